@@ -0,0 +1,214 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+//
+// Usage: ./cfs-cli -m 10.196.0.1:80,10.196.0.2:80 <command> <subcommand> [flags] [args]
+//
+// The master addresses may also be given by the CFS_MASTER environment
+// variable. Requests follow the master leader, so any master may be given.
+//
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+const (
+	CliName    = "cfs-cli"
+	EnvMasters = "CFS_MASTER"
+)
+
+// Command is a node of the command tree. A command either runs itself or
+// dispatches to one of its sub commands.
+type Command struct {
+	Name  string
+	Args  string
+	Short string
+	Flags func(fs *flag.FlagSet)
+	Run   func(args []string) error
+	Subs  []*Command
+}
+
+func (cmd *Command) find(name string) *Command {
+	for _, sub := range cmd.Subs {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+var (
+	masterAddrs string
+	jsonOutput  bool
+	assumeYes   bool
+
+	masterClient masterAPI
+)
+
+// masterAPI is the part of master.MasterClient used by the commands.
+type masterAPI interface {
+	GetCluster() (*master.ClusterView, error)
+	GetCompactStatus() (bool, error)
+	SetCompactStatus(req *master.SetCompactStatusRequest) error
+	SetMetaNodeThreshold(req *master.SetMetaNodeThresholdRequest) error
+
+	GetVol(req *master.VolRequest) (*master.VolView, error)
+	GetVolStat(req *master.VolRequest) (*master.VolStatInfo, error)
+	GetTopDirs(req *master.TopDirsRequest) ([]proto.InodeUsage, error)
+	CreateVol(req *master.CreateVolRequest) error
+	DeleteVol(req *master.VolRequest) error
+
+	GetMetaNode(req *master.NodeRequest) (*master.MetaNodeInfo, error)
+	MetaNodeOffline(req *master.NodeRequest) error
+	BalanceMetaNodes() error
+	GetDataNode(req *master.NodeRequest) (*master.DataNodeInfo, error)
+	DataNodeOffline(req *master.NodeRequest) error
+
+	GetDataPartitions(req *master.VolRequest) (*master.DataPartitionsView, error)
+	GetDataPartition(req *master.GetDataPartitionRequest) (*master.DataPartitionInfo, error)
+	CreateDataPartition(req *master.CreateDataPartitionRequest) error
+	LoadDataPartition(req *master.PartitionRequest) error
+	DataPartitionOffline(req *master.PartitionOfflineRequest) error
+	GetMetaPartition(req *master.PartitionRequest) (*master.MetaPartitionInfo, error)
+	CreateMetaPartition(req *master.CreateMetaPartitionRequest) error
+	MetaPartitionOffline(req *master.PartitionOfflineRequest) error
+	SplitMetaPartition(req *master.SplitMetaPartitionRequest) error
+}
+
+// addGlobalFlags registers the options accepted at every level, so they
+// may be given before or after the command names. The defaults are the
+// values parsed so far so that a later flag set keeps them.
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&masterAddrs, "m", masterAddrs, "comma separated master addresses")
+	fs.BoolVar(&jsonOutput, "json", jsonOutput, "print the result as JSON")
+	fs.BoolVar(&assumeYes, "y", assumeYes, "do not ask for confirmation")
+}
+
+var rootCmd *Command
+
+// The tree is built in init since completion walks it.
+func init() {
+	rootCmd = &Command{
+		Name: CliName,
+		Subs: []*Command{
+			clusterCmd,
+			volCmd,
+			metaNodeCmd,
+			dataNodeCmd,
+			dataPartitionCmd,
+			metaPartitionCmd,
+			completionCmd,
+		},
+	}
+}
+
+func main() {
+	masterAddrs = os.Getenv(EnvMasters)
+	fs := flag.NewFlagSet(CliName, flag.ContinueOnError)
+	addGlobalFlags(fs)
+	fs.Usage = func() { printUsage(rootCmd, nil) }
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if err := execute(rootCmd, nil, fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", CliName, err)
+		os.Exit(1)
+	}
+}
+
+// execute walks down the command tree along args and runs the command it
+// ends on, path holds the names of the commands already walked.
+func execute(cmd *Command, path []string, args []string) error {
+	if cmd.Run == nil {
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			printUsage(cmd, path)
+			return nil
+		}
+		sub := cmd.find(args[0])
+		if sub == nil {
+			printUsage(cmd, path)
+			return fmt.Errorf("unknown command %q", strings.Join(append(path, args[0]), " "))
+		}
+		return execute(sub, append(path, sub.Name), args[1:])
+	}
+	fs := flag.NewFlagSet(strings.Join(path, " "), flag.ContinueOnError)
+	addGlobalFlags(fs)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v %v [flags] %v\n\n%v\n\nFlags:\n", CliName, strings.Join(path, " "), cmd.Args, cmd.Short)
+		fs.PrintDefaults()
+	}
+	if err := parseInterspersed(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	return cmd.Run(fs.Args())
+}
+
+// parseInterspersed parses the flags of fs wherever they appear between
+// the positional arguments, which stay in order in fs.Args().
+func parseInterspersed(fs *flag.FlagSet, args []string) (err error) {
+	positional := make([]string, 0, len(args))
+	for {
+		if err = fs.Parse(args); err != nil {
+			return
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return fs.Parse(positional)
+}
+
+func printUsage(cmd *Command, path []string) {
+	name := strings.Join(append([]string{CliName}, path...), " ")
+	fmt.Fprintf(os.Stderr, "Usage: %v [-m masters] [-json] [-y] <command>\n\nCommands:\n", name)
+	for _, sub := range cmd.Subs {
+		fmt.Fprintf(os.Stderr, "  %-16v %v\n", sub.Name, sub.Short)
+	}
+}
+
+// getMasterClient returns the client of the masters given by -m, it is
+// created on first use so that commands such as completion need none.
+func getMasterClient() (masterAPI, error) {
+	if masterClient != nil {
+		return masterClient, nil
+	}
+	mc := master.NewMasterClient(strings.Split(masterAddrs, ","))
+	if len(mc.Nodes()) == 0 {
+		return nil, fmt.Errorf("no master address, use -m or %v", EnvMasters)
+	}
+	masterClient = mc
+	return masterClient, nil
+}
+
+// usageError reports a wrong number of positional arguments.
+func usageError(want string) error {
+	return fmt.Errorf("wrong arguments, want %v", want)
+}
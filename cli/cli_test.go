@@ -0,0 +1,366 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+// fakeMaster records the requests of the commands which change the
+// cluster, and answers the queries with the views it is given. The methods
+// which are not implemented panic through the nil masterAPI.
+type fakeMaster struct {
+	masterAPI
+	calls   []interface{}
+	cluster *master.ClusterView
+	vol     *master.VolView
+	compact bool
+}
+
+func newFakeMaster() *fakeMaster {
+	return &fakeMaster{
+		cluster: &master.ClusterView{
+			Name:      "test",
+			Vols:      []string{"a", "b"},
+			MetaNodes: []master.MetaNodeView{{ID: 1, Addr: "10.0.0.1:9021", Status: true}, {ID: 12, Addr: "10.0.0.2:9021"}},
+		},
+		vol: &master.VolView{Name: "a", VolType: proto.ExtentPartition, InlineSize: 4096},
+	}
+}
+
+func (m *fakeMaster) GetCluster() (*master.ClusterView, error) { return m.cluster, nil }
+func (m *fakeMaster) GetCompactStatus() (bool, error)          { return m.compact, nil }
+
+func (m *fakeMaster) GetVol(req *master.VolRequest) (*master.VolView, error) {
+	if req.Name != m.vol.Name {
+		return nil, master.ErrVolNotFound
+	}
+	return m.vol, nil
+}
+
+func (m *fakeMaster) SetCompactStatus(req *master.SetCompactStatusRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) SetMetaNodeThreshold(req *master.SetMetaNodeThresholdRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) CreateVol(req *master.CreateVolRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) DeleteVol(req *master.VolRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) MetaNodeOffline(req *master.NodeRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) CreateDataPartition(req *master.CreateDataPartitionRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) DataPartitionOffline(req *master.PartitionOfflineRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+func (m *fakeMaster) SplitMetaPartition(req *master.SplitMetaPartitionRequest) error {
+	m.calls = append(m.calls, *req)
+	return nil
+}
+
+// run runs the command line args against m, with in as the answers of the
+// operator, and returns what the command printed.
+func run(m *fakeMaster, in string, args ...string) (string, error) {
+	jsonOutput, assumeYes = false, false
+	masterClient = m
+	buf := new(bytes.Buffer)
+	output, input = buf, strings.NewReader(in)
+	fs := flag.NewFlagSet(CliName, flag.ContinueOnError)
+	addGlobalFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	err := execute(rootCmd, nil, fs.Args())
+	return buf.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		in    string
+		calls []interface{}
+		out   string
+		err   string
+	}{
+		{
+			name:  "create volume with defaults",
+			args:  []string{"vol", "create", "v1"},
+			calls: []interface{}{master.CreateVolRequest{Name: "v1", Replicas: 3, Type: proto.ExtentPartition}},
+			out:   "created volume v1\n",
+		},
+		{
+			name: "create volume with flags after the name",
+			args: []string{"vol", "create", "-replicas", "2", "v1", "-inline-size", "4096", "-worm-retention", "60"},
+			calls: []interface{}{master.CreateVolRequest{Name: "v1", Replicas: 2, Type: proto.ExtentPartition,
+				Worm: proto.WormPolicy{Retention: 60}, InlineSize: 4096}},
+			out: "created volume v1\n",
+		},
+		{
+			name: "create volume without a name",
+			args: []string{"vol", "create"},
+			err:  "wrong arguments, want <name>",
+		},
+		{
+			name: "create volume with a bad flag",
+			args: []string{"vol", "create", "-replicas", "three", "v1"},
+			err:  `invalid value "three" for flag -replicas`,
+		},
+		{
+			name: "delete volume declined",
+			args: []string{"vol", "delete", "v1"},
+			in:   "n\n",
+			err:  "aborted",
+		},
+		{
+			name:  "delete volume confirmed",
+			args:  []string{"vol", "delete", "v1"},
+			in:    "yes\n",
+			calls: []interface{}{master.VolRequest{Name: "v1"}},
+			out:   "deleted volume v1\n",
+		},
+		{
+			name:  "delete volume with -y before the command",
+			args:  []string{"-y", "vol", "delete", "v1"},
+			calls: []interface{}{master.VolRequest{Name: "v1"}},
+			out:   "deleted volume v1\n",
+		},
+		{
+			name:  "set threshold",
+			args:  []string{"cluster", "threshold", "0.75"},
+			calls: []interface{}{master.SetMetaNodeThresholdRequest{Threshold: 0.75}},
+			out:   "set meta node threshold to 0.75\n",
+		},
+		{
+			name: "set threshold out of range",
+			args: []string{"cluster", "threshold", "1.5"},
+			err:  `invalid threshold "1.5", want a ratio in (0, 1]`,
+		},
+		{
+			name: "show compact status",
+			args: []string{"cluster", "compact"},
+			out:  "false\n",
+		},
+		{
+			name: "show compact status as JSON",
+			args: []string{"cluster", "compact", "-json"},
+			out:  "{\n  \"compact\": false\n}\n",
+		},
+		{
+			name:  "set compact status",
+			args:  []string{"cluster", "compact", "on"},
+			calls: []interface{}{master.SetCompactStatusRequest{Enable: true}},
+			out:   "set compact status to on\n",
+		},
+		{
+			name: "set compact status to a bad value",
+			args: []string{"cluster", "compact", "maybe"},
+			err:  "wrong arguments, want [on|off]",
+		},
+		{
+			name:  "take a meta node offline",
+			args:  []string{"metanode", "offline", "-y", "10.0.0.1:9021"},
+			calls: []interface{}{master.NodeRequest{Addr: "10.0.0.1:9021"}},
+			out:   "meta node 10.0.0.1:9021 is offline\n",
+		},
+		{
+			name:  "create data partitions",
+			args:  []string{"datapartition", "create", "-count", "4", "v1"},
+			calls: []interface{}{master.CreateDataPartitionRequest{Vol: "v1", Count: 4, Type: proto.ExtentPartition}},
+			out:   "created 4 data partitions for volume v1\n",
+		},
+		{
+			name:  "take a data partition replica offline",
+			args:  []string{"-y", "datapartition", "offline", "v1", "7", "10.0.0.3:6000"},
+			calls: []interface{}{master.PartitionOfflineRequest{Vol: "v1", PartitionID: 7, Addr: "10.0.0.3:6000"}},
+			out:   "data partition 7 on 10.0.0.3:6000 is offline\n",
+		},
+		{
+			name:  "split a meta partition",
+			args:  []string{"metapartition", "split", "v1", "5", "1000"},
+			calls: []interface{}{master.SplitMetaPartitionRequest{Vol: "v1", PartitionID: 5, SplitAt: 1000}},
+			out:   "meta partition 5 is being split after inode 1000\n",
+		},
+		{
+			name: "split a meta partition with a bad id",
+			args: []string{"metapartition", "split", "v1", "x", "1000"},
+			err:  `invalid partition id "x"`,
+		},
+		{
+			name: "split a meta partition with a bad start",
+			args: []string{"metapartition", "split", "v1", "5", "end"},
+			err:  `invalid start inode "end"`,
+		},
+		{
+			name: "unknown command",
+			args: []string{"nosuch"},
+			err:  `unknown command "nosuch"`,
+		},
+		{
+			name: "unknown sub command",
+			args: []string{"vol", "nosuch"},
+			err:  `unknown command "vol nosuch"`,
+		},
+		{
+			name: "help of a command",
+			args: []string{"vol", "create", "-h"},
+		},
+	}
+	for _, tt := range tests {
+		m := newFakeMaster()
+		out, err := run(m, tt.in, tt.args...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: err %v, want %q", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(m.calls, tt.calls) {
+			t.Errorf("%v: calls %+v, want %+v", tt.name, m.calls, tt.calls)
+		}
+		if out != tt.out {
+			t.Errorf("%v: output %q, want %q", tt.name, out, tt.out)
+		}
+	}
+}
+
+func TestQueries(t *testing.T) {
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{
+			args: []string{"vol", "list"},
+			out:  "NAME\na\nb\n",
+		},
+		{
+			args: []string{"vol", "list", "-json"},
+			out:  "[\n  {\n    \"name\": \"a\"\n  },\n  {\n    \"name\": \"b\"\n  }\n]\n",
+		},
+		{
+			args: []string{"metanode", "list"},
+			out: "ID  ADDR           STATUS\n" +
+				"1   10.0.0.1:9021  active\n" +
+				"12  10.0.0.2:9021  inactive\n",
+		},
+		{
+			args: []string{"vol", "info", "a"},
+			out: "Name:            a\n" +
+				"Type:            extent\n" +
+				"WormRetention:   0\n" +
+				"WormAutoCommit:  0\n" +
+				"InlineSize:      4.00KB\n" +
+				"MetaPartitions:  0\n" +
+				"DataPartitions:  0\n",
+		},
+	}
+	for _, tt := range tests {
+		out, err := run(newFakeMaster(), "", tt.args...)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if out != tt.out {
+			t.Errorf("%v: output %q, want %q", tt.args, out, tt.out)
+		}
+	}
+
+	if _, err := run(newFakeMaster(), "", "vol", "info", "c"); err != master.ErrVolNotFound {
+		t.Fatalf("info of a missing volume: %v", err)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args  []string
+		count int
+		json  bool
+		rest  []string
+		err   bool
+	}{
+		{args: []string{"a", "b"}, count: 1, rest: []string{"a", "b"}},
+		{args: []string{"a", "-count", "3", "b"}, count: 3, rest: []string{"a", "b"}},
+		{args: []string{"-json", "a", "-count=2"}, count: 2, json: true, rest: []string{"a"}},
+		{args: []string{"a", "--", "-count"}, count: 1, rest: []string{"a", "-count"}},
+		{args: []string{"a", "-count"}, err: true},
+		{args: []string{"-nosuch", "a"}, err: true},
+	}
+	for _, tt := range tests {
+		jsonOutput = false
+		var count int
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(new(bytes.Buffer))
+		addGlobalFlags(fs)
+		fs.IntVar(&count, "count", 1, "")
+		err := parseInterspersed(fs, tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("%v: err %v", tt.args, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if count != tt.count || jsonOutput != tt.json || !reflect.DeepEqual(fs.Args(), tt.rest) {
+			t.Errorf("%v: count %v json %v args %q", tt.args, count, jsonOutput, fs.Args())
+		}
+	}
+	jsonOutput = false
+}
+
+func TestCompletion(t *testing.T) {
+	out, err := run(newFakeMaster(), "", "completion", "bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"") COMPREPLY=($(compgen -W "cluster vol metanode datanode datapartition metapartition completion" -- "$cur")) ;;`,
+		`"vol") COMPREPLY=($(compgen -W "list info stat topdirs create delete" -- "$cur")) ;;`,
+		"complete -F _cfs_cli cfs-cli\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("completion has no %q", want)
+		}
+	}
+	if _, err = run(newFakeMaster(), "", "completion", "fish"); err == nil {
+		t.Fatal("completion for fish")
+	}
+}
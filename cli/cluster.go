@@ -0,0 +1,131 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+var clusterCmd = &Command{
+	Name:  "cluster",
+	Short: "show and tune the cluster",
+	Subs: []*Command{
+		{
+			Name:  "info",
+			Short: "show the cluster overview",
+			Run:   clusterInfo,
+		},
+		{
+			Name:  "compact",
+			Args:  "[on|off]",
+			Short: "show or set the compact status",
+			Run:   clusterCompact,
+		},
+		{
+			Name:  "threshold",
+			Args:  "<ratio>",
+			Short: "set the memory threshold of the meta nodes",
+			Run:   clusterThreshold,
+		},
+	},
+}
+
+func getCluster() (cv *master.ClusterView, err error) {
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	return mc.GetCluster()
+}
+
+func clusterInfo(args []string) (err error) {
+	if len(args) != 0 {
+		return usageError("no arguments")
+	}
+	var cv *master.ClusterView
+	if cv, err = getCluster(); err != nil {
+		return
+	}
+	activeMetaNodes, activeDataNodes := 0, 0
+	for _, mn := range cv.MetaNodes {
+		if mn.Status {
+			activeMetaNodes++
+		}
+	}
+	for _, dn := range cv.DataNodes {
+		if dn.Status {
+			activeDataNodes++
+		}
+	}
+	return printFields(cv, [][2]interface{}{
+		{"Name", cv.Name},
+		{"Leader", cv.LeaderAddr},
+		{"Compact", cv.CompactStatus},
+		{"Applied", cv.Applied},
+		{"Volumes", len(cv.Vols)},
+		{"MetaNodes", fmt.Sprintf("%v/%v active", activeMetaNodes, len(cv.MetaNodes))},
+		{"DataNodes", fmt.Sprintf("%v/%v active", activeDataNodes, len(cv.DataNodes))},
+		{"MaxMetaNodeID", cv.MaxMetaNodeID},
+		{"MaxMetaPartitionID", cv.MaxMetaPartitionID},
+		{"MaxDataPartitionID", cv.MaxDataPartitionID},
+	})
+}
+
+func clusterCompact(args []string) (err error) {
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	switch {
+	case len(args) == 0:
+		var status bool
+		if status, err = mc.GetCompactStatus(); err != nil {
+			return
+		}
+		if jsonOutput {
+			return printJSON(map[string]bool{"compact": status})
+		}
+		fmt.Fprintln(output, status)
+		return nil
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		if err = mc.SetCompactStatus(&master.SetCompactStatusRequest{Enable: args[0] == "on"}); err != nil {
+			return
+		}
+		return printDone("set compact status to %v", args[0])
+	default:
+		return usageError("[on|off]")
+	}
+}
+
+func clusterThreshold(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<ratio>")
+	}
+	var threshold float64
+	if threshold, err = strconv.ParseFloat(args[0], 64); err != nil || threshold <= 0 || threshold > 1 {
+		return fmt.Errorf("invalid threshold %q, want a ratio in (0, 1]", args[0])
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if err = mc.SetMetaNodeThreshold(&master.SetMetaNodeThresholdRequest{Threshold: threshold}); err != nil {
+		return
+	}
+	return printDone("set meta node threshold to %v", threshold)
+}
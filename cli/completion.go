@@ -0,0 +1,90 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+var completionCmd = &Command{
+	Name:  "completion",
+	Args:  "<bash|zsh>",
+	Short: "print the shell completion script",
+	Run:   completion,
+}
+
+func completion(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<bash|zsh>")
+	}
+	buf := new(bytes.Buffer)
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(buf)
+	case "zsh":
+		// zsh runs the bash script through bashcompinit.
+		buf.WriteString("autoload -U +X bashcompinit && bashcompinit\n")
+		writeBashCompletion(buf)
+	default:
+		return usageError("<bash|zsh>")
+	}
+	_, err = output.Write(buf.Bytes())
+	return
+}
+
+// writeBashCompletion writes a completion function which completes the
+// command names by the words typed so far, one case per command having
+// sub commands.
+func writeBashCompletion(buf *bytes.Buffer) {
+	fn := "_" + strings.Replace(CliName, "-", "_", -1)
+	fmt.Fprintf(buf, "%v() {\n", fn)
+	buf.WriteString("    local cur path word i\n")
+	buf.WriteString("    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	buf.WriteString("    path=\"\"\n")
+	buf.WriteString("    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	buf.WriteString("        word=\"${COMP_WORDS[i]}\"\n")
+	buf.WriteString("        case \"$word\" in\n")
+	buf.WriteString("            -m) ((i++)) ;;\n")
+	buf.WriteString("            -*) ;;\n")
+	buf.WriteString("            *) path=\"${path} ${word}\" ;;\n")
+	buf.WriteString("        esac\n")
+	buf.WriteString("    done\n")
+	buf.WriteString("    if [[ \"$cur\" == -* ]]; then\n")
+	buf.WriteString("        COMPREPLY=($(compgen -W \"-m -json -y -h\" -- \"$cur\"))\n")
+	buf.WriteString("        return\n")
+	buf.WriteString("    fi\n")
+	buf.WriteString("    case \"${path# }\" in\n")
+	writeBashCases(buf, rootCmd, nil)
+	buf.WriteString("    esac\n")
+	buf.WriteString("}\n")
+	fmt.Fprintf(buf, "complete -F %v %v\n", fn, CliName)
+}
+
+func writeBashCases(buf *bytes.Buffer, cmd *Command, path []string) {
+	if len(cmd.Subs) == 0 {
+		return
+	}
+	names := make([]string, 0, len(cmd.Subs))
+	for _, sub := range cmd.Subs {
+		names = append(names, sub.Name)
+	}
+	fmt.Fprintf(buf, "        %q) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n",
+		strings.Join(path, " "), strings.Join(names, " "))
+	for _, sub := range cmd.Subs {
+		writeBashCases(buf, sub, append(path, sub.Name))
+	}
+}
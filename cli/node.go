@@ -0,0 +1,209 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+var metaNodeCmd = &Command{
+	Name:  "metanode",
+	Short: "manage meta nodes",
+	Subs: []*Command{
+		{
+			Name:  "list",
+			Short: "list the meta nodes",
+			Run:   metaNodeList,
+		},
+		{
+			Name:  "info",
+			Args:  "<addr>",
+			Short: "show a meta node",
+			Run:   metaNodeInfo,
+		},
+		{
+			Name:  "offline",
+			Args:  "<addr>",
+			Short: "take a meta node offline and migrate its partitions",
+			Run:   metaNodeOffline,
+		},
+		{
+			Name:  "balance",
+			Short: "move a meta partition replica to the least loaded meta node",
+			Run:   metaNodeBalance,
+		},
+	},
+}
+
+var dataNodeCmd = &Command{
+	Name:  "datanode",
+	Short: "manage data nodes",
+	Subs: []*Command{
+		{
+			Name:  "list",
+			Short: "list the data nodes",
+			Run:   dataNodeList,
+		},
+		{
+			Name:  "info",
+			Args:  "<addr>",
+			Short: "show a data node",
+			Run:   dataNodeInfo,
+		},
+		{
+			Name:  "offline",
+			Args:  "<addr>",
+			Short: "take a data node offline and migrate its partitions",
+			Run:   dataNodeOffline,
+		},
+	},
+}
+
+func nodeStatus(active bool) string {
+	if active {
+		return "active"
+	}
+	return "inactive"
+}
+
+func metaNodeList(args []string) (err error) {
+	if len(args) != 0 {
+		return usageError("no arguments")
+	}
+	var cv *master.ClusterView
+	if cv, err = getCluster(); err != nil {
+		return
+	}
+	t := newTable("id", "addr", "status")
+	for _, mn := range cv.MetaNodes {
+		t.add(mn.ID, mn.Addr, nodeStatus(mn.Status))
+	}
+	return t.print()
+}
+
+func metaNodeInfo(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<addr>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	var mn *master.MetaNodeInfo
+	if mn, err = mc.GetMetaNode(&master.NodeRequest{Addr: args[0]}); err != nil {
+		return
+	}
+	return printFields(mn, [][2]interface{}{
+		{"ID", mn.ID},
+		{"Addr", mn.Addr},
+		{"Status", nodeStatus(mn.IsActive)},
+		{"Rack", mn.RackName},
+		{"Total", formatSize(mn.Total)},
+		{"Used", formatSize(mn.Used)},
+		{"Ratio", fmt.Sprintf("%.2f", mn.Ratio)},
+		{"Threshold", mn.Threshold},
+		{"MetaPartitions", mn.MetaPartitionCount},
+		{"ReportTime", mn.ReportTime},
+	})
+}
+
+func metaNodeOffline(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<addr>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if !confirm("Take meta node %v offline and migrate all of its partitions?", args[0]) {
+		return errAborted
+	}
+	if err = mc.MetaNodeOffline(&master.NodeRequest{Addr: args[0]}); err != nil {
+		return
+	}
+	return printDone("meta node %v is offline", args[0])
+}
+
+func metaNodeBalance(args []string) (err error) {
+	if len(args) != 0 {
+		return usageError("no arguments")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if err = mc.BalanceMetaNodes(); err != nil {
+		return
+	}
+	return printDone("moved a meta partition replica to the least loaded meta node")
+}
+
+func dataNodeList(args []string) (err error) {
+	if len(args) != 0 {
+		return usageError("no arguments")
+	}
+	var cv *master.ClusterView
+	if cv, err = getCluster(); err != nil {
+		return
+	}
+	t := newTable("addr", "status")
+	for _, dn := range cv.DataNodes {
+		t.add(dn.Addr, nodeStatus(dn.Status))
+	}
+	return t.print()
+}
+
+func dataNodeInfo(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<addr>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	var dn *master.DataNodeInfo
+	if dn, err = mc.GetDataNode(&master.NodeRequest{Addr: args[0]}); err != nil {
+		return
+	}
+	return printFields(dn, [][2]interface{}{
+		{"Addr", dn.Addr},
+		{"Rack", dn.RackName},
+		{"Total", formatSize(dn.Total)},
+		{"Used", formatSize(dn.Used)},
+		{"Available", formatSize(dn.Available)},
+		{"Ratio", fmt.Sprintf("%.2f", dn.Ratio)},
+		{"DataPartitions", dn.DataPartitionCount},
+		{"ReportTime", dn.ReportTime},
+	})
+}
+
+func dataNodeOffline(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<addr>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if !confirm("Take data node %v offline and migrate all of its partitions?", args[0]) {
+		return errAborted
+	}
+	if err = mc.DataNodeOffline(&master.NodeRequest{Addr: args[0]}); err != nil {
+		return
+	}
+	return printDone("data node %v is offline", args[0])
+}
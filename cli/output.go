@@ -0,0 +1,135 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// The results are printed to output, and the answers of the operator are
+// read from input.
+var (
+	output io.Writer = os.Stdout
+	input  io.Reader = os.Stdin
+)
+
+// table collects rows and prints them aligned, or as a JSON array of
+// objects keyed by the column names when -json is given.
+type table struct {
+	header []string
+	rows   [][]interface{}
+}
+
+func newTable(header ...string) *table {
+	return &table{header: header}
+}
+
+func (t *table) add(cells ...interface{}) {
+	t.rows = append(t.rows, cells)
+}
+
+func (t *table) print() error {
+	if jsonOutput {
+		objects := make([]map[string]interface{}, 0, len(t.rows))
+		for _, row := range t.rows {
+			object := make(map[string]interface{}, len(t.header))
+			for i, name := range t.header {
+				if i < len(row) {
+					object[name] = row[i]
+				}
+			}
+			objects = append(objects, object)
+		}
+		return printJSON(objects)
+	}
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(t.header, "\t")))
+	for _, row := range t.rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprint(cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+// printJSON prints v indented, it is the output of every command run
+// with -json.
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output, string(data))
+	return nil
+}
+
+// printFields prints name value pairs one per line, or v as JSON when
+// -json is given.
+func printFields(v interface{}, fields [][2]interface{}) error {
+	if jsonOutput {
+		return printJSON(v)
+	}
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	for _, field := range fields {
+		fmt.Fprintf(w, "%v:\t%v\n", field[0], field[1])
+	}
+	return w.Flush()
+}
+
+// printDone reports a successful action.
+func printDone(format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if jsonOutput {
+		return printJSON(map[string]string{"message": msg})
+	}
+	fmt.Fprintln(output, msg)
+	return nil
+}
+
+// confirm asks the operator before a destructive action, it is skipped
+// with -y.
+func confirm(format string, a ...interface{}) bool {
+	if assumeYes {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, format+" [y/N]: ", a...)
+	answer, _ := bufio.NewReader(input).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+var errAborted = fmt.Errorf("aborted")
+
+func formatSize(size uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%v", size, units[i])
+	}
+	return fmt.Sprintf("%.2f%v", value, units[i])
+}
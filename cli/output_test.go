@@ -0,0 +1,129 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// capture runs fn with output going to a buffer and -json set to json, and
+// returns what it printed.
+func capture(t *testing.T, json bool, fn func() error) string {
+	buf := new(bytes.Buffer)
+	output, jsonOutput = buf, json
+	defer func() { jsonOutput = false }()
+	if err := fn(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.00KB"},
+		{1536 * 1024, "1.50MB"},
+		{10 << 30, "10.00GB"},
+		{1 << 40, "1.00TB"},
+		{1 << 60, "1024.00PB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.size); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	tab := newTable("id", "name")
+	tab.add(1, "a")
+	tab.add(100, "bb")
+	out := capture(t, false, tab.print)
+	if want := "ID   NAME\n1    a\n100  bb\n"; out != want {
+		t.Fatalf("text %q, want %q", out, want)
+	}
+	out = capture(t, true, tab.print)
+	want := `[
+  {
+    "id": 1,
+    "name": "a"
+  },
+  {
+    "id": 100,
+    "name": "bb"
+  }
+]
+`
+	if out != want {
+		t.Fatalf("JSON %q, want %q", out, want)
+	}
+	if out = capture(t, true, newTable("id").print); out != "[]\n" {
+		t.Fatalf("empty JSON %q", out)
+	}
+}
+
+func TestPrintFields(t *testing.T) {
+	v := struct {
+		Name string `json:"name"`
+		Size uint64 `json:"size"`
+	}{"a", 2048}
+	fields := [][2]interface{}{{"Name", v.Name}, {"Size", formatSize(v.Size)}}
+	print := func() error { return printFields(v, fields) }
+	if out, want := capture(t, false, print), "Name:  a\nSize:  2.00KB\n"; out != want {
+		t.Fatalf("text %q, want %q", out, want)
+	}
+	if out, want := capture(t, true, print), "{\n  \"name\": \"a\",\n  \"size\": 2048\n}\n"; out != want {
+		t.Fatalf("JSON %q, want %q", out, want)
+	}
+}
+
+func TestPrintDone(t *testing.T) {
+	done := func() error { return printDone("deleted volume %v", "a") }
+	if out := capture(t, false, done); out != "deleted volume a\n" {
+		t.Fatalf("text %q", out)
+	}
+	if out := capture(t, true, done); out != "{\n  \"message\": \"deleted volume a\"\n}\n" {
+		t.Fatalf("JSON %q", out)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		in   string
+		yes  bool
+		want bool
+	}{
+		{"y\n", false, true},
+		{" YES \n", false, true},
+		{"n\n", false, false},
+		{"\n", false, false},
+		{"", false, false},
+		{"yep\n", false, false},
+		{"", true, true},
+	}
+	for _, tt := range tests {
+		input, assumeYes = strings.NewReader(tt.in), tt.yes
+		if got := confirm("delete %v?", "a"); got != tt.want {
+			t.Errorf("confirm with %q, -y %v = %v", tt.in, tt.yes, got)
+		}
+	}
+	assumeYes = false
+}
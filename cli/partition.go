@@ -0,0 +1,356 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+var (
+	dpCreateCount int
+	dpCreateType  string
+)
+
+var dataPartitionCmd = &Command{
+	Name:  "datapartition",
+	Short: "manage data partitions",
+	Subs: []*Command{
+		{
+			Name:  "list",
+			Args:  "<vol>",
+			Short: "list the data partitions of a volume",
+			Run:   dataPartitionList,
+		},
+		{
+			Name:  "info",
+			Args:  "<id>",
+			Short: "show a data partition and its replicas",
+			Run:   dataPartitionInfo,
+		},
+		{
+			Name:  "create",
+			Args:  "<vol>",
+			Short: "create data partitions for a volume",
+			Flags: func(fs *flag.FlagSet) {
+				fs.IntVar(&dpCreateCount, "count", 1, "number of data partitions to create")
+				fs.StringVar(&dpCreateType, "type", proto.ExtentPartition, "data partition type, extent or blob")
+			},
+			Run: dataPartitionCreate,
+		},
+		{
+			Name:  "load",
+			Args:  "<vol> <id>",
+			Short: "load a data partition and check its replicas",
+			Run:   dataPartitionLoad,
+		},
+		{
+			Name:  "offline",
+			Args:  "<vol> <id> <addr>",
+			Short: "take a replica of a data partition offline",
+			Run:   dataPartitionOffline,
+		},
+	},
+}
+
+var metaPartitionCmd = &Command{
+	Name:  "metapartition",
+	Short: "manage meta partitions",
+	Subs: []*Command{
+		{
+			Name:  "list",
+			Args:  "<vol>",
+			Short: "list the meta partitions of a volume",
+			Run:   metaPartitionList,
+		},
+		{
+			Name:  "info",
+			Args:  "<vol> <id>",
+			Short: "show a meta partition and its replicas",
+			Run:   metaPartitionInfo,
+		},
+		{
+			Name:  "create",
+			Args:  "<vol> <start>",
+			Short: "split the last meta partition of a volume at start",
+			Run:   metaPartitionCreate,
+		},
+		{
+			Name:  "offline",
+			Args:  "<vol> <id> <addr>",
+			Short: "take a replica of a meta partition offline",
+			Run:   metaPartitionOffline,
+		},
+		{
+			Name:  "split",
+			Args:  "<vol> <id> <start>",
+			Short: "move the inodes after start to a new meta partition",
+			Run:   metaPartitionSplit,
+		},
+	},
+}
+
+func parseID(value string) (id uint64, err error) {
+	if id, err = strconv.ParseUint(value, 10, 64); err != nil {
+		err = fmt.Errorf("invalid partition id %q", value)
+	}
+	return
+}
+
+func dataPartitionList(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<vol>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	var view *master.DataPartitionsView
+	if view, err = mc.GetDataPartitions(&master.VolRequest{Name: args[0]}); err != nil {
+		return
+	}
+	t := newTable("id", "type", "status", "replicas", "hosts")
+	for _, dp := range view.DataPartitions {
+		t.add(dp.PartitionID, dp.PartitionType, dp.Status, dp.ReplicaNum, strings.Join(dp.Hosts, ","))
+	}
+	return t.print()
+}
+
+func dataPartitionInfo(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<id>")
+	}
+	var (
+		mc masterAPI
+		id uint64
+		dp *master.DataPartitionInfo
+	)
+	if id, err = parseID(args[0]); err != nil {
+		return
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if dp, err = mc.GetDataPartition(&master.GetDataPartitionRequest{PartitionID: id}); err != nil {
+		return
+	}
+	if jsonOutput {
+		return printJSON(dp)
+	}
+	if err = printFields(dp, [][2]interface{}{
+		{"ID", dp.PartitionID},
+		{"Vol", dp.VolName},
+		{"Type", dp.PartitionType},
+		{"Status", dp.Status},
+		{"ReplicaNum", dp.ReplicaNum},
+		{"Hosts", strings.Join(dp.PersistenceHosts, ",")},
+	}); err != nil {
+		return
+	}
+	fmt.Fprintln(output)
+	t := newTable("addr", "status", "files", "total", "used", "reportTime")
+	for _, replica := range dp.Replicas {
+		t.add(replica.Addr, replica.Status, replica.FileCount, formatSize(replica.Total), formatSize(replica.Used), replica.ReportTime)
+	}
+	return t.print()
+}
+
+func dataPartitionCreate(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<vol>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	req := &master.CreateDataPartitionRequest{Vol: args[0], Count: dpCreateCount, Type: dpCreateType}
+	if err = mc.CreateDataPartition(req); err != nil {
+		return
+	}
+	return printDone("created %v data partitions for volume %v", dpCreateCount, args[0])
+}
+
+func dataPartitionLoad(args []string) (err error) {
+	if len(args) != 2 {
+		return usageError("<vol> <id>")
+	}
+	var (
+		mc masterAPI
+		id uint64
+	)
+	if id, err = parseID(args[1]); err != nil {
+		return
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if err = mc.LoadDataPartition(&master.PartitionRequest{Vol: args[0], PartitionID: id}); err != nil {
+		return
+	}
+	return printDone("loaded data partition %v", id)
+}
+
+func dataPartitionOffline(args []string) (err error) {
+	if len(args) != 3 {
+		return usageError("<vol> <id> <addr>")
+	}
+	var (
+		mc masterAPI
+		id uint64
+	)
+	if id, err = parseID(args[1]); err != nil {
+		return
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if !confirm("Take the replica of data partition %v on %v offline?", id, args[2]) {
+		return errAborted
+	}
+	req := &master.PartitionOfflineRequest{Vol: args[0], PartitionID: id, Addr: args[2]}
+	if err = mc.DataPartitionOffline(req); err != nil {
+		return
+	}
+	return printDone("data partition %v on %v is offline", id, args[2])
+}
+
+func metaPartitionList(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<vol>")
+	}
+	var view *master.VolView
+	if view, err = getVol(args[0]); err != nil {
+		return
+	}
+	t := newTable("id", "start", "end", "status", "leader", "members")
+	for _, mp := range view.MetaPartitions {
+		t.add(mp.PartitionID, mp.Start, mp.End, mp.Status, mp.LeaderAddr, strings.Join(mp.Members, ","))
+	}
+	return t.print()
+}
+
+func metaPartitionInfo(args []string) (err error) {
+	if len(args) != 2 {
+		return usageError("<vol> <id>")
+	}
+	var (
+		mc masterAPI
+		id uint64
+		mp *master.MetaPartitionInfo
+	)
+	if id, err = parseID(args[1]); err != nil {
+		return
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if mp, err = mc.GetMetaPartition(&master.PartitionRequest{Vol: args[0], PartitionID: id}); err != nil {
+		return
+	}
+	if jsonOutput {
+		return printJSON(mp)
+	}
+	if err = printFields(mp, [][2]interface{}{
+		{"ID", mp.PartitionID},
+		{"Start", mp.Start},
+		{"End", mp.End},
+		{"MaxInode", mp.MaxNodeID},
+		{"Status", mp.Status},
+		{"ReplicaNum", mp.ReplicaNum},
+		{"Hosts", strings.Join(mp.PersistenceHosts, ",")},
+	}); err != nil {
+		return
+	}
+	fmt.Fprintln(output)
+	t := newTable("addr", "status", "leader", "reportTime")
+	for _, replica := range mp.Replicas {
+		t.add(replica.Addr, replica.Status, replica.IsLeader, replica.ReportTime)
+	}
+	return t.print()
+}
+
+func metaPartitionCreate(args []string) (err error) {
+	if len(args) != 2 {
+		return usageError("<vol> <start>")
+	}
+	var (
+		mc    masterAPI
+		start uint64
+	)
+	if start, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+		return fmt.Errorf("invalid start inode %q", args[1])
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if err = mc.CreateMetaPartition(&master.CreateMetaPartitionRequest{Vol: args[0], Start: start}); err != nil {
+		return
+	}
+	return printDone("created meta partition of volume %v from inode %v", args[0], start)
+}
+
+func metaPartitionOffline(args []string) (err error) {
+	if len(args) != 3 {
+		return usageError("<vol> <id> <addr>")
+	}
+	var (
+		mc masterAPI
+		id uint64
+	)
+	if id, err = parseID(args[1]); err != nil {
+		return
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if !confirm("Take the replica of meta partition %v on %v offline?", id, args[2]) {
+		return errAborted
+	}
+	req := &master.PartitionOfflineRequest{Vol: args[0], PartitionID: id, Addr: args[2]}
+	if err = mc.MetaPartitionOffline(req); err != nil {
+		return
+	}
+	return printDone("meta partition %v on %v is offline", id, args[2])
+}
+
+func metaPartitionSplit(args []string) (err error) {
+	if len(args) != 3 {
+		return usageError("<vol> <id> <start>")
+	}
+	var (
+		mc    masterAPI
+		id    uint64
+		start uint64
+	)
+	if id, err = parseID(args[1]); err != nil {
+		return
+	}
+	if start, err = strconv.ParseUint(args[2], 10, 64); err != nil {
+		return fmt.Errorf("invalid start inode %q", args[2])
+	}
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	req := &master.SplitMetaPartitionRequest{Vol: args[0], PartitionID: id, SplitAt: start}
+	if err = mc.SplitMetaPartition(req); err != nil {
+		return
+	}
+	return printDone("meta partition %v is being split after inode %v", id, start)
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+var (
+	volReplicas       int
+	volType           string
+	volWormRetention  int64
+	volWormAutoCommit int64
+	volInlineSize     uint
+	volTopDirsCount   int
+)
+
+var volCmd = &Command{
+	Name:  "vol",
+	Short: "manage volumes",
+	Subs: []*Command{
+		{
+			Name:  "list",
+			Short: "list the volumes",
+			Run:   volList,
+		},
+		{
+			Name:  "info",
+			Args:  "<name>",
+			Short: "show the partitions of a volume",
+			Run:   volInfo,
+		},
+		{
+			Name:  "stat",
+			Args:  "<name>",
+			Short: "show the space usage of a volume",
+			Run:   volStat,
+		},
+		{
+			Name:  "topdirs",
+			Args:  "<name>",
+			Short: "show the largest directories of a volume",
+			Flags: func(fs *flag.FlagSet) {
+				fs.IntVar(&volTopDirsCount, "count", 10, "number of directories")
+			},
+			Run: volTopDirs,
+		},
+		{
+			Name:  "create",
+			Args:  "<name>",
+			Short: "create a volume",
+			Flags: func(fs *flag.FlagSet) {
+				fs.IntVar(&volReplicas, "replicas", 3, "replica number of the partitions")
+				fs.StringVar(&volType, "type", proto.ExtentPartition, "data partition type, extent or blob")
+				fs.Int64Var(&volWormRetention, "worm-retention", 0, "WORM retention period in seconds, 0 disables WORM")
+				fs.Int64Var(&volWormAutoCommit, "worm-autocommit", 0, "WORM auto commit period in seconds")
+				fs.UintVar(&volInlineSize, "inline-size", 0, "size up to which files are kept inline in their inodes, 0 disables it")
+			},
+			Run: volCreate,
+		},
+		{
+			Name:  "delete",
+			Args:  "<name>",
+			Short: "delete a volume",
+			Run:   volDelete,
+		},
+	},
+}
+
+func volList(args []string) (err error) {
+	if len(args) != 0 {
+		return usageError("no arguments")
+	}
+	var cv *master.ClusterView
+	if cv, err = getCluster(); err != nil {
+		return
+	}
+	t := newTable("name")
+	for _, name := range cv.Vols {
+		t.add(name)
+	}
+	return t.print()
+}
+
+func getVol(name string) (view *master.VolView, err error) {
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	return mc.GetVol(&master.VolRequest{Name: name})
+}
+
+func volInfo(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<name>")
+	}
+	var view *master.VolView
+	if view, err = getVol(args[0]); err != nil {
+		return
+	}
+	return printFields(view, [][2]interface{}{
+		{"Name", view.Name},
+		{"Type", view.VolType},
+		{"WormRetention", view.Worm.Retention},
+		{"WormAutoCommit", view.Worm.AutoCommit},
+		{"InlineSize", formatSize(uint64(view.InlineSize))},
+		{"MetaPartitions", len(view.MetaPartitions)},
+		{"DataPartitions", len(view.DataPartitions)},
+	})
+}
+
+func volStat(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<name>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	var stat *master.VolStatInfo
+	if stat, err = mc.GetVolStat(&master.VolRequest{Name: args[0]}); err != nil {
+		return
+	}
+	return printFields(stat, [][2]interface{}{
+		{"Name", stat.Name},
+		{"Total", formatSize(stat.TotalSize)},
+		{"Used", formatSize(stat.UsedSize)},
+	})
+}
+
+func volTopDirs(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<name>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	var dirs []proto.InodeUsage
+	if dirs, err = mc.GetTopDirs(&master.TopDirsRequest{Name: args[0], Count: volTopDirsCount}); err != nil {
+		return
+	}
+	t := newTable("inode", "bytes", "files", "dirs")
+	for _, dir := range dirs {
+		t.add(dir.Inode, formatSize(uint64(dir.Bytes)), dir.Files, dir.Dirs)
+	}
+	return t.print()
+}
+
+func volCreate(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<name>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	req := &master.CreateVolRequest{
+		Name:     args[0],
+		Replicas: volReplicas,
+		Type:     volType,
+		Worm:     proto.WormPolicy{Retention: volWormRetention, AutoCommit: volWormAutoCommit},
+		// The master rejects sizes beyond proto.MaxInlineSize.
+		InlineSize: uint32(volInlineSize),
+	}
+	if err = mc.CreateVol(req); err != nil {
+		return
+	}
+	return printDone("created volume %v", args[0])
+}
+
+func volDelete(args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("<name>")
+	}
+	var mc masterAPI
+	if mc, err = getMasterClient(); err != nil {
+		return
+	}
+	if !confirm("Delete volume %v and all of its data?", args[0]) {
+		return errAborted
+	}
+	if err = mc.DeleteVol(&master.VolRequest{Name: args[0]}); err != nil {
+		return
+	}
+	return printDone("deleted volume %v", args[0])
+}
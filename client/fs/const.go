@@ -15,6 +15,7 @@
 package fs
 
 import (
+	"math"
 	"syscall"
 	"time"
 
@@ -55,6 +56,30 @@ const (
 	DeleteExtentsTimeout = 600 * time.Second
 )
 
+// The ioctl commands used by chattr(1), lsattr(1) and cp --reflink. The
+// argument size encoded in the command differs between kernels, so only the
+// type and number of a command are compared.
+const (
+	IoctlCmdMask  = 0xffff
+	IoctlGetFlags = 0x6601 // FS_IOC_GETFLAGS
+	IoctlSetFlags = 0x6602 // FS_IOC_SETFLAGS
+
+	IoctlClone      = 0x9409 // FICLONE
+	IoctlCloneRange = 0x940d // FICLONERANGE
+)
+
+// MaxCopySize is the most bytes cloned by one copy_file_range(2), the
+// reply holds the size in 32 bits.
+const MaxCopySize = uint64(math.MaxUint32 &^ (DefaultBlksize - 1))
+
+// Virtual extended attributes of a directory, the recursive usage of its
+// tree kept by the meta nodes.
+const (
+	XattrDirBytes   = "cfs.dir.rbytes"
+	XattrDirFiles   = "cfs.dir.rfiles"
+	XattrDirSubdirs = "cfs.dir.rsubdirs"
+)
+
 func ParseError(err error) fuse.Errno {
 	switch v := err.(type) {
 	case syscall.Errno:
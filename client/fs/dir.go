@@ -16,6 +16,7 @@ package fs
 
 import (
 	"os"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -295,8 +296,36 @@ func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.
 	return newFile, nil
 }
 
+// Getxattr answers the virtual attributes of the directory usage. The
+// other attributes are reported missing rather than unsupported, which
+// would make the kernel stop asking for any attribute.
 func (d *Dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ENOSYS
+	switch req.Name {
+	case XattrDirBytes, XattrDirFiles, XattrDirSubdirs:
+	default:
+		return fuse.ErrNoXattr
+	}
+	ino := d.inode.ino
+	info, err := d.super.mw.InodeGet_ll(ino)
+	if err != nil {
+		log.LogErrorf("Getxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	if info.Usage == nil {
+		return fuse.ErrNoXattr
+	}
+	var value int64
+	switch req.Name {
+	case XattrDirBytes:
+		value = info.Usage.Bytes
+	case XattrDirFiles:
+		value = info.Usage.Files
+	case XattrDirSubdirs:
+		value = info.Usage.Dirs
+	}
+	resp.Xattr = []byte(strconv.FormatInt(value, 10))
+	log.LogDebugf("TRACE Getxattr: ino(%v) name(%v) value(%v)", ino, req.Name, value)
+	return nil
 }
 
 func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
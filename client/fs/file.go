@@ -15,7 +15,11 @@
 package fs
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
+	"syscall"
 	"time"
 
 	"github.com/tiglabs/containerfs/fuse"
@@ -37,21 +41,24 @@ type File struct {
 
 //functions that File needs to implement
 var (
-	_ fs.Node              = (*File)(nil)
-	_ fs.Handle            = (*File)(nil)
-	_ fs.NodeForgetter     = (*File)(nil)
-	_ fs.NodeOpener        = (*File)(nil)
-	_ fs.HandleReleaser    = (*File)(nil)
-	_ fs.HandleReader      = (*File)(nil)
-	_ fs.HandleWriter      = (*File)(nil)
-	_ fs.HandleFlusher     = (*File)(nil)
-	_ fs.NodeFsyncer       = (*File)(nil)
-	_ fs.NodeSetattrer     = (*File)(nil)
-	_ fs.NodeReadlinker    = (*File)(nil)
-	_ fs.NodeGetxattrer    = (*File)(nil)
-	_ fs.NodeListxattrer   = (*File)(nil)
-	_ fs.NodeSetxattrer    = (*File)(nil)
-	_ fs.NodeRemovexattrer = (*File)(nil)
+	_ fs.Node                 = (*File)(nil)
+	_ fs.Handle               = (*File)(nil)
+	_ fs.NodeForgetter        = (*File)(nil)
+	_ fs.NodeOpener           = (*File)(nil)
+	_ fs.HandleReleaser       = (*File)(nil)
+	_ fs.HandleReader         = (*File)(nil)
+	_ fs.HandleWriter         = (*File)(nil)
+	_ fs.HandleFlusher        = (*File)(nil)
+	_ fs.HandleFallocater     = (*File)(nil)
+	_ fs.HandleCopyFileRanger = (*File)(nil)
+	_ fs.HandleIoctler        = (*File)(nil)
+	_ fs.NodeFsyncer          = (*File)(nil)
+	_ fs.NodeSetattrer        = (*File)(nil)
+	_ fs.NodeReadlinker       = (*File)(nil)
+	_ fs.NodeGetxattrer       = (*File)(nil)
+	_ fs.NodeListxattrer      = (*File)(nil)
+	_ fs.NodeSetxattrer       = (*File)(nil)
+	_ fs.NodeRemovexattrer    = (*File)(nil)
 )
 
 func (f *File) getReadStream() (r *stream.StreamReader) {
@@ -117,7 +124,15 @@ func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenR
 		return nil, ParseError(err)
 	}
 
-	f.super.ec.OpenForWrite(ino, inode.size)
+	if !req.Flags.IsReadOnly() {
+		if inode.isImmutable() || inode.isWormCommitted() ||
+			(inode.isAppendOnly() && req.Flags&fuse.OpenAppend == 0) {
+			log.LogWarnf("Open: ino(%v) req(%v) flags(%#x) not permitted", ino, req, inode.flags)
+			return nil, fuse.EPERM
+		}
+	}
+
+	f.super.ec.OpenForWrite(ino, inode.dataSize())
 
 	elapsed := time.Since(start)
 	log.LogDebugf("TRACE Open: ino(%v) flags(%v) (%v)ns", ino, req.Flags, elapsed.Nanoseconds())
@@ -140,6 +155,14 @@ func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) (err error
 		return fuse.EIO
 	}
 
+	// Files of a WORM volume are committed once they are written and closed.
+	if !req.Flags.IsReadOnly() && f.super.mw.Worm().Enabled() {
+		if err = f.super.mw.WormCommit(ino); err != nil {
+			log.LogErrorf("Release: worm commit failed, ino(%v) req(%v) err(%v)", ino, req, err)
+			return ParseError(err)
+		}
+	}
+
 	f.super.ic.Delete(ino)
 	elapsed := time.Since(start)
 	log.LogDebugf("TRACE Release: ino(%v) req(%v) (%v)ns", ino, req, elapsed.Nanoseconds())
@@ -186,6 +209,25 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 		f.super.ic.Delete(f.inode.ino)
 	}()
 
+	inode, err := f.super.InodeGet(f.inode.ino)
+	if err != nil {
+		log.LogErrorf("Write: ino(%v) err(%v)", f.inode.ino, err)
+		return ParseError(err)
+	}
+	if inode.isImmutable() || inode.isWormCommitted() {
+		return fuse.EPERM
+	}
+	if inode.isAppendOnly() {
+		size := inode.dataSize()
+		if writeSize := f.super.ec.GetWriteSize(f.inode.ino); writeSize > size {
+			size = writeSize
+		}
+		if uint64(req.Offset) != size {
+			log.LogWarnf("Write: ino(%v) offset(%v) size(%v) append only", f.inode.ino, req.Offset, size)
+			return fuse.EPERM
+		}
+	}
+
 	start := time.Now()
 	size, err := f.super.ec.Write(f.inode.ino, int(req.Offset), req.Data)
 	if err != nil {
@@ -207,6 +249,231 @@ func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
 	return fuse.ENOSYS
 }
 
+func (f *File) Fallocate(ctx context.Context, req *fuse.FallocateRequest) (err error) {
+	ino := f.inode.ino
+	start := time.Now()
+	switch req.Mode {
+	case 0, fuse.FallocateKeepSize:
+		// The space is reserved by the extents written next. Without
+		// FALLOC_FL_KEEP_SIZE the file is extended too, the data appended
+		// then takes the place of the unwritten space.
+		end := req.Offset + req.Length
+		if err = f.super.ec.Preallocate(ino, end); err != nil {
+			log.LogErrorf("Fallocate: preallocate ino(%v) req(%v) err(%v)", ino, req, err)
+			return fuse.EIO
+		}
+		if req.Mode&fuse.FallocateKeepSize != 0 {
+			break
+		}
+		inode, err := f.super.InodeGet(ino)
+		if err != nil {
+			log.LogErrorf("Fallocate: ino(%v) err(%v)", ino, err)
+			return ParseError(err)
+		}
+		if end <= inode.size || end <= f.super.ec.GetWriteSize(ino) {
+			break
+		}
+		if err = f.super.mw.Allocate(ino, end); err != nil {
+			log.LogErrorf("Fallocate: allocate ino(%v) req(%v) err(%v)", ino, req, err)
+			if err == syscall.EINVAL {
+				// An inline file is not extended.
+				return fuse.Errno(syscall.EOPNOTSUPP)
+			}
+			return ParseError(err)
+		}
+		f.super.ic.Delete(ino)
+	case fuse.FallocatePunchHole | fuse.FallocateKeepSize:
+		if err = f.super.ec.Seal(ino); err != nil {
+			log.LogErrorf("Fallocate: seal ino(%v) req(%v) err(%v)", ino, req, err)
+			return fuse.EIO
+		}
+		if err = f.super.mw.PunchHole(ino, req.Offset, req.Length); err != nil {
+			log.LogErrorf("Fallocate: punch hole ino(%v) req(%v) err(%v)", ino, req, err)
+			return ParseError(err)
+		}
+		f.super.ic.Delete(ino)
+		f.setReadStream(nil)
+	default:
+		return fuse.Errno(syscall.EOPNOTSUPP)
+	}
+
+	elapsed := time.Since(start)
+	log.LogDebugf("TRACE Fallocate: ino(%v) req(%v) (%v)ns", ino, req, elapsed.Nanoseconds())
+	return nil
+}
+
+// CopyFileRange clones the range by sharing extents when it is appended to
+// the data of the destination. Other copies are left to the kernel, which
+// falls back to reading and writing the data.
+func (f *File) CopyFileRange(ctx context.Context, req *fuse.CopyFileRangeRequest, resp *fuse.CopyFileRangeResponse, dst fs.Handle) (err error) {
+	ino := f.inode.ino
+	start := time.Now()
+	df, ok := dst.(*File)
+	if !ok || req.Flags != 0 {
+		return fuse.Errno(syscall.EOPNOTSUPP)
+	}
+	// The reply holds the copied size in 32 bits, the kernel asks again
+	// for the rest.
+	size := req.Len
+	if size > MaxCopySize {
+		size = MaxCopySize
+	}
+	n, err := df.clone(ino, req.Offset, req.OffsetOut, size)
+	if err != nil {
+		return err
+	}
+	resp.Size = int(n)
+
+	elapsed := time.Since(start)
+	log.LogDebugf("TRACE CopyFileRange: ino(%v) req(%v) size(%v) (%v)ns", ino, req, n, elapsed.Nanoseconds())
+	return nil
+}
+
+// clone makes the file share size bytes at srcOffset of inode ino, appended
+// at dstOffset, which has to be the end of the data of the file. It returns
+// the number of bytes cloned, less than size at the end of ino.
+func (f *File) clone(ino, srcOffset, dstOffset, size uint64) (uint64, error) {
+	dino := f.inode.ino
+	if err := f.super.ec.Seal(ino); err != nil {
+		log.LogErrorf("clone: seal ino(%v) err(%v)", ino, err)
+		return 0, fuse.EIO
+	}
+	if dino != ino {
+		if err := f.super.ec.Seal(dino); err != nil {
+			log.LogErrorf("clone: seal ino(%v) err(%v)", dino, err)
+			return 0, fuse.EIO
+		}
+	}
+	f.super.ic.Delete(ino)
+	f.super.ic.Delete(dino)
+
+	dinode, err := f.super.InodeGet(dino)
+	if err != nil {
+		log.LogErrorf("clone: ino(%v) err(%v)", dino, err)
+		return 0, ParseError(err)
+	}
+	if dinode.isImmutable() || dinode.isWormCommitted() {
+		return 0, fuse.EPERM
+	}
+	if dstOffset != dinode.dataSize() {
+		return 0, fuse.Errno(syscall.EOPNOTSUPP)
+	}
+
+	n, err := f.super.mw.CloneRange(ino, srcOffset, dino, dstOffset, size)
+	if err != nil {
+		log.LogWarnf("clone: ino(%v) offset(%v) to ino(%v) offset(%v) size(%v) err(%v)",
+			ino, srcOffset, dino, dstOffset, size, err)
+		return 0, fuse.Errno(syscall.EOPNOTSUPP)
+	}
+	f.super.ic.Delete(dino)
+	f.super.ec.SetWriteSize(dino, dstOffset+n)
+	f.setReadStream(nil)
+	return n, nil
+}
+
+// cloneSource returns the inode of file fd of process pid, which has to be
+// a file of this mount.
+func (f *File) cloneSource(pid uint32, fd int64) (uint64, error) {
+	var st, mst syscall.Stat_t
+	if err := syscall.Stat(fmt.Sprintf("/proc/%d/fd/%d", pid, fd), &st); err != nil {
+		return 0, fuse.Errno(syscall.EBADF)
+	}
+	if err := syscall.Stat(f.super.mountPoint, &mst); err != nil {
+		log.LogErrorf("cloneSource: stat mount point(%v) err(%v)", f.super.mountPoint, err)
+		return 0, fuse.EIO
+	}
+	if st.Dev != mst.Dev || st.Mode&syscall.S_IFMT != syscall.S_IFREG {
+		return 0, fuse.Errno(syscall.EXDEV)
+	}
+	return st.Ino, nil
+}
+
+// Ioctl serves FS_IOC_GETFLAGS and FS_IOC_SETFLAGS for chattr(1), only
+// the immutable and append-only flags are supported.
+func (f *File) Ioctl(ctx context.Context, req *fuse.IoctlRequest, resp *fuse.IoctlResponse) (err error) {
+	ino := f.inode.ino
+	switch req.Cmd & IoctlCmdMask {
+	case IoctlGetFlags:
+		f.super.ic.Delete(ino)
+		inode, err := f.super.InodeGet(ino)
+		if err != nil {
+			log.LogErrorf("Ioctl: ino(%v) err(%v)", ino, err)
+			return ParseError(err)
+		}
+		if req.OutSize < 4 {
+			return fuse.Errno(syscall.EINVAL)
+		}
+		flags := inode.flags
+		// A retained WORM file behaves as an immutable one.
+		if inode.retention > time.Now().Unix() {
+			flags |= proto.FlagImmutable
+		}
+		resp.Data = make([]byte, req.OutSize)
+		binary.LittleEndian.PutUint32(resp.Data, flags)
+	case IoctlSetFlags:
+		if len(req.Data) < 4 {
+			return fuse.Errno(syscall.EINVAL)
+		}
+		flags := binary.LittleEndian.Uint32(req.Data) & proto.FlagMask
+		inode, err := f.super.InodeGet(ino)
+		if err != nil {
+			log.LogErrorf("Ioctl: ino(%v) err(%v)", ino, err)
+			return ParseError(err)
+		}
+		// Like CAP_LINUX_IMMUTABLE, only root changes the flags.
+		if flags != inode.flags && req.Header.Uid != 0 {
+			return fuse.EPERM
+		}
+		if err = f.super.mw.SetFlags(ino, flags); err != nil {
+			log.LogErrorf("Ioctl: set flags ino(%v) flags(%#x) err(%v)", ino, flags, err)
+			return ParseError(err)
+		}
+		f.super.ic.Delete(ino)
+	case IoctlClone, IoctlCloneRange:
+		return f.ioctlClone(req)
+	default:
+		return fuse.Errno(syscall.ENOTTY)
+	}
+	log.LogDebugf("TRACE Ioctl: ino(%v) req(%v)", ino, req)
+	return nil
+}
+
+// ioctlClone serves FICLONE and FICLONERANGE, which clone a file, or a range
+// of it, into this one. Like copy_file_range(2), only ranges appended to the
+// data of this file are cloned.
+func (f *File) ioctlClone(req *fuse.IoctlRequest) error {
+	var (
+		fd                   int64
+		srcOffset, dstOffset uint64
+		size                 uint64 = math.MaxUint64
+	)
+	if req.Cmd&IoctlCmdMask == IoctlClone {
+		fd = int64(int32(req.Arg))
+	} else {
+		// struct file_clone_range
+		if len(req.Data) < 32 {
+			return fuse.Errno(syscall.EINVAL)
+		}
+		fd = int64(binary.LittleEndian.Uint64(req.Data[0:]))
+		srcOffset = binary.LittleEndian.Uint64(req.Data[8:])
+		// A length of zero clones up to the end of the source.
+		if n := binary.LittleEndian.Uint64(req.Data[16:]); n != 0 {
+			size = n
+		}
+		dstOffset = binary.LittleEndian.Uint64(req.Data[24:])
+	}
+	ino, err := f.cloneSource(req.Header.Pid, fd)
+	if err != nil {
+		return err
+	}
+	n, err := f.clone(ino, srcOffset, dstOffset, size)
+	if err != nil {
+		return err
+	}
+	log.LogDebugf("TRACE Ioctl: clone ino(%v) to ino(%v) req(%v) size(%v)", ino, f.inode.ino, req, n)
+	return nil
+}
+
 func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 	start := time.Now()
 	err = f.super.ec.Flush(f.inode.ino)
@@ -271,8 +538,10 @@ func (f *File) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string,
 	return string(inode.target), nil
 }
 
+// Getxattr reports every attribute missing, ENOSYS would make the kernel
+// stop asking for the virtual attributes of the directories too.
 func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ENOSYS
+	return fuse.ErrNoXattr
 }
 
 func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
@@ -40,6 +40,13 @@ type Inode struct {
 	atime  time.Time
 	mode   os.FileMode
 	target []byte
+	flags  uint32
+
+	// WORM retention deadline in unix time, 0 if not committed
+	retention int64
+
+	// space allocated by fallocate after the data, included in size
+	unwritten uint64
 
 	// protected under the inode cache lock
 	expiration int64
@@ -105,6 +112,15 @@ func (inode *Inode) fill(info *proto.InodeInfo) {
 	inode.mtime = info.ModifyTime
 	inode.target = info.Target
 	inode.mode = proto.OsMode(info.Mode)
+	inode.flags = info.Flags
+	inode.retention = info.Retention
+	inode.unwritten = info.Unwritten
+}
+
+// dataSize returns the size of the data of the file, new data is written
+// from there on.
+func (inode *Inode) dataSize() uint64 {
+	return inode.size - inode.unwritten
 }
 
 func (inode *Inode) fillAttr(attr *fuse.Attr) {
@@ -122,6 +138,18 @@ func (inode *Inode) fillAttr(attr *fuse.Attr) {
 	attr.Gid = inode.gid
 }
 
+func (inode *Inode) isImmutable() bool {
+	return inode.flags&proto.FlagImmutable != 0
+}
+
+func (inode *Inode) isAppendOnly() bool {
+	return inode.flags&proto.FlagAppend != 0
+}
+
+func (inode *Inode) isWormCommitted() bool {
+	return inode.retention != 0
+}
+
 func (inode *Inode) expired() bool {
 	if time.Now().UnixNano() > inode.expiration {
 		return true
@@ -34,6 +34,8 @@ type Super struct {
 	mw      *meta.MetaWrapper
 	ec      *stream.ExtentClient
 	orphan  *OrphanInodeList
+	// Files of the mount share its device number.
+	mountPoint string
 }
 
 //functions that Super needs to implement
@@ -42,7 +44,7 @@ var (
 	_ fs.FSStatfser = (*Super)(nil)
 )
 
-func NewSuper(volname, master string, icacheTimeout int64) (s *Super, err error) {
+func NewSuper(volname, master, mountPoint string, icacheTimeout int64) (s *Super, err error) {
 	s = new(Super)
 	s.mw, err = meta.NewMetaWrapper(volname, master)
 	if err != nil {
@@ -55,8 +57,10 @@ func NewSuper(volname, master string, icacheTimeout int64) (s *Super, err error)
 		log.LogErrorf("NewExtentClient failed! %v", err.Error())
 		return nil, err
 	}
+	s.ec.SetInline(int(s.mw.InlineSize()), s.mw.GetInline, s.mw.WriteInline)
 
 	s.volname = volname
+	s.mountPoint = mountPoint
 	s.cluster = s.mw.Cluster()
 	inodeExpiration := DefaultInodeExpiration
 	if icacheTimeout > 0 {
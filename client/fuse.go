@@ -116,7 +116,7 @@ func Mount(cfg *config.Config) error {
 	}
 	defer log.LogFlush()
 
-	super, err := bdfs.NewSuper(volname, master, icacheTimeout)
+	super, err := bdfs.NewSuper(volname, master, mnt, icacheTimeout)
 	if err != nil {
 		return err
 	}
@@ -16,8 +16,10 @@ package main
 
 import (
 	"github.com/tiglabs/containerfs/datanode"
+	"github.com/tiglabs/containerfs/imagenode"
 	"github.com/tiglabs/containerfs/master"
 	"github.com/tiglabs/containerfs/metanode"
+	"github.com/tiglabs/containerfs/objectnode"
 	"github.com/tiglabs/containerfs/util/log"
 	"strings"
 
@@ -50,12 +52,16 @@ const (
 	RoleMaster = "master"
 	RoleMeta   = "metanode"
 	RoleData   = "datanode"
+	RoleObject = "objectnode"
+	RoleImage  = "imagenode"
 )
 
 const (
 	ModuleMaster = "master"
 	ModuleMeta   = "metaNode"
 	ModuleData   = "dataNode"
+	ModuleObject = "objectNode"
+	ModuleImage  = "imageNode"
 )
 
 var (
@@ -123,6 +129,12 @@ func main() {
 	case RoleData:
 		server = datanode.NewServer()
 		module = ModuleData
+	case RoleObject:
+		server = objectnode.NewServer()
+		module = ModuleObject
+	case RoleImage:
+		server = imagenode.NewServer()
+		module = ModuleImage
 	default:
 		log.LogInfo("Fatal: role mismatch: ", role)
 		os.Exit(1)
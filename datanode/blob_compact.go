@@ -14,6 +14,11 @@ var (
 	GcanCompact int
 )
 
+const (
+	// How often the leader of a data partition scans for expired blob objects.
+	BlobExpireScanInterval = time.Minute * 5
+)
+
 func (dp *dataPartition) lauchCompact() {
 	if GcanCompact != CanCompact {
 		return
@@ -98,3 +103,61 @@ func (dp *dataPartition) notifyCompactBlobFile(blobFile int) (err error) {
 	}
 	return
 }
+
+// expireBlobObjects marks the expired blob objects deleted, so that they are
+// removed by compaction. Only the leader scans, and it deletes an object after
+// all the followers have deleted it, so the replicas expire the same objects.
+// The objects failed to be deleted are retried by the next scan.
+func (dp *dataPartition) expireBlobObjects() {
+	if !dp.isLeader || time.Since(dp.lastExpireScan) < BlobExpireScanInterval {
+		return
+	}
+	dp.lastExpireScan = time.Now()
+	now := dp.lastExpireScan.Unix()
+	for blobFile := 1; blobFile <= storage.BlobFileFileCount; blobFile++ {
+		for _, oid := range dp.blobStore.GetExpiredObjects(uint32(blobFile), now) {
+			if err := dp.expireBlobObject(blobFile, oid); err != nil {
+				log.LogWarnf(err.Error())
+				continue
+			}
+			log.LogInfof("%v expired oid(%v)", dp.getCompactKey(blobFile), oid)
+		}
+	}
+}
+
+func (dp *dataPartition) expireBlobObject(blobFile int, oid uint64) (err error) {
+	for i := 1; i < len(dp.replicaHosts); i++ {
+		if err = dp.notifyMarkDelete(dp.replicaHosts[i], blobFile, oid); err != nil {
+			return
+		}
+	}
+	if err = dp.blobStore.MarkDelete(uint32(blobFile), int64(oid), 0); err != nil {
+		err = fmt.Errorf("%v expire oid(%v) failed (%v)", dp.getCompactKey(blobFile), oid, err.Error())
+	}
+	return
+}
+
+func (dp *dataPartition) notifyMarkDelete(target string, blobFile int, oid uint64) (err error) {
+	pkg := NewBlobMarkDeletePkg(uint32(blobFile), dp.partitionId, oid)
+	conn, err := gConnPool.Get(target)
+	if err != nil {
+		return fmt.Errorf("%v expire oid(%v) get connect for (%v) failed (%v)",
+			dp.getCompactKey(blobFile), oid, target, err.Error())
+	}
+	if err = pkg.WriteToConn(conn); err != nil {
+		gConnPool.Put(conn, true)
+		return fmt.Errorf("%v send expire oid(%v) to (%v) failed (%v)",
+			dp.getCompactKey(blobFile), oid, target, err.Error())
+	}
+	if err = pkg.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		gConnPool.Put(conn, true)
+		return fmt.Errorf("%v read expire oid(%v) response from (%v) failed (%v)",
+			dp.getCompactKey(blobFile), oid, target, err.Error())
+	}
+	gConnPool.Put(conn, false)
+	if pkg.ResultCode != proto.OpOk {
+		return fmt.Errorf("%v expire oid(%v) on (%v) failed (%v)",
+			dp.getCompactKey(blobFile), oid, target, string(pkg.Data[:pkg.Size]))
+	}
+	return
+}
@@ -38,6 +38,7 @@ func (dp *dataPartition) lauchBlobRepair() {
 		case <-ticker:
 			dp.blobRepair()
 			dp.lauchCompact()
+			dp.expireBlobObjects()
 		case <-dp.stopC:
 			return
 		}
@@ -498,6 +499,9 @@ func (dp *dataPartition) applyRepairBlobObjects(blobfileId int, data []byte, end
 		}
 		log.LogWritef("%v applyRepairBlobObjects start Fix oid(%v) end(%v)", dp.getBlobRepairLogKey(blobfileId), startObjectId, endObjectId)
 
+		//the metadata of the object is in front of its body
+		meta := data[dataPos:util.Min(dataPos+int(o.MetaSize), dataLen)]
+		dataPos += len(meta)
 		//if dataPos +this objectSize has great 15MB,then break,donnot fix it
 		if dataPos+int(o.Size) > dataLen {
 			return errors.Annotatef(err, "%v applyRepairBlobObjects  oid(%v) no body"+
@@ -516,7 +520,7 @@ func (dp *dataPartition) applyRepairBlobObjects(blobfileId int, data []byte, end
 		}
 		//write local storage engine
 		log.LogWritef("%v applyRepairBlobObjects oid(%v) size(%v) crc(%v)", dp.getBlobRepairLogKey(blobfileId), o.Oid, ncrc)
-		err = store.Write(uint32(blobfileId), uint64(o.Oid), int64(o.Size), ndata, o.Crc)
+		err = store.WriteObject(uint32(blobfileId), uint64(o.Oid), meta, ndata, o.Crc)
 		if err != nil {
 			return errors.Annotatef(err, "%v applyRepairBlobObjects oid(%v) write failed(%v)", dp.getBlobRepairLogKey(blobfileId), o.Oid, err)
 		}
@@ -562,7 +566,7 @@ func (dp *dataPartition) syncData(blobfileID uint32, startOid, endOid uint64, pk
 		var realSize uint32
 		realSize = 0
 		if objects[i].Size != storage.MarkDeleteObject {
-			realSize = objects[i].Size
+			realSize = uint32(objects[i].MetaSize) + objects[i].Size
 		}
 		if pos+int(realSize)+storage.ObjectHeaderSize >= PkgRepairCReadRespLimitSize {
 			if err = dp.postRepairData(pkg, startOid, objects[i-1].Oid, databuf, int(blobfileID), pos, conn); err != nil {
@@ -93,6 +93,7 @@ const (
 	LogDelPartition      = "DELV:"
 	LogDelFile           = "DELF:"
 	LogMarkDel           = "MDEL:"
+	LogPunchHole         = "PUNCH:"
 	LogPartitionSnapshot = "Snapshot:"
 	LogGetWm             = "WM:"
 	LogGetAllWm          = "AllWM:"
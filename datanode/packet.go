@@ -20,6 +20,7 @@ import (
 	"hash/crc32"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -82,6 +83,43 @@ func (p *Packet) UnmarshalAddrs() (addrs []string, err error) {
 	return
 }
 
+// argTail returns what Arg carries after the addresses of the replicas,
+// i.e. the text after the last AddrSplit, which UnmarshalAddrs ignores.
+func (p *Packet) argTail() (tail string, err error) {
+	if len(p.Arg) < int(p.Arglen) {
+		return "", ErrArgLenMismatch
+	}
+	arg := string(p.Arg[:int(p.Arglen)])
+	return arg[strings.LastIndex(arg, proto.AddrSplit)+1:], nil
+}
+
+// argTailInt returns the decimal carried at the tail of Arg, 0 if none.
+func (p *Packet) argTailInt() (n int64, err error) {
+	tail, err := p.argTail()
+	if err != nil || tail == "" {
+		return
+	}
+	return strconv.ParseInt(tail, 10, 64)
+}
+
+// blobReadOffset returns the offset in the object a blob read starts at,
+// 0 if the whole object is read.
+func (p *Packet) blobReadOffset() (offset int64, err error) {
+	return p.argTailInt()
+}
+
+// blobMetaSize returns the size of the metadata in front of the data of a
+// blob write.
+func (p *Packet) blobMetaSize() (size int64, err error) {
+	if size, err = p.argTailInt(); err != nil {
+		return
+	}
+	if size < 0 || size > int64(p.Size) || size > proto.MaxBlobMetaSize {
+		return 0, ErrArgLenMismatch
+	}
+	return
+}
+
 func NewPacket() (p *Packet) {
 	p = new(Packet)
 	p.Magic = proto.ProtoMagic
@@ -211,6 +249,21 @@ func NewNotifyCompactPkg(fileID, datapartitionId uint32) (p *Packet) {
 	return
 }
 
+// NewBlobMarkDeletePkg marks the object of a blob file deleted on the
+// replica it is sent to only.
+func NewBlobMarkDeletePkg(fileID, datapartitionId uint32, oid uint64) (p *Packet) {
+	p = new(Packet)
+	p.FileID = uint64(fileID)
+	p.PartitionID = datapartitionId
+	p.Offset = int64(oid)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpMarkDelete
+	p.StoreMode = proto.BlobStoreMode
+	p.ReqID = proto.GetReqID()
+
+	return
+}
+
 func (p *Packet) IsTailNode() (ok bool) {
 	if p.Nodes == 0 && (p.IsWriteOperation() || p.Opcode == proto.OpCreateFile ||
 		(p.Opcode == proto.OpMarkDelete && p.StoreMode == proto.BlobStoreMode)) {
@@ -232,6 +285,10 @@ func (p *Packet) IsMarkDeleteOperation() bool {
 	return p.Opcode == proto.OpMarkDelete
 }
 
+func (p *Packet) IsPunchHoleOperation() bool {
+	return p.Opcode == proto.OpPunchHole
+}
+
 func (p *Packet) IsExtentWritePacket() bool {
 	return p.StoreMode == proto.ExtentStoreMode && p.IsWriteOperation()
 }
@@ -22,14 +22,13 @@ import (
 	"math"
 	"os"
 	"path"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/juju/errors"
-	"github.com/tiglabs/containerfs/master"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/storage"
 	"github.com/tiglabs/containerfs/util/log"
 )
@@ -40,10 +39,6 @@ const (
 	TimeLayout                = "2006-01-02 15:04:05"
 )
 
-var (
-	AdminGetDataPartition = master.AdminGetDataPartition
-)
-
 type DataPartition interface {
 	ID() uint32
 	Path() string
@@ -109,6 +104,7 @@ type dataPartition struct {
 	blobStore       *storage.BlobStore
 	stopC           chan bool
 	isFirstRestart  bool
+	lastExpireScan  time.Time
 
 	runtimeMetrics *DataPartitionMetrics
 }
@@ -358,21 +354,13 @@ func (dp *dataPartition) compareReplicaHosts(v1, v2 []string) (equals bool) {
 
 func (dp *dataPartition) fetchReplicaHosts() (isLeader bool, replicaHosts []string, err error) {
 	var (
-		HostsBuf []byte
+		response *master.DataPartitionInfo
 	)
-	params := make(map[string]string)
-	params["id"] = strconv.Itoa(int(dp.partitionId))
-	if HostsBuf, err = MasterHelper.Request("GET", AdminGetDataPartition, params, nil); err != nil {
+	if response, err = MasterClient.GetDataPartition(&master.GetDataPartitionRequest{PartitionID: uint64(dp.partitionId)}); err != nil {
 		isLeader = false
 		return
 	}
-	response := &master.DataPartition{}
 	replicaHosts = make([]string, 0)
-	if err = json.Unmarshal(HostsBuf, &response); err != nil {
-		isLeader = false
-		replicaHosts = nil
-		return
-	}
 	for _, host := range response.PersistenceHosts {
 		replicaHosts = append(replicaHosts, host)
 	}
@@ -435,7 +423,15 @@ func (dp *dataPartition) PackObject(dataBuf []byte, o *storage.Object, blobfileI
 	if o.Size == storage.MarkDeleteObject && o.Oid != 0 {
 		return
 	}
-	_, err = dp.blobStore.Read(blobfileID, int64(o.Oid), int64(o.Size), dataBuf[storage.ObjectHeaderSize:])
+	dataBuf = dataBuf[storage.ObjectHeaderSize:]
+	if o.MetaSize > 0 {
+		var meta []byte
+		if meta, err = dp.blobStore.ReadMeta(blobfileID, int64(o.Oid)); err != nil {
+			return
+		}
+		dataBuf = dataBuf[copy(dataBuf, meta):]
+	}
+	_, err = dp.blobStore.Read(blobfileID, int64(o.Oid), 0, int64(o.Size), dataBuf)
 	return
 }
 
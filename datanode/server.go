@@ -15,7 +15,6 @@
 package datanode
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -30,8 +29,8 @@ import (
 	"time"
 
 	"github.com/juju/errors"
-	"github.com/tiglabs/containerfs/master"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/storage"
 	"github.com/tiglabs/containerfs/util"
 	"github.com/tiglabs/containerfs/util/config"
@@ -49,11 +48,10 @@ var (
 
 	LocalIP      string
 	gConnPool    = pool.NewConnPool()
-	MasterHelper = util.NewMasterHelper()
+	MasterClient = master.NewMasterClient(nil)
 )
 
 const (
-	GetIpFromMaster = master.AdminGetIp
 	DefaultRackName = "huitian_rack1"
 )
 
@@ -164,13 +162,13 @@ func (s *DataNode) parseConfig(cfg *config.Config) (err error) {
 		return ErrBadConfFile
 	}
 	for _, ip := range cfg.GetArray(ConfigKeyMasterAddr) {
-		MasterHelper.AddNode(ip.(string))
+		MasterClient.AddNode(ip.(string))
 	}
 	s.rackName = cfg.GetString(ConfigKeyRack)
 	if s.rackName == "" {
 		s.rackName = DefaultRackName
 	}
-	log.LogDebugf("action[parseConfig] load masterAddrs(%v).", MasterHelper.Nodes())
+	log.LogDebugf("action[parseConfig] load masterAddrs(%v).", MasterClient.Nodes())
 	log.LogDebugf("action[parseConfig] load port(%v).", s.port)
 	log.LogDebugf("action[parseConfig] load clusterId(%v).", s.clusterId)
 	log.LogDebugf("action[parseConfig] load rackName(%v).", s.rackName)
@@ -212,24 +210,22 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 
 func (s *DataNode) registerToMaster() {
 	var (
-		err  error
-		data []byte
+		err   error
+		cInfo *proto.ClusterInfo
 	)
 	// Get IP address and cluster ID from master.
 	for {
 		timer := time.NewTimer(0)
 		select {
 		case <-timer.C:
-			data, err = MasterHelper.Request(http.MethodGet, GetIpFromMaster, nil, nil)
-			masterAddr := MasterHelper.Leader()
+			cInfo, err = MasterClient.GetClusterInfo()
+			masterAddr := MasterClient.Leader()
 			if err != nil {
 				log.LogErrorf("action[registerToMaster] cannot get ip from master(%v) err(%v).",
 					masterAddr, err)
 				timer = time.NewTimer(5 * time.Second)
 				continue
 			}
-			cInfo := new(proto.ClusterInfo)
-			json.Unmarshal(data, cInfo)
 			LocalIP = string(cInfo.Ip)
 			s.clusterId = cInfo.Cluster
 			s.localServeAddr = fmt.Sprintf("%s:%v", LocalIP, s.port)
@@ -240,11 +236,9 @@ func (s *DataNode) registerToMaster() {
 				continue
 			}
 			// Register this data node to master.
-			params := make(map[string]string)
-			params["addr"] = fmt.Sprintf("%s:%v", LocalIP, s.port)
-			data, err = MasterHelper.Request(http.MethodPost, master.AddDataNode, params, nil)
+			err = MasterClient.AddDataNode(&master.NodeRequest{Addr: fmt.Sprintf("%s:%v", LocalIP, s.port)})
 			if err != nil {
-				log.LogErrorf("action[registerToMaster] cannot register this node to master[%] err(%v).",
+				log.LogErrorf("action[registerToMaster] cannot register this node to master[%v] err(%v).",
 					masterAddr, err)
 				continue
 			}
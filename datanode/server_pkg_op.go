@@ -18,12 +18,12 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"net"
 	"strconv"
 	"time"
 
 	"github.com/juju/errors"
-	"github.com/tiglabs/containerfs/master"
 	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/storage"
 	"github.com/tiglabs/containerfs/util"
@@ -69,12 +69,16 @@ func (s *DataNode) operatePacket(pkg *Packet, c *net.TCPConn) {
 		s.handleWrite(pkg)
 	case proto.OpRead:
 		s.handleRead(pkg)
+	case proto.OpBlobStat:
+		s.handleBlobStat(pkg)
 	case proto.OpBlobFileRepairRead:
 		s.handleBlobFileRepairRead(pkg, c)
 	case proto.OpStreamRead:
 		s.handleStreamRead(pkg, c)
 	case proto.OpMarkDelete:
 		s.handleMarkDelete(pkg)
+	case proto.OpPunchHole:
+		s.handlePunchHole(pkg)
 	case proto.OpNotifyCompactBlobFile:
 		s.handleNotifyCompact(pkg)
 	case proto.OpNotifyExtentRepair:
@@ -127,11 +131,22 @@ func (s *DataNode) handleCreateFile(pkg *Packet) {
 	case proto.BlobStoreMode:
 		err = errors.Annotatef(ErrStoreTypeMismatch, " CreateFile only support ExtentMode DataPartition")
 	case proto.ExtentStoreMode:
-		var ino uint64
+		var ino, prealloc uint64
 		if len(pkg.Data) >= 8 && pkg.Size >= 8 {
 			ino = binary.BigEndian.Uint64(pkg.Data)
 		}
-		err = pkg.DataPartition.GetExtentStore().Create(pkg.FileID, ino, false)
+		if len(pkg.Data) >= 16 && pkg.Size >= 16 {
+			prealloc = binary.BigEndian.Uint64(pkg.Data[8:16])
+		}
+		store := pkg.DataPartition.GetExtentStore()
+		if err = store.Create(pkg.FileID, ino, false); err != nil || prealloc == 0 {
+			return
+		}
+		// Preallocation is only a hint, the extent is usable without it.
+		if fErr := store.Fallocate(pkg.FileID, 0, int64(prealloc)); fErr != nil {
+			log.LogWarnf("action[handleCreateFile] Request(%v) preallocate(%v) err(%v)",
+				pkg.GetUniqueLogId(), prealloc, fErr)
+		}
 	}
 	return
 }
@@ -163,8 +178,7 @@ func (s *DataNode) handleCreateDataPartition(pkg *Packet) {
 		log.LogErrorf("from master Task(%v) failed,error(%v)", task.ToString(), response.Result)
 	}
 	task.Response = response
-	data, _ := json.Marshal(task)
-	_, err := MasterHelper.Request("POST", master.DataNodeResponse, nil, data)
+	err := MasterClient.DataNodeResponse(task)
 	if err != nil {
 		err = errors.Annotatef(err, "create dataPartition failed,partitionId(%v)", request.PartitionId)
 		log.LogError(errors.ErrorStack(err))
@@ -187,25 +201,20 @@ func (s *DataNode) handleHeartbeats(pkg *Packet) {
 		bytes, _ := json.Marshal(task.Request)
 		json.Unmarshal(bytes, request)
 		response.Status = proto.TaskSuccess
-		MasterHelper.AddNode(request.MasterAddr)
+		MasterClient.AddNode(request.MasterAddr)
 	} else {
 		response.Status = proto.TaskFail
 		response.Result = "illegal opcode"
 	}
 	task.Response = response
-	data, err := json.Marshal(task)
-	if err != nil {
-		log.LogErrorf("action[heartbeat] err(%v).", err)
-		return
-	}
-	_, err = MasterHelper.Request("POST", master.DataNodeResponse, nil, data)
+	err = MasterClient.DataNodeResponse(task)
 	if err != nil {
 		err = errors.Annotatef(err, "heartbeat to master(%v) failed.", request.MasterAddr)
 		log.LogErrorf("action[handleHeartbeats] err(%v).", err)
 		log.LogErrorf(errors.ErrorStack(err))
 		return
 	}
-	log.LogDebugf("action[handleHeartbeats] report data len(%v) to master success.", len(data))
+	log.LogDebugf("action[handleHeartbeats] report to master(%v) success.", MasterClient.Leader())
 }
 
 // Handle OpDeleteDataPartition packet.
@@ -235,8 +244,7 @@ func (s *DataNode) handleDeleteDataPartition(pkg *Packet) {
 		log.LogErrorf("action[handleDeleteDataPartition] from master Task(%v) failed, err(%v).", task.ToString(), response.Result)
 	}
 	task.Response = response
-	data, _ := json.Marshal(task)
-	_, err := MasterHelper.Request("POST", master.DataNodeResponse, nil, data)
+	err := MasterClient.DataNodeResponse(task)
 	if err != nil {
 		err = errors.Annotatef(err, "delete dataPartition failed,partitionId(%v)", request.PartitionId)
 		log.LogErrorf("action[handleDeleteDataPartition] err(%v).", err)
@@ -270,8 +278,7 @@ func (s *DataNode) handleLoadDataPartition(pkg *Packet) {
 		log.LogErrorf("from master Task(%v) failed,error(%v)", task.ToString(), response.Result)
 	}
 	task.Response = response
-	data, _ := json.Marshal(task)
-	_, err := MasterHelper.Request("POST", master.DataNodeResponse, nil, data)
+	err := MasterClient.DataNodeResponse(task)
 	if err != nil {
 		err = errors.Annotatef(err, "load dataPartition failed,partitionId(%v)", request.PartitionId)
 		log.LogError(errors.ErrorStack(err))
@@ -297,6 +304,30 @@ func (s *DataNode) handleMarkDelete(pkg *Packet) {
 	return
 }
 
+// Handle OpPunchHole packet.
+func (s *DataNode) handlePunchHole(pkg *Packet) {
+	var err error
+	defer func() {
+		if err != nil {
+			err = errors.Annotatef(err, "Request(%v) PunchHole Error", pkg.GetUniqueLogId())
+			pkg.PackErrorBody(LogPunchHole, err.Error())
+		} else {
+			pkg.PackOkReply()
+		}
+	}()
+	if pkg.StoreMode != proto.ExtentStoreMode {
+		err = errors.Annotatef(ErrStoreTypeMismatch, " PunchHole only support ExtentMode DataPartition")
+		return
+	}
+	if len(pkg.Data) < 8 || pkg.Size < 8 {
+		err = storage.ErrorParamMismatch
+		return
+	}
+	size := int64(binary.BigEndian.Uint64(pkg.Data))
+	err = pkg.DataPartition.GetExtentStore().PunchHole(pkg.FileID, pkg.Offset, size)
+	return
+}
+
 // Handle OpWrite packet.
 func (s *DataNode) handleWrite(pkg *Packet) {
 	var err error
@@ -318,7 +349,15 @@ func (s *DataNode) handleWrite(pkg *Packet) {
 	}
 	switch pkg.StoreMode {
 	case proto.BlobStoreMode:
-		err = pkg.DataPartition.GetBlobStore().Write(uint32(pkg.FileID), uint64(pkg.Offset), int64(pkg.Size), pkg.Data, pkg.Crc)
+		var metaSize int64
+		if metaSize, err = pkg.blobMetaSize(); err != nil {
+			break
+		}
+		meta, data, crc := pkg.Data[:metaSize], pkg.Data[metaSize:pkg.Size], pkg.Crc
+		if metaSize > 0 {
+			crc = crc32.ChecksumIEEE(data)
+		}
+		err = pkg.DataPartition.GetBlobStore().WriteObject(uint32(pkg.FileID), uint64(pkg.Offset), meta, data, crc)
 		s.addDiskErrs(pkg.PartitionID, err, WriteFlag)
 	case proto.ExtentStoreMode:
 		err = pkg.DataPartition.GetExtentStore().Write(pkg.FileID, pkg.Offset, int64(pkg.Size), pkg.Data, pkg.Crc)
@@ -336,7 +375,11 @@ func (s *DataNode) handleRead(pkg *Packet) {
 	var err error
 	switch pkg.StoreMode {
 	case proto.BlobStoreMode:
-		pkg.Crc, err = pkg.DataPartition.GetBlobStore().Read(uint32(pkg.FileID), pkg.Offset, int64(pkg.Size), pkg.Data)
+		var offset int64
+		if offset, err = pkg.blobReadOffset(); err != nil {
+			break
+		}
+		pkg.Crc, err = pkg.DataPartition.GetBlobStore().Read(uint32(pkg.FileID), pkg.Offset, offset, int64(pkg.Size), pkg.Data)
 		s.addDiskErrs(pkg.PartitionID, err, ReadFlag)
 	case proto.ExtentStoreMode:
 		pkg.Crc, err = pkg.DataPartition.GetExtentStore().Read(pkg.FileID, pkg.Offset, int64(pkg.Size), pkg.Data)
@@ -351,6 +394,24 @@ func (s *DataNode) handleRead(pkg *Packet) {
 	return
 }
 
+// Handle OpBlobStat packet, which replies the metadata of a blob object.
+func (s *DataNode) handleBlobStat(pkg *Packet) {
+	var err error
+	if pkg.StoreMode == proto.BlobStoreMode {
+		pkg.Data, err = pkg.DataPartition.GetBlobStore().ReadMeta(uint32(pkg.FileID), pkg.Offset)
+		s.addDiskErrs(pkg.PartitionID, err, ReadFlag)
+	} else {
+		err = ErrStoreTypeMismatch
+	}
+	if err == nil {
+		pkg.Size = uint32(len(pkg.Data))
+		pkg.Crc = crc32.ChecksumIEEE(pkg.Data)
+		pkg.PackOkReadReply()
+	} else {
+		pkg.PackErrorBody(LogRead, err.Error())
+	}
+}
+
 // Handle OpStreamRead packet.
 func (s *DataNode) handleStreamRead(request *Packet, connect net.Conn) {
 	var (
@@ -108,7 +108,7 @@ func (s *DataNode) doRequestCh(req *Packet, msgH *MessageHandler) {
 	} else {
 		log.LogErrorf("action[doRequestCh] %dp.", req.ActionMsg(ActionSendToNext, req.NextAddr,
 			req.StartT, fmt.Errorf("failed to send to : %v", req.NextAddr)))
-		if req.IsMarkDeleteReq() {
+		if req.IsMarkDeleteReq() || req.IsPunchHoleOperation() {
 			s.operatePacket(req, msgH.inConn)
 		}
 	}
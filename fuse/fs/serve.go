@@ -284,6 +284,24 @@ type HandleFlusher interface {
 	Flush(ctx context.Context, req *fuse.FlushRequest) error
 }
 
+type HandleFallocater interface {
+	// Fallocate manipulates the allocated space of the byte range
+	// described by the request, as fallocate(2) does.
+	Fallocate(ctx context.Context, req *fuse.FallocateRequest) error
+}
+
+type HandleIoctler interface {
+	// Ioctl runs an ioctl command on the handle. Output beyond
+	// req.OutSize is dropped.
+	Ioctl(ctx context.Context, req *fuse.IoctlRequest, resp *fuse.IoctlResponse) error
+}
+
+type HandleCopyFileRanger interface {
+	// CopyFileRange copies a byte range of this handle into the
+	// handle dst, as copy_file_range(2) does.
+	CopyFileRange(ctx context.Context, req *fuse.CopyFileRangeRequest, resp *fuse.CopyFileRangeResponse, dst Handle) error
+}
+
 type HandleReadAller interface {
 	ReadAll(ctx context.Context) ([]byte, error)
 }
@@ -1295,6 +1313,63 @@ func (c *Server) handleRequest(ctx context.Context, node Node, snode *serveNode,
 		r.Respond()
 		return nil
 
+	case *fuse.FallocateRequest:
+		shandle := c.getHandle(r.Handle)
+		if shandle == nil {
+			return fuse.ESTALE
+		}
+		h, ok := shandle.handle.(HandleFallocater)
+		if !ok {
+			return fuse.ENOSYS
+		}
+		if err := h.Fallocate(ctx, r); err != nil {
+			return err
+		}
+		done(nil)
+		r.Respond()
+		return nil
+
+	case *fuse.IoctlRequest:
+		shandle := c.getHandle(r.Handle)
+		if shandle == nil {
+			return fuse.ESTALE
+		}
+		h, ok := shandle.handle.(HandleIoctler)
+		if !ok {
+			return fuse.ENOSYS
+		}
+		s := &fuse.IoctlResponse{}
+		if err := h.Ioctl(ctx, r, s); err != nil {
+			return err
+		}
+		if uint32(len(s.Data)) > r.OutSize {
+			s.Data = s.Data[:r.OutSize]
+		}
+		done(s)
+		r.Respond(s)
+		return nil
+
+	case *fuse.CopyFileRangeRequest:
+		shandle := c.getHandle(r.Handle)
+		if shandle == nil {
+			return fuse.ESTALE
+		}
+		dhandle := c.getHandle(r.HandleOut)
+		if dhandle == nil {
+			return fuse.ESTALE
+		}
+		h, ok := shandle.handle.(HandleCopyFileRanger)
+		if !ok {
+			return fuse.ENOSYS
+		}
+		s := &fuse.CopyFileRangeResponse{}
+		if err := h.CopyFileRange(ctx, r, s, dhandle.handle); err != nil {
+			return err
+		}
+		done(s)
+		r.Respond(s)
+		return nil
+
 	case *fuse.ReleaseRequest:
 		shandle := c.getHandle(r.Handle)
 		if shandle == nil {
@@ -106,6 +106,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"sync"
 	"syscall"
@@ -868,6 +869,54 @@ loop:
 			Flags:  in.FsyncFlags,
 		}
 
+	case opFallocate:
+		in := (*fallocateIn)(m.data())
+		if m.len() < unsafe.Sizeof(*in) {
+			goto corrupt
+		}
+		req = &FallocateRequest{
+			Header: m.Header(),
+			Handle: HandleID(in.Fh),
+			Offset: in.Offset,
+			Length: in.Length,
+			Mode:   FallocateFlags(in.Mode),
+		}
+
+	case opIoctl:
+		in := (*ioctlIn)(m.data())
+		if m.len() < unsafe.Sizeof(*in) {
+			goto corrupt
+		}
+		buf := m.bytes()[unsafe.Sizeof(*in):]
+		if uint32(len(buf)) < in.InSize {
+			goto corrupt
+		}
+		req = &IoctlRequest{
+			Header:  m.Header(),
+			Handle:  HandleID(in.Fh),
+			Flags:   in.Flags,
+			Cmd:     in.Cmd,
+			Arg:     in.Arg,
+			Data:    buf[:in.InSize],
+			OutSize: in.OutSize,
+		}
+
+	case opCopyFileRange:
+		in := (*copyFileRangeIn)(m.data())
+		if m.len() < unsafe.Sizeof(*in) {
+			goto corrupt
+		}
+		req = &CopyFileRangeRequest{
+			Header:    m.Header(),
+			Handle:    HandleID(in.FhIn),
+			Offset:    in.OffIn,
+			NodeOut:   NodeID(in.NodeIdOut),
+			HandleOut: HandleID(in.FhOut),
+			OffsetOut: in.OffOut,
+			Len:       in.Len,
+			Flags:     in.Flags,
+		}
+
 	case opSetxattr:
 		in := (*setxattrIn)(m.data())
 		if m.len() < unsafe.Sizeof(*in) {
@@ -2264,6 +2313,117 @@ func (r *FsyncRequest) Respond() {
 	r.respond(buf)
 }
 
+// FallocateFlags are the mode bits of a FallocateRequest.
+type FallocateFlags uint32
+
+const (
+	FallocateKeepSize  FallocateFlags = 0x01
+	FallocatePunchHole FallocateFlags = 0x02
+)
+
+// A FallocateRequest asks to preallocate or deallocate space for the
+// byte range [Offset, Offset+Length) of an open file.
+type FallocateRequest struct {
+	Header `json:"-"`
+	Handle HandleID
+	Offset uint64
+	Length uint64
+	Mode   FallocateFlags
+}
+
+var _ = Request(&FallocateRequest{})
+
+func (r *FallocateRequest) String() string {
+	return fmt.Sprintf("Fallocate [%s] %v %d @%d mode=%#x", &r.Header, r.Handle, r.Length, r.Offset, uint32(r.Mode))
+}
+
+// Respond replies to the request, indicating that the allocation succeeded.
+func (r *FallocateRequest) Respond() {
+	buf := newBuffer(0)
+	r.respond(buf)
+}
+
+// An IoctlRequest asks to run the ioctl command Cmd on an open file.
+// Data holds the input of the command, and at most OutSize bytes of
+// output are expected in the response.
+type IoctlRequest struct {
+	Header  `json:"-"`
+	Handle  HandleID
+	Flags   uint32
+	Cmd     uint32
+	Arg     uint64
+	Data    []byte
+	OutSize uint32
+}
+
+var _ = Request(&IoctlRequest{})
+
+func (r *IoctlRequest) String() string {
+	return fmt.Sprintf("Ioctl [%s] %v cmd=%#x arg=%#x fl=%#x in=%d out=%d", &r.Header, r.Handle, r.Cmd, r.Arg, r.Flags, len(r.Data), r.OutSize)
+}
+
+// Respond replies to the request with the result and output of the command.
+func (r *IoctlRequest) Respond(resp *IoctlResponse) {
+	buf := newBuffer(unsafe.Sizeof(ioctlOut{}) + uintptr(len(resp.Data)))
+	out := (*ioctlOut)(buf.alloc(unsafe.Sizeof(ioctlOut{})))
+	out.Result = resp.Result
+	buf = append(buf, resp.Data...)
+	r.respond(buf)
+}
+
+// An IoctlResponse is the response to an IoctlRequest.
+type IoctlResponse struct {
+	Result int32
+	Data   []byte
+}
+
+func (r *IoctlResponse) String() string {
+	return fmt.Sprintf("Ioctl result=%d out=%d", r.Result, len(r.Data))
+}
+
+// A CopyFileRangeRequest asks to copy Len bytes at Offset of the open
+// file Handle to OffsetOut of the open file HandleOut, as
+// copy_file_range(2) does.
+type CopyFileRangeRequest struct {
+	Header    `json:"-"`
+	Handle    HandleID
+	Offset    uint64
+	NodeOut   NodeID
+	HandleOut HandleID
+	OffsetOut uint64
+	Len       uint64
+	Flags     uint64
+}
+
+var _ = Request(&CopyFileRangeRequest{})
+
+func (r *CopyFileRangeRequest) String() string {
+	return fmt.Sprintf("CopyFileRange [%s] %v %d @%d -> %v %v @%d fl=%#x", &r.Header, r.Handle, r.Len, r.Offset, r.NodeOut, r.HandleOut, r.OffsetOut, r.Flags)
+}
+
+// Respond replies to the request with the number of bytes copied. The
+// reply holds at most math.MaxUint32 bytes, a larger size is cut down to
+// it and the caller copies the rest again.
+func (r *CopyFileRangeRequest) Respond(resp *CopyFileRangeResponse) {
+	buf := newBuffer(unsafe.Sizeof(writeOut{}))
+	out := (*writeOut)(buf.alloc(unsafe.Sizeof(writeOut{})))
+	size := resp.Size
+	if uint64(size) > math.MaxUint32 {
+		size = math.MaxUint32
+	}
+	out.Size = uint32(size)
+	r.respond(buf)
+}
+
+// A CopyFileRangeResponse replies to a copy indicating how many bytes were copied.
+type CopyFileRangeResponse struct {
+	Size int
+}
+
+func (r *CopyFileRangeResponse) String() string {
+	return fmt.Sprintf("CopyFileRange %d", r.Size)
+}
+
 // An InterruptRequest is a request to interrupt another pending request. The
 // response to that request should return an error status of EINTR.
 type InterruptRequest struct {
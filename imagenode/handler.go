@@ -0,0 +1,184 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imagenode
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tiglabs/containerfs/sdk/data/blob"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// ServeHTTP serves the objects of the blob store:
+//
+//	PUT or POST /<vol>   writes the body as an object, and replies its key,
+//	                     the object expires after ?ttl=<duration> if given
+//	GET or HEAD /<key>   reads an object, a Range of it is supported
+//	DELETE /<key>        deletes an object
+func (s *ImageNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		s.putObject(w, r, name)
+	case http.MethodGet, http.MethodHead:
+		s.getObject(w, r, name)
+	case http.MethodDelete:
+		s.deleteObject(w, r, name)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST, DELETE")
+		handleError(w, r, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+	}
+}
+
+func handleError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	log.LogErrorf("action[ServeHTTP] %v %v from %v: status(%v) err(%v)", r.Method, r.URL.Path, r.RemoteAddr, code, err)
+	http.Error(w, err.Error(), code)
+}
+
+// statusOf returns the status reported for an error of the blob client.
+func statusOf(err error) int {
+	switch err {
+	case syscall.ENOENT, syscall.EINVAL:
+		return http.StatusNotFound
+	case syscall.ENOMEM:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// storeOf returns the store of the volume of key.
+func (s *ImageNode) storeOf(key string) (store blobStore, crc uint32, err error) {
+	_, vol, _, _, _, _, crc, err := blob.ParseKey(key)
+	if err != nil {
+		return nil, 0, syscall.EINVAL
+	}
+	if store = s.stores[vol]; store == nil {
+		return nil, 0, syscall.ENOENT
+	}
+	return store, crc, nil
+}
+
+// objectETag returns the ETag of an object, the CRC of its data.
+func objectETag(crc uint32) string {
+	return fmt.Sprintf("\"%08x\"", crc)
+}
+
+func (s *ImageNode) putObject(w http.ResponseWriter, r *http.Request, vol string) {
+	store := s.stores[vol]
+	if store == nil {
+		handleError(w, r, http.StatusNotFound, fmt.Errorf("vol %v not found", vol))
+		return
+	}
+	var ttl time.Duration
+	if value := r.URL.Query().Get(ParaTTL); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+			handleError(w, r, http.StatusBadRequest, fmt.Errorf("invalid %v %v", ParaTTL, value))
+			return
+		}
+	}
+	if r.ContentLength > s.maxObjectSize {
+		handleError(w, r, http.StatusRequestEntityTooLarge, fmt.Errorf("object larger than %v", s.maxObjectSize))
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, s.maxObjectSize+1))
+	if err != nil {
+		handleError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if int64(len(data)) > s.maxObjectSize {
+		handleError(w, r, http.StatusRequestEntityTooLarge, fmt.Errorf("object larger than %v", s.maxObjectSize))
+		return
+	}
+	start := time.Now()
+	key, err := store.Write(data, ttl)
+	if err != nil {
+		handleError(w, r, statusOf(err), err)
+		return
+	}
+	_, _, _, _, _, _, crc, _ := blob.ParseKey(key)
+	log.LogDebugf("TRACE putObject: key(%v) size(%v) (%v)ns", key, len(data), time.Since(start).Nanoseconds())
+	w.Header().Set("Location", "/"+key)
+	w.Header().Set("ETag", objectETag(crc))
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, key)
+}
+
+// getObject serves GET and HEAD of an object. Ranges and conditional
+// requests are served by http.ServeContent, which reads only the ranges
+// requested, and the content type is sniffed from the data.
+func (s *ImageNode) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	store, crc, err := s.storeOf(key)
+	if err != nil {
+		handleError(w, r, statusOf(err), fmt.Errorf("key %v not found", key))
+		return
+	}
+	content, err := store.Open(key)
+	if err == nil {
+		if c, ok := content.(io.Closer); ok {
+			defer c.Close()
+		}
+		err = sniffContentType(w, content)
+	}
+	if err != nil {
+		handleError(w, r, statusOf(err), err)
+		return
+	}
+	w.Header().Set("ETag", objectETag(crc))
+	w.Header().Set("Cache-Control", s.cacheControl)
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
+
+// sniffContentType sets the content type from the head of the object, which
+// also finds out if the object is missing before the reply is started. The
+// head is read with ReadAt if possible, which leaves the crc check of the
+// object read from its start to the reply.
+func sniffContentType(w http.ResponseWriter, content io.ReadSeeker) (err error) {
+	head := make([]byte, SniffLen)
+	var n int
+	if ra, ok := content.(io.ReaderAt); ok {
+		n, err = ra.ReadAt(head, 0)
+	} else {
+		n, err = io.ReadFull(content, head)
+		if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+			_, err = content.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(head[:n]))
+	return nil
+}
+
+func (s *ImageNode) deleteObject(w http.ResponseWriter, r *http.Request, key string) {
+	store, _, err := s.storeOf(key)
+	if err != nil {
+		handleError(w, r, statusOf(err), fmt.Errorf("key %v not found", key))
+		return
+	}
+	if err = store.Delete(key); err != nil {
+		handleError(w, r, statusOf(err), err)
+		return
+	}
+	log.LogDebugf("TRACE deleteObject: key(%v)", key)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imagenode
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tiglabs/containerfs/sdk/data/blob"
+)
+
+// memStore is a blobStore in memory.
+type memStore struct {
+	sync.Mutex
+	vol     string
+	nextID  int64
+	objects map[string][]byte
+}
+
+func (m *memStore) Write(data []byte, ttl time.Duration) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.nextID++
+	key := blob.GenKey("test", m.vol, 1, 1, m.nextID, uint32(len(data)), crc32.ChecksumIEEE(data))
+	m.objects[key] = append([]byte(nil), data...)
+	return key, nil
+}
+
+// Open returns a blob.Reader of the object, which checks its crc.
+func (m *memStore) Open(key string) (io.ReadSeeker, error) {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	_, _, _, _, _, _, crc, _ := blob.ParseKey(key)
+	return blob.NewSourceReader(key, int64(len(data)), crc, func(offset int64, length int) ([]byte, error) {
+		return data[offset : offset+int64(length)], nil
+	}), nil
+}
+
+func (m *memStore) Delete(key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func do(t *testing.T, s *ImageNode, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestImageNode(t *testing.T) {
+	s := &ImageNode{
+		cacheControl:  DefaultCacheControl,
+		maxObjectSize: 16,
+		stores:        map[string]blobStore{"img": &memStore{vol: "img", objects: make(map[string][]byte)}},
+	}
+	data := "0123456789abcdef"
+	w := do(t, s, http.MethodPut, "/img", data, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("put: %v %v", w.Code, w.Body.String())
+	}
+	key := w.Body.String()
+	etag := w.Header().Get("ETag")
+	if w.Header().Get("Location") != "/"+key || etag == "" {
+		t.Fatalf("put: location %v etag %v", w.Header().Get("Location"), etag)
+	}
+
+	w = do(t, s, http.MethodGet, "/"+key, "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != data || w.Header().Get("ETag") != etag ||
+		w.Header().Get("Cache-Control") != DefaultCacheControl {
+		t.Fatalf("get: %v %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	w = do(t, s, http.MethodGet, "/"+key, "", map[string]string{"Range": "bytes=2-5"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" || w.Header().Get("Content-Range") != "bytes 2-5/16" {
+		t.Fatalf("ranged get: %v %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	w = do(t, s, http.MethodGet, "/"+key, "", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("conditional get: %v", w.Code)
+	}
+	w = do(t, s, http.MethodHead, "/"+key, "", nil)
+	if body, _ := ioutil.ReadAll(w.Body); w.Code != http.StatusOK || len(body) != 0 || w.Header().Get("Content-Length") != "16" {
+		t.Fatalf("head: %v %q %v", w.Code, body, w.Header())
+	}
+
+	w = do(t, s, http.MethodDelete, "/"+key, "", nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %v", w.Code)
+	}
+	if w = do(t, s, http.MethodGet, "/"+key, "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: %v", w.Code)
+	}
+
+	if w = do(t, s, http.MethodPut, "/img", data+"x", nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("put too large: %v", w.Code)
+	}
+	if w = do(t, s, http.MethodPut, "/other", data, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("put to unknown vol: %v", w.Code)
+	}
+	if w = do(t, s, http.MethodGet, "/not/a/key", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("get bad key: %v", w.Code)
+	}
+}
+
+func TestGetCorruptObject(t *testing.T) {
+	store := &memStore{vol: "img", objects: make(map[string][]byte)}
+	s := &ImageNode{
+		cacheControl:  DefaultCacheControl,
+		maxObjectSize: 1 << 20,
+		stores:        map[string]blobStore{"img": store},
+	}
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	key, err := store.Write(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.objects[key][len(data)-1] ^= 0xff
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get: %v", resp.StatusCode)
+	}
+	// The reply is cut short before the last bytes.
+	if body, err := ioutil.ReadAll(resp.Body); err == nil || len(body) == len(data) {
+		t.Fatalf("get corrupt object: %v bytes, err %v", len(body), err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package imagenode implements the image store, an HTTP gateway of the blob
+// store. Objects are written to a volume and addressed by the keys of the
+// blob store afterwards, which are stable URLs since objects are immutable.
+package imagenode
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/sdk/data/blob"
+	"github.com/tiglabs/containerfs/util"
+	"github.com/tiglabs/containerfs/util/config"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	ConfigKeyListen        = "listen"        // string, e.g. ":80"
+	ConfigKeyMasterAddr    = "masterAddr"    // array
+	ConfigKeyVols          = "vols"          // array, the blob volumes served
+	ConfigKeyCacheControl  = "cacheControl"  // string
+	ConfigKeyMaxObjectSize = "maxObjectSize" // int, bytes
+)
+
+const (
+	DefaultListen = ":80"
+	// Objects never change, so they can be cached for good.
+	DefaultCacheControl  = "public, max-age=31536000, immutable"
+	DefaultMaxObjectSize = 4 * util.MB
+	// The head of an object the content type is sniffed from.
+	SniffLen = 512
+)
+
+const (
+	// The query parameter of the time to live of an object written.
+	ParaTTL = "ttl"
+)
+
+const (
+	Standby uint32 = iota
+	Start
+	Running
+	Shutdown
+	Stopped
+)
+
+var (
+	ErrBadConfFile = errors.New("bad config file")
+)
+
+// blobStore is what the gateway uses of blob.BlobClient.
+type blobStore interface {
+	Write(data []byte, ttl time.Duration) (key string, err error)
+	Open(key string) (r io.ReadSeeker, err error)
+	Delete(key string) (err error)
+}
+
+// clientStore is the blobStore of a blob.BlobClient, objects are opened as
+// blob.Readers so that ranges are read without reading the whole object.
+type clientStore struct {
+	*blob.BlobClient
+}
+
+func (s clientStore) Write(data []byte, ttl time.Duration) (string, error) {
+	return s.WriteWithOptions(data, blob.WriteOptions{TTL: ttl})
+}
+
+func (s clientStore) Open(key string) (io.ReadSeeker, error) {
+	r, err := s.NewReader(key)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ImageNode is the image store gateway.
+type ImageNode struct {
+	listen        string
+	cacheControl  string
+	maxObjectSize int64
+	stores        map[string]blobStore // by volume name
+
+	httpServer *http.Server
+	state      uint32
+	wg         sync.WaitGroup
+}
+
+func NewServer() *ImageNode {
+	return &ImageNode{}
+}
+
+func (s *ImageNode) Start(cfg *config.Config) (err error) {
+	if atomic.CompareAndSwapUint32(&s.state, Standby, Start) {
+		defer func() {
+			if err != nil {
+				atomic.StoreUint32(&s.state, Standby)
+			} else {
+				atomic.StoreUint32(&s.state, Running)
+			}
+		}()
+		if err = s.parseConfig(cfg); err != nil {
+			return
+		}
+		if err = s.startHttpService(); err != nil {
+			return
+		}
+		s.wg.Add(1)
+	}
+	return
+}
+
+func (s *ImageNode) Shutdown() {
+	if atomic.CompareAndSwapUint32(&s.state, Running, Shutdown) {
+		s.httpServer.Close()
+		s.wg.Done()
+		atomic.StoreUint32(&s.state, Stopped)
+	}
+}
+
+func (s *ImageNode) Sync() {
+	if atomic.LoadUint32(&s.state) == Running {
+		s.wg.Wait()
+	}
+}
+
+func (s *ImageNode) parseConfig(cfg *config.Config) (err error) {
+	if s.listen = cfg.GetString(ConfigKeyListen); s.listen == "" {
+		s.listen = DefaultListen
+	}
+	if s.cacheControl = cfg.GetString(ConfigKeyCacheControl); s.cacheControl == "" {
+		s.cacheControl = DefaultCacheControl
+	}
+	if s.maxObjectSize = cfg.GetInt(ConfigKeyMaxObjectSize); s.maxObjectSize <= 0 {
+		s.maxObjectSize = DefaultMaxObjectSize
+	}
+	masters := make([]string, 0)
+	for _, addr := range cfg.GetArray(ConfigKeyMasterAddr) {
+		masters = append(masters, addr.(string))
+	}
+	vols := cfg.GetArray(ConfigKeyVols)
+	if len(masters) == 0 || len(vols) == 0 {
+		return ErrBadConfFile
+	}
+	s.stores = make(map[string]blobStore)
+	for _, vol := range vols {
+		name := vol.(string)
+		client, err := blob.NewBlobClient(name, strings.Join(masters, ","))
+		if err != nil {
+			return errors.Annotatef(err, "NewBlobClient failed! vol[%v]", name)
+		}
+		s.stores[name] = clientStore{client}
+	}
+	log.LogDebugf("action[parseConfig] listen(%v) masters(%v) vols(%v) cacheControl(%v) maxObjectSize(%v)",
+		s.listen, masters, vols, s.cacheControl, s.maxObjectSize)
+	return
+}
+
+func (s *ImageNode) startHttpService() (err error) {
+	var ln net.Listener
+	if ln, err = net.Listen("tcp", s.listen); err != nil {
+		return
+	}
+	s.httpServer = &http.Server{Handler: s}
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.LogErrorf("action[startHttpService] serve failed, err(%v)", err)
+		}
+	}()
+	log.LogInfof("action[startHttpService] listen on %v", s.listen)
+	return
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	AccessKeyLength = 20
+	SecretKeyLength = 40
+
+	accessKeyChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	secretKeyChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+var (
+	AccessKeyNotFound = errors.New("access key not found")
+)
+
+func randomString(n int, chars string) (s string, err error) {
+	buf := make([]byte, n)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+	for i, b := range buf {
+		buf[i] = chars[int(b)%len(chars)]
+	}
+	return string(buf), nil
+}
+
+// createAccessKey creates a key pair of the object gateway which can access
+// vols, or all of the volumes if vols is empty.
+func (c *Cluster) createAccessKey(vols []string) (info *proto.AccessKeyInfo, err error) {
+	for _, name := range vols {
+		if _, err = c.getVol(name); err != nil {
+			goto errDeal
+		}
+	}
+	info = &proto.AccessKeyInfo{Vols: vols}
+	for {
+		if info.AccessKey, err = randomString(AccessKeyLength, accessKeyChars); err != nil {
+			goto errDeal
+		}
+		if _, ok := c.accessKeys.Load(info.AccessKey); !ok {
+			break
+		}
+	}
+	if info.SecretKey, err = randomString(SecretKeyLength, secretKeyChars); err != nil {
+		goto errDeal
+	}
+	if err = c.syncAddAccessKey(info); err != nil {
+		goto errDeal
+	}
+	c.accessKeys.Store(info.AccessKey, info)
+	return
+
+errDeal:
+	err = fmt.Errorf("action[createAccessKey], clusterID[%v] vols:%v, err:%v ", c.Name, vols, err.Error())
+	log.LogError(errors.ErrorStack(err))
+	return nil, err
+}
+
+func (c *Cluster) getAccessKey(accessKey string) (info *proto.AccessKeyInfo, err error) {
+	value, ok := c.accessKeys.Load(accessKey)
+	if !ok {
+		return nil, errors.Annotatef(AccessKeyNotFound, "%v not found", accessKey)
+	}
+	return value.(*proto.AccessKeyInfo), nil
+}
+
+func (c *Cluster) deleteAccessKey(accessKey string) (err error) {
+	var info *proto.AccessKeyInfo
+	if info, err = c.getAccessKey(accessKey); err != nil {
+		return
+	}
+	if err = c.syncDeleteAccessKey(info); err != nil {
+		return
+	}
+	c.accessKeys.Delete(accessKey)
+	return
+}
+
+// key=#ak#accessKey,value=json.Marshal(AccessKeyInfo)
+func (c *Cluster) syncAddAccessKey(info *proto.AccessKeyInfo) (err error) {
+	return c.putAccessKeyInfo(OpSyncAddAccessKey, info)
+}
+
+func (c *Cluster) syncDeleteAccessKey(info *proto.AccessKeyInfo) (err error) {
+	return c.putAccessKeyInfo(OpSyncDeleteAccessKey, info)
+}
+
+func (c *Cluster) putAccessKeyInfo(opType uint32, info *proto.AccessKeyInfo) (err error) {
+	metadata := new(Metadata)
+	metadata.Op = opType
+	metadata.K = AccessKeyPrefix + info.AccessKey
+	if metadata.V, err = json.Marshal(info); err != nil {
+		return errors.New(err.Error())
+	}
+	return c.submit(metadata)
+}
+
+func (c *Cluster) applyAddAccessKey(cmd *Metadata) {
+	log.LogInfof("action[applyAddAccessKey] cmd:%v", cmd.K)
+	keys := strings.Split(cmd.K, KeySeparator)
+	if keys[1] != AccessKeyAcronym {
+		return
+	}
+	info := &proto.AccessKeyInfo{}
+	if err := json.Unmarshal(cmd.V, info); err != nil {
+		log.LogError(fmt.Sprintf("action[applyAddAccessKey] failed,err:%v", err))
+		return
+	}
+	c.accessKeys.Store(info.AccessKey, info)
+}
+
+func (c *Cluster) applyDeleteAccessKey(cmd *Metadata) {
+	log.LogInfof("action[applyDeleteAccessKey] cmd:%v", cmd.K)
+	keys := strings.Split(cmd.K, KeySeparator)
+	if keys[1] != AccessKeyAcronym {
+		return
+	}
+	c.accessKeys.Delete(keys[2])
+}
+
+func (c *Cluster) loadAccessKeys() (err error) {
+	snapshot := c.fsm.store.RocksDBSnapshot()
+	it := c.fsm.store.Iterator(snapshot)
+	defer func() {
+		it.Close()
+		c.fsm.store.ReleaseSnapshot(snapshot)
+	}()
+	prefixKey := []byte(AccessKeyPrefix)
+	it.Seek(prefixKey)
+	for ; it.ValidForPrefix(prefixKey); it.Next() {
+		encodedKey := it.Key()
+		encodedValue := it.Value()
+		info := &proto.AccessKeyInfo{}
+		if err = json.Unmarshal(encodedValue.Data(), info); err != nil {
+			err = fmt.Errorf("action[loadAccessKeys],value:%v,err:%v", encodedValue.Data(), err)
+			return err
+		}
+		c.accessKeys.Store(info.AccessKey, info)
+		encodedKey.Free()
+	}
+	return
+}
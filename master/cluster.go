@@ -40,6 +40,7 @@ type Cluster struct {
 	idAlloc       *IDAllocator
 	t             *Topology
 	compactStatus bool
+	accessKeys    sync.Map // access key of the object gateway -> *proto.AccessKeyInfo
 }
 
 func newCluster(name string, leaderInfo *LeaderInfo, fsm *MetadataFsm, partition raftstore.Partition) (c *Cluster) {
@@ -595,9 +596,9 @@ func (c *Cluster) delMetaNodeFromCache(metaNode *MetaNode) {
 	go metaNode.clean()
 }
 
-func (c *Cluster) createVol(name, volType string, replicaNum uint8) (err error) {
+func (c *Cluster) createVol(name, volType string, replicaNum uint8, worm proto.WormPolicy, inlineSize uint32) (err error) {
 	var vol *Vol
-	if vol, err = c.createVolInternal(name, volType, replicaNum); err != nil {
+	if vol, err = c.createVolInternal(name, volType, replicaNum, worm, inlineSize); err != nil {
 		goto errDeal
 	}
 
@@ -617,12 +618,14 @@ errDeal:
 	return
 }
 
-func (c *Cluster) createVolInternal(name, volType string, replicaNum uint8) (vol *Vol, err error) {
+func (c *Cluster) createVolInternal(name, volType string, replicaNum uint8, worm proto.WormPolicy, inlineSize uint32) (vol *Vol, err error) {
 	if _, err = c.getVol(name); err == nil {
 		err = hasExist(name)
 		goto errDeal
 	}
 	vol = NewVol(name, volType, replicaNum)
+	vol.worm = worm
+	vol.inlineSize = inlineSize
 	if err = c.syncAddVol(vol); err != nil {
 		goto errDeal
 	}
@@ -638,17 +641,20 @@ errDeal:
 func (c *Cluster) CreateMetaPartitionForManual(volName string, start uint64) (err error) {
 
 	var (
-		maxPartitionID uint64
-		vol            *Vol
-		partition      *MetaPartition
+		lastPartitionID uint64
+		vol             *Vol
+		partition       *MetaPartition
 	)
 
 	if vol, err = c.getVol(volName); err != nil {
 		return errors.Annotatef(err, "get vol [%v] err", volName)
 	}
-	maxPartitionID = vol.getMaxPartitionID()
-	if partition, err = vol.getMetaPartition(maxPartitionID); err != nil {
-		return errors.Annotatef(err, "get meta partition [%v] err", maxPartitionID)
+	lastPartitionID = vol.getLastPartitionID()
+	if partition, err = vol.getMetaPartition(lastPartitionID); err != nil {
+		return errors.Annotatef(err, "get meta partition [%v] err", lastPartitionID)
+	}
+	if partition.SplitFrom != 0 {
+		return errors.Errorf("meta partition [%v] is being split", lastPartitionID)
 	}
 	if start < partition.MaxNodeID {
 		err = errors.Errorf("next meta partition start must be larger than %v", partition.MaxNodeID)
@@ -664,35 +670,91 @@ func (c *Cluster) CreateMetaPartitionForManual(volName string, start uint64) (er
 }
 
 func (c *Cluster) CreateMetaPartition(volName string, start, end uint64) (err error) {
+	_, err = c.createMetaPartition(volName, start, end, 0)
+	return
+}
+
+func (c *Cluster) createMetaPartition(volName string, start, end, splitFrom uint64) (mp *MetaPartition, err error) {
 	var (
 		vol         *Vol
-		mp          *MetaPartition
 		hosts       []string
 		partitionID uint64
 		peers       []proto.Peer
 	)
 	if vol, err = c.getVol(volName); err != nil {
-		return errors.Annotatef(err, "get vol [%v] err", volName)
+		return nil, errors.Annotatef(err, "get vol [%v] err", volName)
 	}
 
 	if hosts, peers, err = c.ChooseTargetMetaHosts(int(vol.mpReplicaNum)); err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 	log.LogInfof("target meta hosts:%v,peers:%v", hosts, peers)
 	if partitionID, err = c.idAlloc.allocateMetaPartitionID(); err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 	mp = NewMetaPartition(partitionID, start, end, vol.mpReplicaNum, volName)
 	mp.setPersistenceHosts(hosts)
 	mp.setPeers(peers)
+	mp.SplitFrom = splitFrom
 	if err = c.syncAddMetaPartition(volName, mp); err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 	vol.AddMetaPartition(mp)
 	c.putMetaNodeTasks(mp.generateCreateMetaPartitionTasks(nil, mp.Peers, volName))
 	return
 }
 
+// SplitMetaPartition moves the inodes after splitAt to a new partition,
+// which serves the range (splitAt, end] of the partition afterwards. The
+// new partition stays hidden from the clients until the meta node leading
+// the partition reports the items moved. A failed split is resumed by
+// splitting again at the same inode.
+func (c *Cluster) SplitMetaPartition(volName string, partitionID, splitAt uint64) (err error) {
+	var (
+		vol   *Vol
+		mp    *MetaPartition
+		newMp *MetaPartition
+		t     *proto.AdminTask
+	)
+	if vol, err = c.getVol(volName); err != nil {
+		return errors.Annotatef(err, "get vol [%v] err", volName)
+	}
+	if mp, err = vol.getMetaPartition(partitionID); err != nil {
+		return errors.Annotatef(err, "get meta partition [%v] err", partitionID)
+	}
+	if mp.SplitFrom != 0 {
+		return errors.Errorf("meta partition [%v] is being split from [%v]", partitionID, mp.SplitFrom)
+	}
+	for _, pending := range vol.cloneMetaPartitionMap() {
+		if pending.SplitFrom == partitionID {
+			newMp = pending
+		}
+	}
+	mp.Lock()
+	defer mp.Unlock()
+	if newMp != nil && newMp.Start != splitAt+1 {
+		return errors.Errorf("meta partition [%v] is being split at [%v]", partitionID, newMp.Start-1)
+	}
+	if newMp == nil && (splitAt < mp.Start || splitAt >= mp.End) {
+		return errors.Errorf("split inode [%v] out of range [%v, %v]", splitAt, mp.Start, mp.End)
+	}
+	if _, err = mp.getLeaderMetaReplica(); err != nil {
+		return errors.Annotate(err, "can't execute")
+	}
+	if newMp == nil {
+		if newMp, err = c.createMetaPartition(volName, splitAt+1, mp.End, partitionID); err != nil {
+			return errors.Annotatef(err, "create meta partition err")
+		}
+	}
+	if t, err = mp.generateSplitTask(volName, splitAt, newMp); err != nil {
+		return errors.Trace(err)
+	}
+	c.putMetaNodeTasks([]*proto.AdminTask{t})
+	log.LogWarnf("action[SplitMetaPartition] vol[%v] partitionID[%v] splitAt[%v] newPartitionID[%v]",
+		volName, partitionID, splitAt, newMp.PartitionID)
+	return
+}
+
 func (c *Cluster) hasEnoughWritableMetaHosts(replicaNum int) bool {
 	maxTotal := c.GetMetaNodeMaxTotal()
 	excludeHosts := make([]string, 0)
@@ -80,6 +80,12 @@ func (c *Cluster) loadDataPartitionAndCheckResponse(dp *DataPartition) {
 }
 
 func (c *Cluster) metaPartitionOffline(volName, nodeAddr string, partitionID uint64) (err error) {
+	return c.moveMetaReplica(volName, nodeAddr, "", partitionID)
+}
+
+// moveMetaReplica moves the replica of the partition on nodeAddr to
+// targetAddr, or to an available meta node if targetAddr is empty.
+func (c *Cluster) moveMetaReplica(volName, nodeAddr, targetAddr string, partitionID uint64) (err error) {
 	var (
 		vol         *Vol
 		mp          *MetaPartition
@@ -89,14 +95,20 @@ func (c *Cluster) metaPartitionOffline(volName, nodeAddr string, partitionID uin
 		onlineAddrs []string
 		newPeers    []proto.Peer
 		removePeer  proto.Peer
+		target      *MetaNode
 	)
-	log.LogWarnf("action[metaPartitionOffline],volName[%v],nodeAddr[%v],partitionID[%v]", volName, nodeAddr, partitionID)
+	log.LogWarnf("action[metaPartitionOffline],volName[%v],nodeAddr[%v],targetAddr[%v],partitionID[%v]",
+		volName, nodeAddr, targetAddr, partitionID)
 	if vol, err = c.getVol(volName); err != nil {
 		goto errDeal
 	}
 	if mp, err = vol.getMetaPartition(partitionID); err != nil {
 		goto errDeal
 	}
+	if vol.isSplitting(mp) {
+		err = errors.Errorf("meta partition[%v] is being split", partitionID)
+		goto errDeal
+	}
 	mp.Lock()
 	defer mp.Unlock()
 	if !contains(mp.PersistenceHosts, nodeAddr) {
@@ -107,8 +119,20 @@ func (c *Cluster) metaPartitionOffline(volName, nodeAddr string, partitionID uin
 		goto errDeal
 	}
 
-	if newHosts, newPeers, err = c.getAvailMetaNodeHosts(mp.PersistenceHosts, 1); err != nil {
-		goto errDeal
+	if targetAddr == "" {
+		if newHosts, newPeers, err = c.getAvailMetaNodeHosts(mp.PersistenceHosts, 1); err != nil {
+			goto errDeal
+		}
+	} else {
+		if contains(mp.PersistenceHosts, targetAddr) {
+			err = errors.Errorf("meta partition[%v] is on %v already", partitionID, targetAddr)
+			goto errDeal
+		}
+		if target, err = c.getMetaNode(targetAddr); err != nil {
+			goto errDeal
+		}
+		newHosts = []string{target.Addr}
+		newPeers = []proto.Peer{{ID: target.ID, Addr: target.Addr}}
 	}
 
 	onlineAddrs = make([]string, len(newHosts))
@@ -144,6 +168,58 @@ errDeal:
 	return
 }
 
+// BalanceMetaNodes moves one replica from the meta node using the largest
+// share of its memory to the one using the smallest share. The partition
+// with the most inodes that is not on the target node yet is moved.
+func (c *Cluster) BalanceMetaNodes() (err error) {
+	var (
+		src, dst  *MetaNode
+		mp        *MetaPartition
+		moved     *MetaPartition
+		movedSize uint64
+	)
+	c.metaNodes.Range(func(addr, node interface{}) bool {
+		metaNode := node.(*MetaNode)
+		if !metaNode.IsActive {
+			return true
+		}
+		if src == nil || metaNode.Ratio > src.Ratio {
+			src = metaNode
+		}
+		if dst == nil || metaNode.Ratio < dst.Ratio {
+			dst = metaNode
+		}
+		return true
+	})
+	if src == nil || src == dst || src.Ratio-dst.Ratio < DefaultMetaNodeBalanceRatio {
+		return errors.Errorf("meta nodes are balanced")
+	}
+	if !dst.IsWriteAble() {
+		return errors.Errorf("meta node[%v] is not writable", dst.Addr)
+	}
+	src.RLock()
+	reports := src.metaPartitionInfos
+	src.RUnlock()
+	for _, mr := range reports {
+		if mp, err = c.getMetaPartitionByID(mr.PartitionID); err != nil {
+			continue
+		}
+		if contains(mp.PersistenceHosts, dst.Addr) {
+			continue
+		}
+		if size := mr.MaxInodeID - mr.Start; moved == nil || size > movedSize {
+			moved = mp
+			movedSize = size
+		}
+	}
+	if moved == nil {
+		return errors.Errorf("no meta partition of meta node[%v] can be moved to [%v]", src.Addr, dst.Addr)
+	}
+	log.LogWarnf("action[BalanceMetaNodes] move meta partition[%v] from[%v] ratio[%v] to[%v] ratio[%v]",
+		moved.PartitionID, src.Addr, src.Ratio, dst.Addr, dst.Ratio)
+	return c.moveMetaReplica(moved.volName, src.Addr, dst.Addr, moved.PartitionID)
+}
+
 func (c *Cluster) loadMetaPartitionAndCheckResponse(mp *MetaPartition) {
 	go func() {
 		c.processLoadMetaPartition(mp)
@@ -210,6 +286,9 @@ func (c *Cluster) dealMetaNodeTaskResponse(nodeAddr string, task *proto.AdminTas
 	case proto.OpOfflineMetaPartition:
 		response := task.Response.(*proto.MetaPartitionOfflineResponse)
 		err = c.dealOfflineMetaPartitionResp(task.OperatorAddr, response)
+	case proto.OpSplitMetaPartition:
+		response := task.Response.(*proto.SplitMetaPartitionResponse)
+		err = c.dealSplitMetaPartitionResp(task.OperatorAddr, response)
 	default:
 		log.LogError(fmt.Sprintf("unknown operate code %v", task.OpCode))
 	}
@@ -238,6 +317,59 @@ func (c *Cluster) dealOfflineMetaPartitionResp(nodeAddr string, resp *proto.Meta
 	return
 }
 
+func (c *Cluster) dealSplitMetaPartitionResp(nodeAddr string, resp *proto.SplitMetaPartitionResponse) (err error) {
+	if resp.Status == proto.TaskFail {
+		msg := fmt.Sprintf("action[dealSplitMetaPartitionResp],clusterID[%v] nodeAddr %v "+
+			"split meta partition[%v] failed,err %v",
+			c.Name, nodeAddr, resp.PartitionID, resp.Result)
+		log.LogError(msg)
+		Warn(c.Name, msg)
+		return
+	}
+	var (
+		vol   *Vol
+		mp    *MetaPartition
+		newMp *MetaPartition
+	)
+	if vol, err = c.getVol(resp.VolName); err != nil {
+		goto errDeal
+	}
+	if mp, err = vol.getMetaPartition(resp.PartitionID); err != nil {
+		goto errDeal
+	}
+	if newMp, err = vol.getMetaPartition(resp.NewPartitionID); err != nil {
+		goto errDeal
+	}
+	mp.Lock()
+	if mp.End != resp.End {
+		oldEnd := mp.End
+		mp.End = resp.End
+		if err = c.syncUpdateMetaPartition(resp.VolName, mp); err != nil {
+			mp.End = oldEnd
+			mp.Unlock()
+			goto errDeal
+		}
+		mp.updateAllReplicasEnd()
+	}
+	mp.Unlock()
+	newMp.Lock()
+	defer newMp.Unlock()
+	if newMp.SplitFrom != 0 {
+		newMp.SplitFrom = 0
+		if err = c.syncUpdateMetaPartition(resp.VolName, newMp); err != nil {
+			newMp.SplitFrom = resp.PartitionID
+			goto errDeal
+		}
+	}
+	Warn(c.Name, fmt.Sprintf("clusterID[%v] meta partition[%v] split at[%v] to partition[%v] success",
+		c.Name, resp.PartitionID, resp.End, resp.NewPartitionID))
+	return
+errDeal:
+	log.LogError(fmt.Sprintf("action[dealSplitMetaPartitionResp],partitionID: %v,err: %v",
+		resp.PartitionID, errors.ErrorStack(err)))
+	return
+}
+
 func (c *Cluster) dealLoadMetaPartitionResp(nodeAddr string, resp *proto.LoadMetaPartitionMetricResponse) (err error) {
 	return
 }
@@ -563,9 +695,13 @@ func (c *Cluster) updateEnd(mp *MetaPartition, mr *proto.MetaPartitionReport, th
 		log.LogWarnf("action[updateEnd] vol[%v] not found", mp.volName)
 		return
 	}
-	maxPartitionID := vol.getMaxPartitionID()
-	if mp.PartitionID < maxPartitionID {
-		log.LogWarnf("action[updateEnd] vol[%v] id[%v] less than maxId[%v]", mp.volName, mp.PartitionID, maxPartitionID)
+	lastPartitionID := vol.getLastPartitionID()
+	if mp.PartitionID != lastPartitionID {
+		log.LogWarnf("action[updateEnd] vol[%v] id[%v] not last id[%v]", mp.volName, mp.PartitionID, lastPartitionID)
+		return
+	}
+	if mp.SplitFrom != 0 {
+		log.LogWarnf("action[updateEnd] vol[%v] id[%v] is being split from id[%v]", mp.volName, mp.PartitionID, mp.SplitFrom)
 		return
 	}
 
@@ -24,6 +24,11 @@ const (
 	ParaStart             = "start"
 	ParaEnable            = "enable"
 	ParaThreshold         = "threshold"
+	ParaWormRetention     = "wormRetention"
+	ParaWormAutoCommit    = "wormAutoCommit"
+	ParaInlineSize        = "inlineSize"
+	ParaAccessKey         = "accessKey"
+	ParaVols              = "vols"
 )
 
 const (
@@ -45,10 +50,12 @@ const (
 	DefaultMaxMetaPartitionInodeID  uint64  = 1<<63 - 1
 	DefaultMetaPartitionInodeIDStep uint64  = 1 << 24
 	DefaultMetaNodeReservedMem      uint64  = 1 << 32
+	DefaultMetaNodeBalanceRatio     float64 = 0.1
 	RuntimeStackBufSize                     = 4096
 	NodesAliveRate                  float32 = 0.5
 	MinReadWriteDataPartitions              = 200
 	SpaceAvailRate                          = 0.95
+	DefaultTopDirsCount                     = 10
 )
 
 const (
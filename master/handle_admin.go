@@ -323,12 +323,20 @@ func (m *Master) createVol(w http.ResponseWriter, r *http.Request) {
 		msg        string
 		volType    string
 		replicaNum int
+		worm       proto.WormPolicy
+		inlineSize uint32
 	)
 
 	if name, volType, replicaNum, err = parseCreateVolPara(r); err != nil {
 		goto errDeal
 	}
-	if err = m.cluster.createVol(name, volType, uint8(replicaNum)); err != nil {
+	if worm, err = parseWormPara(r); err != nil {
+		goto errDeal
+	}
+	if inlineSize, err = parseInlineSizePara(r); err != nil {
+		goto errDeal
+	}
+	if err = m.cluster.createVol(name, volType, uint8(replicaNum), worm, inlineSize); err != nil {
 		goto errDeal
 	}
 	msg = fmt.Sprintf("create vol[%v] successed\n", name)
@@ -520,6 +528,38 @@ errDeal:
 	return
 }
 
+func (m *Master) splitMetaPartition(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		splitAt     uint64
+		volName     string
+		msg         string
+		err         error
+	)
+	if volName, partitionID, splitAt, err = parseSplitMetaPartitionPara(r); err != nil {
+		goto errDeal
+	}
+	if err = m.cluster.SplitMetaPartition(volName, partitionID, splitAt); err != nil {
+		goto errDeal
+	}
+	msg = fmt.Sprintf(AdminSplitMetaPartition+" partitionID :%v split at %v request success", partitionID, splitAt)
+	io.WriteString(w, msg)
+	return
+errDeal:
+	logMsg := getReturnMessage(AdminSplitMetaPartition, r.RemoteAddr, err.Error(), http.StatusBadRequest)
+	HandleError(logMsg, err, http.StatusBadRequest, w)
+	return
+}
+
+func (m *Master) balanceMetaNodes(w http.ResponseWriter, r *http.Request) {
+	if err := m.cluster.BalanceMetaNodes(); err != nil {
+		logMsg := getReturnMessage(MetaNodeBalance, r.RemoteAddr, err.Error(), http.StatusBadRequest)
+		HandleError(logMsg, err, http.StatusBadRequest, w)
+		return
+	}
+	io.WriteString(w, MetaNodeBalance+" request success")
+}
+
 func (m *Master) loadMetaPartition(w http.ResponseWriter, r *http.Request) {
 	var (
 		volName     string
@@ -718,6 +758,44 @@ func parseCreateVolPara(r *http.Request) (name, volType string, replicaNum int,
 	return
 }
 
+// parseWormPara parses the optional WORM policy of a new volume, the
+// retention and auto commit periods are in seconds.
+func parseWormPara(r *http.Request) (worm proto.WormPolicy, err error) {
+	if retentionStr := r.FormValue(ParaWormRetention); retentionStr != "" {
+		if worm.Retention, err = strconv.ParseInt(retentionStr, 10, 64); err != nil || worm.Retention < 0 {
+			err = UnMatchPara
+			return
+		}
+	}
+	if autoCommitStr := r.FormValue(ParaWormAutoCommit); autoCommitStr != "" {
+		if worm.AutoCommit, err = strconv.ParseInt(autoCommitStr, 10, 64); err != nil || worm.AutoCommit < 0 {
+			err = UnMatchPara
+			return
+		}
+		if !worm.Enabled() {
+			err = paraNotFound(ParaWormRetention)
+			return
+		}
+	}
+	return
+}
+
+// parseInlineSizePara parses the optional size up to which the files of a
+// new volume are kept inline in their inodes, 0 if not set.
+func parseInlineSizePara(r *http.Request) (inlineSize uint32, err error) {
+	inlineSizeStr := r.FormValue(ParaInlineSize)
+	if inlineSizeStr == "" {
+		return
+	}
+	size, err := strconv.ParseUint(inlineSizeStr, 10, 32)
+	if err != nil || size > proto.MaxInlineSize {
+		err = UnMatchPara
+		return
+	}
+	inlineSize = uint32(size)
+	return
+}
+
 func parseCreateDataPartitionPara(r *http.Request) (count int, name, partitionType string, err error) {
 	r.ParseForm()
 	if countStr := r.FormValue(ParaCount); countStr == "" {
@@ -822,6 +900,15 @@ func parseMetaPartitionOffline(r *http.Request) (volName, nodeAddr string, parti
 	return
 }
 
+func parseSplitMetaPartitionPara(r *http.Request) (volName string, partitionID, splitAt uint64, err error) {
+	r.ParseForm()
+	if partitionID, err = checkMetaPartitionID(r); err != nil {
+		return
+	}
+	volName, splitAt, err = parseCreateMetaPartitionPara(r)
+	return
+}
+
 func parseCompactPara(r *http.Request) (status bool, err error) {
 	r.ParseForm()
 	var value string
@@ -861,3 +948,93 @@ func parseCreateMetaPartitionPara(r *http.Request) (volName string, start uint64
 	start, err = strconv.ParseUint(value, 10, 64)
 	return
 }
+
+func (m *Master) createAccessKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		vols []string
+		info *proto.AccessKeyInfo
+		body []byte
+		err  error
+	)
+	if vols, err = parseCreateAccessKeyPara(r); err != nil {
+		goto errDeal
+	}
+	if info, err = m.cluster.createAccessKey(vols); err != nil {
+		goto errDeal
+	}
+	if body, err = json.Marshal(info); err != nil {
+		goto errDeal
+	}
+	io.WriteString(w, string(body))
+	return
+errDeal:
+	logMsg := getReturnMessage("createAccessKey", r.RemoteAddr, err.Error(), http.StatusBadRequest)
+	HandleError(logMsg, err, http.StatusBadRequest, w)
+	return
+}
+
+func (m *Master) deleteAccessKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		accessKey string
+		err       error
+	)
+	if accessKey, err = parseAccessKeyPara(r); err != nil {
+		goto errDeal
+	}
+	if err = m.cluster.deleteAccessKey(accessKey); err != nil {
+		goto errDeal
+	}
+	io.WriteString(w, fmt.Sprintf("delete access key[%v] success", accessKey))
+	return
+errDeal:
+	logMsg := getReturnMessage("deleteAccessKey", r.RemoteAddr, err.Error(), http.StatusBadRequest)
+	HandleError(logMsg, err, http.StatusBadRequest, w)
+	return
+}
+
+func (m *Master) getAccessKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		accessKey string
+		info      *proto.AccessKeyInfo
+		body      []byte
+		err       error
+	)
+	if accessKey, err = parseAccessKeyPara(r); err != nil {
+		goto errDeal
+	}
+	if info, err = m.cluster.getAccessKey(accessKey); err != nil {
+		goto errDeal
+	}
+	if body, err = json.Marshal(info); err != nil {
+		goto errDeal
+	}
+	io.WriteString(w, string(body))
+	return
+errDeal:
+	logMsg := getReturnMessage("getAccessKey", r.RemoteAddr, err.Error(), http.StatusBadRequest)
+	HandleError(logMsg, err, http.StatusBadRequest, w)
+	return
+}
+
+// parseCreateAccessKeyPara parses the optional comma separated volumes the
+// new key can access.
+func parseCreateAccessKeyPara(r *http.Request) (vols []string, err error) {
+	r.ParseForm()
+	vols = make([]string, 0)
+	if value := r.FormValue(ParaVols); value != "" {
+		for _, name := range strings.Split(value, CommaSplit) {
+			if name = strings.TrimSpace(name); name != "" {
+				vols = append(vols, name)
+			}
+		}
+	}
+	return
+}
+
+func parseAccessKeyPara(r *http.Request) (accessKey string, err error) {
+	r.ParseForm()
+	if accessKey = r.FormValue(ParaAccessKey); accessKey == "" {
+		err = paraNotFound(ParaAccessKey)
+	}
+	return
+}
@@ -17,6 +17,7 @@ package master
 import (
 	"encoding/json"
 	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/util/log"
 	"net/http"
 	"regexp"
@@ -59,6 +60,8 @@ type MetaPartitionView struct {
 type VolView struct {
 	Name           string
 	VolType        string
+	Worm           proto.WormPolicy
+	InlineSize     uint32
 	MetaPartitions []*MetaPartitionView
 	DataPartitions []*DataPartitionResponse
 }
@@ -166,8 +169,41 @@ errDeal:
 	return
 }
 
+// getVolTopDirs answers the largest directories of a volume, by the bytes
+// of the files under them.
+func (m *Master) getVolTopDirs(w http.ResponseWriter, r *http.Request) {
+	var (
+		body  []byte
+		code  int
+		err   error
+		name  string
+		count int
+		vol   *Vol
+		ok    bool
+	)
+	if name, count, err = parseVolTopDirsPara(r); err != nil {
+		goto errDeal
+	}
+	if vol, ok = m.cluster.vols[name]; !ok {
+		err = errors.Annotatef(VolNotFound, "%v not found", name)
+		goto errDeal
+	}
+	if body, err = json.Marshal(vol.topDirs(count)); err != nil {
+		code = http.StatusMethodNotAllowed
+		goto errDeal
+	}
+	w.Write(body)
+	return
+errDeal:
+	logMsg := getReturnMessage("getVolTopDirs", r.RemoteAddr, err.Error(), code)
+	HandleError(logMsg, err, code, w)
+	return
+}
+
 func (m *Master) getVolView(vol *Vol) (view *VolView) {
 	view = NewVolView(vol.Name, vol.VolType)
+	view.Worm = vol.worm
+	view.InlineSize = vol.inlineSize
 	setMetaPartitions(vol, view, m.cluster.getLiveMetaNodesRate())
 	setDataPartitions(vol, view, m.cluster.getLiveDataNodesRate())
 	return
@@ -187,6 +223,11 @@ func setMetaPartitions(vol *Vol, view *VolView, liveRate float32) {
 	vol.mpsLock.RLock()
 	defer vol.mpsLock.RUnlock()
 	for _, mp := range vol.MetaPartitions {
+		// The range of a partition being split is still served by the
+		// source partition.
+		if mp.SplitFrom != 0 {
+			continue
+		}
 		view.MetaPartitions = append(view.MetaPartitions, getMetaPartitionView(mp))
 	}
 }
@@ -278,9 +319,23 @@ func parseGetVolPara(r *http.Request) (name string, err error) {
 	return checkVolPara(r)
 }
 
+func parseVolTopDirsPara(r *http.Request) (name string, count int, err error) {
+	r.ParseForm()
+	if name, err = checkVolPara(r); err != nil {
+		return
+	}
+	count = DefaultTopDirsCount
+	if value := r.FormValue(ParaCount); value != "" {
+		if count, err = strconv.Atoi(value); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func checkVolPara(r *http.Request) (name string, err error) {
 	if name = r.FormValue(ParaName); name == "" {
-		err = paraNotFound(name)
+		err = paraNotFound(ParaName)
 		return
 	}
 
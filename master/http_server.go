@@ -30,12 +30,16 @@ const (
 	AdminCreateDataPartition  = "/dataPartition/create"
 	AdminDataPartitionOffline = "/dataPartition/offline"
 	AdminDeleteVol            = "/vol/delete"
+	AdminVolTopDirs           = "/vol/topDirs"
 	AdminCreateVol            = "/admin/createVol"
 	AdminGetIp                = "/admin/getIp"
 	AdminCreateMP             = "/metaPartition/create"
 	AdminSetCompactStatus     = "/compactStatus/set"
 	AdminGetCompactStatus     = "/compactStatus/get"
 	AdminSetMetaNodeThreshold = "/threshold/set"
+	AdminCreateAccessKey      = "/accessKey/create"
+	AdminDeleteAccessKey      = "/accessKey/delete"
+	AdminGetAccessKey         = "/accessKey/get"
 
 	// Client APIs
 	ClientDataPartitions = "/client/dataPartitions"
@@ -56,6 +60,8 @@ const (
 	GetMetaNode               = "/metaNode/get"
 	AdminLoadMetaPartition    = "/metaPartition/load"
 	AdminMetaPartitionOffline = "/metaPartition/offline"
+	AdminSplitMetaPartition   = "/metaPartition/split"
+	MetaNodeBalance           = "/metaNode/balance"
 
 	// Operation response
 	MetaNodeResponse = "/metaNode/response" // Method: 'POST', ContentType: 'application/json'
@@ -79,6 +85,7 @@ func (m *Master) handleFunctions() {
 	http.Handle(AdminDataPartitionOffline, m.handlerWithInterceptor())
 	http.Handle(AdminCreateVol, m.handlerWithInterceptor())
 	http.Handle(AdminDeleteVol, m.handlerWithInterceptor())
+	http.Handle(AdminVolTopDirs, m.handlerWithInterceptor())
 	http.Handle(AddDataNode, m.handlerWithInterceptor())
 	http.Handle(AddMetaNode, m.handlerWithInterceptor())
 	http.Handle(DataNodeOffline, m.handlerWithInterceptor())
@@ -87,6 +94,8 @@ func (m *Master) handleFunctions() {
 	http.Handle(GetMetaNode, m.handlerWithInterceptor())
 	//http.Handle(AdminLoadMetaPartition, m.handlerWithInterceptor())
 	http.Handle(AdminMetaPartitionOffline, m.handlerWithInterceptor())
+	http.Handle(AdminSplitMetaPartition, m.handlerWithInterceptor())
+	http.Handle(MetaNodeBalance, m.handlerWithInterceptor())
 	http.Handle(ClientDataPartitions, m.handlerWithInterceptor())
 	http.Handle(ClientVol, m.handlerWithInterceptor())
 	http.Handle(ClientMetaPartition, m.handlerWithInterceptor())
@@ -99,6 +108,9 @@ func (m *Master) handleFunctions() {
 	http.Handle(AdminSetCompactStatus, m.handlerWithInterceptor())
 	http.Handle(AdminGetCompactStatus, m.handlerWithInterceptor())
 	http.Handle(AdminSetMetaNodeThreshold, m.handlerWithInterceptor())
+	http.Handle(AdminCreateAccessKey, m.handlerWithInterceptor())
+	http.Handle(AdminDeleteAccessKey, m.handlerWithInterceptor())
+	http.Handle(AdminGetAccessKey, m.handlerWithInterceptor())
 
 	return
 }
@@ -130,6 +142,8 @@ func (m *Master) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		m.createVol(w, r)
 	case AdminDeleteVol:
 		m.markDeleteVol(w, r)
+	case AdminVolTopDirs:
+		m.getVolTopDirs(w, r)
 	case AddDataNode:
 		m.addDataNode(w, r)
 	case GetDataNode:
@@ -158,6 +172,10 @@ func (m *Master) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		m.loadMetaPartition(w, r)
 	case AdminMetaPartitionOffline:
 		m.metaPartitionOffline(w, r)
+	case AdminSplitMetaPartition:
+		m.splitMetaPartition(w, r)
+	case MetaNodeBalance:
+		m.balanceMetaNodes(w, r)
 	case AdminCreateMP:
 		m.createMetaPartition(w, r)
 	case RaftNodeAdd:
@@ -170,6 +188,12 @@ func (m *Master) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		m.getCompactStatus(w, r)
 	case AdminSetMetaNodeThreshold:
 		m.setMetaNodeThreshold(w, r)
+	case AdminCreateAccessKey:
+		m.createAccessKey(w, r)
+	case AdminDeleteAccessKey:
+		m.deleteAccessKey(w, r)
+	case AdminGetAccessKey:
+		m.getAccessKey(w, r)
 	default:
 
 	}
@@ -182,5 +206,8 @@ func getReturnMessage(requestType, remoteAddr, message string, code int) (logMsg
 
 func HandleError(message string, err error, code int, w http.ResponseWriter) {
 	log.LogErrorf("errMsg:%v errStack:%v", message, errors.ErrorStack(err))
+	if code == 0 {
+		code = http.StatusBadRequest
+	}
 	http.Error(w, message, code)
 }
@@ -102,5 +102,8 @@ func (m *Master) loadMetadata() {
 	if err = m.cluster.loadDataPartitions(); err != nil {
 		panic(err)
 	}
+	if err = m.cluster.loadAccessKeys(); err != nil {
+		panic(err)
+	}
 
 }
@@ -49,6 +49,10 @@ type MetaPartition struct {
 	PersistenceHosts []string
 	Peers            []proto.Peer
 	MissNodes        map[string]int64
+	SplitFrom        uint64 // Set while the partition imports the upper range of partition SplitFrom
+	worm             proto.WormPolicy
+	inlineSize       uint32
+	topDirs          []proto.InodeUsage // Largest directories reported by the leader
 	sync.RWMutex
 }
 
@@ -164,9 +168,9 @@ errDeal:
 	return
 }
 
-func (mp *MetaPartition) checkEnd(c *Cluster, maxPartitionID uint64) {
+func (mp *MetaPartition) checkEnd(c *Cluster, lastPartitionID uint64) {
 
-	if mp.PartitionID < maxPartitionID {
+	if mp.PartitionID != lastPartitionID {
 		return
 	}
 	vol, err := c.getVol(mp.volName)
@@ -176,9 +180,13 @@ func (mp *MetaPartition) checkEnd(c *Cluster, maxPartitionID uint64) {
 	}
 	mp.Lock()
 	defer mp.Unlock()
-	curMaxPartitionID := vol.getMaxPartitionID()
-	if mp.PartitionID != curMaxPartitionID {
-		log.LogWarnf("action[checkEnd] partition[%v] not max partition[%v]", mp.PartitionID, curMaxPartitionID)
+	curLastPartitionID := vol.getLastPartitionID()
+	if mp.PartitionID != curLastPartitionID {
+		log.LogWarnf("action[checkEnd] partition[%v] not last partition[%v]", mp.PartitionID, curLastPartitionID)
+		return
+	}
+	if mp.SplitFrom != 0 {
+		log.LogWarnf("action[checkEnd] partition[%v] is being split from partition[%v]", mp.PartitionID, mp.SplitFrom)
 		return
 	}
 	if mp.End != DefaultMaxMetaPartitionInodeID {
@@ -300,6 +308,9 @@ func (mp *MetaPartition) UpdateMetaPartition(mgr *proto.MetaPartitionReport, met
 		mp.addReplica(mr)
 	}
 	mp.MaxNodeID = mgr.MaxInodeID
+	if mgr.IsLeader {
+		mp.topDirs = mgr.TopDirs
+	}
 	mr.updateMetric(mgr)
 	mp.checkAndRemoveMissMetaReplica(metaNode.Addr)
 }
@@ -446,6 +457,9 @@ func (mp *MetaPartition) generateCreateMetaPartitionTasks(specifyAddrs []string,
 		PartitionID: mp.PartitionID,
 		Members:     peers,
 		VolName:     volName,
+		Worm:        mp.worm,
+		SplitFrom:   mp.SplitFrom,
+		InlineSize:  mp.inlineSize,
 	}
 	if specifyAddrs == nil {
 		hosts = mp.PersistenceHosts
@@ -476,6 +490,23 @@ func (mp *MetaPartition) generateOfflineTask(volName string, removePeer proto.Pe
 	return
 }
 
+func (mp *MetaPartition) generateSplitTask(volName string, splitAt uint64, newMp *MetaPartition) (t *proto.AdminTask, err error) {
+	mr, err := mp.getLeaderMetaReplica()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	req := &proto.SplitMetaPartitionRequest{
+		PartitionID:    mp.PartitionID,
+		VolName:        volName,
+		SplitAt:        splitAt,
+		NewPartitionID: newMp.PartitionID,
+		NewPeers:       newMp.Peers,
+	}
+	t = proto.NewAdminTask(proto.OpSplitMetaPartition, mr.Addr, req)
+	resetMetaPartitionTaskID(t, mp.PartitionID)
+	return
+}
+
 func resetMetaPartitionTaskID(t *proto.AdminTask, partitionID uint64) {
 	t.ID = fmt.Sprintf("%v_pid[%v]", t.ID, partitionID)
 }
@@ -527,5 +558,5 @@ func (mp *MetaPartition) updateMetricByRaft(mpv *MetaPartitionValue) {
 	mp.End = mpv.End
 	mp.Peers = mpv.Peers
 	mp.PersistenceHosts = strings.Split(mpv.Hosts, UnderlineSeparator)
-
+	mp.SplitFrom = mpv.SplitFrom
 }
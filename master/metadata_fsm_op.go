@@ -43,6 +43,8 @@ const (
 	OpSyncDeleteVol            uint32 = 0x0F
 	OpSyncDeleteDataPartition  uint32 = 0x10
 	OpSyncDeleteMetaPartition  uint32 = 0x11
+	OpSyncAddAccessKey         uint32 = 0x12
+	OpSyncDeleteAccessKey      uint32 = 0x13
 )
 
 const (
@@ -53,12 +55,14 @@ const (
 	MetaPartitionAcronym = "mp"
 	VolAcronym           = "vol"
 	ClusterAcronym       = "c"
+	AccessKeyAcronym     = "ak"
 	MetaNodePrefix       = KeySeparator + MetaNodeAcronym + KeySeparator
 	DataNodePrefix       = KeySeparator + DataNodeAcronym + KeySeparator
 	DataPartitionPrefix  = KeySeparator + DataPartitionAcronym + KeySeparator
 	VolPrefix            = KeySeparator + VolAcronym + KeySeparator
 	MetaPartitionPrefix  = KeySeparator + MetaPartitionAcronym + KeySeparator
 	ClusterPrefix        = KeySeparator + ClusterAcronym + KeySeparator
+	AccessKeyPrefix      = KeySeparator + AccessKeyAcronym + KeySeparator
 )
 
 type MetaPartitionValue struct {
@@ -68,6 +72,7 @@ type MetaPartitionValue struct {
 	End         uint64
 	Hosts       string
 	Peers       []bsProto.Peer
+	SplitFrom   uint64
 }
 
 func newMetaPartitionValue(mp *MetaPartition) (mpv *MetaPartitionValue) {
@@ -78,6 +83,7 @@ func newMetaPartitionValue(mp *MetaPartition) (mpv *MetaPartitionValue) {
 		End:         mp.End,
 		Hosts:       mp.hostsToString(),
 		Peers:       mp.Peers,
+		SplitFrom:   mp.SplitFrom,
 	}
 	return
 }
@@ -103,6 +109,8 @@ type VolValue struct {
 	VolType    string
 	ReplicaNum uint8
 	Status     uint8
+	Worm       bsProto.WormPolicy
+	InlineSize uint32
 }
 
 func newVolValue(vol *Vol) (vv *VolValue) {
@@ -110,6 +118,8 @@ func newVolValue(vol *Vol) (vv *VolValue) {
 		VolType:    vol.VolType,
 		ReplicaNum: vol.dpReplicaNum,
 		Status:     vol.Status,
+		Worm:       vol.worm,
+		InlineSize: vol.inlineSize,
 	}
 	return
 }
@@ -159,6 +169,8 @@ func (m *Metadata) setOpType() {
 		m.Op = OpSyncAddVol
 	case ClusterAcronym:
 		m.Op = OpSyncPutCluster
+	case AccessKeyAcronym:
+		m.Op = OpSyncAddAccessKey
 	default:
 		log.LogWarnf("action[setOpType] unknown opCode[%v]", keyArr[1])
 	}
@@ -352,6 +364,10 @@ func (c *Cluster) handleApply(cmd *Metadata) (err error) {
 		c.applyDeleteDataNode(cmd)
 	case OpSyncPutCluster:
 		c.applyPutCluster(cmd)
+	case OpSyncAddAccessKey:
+		c.applyAddAccessKey(cmd)
+	case OpSyncDeleteAccessKey:
+		c.applyDeleteAccessKey(cmd)
 	case OpSyncAllocMetaNodeID:
 		c.idAlloc.increaseMetaNodeID()
 	case OpSyncAllocDataPartitionID:
@@ -440,6 +456,8 @@ func (c *Cluster) applyAddVol(cmd *Metadata) {
 			return
 		}
 		vol := NewVol(keys[2], vv.VolType, vv.ReplicaNum)
+		vol.worm = vv.Worm
+		vol.inlineSize = vv.InlineSize
 		c.putVol(vol)
 	}
 }
@@ -487,6 +505,7 @@ func (c *Cluster) applyAddMetaPartition(cmd *Metadata) {
 		mp.Lock()
 		mp.Peers = mpv.Peers
 		mp.PersistenceHosts = strings.Split(mpv.Hosts, UnderlineSeparator)
+		mp.SplitFrom = mpv.SplitFrom
 		mp.Unlock()
 		vol, _ := c.getVol(keys[2])
 		vol.AddMetaPartitionByRaft(mp)
@@ -663,6 +682,8 @@ func (c *Cluster) loadVols() (err error) {
 		}
 		vol := NewVol(volName, vv.VolType, vv.ReplicaNum)
 		vol.Status = vv.Status
+		vol.worm = vv.Worm
+		vol.inlineSize = vv.InlineSize
 		c.putVol(vol)
 		encodedKey.Free()
 	}
@@ -697,6 +718,7 @@ func (c *Cluster) loadMetaPartitions() (err error) {
 		mp.Lock()
 		mp.setPersistenceHosts(strings.Split(mpv.Hosts, UnderlineSeparator))
 		mp.setPeers(mpv.Peers)
+		mp.SplitFrom = mpv.SplitFrom
 		mp.Unlock()
 		vol.AddMetaPartition(mp)
 		encodedKey.Free()
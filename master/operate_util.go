@@ -77,6 +77,8 @@ func UnmarshalTaskResponse(task *proto.AdminTask) (err error) {
 		response = task.Response.(*proto.LoadMetaPartitionMetricResponse)
 	case proto.OpOfflineMetaPartition:
 		response = task.Response.(*proto.MetaPartitionOfflineResponse)
+	case proto.OpSplitMetaPartition:
+		response = &proto.SplitMetaPartitionResponse{}
 
 	default:
 		log.LogError(fmt.Sprintf("unknown operate code(%v)", task.OpCode))
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/util/log"
+	"sort"
 	"sync"
 )
 
@@ -31,6 +32,8 @@ type Vol struct {
 	mpsLock        sync.RWMutex
 	dataPartitions *DataPartitionMap
 	Status         uint8
+	worm           proto.WormPolicy // set at creation and never changed
+	inlineSize     uint32           // set at creation and never changed
 	sync.RWMutex
 }
 
@@ -50,6 +53,8 @@ func NewVol(name, volType string, replicaNum uint8) (vol *Vol) {
 func (vol *Vol) AddMetaPartition(mp *MetaPartition) {
 	vol.mpsLock.Lock()
 	defer vol.mpsLock.Unlock()
+	mp.worm = vol.worm
+	mp.inlineSize = vol.inlineSize
 	if _, ok := vol.MetaPartitions[mp.PartitionID]; !ok {
 		vol.MetaPartitions[mp.PartitionID] = mp
 	}
@@ -58,6 +63,8 @@ func (vol *Vol) AddMetaPartition(mp *MetaPartition) {
 func (vol *Vol) AddMetaPartitionByRaft(mp *MetaPartition) {
 	vol.mpsLock.Lock()
 	defer vol.mpsLock.Unlock()
+	mp.worm = vol.worm
+	mp.inlineSize = vol.inlineSize
 	vol.MetaPartitions[mp.PartitionID] = mp
 }
 
@@ -71,17 +78,38 @@ func (vol *Vol) getMetaPartition(partitionID uint64) (mp *MetaPartition, err err
 	return
 }
 
-func (vol *Vol) getMaxPartitionID() (maxPartitionID uint64) {
+// getLastPartitionID returns the partition serving the highest inode range,
+// whose end is extended as the inodes are used up. The new partition of a
+// split has the largest id without serving the highest range.
+func (vol *Vol) getLastPartitionID() (lastPartitionID uint64) {
 	vol.mpsLock.RLock()
 	defer vol.mpsLock.RUnlock()
-	for id := range vol.MetaPartitions {
-		if id > maxPartitionID {
-			maxPartitionID = id
+	var start uint64
+	for id, mp := range vol.MetaPartitions {
+		if lastPartitionID == 0 || mp.Start > start {
+			lastPartitionID = id
+			start = mp.Start
 		}
 	}
 	return
 }
 
+// isSplitting tells whether the partition is the source or the new
+// partition of a split in progress.
+func (vol *Vol) isSplitting(mp *MetaPartition) bool {
+	if mp.SplitFrom != 0 {
+		return true
+	}
+	vol.mpsLock.RLock()
+	defer vol.mpsLock.RUnlock()
+	for _, pending := range vol.MetaPartitions {
+		if pending.SplitFrom == mp.PartitionID {
+			return true
+		}
+	}
+	return false
+}
+
 func (vol *Vol) getDataPartitionsView(liveRate float32) (body []byte, err error) {
 	if liveRate < NodesAliveRate {
 		body = make([]byte, 0)
@@ -141,13 +169,13 @@ func (vol *Vol) ReleaseDataPartitionsAfterLoad(releaseCount int, afterLoadSecond
 
 func (vol *Vol) checkMetaPartitions(c *Cluster) {
 	var tasks []*proto.AdminTask
-	maxPartitionID := vol.getMaxPartitionID()
+	lastPartitionID := vol.getLastPartitionID()
 	mps := vol.cloneMetaPartitionMap()
 	for _, mp := range mps {
 		mp.checkStatus(true, int(vol.mpReplicaNum))
 		mp.checkReplicaLeader()
 		mp.checkReplicaNum(c, vol.Name, vol.mpReplicaNum)
-		mp.checkEnd(c, maxPartitionID)
+		mp.checkEnd(c, lastPartitionID)
 		mp.checkReplicaMiss(c.Name, DefaultMetaPartitionTimeOutSec, DefaultMetaPartitionWarnInterval)
 		tasks = append(tasks, mp.GenerateReplicaTask(c.Name, vol.Name)...)
 	}
@@ -164,6 +192,23 @@ func (vol *Vol) cloneMetaPartitionMap() (mps map[uint64]*MetaPartition) {
 	return
 }
 
+// topDirs returns the count largest directories reported by the leaders of
+// the meta partitions, the largest first.
+func (vol *Vol) topDirs(count int) (dirs []proto.InodeUsage) {
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		mp.RLock()
+		dirs = append(dirs, mp.topDirs...)
+		mp.RUnlock()
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Bytes > dirs[j].Bytes
+	})
+	if len(dirs) > count {
+		dirs = dirs[:count]
+	}
+	return
+}
+
 func (vol *Vol) statSpace() (used, total uint64) {
 	vol.dataPartitions.RLock()
 	defer vol.dataPartitions.RUnlock()
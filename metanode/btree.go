@@ -26,6 +26,27 @@ const defaultBTreeDegree = 32
 type (
 	BtreeItem = btree.Item
 )
+
+// MetaTree stores the inodes or the dentries of a meta partition in key
+// order. Items returned by Get, Find and ReplaceOrInsert may be modified in
+// place, items passed to the Ascend iterators are read only.
+type MetaTree interface {
+	Get(key BtreeItem) BtreeItem
+	Find(key BtreeItem, fn func(i BtreeItem))
+	Has(key BtreeItem) bool
+	Delete(key BtreeItem) BtreeItem
+	ReplaceOrInsert(key BtreeItem, replace bool) (BtreeItem, bool)
+	Ascend(fn func(i BtreeItem) bool)
+	AscendRange(greaterOrEqual, lessThan BtreeItem, iterator func(i BtreeItem) bool)
+	AscendGreaterOrEqual(pivot BtreeItem, iterator func(i BtreeItem) bool)
+	// GetTree returns a read only copy of the tree, it has to be released
+	// once it is no longer used.
+	GetTree() MetaTree
+	Release()
+	Reset()
+	Len() int
+}
+
 type BTree struct {
 	sync.RWMutex
 	tree *btree.BTree
@@ -99,7 +120,7 @@ func (b *BTree) AscendGreaterOrEqual(pivot BtreeItem, iterator func(i BtreeItem)
 	t.AscendGreaterOrEqual(pivot, iterator)
 }
 
-func (b *BTree) GetTree() *BTree {
+func (b *BTree) GetTree() MetaTree {
 	b.Lock()
 	t := b.tree.Clone()
 	b.Unlock()
@@ -108,6 +129,8 @@ func (b *BTree) GetTree() *BTree {
 	return nb
 }
 
+func (b *BTree) Release() {}
+
 func (b *BTree) Reset() {
 	b.Lock()
 	b.tree.Clear(false)
@@ -0,0 +1,687 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/util/btree"
+	"github.com/tiglabs/containerfs/util/gorocksdb"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	rocksInodePrefix     byte = 'i'
+	rocksDentryPrefix    byte = 'd'
+	rocksMetaPrefix      byte = 'm'
+	rocksExtentRefPrefix byte = 'x'
+
+	// Decoded items kept in memory per tree once they have been stored.
+	rocksCacheItems = 1 << 18
+	// Size of the rocksdb block cache of a partition.
+	rocksBlockCache = 256 << 20
+)
+
+var (
+	rocksApplyIDKey   = []byte{rocksMetaPrefix, 'a'}
+	rocksRestoringKey = []byte{rocksMetaPrefix, 'r'}
+	// Set once the extent reference counts are stored, they are missing
+	// in the instances written before.
+	rocksExtentRefsKey = []byte{rocksMetaPrefix, 'x'}
+	// The pending link changes, missing in the instances written before
+	// they were stored.
+	rocksLinksKey = []byte{rocksMetaPrefix, 'l'}
+)
+
+// rocksItem is an item of a RocksTree, the marshaled keys have to sort in
+// the same order as the items.
+type rocksItem interface {
+	BtreeItem
+	MarshalKey() []byte
+	UnmarshalKey(k []byte) error
+	MarshalValue() []byte
+	UnmarshalValue(v []byte) error
+}
+
+// rocksEntry is an item which has been changed or handed out since the last
+// flush, or a deleted one.
+type rocksEntry struct {
+	key     []byte
+	item    rocksItem
+	orig    []byte // Value stored in rocksdb, nil if the key is not stored
+	deleted bool
+}
+
+func (e *rocksEntry) Less(than btree.Item) bool {
+	return bytes.Compare(e.key, than.(*rocksEntry).key) < 0
+}
+
+// RocksTree is a MetaTree stored in rocksdb. The items handed out to be
+// modified in place stay in memory until the next flush, which writes the
+// changed ones together with the applyID of the partition.
+//
+// A MetaTree can not return errors, so a failed read of rocksdb is treated
+// like a missing item and kept as the error of the tree. A tree with an
+// error is not flushed any more, see Err.
+type RocksTree struct {
+	sync.Mutex
+	store   *rocksStore
+	prefix  byte
+	newItem func() rocksItem
+	pending *btree.BTree // Entries handed out or changed since the last flush
+	cache   *entryCache  // Unchanged entries
+	count   int
+	gen     uint64 // Incremented by every flush
+
+	// Read only copies returned by GetTree read from a rocksdb snapshot.
+	view   bool
+	snap   *gorocksdb.Snapshot
+	origin *RocksTree // The tree a copy is taken from
+
+	errLock sync.Mutex
+	err     error
+}
+
+func newRocksTree(store *rocksStore, prefix byte,
+	newItem func() rocksItem) *RocksTree {
+	return &RocksTree{
+		store:   store,
+		prefix:  prefix,
+		newItem: newItem,
+		pending: btree.New(defaultBTreeDegree),
+		cache:   newEntryCache(rocksCacheItems),
+	}
+}
+
+func (t *RocksTree) dbKey(key []byte) []byte {
+	return append([]byte{t.prefix}, key...)
+}
+
+func (t *RocksTree) countKey() []byte {
+	return []byte{rocksMetaPrefix, 'c', t.prefix}
+}
+
+// Err returns the first error of reading the tree or its copies.
+func (t *RocksTree) Err() error {
+	t.errLock.Lock()
+	defer t.errLock.Unlock()
+	return t.err
+}
+
+// fail records the error of a read, copies record it in their origin.
+func (t *RocksTree) fail(err error) {
+	if t.origin != nil {
+		t.origin.fail(err)
+		return
+	}
+	log.LogErrorf("[RocksTree] %s", err.Error())
+	t.errLock.Lock()
+	defer t.errLock.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *RocksTree) decode(key, value []byte) (e *rocksEntry, err error) {
+	item := t.newItem()
+	if err = item.UnmarshalKey(key); err != nil {
+		err = errors.Errorf("[RocksTree] unmarshal key %v: %s", key,
+			err.Error())
+		return
+	}
+	if err = item.UnmarshalValue(value); err != nil {
+		err = errors.Errorf("[RocksTree] unmarshal value of key %v: %s",
+			key, err.Error())
+		return
+	}
+	e = &rocksEntry{key: key, item: item, orig: value}
+	return
+}
+
+func (t *RocksTree) read(key []byte) (e *rocksEntry, err error) {
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	if t.snap != nil {
+		ro.SetSnapshot(t.snap)
+	}
+	value, err := t.store.db.GetBytes(ro, t.dbKey(key))
+	if err != nil {
+		err = errors.Errorf("[RocksTree] read key %v: %s", key, err.Error())
+		return
+	}
+	if value == nil {
+		return
+	}
+	return t.decode(key, value)
+}
+
+// lookup returns the entry of the key, a pinned entry stays in memory until
+// the next flush. The caller holds the lock of a writable tree, which is
+// released while reading rocksdb.
+func (t *RocksTree) lookup(key []byte, pin bool) (e *rocksEntry) {
+	probe := &rocksEntry{key: key}
+	for {
+		if i := t.pending.Get(probe); i != nil {
+			return i.(*rocksEntry)
+		}
+		if t.view {
+			var err error
+			if e, err = t.read(key); err != nil {
+				t.fail(err)
+			}
+			return
+		}
+		if e = t.cache.get(key); e == nil {
+			gen := t.gen
+			t.Unlock()
+			var err error
+			e, err = t.read(key)
+			t.Lock()
+			if err != nil {
+				t.fail(err)
+				return nil
+			}
+			if gen != t.gen || t.pending.Has(probe) {
+				// Flushed or changed meanwhile.
+				continue
+			}
+			if cached := t.cache.get(key); cached != nil {
+				e = cached
+			}
+			if e == nil {
+				return
+			}
+		}
+		if pin {
+			t.cache.remove(key)
+			t.pending.ReplaceOrInsert(e)
+		} else {
+			t.cache.add(e)
+		}
+		return
+	}
+}
+
+func (t *RocksTree) Get(key BtreeItem) BtreeItem {
+	t.Lock()
+	defer t.Unlock()
+	e := t.lookup(key.(rocksItem).MarshalKey(), true)
+	if e == nil || e.deleted {
+		return nil
+	}
+	return e.item
+}
+
+func (t *RocksTree) Find(key BtreeItem, fn func(i BtreeItem)) {
+	t.Lock()
+	defer t.Unlock()
+	e := t.lookup(key.(rocksItem).MarshalKey(), true)
+	if e == nil || e.deleted {
+		return
+	}
+	fn(e.item)
+}
+
+func (t *RocksTree) Has(key BtreeItem) bool {
+	t.Lock()
+	defer t.Unlock()
+	e := t.lookup(key.(rocksItem).MarshalKey(), false)
+	return e != nil && !e.deleted
+}
+
+func (t *RocksTree) Delete(key BtreeItem) BtreeItem {
+	t.Lock()
+	defer t.Unlock()
+	k := key.(rocksItem).MarshalKey()
+	e := t.lookup(k, false)
+	if e == nil || e.deleted {
+		return nil
+	}
+	t.cache.remove(k)
+	if e.orig == nil {
+		t.pending.Delete(e)
+	} else {
+		t.pending.ReplaceOrInsert(&rocksEntry{key: k, orig: e.orig,
+			deleted: true})
+	}
+	t.count--
+	return e.item
+}
+
+func (t *RocksTree) ReplaceOrInsert(key BtreeItem,
+	replace bool) (BtreeItem, bool) {
+	t.Lock()
+	defer t.Unlock()
+	item := key.(rocksItem)
+	k := item.MarshalKey()
+	e := t.lookup(k, false)
+	if e != nil && !e.deleted && !replace {
+		return e.item, false
+	}
+	ne := &rocksEntry{key: k, item: item}
+	var old BtreeItem
+	if e != nil {
+		ne.orig = e.orig
+		if !e.deleted {
+			old = e.item
+		}
+	}
+	if old == nil {
+		t.count++
+	}
+	t.cache.remove(k)
+	t.pending.ReplaceOrInsert(ne)
+	return old, true
+}
+
+func (t *RocksTree) Ascend(fn func(i BtreeItem) bool) {
+	t.ascend(nil, nil, fn)
+}
+
+func (t *RocksTree) AscendRange(greaterOrEqual, lessThan BtreeItem,
+	iterator func(i BtreeItem) bool) {
+	t.ascend(greaterOrEqual.(rocksItem).MarshalKey(),
+		lessThan.(rocksItem).MarshalKey(), iterator)
+}
+
+func (t *RocksTree) AscendGreaterOrEqual(pivot BtreeItem,
+	iterator func(i BtreeItem) bool) {
+	var start []byte
+	if pivot != nil {
+		start = pivot.(rocksItem).MarshalKey()
+	}
+	t.ascend(start, nil, iterator)
+}
+
+// ascend merges the entries in memory with the stored ones, end is
+// exclusive and nil for no upper bound.
+func (t *RocksTree) ascend(start, end []byte, fn func(i BtreeItem) bool) {
+	if !t.view {
+		v := t.GetTree().(*RocksTree)
+		defer v.Release()
+		v.ascend(start, end, fn)
+		return
+	}
+	// Iterated only in part if an item fails to be decoded.
+	var entries []*rocksEntry
+	collect := func(i btree.Item) bool {
+		entries = append(entries, i.(*rocksEntry))
+		return true
+	}
+	if end != nil {
+		t.pending.AscendRange(&rocksEntry{key: start},
+			&rocksEntry{key: end}, collect)
+	} else {
+		t.pending.AscendGreaterOrEqual(&rocksEntry{key: start}, collect)
+	}
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	ro.SetSnapshot(t.snap)
+	it := t.store.db.NewIterator(ro)
+	defer it.Close()
+	prefix := []byte{t.prefix}
+	for it.Seek(t.dbKey(start)); ; {
+		var key []byte
+		if it.ValidForPrefix(prefix) {
+			key = it.Key().Data()[1:]
+			if end != nil && bytes.Compare(key, end) >= 0 {
+				key = nil
+			}
+		}
+		if key == nil && len(entries) == 0 {
+			return
+		}
+		if key != nil && (len(entries) == 0 ||
+			bytes.Compare(key, entries[0].key) < 0) {
+			e, err := t.decode(append([]byte(nil), key...),
+				append([]byte(nil), it.Value().Data()...))
+			if err != nil {
+				t.fail(err)
+				return
+			}
+			it.Next()
+			if !fn(e.item) {
+				return
+			}
+			continue
+		}
+		e := entries[0]
+		entries = entries[1:]
+		if key != nil && bytes.Equal(key, e.key) {
+			it.Next()
+		}
+		if e.deleted {
+			continue
+		}
+		if !fn(e.item) {
+			return
+		}
+	}
+}
+
+func (t *RocksTree) GetTree() MetaTree {
+	t.Lock()
+	defer t.Unlock()
+	return &RocksTree{
+		store:   t.store,
+		prefix:  t.prefix,
+		newItem: t.newItem,
+		pending: t.pending.Clone(),
+		count:   t.count,
+		view:    true,
+		snap:    t.store.db.NewSnapshot(),
+		origin:  t,
+	}
+}
+
+func (t *RocksTree) Release() {
+	if t.view && t.snap != nil {
+		t.store.db.ReleaseSnapshot(t.snap)
+		t.snap = nil
+	}
+}
+
+// Reset removes all the items, the tree is empty after the next flush.
+func (t *RocksTree) Reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.pending = btree.New(defaultBTreeDegree)
+	t.cache = newEntryCache(rocksCacheItems)
+	t.count = 0
+	v := &RocksTree{store: t.store, prefix: t.prefix, newItem: t.newItem,
+		pending: t.pending, view: true, snap: t.store.db.NewSnapshot(),
+		origin: t}
+	defer v.Release()
+	v.ascend(nil, nil, func(i BtreeItem) bool {
+		k := i.(rocksItem).MarshalKey()
+		t.pending.ReplaceOrInsert(&rocksEntry{key: k, orig: []byte{},
+			deleted: true})
+		return true
+	})
+}
+
+func (t *RocksTree) Len() int {
+	t.Lock()
+	defer t.Unlock()
+	return t.count
+}
+
+// stage adds the changes since the last flush to the write batch and
+// returns the values written.
+func (t *RocksTree) stage(wb *gorocksdb.WriteBatch) (written map[*rocksEntry][]byte) {
+	written = make(map[*rocksEntry][]byte)
+	t.pending.Ascend(func(i btree.Item) bool {
+		e := i.(*rocksEntry)
+		if e.deleted {
+			wb.Delete(t.dbKey(e.key))
+			return true
+		}
+		value := e.item.MarshalValue()
+		if !bytes.Equal(value, e.orig) {
+			wb.Put(t.dbKey(e.key), value)
+		}
+		written[e] = value
+		return true
+	})
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, uint64(t.count))
+	wb.Put(t.countKey(), count)
+	return
+}
+
+// commit moves the stored entries to the cache once the write batch has
+// been written.
+func (t *RocksTree) commit(written map[*rocksEntry][]byte) {
+	pending := t.pending
+	t.pending = btree.New(defaultBTreeDegree)
+	t.gen++
+	pending.Ascend(func(i btree.Item) bool {
+		e := i.(*rocksEntry)
+		if !e.deleted {
+			// Copies of the tree share the entry, replace it.
+			t.cache.add(&rocksEntry{key: e.key, item: e.item,
+				orig: written[e]})
+		}
+		return true
+	})
+}
+
+// rocksStore is the rocksdb instance of a meta partition, holding both the
+// inodes and the dentries, and the reference counts of the shared extents.
+type rocksStore struct {
+	db       *gorocksdb.DB
+	inodes   *RocksTree
+	dentries *RocksTree
+	refs     *extentRefs
+	links    *linkSet
+}
+
+func openRocksStore(dir string) (s *rocksStore, err error) {
+	tableOpts := gorocksdb.NewDefaultBlockBasedTableOptions()
+	tableOpts.SetBlockCache(gorocksdb.NewLRUCache(rocksBlockCache))
+	opts := gorocksdb.NewDefaultOptions()
+	opts.SetBlockBasedTableFactory(tableOpts)
+	opts.SetCreateIfMissing(true)
+	s = &rocksStore{}
+	if s.db, err = gorocksdb.OpenDb(opts, dir); err != nil {
+		err = errors.Errorf("[openRocksStore] %s: %s", dir, err.Error())
+		return
+	}
+	s.inodes = newRocksTree(s, rocksInodePrefix, func() rocksItem {
+		return NewInode(0, 0)
+	})
+	s.dentries = newRocksTree(s, rocksDentryPrefix, func() rocksItem {
+		return &Dentry{}
+	})
+	for _, t := range []*RocksTree{s.inodes, s.dentries} {
+		var count []byte
+		if count, err = s.get(t.countKey()); err != nil {
+			s.Close()
+			return
+		}
+		if len(count) == 8 {
+			t.count = int(binary.BigEndian.Uint64(count))
+		}
+	}
+	return
+}
+
+func (s *rocksStore) get(key []byte) (value []byte, err error) {
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	if value, err = s.db.GetBytes(ro, key); err != nil {
+		err = errors.Errorf("[rocksStore] get %v: %s", key, err.Error())
+	}
+	return
+}
+
+// applyID returns the applyID of the last flush. Restoring is set if the
+// partition has been interrupted while applying a raft snapshot.
+func (s *rocksStore) applyID() (applyID uint64, restoring bool, err error) {
+	value, err := s.get(rocksApplyIDKey)
+	if err != nil {
+		return
+	}
+	if len(value) == 8 {
+		applyID = binary.BigEndian.Uint64(value)
+	}
+	if value, err = s.get(rocksRestoringKey); err != nil {
+		return
+	}
+	restoring = value != nil
+	return
+}
+
+// Err returns the read error of either tree.
+func (s *rocksStore) Err() (err error) {
+	if err = s.inodes.Err(); err == nil {
+		err = s.dentries.Err()
+	}
+	return
+}
+
+func extentRefKey(id extentID) []byte {
+	key := make([]byte, 13)
+	key[0] = rocksExtentRefPrefix
+	binary.BigEndian.PutUint32(key[1:5], id.PartitionId)
+	binary.BigEndian.PutUint64(key[5:13], id.ExtentId)
+	return key
+}
+
+// loadExtentRefs returns the stored reference counts of the shared
+// extents, stored is false if they have never been stored.
+func (s *rocksStore) loadExtentRefs() (refs map[extentID]uint32, stored bool,
+	err error) {
+	refs = make(map[extentID]uint32)
+	value, err := s.get(rocksExtentRefsKey)
+	if err != nil || value == nil {
+		return
+	}
+	stored = true
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	it := s.db.NewIterator(ro)
+	defer it.Close()
+	prefix := []byte{rocksExtentRefPrefix}
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key, value := it.Key().Data(), it.Value().Data()
+		if len(key) != 13 || len(value) != 4 {
+			err = errors.Errorf("[rocksStore] extent ref %v: %v", key, value)
+			return
+		}
+		refs[extentID{
+			PartitionId: binary.BigEndian.Uint32(key[1:5]),
+			ExtentId:    binary.BigEndian.Uint64(key[5:13]),
+		}] = binary.BigEndian.Uint32(value)
+	}
+	if err = it.Err(); err != nil {
+		err = errors.Errorf("[rocksStore] load extent refs: %s", err.Error())
+	}
+	return
+}
+
+// flush writes the changes of both trees, the changed extent reference
+// counts, the pending link changes and the applyID in one batch. Nothing is written once a tree
+// failed to be read, its changes may rely on items missed.
+func (s *rocksStore) flush(applyID uint64, restoring bool) (err error) {
+	if err = s.Err(); err != nil {
+		err = errors.Errorf("[rocksStore] flush applyID=%d: %s", applyID,
+			err.Error())
+		return
+	}
+	s.inodes.Lock()
+	defer s.inodes.Unlock()
+	s.dentries.Lock()
+	defer s.dentries.Unlock()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	inodes := s.inodes.stage(wb)
+	dentries := s.dentries.stage(wb)
+	var refs map[extentID]uint32
+	if s.refs != nil {
+		refs = s.refs.swapDirty()
+		for id, cnt := range refs {
+			if cnt < 2 {
+				wb.Delete(extentRefKey(id))
+				continue
+			}
+			value := make([]byte, 4)
+			binary.BigEndian.PutUint32(value, cnt)
+			wb.Put(extentRefKey(id), value)
+		}
+		wb.Put(rocksExtentRefsKey, []byte{1})
+	}
+	if s.links != nil {
+		links, _ := s.links.marshal()
+		wb.Put(rocksLinksKey, links)
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, applyID)
+	wb.Put(rocksApplyIDKey, value)
+	if restoring {
+		wb.Put(rocksRestoringKey, []byte{1})
+	} else {
+		wb.Delete(rocksRestoringKey)
+	}
+	wo := gorocksdb.NewDefaultWriteOptions()
+	defer wo.Destroy()
+	wo.SetSync(true)
+	if err = s.db.Write(wo, wb); err != nil {
+		if s.refs != nil {
+			s.refs.requeue(refs)
+		}
+		err = errors.Errorf("[rocksStore] flush applyID=%d: %s", applyID,
+			err.Error())
+		return
+	}
+	s.inodes.commit(inodes)
+	s.dentries.commit(dentries)
+	return
+}
+
+func (s *rocksStore) Close() {
+	s.db.Close()
+}
+
+// entryCache is a LRU cache of unchanged entries.
+type entryCache struct {
+	capacity int
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+func newEntryCache(capacity int) *entryCache {
+	return &entryCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *entryCache) get(key []byte) *rocksEntry {
+	elem, ok := c.entries[string(key)]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*rocksEntry)
+}
+
+func (c *entryCache) add(e *rocksEntry) {
+	if elem, ok := c.entries[string(e.key)]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[string(e.key)] = c.lru.PushFront(e)
+	for c.lru.Len() > c.capacity {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, string(elem.Value.(*rocksEntry).key))
+	}
+}
+
+func (c *entryCache) remove(key []byte) {
+	if elem, ok := c.entries[string(key)]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, string(key))
+	}
+}
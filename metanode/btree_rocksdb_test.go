@@ -0,0 +1,194 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/gorocksdb"
+)
+
+func TestRocksTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rockstree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := openRocksStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := store.inodes
+	// Keep the cache small to read most items from rocksdb.
+	tree.cache = newEntryCache(4)
+	expect := NewBtree()
+	sizes := func(tr MetaTree) (s []uint64) {
+		tr.Ascend(func(i BtreeItem) bool {
+			ino := i.(*Inode)
+			s = append(s, ino.Inode, ino.Size)
+			return true
+		})
+		return
+	}
+	check := func(step int, tr MetaTree) {
+		if got, want := sizes(tr), sizes(expect); !reflect.DeepEqual(got,
+			want) || tr.Len() != expect.Len() {
+			t.Fatalf("step %d: got %v len %d, want %v", step, got,
+				tr.Len(), want)
+		}
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for step := 0; step < 2000; step++ {
+		id := uint64(rnd.Intn(50))
+		size := uint64(rnd.Intn(1000))
+		switch rnd.Intn(5) {
+		case 0:
+			ino := NewInode(id, 0)
+			ino.Size = size
+			tree.ReplaceOrInsert(ino, false)
+			ino = NewInode(id, 0)
+			ino.Size = size
+			expect.ReplaceOrInsert(ino, false)
+		case 1:
+			tree.Delete(NewInode(id, 0))
+			expect.Delete(NewInode(id, 0))
+		case 2:
+			// Items handed out by Get are modified in place.
+			if i := tree.Get(NewInode(id, 0)); i != nil {
+				i.(*Inode).Size = size
+			}
+			if i := expect.Get(NewInode(id, 0)); i != nil {
+				i.(*Inode).Size = size
+			}
+		case 3:
+			if err = store.flush(uint64(step), false); err != nil {
+				t.Fatal(err)
+			}
+		case 4:
+			var got, want []uint64
+			collect := func(s *[]uint64) func(i BtreeItem) bool {
+				return func(i BtreeItem) bool {
+					*s = append(*s, i.(*Inode).Inode)
+					return true
+				}
+			}
+			tree.AscendRange(NewInode(10, 0), NewInode(30, 0),
+				collect(&got))
+			expect.AscendRange(NewInode(10, 0), NewInode(30, 0),
+				collect(&want))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("step %d: range %v, want %v", step, got, want)
+			}
+		}
+		check(step, tree)
+	}
+
+	// The trees are read back from rocksdb after a restart.
+	applyID := uint64(0)
+	if err = store.flush(4242, false); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = openRocksStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if applyID, _, err = store.applyID(); err != nil || applyID != 4242 {
+		t.Fatalf("applyID %v: %v", applyID, err)
+	}
+	check(-1, store.inodes)
+}
+
+func TestRocksExtentRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocksrefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := openRocksStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, stored, err := store.loadExtentRefs()
+	if err != nil || stored || len(refs) != 0 {
+		t.Fatalf("new store refs %v stored %v: %v", refs, stored, err)
+	}
+	ek := proto.ExtentKey{PartitionId: 1, ExtentId: 10, Size: 100}
+	other := proto.ExtentKey{PartitionId: 1, ExtentId: 11, Size: 100}
+	r := newExtentRefs()
+	r.track(refs)
+	store.refs = r
+	for _, k := range []proto.ExtentKey{ek, ek, ek, other, other} {
+		ino := NewInode(1, 0)
+		ino.AppendExtents(k)
+		r.Ref(ino)
+	}
+	if err = store.flush(1, false); err != nil {
+		t.Fatal(err)
+	}
+	r.UnrefExtent(other)
+	r.UnrefExtent(other)
+	if err = store.flush(2, false); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	if store, err = openRocksStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	refs, stored, err = store.loadExtentRefs()
+	if err != nil || !stored || len(refs) != 1 || refs[newExtentID(ek)] != 4 {
+		t.Fatalf("loaded refs %v stored %v: %v", refs, stored, err)
+	}
+}
+
+func TestRocksTreeReadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rockserr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := openRocksStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.inodes.ReplaceOrInsert(NewInode(1, 0), false)
+	if err = store.flush(1, false); err != nil {
+		t.Fatal(err)
+	}
+	wo := gorocksdb.NewDefaultWriteOptions()
+	defer wo.Destroy()
+	key := store.inodes.dbKey(NewInode(2, 0).MarshalKey())
+	if err = store.db.Put(wo, key, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.inodes.Get(NewInode(1, 0)) == nil {
+		t.Fatalf("inode 1 not found")
+	}
+	if store.inodes.Get(NewInode(2, 0)) != nil || store.Err() == nil {
+		t.Fatalf("corrupt inode read without error")
+	}
+	if err = store.flush(2, false); err == nil {
+		t.Fatalf("flushed after a read error")
+	}
+}
@@ -17,6 +17,7 @@ package metanode
 import (
 	"github.com/juju/errors"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"time"
 )
 
@@ -48,6 +49,8 @@ type (
 	DeleteInoResp = proto.DeleteInodeResponse
 	// Client -> MetaNode create Dentry request struct
 	CreateDentryReq = proto.CreateDentryRequest
+	// MetaNode -> Client create Dentry response struct
+	CreateDentryResp = proto.CreateDentryResponse
 	// Client -> MetaNode delete Dentry request struct
 	DeleteDentryReq = proto.DeleteDentryRequest
 	// MetaNode -> Client delete Dentry response struct
@@ -83,6 +86,32 @@ type (
 	EvictInodeReq = proto.EvictInodeRequest
 	// Client -> MetaNOde
 	SetattrRequest = proto.SetattrRequest
+	// Client -> MetaNode
+	PunchHoleReq = proto.PunchHoleRequest
+	// Client -> MetaNode
+	CloneExtentsReq = proto.CloneExtentsRequest
+	// Client -> MetaNode
+	WormCommitReq = proto.WormCommitRequest
+	// Client -> MetaNode
+	InlineWriteReq = proto.InlineWriteRequest
+	// Client -> MetaNode
+	BatchReq = proto.BatchRequest
+	// MetaNode -> Client
+	BatchResp = proto.BatchResponse
+	// Master -> MetaNode
+	SplitPartitionReq = proto.SplitMetaPartitionRequest
+	// MetaNode -> Master
+	SplitPartitionResp = proto.SplitMetaPartitionResponse
+	// MetaNode -> MetaNode
+	ImportItemsReq = proto.ImportItemsRequest
+	// MetaNode -> MetaNode
+	UpdateUsageReq = proto.UpdateUsageRequest
+	// MetaNode -> MetaNode
+	UpdateLinksReq = proto.UpdateLinksRequest
+	// Client -> MetaNode
+	ReadChangesReq = proto.ReadChangesRequest
+	// MetaNode -> Client
+	ReadChangesResp = proto.ReadChangesResponse
 )
 
 // For use when raftStore store and application apply
@@ -105,12 +134,27 @@ const (
 	opFSMEvictInode
 	opFSMInternalDeleteInode
 	opFSMSetAttr
+	opFSMPunchHole
+	opFSMExtentsClone
+	opFSMWormCommit
+	opFSMInlineWrite
+	opFSMImportItems
+	opFSMDeleteRange
+	opFSMBatch
+	opFSMUpdateUsage
+	opFSMUpdateLinks
+	opFSMReclaimExtents
+	opFSMLinksSent
+	opFSMBackfillLinks
+	// The pending link changes of a raft snapshot
+	opSnapLinks
+	opFSMPunchReleased
 )
 
 var (
-	masterAddrs   []string
-	curMasterAddr string
-	UMPKey        string
+	masterAddrs  []string
+	masterClient *master.MasterClient
+	UMPKey       string
 )
 
 var (
@@ -124,11 +168,6 @@ const (
 	defaultRaftDir = "raftDir"
 )
 
-const (
-	metaNodeURL     = "/metaNode/add"
-	metaNodeGetName = "/admin/getIp"
-)
-
 // Configuration keys
 const (
 	cfgListen            = "listen"
@@ -137,6 +176,13 @@ const (
 	cfgMasterAddrs       = "masterAddrs"
 	cfgRaftHeartbeatPort = "raftHeartbeatPort"
 	cfgRaftReplicatePort = "raftReplicatePort"
+	cfgStoreMode         = "storeMode"
+)
+
+// Storage engines of the inodes and dentries of a meta partition.
+const (
+	StoreModeMemory  = "memory"
+	StoreModeRocksDB = "rocksdb"
 )
 
 const (
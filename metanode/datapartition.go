@@ -16,14 +16,11 @@ package metanode
 
 import (
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"strings"
 	"sync"
 )
 
-const (
-	DataPartitionViewUrl = "/client/dataPartitions"
-)
-
 type DataPartition struct {
 	PartitionID   uint32
 	Status        int8
@@ -36,13 +33,10 @@ func (dp *DataPartition) GetAllAddrs() (m string) {
 	return strings.Join(dp.Hosts[1:], proto.AddrSplit) + proto.AddrSplit
 }
 
-type DataPartitionsView struct {
-	DataPartitions []*DataPartition
-}
-
 type Vol struct {
 	sync.RWMutex
 	dataPartitionView map[uint32]*DataPartition
+	metaPartitionView []*master.MetaPartitionView
 }
 
 func NewVol() *Vol {
@@ -57,9 +51,15 @@ func (v *Vol) GetPartition(partitionID uint32) *DataPartition {
 	return v.dataPartitionView[partitionID]
 }
 
-func (v *Vol) UpdatePartitions(partitions *DataPartitionsView) {
+func (v *Vol) UpdatePartitions(partitions *master.DataPartitionsView) {
 	for _, dp := range partitions.DataPartitions {
-		v.replaceOrInsert(dp)
+		v.replaceOrInsert(&DataPartition{
+			PartitionID:   uint32(dp.PartitionID),
+			Status:        dp.Status,
+			ReplicaNum:    dp.ReplicaNum,
+			PartitionType: dp.PartitionType,
+			Hosts:         dp.Hosts,
+		})
 	}
 }
 
@@ -68,3 +68,23 @@ func (v *Vol) replaceOrInsert(partition *DataPartition) {
 	defer v.Unlock()
 	v.dataPartitionView[partition.PartitionID] = partition
 }
+
+// UpdateMetaPartitions replaces the meta partitions of the volume.
+func (v *Vol) UpdateMetaPartitions(view *master.VolView) {
+	v.Lock()
+	defer v.Unlock()
+	v.metaPartitionView = view.MetaPartitions
+}
+
+// GetMetaPartition returns the meta partition of inode ino, nil if it is
+// not known.
+func (v *Vol) GetMetaPartition(ino uint64) *master.MetaPartitionView {
+	v.RLock()
+	defer v.RUnlock()
+	for _, mp := range v.metaPartitionView {
+		if mp.Start <= ino && ino <= mp.End {
+			return mp
+		}
+	}
+	return nil
+}
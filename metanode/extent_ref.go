@@ -0,0 +1,191 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sync"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+type extentID struct {
+	PartitionId uint32
+	ExtentId    uint64
+}
+
+func newExtentID(ek proto.ExtentKey) extentID {
+	return extentID{PartitionId: ek.PartitionId, ExtentId: ek.ExtentId}
+}
+
+// extentRefs counts how many inodes of the partition reference an extent.
+// Only shared extents are recorded, an extent which is missing is owned by
+// a single inode. The counts are derived from the inode tree. They are
+// rebuilt after loading or applying a snapshot, unless the partition is
+// stored in rocksdb: then the extents changed are recorded in dirty, and
+// their counts are stored with the trees.
+type extentRefs struct {
+	sync.RWMutex
+	refs  map[extentID]uint32
+	dirty map[extentID]struct{} // nil unless the counts are stored
+}
+
+func newExtentRefs() *extentRefs {
+	return &extentRefs{
+		refs: make(map[extentID]uint32),
+	}
+}
+
+// Get returns the number of inodes referencing the extent.
+func (r *extentRefs) Get(ek proto.ExtentKey) uint32 {
+	r.RLock()
+	defer r.RUnlock()
+	if cnt, ok := r.refs[newExtentID(ek)]; ok {
+		return cnt
+	}
+	return 1
+}
+
+// track records the extents changed from now on, the counts are set to
+// the stored ones.
+func (r *extentRefs) track(refs map[extentID]uint32) {
+	r.Lock()
+	defer r.Unlock()
+	r.refs = refs
+	r.dirty = make(map[extentID]struct{})
+}
+
+func (r *extentRefs) markDirty(id extentID) {
+	if r.dirty != nil {
+		r.dirty[id] = struct{}{}
+	}
+}
+
+// swapDirty returns the counts of the extents changed since the last call,
+// 0 for the extents which are not shared any more.
+func (r *extentRefs) swapDirty() (changed map[extentID]uint32) {
+	r.Lock()
+	defer r.Unlock()
+	changed = make(map[extentID]uint32, len(r.dirty))
+	for id := range r.dirty {
+		changed[id] = r.refs[id]
+	}
+	if r.dirty != nil {
+		r.dirty = make(map[extentID]struct{})
+	}
+	return
+}
+
+// requeue marks the extents changed again, whose counts failed to be
+// stored.
+func (r *extentRefs) requeue(changed map[extentID]uint32) {
+	r.Lock()
+	defer r.Unlock()
+	for id := range changed {
+		r.markDirty(id)
+	}
+}
+
+// Ref adds one reference to every extent of the inode.
+func (r *extentRefs) Ref(ino *Inode) {
+	r.Lock()
+	defer r.Unlock()
+	for id := range inodeExtentIDs(ino) {
+		r.ref(id)
+	}
+}
+
+// RefExtent adds one reference to the extent.
+func (r *extentRefs) RefExtent(id extentID) {
+	r.Lock()
+	defer r.Unlock()
+	r.ref(id)
+}
+
+func (r *extentRefs) ref(id extentID) {
+	r.markDirty(id)
+	if cnt, ok := r.refs[id]; ok {
+		r.refs[id] = cnt + 1
+	} else {
+		r.refs[id] = 2
+	}
+}
+
+// Unref drops one reference of every extent of the inode.
+func (r *extentRefs) Unref(ino *Inode) {
+	r.Lock()
+	defer r.Unlock()
+	for id := range inodeExtentIDs(ino) {
+		r.unref(id)
+	}
+}
+
+// UnrefExtent drops one reference of the extent.
+func (r *extentRefs) UnrefExtent(ek proto.ExtentKey) {
+	r.Lock()
+	defer r.Unlock()
+	r.unref(newExtentID(ek))
+}
+
+func (r *extentRefs) unref(id extentID) {
+	cnt, ok := r.refs[id]
+	if !ok {
+		return
+	}
+	r.markDirty(id)
+	if cnt <= 2 {
+		delete(r.refs, id)
+		return
+	}
+	r.refs[id] = cnt - 1
+}
+
+// Rebuild recounts the references from the inode tree.
+func (r *extentRefs) Rebuild(tree MetaTree) {
+	all := make(map[extentID]uint32)
+	tree.Ascend(func(i BtreeItem) bool {
+		for id := range inodeExtentIDs(i.(*Inode)) {
+			all[id]++
+		}
+		return true
+	})
+	refs := make(map[extentID]uint32)
+	for id, cnt := range all {
+		if cnt > 1 {
+			refs[id] = cnt
+		}
+	}
+	r.Lock()
+	for id := range r.refs {
+		r.markDirty(id)
+	}
+	for id := range refs {
+		r.markDirty(id)
+	}
+	r.refs = refs
+	r.Unlock()
+}
+
+// inodeExtentIDs returns the distinct extents referenced by the inode.
+// An extent split by holes is referenced by the inode only once.
+func inodeExtentIDs(ino *Inode) map[extentID]struct{} {
+	ids := make(map[extentID]struct{})
+	ino.Extents.Range(func(i int, ek proto.ExtentKey) bool {
+		if !ek.IsHole() {
+			ids[newExtentID(ek)] = struct{}{}
+		}
+		return true
+	})
+	return ids
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestCloneExtentsRefs(t *testing.T) {
+	mp := newTestPartition(t)
+	mode := proto.Mode(os.ModePerm)
+	src := NewInode(1, mode)
+	ek := proto.ExtentKey{PartitionId: 1, ExtentId: 10, Size: 100}
+	src.AppendExtents(ek)
+	mp.createInode(src)
+	mp.createInode(NewInode(2, mode))
+	mp.createInode(NewInode(3, mode))
+
+	if status := mp.cloneExtents(&CloneExtentsReq{SrcInode: 1, DstInode: 2, Size: math.MaxUint64}).Status; status != proto.OpOk {
+		t.Fatalf("clone status %v", status)
+	}
+	if status := mp.cloneExtents(&CloneExtentsReq{SrcInode: 2, DstInode: 3, Size: math.MaxUint64}).Status; status != proto.OpOk {
+		t.Fatalf("clone status %v", status)
+	}
+	if status := mp.cloneExtents(&CloneExtentsReq{SrcInode: 1, DstInode: 2, Size: math.MaxUint64}).Status; status != proto.OpArgMismatchErr {
+		t.Fatalf("clone to non-empty inode status %v", status)
+	}
+	if refs := mp.extentRefs.Get(ek); refs != 3 {
+		t.Fatalf("refs %v, expect 3", refs)
+	}
+
+	// Punching a shared extent must not release its data.
+	resp := mp.punchHole(&PunchHoleReq{Inode: 3, Offset: 0, Size: 100})
+	if resp.Status != proto.OpOk || resp.Msg.Extents.GetExtentLen() != 0 {
+		t.Fatalf("punch shared extent resp %v %v", resp.Status, resp.Msg)
+	}
+	if refs := mp.extentRefs.Get(ek); refs != 2 {
+		t.Fatalf("refs %v, expect 2", refs)
+	}
+
+	mp.internalDeleteInode(NewInode(1, 0))
+	if refs := mp.extentRefs.Get(ek); refs != 1 {
+		t.Fatalf("refs %v, expect 1", refs)
+	}
+	resp = mp.punchHole(&PunchHoleReq{Inode: 2, Offset: 0, Size: 50})
+	if resp.Msg.Extents.GetExtentLen() != 1 {
+		t.Fatalf("punch owned extent resp %v", resp.Msg)
+	}
+
+	mp.extentRefs.Rebuild(mp.inodeTree)
+	if refs := mp.extentRefs.Get(ek); refs != 1 {
+		t.Fatalf("rebuilt refs %v, expect 1", refs)
+	}
+}
+
+func TestCloneRange(t *testing.T) {
+	mp := newTestPartition(t)
+	mode := proto.Mode(os.ModePerm)
+	e1 := proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 100}
+	e2 := proto.ExtentKey{PartitionId: 1, ExtentId: 2, Size: 100}
+	e3 := proto.ExtentKey{PartitionId: 1, ExtentId: 3, Size: 50}
+	src := NewInode(1, mode)
+	src.AppendExtents(e1)
+	src.AppendExtents(e2)
+	mp.createInode(src)
+	dst := NewInode(2, mode)
+	dst.AppendExtents(e3)
+	mp.createInode(dst)
+
+	req := &CloneExtentsReq{SrcInode: 1, DstInode: 2, SrcOffset: 50, DstOffset: 0, Size: 100}
+	if resp := mp.cloneExtents(req); resp.Status != proto.OpArgMismatchErr {
+		t.Fatalf("clone into the data status %v", resp.Status)
+	}
+	req.DstOffset = 50
+	if resp := mp.cloneExtents(req); resp.Status != proto.OpOk || resp.Size != 100 {
+		t.Fatalf("clone range status %v size %v", resp.Status, resp.Size)
+	}
+	expect := []proto.ExtentKey{e3,
+		{PartitionId: 1, ExtentId: 1, ExtentOffset: 50, Size: 50},
+		{PartitionId: 1, ExtentId: 2, Size: 50}}
+	if !reflect.DeepEqual(dst.Extents.Extents, expect) || dst.Size != 150 {
+		t.Fatalf("cloned extents %v size %v", dst.Extents.Extents, dst.Size)
+	}
+	if mp.extentRefs.Get(e1) != 2 || mp.extentRefs.Get(e2) != 2 || mp.extentRefs.Get(e3) != 1 {
+		t.Fatalf("refs %v %v %v", mp.extentRefs.Get(e1), mp.extentRefs.Get(e2), mp.extentRefs.Get(e3))
+	}
+
+	// The clone stops at the end of the source.
+	req = &CloneExtentsReq{SrcInode: 1, DstInode: 2, SrcOffset: 150, DstOffset: 150, Size: 100}
+	if resp := mp.cloneExtents(req); resp.Status != proto.OpOk || resp.Size != 50 {
+		t.Fatalf("clone past the end status %v size %v", resp.Status, resp.Size)
+	}
+	// A file appending its own range adds no reference.
+	req = &CloneExtentsReq{SrcInode: 1, DstInode: 1, SrcOffset: 0, DstOffset: 200, Size: 50}
+	if resp := mp.cloneExtents(req); resp.Status != proto.OpOk || src.Size != 250 {
+		t.Fatalf("clone into itself status %v size %v", resp.Status, src.Size)
+	}
+	if refs := mp.extentRefs.Get(e1); refs != 2 {
+		t.Fatalf("refs %v after cloning into itself", refs)
+	}
+}
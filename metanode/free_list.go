@@ -74,3 +74,21 @@ func (i *freeList) FrontMoveToBack() {
 	}
 	i.list.MoveToBack(item)
 }
+
+// Items returns the items of the list in order
+func (i *freeList) Items() (inos []*Inode) {
+	i.RLock()
+	defer i.RUnlock()
+	inos = make([]*Inode, 0, i.list.Len())
+	for item := i.list.Front(); item != nil; item = item.Next() {
+		inos = append(inos, item.Value.(*Inode))
+	}
+	return
+}
+
+// Reset removes all the items of list
+func (i *freeList) Reset() {
+	i.Lock()
+	defer i.Unlock()
+	i.list.Init()
+}
@@ -33,11 +33,15 @@ import (
 //  | bytes |   8   |
 //  +-------+-------+
 // Marshal value:
-//  +-------+------+------+-----+----+----+----+--------+------------------+
-//  | item  | Type | Size | Gen | CT | AT | MT | ExtLen | MarshaledExtents |
-//  +-------+------+------+-----+----+----+----+--------+------------------+
-//  | bytes |  4   |  8   |  8  | 8  | 8  | 8  |   4    |      ExtLen      |
-//  +-------+------+------+-----+----+----+----+--------+------------------+
+//  +-------+------+---------+------------+-------+------------------+
+//  | item  | Mark | Version | Attributes | Extra | MarshaledExtents |
+//  +-------+------+---------+------------+-------+------------------+
+//  | bytes |  1   |    1    |     ..     |  ..   |       rest       |
+//  +-------+------+---------+------------+-------+------------------+
+// Attributes are Type, Uid, Gid, Size, Gen, CT, AT, MT, SymLink, NLink and
+// MarkDelete. Version 0 values have neither Mark, Version nor Extra, and
+// their extent keys have no version. They start with Type, whose first
+// byte is never inodeValueMark.
 // Marshal entity:
 //  +-------+-----------+--------------+-----------+--------------+
 //  | item  | KeyLength | MarshaledKey | ValLength | MarshaledVal |
@@ -54,9 +58,18 @@ type Inode struct {
 	CreateTime int64
 	AccessTime int64
 	ModifyTime int64
-	LinkTarget []byte // SymLink target name
-	NLink      uint32 // NodeLink counts
-	MarkDelete uint8  // 0: false; 1: true
+	LinkTarget []byte            // SymLink target name
+	NLink      uint32            // NodeLink counts
+	MarkDelete uint8             // 0: false; 1: true
+	Flags      uint32            // proto.FlagImmutable, proto.FlagAppend
+	Retention  int64             // WORM retention deadline, 0: not committed
+	Inline     []byte            // body of a small file without extents
+	Entries    uint64            // dentries created in the directory before sharding
+	Shards     []uint64          // shard directories of a sharded directory
+	Parent     uint64            // directory the usage is added to, 0: unknown
+	Usage      proto.DirUsage    // recursive usage of a directory
+	Links      []proto.InodeLink // dentries of the inode, to resolve its paths
+	Punched    []proto.ExtentKey // pieces punched out, not released on the dataNodes yet
 	Extents    *proto.StreamKey
 }
 
@@ -75,6 +88,15 @@ func (i *Inode) String() string {
 	buff.WriteString(fmt.Sprintf("LinkT[%s]", i.LinkTarget))
 	buff.WriteString(fmt.Sprintf("NLink[%d]", i.NLink))
 	buff.WriteString(fmt.Sprintf("MD[%d]", i.MarkDelete))
+	buff.WriteString(fmt.Sprintf("Flags[%#x]", i.Flags))
+	buff.WriteString(fmt.Sprintf("Ret[%d]", i.Retention))
+	buff.WriteString(fmt.Sprintf("Inline[%d]", len(i.Inline)))
+	buff.WriteString(fmt.Sprintf("Entries[%d]", i.Entries))
+	buff.WriteString(fmt.Sprintf("Shards[%v]", i.Shards))
+	buff.WriteString(fmt.Sprintf("Parent[%d]", i.Parent))
+	buff.WriteString(fmt.Sprintf("Usage[%v]", i.Usage))
+	buff.WriteString(fmt.Sprintf("Links[%v]", i.Links))
+	buff.WriteString(fmt.Sprintf("Punched[%v]", i.Punched))
 	buff.WriteString(fmt.Sprintf("Extents[%s]", i.Extents))
 	buff.WriteString("}")
 	return buff.String()
@@ -170,11 +192,106 @@ func (i *Inode) UnmarshalKey(k []byte) (err error) {
 	return
 }
 
+// Versions of the marshaled inode value.
+const (
+	// inodeValueMark starts a value of version 1 or later.
+	inodeValueMark uint8 = 0xff
+
+	inodeValueVersion0 uint8 = 0 // attributes and extents only
+	inodeValueVersion1 uint8 = 1 // flags, inline data, shards, usage, links
+	inodeValueVersion2 uint8 = 2 // punched pieces
+
+	inodeValueVersion = inodeValueVersion2
+)
+
 // MarshalValue marshal value to bytes.
 func (i *Inode) MarshalValue() (val []byte) {
 	var err error
 	buff := bytes.NewBuffer(make([]byte, 0, 128))
 	buff.Grow(64)
+	buff.WriteByte(inodeValueMark)
+	buff.WriteByte(inodeValueVersion)
+	i.marshalAttributes(buff)
+	if err = binary.Write(buff, binary.BigEndian, &i.Flags); err != nil {
+		panic(err)
+	}
+	if err = binary.Write(buff, binary.BigEndian, &i.Retention); err != nil {
+		panic(err)
+	}
+	// Write inline data
+	inlineSize := uint32(len(i.Inline))
+	if err = binary.Write(buff, binary.BigEndian, &inlineSize); err != nil {
+		panic(err)
+	}
+	if _, err = buff.Write(i.Inline); err != nil {
+		panic(err)
+	}
+	if err = binary.Write(buff, binary.BigEndian, &i.Entries); err != nil {
+		panic(err)
+	}
+	// Write shard directories
+	shardCount := uint32(len(i.Shards))
+	if err = binary.Write(buff, binary.BigEndian, &shardCount); err != nil {
+		panic(err)
+	}
+	if err = binary.Write(buff, binary.BigEndian, i.Shards); err != nil {
+		panic(err)
+	}
+	if err = binary.Write(buff, binary.BigEndian, &i.Parent); err != nil {
+		panic(err)
+	}
+	if err = binary.Write(buff, binary.BigEndian, &i.Usage); err != nil {
+		panic(err)
+	}
+	// Write links
+	linkCount := uint32(len(i.Links))
+	if err = binary.Write(buff, binary.BigEndian, &linkCount); err != nil {
+		panic(err)
+	}
+	for _, link := range i.Links {
+		if err = binary.Write(buff, binary.BigEndian, &link.Parent); err != nil {
+			panic(err)
+		}
+		nameSize := uint32(len(link.Name))
+		if err = binary.Write(buff, binary.BigEndian, &nameSize); err != nil {
+			panic(err)
+		}
+		if _, err = buff.WriteString(link.Name); err != nil {
+			panic(err)
+		}
+	}
+	// Write punched pieces
+	punchedCount := uint32(len(i.Punched))
+	if err = binary.Write(buff, binary.BigEndian, &punchedCount); err != nil {
+		panic(err)
+	}
+	for _, ek := range i.Punched {
+		data, err := ek.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		if _, err = buff.Write(data); err != nil {
+			panic(err)
+		}
+	}
+	if i.Extents.Size() != 0 {
+		// Marshal ExtentsKey
+		extData, err := i.Extents.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		if _, err = buff.Write(extData); err != nil {
+			panic(err)
+		}
+	}
+
+	val = buff.Bytes()
+	return
+}
+
+// marshalAttributes writes the attributes every version starts with.
+func (i *Inode) marshalAttributes(buff *bytes.Buffer) {
+	var err error
 	if err = binary.Write(buff, binary.BigEndian, &i.Type); err != nil {
 		panic(err)
 	}
@@ -214,24 +331,137 @@ func (i *Inode) MarshalValue() (val []byte) {
 	if err = binary.Write(buff, binary.BigEndian, &i.MarkDelete); err != nil {
 		panic(err)
 	}
-	if i.Extents.Size() != 0 {
-		// Marshal ExtentsKey
-		extData, err := i.Extents.MarshalBinary()
-		if err != nil {
-			panic(err)
-		}
-		if _, err = buff.Write(extData); err != nil {
-			panic(err)
-		}
+}
+
+// UnmarshalValue unmarshal value from bytes.
+func (i *Inode) UnmarshalValue(val []byte) (err error) {
+	if len(val) == 0 || val[0] != inodeValueMark {
+		return i.unmarshalValueV0(val)
+	}
+	if len(val) < 2 {
+		return io.ErrUnexpectedEOF
 	}
+	switch version := val[1]; version {
+	case inodeValueVersion1, inodeValueVersion2:
+		return i.unmarshalValueV1(val[2:], version)
+	default:
+		return fmt.Errorf("unknown inode value version %v", version)
+	}
+}
 
-	val = buff.Bytes()
+// unmarshalValueV0 reads a value written before the value was versioned.
+func (i *Inode) unmarshalValueV0(val []byte) (err error) {
+	buff := bytes.NewBuffer(val)
+	if err = i.unmarshalAttributes(buff); err != nil {
+		return
+	}
+	i.Flags, i.Retention = 0, 0
+	i.Inline, i.Entries, i.Shards = nil, 0, nil
+	i.Parent, i.Usage, i.Links = 0, proto.DirUsage{}, nil
+	i.Punched = nil
+	i.initExtents()
+	if buff.Len() == 0 {
+		return
+	}
+	err = i.Extents.UnmarshalBinaryV0(buff.Bytes())
 	return
 }
 
-// UnmarshalValue unmarshal value from bytes.
-func (i *Inode) UnmarshalValue(val []byte) (err error) {
+// unmarshalValueV1 reads a value of version 1 or later.
+func (i *Inode) unmarshalValueV1(val []byte, version uint8) (err error) {
 	buff := bytes.NewBuffer(val)
+	if err = i.unmarshalAttributes(buff); err != nil {
+		return
+	}
+	if err = binary.Read(buff, binary.BigEndian, &i.Flags); err != nil {
+		return
+	}
+	if err = binary.Read(buff, binary.BigEndian, &i.Retention); err != nil {
+		return
+	}
+	// Read inline data
+	inlineSize := uint32(0)
+	if err = binary.Read(buff, binary.BigEndian, &inlineSize); err != nil {
+		return
+	}
+	i.Inline = nil
+	if inlineSize > 0 {
+		i.Inline = make([]byte, inlineSize)
+		if _, err = io.ReadFull(buff, i.Inline); err != nil {
+			return
+		}
+	}
+	if err = binary.Read(buff, binary.BigEndian, &i.Entries); err != nil {
+		return
+	}
+	// Read shard directories
+	shardCount := uint32(0)
+	if err = binary.Read(buff, binary.BigEndian, &shardCount); err != nil {
+		return
+	}
+	i.Shards = nil
+	if shardCount > 0 {
+		i.Shards = make([]uint64, shardCount)
+		if err = binary.Read(buff, binary.BigEndian, i.Shards); err != nil {
+			return
+		}
+	}
+	if err = binary.Read(buff, binary.BigEndian, &i.Parent); err != nil {
+		return
+	}
+	if err = binary.Read(buff, binary.BigEndian, &i.Usage); err != nil {
+		return
+	}
+	// Read links
+	linkCount := uint32(0)
+	if err = binary.Read(buff, binary.BigEndian, &linkCount); err != nil {
+		return
+	}
+	i.Links = nil
+	for k := uint32(0); k < linkCount; k++ {
+		var (
+			link     proto.InodeLink
+			nameSize uint32
+		)
+		if err = binary.Read(buff, binary.BigEndian, &link.Parent); err != nil {
+			return
+		}
+		if err = binary.Read(buff, binary.BigEndian, &nameSize); err != nil {
+			return
+		}
+		name := make([]byte, nameSize)
+		if _, err = io.ReadFull(buff, name); err != nil {
+			return
+		}
+		link.Name = string(name)
+		i.Links = append(i.Links, link)
+	}
+	i.Punched = nil
+	if version >= inodeValueVersion2 {
+		// Read punched pieces
+		punchedCount := uint32(0)
+		if err = binary.Read(buff, binary.BigEndian, &punchedCount); err != nil {
+			return
+		}
+		for k := uint32(0); k < punchedCount; k++ {
+			var ek proto.ExtentKey
+			if err = ek.UnmarshalBinary(buff); err != nil {
+				return
+			}
+			i.Punched = append(i.Punched, ek)
+		}
+	}
+	i.initExtents()
+	if buff.Len() == 0 {
+		return
+	}
+	// Unmarshal ExtentsKey
+	err = i.Extents.UnmarshalBinary(buff.Bytes())
+	return
+}
+
+// unmarshalAttributes reads the attributes every version starts with.
+func (i *Inode) unmarshalAttributes(buff *bytes.Buffer) (err error) {
 	if err = binary.Read(buff, binary.BigEndian, &i.Type); err != nil {
 		return
 	}
@@ -261,6 +491,7 @@ func (i *Inode) UnmarshalValue(val []byte) (err error) {
 	if err = binary.Read(buff, binary.BigEndian, &symSize); err != nil {
 		return
 	}
+	i.LinkTarget = nil
 	if symSize > 0 {
 		i.LinkTarget = make([]byte, symSize)
 		if _, err = io.ReadFull(buff, i.LinkTarget); err != nil {
@@ -274,19 +505,43 @@ func (i *Inode) UnmarshalValue(val []byte) (err error) {
 	if err = binary.Read(buff, binary.BigEndian, &i.MarkDelete); err != nil {
 		return
 	}
+	return
+}
+
+func (i *Inode) initExtents() {
 	if i.Extents == nil {
 		i.Extents = proto.NewStreamKey(i.Inode)
 	} else {
 		i.Extents.Inode = i.Inode
 	}
-	if buff.Len() == 0 {
-		return
-	}
-	// Unmarshal ExtentsKey
-	if err = i.Extents.UnmarshalBinary(buff.Bytes()); err != nil {
-		return
-	}
-	return
+}
+
+// IsWormCommitted tests whether the inode is a committed WORM file, which
+// can not be modified any more.
+func (i *Inode) IsWormCommitted() bool {
+	return i.Retention != 0
+}
+
+// IsRetained tests whether the committed WORM file can not be removed at
+// the unix time now.
+func (i *Inode) IsRetained(now int64) bool {
+	return i.Retention != 0 && now < i.Retention
+}
+
+// IsImmutable tests whether the inode can not be modified, linked or removed.
+func (i *Inode) IsImmutable() bool {
+	return i.Flags&proto.FlagImmutable != 0
+}
+
+// IsAppendOnly tests whether the data of the inode can only be appended.
+func (i *Inode) IsAppendOnly() bool {
+	return i.Flags&proto.FlagAppend != 0
+}
+
+// IsSharded tests whether the new dentries of the directory are kept in its
+// shard directories.
+func (i *Inode) IsSharded() bool {
+	return len(i.Shards) != 0
 }
 
 func (i *Inode) AppendExtents(ext proto.ExtentKey) {
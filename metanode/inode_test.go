@@ -0,0 +1,441 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestInodeFlags(t *testing.T) {
+	mp := newTestPartition(t)
+	ino := NewInode(1, proto.Mode(os.ModePerm))
+	ino.AppendExtents(proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 10})
+	mp.createInode(ino)
+
+	req := &SetattrRequest{Inode: 1, Valid: proto.AttrFlags, Flags: proto.FlagImmutable}
+	if status := mp.setAttr(req); status != proto.OpOk {
+		t.Fatalf("set flags status %v", status)
+	}
+	data, err := ino.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInode(0, 0)
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsImmutable() || loaded.Extents.GetExtentLen() != 1 {
+		t.Fatalf("unmarshal inode %v", loaded)
+	}
+
+	if status := mp.setAttr(&SetattrRequest{Inode: 1, Valid: proto.AttrUid, Uid: 1}); status != proto.OpNotPermErr {
+		t.Fatalf("chown immutable status %v", status)
+	}
+	if resp := mp.deleteInode(NewInode(1, 0)); resp.Status != proto.OpNotPermErr {
+		t.Fatalf("unlink immutable status %v", resp.Status)
+	}
+	if status := mp.appendExtents(NewInode(1, 0)); status != proto.OpNotPermErr {
+		t.Fatalf("write immutable status %v", status)
+	}
+
+	req.Flags = proto.FlagAppend
+	mp.setAttr(req)
+	next := NewInode(1, 0)
+	next.Extents.Put(proto.ExtentKey{PartitionId: 1, ExtentId: 2, Size: 10})
+	if status := mp.appendExtents(next); status != proto.OpOk {
+		t.Fatalf("append to append-only status %v", status)
+	}
+	if resp := mp.punchHole(&PunchHoleReq{Inode: 1, Size: 10}); resp.Status != proto.OpNotPermErr {
+		t.Fatalf("punch append-only status %v", resp.Status)
+	}
+}
+
+func TestWormCommit(t *testing.T) {
+	mp := newTestPartition(t)
+	mp.createInode(NewInode(1, proto.Mode(os.ModePerm)))
+
+	req := NewInode(1, 0)
+	req.Retention = req.ModifyTime + 100
+	if status := mp.wormCommit(req); status != proto.OpOk {
+		t.Fatalf("commit status %v", status)
+	}
+	if status := mp.appendExtents(NewInode(1, 0)); status != proto.OpNotPermErr {
+		t.Fatalf("write committed status %v", status)
+	}
+	if resp := mp.deleteInode(NewInode(1, 0)); resp.Status != proto.OpNotPermErr {
+		t.Fatalf("unlink retained status %v", resp.Status)
+	}
+	shorten := &SetattrRequest{Inode: 1, Valid: proto.AttrRetention, Retention: req.Retention - 1}
+	if status := mp.setAttr(shorten); status != proto.OpNotPermErr {
+		t.Fatalf("shorten retention status %v", status)
+	}
+
+	expired := NewInode(1, 0)
+	expired.ModifyTime = req.Retention
+	if resp := mp.deleteInode(expired); resp.Status != proto.OpOk {
+		t.Fatalf("unlink expired status %v", resp.Status)
+	}
+}
+
+func TestInlineWrite(t *testing.T) {
+	mp := newTestPartition(t)
+	ino := NewInode(1, proto.Mode(os.ModePerm))
+	mp.createInode(ino)
+
+	// Inline bodies are disabled unless the volume sets an inline size.
+	mp.config.InlineSize = 0
+	if status := mp.inlineWrite(&InlineWriteReq{Inode: 1, Data: []byte("ab")}); status != proto.OpArgMismatchErr {
+		t.Fatalf("inline write without inline size status %v", status)
+	}
+	mp.config.InlineSize = 16
+	if status := mp.inlineWrite(&InlineWriteReq{Inode: 1, Offset: 2, Data: []byte("cd")}); status != proto.OpOk {
+		t.Fatalf("inline write status %v", status)
+	}
+	mp.inlineWrite(&InlineWriteReq{Inode: 1, Data: []byte("ab")})
+	data, _ := ino.Marshal()
+	loaded := NewInode(0, 0)
+	if err := loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.Inline) != "abcd" || loaded.Size != 4 {
+		t.Fatalf("unmarshal inode %v inline %q", loaded, loaded.Inline)
+	}
+
+	big := &InlineWriteReq{Inode: 1, Data: make([]byte, mp.config.InlineSize+1)}
+	if status := mp.inlineWrite(big); status != proto.OpArgMismatchErr {
+		t.Fatalf("oversize inline write status %v", status)
+	}
+
+	next := NewInode(1, 0)
+	next.Extents.Put(proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 4})
+	mp.appendExtents(next)
+	if len(ino.Inline) != 0 || ino.Size != 4 {
+		t.Fatalf("inline body is kept after extents are appended: %v", ino)
+	}
+	if status := mp.inlineWrite(&InlineWriteReq{Inode: 1, Data: []byte("a")}); status != proto.OpArgMismatchErr {
+		t.Fatalf("inline write to extents status %v", status)
+	}
+}
+
+func TestInodeValueV0(t *testing.T) {
+	// A value written before the value was versioned, with one extent key
+	// without ExtentOffset.
+	buf := new(bytes.Buffer)
+	for _, v := range []interface{}{proto.Mode(os.ModePerm), uint32(1), uint32(2),
+		uint64(10), uint64(1), int64(3), int64(4), int64(5), uint32(0),
+		uint32(1), uint8(0), uint32(7), uint64(8), uint32(10), uint32(9)} {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	ino := NewInode(1, 0)
+	if err := ino.UnmarshalValue(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	ek := proto.ExtentKey{PartitionId: 7, ExtentId: 8, Size: 10, Crc: 9}
+	if ino.Type != proto.Mode(os.ModePerm) || ino.Uid != 1 || ino.Gid != 2 ||
+		ino.Size != 10 || ino.ModifyTime != 5 || ino.NLink != 1 ||
+		ino.Extents.GetExtentLen() != 1 || ino.Extents.Extents[0] != ek {
+		t.Fatalf("version 0 inode %v", ino)
+	}
+
+	ino.Flags = proto.FlagAppend
+	ino.Extents.Extents[0].ExtentOffset = 100
+	loaded := NewInode(1, 0)
+	if err := loaded.UnmarshalValue(ino.MarshalValue()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Flags != proto.FlagAppend || loaded.Extents.GetExtentLen() != 1 ||
+		loaded.Extents.Extents[0].ExtentOffset != 100 {
+		t.Fatalf("current inode %v", loaded)
+	}
+}
+
+func TestExtentKeyV1(t *testing.T) {
+	// Version 1 keys have no flags, an unwritten hole has ExtentOffset 1.
+	buf := new(bytes.Buffer)
+	for _, k := range []proto.ExtentKey{
+		{PartitionId: 7, ExtentId: 8, ExtentOffset: 1, Size: 10, Crc: 9},
+		{ExtentOffset: 1, Size: 20},
+		{Size: 30},
+	} {
+		buf.WriteByte(proto.ExtentKeyVersion1)
+		for _, v := range []interface{}{k.PartitionId, k.ExtentId,
+			k.ExtentOffset, k.Size, k.Crc} {
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	}
+	sk := proto.NewStreamKey(1)
+	if err := sk.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	expect := []proto.ExtentKey{
+		{PartitionId: 7, ExtentId: 8, ExtentOffset: 1, Size: 10, Crc: 9},
+		proto.NewUnwrittenKey(20),
+		proto.NewHoleKey(30),
+	}
+	if !reflect.DeepEqual(sk.Extents, expect) {
+		t.Fatalf("version 1 keys %v, expect %v", sk.Extents, expect)
+	}
+
+	data, err := sk.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := proto.NewStreamKey(1)
+	if err = loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Extents, expect) || !loaded.Extents[1].IsUnwritten() {
+		t.Fatalf("current keys %v, expect %v", loaded.Extents, expect)
+	}
+}
+
+func TestWormQueue(t *testing.T) {
+	mp := newTestPartition(t)
+	newFile := func(inode uint64, modifyTime int64) *Inode {
+		ino := NewInode(inode, proto.Mode(os.ModePerm))
+		ino.ModifyTime = modifyTime
+		return ino
+	}
+	mp.createInode(newFile(1, 30))
+	mp.createInode(NewInode(2, proto.Mode(os.ModeDir|os.ModePerm)))
+	committed := newFile(3, 10)
+	committed.Retention = 100
+	mp.createInode(committed)
+	if mp.worm.tree.Len() != 0 {
+		t.Fatalf("%v queued before fill", mp.worm.tree.Len())
+	}
+
+	mp.worm.fill(mp.getInodeTree())
+	mp.createInode(newFile(4, 10))
+	due := mp.worm.due(30)
+	if len(due) != 2 || due[0].inode != 4 || due[1].inode != 1 {
+		t.Fatalf("due %v", due)
+	}
+	if mp.worm.tree.Len() != 0 {
+		t.Fatalf("%v left after due", mp.worm.tree.Len())
+	}
+	mp.worm.requeue(due[1:])
+	mp.worm.reset()
+	if mp.worm.tree.Len() != 0 || mp.worm.filled {
+		t.Fatalf("%v queued after reset", mp.worm.tree.Len())
+	}
+}
+
+func TestStreamKeySplitExtent(t *testing.T) {
+	ek := func(id uint64, off, size uint32) proto.ExtentKey {
+		return proto.ExtentKey{PartitionId: 1, ExtentId: id, ExtentOffset: off, Size: size}
+	}
+	hole := proto.NewHoleKey
+	cases := []struct {
+		name   string
+		build  func(sk *proto.StreamKey)
+		expect []proto.ExtentKey
+	}{
+		{"grow", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Put(ek(1, 0, 150))
+		}, []proto.ExtentKey{ek(1, 0, 150)}},
+		{"grow after punch in the middle", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Punch(20, 30)
+			sk.Put(ek(1, 0, 150))
+		}, []proto.ExtentKey{ek(1, 0, 20), hole(30), ek(1, 50, 100)}},
+		{"append after punch at the end", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Punch(80, 20)
+			sk.Put(ek(1, 0, 150))
+		}, []proto.ExtentKey{ek(1, 0, 80), hole(20), ek(1, 100, 50)}},
+		{"resend after punch", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Punch(80, 20)
+			sk.Put(ek(1, 0, 100))
+		}, []proto.ExtentKey{ek(1, 0, 80), hole(20)}},
+		{"extent followed by another", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Put(ek(2, 0, 50))
+			sk.Put(ek(1, 0, 120))
+		}, []proto.ExtentKey{ek(1, 0, 100), ek(2, 0, 50), ek(1, 100, 20)}},
+		{"appended into unwritten space", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Allocate(300)
+			sk.Put(ek(1, 0, 150))
+			sk.Put(ek(2, 0, 100))
+		}, []proto.ExtentKey{ek(1, 0, 150), ek(2, 0, 100), proto.NewUnwrittenKey(50)}},
+		{"punch in unwritten space", func(sk *proto.StreamKey) {
+			sk.Put(ek(1, 0, 100))
+			sk.Allocate(300)
+			sk.Punch(150, 50)
+			sk.Put(ek(1, 0, 120))
+		}, []proto.ExtentKey{ek(1, 0, 100), proto.NewUnwrittenKey(50), hole(50), proto.NewUnwrittenKey(100)}},
+		{"appended past unwritten space", func(sk *proto.StreamKey) {
+			sk.Allocate(100)
+			sk.Put(ek(1, 0, 150))
+		}, []proto.ExtentKey{ek(1, 0, 150)}},
+	}
+	for _, c := range cases {
+		sk := proto.NewStreamKey(1)
+		c.build(sk)
+		if !reflect.DeepEqual(sk.Extents, c.expect) {
+			t.Errorf("%s: extents %v, expect %v", c.name, sk.Extents, c.expect)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	mp := newTestPartition(t)
+	ino := NewInode(1, proto.Mode(os.ModePerm))
+	ino.AppendExtents(proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 10})
+	mp.createInode(ino)
+	mp.createInode(NewInode(2, proto.Mode(os.ModeDir|os.ModePerm)))
+	inline := NewInode(3, proto.Mode(os.ModePerm))
+	mp.createInode(inline)
+	mp.inlineWrite(&InlineWriteReq{Inode: 3, Data: []byte("ab")})
+
+	if status := mp.setAttr(&SetattrRequest{Inode: 1, Valid: proto.AttrSize, Size: 100}); status != proto.OpOk {
+		t.Fatalf("allocate status %v", status)
+	}
+	info := &proto.InodeInfo{}
+	replyInfo(info, ino)
+	if info.Size != 100 || info.Unwritten != 90 {
+		t.Fatalf("allocated size %v unwritten %v", info.Size, info.Unwritten)
+	}
+	mp.setAttr(&SetattrRequest{Inode: 1, Valid: proto.AttrSize, Size: 50})
+	if ino.Size != 100 {
+		t.Fatalf("allocate shrinks the file to %v", ino.Size)
+	}
+	next := NewInode(1, 0)
+	next.Extents.Put(proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 30})
+	mp.appendExtents(next)
+	if ino.Size != 100 || ino.Extents.Unwritten() != 70 {
+		t.Fatalf("appended size %v unwritten %v", ino.Size, ino.Extents.Unwritten())
+	}
+
+	for _, i := range []uint64{2, 3} {
+		if status := mp.setAttr(&SetattrRequest{Inode: i, Valid: proto.AttrSize, Size: 100}); status != proto.OpArgMismatchErr {
+			t.Fatalf("allocate inode %v status %v", i, status)
+		}
+	}
+}
+
+func TestPunchReleasedPieces(t *testing.T) {
+	mp := newTestPartition(t)
+	raft := newTestRaft(mp)
+	mode := proto.Mode(os.ModePerm)
+	ino := NewInode(1, mode)
+	// The extent is used twice by the file, a punch of one use releases
+	// only what the other does not use.
+	ino.Extents.Extents = []proto.ExtentKey{
+		{PartitionId: 1, ExtentId: 1, Size: 100},
+		{PartitionId: 1, ExtentId: 1, ExtentOffset: 50, Size: 100},
+	}
+	ino.Size = ino.Extents.Size()
+	mp.createInode(ino)
+
+	// The dataPartition is unknown, so the pieces are kept with the inode
+	// once the hole is committed.
+	p := &Packet{}
+	mp.ExtentsPunchHole(&PunchHoleReq{Inode: 1, Offset: 0, Size: 100}, p)
+	expect := []proto.ExtentKey{{PartitionId: 1, ExtentId: 1, Size: 50}}
+	if p.ResultCode != proto.OpOk || !ino.Extents.Extents[0].IsHole() {
+		t.Fatalf("punch result %v extents %v", p.GetResultMesg(), ino.Extents)
+	}
+	if !reflect.DeepEqual(ino.Punched, expect) {
+		t.Fatalf("punched %v, expect %v", ino.Punched, expect)
+	}
+	data, err := ino.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInode(0, 0)
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Punched, expect) {
+		t.Fatalf("loaded punched %v, expect %v", loaded.Punched, expect)
+	}
+
+	// A file which may not be punched is refused before the hole is
+	// proposed.
+	locked := NewInode(2, mode)
+	locked.Flags = proto.FlagAppend
+	locked.AppendExtents(proto.ExtentKey{PartitionId: 1, ExtentId: 2, Size: 100})
+	mp.createInode(locked)
+	submitted := len(raft.submitted)
+	p = &Packet{}
+	mp.ExtentsPunchHole(&PunchHoleReq{Inode: 2, Offset: 0, Size: 100}, p)
+	if p.ResultCode != proto.OpNotPermErr || len(raft.submitted) != submitted ||
+		locked.Extents.Extents[0].IsHole() {
+		t.Fatalf("punch append-only result %v extents %v", p.GetResultMesg(),
+			locked.Extents)
+	}
+
+	// The worker keeps the pieces which fail, and retries them later.
+	now := time.Now()
+	mp.releasePunchedInodes(now)
+	if !reflect.DeepEqual(ino.Punched, expect) || mp.punchRetry.due(1, now) {
+		t.Fatalf("punched %v after a failure", ino.Punched)
+	}
+	if inodes := mp.punches.take(); !reflect.DeepEqual(inodes, []uint64{1}) {
+		t.Fatalf("queued %v", inodes)
+	}
+
+	// The pieces of a deleted inode are dropped, its extents are released
+	// whole.
+	ino.MarkDelete = 1
+	mp.punches.requeue([]uint64{1})
+	mp.releasePunchedInodes(now)
+	if len(ino.Punched) != 0 || len(mp.punches.take()) != 0 {
+		t.Fatalf("punched %v after delete", ino.Punched)
+	}
+}
+
+func TestPunchReleased(t *testing.T) {
+	mp := newTestPartition(t)
+	p1 := proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 50}
+	p2 := proto.ExtentKey{PartitionId: 1, ExtentId: 2, ExtentOffset: 10, Size: 20}
+	ino := NewInode(1, proto.Mode(os.ModePerm))
+	ino.Punched = []proto.ExtentKey{p1, p2}
+	mp.createInode(ino)
+
+	val, _ := json.Marshal([]reclaimItem{{Inode: 1, Extents: []proto.ExtentKey{p2}},
+		{Inode: 2, Extents: []proto.ExtentKey{p1}}})
+	if _, err := mp.applyItem(NewMetaItem(opFSMPunchReleased, nil, val), 1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ino.Punched, []proto.ExtentKey{p1}) {
+		t.Fatalf("punched %v", ino.Punched)
+	}
+
+	// The queue is filled from the inodes with pieces left.
+	mp.createInode(NewInode(3, proto.Mode(os.ModePerm)))
+	mp.punches.fill(mp.inodeTree)
+	if inodes := mp.punches.take(); !reflect.DeepEqual(inodes, []uint64{1}) {
+		t.Fatalf("queued %v", inodes)
+	}
+	if status := mp.punchHole(&PunchHoleReq{Inode: 3, Size: 10}).Status; status != proto.OpOk {
+		t.Fatalf("punch status %v", status)
+	}
+	if inodes := mp.punches.take(); len(inodes) != 0 {
+		t.Fatalf("queued %v after punching nothing", inodes)
+	}
+}
@@ -17,6 +17,7 @@ package metanode
 import (
 	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/util/btree"
+	"os"
 	"reflect"
 	"testing"
 )
@@ -78,7 +79,7 @@ func TestDentryBtree(t *testing.T) {
 		ParentId: 1,
 		Name:     "star",
 		Inode:    10,
-		Type:     proto.ModeDir,
+		Type:     proto.Mode(os.ModeDir),
 	}
 	dTree.ReplaceOrInsert(dentry)
 	newDen := &Dentry{
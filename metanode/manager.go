@@ -50,12 +50,14 @@ type MetaManager interface {
 type MetaManagerConfig struct {
 	NodeID    uint64
 	RootDir   string
+	StoreMode string // Storage engine of new partitions
 	RaftStore raftstore.RaftStore
 }
 
 type metaManager struct {
 	nodeId     uint64
 	rootDir    string
+	storeMode  string
 	raftStore  raftstore.RaftStore
 	connPool   *pool.ConnectPool
 	state      uint32
@@ -103,6 +105,18 @@ func (m *metaManager) HandleMetaOperation(conn net.Conn, p *Packet) (err error)
 		err = m.opMetaExtentsDel(conn, p)
 	case proto.OpMetaTruncate:
 		err = m.opMetaExtentsTruncate(conn, p)
+	case proto.OpMetaPunchHole:
+		err = m.opMetaPunchHole(conn, p)
+	case proto.OpMetaExtentsClone:
+		err = m.opMetaExtentsClone(conn, p)
+	case proto.OpMetaWormCommit:
+		err = m.opMetaWormCommit(conn, p)
+	case proto.OpMetaInlineWrite:
+		err = m.opMetaInlineWrite(conn, p)
+	case proto.OpMetaBatch:
+		err = m.opMetaBatch(conn, p)
+	case proto.OpMetaReadChanges:
+		err = m.opMetaReadChanges(conn, p)
 	case proto.OpMetaLookup:
 		err = m.opMetaLookup(conn, p)
 	case proto.OpDeleteMetaPartition:
@@ -113,6 +127,14 @@ func (m *metaManager) HandleMetaOperation(conn net.Conn, p *Packet) (err error)
 		err = m.opLoadMetaPartition(conn, p)
 	case proto.OpOfflineMetaPartition:
 		err = m.opOfflineMetaPartition(conn, p)
+	case proto.OpSplitMetaPartition:
+		err = m.opSplitMetaPartition(conn, p)
+	case proto.OpMetaImportItems:
+		err = m.opMetaImportItems(conn, p)
+	case proto.OpMetaUpdateUsage:
+		err = m.opMetaUpdateUsage(conn, p)
+	case proto.OpMetaUpdateLinks:
+		err = m.opMetaUpdateLinks(conn, p)
 	case proto.OpMetaBatchInodeGet:
 		err = m.opMetaBatchInodeGet(conn, p)
 	case proto.OpPing:
@@ -259,13 +281,17 @@ func (m *metaManager) detachPartition(id uint64) (err error) {
 }
 
 func (m *metaManager) createPartition(id uint64, volName string, start,
-	end uint64, peers []proto.Peer) (err error) {
+	end uint64, peers []proto.Peer, worm proto.WormPolicy,
+	storeMode string, splitFrom uint64, inlineSize uint32) (err error) {
 	/* Check Partition */
 	if _, err = m.getPartition(id); err == nil {
 		err = errors.Errorf("create partition id=%d is exsited!", id)
 		return
 	}
 	err = nil
+	if storeMode == "" {
+		storeMode = m.storeMode
+	}
 	/* Create metaPartition and add metaManager */
 	partId := fmt.Sprintf("%d", id)
 	mpc := &MetaPartitionConfig{
@@ -275,6 +301,10 @@ func (m *metaManager) createPartition(id uint64, volName string, start,
 		End:         end,
 		Cursor:      start,
 		Peers:       peers,
+		Worm:        worm,
+		StoreMode:   storeMode,
+		SplitFrom:   splitFrom,
+		InlineSize:  inlineSize,
 		RaftStore:   m.raftStore,
 		NodeId:      m.nodeId,
 		RootDir:     path.Join(m.rootDir, partitionPrefix+partId),
@@ -325,6 +355,7 @@ func NewMetaManager(conf MetaManagerConfig) MetaManager {
 	return &metaManager{
 		nodeId:     conf.NodeID,
 		rootDir:    conf.RootDir,
+		storeMode:  conf.StoreMode,
 		raftStore:  conf.RaftStore,
 		partitions: make(map[uint64]MetaPartition),
 	}
@@ -55,9 +55,7 @@ func (m *metaManager) opMasterHeartbeat(conn net.Conn, p *Packet) (err error) {
 		resp.Result = err.Error()
 		return
 	}
-	if curMasterAddr != req.MasterAddr {
-		curMasterAddr = req.MasterAddr
-	}
+	masterClient.AddNode(req.MasterAddr)
 	// collect used info
 	// machine mem total and used
 	resp.Total, _, err = util.GetMemInfo()
@@ -85,6 +83,9 @@ func (m *metaManager) opMasterHeartbeat(conn net.Conn, p *Packet) (err error) {
 			mpr.Status = proto.Unavaliable
 		}
 		mpr.IsLeader = isLeader
+		if isLeader {
+			mpr.TopDirs = partition.TopDirs()
+		}
 		if mConf.Cursor >= mConf.End {
 			mpr.Status = proto.ReadOnly
 		}
@@ -143,7 +144,8 @@ func (m *metaManager) opCreateMetaPartition(conn net.Conn, p *Packet) (err error
 	}
 	// Create new  metaPartition.
 	if err = m.createPartition(req.PartitionID, req.VolName, req.Start, req.End,
-		req.Members); err != nil {
+		req.Members, req.Worm, req.StoreMode, req.SplitFrom,
+		req.InlineSize); err != nil {
 		resp.Status = proto.TaskFail
 		resp.Result = err.Error()
 		err = errors.Errorf("[opCreateMetaPartition]->%s; request message: %v",
@@ -534,6 +536,142 @@ func (m *metaManager) opMetaExtentsTruncate(conn net.Conn, p *Packet) (err error
 	return
 }
 
+func (m *metaManager) opMetaPunchHole(conn net.Conn, p *Packet) (err error) {
+	req := &PunchHoleReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	mp.ExtentsPunchHole(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaPunchHole] req: %v, resp: %v", req, p.GetResultMesg())
+	return
+}
+
+func (m *metaManager) opMetaExtentsClone(conn net.Conn, p *Packet) (err error) {
+	req := &CloneExtentsReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	mp.ExtentsClone(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaExtentsClone] req: %v, resp: %v", req, p.GetResultMesg())
+	return
+}
+
+func (m *metaManager) opMetaWormCommit(conn net.Conn, p *Packet) (err error) {
+	req := &WormCommitReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	mp.WormCommit(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaWormCommit] req: %v, resp: %v", req, p.GetResultMesg())
+	return
+}
+
+func (m *metaManager) opMetaInlineWrite(conn net.Conn, p *Packet) (err error) {
+	req := &InlineWriteReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	mp.InlineWrite(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaInlineWrite] req: ino(%v) off(%v) size(%v), resp: %v",
+		req.Inode, req.Offset, len(req.Data), p.GetResultMesg())
+	return
+}
+
+func (m *metaManager) opMetaBatch(conn net.Conn, p *Packet) (err error) {
+	req := &BatchReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	mp.Batch(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaBatch] req: items(%v), resp: %v", len(req.Items),
+		p.GetResultMesg())
+	return
+}
+
+// opMetaReadChanges is served by the member asked, without the leader.
+func (m *metaManager) opMetaReadChanges(conn net.Conn, p *Packet) (err error) {
+	req := &ReadChangesReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.Errorf("[opMetaReadChanges]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if err = mp.ReadChanges(req, p); err != nil {
+		err = errors.Errorf("[opMetaReadChanges]: %s", err.Error())
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaReadChanges] req: %v, resp: %v", req,
+		p.GetResultMesg())
+	return
+}
+
 func (m *metaManager) opDeleteMetaPartition(conn net.Conn, p *Packet) (err error) {
 	adminTask := &proto.AdminTask{}
 	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
@@ -759,3 +897,127 @@ func (m *metaManager) opMetaBatchInodeGet(conn net.Conn, p *Packet) (err error)
 		p.GetResultMesg(), p.Data)
 	return
 }
+
+func (m *metaManager) opSplitMetaPartition(conn net.Conn, p *Packet) (err error) {
+	var (
+		reqData []byte
+		req     = &SplitPartitionReq{}
+	)
+	adminTask := &proto.AdminTask{}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	log.LogDebugf("[opSplitMetaPartition] received task: %v", adminTask)
+	if reqData, err = json.Marshal(adminTask.Request); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if err = json.Unmarshal(reqData, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	m.responseAckOKToMaster(conn, p)
+	resp := &SplitPartitionResp{}
+	err = mp.SplitPartition(req, resp)
+	adminTask.Response = resp
+	adminTask.Request = nil
+	m.respondToMaster(adminTask)
+	log.LogDebugf("[opSplitMetaPartition] req[%v], response[%v].", req,
+		adminTask)
+	return
+}
+
+func (m *metaManager) opMetaImportItems(conn net.Conn, p *Packet) (err error) {
+	req := &ImportItemsReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.Errorf("[opMetaImportItems]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		// The partition may be created after the split has started.
+		p.PackErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.ImportItems(req, p); err != nil {
+		err = errors.Errorf("[opMetaImportItems]: %s", err.Error())
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaImportItems] partition id=%d, inodes=%d,"+
+		" dentries=%d, done=%v, resp: %v", req.PartitionID, len(req.Inodes),
+		len(req.Dentries), req.Done, p.GetResultMesg())
+	return
+}
+
+func (m *metaManager) opMetaUpdateUsage(conn net.Conn, p *Packet) (err error) {
+	req := &UpdateUsageReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.Errorf("[opMetaUpdateUsage]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.UpdateUsage(req, p); err != nil {
+		err = errors.Errorf("[opMetaUpdateUsage]: %s", err.Error())
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaUpdateUsage] partition id=%d, deltas=%d, resp: %v",
+		req.PartitionID, len(req.Deltas), p.GetResultMesg())
+	return
+}
+
+func (m *metaManager) opMetaUpdateLinks(conn net.Conn, p *Packet) (err error) {
+	req := &UpdateLinksReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.Errorf("[opMetaUpdateLinks]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.UpdateLinks(req, p); err != nil {
+		err = errors.Errorf("[opMetaUpdateLinks]: %s", err.Error())
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("[opMetaUpdateLinks] partition id=%d, changes=%d, resp: %v",
+		req.PartitionID, len(req.Changes), p.GetResultMesg())
+	return
+}
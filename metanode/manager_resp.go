@@ -15,20 +15,15 @@
 package metanode
 
 import (
-	"encoding/json"
 	"net"
 
 	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/util/log"
 )
 
-const (
-	masterResponsePath = "/metaNode/response" // Method: 'POST',
-	// ContentType: 'application/json'
-)
-
 // ReplyToMaster reply operation result to master by sending http request.
-func (m *metaManager) respondToMaster(data interface{}) (err error) {
+func (m *metaManager) respondToMaster(task *proto.AdminTask) (err error) {
 	// Handle panic
 	defer func() {
 		if r := recover(); r != nil {
@@ -40,12 +35,8 @@ func (m *metaManager) respondToMaster(data interface{}) (err error) {
 			}
 		}
 	}()
-	// Process data and send reply though http specified remote address.
-	jsonBytes, err := json.Marshal(data)
-	if err != nil {
-		return
-	}
-	postToMaster("POST", masterResponsePath, jsonBytes)
+	// Send reply though http to the master leader.
+	err = masterClient.MetaNodeResponse(task)
 	return
 }
 
@@ -15,21 +15,16 @@
 package metanode
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/juju/errors"
-	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/raftstore"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/util"
 	"github.com/tiglabs/containerfs/util/config"
 	"github.com/tiglabs/containerfs/util/log"
@@ -50,6 +45,7 @@ type MetaNode struct {
 	raftStore         raftstore.RaftStore
 	raftHeartbeatPort string
 	raftReplicatePort string
+	storeMode         string //storage engine of new partitions
 	httpStopC         chan uint8
 	state             uint32
 	wg                sync.WaitGroup
@@ -137,12 +133,14 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 	m.raftDir = cfg.GetString(cfgRaftDir)
 	m.raftHeartbeatPort = cfg.GetString(cfgRaftHeartbeatPort)
 	m.raftReplicatePort = cfg.GetString(cfgRaftReplicatePort)
+	m.storeMode = cfg.GetString(cfgStoreMode)
 
 	log.LogDebugf("action[parseConfig] load listen[%v].", m.listen)
 	log.LogDebugf("action[parseConfig] load metaDir[%v].", m.metaDir)
 	log.LogDebugf("action[parseConfig] load raftDir[%v].", m.raftDir)
 	log.LogDebugf("action[parseConfig] load raftHeartbeatPort[%v].", m.raftHeartbeatPort)
 	log.LogDebugf("action[parseConfig] load raftReplicatePort[%v].", m.raftReplicatePort)
+	log.LogDebugf("action[parseConfig] load storeMode[%v].", m.storeMode)
 
 	addrs := cfg.GetArray(cfgMasterAddrs)
 	for _, addr := range addrs {
@@ -163,6 +161,14 @@ func (m *MetaNode) validConfig() (err error) {
 	if m.raftDir == "" {
 		m.raftDir = defaultRaftDir
 	}
+	switch m.storeMode {
+	case "":
+		m.storeMode = StoreModeMemory
+	case StoreModeMemory, StoreModeRocksDB:
+	default:
+		err = errors.New("illegal storeMode")
+		return
+	}
 	if len(masterAddrs) == 0 {
 		err = errors.New("master address list is empty")
 		return
@@ -180,6 +186,7 @@ func (m *MetaNode) startMetaManager() (err error) {
 	conf := MetaManagerConfig{
 		NodeID:    m.nodeId,
 		RootDir:   m.metaDir,
+		StoreMode: m.storeMode,
 		RaftStore: m.raftStore,
 	}
 	m.metaManager = NewMetaManager(conf)
@@ -195,6 +202,7 @@ func (m *MetaNode) stopMetaManager() {
 }
 
 func (m *MetaNode) register() (err error) {
+	masterClient = master.NewMasterClient(masterAddrs)
 	for {
 		m.localAddr, err = util.GetLocalIP()
 		if err != nil {
@@ -212,97 +220,21 @@ func (m *MetaNode) register() (err error) {
 }
 
 func (m *MetaNode) postNodeID() (err error) {
-	reqPath := fmt.Sprintf("%s?addr=%s:%s", metaNodeURL, m.localAddr, m.listen)
-	msg, err := postToMaster("POST", reqPath, nil)
-	if err != nil {
+	addr := fmt.Sprintf("%s:%s", m.localAddr, m.listen)
+	if m.nodeId, err = masterClient.AddMetaNode(&master.NodeRequest{Addr: addr}); err != nil {
 		err = errors.Errorf("[postNodeID] %s", err.Error())
-		return
-	}
-	nodeIDStr := strings.TrimSpace(string(msg))
-	if nodeIDStr == "" {
-		err = errors.Errorf("[postNodeID] master respond empty body")
-		return
-	}
-	m.nodeId, err = strconv.ParseUint(nodeIDStr, 10, 64)
-	return
-}
-
-func postToMaster(method string, reqPath string, body []byte) (msg []byte,
-	err error) {
-	var (
-		req  *http.Request
-		resp *http.Response
-	)
-	client := &http.Client{Timeout: 2 * time.Second}
-	for _, maddr := range masterAddrs {
-		if curMasterAddr == "" {
-			curMasterAddr = maddr
-		}
-		reqURL := fmt.Sprintf("http://%s%s", curMasterAddr, reqPath)
-		reqBody := bytes.NewBuffer(body)
-		req, err = http.NewRequest(method, reqURL, reqBody)
-		if err != nil {
-			log.LogErrorf("[postToMaster] construction NewRequest url=%s: %s",
-				reqURL, err.Error())
-			curMasterAddr = ""
-			continue
-		}
-		req.Header.Set("Connection", "close")
-		resp, err = client.Do(req)
-		if err != nil {
-			log.LogErrorf("[postToMaster] connect master url=%s: %s",
-				reqURL, err.Error())
-			curMasterAddr = ""
-			continue
-		}
-		msg, err = ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			log.LogErrorf("[postToMaster] read body url=%s: %s",
-				reqURL, err.Error())
-			curMasterAddr = ""
-			continue
-		}
-		if resp.StatusCode == http.StatusOK {
-			return
-		}
-		if resp.StatusCode == http.StatusForbidden {
-			curMasterAddr = strings.TrimSpace(string(msg))
-			err = errors.Errorf("[postToMaster] master response ")
-			continue
-		}
-		curMasterAddr = ""
-		err = errors.Errorf("[postToMaster] master response url=%s,"+
-			" status_code=%d, msg: %v", reqURL, resp.StatusCode, string(msg))
-		log.LogErrorf(err.Error())
 	}
 	return
 }
 
 func (m *MetaNode) startUMP() (err error) {
-	defaultTimeout := http.DefaultClient.Timeout
-	defer func() {
-		http.DefaultClient.Timeout = defaultTimeout
-	}()
 	// Get cluster name from master
-	http.DefaultClient.Timeout = 2 * time.Second
-	resp, err := http.Get(fmt.Sprintf("http://%s%s", curMasterAddr, metaNodeGetName))
+	info, err := masterClient.GetClusterInfo()
 	if err != nil {
 		err = errors.Errorf("[startUMP]: %s", err.Error())
 		return
 	}
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		err = errors.Errorf("[startUMP]: %s", err.Error())
-		return
-	}
-	req := &proto.ClusterInfo{}
-	if err = json.Unmarshal(data, req); err != nil {
-		err = errors.Errorf("[startUMP]: %s", err.Error())
-		return
-	}
-	UMPKey = req.Cluster + "_metaNode"
+	UMPKey = info.Cluster + "_metaNode"
 	ump.InitUmp(UMPKey)
 	return
 }
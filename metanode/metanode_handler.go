@@ -30,6 +30,9 @@ func (m *MetaNode) registerHandler() (err error) {
 	http.HandleFunc("/getInodeRange", m.rangeHandle)
 	http.HandleFunc("/getExtents", m.getExtents)
 	http.HandleFunc("/getDentry", m.getDentryHandle)
+	http.HandleFunc("/getInodePaths", m.getInodePaths)
+	http.HandleFunc("/getChanges", m.getChanges)
+	http.HandleFunc("/getReclaimStat", m.getReclaimStat)
 	return
 }
 func (m *MetaNode) allPartitionsHandle(w http.ResponseWriter, r *http.Request) {
@@ -188,3 +191,134 @@ func (m *MetaNode) getDentryHandle(w http.ResponseWriter, r *http.Request) {
 	})
 	return
 }
+
+// getInodePaths resolves the paths of an inode of the partition, the
+// parents on the other partitions of the volume are asked from them.
+func (m *MetaNode) getInodePaths(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	pidVal := r.FormValue("pid")
+	idVal := r.FormValue("ino")
+	if pidVal == "" || idVal == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	pid, err := strconv.ParseUint(pidVal, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	id, err := strconv.ParseUint(idVal, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	mp, err := m.metaManager.GetPartition(pid)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	mm := mp.(*metaPartition)
+	paths, err := proto.InodePaths(id, mm.lookupInode)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	data, err := json.Marshal(paths)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(data)
+}
+
+// getChanges long-polls the change feed of a partition, like
+// OpMetaReadChanges. The wait is in milliseconds.
+func (m *MetaNode) getChanges(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	req := &ReadChangesReq{}
+	pid, err := strconv.ParseUint(r.FormValue("pid"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	req.PartitionID = pid
+	if val := r.FormValue("from"); val != "" {
+		if req.From, err = strconv.ParseUint(val, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	if val := r.FormValue("limit"); val != "" {
+		if req.Limit, err = strconv.Atoi(val); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	if val := r.FormValue("wait"); val != "" {
+		if req.Wait, err = strconv.ParseInt(val, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	mp, err := m.metaManager.GetPartition(pid)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	resp := mp.(*metaPartition).readChanges(req)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if req.From != 0 && req.From < resp.Start {
+		// The changes from the index are lost.
+		w.WriteHeader(http.StatusGone)
+	}
+	w.Write(data)
+}
+
+// getReclaimStat reports the deleted inodes left to free of a partition, or
+// of all the partitions without pid, and the failures of the leader.
+func (m *MetaNode) getReclaimStat(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	var stats []*ReclaimStat
+	if val := r.FormValue("pid"); val != "" {
+		pid, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		mp, err := m.metaManager.GetPartition(pid)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		stats = append(stats, mp.(*metaPartition).reclaimStat())
+	} else {
+		m.metaManager.(*metaManager).Range(func(i uint64, p MetaPartition) bool {
+			stats = append(stats, p.(*metaPartition).reclaimStat())
+			return true
+		})
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(data)
+}
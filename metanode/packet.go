@@ -14,7 +14,11 @@
 
 package metanode
 
-import "github.com/tiglabs/containerfs/proto"
+import (
+	"encoding/binary"
+
+	"github.com/tiglabs/containerfs/proto"
+)
 
 type Packet struct {
 	proto.Packet
@@ -35,3 +39,67 @@ func NewExtentDeletePacket(dp *DataPartition, extentId uint64) *Packet {
 
 	return p
 }
+
+// For send punch hole request to dataNode
+func NewExtentPunchPacket(dp *DataPartition, ext proto.ExtentKey) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpPunchHole
+	p.StoreMode = proto.ExtentStoreMode
+	p.PartitionID = dp.PartitionID
+	p.FileID = ext.ExtentId
+	p.Offset = int64(ext.ExtentOffset)
+	p.Data = make([]byte, 8)
+	binary.BigEndian.PutUint64(p.Data, uint64(ext.Size))
+	p.Size = uint32(len(p.Data))
+	p.ReqID = proto.GetReqID()
+	p.Nodes = uint8(len(dp.Hosts) - 1)
+	p.Arg = ([]byte)(dp.GetAllAddrs())
+	p.Arglen = uint32(len(p.Arg))
+
+	return p
+}
+
+// For send the items of a split to the new meta partition
+func NewImportItemsPacket(data []byte) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpMetaImportItems
+	p.ReqID = proto.GetReqID()
+	p.Data = data
+	p.Size = uint32(len(data))
+	return p
+}
+
+// For send the usage changes of directories to their meta partition
+func NewUpdateUsagePacket(data []byte) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpMetaUpdateUsage
+	p.ReqID = proto.GetReqID()
+	p.Data = data
+	p.Size = uint32(len(data))
+	return p
+}
+
+// For send the link changes of inodes to their meta partition
+func NewUpdateLinksPacket(data []byte) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpMetaUpdateLinks
+	p.ReqID = proto.GetReqID()
+	p.Data = data
+	p.Size = uint32(len(data))
+	return p
+}
+
+// For get an inode of another meta partition
+func NewInodeGetPacket(data []byte) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpMetaInodeGet
+	p.ReqID = proto.GetReqID()
+	p.Data = data
+	p.Size = uint32(len(data))
+	return p
+}
@@ -16,9 +16,12 @@ package metanode
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/juju/errors"
@@ -26,6 +29,7 @@ import (
 	"github.com/tiglabs/containerfs/raftstore"
 	"github.com/tiglabs/containerfs/util/log"
 	"github.com/tiglabs/containerfs/util/pool"
+	"github.com/tiglabs/containerfs/util/ump"
 	raftproto "github.com/tiglabs/raft/proto"
 )
 
@@ -58,6 +62,7 @@ Start: Minimal Inode ID of this range. (Required when initialize)
 End: Maximal Inode ID of this range. (Required when initialize)
 Cursor: Cursor ID value of Inode what have been already assigned.
 Peers: Peers information for raftStore.
+SplitFrom: Source partition of the items while the partition imports them during a split.
 */
 type MetaPartitionConfig struct {
 	PartitionId uint64              `json:"partition_id"`
@@ -65,6 +70,10 @@ type MetaPartitionConfig struct {
 	Start       uint64              `json:"start"`
 	End         uint64              `json:"end"`
 	Peers       []proto.Peer        `json:"peers"`
+	Worm        proto.WormPolicy    `json:"worm"`
+	StoreMode   string              `json:"store_mode"`
+	SplitFrom   uint64              `json:"split_from"`
+	InlineSize  uint32              `json:"inline_size"`
 	Cursor      uint64              `json:"-"`
 	NodeId      uint64              `json:"-"`
 	RootDir     string              `json:"-"`
@@ -120,6 +129,7 @@ type OpInode interface {
 	CreateLinkInode(req *LinkInodeReq, p *Packet) (err error)
 	EvictInode(req *EvictInodeReq, p *Packet) (err error)
 	SetAttr(reqData []byte, p *Packet) (err error)
+	WormCommit(req *WormCommitReq, p *Packet) (err error)
 }
 
 type OpDentry interface {
@@ -134,6 +144,9 @@ type OpExtent interface {
 	ExtentAppend(req *proto.AppendExtentKeyRequest, p *Packet) (err error)
 	ExtentsList(req *proto.GetExtentsRequest, p *Packet) (err error)
 	ExtentsTruncate(req *ExtentsTruncateReq, p *Packet) (err error)
+	ExtentsPunchHole(req *PunchHoleReq, p *Packet) (err error)
+	ExtentsClone(req *CloneExtentsReq, p *Packet) (err error)
+	InlineWrite(req *InlineWriteReq, p *Packet) (err error)
 }
 
 type OpMeta interface {
@@ -141,6 +154,7 @@ type OpMeta interface {
 	OpDentry
 	OpExtent
 	OpPartition
+	Batch(req *BatchReq, p *Packet) (err error)
 }
 
 type OpPartition interface {
@@ -151,6 +165,12 @@ type OpPartition interface {
 	ChangeMember(changeType raftproto.ConfChangeType, peer raftproto.Peer, context []byte) (resp interface{}, err error)
 	DeletePartition() (err error)
 	UpdatePartition(req *UpdatePartitionReq, resp *UpdatePartitionResp) (err error)
+	SplitPartition(req *SplitPartitionReq, resp *SplitPartitionResp) (err error)
+	ImportItems(req *ImportItemsReq, p *Packet) (err error)
+	UpdateUsage(req *UpdateUsageReq, p *Packet) (err error)
+	UpdateLinks(req *UpdateLinksReq, p *Packet) (err error)
+	ReadChanges(req *ReadChangesReq, p *Packet) (err error)
+	TopDirs() []proto.InodeUsage
 	DeleteRaft() error
 }
 
@@ -170,14 +190,27 @@ type metaPartition struct {
 	config        *MetaPartitionConfig
 	size          uint64 // For partition all file size
 	applyID       uint64 // For store Inode/Dentry max applyID, this index will be update after restore from dump data.
-	dentryTree    *BTree
-	inodeTree     *BTree              // B-Tree for Inode.
+	dentryTree    MetaTree
+	inodeTree     MetaTree            // B-Tree for Inode.
 	raftPartition raftstore.Partition // RaftStore partition instance of this meta partition.
 	stopC         chan bool
 	storeChan     chan *storeMsg
 	state         uint32
-	freeList      *freeList // Free inode list
+	freeList      *freeList   // Free inode list
+	extentRefs    *extentRefs // Reference counts of shared extents
 	vol           *Vol
+	dirty         *dirtySet   // Inodes and dentries changed since the last store tick
+	baseLock      sync.Mutex  // Serializes writing the base image
+	baseApplyID   uint64      // ApplyID of the base image written last
+	merging       uint32      // Set while merging the delta files
+	rocks         *rocksStore // Set if the trees are stored in rocksdb
+	usage         *usageSet   // Usage changes of directories to be added
+	links         *linkSet    // Link changes of inodes to be recorded
+	changes       *changeFeed // Changes applied lately, for external consumers
+	reclaims      *reclaimSet // Failures of the inodes being freed
+	worm          *wormQueue  // Files to be committed automatically
+	punches       *punchQueue // Inodes with punched pieces to be released
+	punchRetry    *reclaimSet // Failures of the punched inodes
 }
 
 func (mp *metaPartition) Start() (err error) {
@@ -221,7 +254,7 @@ func (mp *metaPartition) Stop() {
 }
 
 func (mp *metaPartition) onStart() (err error) {
-	if err = mp.load(); err != nil {
+	if err = mp.loadOrReset(); err != nil {
 		err = errors.Errorf("[onStart]:load partition id=%d: %s",
 			mp.config.PartitionId, err.Error())
 		return
@@ -234,12 +267,32 @@ func (mp *metaPartition) onStart() (err error) {
 	}
 	mp.startSchedule(mp.applyID)
 	mp.startFreeList()
+	mp.startWormWorker()
+	mp.startUsageWorker()
+	mp.startLinkWorker()
 	return
 }
 
 func (mp *metaPartition) onStop() {
 	mp.stopRaft()
 	mp.stop()
+	mp.closeRocks()
+}
+
+// loadOrReset loads the partition from its files. Partial metadata is not
+// served: if a file is corrupt, the partition starts empty at apply index 0
+// so that the raft leader sends it a snapshot. The local raft log is kept.
+func (mp *metaPartition) loadOrReset() (err error) {
+	if err = mp.load(); err == nil || !isCorruptFile(err) {
+		return
+	}
+	msg := fmt.Sprintf("partition id=%d: %s, fetch snapshot from raft "+
+		"leader", mp.config.PartitionId, err.Error())
+	log.LogErrorf("[loadOrReset] %s", msg)
+	ump.Alarm(UMPKey, msg)
+	mp.links.reset()
+	mp.freeList.Reset()
+	return mp.Reset()
 }
 
 func (mp *metaPartition) startRaft() (err error) {
@@ -314,7 +367,16 @@ func NewMetaPartition(conf *MetaPartitionConfig) MetaPartition {
 		stopC:      make(chan bool),
 		storeChan:  make(chan *storeMsg, 5),
 		freeList:   newFreeList(),
+		extentRefs: newExtentRefs(),
 		vol:        NewVol(),
+		dirty:      newDirtySet(),
+		usage:      newUsageSet(),
+		links:      newLinkSet(),
+		changes:    newChangeFeed(),
+		reclaims:   newReclaimSet(),
+		worm:       newWormQueue(),
+		punches:    newPunchQueue(),
+		punchRetry: newReclaimSet(),
 	}
 	return mp
 }
@@ -349,26 +411,73 @@ func (mp *metaPartition) load() (err error) {
 	if err = mp.loadMeta(); err != nil {
 		return
 	}
-	if err = mp.loadInode(); err != nil {
-		return
+	if mp.config.StoreMode == StoreModeRocksDB {
+		if err = mp.loadRocks(); err != nil {
+			return
+		}
+	} else {
+		if err = mp.loadInode(); err != nil {
+			return
+		}
+		if err = mp.loadDentry(); err != nil {
+			return
+		}
+		if err = mp.loadDelta(); err != nil {
+			return
+		}
+		if err = mp.loadApplyID(); err != nil {
+			return
+		}
+		// The loaded dentries are recorded in their inodes already.
+		if err = mp.loadLinks(); err != nil {
+			return
+		}
 	}
-	if err = mp.loadDentry(); err != nil {
-		return
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		mp.checkAndInsertFreeList(ino)
+		if mp.config.Cursor < ino.Inode {
+			mp.config.Cursor = ino.Inode
+		}
+		return true
+	})
+	if mp.rocks == nil {
+		mp.extentRefs.Rebuild(mp.inodeTree)
 	}
-	err = mp.loadApplyID()
+	mp.dirty.reset()
+	// The loaded dentries are recorded in their directories already.
+	mp.usage.swap()
+	mp.changes.reset(mp.applyID + 1)
 	return
 }
 
+// store writes the changes since the previous store tick as a delta file,
+// the full trees are only written after a raft snapshot has been applied
+// and when the delta files are merged.
 func (mp *metaPartition) store(sm *storeMsg) (err error) {
-	if err = mp.storeInode(sm); err != nil {
+	if mp.rocks != nil {
+		// Already written to rocksdb by Apply.
 		return
 	}
-	if err = mp.storeDentry(sm); err != nil {
+	if sm.full {
+		err = mp.storeBase(sm)
+	} else {
+		err = mp.storeDelta(sm)
+	}
+	if err != nil {
 		return
 	}
+	if sm.links != nil {
+		if err = mp.storeLinks(sm); err != nil {
+			return
+		}
+	}
 	if err = mp.storeApplyID(sm); err != nil {
 		return
 	}
+	if !sm.full {
+		mp.mergeDelta(sm)
+	}
 	return
 }
 
@@ -445,11 +554,18 @@ func (mp *metaPartition) OfflinePartition(req []byte) (err error) {
 func (mp *metaPartition) Reset() (err error) {
 	mp.inodeTree.Reset()
 	mp.dentryTree.Reset()
+	mp.extentRefs.Rebuild(mp.inodeTree)
 	mp.config.Cursor = 0
 	mp.applyID = 0
+	mp.baseApplyID = 0
+	mp.dirty.reset()
 	// delete ino/dentry applyID file
 	mp.deleteApplyFile()
 	mp.deleteDentryFile()
 	mp.deleteInodeFile()
+	mp.deleteDeltaFiles(math.MaxUint64)
+	if mp.rocks != nil {
+		err = mp.rocks.flush(0, false)
+	}
 	return
 }
@@ -0,0 +1,147 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/tiglabs/containerfs/sdk/master"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// The usage and link changes recorded by a dentry or inode operation belong
+// to inodes which may be kept by other partitions. The leader sends them to
+// the partitions of their inodes in the background.
+
+// asyncSender sends changes to the partitions of their inodes, those of the
+// partition itself are applied through raft with op. The view of the
+// partitions is fetched before the first round, and again after a round
+// which missed a partition.
+type asyncSender struct {
+	mp        *metaPartition
+	name      string
+	op        uint32
+	newPacket func(data []byte) *Packet
+	refresh   bool
+}
+
+func newAsyncSender(mp *metaPartition, name string, op uint32,
+	newPacket func(data []byte) *Packet) *asyncSender {
+	return &asyncSender{mp: mp, name: name, op: op, newPacket: newPacket,
+		refresh: true}
+}
+
+// send sends n changes, change i belongs to inode ino(i). The changes sent
+// to a partition are put in the request built by request, from their
+// indexes in order. It returns the indexes of the changes which are not
+// sent, in order. The changes of a partition which is gone are dropped.
+func (s *asyncSender) send(n int, ino func(i int) uint64,
+	request func(partitionID uint64, indexes []int) interface{}) (failed []int) {
+	mp := s.mp
+	refresh := s.refresh
+	s.refresh = false
+	if refresh {
+		if err := mp.refreshVol(); err != nil {
+			log.LogErrorf("[%s] partition id=%d: %s", s.name,
+				mp.config.PartitionId, err.Error())
+			refresh = false
+			s.refresh = true
+		}
+	}
+	var (
+		local      []int
+		remote     = make(map[uint64][]int)
+		partitions = make(map[uint64]*master.MetaPartitionView)
+	)
+	for i := 0; i < n; i++ {
+		if mp.inRange(ino(i)) {
+			local = append(local, i)
+			continue
+		}
+		view := mp.vol.GetMetaPartition(ino(i))
+		if view == nil {
+			if refresh {
+				// The partition of the inode is gone.
+				log.LogWarnf("[%s] partition id=%d: no partition of"+
+					" inode %d", s.name, mp.config.PartitionId, ino(i))
+				continue
+			}
+			failed = append(failed, i)
+			s.refresh = true
+			continue
+		}
+		remote[view.PartitionID] = append(remote[view.PartitionID], i)
+		partitions[view.PartitionID] = view
+	}
+	if len(local) != 0 {
+		if err := s.put(request(mp.config.PartitionId, local)); err != nil {
+			log.LogErrorf("[%s] partition id=%d: %s", s.name,
+				mp.config.PartitionId, err.Error())
+			failed = append(failed, local...)
+		}
+	}
+	for id, indexes := range remote {
+		if err := s.sendTo(partitions[id], request(id, indexes)); err != nil {
+			log.LogErrorf("[%s] partition id=%d: %s", s.name,
+				mp.config.PartitionId, err.Error())
+			failed = append(failed, indexes...)
+			s.refresh = true
+		}
+	}
+	// The changes of an inode are sent to one partition, so they stay in
+	// order once the failed ones are sorted.
+	sort.Ints(failed)
+	return
+}
+
+func (s *asyncSender) put(req interface{}) (err error) {
+	val, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	_, err = s.mp.Put(s.op, val)
+	return
+}
+
+func (s *asyncSender) sendTo(view *master.MetaPartitionView,
+	req interface{}) (err error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	_, err = s.mp.sendToPartition(view, func() *Packet {
+		return s.newPacket(data)
+	})
+	return
+}
+
+// runAsync calls fn every interval until the partition is stopped, telling
+// if the partition is the leader.
+func (mp *metaPartition) runAsync(interval time.Duration,
+	fn func(isLeader bool)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mp.stopC:
+			return
+		case <-ticker.C:
+			_, isLeader := mp.IsLeader()
+			fn(isLeader)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// preparedOp is a mutation checked like its request, and the item which
+// applies it. The reply is packed by pack with the result of the applied
+// item, or at once if the request is refused, then item is nil. A request
+// sent alone and a sub-operation of a batch are prepared alike.
+type preparedOp struct {
+	item  *MetaItem
+	pack  func(resp interface{})
+	reply *Packet
+}
+
+// putOp proposes the item of the prepared request alone, and packs the
+// reply.
+func (mp *metaPartition) putOp(op *preparedOp) (err error) {
+	if op.item == nil {
+		return
+	}
+	resp, err := mp.Put(op.item.Op, op.item.V)
+	if err != nil {
+		op.reply.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	op.pack(resp)
+	return
+}
+
+// Batch applies the mutations of the request in one raft entry. Each of
+// them is replied as if it were sent alone.
+func (mp *metaPartition) Batch(req *BatchReq, p *Packet) (err error) {
+	if len(req.Items) == 0 || len(req.Items) > proto.MaxBatchItems {
+		p.PackErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	ops := make([]*preparedOp, len(req.Items))
+	items := make([]*MetaItem, 0, len(req.Items))
+	for i := range req.Items {
+		ops[i] = mp.newBatchOp(&req.Items[i])
+		if ops[i].item != nil {
+			items = append(items, ops[i].item)
+		}
+	}
+	if len(items) != 0 {
+		var (
+			val []byte
+			r   interface{}
+		)
+		if val, err = json.Marshal(items); err != nil {
+			p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+			return
+		}
+		if r, err = mp.Put(opFSMBatch, val); err != nil {
+			p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+			return
+		}
+		results := r.([]interface{})
+		i := 0
+		for _, op := range ops {
+			if op.item == nil {
+				continue
+			}
+			if e, ok := results[i].(error); ok {
+				op.reply.PackErrorWithBody(proto.OpErr, []byte(e.Error()))
+			} else {
+				op.pack(results[i])
+			}
+			i++
+		}
+	}
+	resp := &BatchResp{Results: make([]proto.BatchResult, len(ops))}
+	for i, op := range ops {
+		resp.Results[i].ResultCode = op.reply.ResultCode
+		resp.Results[i].Data = op.reply.Data
+	}
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PackOkWithBody(reply)
+	return
+}
+
+// newBatchOp prepares the sub-operation like the request sent alone.
+func (mp *metaPartition) newBatchOp(bi *proto.BatchItem) (op *preparedOp) {
+	p := &Packet{}
+	decode := func(v interface{}) bool {
+		if err := json.Unmarshal(bi.Data, v); err != nil {
+			p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+			return false
+		}
+		return true
+	}
+	switch bi.Op {
+	case proto.OpMetaCreateInode:
+		req := &CreateInoReq{}
+		if decode(req) {
+			return mp.prepareCreateInode(req, p)
+		}
+	case proto.OpMetaDeleteInode:
+		req := &DeleteInoReq{}
+		if decode(req) {
+			return mp.prepareDeleteInode(req, p)
+		}
+	case proto.OpMetaCreateDentry:
+		req := &CreateDentryReq{}
+		if decode(req) {
+			return mp.prepareCreateDentry(req, p)
+		}
+	case proto.OpMetaDeleteDentry:
+		req := &DeleteDentryReq{}
+		if decode(req) {
+			return mp.prepareDeleteDentry(req, p)
+		}
+	case proto.OpMetaSetattr:
+		return mp.prepareSetAttr(bi.Data, p)
+	default:
+		p.PackErrorWithBody(proto.OpArgMismatchErr, []byte(fmt.Sprintf(
+			"operation %v can not be batched", bi.Op)))
+	}
+	return &preparedOp{reply: p}
+}
+
+// applyBatch applies the items of a batch one by one. The result of an
+// item which fails is its error, the others are applied anyway.
+func (mp *metaPartition) applyBatch(data []byte, index uint64) (resp interface{}, err error) {
+	var items []*MetaItem
+	if err = json.Unmarshal(data, &items); err != nil {
+		return
+	}
+	results := make([]interface{}, len(items))
+	for i, item := range items {
+		switch item.Op {
+		case opCreateInode, opDeleteInode, opCreateDentry, opDeleteDentry,
+			opFSMSetAttr, opFSMWormCommit:
+			results[i], err = mp.applyItem(item, index)
+		default:
+			err = fmt.Errorf("operation %v can not be batched", item.Op)
+		}
+		if err != nil {
+			log.LogErrorf("[applyBatch] partition id=%d item %d: %s",
+				mp.config.PartitionId, i, err.Error())
+			results[i] = err
+			err = nil
+		}
+	}
+	resp = results
+	return
+}
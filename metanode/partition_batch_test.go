@@ -0,0 +1,76 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestApplyBatch(t *testing.T) {
+	mp := newTestPartition(t)
+	mode := proto.Mode(os.ModePerm)
+	batchItem := func(op uint8, req interface{}) *proto.BatchItem {
+		data, _ := json.Marshal(req)
+		return &proto.BatchItem{Op: op, Data: data}
+	}
+	ops := []*preparedOp{
+		mp.newBatchOp(batchItem(proto.OpMetaCreateInode, &CreateInoReq{Mode: mode})),
+		mp.newBatchOp(batchItem(proto.OpMetaCreateDentry, &CreateDentryReq{ParentID: 1, Name: "a", Inode: 1, Mode: mode})),
+		mp.newBatchOp(batchItem(proto.OpMetaCreateDentry, &CreateDentryReq{ParentID: 1, Name: "a", Inode: 2, Mode: mode})),
+		mp.newBatchOp(batchItem(proto.OpMetaDeleteDentry, &DeleteDentryReq{ParentID: 1, Name: "b"})),
+		mp.newBatchOp(batchItem(proto.OpMetaReadDir, &ReadDirReq{ParentID: 1})),
+		mp.newBatchOp(batchItem(proto.OpMetaSetattr, &SetattrRequest{Inode: 101, Valid: proto.AttrUid})),
+	}
+	items := make([]*MetaItem, 0, len(ops))
+	for _, op := range ops {
+		if op.item != nil {
+			items = append(items, op.item)
+		}
+	}
+	if len(items) != 4 {
+		t.Fatalf("%v items to apply", len(items))
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := mp.applyBatch(data, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := r.([]interface{})
+	for i, op := range ops[:4] {
+		op.pack(results[i])
+	}
+
+	expect := []uint8{proto.OpOk, proto.OpOk, proto.OpExistErr, proto.OpNotExistErr,
+		proto.OpArgMismatchErr, proto.OpMovedErr}
+	for i, op := range ops {
+		if op.reply.ResultCode != expect[i] {
+			t.Fatalf("item %v result %v", i, op.reply.GetResultMesg())
+		}
+	}
+	resp := &CreateInoResp{}
+	if err = json.Unmarshal(ops[0].reply.Data, resp); err != nil || resp.Info.Inode != 1 {
+		t.Fatalf("create inode reply %s", ops[0].reply.Data)
+	}
+	if mp.inodeTree.Len() != 1 || mp.dentryTree.Len() != 1 {
+		t.Fatalf("%v inodes %v dentries", mp.inodeTree.Len(), mp.dentryTree.Len())
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// The change feed of a partition keeps the changes of the dentries and
+// inodes in the order they are applied, so external consumers can follow
+// them. Every replica records the changes while it applies the raft log,
+// so a consumer may read from any member, and resume from the apply index
+// it stopped at. The changes of an index are read once the index is applied
+// as a whole, a batch records many. The feed is kept in memory for ChangeRetention, at most
+// ChangeMaxCount changes. After a restart the raft log is applied again
+// from the stored apply index, so the feed starts from there, and after a
+// raft snapshot from the index of the snapshot.
+
+const (
+	ChangeRetention = time.Hour
+	ChangeMaxCount  = 100000
+	// DefaultChangesLimit is the number of changes read at most if the
+	// request does not say.
+	DefaultChangesLimit = 1000
+	// MaxChangesWait bounds the wait for a change, below the read deadline
+	// of the clients.
+	MaxChangesWait = 3 * time.Second
+)
+
+// changeFeed keeps the changes from apply index start on.
+type changeFeed struct {
+	sync.Mutex
+	start   uint64
+	applied uint64 // the changes after it are being applied
+	changes []proto.MetaChange
+	notify  chan struct{} // closed when changes are applied
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{start: 1, notify: make(chan struct{})}
+}
+
+// reset drops the changes, the feed starts from apply index start.
+func (f *changeFeed) reset(start uint64) {
+	f.Lock()
+	defer f.Unlock()
+	f.start = start
+	f.applied = start - 1
+	f.changes = nil
+}
+
+func (f *changeFeed) add(c proto.MetaChange) {
+	f.Lock()
+	defer f.Unlock()
+	if c.Index < f.start {
+		return
+	}
+	f.changes = append(f.changes, c)
+	f.trim(c.Time - int64(ChangeRetention/time.Second))
+}
+
+// apply makes the changes up to index readable.
+func (f *changeFeed) apply(index uint64) {
+	f.Lock()
+	defer f.Unlock()
+	if index <= f.applied {
+		return
+	}
+	f.applied = index
+	if n := len(f.changes); n != 0 && f.changes[n-1].Index == index {
+		close(f.notify)
+		f.notify = make(chan struct{})
+	}
+}
+
+// trim drops the changes applied before deadline and those over
+// ChangeMaxCount, all the changes of an index together.
+func (f *changeFeed) trim(deadline int64) {
+	n := 0
+	for n < len(f.changes) && (len(f.changes)-n > ChangeMaxCount ||
+		f.changes[n].Time < deadline) {
+		index := f.changes[n].Index
+		for n < len(f.changes) && f.changes[n].Index == index {
+			n++
+		}
+		f.start = index + 1
+	}
+	if n != 0 {
+		f.changes = f.changes[n:]
+	}
+}
+
+// read returns at most limit changes from apply index from up to the
+// applied index, though all the changes of an index together. If there is
+// none, notify is closed once changes are applied. more tells whether
+// applied changes are left after those read.
+func (f *changeFeed) read(from uint64, limit int) (changes []proto.MetaChange,
+	start, applied uint64, more bool, notify chan struct{}) {
+	f.Lock()
+	defer f.Unlock()
+	start, applied, notify = f.start, f.applied, f.notify
+	if from < f.start {
+		if from != 0 {
+			return
+		}
+		from = f.start
+	}
+	k := sort.Search(len(f.changes), func(k int) bool {
+		return f.changes[k].Index >= from
+	})
+	end := k
+	for end < len(f.changes) && f.changes[end].Index <= f.applied &&
+		(end-k < limit || f.changes[end].Index == f.changes[end-1].Index) {
+		end++
+	}
+	changes = make([]proto.MetaChange, end-k)
+	copy(changes, f.changes[k:end])
+	more = end < len(f.changes) && f.changes[end].Index <= f.applied
+	return
+}
+
+// recordChange adds a change applied at index to the feed.
+func (mp *metaPartition) recordChange(index uint64, c proto.MetaChange) {
+	c.PartitionID = mp.config.PartitionId
+	c.Index = index
+	c.Time = time.Now().Unix()
+	mp.changes.add(c)
+}
+
+// sizeOf returns the size of inode ino, 0 if it does not exist.
+func (mp *metaPartition) sizeOf(ino uint64) uint64 {
+	if i, _ := mp.inodeTree.Get(NewInode(ino, 0)).(*Inode); i != nil {
+		return i.Size
+	}
+	return 0
+}
+
+// recordSize adds a ChangeSize if the size of inode ino is not oldSize.
+func (mp *metaPartition) recordSize(index, ino, oldSize uint64) {
+	if size := mp.sizeOf(ino); size != oldSize {
+		mp.recordChange(index, proto.MetaChange{
+			Type:  proto.ChangeSize,
+			Inode: ino,
+			Size:  size,
+		})
+	}
+}
+
+// readChanges reads the changes of the request, and waits for one up to
+// the wait of the request if there is none.
+func (mp *metaPartition) readChanges(req *ReadChangesReq) (resp *ReadChangesResp) {
+	limit := req.Limit
+	if limit <= 0 || limit > DefaultChangesLimit {
+		limit = DefaultChangesLimit
+	}
+	wait := time.Duration(req.Wait) * time.Millisecond
+	if wait > MaxChangesWait {
+		wait = MaxChangesWait
+	}
+	resp = &ReadChangesResp{}
+	for {
+		changes, start, applied, more, notify := mp.changes.read(req.From, limit)
+		resp.Changes, resp.Start, resp.Next = changes, start, req.From
+		if req.From != 0 && req.From < start {
+			return
+		}
+		if len(changes) != 0 {
+			resp.Next = changes[len(changes)-1].Index + 1
+		}
+		if !more && resp.Next <= applied {
+			resp.Next = applied + 1
+		}
+		if len(changes) != 0 || wait <= 0 {
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-notify:
+			timer.Stop()
+			wait = 0
+			continue
+		case <-timer.C:
+		case <-mp.stopC:
+			timer.Stop()
+		}
+		return
+	}
+}
+
+// ReadChanges replies the changes of the partition from the index of the
+// request. Any member serves it, the feed is kept by every replica.
+func (mp *metaPartition) ReadChanges(req *ReadChangesReq, p *Packet) (err error) {
+	reply, err := json.Marshal(mp.readChanges(req))
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PackOkWithBody(reply)
+	return
+}
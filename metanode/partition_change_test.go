@@ -0,0 +1,87 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestChangeFeed(t *testing.T) {
+	mp := newTestPartition(t)
+	fileMode := proto.Mode(os.ModePerm)
+	mp.createInode(NewInode(1, proto.Mode(os.ModeDir|os.ModePerm)))
+	mp.createInode(NewInode(2, fileMode))
+	apply := func(index uint64, op uint32, val []byte) {
+		if _, err := mp.applyItem(NewMetaItem(op, nil, val), index); err != nil {
+			t.Fatal(err)
+		}
+		mp.uploadApplyID(index)
+	}
+	val, _ := (&Dentry{ParentId: 1, Name: "a", Inode: 2, Type: fileMode}).Marshal()
+	apply(1, opCreateDentry, val)
+	val, _ = json.Marshal(&InlineWriteReq{Inode: 2, Data: make([]byte, 10)})
+	apply(2, opFSMInlineWrite, val)
+	val, _ = (&Dentry{ParentId: 1, Name: "a"}).Marshal()
+	apply(3, opDeleteDentry, val)
+
+	resp := mp.readChanges(&ReadChangesReq{})
+	types := []uint8{proto.ChangeCreate, proto.ChangeSize, proto.ChangeDelete}
+	if len(resp.Changes) != len(types) || resp.Next != 4 {
+		t.Fatalf("changes %v next %v", resp.Changes, resp.Next)
+	}
+	for i, c := range resp.Changes {
+		if c.Type != types[i] || c.Index != uint64(i+1) || c.Inode != 2 {
+			t.Fatalf("change %d: %v", i, c)
+		}
+	}
+	if c := resp.Changes[1]; c.Size != 10 {
+		t.Fatalf("size change %v", c)
+	}
+
+	resp = mp.readChanges(&ReadChangesReq{From: 2, Limit: 1})
+	if len(resp.Changes) != 1 || resp.Changes[0].Index != 2 || resp.Next != 3 {
+		t.Fatalf("limited changes %v next %v", resp.Changes, resp.Next)
+	}
+	resp = mp.readChanges(&ReadChangesReq{From: 4, Wait: 10})
+	if len(resp.Changes) != 0 || resp.Next != 4 {
+		t.Fatalf("changes after the end %v next %v", resp.Changes, resp.Next)
+	}
+
+	// The changes of an index being applied are not read yet.
+	val, _ = (&Dentry{ParentId: 1, Name: "b", Inode: 2, Type: fileMode}).Marshal()
+	if _, err := mp.applyItem(NewMetaItem(opCreateDentry, nil, val), 4); err != nil {
+		t.Fatal(err)
+	}
+	resp = mp.readChanges(&ReadChangesReq{From: 4})
+	if len(resp.Changes) != 0 || resp.Next != 4 {
+		t.Fatalf("changes being applied %v next %v", resp.Changes, resp.Next)
+	}
+	mp.uploadApplyID(4)
+	resp = mp.readChanges(&ReadChangesReq{From: 4})
+	if len(resp.Changes) != 1 || resp.Next != 5 {
+		t.Fatalf("applied changes %v next %v", resp.Changes, resp.Next)
+	}
+
+	// The feed restarts from a raft snapshot.
+	mp.changes.reset(10)
+	resp = mp.readChanges(&ReadChangesReq{From: 4})
+	if len(resp.Changes) != 0 || resp.Start != 10 {
+		t.Fatalf("expired changes %v start %v", resp.Changes, resp.Start)
+	}
+}
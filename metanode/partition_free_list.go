@@ -15,10 +15,9 @@
 package metanode
 
 import (
-	"encoding/json"
-	"fmt"
 	"github.com/juju/errors"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/util/log"
 	"runtime"
 	"time"
@@ -36,40 +35,43 @@ func (mp *metaPartition) startFreeList() {
 
 	go mp.deleteWorker()
 	go mp.checkFreelistWorker()
+	go mp.punchWorker()
 }
 
 func (mp *metaPartition) updateVolWorker() {
 	t := time.NewTicker(UpdateVolTicket)
-	reqURL := fmt.Sprintf("%s?name=%s", DataPartitionViewUrl, mp.config.VolName)
+	// The dataPartitions are needed at once by the inodes left to free.
+	mp.updateVol()
 	for {
 		select {
 		case <-mp.stopC:
 			t.Stop()
 			return
 		case <-t.C:
-			// Get dataPartitionView
-			respBody, err := postToMaster("GET", reqURL, nil)
-			if err != nil {
-				log.LogErrorf("[updateVol] %s", err.Error())
-				break
-			}
-			dataView := new(DataPartitionsView)
-			if err = json.Unmarshal(respBody, dataView); err != nil {
-				log.LogErrorf("[updateVol] %s", err.Error())
-				break
-			}
-			mp.vol.UpdatePartitions(dataView)
-			log.LogDebugf("[updateVol] %v", dataView)
+			mp.updateVol()
 		}
 	}
 }
 
+func (mp *metaPartition) updateVol() {
+	// Get dataPartitionView
+	req := &master.VolRequest{Name: mp.config.VolName}
+	dataView, err := masterClient.GetDataPartitions(req)
+	if err != nil {
+		log.LogErrorf("[updateVol] %s", err.Error())
+		return
+	}
+	mp.vol.UpdatePartitions(dataView)
+	log.LogDebugf("[updateVol] %v", dataView)
+}
+
 func (mp *metaPartition) deleteWorker() {
 	var (
 		idx      int
 		isLeader bool
 	)
 	buffSlice := make([]*Inode, 0, BatchCounts)
+	deferred := make([]*Inode, 0, BatchCounts)
 Begin:
 	time.Sleep(AsyncDeleteInterval)
 	for {
@@ -80,15 +82,38 @@ Begin:
 		default:
 		}
 		if _, isLeader = mp.IsLeader(); !isLeader {
+			// The failures are retried at once by a new leader.
+			mp.reclaims.reset()
 			goto Begin
 		}
+		now := time.Now()
+		deferred = deferred[:0]
 		for idx = 0; idx < BatchCounts; idx++ {
 			// batch get free inode from freeList
 			ino := mp.freeList.Pop()
 			if ino == nil {
 				break
 			}
-			buffSlice = append(buffSlice, ino)
+			// Inodes moved away by a split are freed by their new
+			// partition.
+			if !mp.inRange(ino.Inode) {
+				continue
+			}
+			// The extents released so far are dropped from the inode
+			// of the tree.
+			cur, _ := mp.inodeTree.Get(ino).(*Inode)
+			if cur == nil || cur.MarkDelete != 1 {
+				mp.reclaims.forget(ino.Inode)
+				continue
+			}
+			if !mp.reclaims.due(cur.Inode, now) {
+				deferred = append(deferred, cur)
+				continue
+			}
+			buffSlice = append(buffSlice, cur)
+		}
+		for _, ino := range deferred {
+			mp.freeList.Push(ino)
 		}
 		if len(buffSlice) == 0 {
 			goto Begin
@@ -138,63 +163,111 @@ func (mp *metaPartition) checkFreelistWorker() {
 	}
 }
 
-func (mp *metaPartition) deleteDataPartitionMark(inoSlice []*Inode) {
-	stepFunc := func(ext proto.ExtentKey) (err error) {
-		// get dataNode View
-		dp := mp.vol.GetPartition(ext.PartitionId)
-		if dp == nil {
-			err = errors.Errorf("unknown dataPartitionID=%d in vol",
-				ext.PartitionId)
-			return
-		}
-		// delete dataNode
-		conn, err := mp.config.ConnPool.Get(dp.Hosts[0])
-		if err != nil {
-			mp.config.ConnPool.Put(conn, ForceCloseConnect)
-			err = errors.Errorf("get conn from pool %s, "+
-				"extents partitionId=%d, extentId=%d",
-				err.Error(), ext.PartitionId, ext.ExtentId)
-			return
-		}
-		p := NewExtentDeletePacket(dp, ext.ExtentId)
-		if err = p.WriteToConn(conn); err != nil {
-			mp.config.ConnPool.Put(conn, ForceCloseConnect)
-			err = errors.Errorf("write to dataNode %s, %s", p.GetUniqueLogId(),
-				err.Error())
-			return
-		}
-		if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
-			mp.config.ConnPool.Put(conn, ForceCloseConnect)
-			err = errors.Errorf("read response from dataNode %s, %s",
-				p.GetUniqueLogId(), err.Error())
-			return
-		}
-		log.LogDebugf("[deleteDataPartitionMark] %v", p.GetUniqueLogId())
-		mp.config.ConnPool.Put(conn, NoCloseConnect)
+// deleteExtent deletes the extent on the leader of its dataPartition.
+func (mp *metaPartition) deleteExtent(ext proto.ExtentKey) (err error) {
+	// get dataNode View
+	dp := mp.vol.GetPartition(ext.PartitionId)
+	if dp == nil {
+		err = errors.Errorf("unknown dataPartitionID=%d in vol",
+			ext.PartitionId)
+		return
+	}
+	// delete dataNode
+	conn, err := mp.config.ConnPool.Get(dp.Hosts[0])
+	if err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		err = errors.Errorf("get conn from pool %s, "+
+			"extents partitionId=%d, extentId=%d",
+			err.Error(), ext.PartitionId, ext.ExtentId)
+		return
+	}
+	p := NewExtentDeletePacket(dp, ext.ExtentId)
+	if err = p.WriteToConn(conn); err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		err = errors.Errorf("write to dataNode %s, %s", p.GetUniqueLogId(),
+			err.Error())
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		err = errors.Errorf("read response from dataNode %s, %s",
+			p.GetUniqueLogId(), err.Error())
+		return
+	}
+	mp.config.ConnPool.Put(conn, NoCloseConnect)
+	if p.ResultCode != proto.OpOk {
+		err = errors.Errorf("dataNode %s result %s", p.GetUniqueLogId(),
+			p.GetResultMesg())
 		return
 	}
+	log.LogDebugf("[deleteDataPartitionMark] %v", p.GetUniqueLogId())
+	return
+}
+
+func (mp *metaPartition) deleteDataPartitionMark(inoSlice []*Inode) {
 	shouldCommit := make([]*Inode, 0, BatchCounts)
-	var err error
+	var (
+		reclaimed []reclaimItem
+		failed    []*Inode
+	)
+	// Extents shared with other inodes are kept on the dataNode, the
+	// reference is dropped when the inode is deleted. released counts the
+	// references dropped by this batch, so the last one deletes the extent.
+	released := make(map[extentID]uint32)
 	for _, ino := range inoSlice {
-		var reExt []proto.ExtentKey
+		var (
+			done     []proto.ExtentKey
+			firstErr error
+		)
+		visited := make(map[extentID]struct{})
 		ino.Extents.Range(func(i int, v proto.ExtentKey) bool {
-			if err = stepFunc(v); err != nil {
-				reExt = append(reExt, v)
+			if v.IsHole() {
+				return true
+			}
+			id := newExtentID(v)
+			if _, ok := visited[id]; ok {
+				return true
+			}
+			visited[id] = struct{}{}
+			if refs := mp.extentRefs.Get(v); refs > released[id]+1 {
+				released[id]++
+				done = append(done, v)
+				log.LogDebugf("[deleteDataPartitionMark] ino(%v) skip shared "+
+					"extentKey: %s, refs(%v)", ino.Inode, v.String(), refs)
+				return true
+			}
+			if err := mp.deleteExtent(v); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
 				log.LogWarnf("[deleteDataPartitionMark] extentKey: %s, "+
 					"err: %s", v.String(), err.Error())
+				return true
 			}
+			done = append(done, v)
 			return true
 		})
-		if len(reExt) == 0 {
+		if firstErr == nil {
 			shouldCommit = append(shouldCommit, ino)
-		} else {
-			newIno := NewInode(ino.Inode, ino.Type)
-			for _, ext := range reExt {
-				newIno.Extents.Put(ext)
-			}
-			mp.freeList.Push(newIno)
+			continue
+		}
+		// Keep the progress, so only the extents left are deleted by the
+		// next attempt, whichever the leader is then.
+		if len(done) != 0 {
+			reclaimed = append(reclaimed, reclaimItem{Inode: ino.Inode, Extents: done})
+		}
+		mp.reclaims.fail(ino.Inode, firstErr, time.Now())
+		failed = append(failed, ino)
+	}
+	if len(reclaimed) > 0 {
+		if err := mp.putReclaim(reclaimed); err != nil {
+			log.LogWarnf("[deleteDataPartitionMark] raft commit reclaimed "+
+				"extents of %v inodes: %s", len(reclaimed), err.Error())
 		}
 	}
+	for _, ino := range failed {
+		mp.freeList.Push(ino)
+	}
 	if len(shouldCommit) > 0 {
 		bufSlice := make([]byte, 0, 8*len(shouldCommit))
 		for _, ino := range shouldCommit {
@@ -208,8 +281,66 @@ func (mp *metaPartition) deleteDataPartitionMark(inoSlice []*Inode) {
 			}
 			log.LogWarnf("[deleteInodeTree] raft commit inode list: %v, "+
 				"response %s", shouldCommit, err.Error())
+			return
+		}
+		for _, ino := range shouldCommit {
+			mp.reclaims.forget(ino.Inode)
 		}
 		log.LogDebugf("[deleteInodeTree] inode list: %v", shouldCommit)
 	}
+}
+
+// punchDataPartitionHole releases the space of extent pieces which are
+// punched out of an inode. It returns the first failure, after trying all
+// of the pieces.
+func (mp *metaPartition) punchDataPartitionHole(pieces []proto.ExtentKey) (err error) {
+	for _, ext := range pieces {
+		if e := mp.punchExtent(ext); e != nil {
+			log.LogWarnf("[punchDataPartitionHole] extentKey: %s, err: %s",
+				ext.String(), e.Error())
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return
+}
 
+// punchExtent releases the space of a piece of extent on the leader of its
+// dataPartition.
+func (mp *metaPartition) punchExtent(ext proto.ExtentKey) (err error) {
+	dp := mp.vol.GetPartition(ext.PartitionId)
+	if dp == nil {
+		err = errors.Errorf("unknown dataPartitionID=%d in vol",
+			ext.PartitionId)
+		return
+	}
+	conn, err := mp.config.ConnPool.Get(dp.Hosts[0])
+	if err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		err = errors.Errorf("get conn from pool %s, extentKey: %s",
+			err.Error(), ext.String())
+		return
+	}
+	p := NewExtentPunchPacket(dp, ext)
+	if err = p.WriteToConn(conn); err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		err = errors.Errorf("write to dataNode %s, %s", p.GetUniqueLogId(),
+			err.Error())
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		err = errors.Errorf("read response from dataNode %s, %s",
+			p.GetUniqueLogId(), err.Error())
+		return
+	}
+	mp.config.ConnPool.Put(conn, NoCloseConnect)
+	if p.ResultCode != proto.OpOk {
+		err = errors.Errorf("dataNode %s result %s", p.GetUniqueLogId(),
+			p.GetResultMesg())
+		return
+	}
+	log.LogDebugf("[punchDataPartitionHole] %v", p.GetUniqueLogId())
+	return
 }
@@ -37,12 +37,26 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 	if err = msg.UnmarshalJson(command); err != nil {
 		return
 	}
+	if resp, err = mp.applyItem(msg, index); err != nil || mp.rocks == nil {
+		return
+	}
+	// The item may be applied on a missing item, if the trees failed to be
+	// read.
+	err = mp.rocks.Err()
+	return
+}
+
+func (mp *metaPartition) applyItem(msg *MetaItem, index uint64) (resp interface{}, err error) {
 	switch msg.Op {
 	case opCreateInode:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
+		if !mp.inRange(ino.Inode) {
+			resp = proto.OpAgain
+			break
+		}
 		if mp.config.Cursor < ino.Inode {
 			mp.config.Cursor = ino.Inode
 		}
@@ -58,7 +72,9 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
+		oldSize := mp.sizeOf(ino.Inode)
 		resp = mp.extentsTruncate(ino)
+		mp.recordSize(index, ino.Inode, oldSize)
 	case opFSMCreateLinkInode:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
@@ -77,25 +93,92 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 		if err != nil {
 			return
 		}
-		err = mp.setAttr(req)
+		status := mp.setAttr(req)
+		if status == proto.OpOk {
+			mp.recordChange(index, proto.MetaChange{
+				Type:  proto.ChangeSetattr,
+				Inode: req.Inode,
+				Valid: req.Valid,
+			})
+		}
+		resp = status
+	case opFSMPunchHole:
+		req := &PunchHoleReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.punchHole(req)
+	case opFSMExtentsClone:
+		req := &CloneExtentsReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		oldSize := mp.sizeOf(req.DstInode)
+		resp = mp.cloneExtents(req)
+		mp.recordSize(index, req.DstInode, oldSize)
+	case opFSMWormCommit:
+		ino := NewInode(0, 0)
+		if err = ino.Unmarshal(msg.V); err != nil {
+			return
+		}
+		resp = mp.wormCommit(ino)
+	case opFSMInlineWrite:
+		req := &InlineWriteReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		oldSize := mp.sizeOf(req.Inode)
+		resp = mp.inlineWrite(req)
+		mp.recordSize(index, req.Inode, oldSize)
 	case opCreateDentry:
 		den := &Dentry{}
 		if err = den.Unmarshal(msg.V); err != nil {
 			return
 		}
-		resp = mp.createDentry(den)
+		status := mp.createDentry(den)
+		if status == proto.OpOk {
+			mp.recordChange(index, proto.MetaChange{
+				Type:   proto.ChangeCreate,
+				Inode:  den.Inode,
+				Parent: den.ParentId,
+				Name:   den.Name,
+				Mode:   den.Type,
+			})
+		}
+		resp = status
 	case opDeleteDentry:
 		den := &Dentry{}
 		if err = den.Unmarshal(msg.V); err != nil {
 			return
 		}
-		resp = mp.deleteDentry(den)
+		r := mp.deleteDentry(den)
+		if r.Status == proto.OpOk {
+			mp.recordChange(index, proto.MetaChange{
+				Type:   proto.ChangeDelete,
+				Inode:  r.Msg.Inode,
+				Parent: den.ParentId,
+				Name:   den.Name,
+				Mode:   r.Msg.Type,
+			})
+		}
+		resp = r
 	case opUpdateDentry:
 		den := &Dentry{}
 		if err = den.Unmarshal(msg.V); err != nil {
 			return
 		}
-		resp = mp.updateDentry(den)
+		inode := den.Inode
+		r := mp.updateDentry(den)
+		if r.Status == proto.OpOk {
+			mp.recordChange(index, proto.MetaChange{
+				Type:     proto.ChangeRename,
+				Inode:    inode,
+				Parent:   den.ParentId,
+				Name:     den.Name,
+				OldInode: r.Msg.Inode,
+			})
+		}
+		resp = r
 	case opOpen:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
@@ -115,17 +198,81 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
+		oldSize := mp.sizeOf(ino.Inode)
 		resp = mp.appendExtents(ino)
+		mp.recordSize(index, ino.Inode, oldSize)
 	case opStoreTick:
+		if mp.rocks != nil {
+			mp.dirty.reset()
+			if err = mp.rocks.flush(index, false); err != nil {
+				log.LogErrorf("[Apply] partition id=%d: %s",
+					mp.config.PartitionId, err.Error())
+				err = nil
+				break
+			}
+			mp.storeChan <- &storeMsg{
+				command:    opStoreTick,
+				applyIndex: index,
+			}
+			break
+		}
 		msg := &storeMsg{
 			command:    opStoreTick,
 			applyIndex: index,
 			inodeTree:  mp.getInodeTree(),
 			dentryTree: mp.getDentryTree(),
+			dirty:      mp.dirty.swap(),
 		}
+		msg.links, _ = mp.links.marshal()
 		mp.storeChan <- msg
 	case opFSMInternalDeleteInode:
 		err = mp.internalDelete(msg.V)
+	case opFSMImportItems:
+		req := &ImportItemsReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp, err = mp.importItems(req)
+	case opFSMDeleteRange:
+		if len(msg.V) != 8 {
+			err = fmt.Errorf("delete range: invalid start %v", msg.V)
+			return
+		}
+		resp = mp.deleteRange(binary.BigEndian.Uint64(msg.V))
+	case opFSMBatch:
+		resp, err = mp.applyBatch(msg.V, index)
+	case opFSMUpdateUsage:
+		req := &UpdateUsageReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.applyUsage(req)
+	case opFSMUpdateLinks:
+		req := &UpdateLinksReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.applyLinks(req)
+	case opFSMLinksSent:
+		req := &linkSentReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.linksSent(req)
+	case opFSMBackfillLinks:
+		resp = mp.backfillLinks()
+	case opFSMReclaimExtents:
+		var items []reclaimItem
+		if err = json.Unmarshal(msg.V, &items); err != nil {
+			return
+		}
+		resp = mp.reclaimExtents(items)
+	case opFSMPunchReleased:
+		var items []reclaimItem
+		if err = json.Unmarshal(msg.V, &items); err != nil {
+			return
+		}
+		resp = mp.punchReleased(items)
 	}
 	return
 }
@@ -169,7 +316,8 @@ func (mp *metaPartition) Snapshot() (raftproto.Snapshot, error) {
 	applyID := mp.applyID
 	ino := mp.getInodeTree()
 	dentry := mp.getDentryTree()
-	snapIter := NewMetaItemIterator(applyID, ino, dentry)
+	links, _ := mp.links.marshal()
+	snapIter := NewMetaItemIterator(applyID, ino, dentry, links)
 	return snapIter, nil
 }
 
@@ -180,28 +328,70 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer,
 		index      int
 		appIndexID uint64
 		cursor     uint64
-		inodeTree  = NewBtree()
-		dentryTree = NewBtree()
+		restored   int
+		inodeTree  MetaTree = NewBtree()
+		dentryTree MetaTree = NewBtree()
+		links      []byte
 	)
 	defer func() {
+		if err == io.EOF {
+			// Snapshots without the pending link changes start the
+			// backfill over.
+			mp.links.reset()
+			if links != nil {
+				if err = mp.links.unmarshal(links); err == nil {
+					err = io.EOF
+				}
+			}
+			links, _ = mp.links.marshal()
+		}
+		if err == io.EOF && mp.rocks != nil {
+			// The counts are stored with the restored items.
+			mp.extentRefs.Rebuild(inodeTree)
+			if err = mp.rocks.flush(appIndexID, false); err == nil {
+				err = io.EOF
+			}
+		}
 		if err == io.EOF {
 			mp.applyID = appIndexID
 			mp.inodeTree = inodeTree
 			mp.dentryTree = dentryTree
+			if mp.rocks == nil {
+				mp.extentRefs.Rebuild(inodeTree)
+			}
 			mp.config.Cursor = cursor
+			mp.dirty.reset()
+			mp.changes.reset(appIndexID + 1)
+			mp.rebuildFreeList()
+			mp.worm.reset()
+			mp.punches.reset()
 			err = nil
 			// store message
-			mp.storeChan <- &storeMsg{
-				command:    opStoreTick,
-				applyIndex: mp.applyID,
-				inodeTree:  mp.inodeTree,
-				dentryTree: mp.dentryTree,
+			if mp.rocks == nil {
+				mp.storeChan <- &storeMsg{
+					command:    opStoreTick,
+					applyIndex: mp.applyID,
+					inodeTree:  mp.getInodeTree(),
+					dentryTree: mp.getDentryTree(),
+					links:      links,
+					full:       true,
+				}
 			}
 			log.LogDebugf("[ApplySnapshot] successful.")
 			return
 		}
 		log.LogErrorf("[ApplySnapshot]: %s", err.Error())
 	}()
+	if mp.rocks != nil {
+		// The items are written to rocksdb while they arrive, the
+		// partition is marked as restoring until all have been stored.
+		mp.inodeTree.Reset()
+		mp.dentryTree.Reset()
+		if err = mp.rocks.flush(0, true); err != nil {
+			return
+		}
+		inodeTree, dentryTree = mp.inodeTree, mp.dentryTree
+	}
 	for {
 		data, err = iter.Next()
 		if err != nil {
@@ -232,10 +422,17 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer,
 			dentry.UnmarshalValue(snap.V)
 			dentryTree.ReplaceOrInsert(dentry, true)
 			log.LogDebugf("action[ApplySnapshot] create dentry[%v].", dentry)
+		case opSnapLinks:
+			links = snap.V
 		default:
 			err = fmt.Errorf("unknown op=%d", snap.Op)
 			return
 		}
+		if restored++; mp.rocks != nil && restored%rocksRestoreBatch == 0 {
+			if err = mp.rocks.flush(0, true); err != nil {
+				return
+			}
+		}
 	}
 }
 
@@ -291,4 +488,5 @@ func (mp *metaPartition) Del(key interface{}) (interface{}, error) {
 
 func (mp *metaPartition) uploadApplyID(applyId uint64) {
 	atomic.StoreUint64(&mp.applyID, applyId)
+	mp.changes.apply(applyId)
 }
@@ -56,12 +56,17 @@ func (mp *metaPartition) initInode(ino *Inode) {
 }
 
 func (mp *metaPartition) openFile(ino *Inode) (status uint8) {
+	if !mp.inRange(ino.Inode) {
+		status = proto.OpAgain
+		return
+	}
 	item := mp.inodeTree.Get(ino)
 	if item == nil {
 		status = proto.OpNotExistErr
 		return
 	}
 	item.(*Inode).AccessTime = ino.AccessTime
+	mp.dirty.markInode(ino.Inode)
 	status = proto.OpOk
 	return
 }
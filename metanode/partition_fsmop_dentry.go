@@ -32,9 +32,27 @@ func NewResponseDentry() *ResponseDentry {
 // CreateDentry insert dentry into dentry tree.
 func (mp *metaPartition) createDentry(dentry *Dentry) (status uint8) {
 	status = proto.OpOk
+	if !mp.inRange(dentry.ParentId) {
+		status = proto.OpAgain
+		return
+	}
+	// The new dentries of a sharded directory are kept in its shards.
+	parent, _ := mp.inodeTree.Get(NewInode(dentry.ParentId, 0)).(*Inode)
+	if parent != nil && parent.IsSharded() {
+		status = proto.OpShardedErr
+		return
+	}
 	if _, ok := mp.dentryTree.ReplaceOrInsert(dentry, false); !ok {
 		status = proto.OpExistErr
+		return
+	}
+	mp.dirty.markDentry(dentry)
+	if parent != nil {
+		parent.Entries++
+		mp.dirty.markInode(parent.Inode)
 	}
+	mp.addUsage(dentry.ParentId, entryUsage(dentry.Type, 1))
+	mp.addLink(dentry.Inode, dentry.ParentId, dentry.Name, false)
 	return
 }
 
@@ -54,18 +72,34 @@ func (mp *metaPartition) getDentry(dentry *Dentry) (*Dentry, uint8) {
 func (mp *metaPartition) deleteDentry(dentry *Dentry) (resp *ResponseDentry) {
 	resp = NewResponseDentry()
 	resp.Status = proto.OpOk
+	if !mp.inRange(dentry.ParentId) {
+		resp.Status = proto.OpAgain
+		return
+	}
 	item := mp.dentryTree.Delete(dentry)
 	if item == nil {
 		resp.Status = proto.OpNotExistErr
 		return
 	}
 	resp.Msg = item.(*Dentry)
+	mp.dirty.markDentry(resp.Msg)
+	parent, _ := mp.inodeTree.Get(NewInode(dentry.ParentId, 0)).(*Inode)
+	if parent != nil && parent.Entries > 0 {
+		parent.Entries--
+		mp.dirty.markInode(parent.Inode)
+	}
+	mp.addUsage(dentry.ParentId, entryUsage(resp.Msg.Type, -1))
+	mp.addLink(resp.Msg.Inode, dentry.ParentId, dentry.Name, true)
 	return
 }
 
 func (mp *metaPartition) updateDentry(dentry *Dentry) (resp *ResponseDentry) {
 	resp = NewResponseDentry()
 	resp.Status = proto.OpOk
+	if !mp.inRange(dentry.ParentId) {
+		resp.Status = proto.OpAgain
+		return
+	}
 	item := mp.dentryTree.Get(dentry)
 	if item == nil {
 		resp.Status = proto.OpNotExistErr
@@ -73,11 +107,14 @@ func (mp *metaPartition) updateDentry(dentry *Dentry) (resp *ResponseDentry) {
 	}
 	d := item.(*Dentry)
 	d.Inode, dentry.Inode = dentry.Inode, d.Inode
+	mp.dirty.markDentry(d)
+	mp.addLink(dentry.Inode, d.ParentId, d.Name, true)
+	mp.addLink(d.Inode, d.ParentId, d.Name, false)
 	resp.Msg = dentry
 	return
 }
 
-func (mp *metaPartition) getDentryTree() *BTree {
+func (mp *metaPartition) getDentryTree() MetaTree {
 	return mp.dentryTree.GetTree()
 }
 
@@ -98,5 +135,16 @@ func (mp *metaPartition) readDir(req *ReadDirReq) (resp *ReadDirResp) {
 		})
 		return true
 	})
+	resp.Shards = mp.dirShards(req.ParentID)
 	return
 }
+
+// dirShards returns the shard directories of directory ino, nil if it is
+// not sharded.
+func (mp *metaPartition) dirShards(ino uint64) []uint64 {
+	item := mp.inodeTree.Get(NewInode(ino, 0))
+	if item == nil {
+		return nil
+	}
+	return item.(*Inode).Shards
+}
@@ -38,13 +38,20 @@ func (mp *metaPartition) createInode(ino *Inode) (status uint8) {
 	status = proto.OpOk
 	if _, ok := mp.inodeTree.ReplaceOrInsert(ino, false); !ok {
 		status = proto.OpExistErr
+		return
 	}
+	mp.dirty.markInode(ino.Inode)
+	mp.worm.add(ino)
 	return
 }
 
 func (mp *metaPartition) createLinkInode(ino *Inode) (resp *ResponseInode) {
 	resp = NewResponseInode()
 	resp.Status = proto.OpOk
+	if !mp.inRange(ino.Inode) {
+		resp.Status = proto.OpAgain
+		return
+	}
 	item := mp.inodeTree.Get(ino)
 	if item == nil {
 		resp.Status = proto.OpNotExistErr
@@ -59,7 +66,12 @@ func (mp *metaPartition) createLinkInode(ino *Inode) (resp *ResponseInode) {
 		resp.Status = proto.OpNotExistErr
 		return
 	}
+	if i.IsImmutable() || i.IsAppendOnly() || i.IsWormCommitted() {
+		resp.Status = proto.OpNotPermErr
+		return
+	}
 	i.NLink++
+	mp.dirty.markInode(i.Inode)
 	resp.Msg = i
 	return
 }
@@ -101,7 +113,7 @@ func (mp *metaPartition) internalHasInode(ino *Inode) bool {
 	return mp.inodeTree.Has(ino)
 }
 
-func (mp *metaPartition) getInodeTree() *BTree {
+func (mp *metaPartition) getInodeTree() MetaTree {
 	return mp.inodeTree.GetTree()
 }
 
@@ -113,14 +125,29 @@ func (mp *metaPartition) RangeInode(f func(i btree.Item) bool) {
 func (mp *metaPartition) deleteInode(ino *Inode) (resp *ResponseInode) {
 	resp = NewResponseInode()
 	resp.Status = proto.OpOk
+	if !mp.inRange(ino.Inode) {
+		resp.Status = proto.OpAgain
+		return
+	}
 	isFind := false
 	isDelete := false
 	mp.inodeTree.Find(ino, func(i BtreeItem) {
 		isFind = true
 		inode := i.(*Inode)
 		resp.Msg = inode
+		if inode.IsImmutable() || inode.IsAppendOnly() {
+			resp.Status = proto.OpNotPermErr
+			return
+		}
+		// The leader's time of the request decides whether the
+		// retention is over.
+		if inode.IsRetained(ino.ModifyTime) {
+			resp.Status = proto.OpNotPermErr
+			return
+		}
 		if proto.IsRegular(inode.Type) {
 			inode.NLink--
+			mp.dirty.markInode(inode.Inode)
 			return
 		}
 		// should delete inode
@@ -132,6 +159,7 @@ func (mp *metaPartition) deleteInode(ino *Inode) (resp *ResponseInode) {
 	}
 	if isDelete {
 		mp.inodeTree.Delete(ino)
+		mp.dirty.markInode(ino.Inode)
 	}
 	return
 }
@@ -156,13 +184,20 @@ func (mp *metaPartition) internalDelete(val []byte) (err error) {
 }
 
 func (mp *metaPartition) internalDeleteInode(ino *Inode) {
-	mp.inodeTree.Delete(ino)
+	if item := mp.inodeTree.Delete(ino); item != nil {
+		mp.extentRefs.Unref(item.(*Inode))
+		mp.dirty.markInode(ino.Inode)
+	}
 	return
 }
 
 func (mp *metaPartition) appendExtents(ino *Inode) (status uint8) {
 	exts := ino.Extents
 	status = proto.OpOk
+	if !mp.inRange(ino.Inode) {
+		status = proto.OpAgain
+		return
+	}
 	item := mp.inodeTree.Get(ino)
 	if item == nil {
 		status = proto.OpNotExistErr
@@ -173,19 +208,31 @@ func (mp *metaPartition) appendExtents(ino *Inode) (status uint8) {
 		status = proto.OpNotExistErr
 		return
 	}
-	modifyTime := ino.ModifyTime
+	if ino.IsImmutable() || ino.IsWormCommitted() {
+		status = proto.OpNotPermErr
+		return
+	}
+	modifyTime, size := ino.ModifyTime, ino.Size
 	exts.Range(func(i int, ext proto.ExtentKey) bool {
 		ino.AppendExtents(ext)
 		return true
 	})
+	// The inline body has been moved to the first extent by the client.
+	ino.Inline = nil
 	ino.ModifyTime = modifyTime
 	ino.Generation++
+	mp.dirty.markInode(ino.Inode)
+	mp.addBytes(ino, size)
 	return
 }
 
 func (mp *metaPartition) extentsTruncate(ino *Inode) (resp *ResponseInode) {
 	resp = NewResponseInode()
 	resp.Status = proto.OpOk
+	if !mp.inRange(ino.Inode) {
+		resp.Status = proto.OpAgain
+		return
+	}
 	isFind := false
 	var markIno *Inode
 	mp.inodeTree.Find(ino, func(item BtreeItem) {
@@ -199,11 +246,22 @@ func (mp *metaPartition) extentsTruncate(ino *Inode) (resp *ResponseInode) {
 			resp.Status = proto.OpNotExistErr
 			return
 		}
+		if i.IsImmutable() || i.IsAppendOnly() || i.IsWormCommitted() {
+			resp.Status = proto.OpNotPermErr
+			return
+		}
 		ino.Extents = i.Extents
+		size := i.Size
 		i.Size = 0
+		i.Inline = nil
 		i.ModifyTime = ino.ModifyTime
 		i.Generation++
 		i.Extents = proto.NewStreamKey(i.Inode)
+		// The extents of the punched pieces are released whole with
+		// markIno.
+		i.Punched = nil
+		mp.dirty.markInode(i.Inode)
+		mp.addBytes(i, size)
 		markIno = NewInode(binary.BigEndian.Uint64(ino.LinkTarget), i.Type)
 		markIno.MarkDelete = 1
 		markIno.Extents = ino.Extents
@@ -216,14 +274,296 @@ func (mp *metaPartition) extentsTruncate(ino *Inode) (resp *ResponseInode) {
 	// mark Delete and push to freeList
 	if markIno != nil {
 		mp.inodeTree.ReplaceOrInsert(markIno, false)
+		mp.dirty.markInode(markIno.Inode)
 		mp.freeList.Push(markIno)
 	}
 	return
 }
 
+// punchHole replaces a range of file data with a hole. The pieces of
+// extents released by the hole are kept with the inode until their space is
+// released on the dataNodes, the returned inode carries them.
+func (mp *metaPartition) punchHole(req *PunchHoleReq) (resp *ResponseInode) {
+	resp = NewResponseInode()
+	resp.Status = proto.OpOk
+	if !mp.inRange(req.Inode) {
+		resp.Status = proto.OpAgain
+		return
+	}
+	item := mp.inodeTree.Get(NewInode(req.Inode, 0))
+	if item == nil {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	ino := item.(*Inode)
+	if proto.IsDir(ino.Type) {
+		resp.Status = proto.OpArgMismatchErr
+		return
+	}
+	if ino.MarkDelete == 1 {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	if ino.IsImmutable() || ino.IsAppendOnly() || ino.IsWormCommitted() {
+		resp.Status = proto.OpNotPermErr
+		return
+	}
+	resp.Msg.Inode = ino.Inode
+	if end := req.Offset + req.Size; req.Offset < uint64(len(ino.Inline)) {
+		if end > uint64(len(ino.Inline)) {
+			end = uint64(len(ino.Inline))
+		}
+		// Never modify the inline body in place, it may be referenced by
+		// a pending reply.
+		inline := make([]byte, len(ino.Inline))
+		copy(inline, ino.Inline)
+		for i := req.Offset; i < end; i++ {
+			inline[i] = 0
+		}
+		ino.Inline = inline
+	}
+	freed := ino.Extents.Punch(req.Offset, req.Size)
+	ino.Generation++
+	mp.dirty.markInode(ino.Inode)
+	release, unref := mp.releasedPieces(ino, freed)
+	for _, ek := range unref {
+		mp.extentRefs.UnrefExtent(ek)
+	}
+	if len(release) != 0 {
+		ino.Punched = append(ino.Punched, release...)
+		mp.punches.add(ino.Inode)
+	}
+	resp.Msg.Extents.Extents = release
+	return
+}
+
+// releasedPieces sorts the pieces punched out of ino into those whose
+// space is released, and the extents whose reference ino drops. Pieces of
+// extents shared with other inodes still hold their data, the reference is
+// only dropped once ino stops using the extent. The parts of a piece which
+// other keys of ino still use are kept too.
+func (mp *metaPartition) releasedPieces(ino *Inode, freed []proto.ExtentKey) (release, unref []proto.ExtentKey) {
+	remain := make(map[extentID][]proto.ExtentKey)
+	ino.Extents.Range(func(i int, ek proto.ExtentKey) bool {
+		if !ek.IsHole() {
+			id := newExtentID(ek)
+			remain[id] = append(remain[id], ek)
+		}
+		return true
+	})
+	dropped := make(map[extentID]struct{})
+	for _, ek := range freed {
+		id := newExtentID(ek)
+		used, ok := remain[id]
+		if mp.extentRefs.Get(ek) > 1 {
+			if _, done := dropped[id]; !ok && !done {
+				unref = append(unref, ek)
+				dropped[id] = struct{}{}
+			}
+			continue
+		}
+		release = append(release, unusedPieces(ek, used)...)
+	}
+	return
+}
+
+// unusedPieces returns the parts of piece ek which none of the keys used of
+// the same extent cover.
+func unusedPieces(ek proto.ExtentKey, used []proto.ExtentKey) (pieces []proto.ExtentKey) {
+	pieces = []proto.ExtentKey{ek}
+	for _, u := range used {
+		uStart, uEnd := u.ExtentOffset, u.ExtentOffset+u.Size
+		var next []proto.ExtentKey
+		for _, p := range pieces {
+			pStart, pEnd := p.ExtentOffset, p.ExtentOffset+p.Size
+			if uEnd <= pStart || uStart >= pEnd {
+				next = append(next, p)
+				continue
+			}
+			if uStart > pStart {
+				head := p
+				head.Size = uStart - pStart
+				next = append(next, head)
+			}
+			if uEnd < pEnd {
+				tail := p
+				tail.ExtentOffset = uEnd
+				tail.Size = pEnd - uEnd
+				next = append(next, tail)
+			}
+		}
+		pieces = next
+	}
+	return
+}
+
+// inlineWrite writes data into the inline body of a small file. The file
+// must not have any extents, and the body must not exceed the inline size of
+// the volume.
+func (mp *metaPartition) inlineWrite(req *InlineWriteReq) (status uint8) {
+	status = proto.OpOk
+	if !mp.inRange(req.Inode) {
+		status = proto.OpAgain
+		return
+	}
+	item := mp.inodeTree.Get(NewInode(req.Inode, 0))
+	if item == nil {
+		status = proto.OpNotExistErr
+		return
+	}
+	ino := item.(*Inode)
+	if ino.MarkDelete == 1 {
+		status = proto.OpNotExistErr
+		return
+	}
+	if !proto.IsRegular(ino.Type) {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	if ino.IsImmutable() || ino.IsWormCommitted() ||
+		(ino.IsAppendOnly() && req.Offset != ino.Size) {
+		status = proto.OpNotPermErr
+		return
+	}
+	end := req.Offset + uint64(len(req.Data))
+	if ino.Extents.GetExtentLen() != 0 || end > uint64(mp.config.InlineSize) {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	size := uint64(len(ino.Inline))
+	if end > size {
+		size = end
+	}
+	// Never modify the inline body in place, it may be referenced by a
+	// pending reply.
+	inline := make([]byte, size)
+	copy(inline, ino.Inline)
+	copy(inline[req.Offset:], req.Data)
+	ino.Inline = inline
+	oldSize := ino.Size
+	ino.Size = size
+	ino.Generation++
+	mp.dirty.markInode(ino.Inode)
+	mp.addBytes(ino, oldSize)
+	return
+}
+
+// cloneExtents makes the empty destination inode share all extents of the
+// source inode, so the data is copied without touching the dataNodes.
+func (mp *metaPartition) cloneExtents(req *CloneExtentsReq) (resp *ResponseClone) {
+	resp = &ResponseClone{}
+	resp.Status, resp.Size = mp.cloneRange(req)
+	return
+}
+
+func (mp *metaPartition) cloneRange(req *CloneExtentsReq) (status uint8, size uint64) {
+	status = proto.OpOk
+	if !mp.inRange(req.SrcInode) || !mp.inRange(req.DstInode) {
+		status = proto.OpAgain
+		return
+	}
+	srcItem := mp.inodeTree.Get(NewInode(req.SrcInode, 0))
+	dstItem := mp.inodeTree.Get(NewInode(req.DstInode, 0))
+	if srcItem == nil || dstItem == nil {
+		status = proto.OpNotExistErr
+		return
+	}
+	src := srcItem.(*Inode)
+	dst := dstItem.(*Inode)
+	if src.MarkDelete == 1 || dst.MarkDelete == 1 {
+		status = proto.OpNotExistErr
+		return
+	}
+	if !proto.IsRegular(src.Type) || !proto.IsRegular(dst.Type) {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	if dst.IsImmutable() || dst.IsWormCommitted() {
+		status = proto.OpNotPermErr
+		return
+	}
+	// The data is only appended, as the stream of the file is.
+	if req.DstOffset != dst.Size-dst.Extents.Unwritten() {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	if req.SrcOffset >= src.Size || req.Size == 0 {
+		return
+	}
+	size = src.Size - req.SrcOffset
+	if req.Size < size {
+		size = req.Size
+	}
+	oldSize := dst.Size
+	if len(src.Inline) != 0 || len(dst.Inline) != 0 {
+		// An inline body is only shared whole, by an empty file.
+		if req.SrcOffset != 0 || size != src.Size || dst.Size != 0 ||
+			dst.Extents.GetExtentLen() != 0 {
+			status, size = proto.OpArgMismatchErr, 0
+			return
+		}
+		dst.Inline = src.Inline
+		dst.Size = src.Size
+	} else {
+		before := inodeExtentIDs(dst)
+		dst.Extents.Append(src.Extents.Slice(req.SrcOffset, size))
+		dst.Size = dst.Extents.Size()
+		for id := range inodeExtentIDs(dst) {
+			if _, ok := before[id]; !ok {
+				mp.extentRefs.RefExtent(id)
+			}
+		}
+	}
+	dst.Generation++
+	mp.dirty.markInode(dst.Inode)
+	mp.addBytes(dst, oldSize)
+	return
+}
+
+// ResponseClone is the result of cloneExtents, Size is the number of bytes
+// cloned.
+type ResponseClone struct {
+	Status uint8
+	Size   uint64
+}
+
+// wormCommit commits a regular file of a WORM volume, the file can not be
+// modified since and can not be removed before the retention deadline.
+func (mp *metaPartition) wormCommit(ino *Inode) (status uint8) {
+	status = proto.OpOk
+	if !mp.inRange(ino.Inode) {
+		status = proto.OpAgain
+		return
+	}
+	item := mp.inodeTree.Get(ino)
+	if item == nil {
+		status = proto.OpNotExistErr
+		return
+	}
+	i := item.(*Inode)
+	if i.MarkDelete == 1 {
+		status = proto.OpNotExistErr
+		return
+	}
+	if !proto.IsRegular(i.Type) {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	if i.IsWormCommitted() {
+		return
+	}
+	i.Retention = ino.Retention
+	mp.dirty.markInode(i.Inode)
+	return
+}
+
 func (mp *metaPartition) evictInode(ino *Inode) (resp *ResponseInode) {
 	resp = NewResponseInode()
 	resp.Status = proto.OpOk
+	if !mp.inRange(ino.Inode) {
+		resp.Status = proto.OpAgain
+		return
+	}
 	isFind := false
 	isDelete := false
 	mp.inodeTree.Find(ino, func(item BtreeItem) {
@@ -241,6 +581,8 @@ func (mp *metaPartition) evictInode(ino *Inode) (resp *ResponseInode) {
 		}
 		if i.NLink < 1 {
 			i.MarkDelete = 1
+			mp.dirty.markInode(i.Inode)
+			mp.addUsage(i.Parent, proto.DirUsage{Bytes: -int64(i.Size)})
 			// push to free list
 			mp.freeList.Push(i)
 		}
@@ -251,6 +593,7 @@ func (mp *metaPartition) evictInode(ino *Inode) (resp *ResponseInode) {
 	}
 	if isDelete {
 		mp.inodeTree.Delete(ino)
+		mp.dirty.markInode(ino.Inode)
 	}
 	return
 }
@@ -264,14 +607,59 @@ func (mp *metaPartition) checkAndInsertFreeList(ino *Inode) {
 	}
 }
 
-func (mp *metaPartition) setAttr(req *SetattrRequest) (err error) {
+func (mp *metaPartition) setAttr(req *SetattrRequest) (status uint8) {
+	status = proto.OpOk
+	if !mp.inRange(req.Inode) {
+		status = proto.OpAgain
+		return
+	}
 	// get Inode
 	ino := NewInode(req.Inode, req.Mode)
 	item := mp.inodeTree.Get(ino)
 	if item == nil {
+		status = proto.OpNotExistErr
 		return
 	}
 	ino = item.(*Inode)
+	// Only the flags can be changed, to make the inode mutable again.
+	if (ino.IsImmutable() || ino.IsAppendOnly()) && req.Valid&^proto.AttrFlags != 0 {
+		status = proto.OpNotPermErr
+		return
+	}
+	// A committed WORM file keeps its attributes, the retention can only
+	// be extended. The parent still changes if the file is renamed.
+	if ino.IsWormCommitted() && req.Valid&^(proto.AttrFlags|proto.AttrRetention|proto.AttrParent) != 0 {
+		status = proto.OpNotPermErr
+		return
+	}
+	if req.Valid&proto.AttrShards != 0 {
+		if !proto.IsDir(ino.Type) || len(req.Shards) == 0 {
+			status = proto.OpArgMismatchErr
+			return
+		}
+		// The shards of a directory never change, the first one wins if
+		// clients shard the directory at the same time.
+		if ino.IsSharded() {
+			status = proto.OpExistErr
+			return
+		}
+	}
+	// The space allocated for an inline file would be taken by its body
+	// once moved to the extents.
+	if req.Valid&proto.AttrSize != 0 && (proto.IsDir(ino.Type) || len(ino.Inline) != 0) {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	if req.Valid&proto.AttrRetention != 0 {
+		if !ino.IsWormCommitted() || req.Retention < ino.Retention {
+			status = proto.OpNotPermErr
+			return
+		}
+		ino.Retention = req.Retention
+	}
+	if req.Valid&proto.AttrFlags != 0 {
+		ino.Flags = req.Flags & proto.FlagMask
+	}
 	if req.Valid&proto.AttrMode != 0 {
 		ino.Type = req.Mode
 	}
@@ -281,5 +669,19 @@ func (mp *metaPartition) setAttr(req *SetattrRequest) (err error) {
 	if req.Valid&proto.AttrGid != 0 {
 		ino.Gid = req.Gid
 	}
+	if req.Valid&proto.AttrShards != 0 {
+		ino.Shards = req.Shards
+	}
+	if req.Valid&proto.AttrParent != 0 {
+		mp.moveUsage(ino, req.Parent)
+	}
+	if req.Valid&proto.AttrSize != 0 && req.Size > ino.Size {
+		size := ino.Size
+		ino.Extents.Allocate(req.Size)
+		ino.Size = ino.Extents.Size()
+		ino.Generation++
+		mp.addBytes(ino, size)
+	}
+	mp.dirty.markInode(ino.Inode)
 	return
 }
@@ -0,0 +1,55 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/raftstore"
+)
+
+// newTestPartition returns partition 1 serving inodes up to 100, without
+// raft and without a directory to store to. Files of up to
+// proto.MaxInlineSize bytes are kept inline.
+func newTestPartition(t *testing.T) *metaPartition {
+	t.Helper()
+	return NewMetaPartition(&MetaPartitionConfig{PartitionId: 1, End: 100,
+		InlineSize: proto.MaxInlineSize}).(*metaPartition)
+}
+
+// testRaft applies the commands submitted by the partition at once, in
+// place of raft. The other methods are not implemented.
+type testRaft struct {
+	raftstore.Partition
+	mp        *metaPartition
+	submitted []uint32
+}
+
+func (r *testRaft) Submit(cmd []byte) (resp interface{}, err error) {
+	msg := &MetaItem{}
+	if err = msg.UnmarshalJson(cmd); err != nil {
+		return
+	}
+	r.submitted = append(r.submitted, msg.Op)
+	return r.mp.Apply(cmd, uint64(len(r.submitted)))
+}
+
+// newTestRaft makes the commands of mp applied at once.
+func newTestRaft(mp *metaPartition) *testRaft {
+	r := &testRaft{mp: mp}
+	mp.raftPartition = r
+	return r
+}
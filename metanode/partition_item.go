@@ -114,21 +114,27 @@ type ItemIterator struct {
 	cur        int
 	curItem    BtreeItem
 	inoLen     int
-	inodeTree  *BTree
+	inodeTree  MetaTree
 	dentryLen  int
-	dentryTree *BTree
+	dentryTree MetaTree
+	links      []byte // pending link changes, sent after the dentries
 	total      int
 }
 
-func NewMetaItemIterator(applyID uint64, ino, den *BTree) *ItemIterator {
+func NewMetaItemIterator(applyID uint64, ino, den MetaTree,
+	links []byte) *ItemIterator {
 	si := new(ItemIterator)
 	si.applyID = applyID
 	si.inodeTree = ino
 	si.dentryTree = den
+	si.links = links
 	si.cur = 0
 	si.inoLen = ino.Len()
 	si.dentryLen = den.Len()
 	si.total = si.inoLen + si.dentryLen
+	if links != nil {
+		si.total++
+	}
 	return si
 }
 
@@ -138,12 +144,15 @@ func (si *ItemIterator) ApplyIndex() uint64 {
 
 func (si *ItemIterator) Close() {
 	si.cur = si.total + 1
+	si.inodeTree.Release()
+	si.dentryTree.Release()
 	return
 }
 
 func (si *ItemIterator) Next() (data []byte, err error) {
 	// TODO: Redesign iterator to improve performance. [Mervin]
 	if si.cur > si.total {
+		si.Close()
 		err = io.EOF
 		data = nil
 		return
@@ -160,7 +169,9 @@ func (si *ItemIterator) Next() (data []byte, err error) {
 	if si.cur <= si.inoLen {
 		si.inodeTree.AscendGreaterOrEqual(si.curItem, func(i btree.Item) bool {
 			ino := i.(*Inode)
-			if si.curItem == ino {
+			// Items read from rocksdb are new copies every time,
+			// compare the keys.
+			if si.curItem != nil && !si.curItem.Less(ino) {
 				return true
 			}
 			si.curItem = ino
@@ -173,13 +184,20 @@ func (si *ItemIterator) Next() (data []byte, err error) {
 		return
 	}
 
+	if si.links != nil && si.cur == si.total {
+		snap := NewMetaItem(opSnapLinks, nil, si.links)
+		data, err = snap.MarshalBinary()
+		si.cur++
+		return
+	}
+
 	// ascend range dentry tree
 	if si.cur == (si.inoLen + 1) {
 		si.curItem = nil
 	}
 	si.dentryTree.AscendGreaterOrEqual(si.curItem, func(i btree.Item) bool {
 		dentry := i.(*Dentry)
-		if si.curItem == dentry {
+		if si.curItem != nil && !si.curItem.Less(dentry) {
 			return true
 		}
 		si.curItem = dentry
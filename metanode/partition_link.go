@@ -0,0 +1,419 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// An inode keeps its links, that is the parent and name of each dentry of
+// the inode, so its paths can be resolved up to the root. The dentry may be
+// on another partition than its inode, so a link change is recorded with
+// the dentry operation, and the leader sends the changes to the partitions
+// of their inodes in the background, in the order of the dentry operations.
+// Every replica records the changes while it applies the raft log, and
+// keeps them until the leader applies that they are sent, so those pending
+// on a leader which steps down are sent by the next one. Applying a change
+// twice has no effect. The dentries created before the upgrade are linked
+// by a backfill, which records their changes in batches through raft too.
+
+const (
+	LinkFlushInterval = time.Second
+	// LinkBackfillBatch is the number of dentries linked by one backfill
+	// step, the next step is taken once the pending changes are fewer.
+	LinkBackfillBatch = 1000
+)
+
+const (
+	linkFile    = "link"
+	linkFileTmp = ".link"
+)
+
+// linkEntry is a link change numbered in the order it is recorded.
+type linkEntry struct {
+	Seq uint64 `json:"seq"`
+	proto.LinkChange
+}
+
+// linkState is the stored state of a linkSet.
+type linkState struct {
+	Seq     uint64      `json:"seq"`
+	Pending []linkEntry `json:"pending"`
+	// The backfill goes on from dentry Cursor, until it is done.
+	Cursor       proto.InodeLink `json:"cursor"`
+	BackfillDone bool            `json:"backfilled"`
+}
+
+// linkSentReq drops the changes up to Seq, except those in Keep which have
+// not been sent.
+type linkSentReq struct {
+	Seq  uint64   `json:"seq"`
+	Keep []uint64 `json:"keep"`
+}
+
+// linkSet collects the link changes of inodes in order.
+type linkSet struct {
+	sync.Mutex
+	linkState
+}
+
+func newLinkSet() *linkSet {
+	return &linkSet{}
+}
+
+func (s *linkSet) add(c proto.LinkChange) {
+	s.Lock()
+	defer s.Unlock()
+	s.Seq++
+	s.Pending = append(s.Pending, linkEntry{Seq: s.Seq, LinkChange: c})
+}
+
+// pending returns the changes not sent yet.
+func (s *linkSet) pending() []linkEntry {
+	s.Lock()
+	defer s.Unlock()
+	return append([]linkEntry(nil), s.Pending...)
+}
+
+func (s *linkSet) len() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.Pending)
+}
+
+// sent drops the changes which have been sent.
+func (s *linkSet) sent(req *linkSentReq) {
+	keep := make(map[uint64]bool, len(req.Keep))
+	for _, seq := range req.Keep {
+		keep[seq] = true
+	}
+	s.Lock()
+	defer s.Unlock()
+	pending := make([]linkEntry, 0, len(s.Pending))
+	for _, e := range s.Pending {
+		if e.Seq > req.Seq || keep[e.Seq] {
+			pending = append(pending, e)
+		}
+	}
+	s.Pending = pending
+}
+
+// backfillCursor returns the dentry the backfill goes on from, done is set
+// once there are no more.
+func (s *linkSet) backfillCursor() (cursor proto.InodeLink, done bool) {
+	s.Lock()
+	defer s.Unlock()
+	return s.Cursor, s.BackfillDone
+}
+
+func (s *linkSet) setBackfillCursor(cursor *proto.InodeLink) {
+	s.Lock()
+	defer s.Unlock()
+	if cursor == nil {
+		s.Cursor, s.BackfillDone = proto.InodeLink{}, true
+		return
+	}
+	s.Cursor = *cursor
+}
+
+// reset drops the changes and starts the backfill over.
+func (s *linkSet) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.linkState = linkState{}
+}
+
+func (s *linkSet) marshal() ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	return json.Marshal(&s.linkState)
+}
+
+func (s *linkSet) unmarshal(data []byte) (err error) {
+	state := linkState{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.linkState = state
+	return
+}
+
+// addLink records that the dentry parent/name of inode ino is created, or
+// removed if remove is set.
+func (mp *metaPartition) addLink(ino, parent uint64, name string, remove bool) {
+	if ino == 0 {
+		return
+	}
+	mp.links.add(proto.LinkChange{
+		Inode:     ino,
+		InodeLink: proto.InodeLink{Parent: parent, Name: name},
+		Remove:    remove,
+	})
+}
+
+// backfillLinks records the links of the next LinkBackfillBatch dentries of
+// the backfill.
+func (mp *metaPartition) backfillLinks() (status uint8) {
+	status = proto.OpOk
+	cursor, done := mp.links.backfillCursor()
+	if done {
+		return
+	}
+	var (
+		n    int
+		next *proto.InodeLink
+	)
+	pivot := &Dentry{ParentId: cursor.Parent, Name: cursor.Name}
+	mp.dentryTree.AscendGreaterOrEqual(pivot, func(i BtreeItem) bool {
+		d := i.(*Dentry)
+		if n == LinkBackfillBatch {
+			next = &proto.InodeLink{Parent: d.ParentId, Name: d.Name}
+			return false
+		}
+		mp.addLink(d.Inode, d.ParentId, d.Name, false)
+		n++
+		return true
+	})
+	mp.links.setBackfillCursor(next)
+	return
+}
+
+// linksSent applies that the changes have been sent.
+func (mp *metaPartition) linksSent(req *linkSentReq) (status uint8) {
+	mp.links.sent(req)
+	return proto.OpOk
+}
+
+func linkIndex(links []proto.InodeLink, link proto.InodeLink) int {
+	for k := range links {
+		if links[k] == link {
+			return k
+		}
+	}
+	return -1
+}
+
+// applyLinks adds or removes the links of the inodes. The inodes which are
+// gone are skipped.
+func (mp *metaPartition) applyLinks(req *UpdateLinksReq) (status uint8) {
+	status = proto.OpOk
+	for _, c := range req.Changes {
+		if !mp.inRange(c.Inode) {
+			continue
+		}
+		ino, _ := mp.inodeTree.Get(NewInode(c.Inode, 0)).(*Inode)
+		if ino == nil {
+			continue
+		}
+		k := linkIndex(ino.Links, c.InodeLink)
+		switch {
+		case c.Remove && k >= 0:
+			// The slice may be shared with an inode being stored.
+			links := make([]proto.InodeLink, 0, len(ino.Links)-1)
+			links = append(links, ino.Links[:k]...)
+			ino.Links = append(links, ino.Links[k+1:]...)
+		case !c.Remove && k < 0:
+			ino.Links = append(ino.Links, c.InodeLink)
+		default:
+			continue
+		}
+		mp.dirty.markInode(ino.Inode)
+	}
+	return
+}
+
+// UpdateLinks applies the link changes sent by another meta partition.
+func (mp *metaPartition) UpdateLinks(req *UpdateLinksReq, p *Packet) (err error) {
+	resp, err := mp.Put(opFSMUpdateLinks, p.Data)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PackErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+func (mp *metaPartition) startLinkWorker() {
+	sender := newAsyncSender(mp, "flushLinks", opFSMUpdateLinks,
+		NewUpdateLinksPacket)
+	go mp.runAsync(LinkFlushInterval, func(isLeader bool) {
+		if isLeader {
+			mp.flushLinks(sender)
+		}
+	})
+}
+
+// flushLinks takes the next backfill step, sends the pending changes to
+// the partitions of their inodes and applies which ones have been sent.
+// The changes which are not sent are sent again in the next round.
+func (mp *metaPartition) flushLinks(sender *asyncSender) {
+	if _, done := mp.links.backfillCursor(); !done &&
+		mp.links.len() < LinkBackfillBatch {
+		if _, err := mp.Put(opFSMBackfillLinks, nil); err != nil {
+			log.LogErrorf("[flushLinks] partition id=%d: backfill: %s",
+				mp.config.PartitionId, err.Error())
+		}
+	}
+	pending := mp.links.pending()
+	if len(pending) == 0 {
+		return
+	}
+	failed := sender.send(len(pending), func(i int) uint64 {
+		return pending[i].Inode
+	}, func(partitionID uint64, indexes []int) interface{} {
+		req := &UpdateLinksReq{
+			VolName:     mp.config.VolName,
+			PartitionID: partitionID,
+		}
+		for _, i := range indexes {
+			req.Changes = append(req.Changes, pending[i].LinkChange)
+		}
+		return req
+	})
+	if len(failed) == len(pending) {
+		return
+	}
+	req := &linkSentReq{Seq: pending[len(pending)-1].Seq}
+	for _, i := range failed {
+		req.Keep = append(req.Keep, pending[i].Seq)
+	}
+	val, err := json.Marshal(req)
+	if err == nil {
+		_, err = mp.Put(opFSMLinksSent, val)
+	}
+	if err != nil {
+		log.LogErrorf("[flushLinks] partition id=%d: %s",
+			mp.config.PartitionId, err.Error())
+	}
+}
+
+// loadLinks loads the changes not sent when the partition was stored.
+func (mp *metaPartition) loadLinks() (err error) {
+	mp.links.reset()
+	filename := path.Join(mp.config.RootDir, linkFile)
+	if _, err = os.Stat(filename); err != nil {
+		// Stored before the changes were, the backfill links the
+		// dentries.
+		err = nil
+		return
+	}
+	fp, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		err = errors.Errorf("[loadLinks] OpenFile: %s", err.Error())
+		return
+	}
+	defer fp.Close()
+	reader, err := newSnapshotReader(fp, filename)
+	if err != nil {
+		return
+	}
+	data, err := reader.ReadRecord()
+	if err != nil {
+		if err == io.EOF {
+			err = reader.corrupt("no link state")
+		}
+		return
+	}
+	if err = mp.links.unmarshal(data); err != nil {
+		err = reader.corrupt("unmarshal link state: %s", err.Error())
+	}
+	return
+}
+
+func (mp *metaPartition) storeLinks(sm *storeMsg) (err error) {
+	filename := path.Join(mp.config.RootDir, linkFileTmp)
+	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_TRUNC|os.
+		O_CREATE, 0755)
+	if err != nil {
+		return
+	}
+	defer func() {
+		fp.Close()
+		os.Remove(filename)
+	}()
+	writer, err := newSnapshotWriter(fp)
+	if err != nil {
+		return
+	}
+	if err = writer.WriteRecord(sm.links); err != nil {
+		return
+	}
+	if err = writer.Close(sm.applyIndex); err != nil {
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		return
+	}
+	err = os.Rename(filename, path.Join(mp.config.RootDir, linkFile))
+	return
+}
+
+// lookupInode returns the info of inode ino, nil if it does not exist. An
+// inode out of the range of the partition is asked from its partition.
+func (mp *metaPartition) lookupInode(ino uint64) (info *proto.InodeInfo, err error) {
+	if mp.inRange(ino) {
+		resp := mp.getInode(NewInode(ino, 0))
+		if resp.Status != proto.OpOk {
+			return
+		}
+		info = &proto.InodeInfo{}
+		replyInfo(info, resp.Msg)
+		return
+	}
+	view := mp.vol.GetMetaPartition(ino)
+	if view == nil {
+		if err = mp.refreshVol(); err != nil {
+			return
+		}
+		if view = mp.vol.GetMetaPartition(ino); view == nil {
+			return
+		}
+	}
+	data, err := json.Marshal(&proto.InodeGetRequest{
+		VolName:     mp.config.VolName,
+		PartitionID: view.PartitionID,
+		Inode:       ino,
+	})
+	if err != nil {
+		return
+	}
+	p, err := mp.sendToPartition(view, func() *Packet {
+		return NewInodeGetPacket(data)
+	})
+	if p != nil && p.ResultCode == proto.OpNotExistErr {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	resp := &proto.InodeGetResponse{}
+	if err = json.Unmarshal(p.Data, resp); err != nil {
+		return
+	}
+	info = resp.Info
+	return
+}
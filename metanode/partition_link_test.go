@@ -0,0 +1,188 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// flushLocalLinks applies the recorded changes like the link worker does.
+func flushLocalLinks(mp *metaPartition) {
+	pending := mp.links.pending()
+	if len(pending) == 0 {
+		return
+	}
+	req := &UpdateLinksReq{}
+	for _, e := range pending {
+		req.Changes = append(req.Changes, e.LinkChange)
+	}
+	mp.applyLinks(req)
+	mp.linksSent(&linkSentReq{Seq: pending[len(pending)-1].Seq})
+}
+
+func inodePaths(t *testing.T, mp *metaPartition, ino uint64) []string {
+	paths, err := proto.InodePaths(ino, mp.lookupInode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestInodeLinks(t *testing.T) {
+	mp := newTestPartition(t)
+	dirMode := proto.Mode(os.ModeDir | os.ModePerm)
+	fileMode := proto.Mode(os.ModePerm)
+	mp.createInode(NewInode(1, dirMode))
+	mp.createInode(NewInode(2, dirMode))
+	mp.createInode(NewInode(3, fileMode))
+	mp.createInode(NewInode(4, fileMode))
+	mp.createDentry(&Dentry{ParentId: 1, Name: "dir", Inode: 2, Type: dirMode})
+	mp.createDentry(&Dentry{ParentId: 2, Name: "a", Inode: 3, Type: fileMode})
+	mp.createDentry(&Dentry{ParentId: 1, Name: "b", Inode: 3, Type: fileMode})
+	flushLocalLinks(mp)
+	if paths := inodePaths(t, mp, 3); !reflect.DeepEqual(paths, []string{"/b", "/dir/a"}) {
+		t.Fatalf("paths %v", paths)
+	}
+
+	// Unlink one of the hard links, and replace the other one.
+	mp.deleteDentry(&Dentry{ParentId: 1, Name: "b"})
+	mp.updateDentry(&Dentry{ParentId: 2, Name: "a", Inode: 4})
+	flushLocalLinks(mp)
+	if paths := inodePaths(t, mp, 3); len(paths) != 0 {
+		t.Fatalf("paths of unlinked inode %v", paths)
+	}
+	if paths := inodePaths(t, mp, 4); !reflect.DeepEqual(paths, []string{"/dir/a"}) {
+		t.Fatalf("paths %v", paths)
+	}
+
+	ino := mp.getInode(NewInode(4, 0)).Msg
+	data, err := ino.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInode(0, 0)
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Links, ino.Links) {
+		t.Fatalf("unmarshal links %v", loaded.Links)
+	}
+}
+
+func TestLinkBackfill(t *testing.T) {
+	mp := newTestPartition(t)
+	dirMode := proto.Mode(os.ModeDir | os.ModePerm)
+	fileMode := proto.Mode(os.ModePerm)
+	mp.createInode(NewInode(1, dirMode))
+	mp.createInode(NewInode(2, fileMode))
+	mp.createInode(NewInode(3, fileMode))
+	// Dentries created before the links were recorded.
+	for i := 0; i <= LinkBackfillBatch; i++ {
+		mp.createDentry(&Dentry{ParentId: 1, Name: fmt.Sprintf("f%04d", i),
+			Inode: 2, Type: fileMode})
+	}
+	mp.createDentry(&Dentry{ParentId: 1, Name: "z", Inode: 3, Type: fileMode})
+	mp.links.reset()
+
+	mp.backfillLinks()
+	flushLocalLinks(mp)
+	if paths := inodePaths(t, mp, 2); len(paths) != LinkBackfillBatch {
+		t.Fatalf("paths after one step %v", len(paths))
+	}
+	if paths := inodePaths(t, mp, 3); len(paths) != 0 {
+		t.Fatalf("paths of inode past the step %v", paths)
+	}
+	if cursor, done := mp.links.backfillCursor(); done ||
+		cursor != (proto.InodeLink{Parent: 1, Name: fmt.Sprintf("f%04d", LinkBackfillBatch)}) {
+		t.Fatalf("cursor %v done %v", cursor, done)
+	}
+
+	mp.backfillLinks()
+	flushLocalLinks(mp)
+	if paths := inodePaths(t, mp, 3); !reflect.DeepEqual(paths, []string{"/z"}) {
+		t.Fatalf("paths %v", paths)
+	}
+	if _, done := mp.links.backfillCursor(); !done {
+		t.Fatal("backfill not done")
+	}
+	if mp.backfillLinks(); mp.links.len() != 0 {
+		t.Fatalf("changes recorded once done %v", mp.links.len())
+	}
+}
+
+func TestLinksStored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metapartition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newPartition := func() *metaPartition {
+		return NewMetaPartition(&MetaPartitionConfig{
+			PartitionId: 1,
+			VolName:     "vol",
+			Start:       1,
+			End:         100,
+			Peers:       []proto.Peer{{ID: 1, Addr: "127.0.0.1:9021"}},
+			RootDir:     dir,
+		}).(*metaPartition)
+	}
+	mode := proto.Mode(os.ModePerm)
+	mp := newPartition()
+	if err = mp.storeMeta(); err != nil {
+		t.Fatal(err)
+	}
+	mp.createInode(NewInode(1, proto.Mode(os.ModePerm|os.ModeDir)))
+	mp.createDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2, Type: mode})
+	mp.createDentry(&Dentry{ParentId: 1, Name: "b", Inode: 3, Type: mode})
+	mp.createDentry(&Dentry{ParentId: 1, Name: "c", Inode: 4, Type: mode})
+	// The change of b failed to be sent.
+	mp.linksSent(&linkSentReq{Seq: 2, Keep: []uint64{2}})
+	want := mp.links.pending()
+	if len(want) != 2 || want[0].Name != "b" || want[1].Name != "c" {
+		t.Fatalf("pending %v", want)
+	}
+
+	sm := &storeMsg{
+		command:    opStoreTick,
+		applyIndex: 10,
+		inodeTree:  mp.getInodeTree(),
+		dentryTree: mp.getDentryTree(),
+		dirty:      mp.dirty.swap(),
+	}
+	sm.links, _ = mp.links.marshal()
+	if err = mp.store(sm); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newPartition()
+	if err = loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.links.pending(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded pending %v, want %v", got, want)
+	}
+	// New changes are numbered after the loaded ones.
+	loaded.createDentry(&Dentry{ParentId: 1, Name: "d", Inode: 5, Type: mode})
+	if got := loaded.links.pending(); len(got) != 3 || got[2].Seq != 4 {
+		t.Fatalf("pending after create %v", got)
+	}
+}
@@ -16,11 +16,20 @@ package metanode
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/tiglabs/containerfs/proto"
 )
 
 func (mp *metaPartition) CreateDentry(req *CreateDentryReq, p *Packet) (err error) {
+	return mp.putOp(mp.prepareCreateDentry(req, p))
+}
+
+func (mp *metaPartition) prepareCreateDentry(req *CreateDentryReq, p *Packet) (op *preparedOp) {
+	op = &preparedOp{reply: p}
+	if !mp.checkInode(req.ParentID, p) {
+		return
+	}
 	dentry := &Dentry{
 		ParentId: req.ParentID,
 		Name:     req.Name,
@@ -29,47 +38,99 @@ func (mp *metaPartition) CreateDentry(req *CreateDentryReq, p *Packet) (err erro
 	}
 	val, err := dentry.Marshal()
 	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	resp, err := mp.Put(opCreateDentry, val)
+	op.item = NewMetaItem(opCreateDentry, nil, val)
+	op.pack = func(resp interface{}) {
+		mp.packCreateDentry(req.ParentID, resp.(uint8), p)
+	}
+	return
+}
+
+func (mp *metaPartition) packCreateDentry(parentID uint64, status uint8, p *Packet) {
+	switch status {
+	case proto.OpOk:
+		m := &CreateDentryResp{}
+		if item := mp.inodeTree.Get(NewInode(parentID, 0)); item != nil {
+			m.Entries = item.(*Inode).Entries
+		}
+		reply, err := json.Marshal(m)
+		if err != nil {
+			p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+			return
+		}
+		p.PackOkWithBody(reply)
+	case proto.OpShardedErr:
+		mp.packSharded(parentID, p)
+	default:
+		p.PackErrorWithBody(status, nil)
+	}
+}
+
+// packSharded replies the shard directories of directory ino, whose
+// dentries are not all kept in the partition.
+func (mp *metaPartition) packSharded(ino uint64, p *Packet) {
+	reply, err := json.Marshal(&proto.ShardedResponse{
+		Shards: mp.dirShards(ino),
+	})
 	if err != nil {
-		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	p.ResultCode = resp.(uint8)
-	return
+	p.PackErrorWithBody(proto.OpShardedErr, reply)
 }
 
 func (mp *metaPartition) DeleteDentry(req *DeleteDentryReq, p *Packet) (err error) {
+	return mp.putOp(mp.prepareDeleteDentry(req, p))
+}
+
+func (mp *metaPartition) prepareDeleteDentry(req *DeleteDentryReq, p *Packet) (op *preparedOp) {
+	op = &preparedOp{reply: p}
+	if !mp.checkInode(req.ParentID, p) {
+		return
+	}
+	if !mp.checkUnlink(req.ParentID, req.Name, p) {
+		return
+	}
 	dentry := &Dentry{
 		ParentId: req.ParentID,
 		Name:     req.Name,
 	}
 	val, err := dentry.Marshal()
 	if err != nil {
-		p.ResultCode = proto.OpErr
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	r, err := mp.Put(opDeleteDentry, val)
-	if err != nil {
-		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
-		return
+	op.item = NewMetaItem(opDeleteDentry, nil, val)
+	op.pack = func(resp interface{}) {
+		mp.packDeleteDentry(req.ParentID, resp.(*ResponseDentry), p)
 	}
-	retMsg := r.(*ResponseDentry)
+	return
+}
+
+func (mp *metaPartition) packDeleteDentry(parentID uint64, retMsg *ResponseDentry, p *Packet) {
 	p.ResultCode = retMsg.Status
-	dentry = retMsg.Msg
+	if p.ResultCode == proto.OpNotExistErr && mp.dirShards(parentID) != nil {
+		mp.packSharded(parentID, p)
+		return
+	}
 	if p.ResultCode == proto.OpOk {
-		var reply []byte
 		resp := &DeleteDentryResp{
-			Inode: dentry.Inode,
+			Inode: retMsg.Msg.Inode,
 		}
-		reply, err = json.Marshal(resp)
+		reply, _ := json.Marshal(resp)
 		p.PackOkWithBody(reply)
 	}
-	return
 }
 
 func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err error) {
+	if !mp.checkInode(req.ParentID, p) {
+		return
+	}
+	if !mp.checkUnlink(req.ParentID, req.Name, p) {
+		return
+	}
 	dentry := &Dentry{
 		ParentId: req.ParentID,
 		Name:     req.Name,
@@ -87,6 +148,10 @@ func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err erro
 	}
 	msg := resp.(*ResponseDentry)
 	p.ResultCode = msg.Status
+	if msg.Status == proto.OpNotExistErr && mp.dirShards(req.ParentID) != nil {
+		mp.packSharded(req.ParentID, p)
+		return
+	}
 	if msg.Status == proto.OpOk {
 		var reply []byte
 		m := &UpdateDentryResp{
@@ -98,7 +163,34 @@ func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err erro
 	return
 }
 
+// checkUnlink tests whether the inode of the dentry parentID/name may lose
+// the dentry, the reply is packed if not. An immutable or append-only inode
+// can neither be removed nor renamed, nor can a WORM file under retention.
+// The inode may be on another partition, so it is checked before the
+// operation is proposed.
+func (mp *metaPartition) checkUnlink(parentID uint64, name string, p *Packet) bool {
+	dentry, status := mp.getDentry(&Dentry{ParentId: parentID, Name: name})
+	if status != proto.OpOk {
+		// Replied by the operation.
+		return true
+	}
+	info, err := mp.lookupInode(dentry.Inode)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return false
+	}
+	if info != nil && (info.Flags&(proto.FlagImmutable|proto.FlagAppend) != 0 ||
+		info.IsRetained(time.Now().Unix())) {
+		p.PackErrorWithBody(proto.OpNotPermErr, nil)
+		return false
+	}
+	return true
+}
+
 func (mp *metaPartition) ReadDir(req *ReadDirReq, p *Packet) (err error) {
+	if !mp.checkInode(req.ParentID, p) {
+		return
+	}
 	resp := mp.readDir(req)
 	reply, err := json.Marshal(resp)
 	if err != nil {
@@ -110,11 +202,18 @@ func (mp *metaPartition) ReadDir(req *ReadDirReq, p *Packet) (err error) {
 }
 
 func (mp *metaPartition) Lookup(req *LookupReq, p *Packet) (err error) {
+	if !mp.checkInode(req.ParentID, p) {
+		return
+	}
 	dentry := &Dentry{
 		ParentId: req.ParentID,
 		Name:     req.Name,
 	}
 	dentry, status := mp.getDentry(dentry)
+	if status == proto.OpNotExistErr && mp.dirShards(req.ParentID) != nil {
+		mp.packSharded(req.ParentID, p)
+		return
+	}
 	var reply []byte
 	if status == proto.OpOk {
 		resp := &LookupResp{
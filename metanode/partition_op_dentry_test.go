@@ -15,8 +15,99 @@
 package metanode
 
 import (
+	"encoding/json"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
 )
 
 func Test_CreateDentry(t *testing.T) {
 }
+
+func TestDirShards(t *testing.T) {
+	mp := newTestPartition(t)
+	dir := NewInode(1, proto.Mode(os.ModeDir|os.ModePerm))
+	mp.createInode(dir)
+	mp.createDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2})
+	mp.createDentry(&Dentry{ParentId: 1, Name: "b", Inode: 3})
+	mp.deleteDentry(&Dentry{ParentId: 1, Name: "b"})
+	if dir.Entries != 1 {
+		t.Fatalf("entries %v", dir.Entries)
+	}
+
+	file := NewInode(2, proto.Mode(os.ModePerm))
+	mp.createInode(file)
+	req := &SetattrRequest{Inode: 2, Valid: proto.AttrShards, Shards: []uint64{10, 11}}
+	if status := mp.setAttr(req); status != proto.OpArgMismatchErr {
+		t.Fatalf("shard file status %v", status)
+	}
+	req.Inode = 1
+	if status := mp.setAttr(req); status != proto.OpOk {
+		t.Fatalf("shard status %v", status)
+	}
+	if status := mp.setAttr(req); status != proto.OpExistErr {
+		t.Fatalf("shard again status %v", status)
+	}
+	data, err := dir.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInode(0, 0)
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Shards) != 2 || loaded.Shards[1] != 11 || loaded.Entries != 1 {
+		t.Fatalf("unmarshal inode %v", loaded)
+	}
+
+	if status := mp.createDentry(&Dentry{ParentId: 1, Name: "c", Inode: 4}); status != proto.OpShardedErr {
+		t.Fatalf("create in sharded dir status %v", status)
+	}
+	p := &Packet{}
+	mp.Lookup(&LookupReq{ParentID: 1, Name: "a"}, p)
+	if p.ResultCode != proto.OpOk {
+		t.Fatalf("lookup dentry before sharding result %v", p.GetResultMesg())
+	}
+	p = &Packet{}
+	mp.Lookup(&LookupReq{ParentID: 1, Name: "c"}, p)
+	resp := &proto.ShardedResponse{}
+	if p.ResultCode != proto.OpShardedErr || json.Unmarshal(p.Data, resp) != nil || len(resp.Shards) != 2 {
+		t.Fatalf("lookup in sharded dir result %v", p.GetResultMesg())
+	}
+	if shards := mp.readDir(&ReadDirReq{ParentID: 1}).Shards; len(shards) != 2 {
+		t.Fatalf("readdir shards %v", shards)
+	}
+}
+
+func TestUnlinkProtected(t *testing.T) {
+	mp := newTestPartition(t)
+	mp.createInode(NewInode(1, proto.Mode(os.ModeDir|os.ModePerm)))
+	file := NewInode(2, proto.Mode(os.ModePerm))
+	file.Flags = proto.FlagImmutable
+	mp.createInode(file)
+	mp.createDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2})
+
+	p := &Packet{}
+	if op := mp.prepareDeleteDentry(&DeleteDentryReq{ParentID: 1, Name: "a"}, p); op.item != nil || p.ResultCode != proto.OpNotPermErr {
+		t.Fatalf("delete immutable result %v", p.GetResultMesg())
+	}
+	file.Flags = proto.FlagAppend
+	p = &Packet{}
+	mp.UpdateDentry(&UpdateDentryReq{ParentID: 1, Name: "a", Inode: 3}, p)
+	if p.ResultCode != proto.OpNotPermErr {
+		t.Fatalf("replace append-only result %v", p.GetResultMesg())
+	}
+	file.Flags = 0
+	file.Retention = time.Now().Unix() + 100
+	p = &Packet{}
+	if op := mp.prepareDeleteDentry(&DeleteDentryReq{ParentID: 1, Name: "a"}, p); op.item != nil || p.ResultCode != proto.OpNotPermErr {
+		t.Fatalf("delete retained result %v", p.GetResultMesg())
+	}
+	file.Retention = time.Now().Unix() - 1
+	p = &Packet{}
+	if op := mp.prepareDeleteDentry(&DeleteDentryReq{ParentID: 1, Name: "a"}, p); op.item == nil {
+		t.Fatalf("delete result %v", p.GetResultMesg())
+	}
+}
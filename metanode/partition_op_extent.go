@@ -18,10 +18,14 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
 	"os"
 )
 
 func (mp *metaPartition) ExtentAppend(req *proto.AppendExtentKeyRequest, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	ino.Extents.Put(req.Extent)
 	val, err := ino.Marshal()
@@ -40,6 +44,9 @@ func (mp *metaPartition) ExtentAppend(req *proto.AppendExtentKeyRequest, p *Pack
 
 func (mp *metaPartition) ExtentsList(req *proto.GetExtentsRequest,
 	p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	retMsg := mp.getInode(ino)
 	ino = retMsg.Msg
@@ -64,6 +71,9 @@ func (mp *metaPartition) ExtentsList(req *proto.GetExtentsRequest,
 
 func (mp *metaPartition) ExtentsTruncate(req *ExtentsTruncateReq,
 	p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, proto.Mode(os.ModePerm))
 	nextIno, err := mp.nextInodeID()
 	if err != nil {
@@ -86,3 +96,81 @@ func (mp *metaPartition) ExtentsTruncate(req *ExtentsTruncateReq,
 	p.PackErrorWithBody(msg.Status, nil)
 	return
 }
+
+func (mp *metaPartition) ExtentsPunchHole(req *PunchHoleReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
+	if ino, _ := mp.inodeTree.Get(NewInode(req.Inode, 0)).(*Inode); ino != nil &&
+		(ino.IsImmutable() || ino.IsAppendOnly() || ino.IsWormCommitted()) {
+		p.PackErrorWithBody(proto.OpNotPermErr, nil)
+		return
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		return
+	}
+	resp, err := mp.Put(opFSMPunchHole, val)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	msg := resp.(*ResponseInode)
+	if msg.Status == proto.OpOk {
+		// The pieces freed by the hole are kept with the inode, those
+		// which fail are released by the punch worker.
+		if err = mp.releasePunched(req.Inode, msg.Msg.Extents.Extents); err != nil {
+			log.LogWarnf("[ExtentsPunchHole] ino(%v): %s", req.Inode, err.Error())
+			err = nil
+		}
+	}
+	p.PackErrorWithBody(msg.Status, nil)
+	return
+}
+
+func (mp *metaPartition) ExtentsClone(req *CloneExtentsReq, p *Packet) (err error) {
+	if !mp.checkInode(req.SrcInode, p) || !mp.checkInode(req.DstInode, p) {
+		return
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		return
+	}
+	resp, err := mp.Put(opFSMExtentsClone, val)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	msg := resp.(*ResponseClone)
+	if msg.Status != proto.OpOk {
+		p.PackErrorWithBody(msg.Status, nil)
+		return
+	}
+	reply, err := json.Marshal(&proto.CloneExtentsResponse{Size: msg.Size})
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		return
+	}
+	p.PackOkWithBody(reply)
+	return
+}
+
+func (mp *metaPartition) InlineWrite(req *InlineWriteReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, nil)
+		return
+	}
+	resp, err := mp.Put(opFSMInlineWrite, val)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PackErrorWithBody(resp.(uint8), nil)
+	return
+}
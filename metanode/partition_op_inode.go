@@ -31,9 +31,28 @@ func replyInfo(info *proto.InodeInfo, ino *Inode) {
 	info.CreateTime = time.Unix(ino.CreateTime, 0)
 	info.AccessTime = time.Unix(ino.AccessTime, 0)
 	info.ModifyTime = time.Unix(ino.ModifyTime, 0)
+	info.Flags = ino.Flags
+	info.Retention = ino.Retention
+	info.Shards = ino.Shards
+	info.Parent = ino.Parent
+	info.Links = ino.Links
+	info.Unwritten = ino.Extents.Unwritten()
+	if proto.IsDir(ino.Type) {
+		usage := ino.Usage
+		info.Usage = &usage
+	}
 }
 
 func (mp *metaPartition) CreateInode(req *CreateInoReq, p *Packet) (err error) {
+	return mp.putOp(mp.prepareCreateInode(req, p))
+}
+
+func (mp *metaPartition) prepareCreateInode(req *CreateInoReq, p *Packet) (op *preparedOp) {
+	op = &preparedOp{reply: p}
+	if mp.config.SplitFrom != 0 {
+		p.PackErrorWithBody(proto.OpAgain, []byte("importing split items"))
+		return
+	}
 	inoID, err := mp.nextInodeID()
 	if err != nil {
 		p.PackErrorWithBody(proto.OpInodeFullErr, []byte(err.Error()))
@@ -41,19 +60,23 @@ func (mp *metaPartition) CreateInode(req *CreateInoReq, p *Packet) (err error) {
 	}
 	ino := NewInode(inoID, req.Mode)
 	ino.LinkTarget = req.Target
+	ino.Parent = req.ParentID
 	val, err := ino.Marshal()
 	if err != nil {
 		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	resp, err := mp.Put(opCreateInode, val)
-	if err != nil {
-		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
-		return
+	op.item = NewMetaItem(opCreateInode, nil, val)
+	op.pack = func(resp interface{}) {
+		packCreateInode(ino, resp.(uint8), p)
 	}
+	return
+}
+
+func packCreateInode(ino *Inode, status uint8, p *Packet) {
 	var (
-		status = resp.(uint8)
-		reply  []byte
+		reply []byte
+		err   error
 	)
 	if status == proto.OpOk {
 		resp := &CreateInoResp{
@@ -75,24 +98,36 @@ func (mp *metaPartition) CreateInode(req *CreateInoReq, p *Packet) (err error) {
 		}
 	}
 	p.PackErrorWithBody(status, reply)
-	return
 }
 
 func (mp *metaPartition) DeleteInode(req *DeleteInoReq, p *Packet) (err error) {
+	return mp.putOp(mp.prepareDeleteInode(req, p))
+}
+
+func (mp *metaPartition) prepareDeleteInode(req *DeleteInoReq, p *Packet) (op *preparedOp) {
+	op = &preparedOp{reply: p}
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	val, err := ino.Marshal()
 	if err != nil {
 		p.PackErrorWithBody(proto.OpErr, nil)
 		return
 	}
-	r, err := mp.Put(opDeleteInode, val)
-	if err != nil {
-		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
-		return
+	op.item = NewMetaItem(opDeleteInode, nil, val)
+	op.pack = func(resp interface{}) {
+		packDeleteInode(resp.(*ResponseInode), p)
 	}
-	msg := r.(*ResponseInode)
-	status := msg.Status
-	var reply []byte
+	return
+}
+
+func packDeleteInode(msg *ResponseInode, p *Packet) {
+	var (
+		status = msg.Status
+		reply  []byte
+		err    error
+	)
 	if status == proto.OpOk {
 		resp := &DeleteInoResp{
 			Info: &proto.InodeInfo{},
@@ -103,10 +138,12 @@ func (mp *metaPartition) DeleteInode(req *DeleteInoReq, p *Packet) (err error) {
 		}
 	}
 	p.PackErrorWithBody(status, reply)
-	return
 }
 
 func (mp *metaPartition) Open(req *OpenReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	val, err := ino.Marshal()
 	if err != nil {
@@ -123,6 +160,9 @@ func (mp *metaPartition) Open(req *OpenReq, p *Packet) (err error) {
 }
 
 func (mp *metaPartition) InodeGet(req *InodeGetReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	if err != nil {
 		p.PackErrorWithBody(proto.OpErr, nil)
@@ -138,17 +178,10 @@ func (mp *metaPartition) InodeGet(req *InodeGetReq, p *Packet) (err error) {
 		resp := &proto.InodeGetResponse{
 			Info: &proto.InodeInfo{},
 		}
-		resp.Info.Inode = ino.Inode
-		resp.Info.Mode = ino.Type
-		resp.Info.Size = ino.Size
-		resp.Info.Generation = ino.Generation
-		resp.Info.CreateTime = time.Unix(ino.CreateTime, 0)
-		resp.Info.AccessTime = time.Unix(ino.AccessTime, 0)
-		resp.Info.ModifyTime = time.Unix(ino.ModifyTime, 0)
-		resp.Info.Target = ino.LinkTarget
-		resp.Info.Nlink = ino.NLink
+		replyInfo(resp.Info, ino)
 		resp.Info.Uid = ino.Uid
 		resp.Info.Gid = ino.Gid
+		resp.Info.Inline = ino.Inline
 		reply, err = json.Marshal(resp)
 		if err != nil {
 			status = proto.OpErr
@@ -159,9 +192,17 @@ func (mp *metaPartition) InodeGet(req *InodeGetReq, p *Packet) (err error) {
 }
 
 func (mp *metaPartition) InodeGetBatch(req *InodeGetReqBatch, p *Packet) (err error) {
+	if mp.config.SplitFrom != 0 {
+		p.PackErrorWithBody(proto.OpAgain, []byte("importing split items"))
+		return
+	}
 	resp := &proto.BatchInodeGetResponse{}
 	ino := NewInode(0, 0)
 	for _, inoId := range req.Inodes {
+		// Inodes moved away by a split are left to the client to look up.
+		if !mp.inRange(inoId) {
+			continue
+		}
 		ino.Inode = inoId
 		retMsg := mp.getInode(ino)
 		if retMsg.Status == proto.OpOk {
@@ -177,6 +218,8 @@ func (mp *metaPartition) InodeGetBatch(req *InodeGetReqBatch, p *Packet) (err er
 			inoInfo.Nlink = retMsg.Msg.NLink
 			inoInfo.Uid = retMsg.Msg.Uid
 			inoInfo.Gid = retMsg.Msg.Gid
+			inoInfo.Flags = retMsg.Msg.Flags
+			inoInfo.Retention = retMsg.Msg.Retention
 			resp.Infos = append(resp.Infos, inoInfo)
 		}
 	}
@@ -190,6 +233,9 @@ func (mp *metaPartition) InodeGetBatch(req *InodeGetReqBatch, p *Packet) (err er
 }
 
 func (mp *metaPartition) CreateLinkInode(req *LinkInodeReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	val, err := ino.Marshal()
 	if err != nil {
@@ -219,6 +265,8 @@ func (mp *metaPartition) CreateLinkInode(req *LinkInodeReq, p *Packet) (err erro
 		resp.Info.Target = retMsg.Msg.LinkTarget
 		resp.Info.Uid = retMsg.Msg.Uid
 		resp.Info.Gid = retMsg.Msg.Gid
+		resp.Info.Flags = retMsg.Msg.Flags
+		resp.Info.Retention = retMsg.Msg.Retention
 		reply, err = json.Marshal(resp)
 		if err != nil {
 			status = proto.OpErr
@@ -229,6 +277,9 @@ func (mp *metaPartition) CreateLinkInode(req *LinkInodeReq, p *Packet) (err erro
 }
 
 func (mp *metaPartition) EvictInode(req *EvictInodeReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
 	val, err := ino.Marshal()
 	if err != nil {
@@ -246,11 +297,48 @@ func (mp *metaPartition) EvictInode(req *EvictInodeReq, p *Packet) (err error) {
 }
 
 func (mp *metaPartition) SetAttr(reqData []byte, p *Packet) (err error) {
-	_, err = mp.Put(opFSMSetAttr, reqData)
+	return mp.putOp(mp.prepareSetAttr(reqData, p))
+}
+
+func (mp *metaPartition) prepareSetAttr(reqData []byte, p *Packet) (op *preparedOp) {
+	op = &preparedOp{reply: p}
+	req := &SetattrRequest{}
+	if err := json.Unmarshal(reqData, req); err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
+	op.item = NewMetaItem(opFSMSetAttr, nil, reqData)
+	op.pack = func(resp interface{}) {
+		p.PackErrorWithBody(resp.(uint8), nil)
+	}
+	return
+}
+
+// WormCommit commits a file of a WORM volume. The retention deadline is
+// decided by the leader, so that all replicas agree on it.
+func (mp *metaPartition) WormCommit(req *WormCommitReq, p *Packet) (err error) {
+	if !mp.checkInode(req.Inode, p) {
+		return
+	}
+	if !mp.config.Worm.Enabled() {
+		p.PackErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	ino := NewInode(req.Inode, 0)
+	ino.Retention = ino.ModifyTime + mp.config.Worm.Retention
+	val, err := ino.Marshal()
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMWormCommit, val)
 	if err != nil {
 		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
 	}
-	p.PackOkReply()
+	p.PackErrorWithBody(resp.(uint8), nil)
 	return
 }
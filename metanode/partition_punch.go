@@ -0,0 +1,229 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// The space of the pieces punched out of a file is released on the
+// dataNodes only once the hole is committed, so the data of a punch which
+// fails is kept. The pieces freed by the hole are kept with the inode until
+// they are released, and dropped from it through raft afterwards. The
+// leader releases them right after the punch, the worker tries the pieces
+// left again with the backoff of the deleted inodes. The extents of a
+// deleted inode are released whole, its pieces are dropped.
+
+// punchQueue keeps the inodes which have punched pieces to be released. It
+// is filled by one scan of the inodes once the worker runs on the leader,
+// the inodes punched since are added as they are applied.
+type punchQueue struct {
+	sync.Mutex
+	inodes map[uint64]struct{}
+	filled bool
+}
+
+func newPunchQueue() *punchQueue {
+	return &punchQueue{inodes: make(map[uint64]struct{})}
+}
+
+// add queues inode ino if the queue is filled.
+func (q *punchQueue) add(ino uint64) {
+	q.Lock()
+	defer q.Unlock()
+	if q.filled {
+		q.inodes[ino] = struct{}{}
+	}
+}
+
+// take removes and returns the queued inodes, in order.
+func (q *punchQueue) take() (inodes []uint64) {
+	q.Lock()
+	defer q.Unlock()
+	for ino := range q.inodes {
+		inodes = append(inodes, ino)
+	}
+	if len(inodes) != 0 {
+		q.inodes = make(map[uint64]struct{})
+	}
+	sort.Slice(inodes, func(i, j int) bool { return inodes[i] < inodes[j] })
+	return
+}
+
+func (q *punchQueue) requeue(inodes []uint64) {
+	q.Lock()
+	defer q.Unlock()
+	for _, ino := range inodes {
+		q.inodes[ino] = struct{}{}
+	}
+}
+
+// reset drops the queue, it is filled again by the worker.
+func (q *punchQueue) reset() {
+	q.Lock()
+	defer q.Unlock()
+	q.inodes = make(map[uint64]struct{})
+	q.filled = false
+}
+
+// fill queues the inodes of the tree which have punched pieces, unless the
+// queue is filled already.
+func (q *punchQueue) fill(tree MetaTree) {
+	q.Lock()
+	defer q.Unlock()
+	if q.filled {
+		return
+	}
+	tree.Ascend(func(i BtreeItem) bool {
+		if ino := i.(*Inode); len(ino.Punched) != 0 {
+			q.inodes[ino.Inode] = struct{}{}
+		}
+		return true
+	})
+	q.filled = true
+}
+
+// releasePunched releases the punched pieces of inode ino on the dataNodes,
+// and drops them from the inode. The pieces are kept if one of them fails.
+func (mp *metaPartition) releasePunched(ino uint64, pieces []proto.ExtentKey) (err error) {
+	if len(pieces) == 0 {
+		return
+	}
+	if err = mp.punchDataPartitionHole(pieces); err != nil {
+		return
+	}
+	return mp.putPunchReleased([]reclaimItem{{Inode: ino, Extents: pieces}})
+}
+
+func (mp *metaPartition) putPunchReleased(items []reclaimItem) (err error) {
+	val, err := json.Marshal(items)
+	if err != nil {
+		return
+	}
+	_, err = mp.Put(opFSMPunchReleased, val)
+	return
+}
+
+// punchReleased drops the released pieces from the punched inodes.
+func (mp *metaPartition) punchReleased(items []reclaimItem) (status uint8) {
+	status = proto.OpOk
+	for _, item := range items {
+		ino, _ := mp.inodeTree.Get(NewInode(item.Inode, 0)).(*Inode)
+		if ino == nil || len(ino.Punched) == 0 {
+			continue
+		}
+		var left []proto.ExtentKey
+		for _, ek := range ino.Punched {
+			if !containsKey(item.Extents, ek) {
+				left = append(left, ek)
+			}
+		}
+		if len(left) == len(ino.Punched) {
+			continue
+		}
+		// The pieces may be referenced by an inode being stored.
+		ino.Punched = left
+		mp.dirty.markInode(ino.Inode)
+	}
+	return
+}
+
+func containsKey(keys []proto.ExtentKey, k proto.ExtentKey) bool {
+	for _, ek := range keys {
+		if ek == k {
+			return true
+		}
+	}
+	return false
+}
+
+// punchWorker releases the punched pieces left by the leader.
+func (mp *metaPartition) punchWorker() {
+	t := time.NewTicker(AsyncDeleteInterval)
+	for {
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-t.C:
+			if _, isLeader := mp.IsLeader(); !isLeader {
+				// The failures are retried at once by a new leader.
+				mp.punchRetry.reset()
+				break
+			}
+			mp.releasePunchedInodes(time.Now())
+		}
+	}
+}
+
+// releasePunchedInodes releases the punched pieces of the queued inodes
+// which are due by now.
+func (mp *metaPartition) releasePunchedInodes(now time.Time) {
+	mp.punches.fill(mp.getInodeTree())
+	var (
+		released []reclaimItem
+		pending  []uint64
+	)
+	for _, id := range mp.punches.take() {
+		// Inodes moved away by a split are released by their new
+		// partition.
+		if !mp.inRange(id) {
+			continue
+		}
+		ino, _ := mp.inodeTree.Get(NewInode(id, 0)).(*Inode)
+		if ino == nil || len(ino.Punched) == 0 {
+			mp.punchRetry.forget(id)
+			continue
+		}
+		pieces := ino.Punched
+		if ino.MarkDelete == 1 {
+			released = append(released, reclaimItem{Inode: id, Extents: pieces})
+			continue
+		}
+		if !mp.punchRetry.due(id, now) {
+			pending = append(pending, id)
+			continue
+		}
+		if err := mp.punchDataPartitionHole(pieces); err != nil {
+			mp.punchRetry.fail(id, err, now)
+			pending = append(pending, id)
+			continue
+		}
+		released = append(released, reclaimItem{Inode: id, Extents: pieces})
+	}
+	if len(released) == 0 {
+		mp.punches.requeue(pending)
+		return
+	}
+	if err := mp.putPunchReleased(released); err != nil {
+		log.LogWarnf("[releasePunchedInodes] raft commit released pieces "+
+			"of %v inodes: %s", len(released), err.Error())
+		for _, item := range released {
+			pending = append(pending, item.Inode)
+		}
+		mp.punches.requeue(pending)
+		return
+	}
+	mp.punches.requeue(pending)
+	for _, item := range released {
+		mp.punchRetry.forget(item.Inode)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// A deleted inode is kept in the inode tree marked deleted until its
+// extents are released on the dataNodes, so the pending deletions are
+// stored with the partition, and the free list is rebuilt from them after a
+// restart or a raft snapshot. The extents released by the leader are
+// dropped from the inode through raft, so that only the extents left are
+// released again after a leader change. An inode which fails is retried
+// with a backoff from ReclaimRetryMin to ReclaimRetryMax, the failures are
+// kept by the leader in memory.
+
+const (
+	ReclaimRetryMin = time.Minute
+	ReclaimRetryMax = time.Hour
+)
+
+// reclaimItem is the extents of deleted inode Inode released so far.
+type reclaimItem struct {
+	Inode   uint64            `json:"ino"`
+	Extents []proto.ExtentKey `json:"eks"`
+}
+
+type reclaimState struct {
+	attempts uint32
+	next     time.Time
+	err      string
+}
+
+// reclaimSet keeps the failures of the deleted inodes of the partition.
+type reclaimSet struct {
+	sync.Mutex
+	failures map[uint64]*reclaimState
+}
+
+func newReclaimSet() *reclaimSet {
+	return &reclaimSet{failures: make(map[uint64]*reclaimState)}
+}
+
+// due tells whether the extents of inode ino are to be released by now.
+func (s *reclaimSet) due(ino uint64, now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.failures[ino]
+	return !ok || !now.Before(st.next)
+}
+
+// fail records a failure of inode ino, and puts off the next attempt.
+func (s *reclaimSet) fail(ino uint64, err error, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.failures[ino]
+	if !ok {
+		st = &reclaimState{}
+		s.failures[ino] = st
+	}
+	st.attempts++
+	wait := ReclaimRetryMax
+	if st.attempts < 16 {
+		if wait = ReclaimRetryMin << (st.attempts - 1); wait > ReclaimRetryMax {
+			wait = ReclaimRetryMax
+		}
+	}
+	st.next = now.Add(wait)
+	st.err = err.Error()
+}
+
+func (s *reclaimSet) forget(ino uint64) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.failures, ino)
+}
+
+func (s *reclaimSet) reset() {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.failures) != 0 {
+		s.failures = make(map[uint64]*reclaimState)
+	}
+}
+
+func (s *reclaimSet) get(ino uint64) (st reclaimState, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+	if p, found := s.failures[ino]; found {
+		st, ok = *p, true
+	}
+	return
+}
+
+// putReclaim drops the released extents from the deleted inodes through
+// raft.
+func (mp *metaPartition) putReclaim(items []reclaimItem) (err error) {
+	val, err := json.Marshal(items)
+	if err != nil {
+		return
+	}
+	_, err = mp.Put(opFSMReclaimExtents, val)
+	return
+}
+
+// reclaimExtents drops the released extents from the deleted inodes, so
+// they are not released again.
+func (mp *metaPartition) reclaimExtents(items []reclaimItem) (status uint8) {
+	status = proto.OpOk
+	for _, item := range items {
+		ino, _ := mp.inodeTree.Get(NewInode(item.Inode, 0)).(*Inode)
+		if ino == nil || ino.MarkDelete != 1 {
+			continue
+		}
+		released := make(map[extentID]proto.ExtentKey, len(item.Extents))
+		for _, ek := range item.Extents {
+			released[newExtentID(ek)] = ek
+		}
+		dropped := make(map[extentID]struct{})
+		left := proto.NewStreamKey(ino.Inode)
+		ino.Extents.Range(func(i int, ek proto.ExtentKey) bool {
+			if ek.IsHole() {
+				return true
+			}
+			id := newExtentID(ek)
+			if _, ok := released[id]; ok {
+				dropped[id] = struct{}{}
+				return true
+			}
+			left.Extents = append(left.Extents, ek)
+			return true
+		})
+		if len(dropped) == 0 {
+			continue
+		}
+		for id := range dropped {
+			mp.extentRefs.UnrefExtent(released[id])
+		}
+		// The stream may be shared with an inode being stored.
+		ino.Extents = left
+		mp.dirty.markInode(ino.Inode)
+	}
+	return
+}
+
+// rebuildFreeList pushes the deleted inodes of the inode tree to the free
+// list, e.g. after a raft snapshot is applied.
+func (mp *metaPartition) rebuildFreeList() {
+	mp.freeList.Reset()
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		mp.checkAndInsertFreeList(i.(*Inode))
+		return true
+	})
+}
+
+// ReclaimFailure is a deleted inode of which some extents failed to be
+// released.
+type ReclaimFailure struct {
+	Inode    uint64 `json:"ino"`
+	Extents  int    `json:"extents"`
+	Attempts uint32 `json:"attempts"`
+	NextTry  int64  `json:"nextTry"`
+	Err      string `json:"err"`
+}
+
+// ReclaimStat is the backlog of the deleted inodes of a partition, the
+// failures are only known by the leader.
+type ReclaimStat struct {
+	PartitionID uint64           `json:"pid"`
+	Leader      bool             `json:"leader"`
+	Inodes      int              `json:"inodes"`
+	Extents     int              `json:"extents"`
+	Failures    []ReclaimFailure `json:"failures"`
+}
+
+func (mp *metaPartition) reclaimStat() (stat *ReclaimStat) {
+	stat = &ReclaimStat{PartitionID: mp.config.PartitionId}
+	_, stat.Leader = mp.IsLeader()
+	for _, i := range mp.freeList.Items() {
+		ino, _ := mp.inodeTree.Get(i).(*Inode)
+		if ino == nil || ino.MarkDelete != 1 {
+			continue
+		}
+		extents := len(inodeExtentIDs(ino))
+		stat.Inodes++
+		stat.Extents += extents
+		if st, ok := mp.reclaims.get(ino.Inode); ok {
+			stat.Failures = append(stat.Failures, ReclaimFailure{
+				Inode:    ino.Inode,
+				Extents:  extents,
+				Attempts: st.attempts,
+				NextTry:  st.next.Unix(),
+				Err:      st.err,
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestReclaimExtents(t *testing.T) {
+	mp := newTestPartition(t)
+	mode := proto.Mode(os.ModePerm)
+	ek1 := proto.ExtentKey{PartitionId: 1, ExtentId: 10, Size: 100}
+	ek2 := proto.ExtentKey{PartitionId: 1, ExtentId: 11, Size: 100}
+	deleted := NewInode(1, mode)
+	deleted.AppendExtents(ek1)
+	deleted.AppendExtents(ek2)
+	deleted.MarkDelete = 1
+	mp.createInode(deleted)
+	live := NewInode(2, mode)
+	live.AppendExtents(ek1)
+	mp.createInode(live)
+	mp.extentRefs.Rebuild(mp.inodeTree)
+
+	val, _ := json.Marshal([]reclaimItem{
+		{Inode: 1, Extents: []proto.ExtentKey{ek1}},
+		{Inode: 2, Extents: []proto.ExtentKey{ek1}},
+	})
+	if _, err := mp.applyItem(NewMetaItem(opFSMReclaimExtents, nil, val), 1); err != nil {
+		t.Fatal(err)
+	}
+	ino := mp.inodeTree.Get(NewInode(1, 0)).(*Inode)
+	if ino.Extents.GetExtentLen() != 1 || ino.Extents.Extents[0].ExtentId != ek2.ExtentId {
+		t.Fatalf("extents left %v", ino.Extents)
+	}
+	if refs := mp.extentRefs.Get(ek1); refs != 1 {
+		t.Fatalf("refs %v, expect 1", refs)
+	}
+	// Only the deleted inodes are reclaimed.
+	if n := mp.inodeTree.Get(NewInode(2, 0)).(*Inode).Extents.GetExtentLen(); n != 1 {
+		t.Fatalf("live inode extents %v", n)
+	}
+
+	// The progress is stored with the inode.
+	data, err := ino.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInode(0, 0)
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Extents.GetExtentLen() != 1 || loaded.MarkDelete != 1 {
+		t.Fatalf("loaded inode %v", loaded)
+	}
+
+	mp.rebuildFreeList()
+	if items := mp.freeList.Items(); len(items) != 1 || items[0].Inode != 1 {
+		t.Fatalf("free list %v", items)
+	}
+}
+
+func TestReclaimBackoff(t *testing.T) {
+	s := newReclaimSet()
+	now := time.Now()
+	if !s.due(1, now) {
+		t.Fatal("new inode not due")
+	}
+	s.fail(1, errors.New("dataNode down"), now)
+	s.fail(1, errors.New("dataNode down"), now)
+	if s.due(1, now.Add(ReclaimRetryMin)) || !s.due(1, now.Add(2*ReclaimRetryMin)) {
+		t.Fatal("second retry not after twice the minimum")
+	}
+	for i := 0; i < 20; i++ {
+		s.fail(1, errors.New("dataNode down"), now)
+	}
+	if st, ok := s.get(1); !ok || st.attempts != 22 || st.next != now.Add(ReclaimRetryMax) {
+		t.Fatalf("state %+v", st)
+	}
+	s.forget(1)
+	if !s.due(1, now) {
+		t.Fatal("forgotten inode not due")
+	}
+}
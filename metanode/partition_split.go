@@ -0,0 +1,389 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// A partition is split at an inode by the leader of the partition:
+//
+//  1. The end of the partition is set to the split inode through raft. From
+//     then on the replicas refuse to change the inodes after the end and the
+//     dentries of these inodes, see inRange.
+//  2. The inodes and dentries after the end are copied to the new partition,
+//     which refuses client requests until the last copy request is applied.
+//  3. The copied items are deleted from the partition through raft.
+//
+// Every step can be repeated, so a failed split is resent by the master.
+
+const (
+	splitImportBatch    = 1024
+	splitImportRetry    = 60
+	splitImportInterval = time.Second
+)
+
+// inRange tells whether the inode belongs to the inode range of the
+// partition.
+func (mp *metaPartition) inRange(ino uint64) bool {
+	return ino >= mp.config.Start && ino <= mp.config.End
+}
+
+// checkInode tells whether the partition serves a request on the inode.
+// If not the reply is packed: OpAgain while the partition imports the items
+// of a split, OpMovedErr if the inode is out of the range of the partition.
+func (mp *metaPartition) checkInode(ino uint64, p *Packet) (ok bool) {
+	if mp.config.SplitFrom != 0 {
+		p.PackErrorWithBody(proto.OpAgain, []byte("importing split items"))
+		return
+	}
+	if mp.inRange(ino) {
+		ok = true
+		return
+	}
+	reply, err := json.Marshal(&proto.MovedResponse{Inode: ino})
+	if err != nil {
+		p.PackErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PackErrorWithBody(proto.OpMovedErr, reply)
+	return
+}
+
+func (mp *metaPartition) SplitPartition(req *SplitPartitionReq,
+	resp *SplitPartitionResp) (err error) {
+	resp.PartitionID = req.PartitionID
+	resp.VolName = req.VolName
+	resp.NewPartitionID = req.NewPartitionID
+	resp.Status = proto.TaskFail
+	defer func() {
+		if err != nil {
+			resp.Result = err.Error()
+		}
+	}()
+	oldEnd := mp.config.End
+	if req.SplitAt < mp.config.Start || req.SplitAt > oldEnd {
+		err = errors.Errorf("[SplitPartition]: split inode %d out of range"+
+			" [%d, %d]", req.SplitAt, mp.config.Start, oldEnd)
+		return
+	}
+	// The partition is fenced already if the split is resent.
+	if req.SplitAt != oldEnd {
+		if err = mp.setEnd(req.SplitAt); err != nil {
+			return
+		}
+	}
+	tree := mp.getInodeTree()
+	id, shared := mp.sharedAcross(tree, req.SplitAt)
+	tree.Release()
+	if shared {
+		err = errors.Errorf("[SplitPartition]: extent %d of data partition"+
+			" %d is shared across inode %d", id.ExtentId, id.PartitionId,
+			req.SplitAt)
+		if req.SplitAt != oldEnd {
+			if e := mp.setEnd(oldEnd); e != nil {
+				log.LogErrorf("[SplitPartition] partition id=%d: %s",
+					mp.config.PartitionId, e.Error())
+			}
+		}
+		return
+	}
+	if err = mp.exportItems(req); err != nil {
+		return
+	}
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, req.SplitAt+1)
+	r, err := mp.Put(opFSMDeleteRange, start)
+	if err != nil {
+		return
+	}
+	if status := r.(uint8); status != proto.OpOk {
+		p := &Packet{}
+		p.ResultCode = status
+		err = errors.Errorf("[SplitPartition]: delete range: %s",
+			p.GetResultMesg())
+		return
+	}
+	resp.End = req.SplitAt
+	resp.Status = proto.TaskSuccess
+	return
+}
+
+func (mp *metaPartition) setEnd(end uint64) (err error) {
+	reqData, err := json.Marshal(&UpdatePartitionReq{
+		PartitionID: mp.config.PartitionId,
+		VolName:     mp.config.VolName,
+		End:         end,
+	})
+	if err != nil {
+		return
+	}
+	r, err := mp.Put(opUpdatePartition, reqData)
+	if err != nil {
+		return
+	}
+	if status := r.(uint8); status != proto.OpOk {
+		p := &Packet{}
+		p.ResultCode = status
+		err = errors.Errorf("[setEnd]: %s", p.GetResultMesg())
+	}
+	return
+}
+
+// sharedAcross finds an extent referenced by inodes on both sides of the
+// split inode. Each partition would free the extent while the other one
+// still uses it, so such a partition can not be split there.
+func (mp *metaPartition) sharedAcross(tree MetaTree, splitAt uint64) (id extentID, found bool) {
+	sides := make(map[extentID]uint8)
+	tree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		side := uint8(1)
+		if ino.Inode > splitAt {
+			side = 2
+		}
+		ino.Extents.Range(func(_ int, ek proto.ExtentKey) bool {
+			if ek.IsHole() || mp.extentRefs.Get(ek) < 2 {
+				return true
+			}
+			id = newExtentID(ek)
+			sides[id] |= side
+			found = sides[id] == 3
+			return !found
+		})
+		return !found
+	})
+	return
+}
+
+// exportItems copies the inodes after the split inode and their dentries
+// to the new partition.
+func (mp *metaPartition) exportItems(req *SplitPartitionReq) (err error) {
+	inoTree := mp.getInodeTree()
+	defer inoTree.Release()
+	dentryTree := mp.getDentryTree()
+	defer dentryTree.Release()
+	batch := &ImportItemsReq{
+		VolName:     req.VolName,
+		PartitionID: req.NewPartitionID,
+	}
+	send := func() bool {
+		if len(batch.Inodes)+len(batch.Dentries) < splitImportBatch {
+			return true
+		}
+		err = mp.sendImport(req.NewPeers, batch)
+		batch.Inodes = nil
+		batch.Dentries = nil
+		return err == nil
+	}
+	inoTree.AscendGreaterOrEqual(NewInode(req.SplitAt+1, 0),
+		func(i BtreeItem) bool {
+			var data []byte
+			if data, err = i.(*Inode).Marshal(); err != nil {
+				return false
+			}
+			batch.Inodes = append(batch.Inodes, data)
+			return send()
+		})
+	if err != nil {
+		return
+	}
+	dentryTree.AscendGreaterOrEqual(&Dentry{ParentId: req.SplitAt + 1},
+		func(i BtreeItem) bool {
+			var data []byte
+			if data, err = i.(*Dentry).Marshal(); err != nil {
+				return false
+			}
+			batch.Dentries = append(batch.Dentries, data)
+			return send()
+		})
+	if err != nil {
+		return
+	}
+	batch.Done = true
+	err = mp.sendImport(req.NewPeers, batch)
+	return
+}
+
+// sendImport sends the items to any member of the new partition, which
+// forwards them to its leader. The new partition may not be created or may
+// have no leader yet, so the request is retried for a while.
+func (mp *metaPartition) sendImport(peers []proto.Peer,
+	req *ImportItemsReq) (err error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	for i := 0; i < splitImportRetry; i++ {
+		for _, peer := range peers {
+			p := NewImportItemsPacket(data)
+			if err = mp.sendPacket(peer.Addr, p); err != nil {
+				continue
+			}
+			if p.ResultCode == proto.OpOk {
+				return
+			}
+			err = errors.Errorf("[sendImport]: partition id=%d on %s: %s",
+				req.PartitionID, peer.Addr, p.GetResultMesg())
+		}
+		time.Sleep(splitImportInterval)
+	}
+	return
+}
+
+// sendToPartition sends the packets made by newPacket to the members of
+// another partition, the leader first, until one is replied with OpOk. The
+// members forward the packet to their leader. The last reply is returned
+// if none succeeds.
+func (mp *metaPartition) sendToPartition(view *master.MetaPartitionView,
+	newPacket func() *Packet) (p *Packet, err error) {
+	addrs := view.Members
+	if view.LeaderAddr != "" {
+		addrs = append([]string{view.LeaderAddr}, addrs...)
+	}
+	err = errors.Errorf("[sendToPartition]: partition id=%d has no members",
+		view.PartitionID)
+	for _, addr := range addrs {
+		reply := newPacket()
+		if err = mp.sendPacket(addr, reply); err != nil {
+			continue
+		}
+		p = reply
+		if p.ResultCode == proto.OpOk {
+			return
+		}
+		err = errors.Errorf("[sendToPartition]: partition id=%d on %s: %s",
+			view.PartitionID, addr, p.GetResultMesg())
+	}
+	return
+}
+
+// refreshVol fetches the view of the meta partitions of the volume.
+func (mp *metaPartition) refreshVol() (err error) {
+	view, err := masterClient.GetVol(&master.VolRequest{Name: mp.config.VolName})
+	if err != nil {
+		return
+	}
+	mp.vol.UpdateMetaPartitions(view)
+	return
+}
+
+func (mp *metaPartition) sendPacket(addr string, p *Packet) (err error) {
+	conn, err := mp.config.ConnPool.Get(addr)
+	if err != nil {
+		return
+	}
+	if err = p.WriteToConn(conn); err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.NoReadDeadlineTime); err != nil {
+		mp.config.ConnPool.Put(conn, ForceCloseConnect)
+		return
+	}
+	mp.config.ConnPool.Put(conn, NoCloseConnect)
+	return
+}
+
+func (mp *metaPartition) ImportItems(req *ImportItemsReq, p *Packet) (err error) {
+	resp, err := mp.Put(opFSMImportItems, p.Data)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PackErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+// importItems inserts the items copied from the source partition of a
+// split. The copies are ignored once the import is done, since the
+// partition owns the items from then on.
+func (mp *metaPartition) importItems(req *ImportItemsReq) (status uint8, err error) {
+	status = proto.OpOk
+	if mp.config.SplitFrom == 0 {
+		return
+	}
+	for _, data := range req.Inodes {
+		ino := NewInode(0, 0)
+		if err = ino.Unmarshal(data); err != nil {
+			return
+		}
+		if !mp.inRange(ino.Inode) {
+			continue
+		}
+		mp.inodeTree.ReplaceOrInsert(ino, true)
+		mp.dirty.markInode(ino.Inode)
+		if mp.config.Cursor < ino.Inode {
+			mp.config.Cursor = ino.Inode
+		}
+	}
+	for _, data := range req.Dentries {
+		den := &Dentry{}
+		if err = den.Unmarshal(data); err != nil {
+			return
+		}
+		if !mp.inRange(den.ParentId) {
+			continue
+		}
+		mp.dentryTree.ReplaceOrInsert(den, true)
+		mp.dirty.markDentry(den)
+	}
+	if !req.Done {
+		return
+	}
+	mp.extentRefs.Rebuild(mp.inodeTree)
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		mp.checkAndInsertFreeList(i.(*Inode))
+		return true
+	})
+	splitFrom := mp.config.SplitFrom
+	mp.config.SplitFrom = 0
+	if err = mp.StoreMeta(); err != nil {
+		mp.config.SplitFrom = splitFrom
+		status = proto.OpDiskErr
+		err = nil
+	}
+	return
+}
+
+// deleteRange drops the inodes from start on and their dentries, after
+// they are moved to the new partition of a split.
+func (mp *metaPartition) deleteRange(start uint64) (status uint8) {
+	status = proto.OpOk
+	if start <= mp.config.End {
+		status = proto.OpArgMismatchErr
+		return
+	}
+	mp.inodeTree.AscendGreaterOrEqual(NewInode(start, 0),
+		func(i BtreeItem) bool {
+			mp.inodeTree.Delete(i)
+			mp.dirty.markInode(i.(*Inode).Inode)
+			return true
+		})
+	mp.dentryTree.AscendGreaterOrEqual(&Dentry{ParentId: start},
+		func(i BtreeItem) bool {
+			mp.dentryTree.Delete(i)
+			mp.dirty.markDentry(i.(*Dentry))
+			return true
+		})
+	mp.extentRefs.Rebuild(mp.inodeTree)
+	return
+}
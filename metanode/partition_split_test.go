@@ -0,0 +1,134 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestSplitMoveItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metapartition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mode := proto.Mode(os.ModePerm)
+	src := NewMetaPartition(&MetaPartitionConfig{
+		PartitionId: 1,
+		Start:       1,
+		End:         100,
+		Cursor:      60,
+	}).(*metaPartition)
+	for ino := uint64(1); ino <= 60; ino++ {
+		src.createInode(NewInode(ino, mode))
+		src.createDentry(&Dentry{ParentId: ino, Name: "a", Inode: ino})
+	}
+	dst := NewMetaPartition(&MetaPartitionConfig{
+		PartitionId: 2,
+		Start:       51,
+		End:         100,
+		Cursor:      51,
+		SplitFrom:   1,
+		RootDir:     dir,
+		Peers:       []proto.Peer{{ID: 1, Addr: "127.0.0.1"}},
+	}).(*metaPartition)
+
+	// Fence the source, the moved items can not be changed any more.
+	src.config.End = 50
+	if status := src.wormCommit(NewInode(55, 0)); status != proto.OpAgain {
+		t.Fatalf("change moved inode status %v", status)
+	}
+	if status := src.createDentry(&Dentry{ParentId: 55, Name: "b"}); status != proto.OpAgain {
+		t.Fatalf("create dentry of moved inode status %v", status)
+	}
+	p := &Packet{}
+	if src.checkInode(55, p) || p.ResultCode != proto.OpMovedErr {
+		t.Fatalf("request on moved inode result %v", p.GetResultMesg())
+	}
+
+	req := &ImportItemsReq{PartitionID: 2}
+	src.inodeTree.AscendGreaterOrEqual(NewInode(51, 0), func(i BtreeItem) bool {
+		data, _ := i.(*Inode).Marshal()
+		req.Inodes = append(req.Inodes, data)
+		return true
+	})
+	src.dentryTree.AscendGreaterOrEqual(&Dentry{ParentId: 51}, func(i BtreeItem) bool {
+		data, _ := i.(*Dentry).Marshal()
+		req.Dentries = append(req.Dentries, data)
+		return true
+	})
+	p = &Packet{}
+	if dst.checkInode(55, p) || p.ResultCode != proto.OpAgain {
+		t.Fatalf("request while importing result %v", p.GetResultMesg())
+	}
+	if status, err := dst.importItems(req); err != nil || status != proto.OpOk {
+		t.Fatalf("import status %v err %v", status, err)
+	}
+	req.Done = true
+	req.Inodes, req.Dentries = nil, nil
+	if status, err := dst.importItems(req); err != nil || status != proto.OpOk {
+		t.Fatalf("import done status %v err %v", status, err)
+	}
+	if dst.config.SplitFrom != 0 || dst.config.Cursor != 60 {
+		t.Fatalf("split from %v cursor %v", dst.config.SplitFrom, dst.config.Cursor)
+	}
+	if !dst.checkInode(55, &Packet{}) {
+		t.Fatalf("imported inode is not served")
+	}
+	if dst.inodeTree.Len() != 10 || dst.dentryTree.Len() != 10 {
+		t.Fatalf("imported %v inodes %v dentries", dst.inodeTree.Len(),
+			dst.dentryTree.Len())
+	}
+
+	if status := src.deleteRange(50); status != proto.OpArgMismatchErr {
+		t.Fatalf("delete served range status %v", status)
+	}
+	if status := src.deleteRange(51); status != proto.OpOk {
+		t.Fatalf("delete range status %v", status)
+	}
+	if src.inodeTree.Len() != 50 || src.dentryTree.Len() != 50 {
+		t.Fatalf("kept %v inodes %v dentries", src.inodeTree.Len(),
+			src.dentryTree.Len())
+	}
+}
+
+func TestSplitSharedExtent(t *testing.T) {
+	mp := newTestPartition(t)
+	mode := proto.Mode(os.ModePerm)
+	src := NewInode(10, mode)
+	src.AppendExtents(proto.ExtentKey{PartitionId: 1, ExtentId: 10, Size: 100})
+	mp.createInode(src)
+	mp.createInode(NewInode(20, mode))
+	mp.createInode(NewInode(60, mode))
+	if status := mp.cloneExtents(&CloneExtentsReq{SrcInode: 10, DstInode: 20, Size: math.MaxUint64}).Status; status != proto.OpOk {
+		t.Fatalf("clone status %v", status)
+	}
+	if _, found := mp.sharedAcross(mp.inodeTree, 50); found {
+		t.Fatalf("extent shared below the split inode is reported")
+	}
+	mp.inodeTree.Delete(NewInode(20, 0))
+	dst := NewInode(60, mode)
+	dst.AppendExtents(proto.ExtentKey{PartitionId: 1, ExtentId: 10, Size: 100})
+	mp.inodeTree.ReplaceOrInsert(dst, true)
+	mp.extentRefs.Rebuild(mp.inodeTree)
+	if id, found := mp.sharedAcross(mp.inodeTree, 50); !found || id.ExtentId != 10 {
+		t.Fatalf("extent shared across the split inode is not reported")
+	}
+}
@@ -15,7 +15,6 @@
 package metanode
 
 import (
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -69,6 +68,8 @@ func (mp *metaPartition) loadMeta() (err error) {
 	mp.config.Start = mConf.Start
 	mp.config.End = mConf.End
 	mp.config.Peers = mConf.Peers
+	mp.config.StoreMode = mConf.StoreMode
+	mp.config.SplitFrom = mConf.SplitFrom
 	return
 }
 
@@ -85,24 +86,17 @@ func (mp *metaPartition) loadInode() (err error) {
 		return
 	}
 	defer fp.Close()
-	lenBuf := make([]byte, 4)
+	reader, err := newSnapshotReader(fp, filename)
+	if err != nil {
+		return
+	}
 	for {
-		// First read length
-		_, err = io.ReadFull(fp, lenBuf)
-		if err != nil {
+		var buf []byte
+		if buf, err = reader.ReadRecord(); err != nil {
 			if err == io.EOF {
+				mp.baseApplyID = reader.applyID
 				err = nil
-				return
 			}
-			err = errors.Errorf("[loadInode] ReadHeader: %s", err.Error())
-			return
-		}
-		length := binary.BigEndian.Uint32(lenBuf)
-		// Now Read Body
-		buf := make([]byte, length)
-		_, err = io.ReadFull(fp, buf)
-		if err != nil {
-			err = errors.Errorf("[loadInode] ReadBody: %s", err.Error())
 			return
 		}
 		ino := NewInode(0, 0)
@@ -111,49 +105,42 @@ func (mp *metaPartition) loadInode() (err error) {
 			return
 		}
 		mp.createInode(ino)
-		mp.checkAndInsertFreeList(ino)
-		if mp.config.Cursor < ino.Inode {
-			mp.config.Cursor = ino.Inode
-		}
 	}
 }
 
-// Load dentry from dentry snapshot file
+// Load dentry from dentry snapshot file, it has to be written together with
+// the inode file.
 func (mp *metaPartition) loadDentry() (err error) {
 	filename := path.Join(mp.config.RootDir, dentryFile)
 	if _, err = os.Stat(filename); err != nil {
 		err = nil
+		if mp.baseApplyID != 0 {
+			err = &corruptFileError{file: filename, reason: "missing"}
+		}
 		return
 	}
 	fp, err := os.OpenFile(filename, os.O_RDONLY, 0644)
 	if err != nil {
-		if err == os.ErrNotExist {
-			err = nil
-			return
-		}
 		err = errors.Errorf("[loadDentry] OpenFile: %s", err.Error())
 		return
 	}
 	defer fp.Close()
-	lenBuf := make([]byte, 4)
+	reader, err := newSnapshotReader(fp, filename)
+	if err != nil {
+		return
+	}
 	for {
-		// First Read 4byte header length
-		_, err = io.ReadFull(fp, lenBuf)
-		if err != nil {
-			if err == io.EOF {
-				err = nil
+		var buf []byte
+		if buf, err = reader.ReadRecord(); err != nil {
+			if err != io.EOF {
 				return
 			}
-			err = errors.Errorf("[loadDentry] ReadHeader: %s", err.Error())
-			return
-		}
-
-		length := binary.BigEndian.Uint32(lenBuf)
-		// Now Read Body Data
-		buf := make([]byte, length)
-		_, err = io.ReadFull(fp, buf)
-		if err != nil {
-			err = errors.Errorf("[loadDentry]: ReadBody: %s", err.Error())
+			err = nil
+			if reader.applyID != mp.baseApplyID {
+				err = &corruptFileError{file: filename, reason: fmt.
+					Sprintf("applyID %d, inode file has %d",
+						reader.applyID, mp.baseApplyID)}
+			}
 			return
 		}
 		dentry := &Dentry{}
@@ -162,7 +149,8 @@ func (mp *metaPartition) loadDentry() (err error) {
 			return
 		}
 		if mp.createDentry(dentry) != proto.OpOk {
-			err = errors.Errorf("[loadDentry]->%s", err.Error())
+			err = errors.Errorf("[loadDentry] duplicate dentry %d/%s",
+				dentry.ParentId, dentry.Name)
 			return
 		}
 	}
@@ -174,23 +162,39 @@ func (mp *metaPartition) loadApplyID() (err error) {
 		err = nil
 		return
 	}
-	data, err := ioutil.ReadFile(filename)
+	fp, err := os.OpenFile(filename, os.O_RDONLY, 0644)
 	if err != nil {
-		if err == os.ErrNotExist {
-			err = nil
-			return
-		}
 		err = errors.Errorf("[loadApplyID] OpenFile: %s", err.Error())
 		return
 	}
-	if len(data) == 0 {
-		err = errors.Errorf("[loadApplyID]: ApplyID is empty")
+	defer fp.Close()
+	reader, err := newSnapshotReader(fp, filename)
+	if err != nil {
+		return
+	}
+	if reader.version == snapshotLegacyVersion {
+		var data []byte
+		if data, err = reader.ReadAll(); err != nil {
+			err = errors.Errorf("[loadApplyID] ReadFile: %s", err.Error())
+			return
+		}
+		if len(data) == 0 {
+			err = reader.corrupt("applyID is empty")
+			return
+		}
+		if _, err = fmt.Sscanf(string(data), "%d", &mp.applyID); err != nil {
+			err = reader.corrupt("read applyID: %s", err.Error())
+		}
 		return
 	}
-	if _, err = fmt.Sscanf(string(data), "%d", &mp.applyID); err != nil {
-		err = errors.Errorf("[loadApplyID] ReadApplyID: %s", err.Error())
+	if _, err = reader.ReadRecord(); err != io.EOF {
+		if err == nil {
+			err = reader.corrupt("unexpected record")
+		}
 		return
 	}
+	err = nil
+	mp.applyID = reader.applyID
 	return
 }
 
@@ -230,11 +234,17 @@ func (mp *metaPartition) storeApplyID(sm *storeMsg) (err error) {
 		return
 	}
 	defer func() {
-		fp.Sync()
 		fp.Close()
 		os.Remove(filename)
 	}()
-	if _, err = fp.WriteString(fmt.Sprintf("%d", sm.applyIndex)); err != nil {
+	writer, err := newSnapshotWriter(fp)
+	if err != nil {
+		return
+	}
+	if err = writer.Close(sm.applyIndex); err != nil {
+		return
+	}
+	if err = fp.Sync(); err != nil {
 		return
 	}
 	err = os.Rename(filename, path.Join(mp.config.RootDir, applyIDFile))
@@ -249,26 +259,22 @@ func (mp *metaPartition) storeInode(sm *storeMsg) (err error) {
 		return
 	}
 	defer func() {
-		fp.Sync()
 		fp.Close()
 		if err != nil {
 			os.RemoveAll(filename)
 		}
 	}()
+	writer, err := newSnapshotWriter(fp)
+	if err != nil {
+		return
+	}
 	sm.inodeTree.Ascend(func(i btree.Item) bool {
 		var data []byte
-		lenBuf := make([]byte, 4)
 		ino := i.(*Inode)
 		if data, err = ino.Marshal(); err != nil {
 			return false
 		}
-		// Set Length
-		binary.BigEndian.PutUint32(lenBuf, uint32(len(data)))
-		if _, err = fp.Write(lenBuf); err != nil {
-			return false
-		}
-		// Set Body Data
-		if _, err = fp.Write(data); err != nil {
+		if err = writer.WriteRecord(data); err != nil {
 			return false
 		}
 		return true
@@ -276,6 +282,12 @@ func (mp *metaPartition) storeInode(sm *storeMsg) (err error) {
 	if err != nil {
 		return
 	}
+	if err = writer.Close(sm.applyIndex); err != nil {
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		return
+	}
 	err = os.Rename(filename, path.Join(mp.config.RootDir, inodeFile))
 	return
 }
@@ -288,24 +300,21 @@ func (mp *metaPartition) storeDentry(sm *storeMsg) (err error) {
 		return
 	}
 	defer func() {
-		fp.Sync()
 		fp.Close()
 		os.Remove(filename)
 	}()
+	writer, err := newSnapshotWriter(fp)
+	if err != nil {
+		return
+	}
 	sm.dentryTree.Ascend(func(i btree.Item) bool {
 		var data []byte
-		lenBuf := make([]byte, 4)
 		dentry := i.(*Dentry)
 		data, err = dentry.Marshal()
 		if err != nil {
 			return false
 		}
-		// Set Length
-		binary.BigEndian.PutUint32(lenBuf, uint32(len(data)))
-		if _, err = fp.Write(lenBuf); err != nil {
-			return false
-		}
-		if _, err = fp.Write(data); err != nil {
+		if err = writer.WriteRecord(data); err != nil {
 			return false
 		}
 		return true
@@ -313,6 +322,12 @@ func (mp *metaPartition) storeDentry(sm *storeMsg) (err error) {
 	if err != nil {
 		return
 	}
+	if err = writer.Close(sm.applyIndex); err != nil {
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		return
+	}
 	err = os.Rename(filename, path.Join(mp.config.RootDir, dentryFile))
 	return
 }
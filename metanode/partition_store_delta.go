@@ -0,0 +1,343 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	deltaFilePrefix = "delta_"
+	deltaFileTmp    = ".delta"
+	// Merge the delta files into the base image once there are that many.
+	deltaMergeThreshold = 8
+)
+
+// dirtySet records the inodes and dentries changed since the last store
+// tick, only these are written to the next delta file.
+type dirtySet struct {
+	sync.Mutex
+	inodes   map[uint64]struct{}
+	dentries map[string]*Dentry
+}
+
+func newDirtySet() *dirtySet {
+	return &dirtySet{
+		inodes:   make(map[uint64]struct{}),
+		dentries: make(map[string]*Dentry),
+	}
+}
+
+func (s *dirtySet) markInode(ino uint64) {
+	s.Lock()
+	s.inodes[ino] = struct{}{}
+	s.Unlock()
+}
+
+func (s *dirtySet) markDentry(d *Dentry) {
+	key := &Dentry{ParentId: d.ParentId, Name: d.Name}
+	s.Lock()
+	s.dentries[string(key.MarshalKey())] = key
+	s.Unlock()
+}
+
+// swap hands out the recorded changes and starts a new empty record.
+func (s *dirtySet) swap() (old *dirtySet) {
+	old = newDirtySet()
+	s.Lock()
+	s.inodes, old.inodes = old.inodes, s.inodes
+	s.dentries, old.dentries = old.dentries, s.dentries
+	s.Unlock()
+	return
+}
+
+func (s *dirtySet) reset() {
+	s.swap()
+}
+
+// merge adds the changes of an older record which has not been stored.
+func (s *dirtySet) merge(old *dirtySet) {
+	if old == nil {
+		return
+	}
+	s.Lock()
+	for ino := range old.inodes {
+		s.inodes[ino] = struct{}{}
+	}
+	for key, d := range old.dentries {
+		s.dentries[key] = d
+	}
+	s.Unlock()
+}
+
+func deltaFileName(applyIndex uint64) string {
+	return fmt.Sprintf("%s%d", deltaFilePrefix, applyIndex)
+}
+
+// listDeltaFiles returns the apply indexes of the delta files in ascending
+// order.
+func (mp *metaPartition) listDeltaFiles() (indexes []uint64, err error) {
+	fileInfos, err := ioutil.ReadDir(mp.config.RootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, fi := range fileInfos {
+		if fi.IsDir() || !strings.HasPrefix(fi.Name(), deltaFilePrefix) {
+			continue
+		}
+		index, parseErr := strconv.ParseUint(
+			strings.TrimPrefix(fi.Name(), deltaFilePrefix), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+	return
+}
+
+// Replay all delta files on top of the base image.
+func (mp *metaPartition) loadDelta() (err error) {
+	indexes, err := mp.listDeltaFiles()
+	if err != nil {
+		err = errors.Errorf("[loadDelta] ReadDir: %s", err.Error())
+		return
+	}
+	for _, index := range indexes {
+		if err = mp.loadDeltaFile(index); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (mp *metaPartition) loadDeltaFile(index uint64) (err error) {
+	filename := path.Join(mp.config.RootDir, deltaFileName(index))
+	fp, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		err = errors.Errorf("[loadDeltaFile] OpenFile: %s", err.Error())
+		return
+	}
+	defer fp.Close()
+	reader, err := newSnapshotReader(fp, filename)
+	if err != nil {
+		return
+	}
+	if reader.version == snapshotLegacyVersion {
+		// Delta files were introduced along with the header.
+		err = reader.corrupt("missing header")
+		return
+	}
+	for {
+		var buf []byte
+		if buf, err = reader.ReadRecord(); err != nil {
+			if err != io.EOF {
+				return
+			}
+			err = nil
+			if reader.applyID != index {
+				err = reader.corrupt("applyID %d", reader.applyID)
+			}
+			return
+		}
+		item := NewMetaItem(0, nil, nil)
+		if err = item.UnmarshalBinary(buf); err != nil {
+			err = errors.Errorf("[loadDeltaFile] %s Unmarshal: %s",
+				filename, err.Error())
+			return
+		}
+		if err = mp.applyDeltaItem(item); err != nil {
+			err = errors.Errorf("[loadDeltaFile] %s: %s", filename,
+				err.Error())
+			return
+		}
+	}
+}
+
+func (mp *metaPartition) applyDeltaItem(item *MetaItem) (err error) {
+	switch item.Op {
+	case opCreateInode, opDeleteInode:
+		ino := NewInode(0, 0)
+		if err = ino.UnmarshalKey(item.K); err != nil {
+			return
+		}
+		if item.Op == opDeleteInode {
+			mp.inodeTree.Delete(ino)
+			return
+		}
+		if err = ino.UnmarshalValue(item.V); err != nil {
+			return
+		}
+		mp.inodeTree.ReplaceOrInsert(ino, true)
+	case opCreateDentry, opDeleteDentry:
+		dentry := &Dentry{}
+		if err = dentry.UnmarshalKey(item.K); err != nil {
+			return
+		}
+		if item.Op == opDeleteDentry {
+			mp.dentryTree.Delete(dentry)
+			return
+		}
+		if err = dentry.UnmarshalValue(item.V); err != nil {
+			return
+		}
+		mp.dentryTree.ReplaceOrInsert(dentry, true)
+	default:
+		err = fmt.Errorf("unknown op=%d", item.Op)
+	}
+	return
+}
+
+// storeDelta writes the inodes and dentries changed since the last store
+// tick. A changed item missing from the trees is written as a deletion.
+func (mp *metaPartition) storeDelta(sm *storeMsg) (err error) {
+	filename := path.Join(mp.config.RootDir, deltaFileTmp)
+	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_TRUNC|os.O_APPEND|os.
+		O_CREATE, 0755)
+	if err != nil {
+		return
+	}
+	defer func() {
+		fp.Close()
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+	writer, err := newSnapshotWriter(fp)
+	if err != nil {
+		return
+	}
+	write := func(item *MetaItem) (err error) {
+		data, err := item.MarshalBinary()
+		if err != nil {
+			return
+		}
+		err = writer.WriteRecord(data)
+		return
+	}
+	if sm.dirty != nil {
+		for id := range sm.dirty.inodes {
+			ino := NewInode(id, 0)
+			item := NewMetaItem(opDeleteInode, ino.MarshalKey(), nil)
+			if i := sm.inodeTree.Get(ino); i != nil {
+				ino = i.(*Inode)
+				item = NewMetaItem(opCreateInode, ino.MarshalKey(),
+					ino.MarshalValue())
+			}
+			if err = write(item); err != nil {
+				return
+			}
+		}
+		for _, dentry := range sm.dirty.dentries {
+			item := NewMetaItem(opDeleteDentry, dentry.MarshalKey(), nil)
+			if i := sm.dentryTree.Get(dentry); i != nil {
+				d := i.(*Dentry)
+				item = NewMetaItem(opCreateDentry, d.MarshalKey(),
+					d.MarshalValue())
+			}
+			if err = write(item); err != nil {
+				return
+			}
+		}
+	}
+	if err = writer.Close(sm.applyIndex); err != nil {
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		return
+	}
+	err = os.Rename(filename, path.Join(mp.config.RootDir,
+		deltaFileName(sm.applyIndex)))
+	return
+}
+
+// storeBase writes the full trees of the store message as the base image
+// and drops the delta files it covers.
+func (mp *metaPartition) storeBase(sm *storeMsg) (err error) {
+	mp.baseLock.Lock()
+	defer mp.baseLock.Unlock()
+	if !sm.full && sm.applyIndex <= mp.baseApplyID {
+		return
+	}
+	if err = mp.storeInode(sm); err != nil {
+		return
+	}
+	if err = mp.storeDentry(sm); err != nil {
+		return
+	}
+	mp.baseApplyID = sm.applyIndex
+	upTo := sm.applyIndex
+	if sm.full {
+		// The trees have been replaced by a raft snapshot, none of
+		// the delta files applies any more.
+		upTo = math.MaxUint64
+	}
+	mp.deleteDeltaFiles(upTo)
+	return
+}
+
+// mergeDelta folds the delta files into the base image in the background
+// once enough of them have piled up. The base image is rewritten from the
+// trees of the store message, which already include all the deltas up to
+// its apply index.
+func (mp *metaPartition) mergeDelta(sm *storeMsg) {
+	indexes, err := mp.listDeltaFiles()
+	if err != nil || len(indexes) < deltaMergeThreshold {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&mp.merging, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreUint32(&mp.merging, 0)
+		if err := mp.storeBase(sm); err != nil {
+			log.LogErrorf("[mergeDelta] partition id=%d, applyID=%d: %s",
+				mp.config.PartitionId, sm.applyIndex, err.Error())
+			return
+		}
+		log.LogDebugf("[mergeDelta] partition id=%d merged %d delta "+
+			"files up to applyID=%d", mp.config.PartitionId,
+			len(indexes), sm.applyIndex)
+	}()
+}
+
+// deleteDeltaFiles removes the delta files up to the apply index.
+func (mp *metaPartition) deleteDeltaFiles(applyIndex uint64) {
+	indexes, _ := mp.listDeltaFiles()
+	for _, index := range indexes {
+		if index > applyIndex {
+			break
+		}
+		os.Remove(path.Join(mp.config.RootDir, deltaFileName(index)))
+	}
+}
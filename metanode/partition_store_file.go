@@ -0,0 +1,239 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// Layout of the inode, dentry, delta and applyID files:
+//
+//	header:  magic(4) | version(4)
+//	record:  length(4) | crc32(4) | body(length)
+//	trailer: 0xFFFFFFFF(4) | count(8) | applyID(8) | crc32(4)
+//
+// A file is only valid if it ends right after a trailer whose record count
+// matches the records read before it.
+//
+// Files written before the header was introduced are read as version 0:
+// inode and dentry files are a plain sequence of length(4) | body(length),
+// the applyID file holds the decimal applyID.
+const (
+	snapshotMagic   uint32 = 0x4346534d // "CFSM"
+	snapshotVersion uint32 = 1
+
+	snapshotLegacyVersion uint32 = 0
+
+	snapshotTrailerMark = math.MaxUint32
+	// Upper bound of a single record, larger lengths mean the file is
+	// corrupt.
+	snapshotMaxRecord = 1 << 30
+)
+
+// corruptFileError is returned when a metadata file fails verification.
+// The partition does not load such files, it starts empty and catches up
+// from a snapshot of the raft leader instead.
+type corruptFileError struct {
+	file   string
+	reason string
+}
+
+func (e *corruptFileError) Error() string {
+	return fmt.Sprintf("corrupt metadata file %s: %s", e.file, e.reason)
+}
+
+func isCorruptFile(err error) bool {
+	_, ok := err.(*corruptFileError)
+	return ok
+}
+
+type snapshotWriter struct {
+	w     *bufio.Writer
+	count uint64
+}
+
+// newSnapshotWriter writes the file header to w.
+func newSnapshotWriter(w io.Writer) (sw *snapshotWriter, err error) {
+	sw = &snapshotWriter{w: bufio.NewWriter(w)}
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], snapshotMagic)
+	binary.BigEndian.PutUint32(header[4:8], snapshotVersion)
+	_, err = sw.w.Write(header)
+	return
+}
+
+func (sw *snapshotWriter) WriteRecord(data []byte) (err error) {
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(head[4:8], crc32.ChecksumIEEE(data))
+	if _, err = sw.w.Write(head); err != nil {
+		return
+	}
+	if _, err = sw.w.Write(data); err != nil {
+		return
+	}
+	sw.count++
+	return
+}
+
+// Close writes the trailer and flushes the buffered records, the caller
+// still has to sync and close the underlying file.
+func (sw *snapshotWriter) Close(applyID uint64) (err error) {
+	trailer := make([]byte, 24)
+	binary.BigEndian.PutUint32(trailer[0:4], snapshotTrailerMark)
+	binary.BigEndian.PutUint64(trailer[4:12], sw.count)
+	binary.BigEndian.PutUint64(trailer[12:20], applyID)
+	binary.BigEndian.PutUint32(trailer[20:24],
+		crc32.ChecksumIEEE(trailer[4:20]))
+	if _, err = sw.w.Write(trailer); err != nil {
+		return
+	}
+	err = sw.w.Flush()
+	return
+}
+
+type snapshotReader struct {
+	r       *bufio.Reader
+	name    string
+	version uint32
+	count   uint64
+	applyID uint64 // Valid once ReadRecord returned io.EOF
+}
+
+// newSnapshotReader verifies the file header of r. A file without header
+// is read as version 0.
+func newSnapshotReader(r io.Reader, name string) (sr *snapshotReader,
+	err error) {
+	sr = &snapshotReader{r: bufio.NewReader(r), name: name}
+	header, err := sr.r.Peek(8)
+	if len(header) < 4 || binary.BigEndian.Uint32(header[0:4]) != snapshotMagic {
+		sr.version = snapshotLegacyVersion
+		err = nil
+		return
+	}
+	if err != nil {
+		err = sr.corrupt("read header: %s", err.Error())
+		return
+	}
+	sr.r.Discard(8)
+	if sr.version = binary.BigEndian.Uint32(header[4:8]); sr.version != snapshotVersion {
+		err = sr.corrupt("unsupported version %d", sr.version)
+		return
+	}
+	return
+}
+
+// ReadAll returns the remaining content of a version 0 file.
+func (sr *snapshotReader) ReadAll() (data []byte, err error) {
+	return ioutil.ReadAll(sr.r)
+}
+
+// ReadRecord returns the next record of the file. It returns io.EOF once
+// the trailer has been read and verified.
+func (sr *snapshotReader) ReadRecord() (data []byte, err error) {
+	if sr.version == snapshotLegacyVersion {
+		return sr.readLegacyRecord()
+	}
+	head := make([]byte, 8)
+	if _, err = io.ReadFull(sr.r, head[0:4]); err != nil {
+		err = sr.corrupt("record %d: missing trailer: %s", sr.count,
+			err.Error())
+		return
+	}
+	length := binary.BigEndian.Uint32(head[0:4])
+	if length == snapshotTrailerMark {
+		err = sr.readTrailer()
+		return
+	}
+	if length > snapshotMaxRecord {
+		err = sr.corrupt("record %d: length %d", sr.count, length)
+		return
+	}
+	if _, err = io.ReadFull(sr.r, head[4:8]); err != nil {
+		err = sr.corrupt("record %d: read crc: %s", sr.count, err.Error())
+		return
+	}
+	data = make([]byte, length)
+	if _, err = io.ReadFull(sr.r, data); err != nil {
+		err = sr.corrupt("record %d: read body: %s", sr.count, err.Error())
+		return
+	}
+	if crc := crc32.ChecksumIEEE(data); crc != binary.BigEndian.Uint32(
+		head[4:8]) {
+		err = sr.corrupt("record %d: crc mismatch", sr.count)
+		return
+	}
+	sr.count++
+	return
+}
+
+// readLegacyRecord reads a record of a version 0 file, which ends at the
+// end of its last record.
+func (sr *snapshotReader) readLegacyRecord() (data []byte, err error) {
+	head := make([]byte, 4)
+	if _, err = io.ReadFull(sr.r, head); err != nil {
+		if err != io.EOF {
+			err = sr.corrupt("record %d: read length: %s", sr.count,
+				err.Error())
+		}
+		return
+	}
+	length := binary.BigEndian.Uint32(head)
+	if length > snapshotMaxRecord {
+		err = sr.corrupt("record %d: length %d", sr.count, length)
+		return
+	}
+	data = make([]byte, length)
+	if _, err = io.ReadFull(sr.r, data); err != nil {
+		err = sr.corrupt("record %d: read body: %s", sr.count, err.Error())
+		return
+	}
+	sr.count++
+	return
+}
+
+func (sr *snapshotReader) readTrailer() (err error) {
+	trailer := make([]byte, 20)
+	if _, err = io.ReadFull(sr.r, trailer); err != nil {
+		err = sr.corrupt("read trailer: %s", err.Error())
+		return
+	}
+	if crc32.ChecksumIEEE(trailer[0:16]) != binary.BigEndian.Uint32(
+		trailer[16:20]) {
+		err = sr.corrupt("trailer crc mismatch")
+		return
+	}
+	if count := binary.BigEndian.Uint64(trailer[0:8]); count != sr.count {
+		err = sr.corrupt("trailer expects %d records, read %d", count,
+			sr.count)
+		return
+	}
+	if _, err = sr.r.ReadByte(); err != io.EOF {
+		err = sr.corrupt("data after trailer")
+		return
+	}
+	sr.applyID = binary.BigEndian.Uint64(trailer[8:16])
+	return
+}
+
+func (sr *snapshotReader) corrupt(format string, a ...interface{}) error {
+	return &corruptFileError{file: sr.name, reason: fmt.Sprintf(format, a...)}
+}
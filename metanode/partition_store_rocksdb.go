@@ -0,0 +1,78 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"path"
+)
+
+const (
+	rocksDBDir = "rocksdb"
+	// Items stored at once while applying a raft snapshot.
+	rocksRestoreBatch = 4096
+)
+
+// loadRocks opens the rocksdb instance of a partition stored in rocksdb,
+// which replaces the inode, dentry, link and applyID files. The extent
+// reference counts are loaded from it too, they are only counted from the
+// inodes if the instance was written before they were stored.
+func (mp *metaPartition) loadRocks() (err error) {
+	dir := path.Join(mp.config.RootDir, rocksDBDir)
+	if mp.rocks == nil {
+		if mp.rocks, err = openRocksStore(dir); err != nil {
+			return
+		}
+		mp.inodeTree = mp.rocks.inodes
+		mp.dentryTree = mp.rocks.dentries
+	}
+	applyID, restoring, err := mp.rocks.applyID()
+	if err != nil {
+		return
+	}
+	if restoring {
+		err = &corruptFileError{file: dir, reason: "interrupted while " +
+			"applying a raft snapshot"}
+		return
+	}
+	mp.applyID = applyID
+	refs, stored, err := mp.rocks.loadExtentRefs()
+	if err != nil {
+		return
+	}
+	mp.rocks.refs = mp.extentRefs
+	mp.extentRefs.track(refs)
+	if !stored {
+		// Stored with the next flush.
+		mp.extentRefs.Rebuild(mp.inodeTree)
+	}
+	mp.rocks.links = mp.links
+	mp.links.reset()
+	links, err := mp.rocks.get(rocksLinksKey)
+	if err != nil || links == nil {
+		return
+	}
+	if err = mp.links.unmarshal(links); err != nil {
+		err = &corruptFileError{file: dir, reason: "unmarshal link state: " +
+			err.Error()}
+	}
+	return
+}
+
+func (mp *metaPartition) closeRocks() {
+	if mp.rocks != nil {
+		mp.rocks.Close()
+		mp.rocks = nil
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+func TestStoreDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metapartition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newPartition := func() *metaPartition {
+		return NewMetaPartition(&MetaPartitionConfig{
+			PartitionId: 1,
+			VolName:     "vol",
+			Start:       1,
+			End:         100,
+			Peers:       []proto.Peer{{ID: 1, Addr: "127.0.0.1:9021"}},
+			RootDir:     dir,
+		}).(*metaPartition)
+	}
+	storeTick := func(mp *metaPartition, index uint64) *storeMsg {
+		sm := &storeMsg{
+			command:    opStoreTick,
+			applyIndex: index,
+			inodeTree:  mp.getInodeTree(),
+			dentryTree: mp.getDentryTree(),
+			dirty:      mp.dirty.swap(),
+		}
+		if err := mp.store(sm); err != nil {
+			t.Fatal(err)
+		}
+		return sm
+	}
+	mode := proto.Mode(os.ModePerm)
+	mp := newPartition()
+	if err = mp.storeMeta(); err != nil {
+		t.Fatal(err)
+	}
+	mp.createInode(NewInode(1, proto.Mode(os.ModePerm|os.ModeDir)))
+	mp.createInode(NewInode(2, mode))
+	mp.createInode(NewInode(3, mode))
+	mp.createDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2, Type: mode})
+	mp.createDentry(&Dentry{ParentId: 1, Name: "b", Inode: 3, Type: mode})
+	storeTick(mp, 10)
+
+	mp.deleteDentry(&Dentry{ParentId: 1, Name: "a"})
+	mp.internalDeleteInode(NewInode(2, 0))
+	mp.setAttr(&SetattrRequest{Inode: 3, Valid: proto.AttrUid, Uid: 7})
+	sm := storeTick(mp, 20)
+	// Nothing changed, the delta is empty.
+	storeTick(mp, 30)
+
+	check := func(name string) {
+		loaded := newPartition()
+		if err := loaded.load(); err != nil {
+			t.Fatalf("%s: load %v", name, err)
+		}
+		if loaded.applyID != 30 || loaded.config.Cursor != 3 {
+			t.Fatalf("%s: applyID %v cursor %v", name, loaded.applyID,
+				loaded.config.Cursor)
+		}
+		if loaded.inodeTree.Len() != 2 || loaded.dentryTree.Len() != 1 {
+			t.Fatalf("%s: inodes %v dentries %v", name,
+				loaded.inodeTree.Len(), loaded.dentryTree.Len())
+		}
+		resp := loaded.getInode(NewInode(3, 0))
+		if resp.Status != proto.OpOk || resp.Msg.Uid != 7 {
+			t.Fatalf("%s: inode 3 %v %v", name, resp.Status, resp.Msg)
+		}
+		if _, status := loaded.getDentry(&Dentry{ParentId: 1,
+			Name: "a"}); status != proto.OpNotExistErr {
+			t.Fatalf("%s: deleted dentry status %v", name, status)
+		}
+	}
+	check("delta")
+	indexes, _ := mp.listDeltaFiles()
+	if len(indexes) != 3 {
+		t.Fatalf("delta files %v", indexes)
+	}
+
+	// Merging the deltas up to 20 leaves the delta of 30 on top of the
+	// base image.
+	if err = mp.storeBase(sm); err != nil {
+		t.Fatal(err)
+	}
+	indexes, _ = mp.listDeltaFiles()
+	if len(indexes) != 1 || indexes[0] != 30 {
+		t.Fatalf("delta files after merge %v", indexes)
+	}
+	check("merged")
+}
+
+func TestLoadCorruptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metapartition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newPartition := func() *metaPartition {
+		return NewMetaPartition(&MetaPartitionConfig{
+			PartitionId: 1,
+			VolName:     "vol",
+			Start:       1,
+			End:         100,
+			Peers:       []proto.Peer{{ID: 1, Addr: "127.0.0.1:9021"}},
+			RootDir:     dir,
+		}).(*metaPartition)
+	}
+	mp := newPartition()
+	if err = mp.storeMeta(); err != nil {
+		t.Fatal(err)
+	}
+	mp.createInode(NewInode(1, proto.Mode(os.ModePerm|os.ModeDir)))
+	mp.createInode(NewInode(2, proto.Mode(os.ModePerm)))
+	mp.createDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2,
+		Type: proto.Mode(os.ModePerm)})
+	if err = mp.store(&storeMsg{
+		command:    opStoreTick,
+		applyIndex: 10,
+		inodeTree:  mp.getInodeTree(),
+		dentryTree: mp.getDentryTree(),
+		full:       true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newPartition()
+	if err = loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.applyID != 10 || loaded.baseApplyID != 10 ||
+		loaded.inodeTree.Len() != 2 || loaded.dentryTree.Len() != 1 {
+		t.Fatalf("applyID %v base %v inodes %v dentries %v",
+			loaded.applyID, loaded.baseApplyID, loaded.inodeTree.Len(),
+			loaded.dentryTree.Len())
+	}
+
+	filename := path.Join(dir, inodeFile)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(name string, content []byte) {
+		if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := newPartition().load(); !isCorruptFile(err) {
+			t.Fatalf("%s: load %v", name, err)
+		}
+	}
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	corrupt("flipped", flipped)
+	corrupt("torn", data[:len(data)-10])
+	corrupt("no trailer", data[:len(data)-24])
+	version := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(version[4:8], snapshotVersion+1)
+	corrupt("version", version)
+
+	// The partition starts empty instead, so that the raft leader sends it
+	// a snapshot.
+	recovered := newPartition()
+	if err = recovered.loadOrReset(); err != nil {
+		t.Fatal(err)
+	}
+	if recovered.applyID != 0 || recovered.inodeTree.Len() != 0 ||
+		recovered.dentryTree.Len() != 0 {
+		t.Fatalf("applyID %v inodes %v dentries %v", recovered.applyID,
+			recovered.inodeTree.Len(), recovered.dentryTree.Len())
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("corrupt file left: %v", err)
+	}
+	if err = newPartition().loadOrReset(); err != nil {
+		t.Fatalf("load after reset: %v", err)
+	}
+}
+
+func TestLoadLegacyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metapartition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mp := NewMetaPartition(&MetaPartitionConfig{
+		PartitionId: 1,
+		VolName:     "vol",
+		Start:       1,
+		End:         100,
+		Peers:       []proto.Peer{{ID: 1, Addr: "127.0.0.1:9021"}},
+		RootDir:     dir,
+	}).(*metaPartition)
+	if err = mp.storeMeta(); err != nil {
+		t.Fatal(err)
+	}
+	// Files are written like before the header was introduced.
+	writeRecords := func(name string, records ...[]byte) {
+		var buf bytes.Buffer
+		for _, data := range records {
+			binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+			buf.Write(data)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirIno, _ := NewInode(1, proto.Mode(os.ModePerm|os.ModeDir)).Marshal()
+	fileIno, _ := NewInode(2, proto.Mode(os.ModePerm)).Marshal()
+	writeRecords(inodeFile, dirIno, fileIno)
+	dentry, _ := (&Dentry{ParentId: 1, Name: "a", Inode: 2,
+		Type: proto.Mode(os.ModePerm)}).Marshal()
+	writeRecords(dentryFile, dentry)
+	if err = ioutil.WriteFile(path.Join(dir, applyIDFile), []byte("10"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = mp.load(); err != nil {
+		t.Fatal(err)
+	}
+	if mp.applyID != 10 || mp.inodeTree.Len() != 2 || mp.dentryTree.Len() != 1 {
+		t.Fatalf("applyID %v inodes %v dentries %v", mp.applyID,
+			mp.inodeTree.Len(), mp.dentryTree.Len())
+	}
+}
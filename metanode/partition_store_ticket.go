@@ -25,8 +25,23 @@ import (
 type storeMsg struct {
 	command    uint32
 	applyIndex uint64
-	inodeTree  *BTree
-	dentryTree *BTree
+	inodeTree  MetaTree
+	dentryTree MetaTree
+	dirty      *dirtySet // Changes since the previous store tick
+	links      []byte    // Pending link changes
+	full       bool      // Store the full trees instead of a delta
+}
+
+// merge takes over the changes of an older message which is dropped in
+// favour of this one.
+func (sm *storeMsg) merge(old *storeMsg) {
+	if old.full {
+		sm.full = true
+	}
+	if sm.dirty == nil {
+		sm.dirty = newDirtySet()
+	}
+	sm.dirty.merge(old.dirty)
 }
 
 func (mp *metaPartition) startSchedule(curIndex uint64) {
@@ -71,15 +86,20 @@ func (mp *metaPartition) startSchedule(curIndex uint64) {
 				return
 
 			case <-readyChan:
-				idx := -1
-				for i, msg := range msgs {
+				var last *storeMsg
+				for _, msg := range msgs {
 					if curIndex >= msg.applyIndex {
 						continue
 					}
-					idx = i
+					// Only the last message is stored, keep
+					// the changes recorded by the others.
+					if last != nil {
+						msg.merge(last)
+					}
+					last = msg
 				}
-				if idx >= 0 {
-					go dumpFunc(msgs[idx])
+				if last != nil {
+					go dumpFunc(last)
 				}
 				msgs = nil
 			case msg := <-mp.storeChan:
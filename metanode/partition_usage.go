@@ -0,0 +1,233 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// A directory keeps the recursive usage of its tree, that is the bytes of
+// the files and the number of files and directories under it. A change is
+// recorded for the directory of the dentry or file it comes from, and the
+// leader adds the changes to their directories in the background. Once
+// added to a directory, a change is recorded for its parent in turn, so it
+// climbs the tree one level per UsageFlushInterval. The changes are not
+// persisted until they are added, those pending on a leader which steps
+// down are lost, so the usage is an estimate. The usage of a tree created
+// before the upgrade is counted from then on.
+
+const (
+	UsageFlushInterval = 5 * time.Second
+	TopDirsInterval    = 10 * time.Minute
+	// TopDirsCount is the number of the largest directories reported to
+	// the master by a partition.
+	TopDirsCount = 10
+)
+
+// usageSet collects the usage changes of directories, and the largest
+// directories of the partition found last.
+type usageSet struct {
+	sync.Mutex
+	deltas  map[uint64]*proto.DirUsage
+	topDirs []proto.InodeUsage
+}
+
+func newUsageSet() *usageSet {
+	return &usageSet{deltas: make(map[uint64]*proto.DirUsage)}
+}
+
+func (s *usageSet) add(ino uint64, u proto.DirUsage) {
+	s.Lock()
+	defer s.Unlock()
+	d, ok := s.deltas[ino]
+	if !ok {
+		d = &proto.DirUsage{}
+		s.deltas[ino] = d
+	}
+	d.Bytes += u.Bytes
+	d.Files += u.Files
+	d.Dirs += u.Dirs
+}
+
+// swap returns the changes collected so far and starts a new set.
+func (s *usageSet) swap() (deltas map[uint64]*proto.DirUsage) {
+	s.Lock()
+	defer s.Unlock()
+	deltas = s.deltas
+	s.deltas = make(map[uint64]*proto.DirUsage)
+	return
+}
+
+func (s *usageSet) setTopDirs(dirs []proto.InodeUsage) {
+	s.Lock()
+	defer s.Unlock()
+	s.topDirs = dirs
+}
+
+func (s *usageSet) getTopDirs() []proto.InodeUsage {
+	s.Lock()
+	defer s.Unlock()
+	return s.topDirs
+}
+
+// entryUsage is the usage which n dentries of mode add to their directory.
+func entryUsage(mode uint32, n int64) (u proto.DirUsage) {
+	if proto.IsDir(mode) {
+		u.Dirs = n
+	} else {
+		u.Files = n
+	}
+	return
+}
+
+// addUsage records a usage change of directory dir.
+func (mp *metaPartition) addUsage(dir uint64, u proto.DirUsage) {
+	if dir == 0 || u == (proto.DirUsage{}) {
+		return
+	}
+	mp.usage.add(dir, u)
+}
+
+// addBytes records the size change of file ino for its directory.
+func (mp *metaPartition) addBytes(ino *Inode, oldSize uint64) {
+	mp.addUsage(ino.Parent, proto.DirUsage{Bytes: int64(ino.Size) - int64(oldSize)})
+}
+
+// moveUsage moves the usage of ino from its parent to the new parent, once
+// ino is renamed. The dentry itself is counted by the dentry operations.
+func (mp *metaPartition) moveUsage(ino *Inode, parent uint64) {
+	if ino.Parent == parent {
+		return
+	}
+	u := proto.DirUsage{Bytes: int64(ino.Size)}
+	if proto.IsDir(ino.Type) {
+		u = ino.Usage
+	}
+	mp.addUsage(parent, u)
+	u.Bytes, u.Files, u.Dirs = -u.Bytes, -u.Files, -u.Dirs
+	mp.addUsage(ino.Parent, u)
+	ino.Parent = parent
+}
+
+// applyUsage adds the changes to the directories, and records them for
+// their parents. The directories which are gone are skipped.
+func (mp *metaPartition) applyUsage(req *UpdateUsageReq) (status uint8) {
+	status = proto.OpOk
+	for _, d := range req.Deltas {
+		if !mp.inRange(d.Inode) {
+			continue
+		}
+		ino, _ := mp.inodeTree.Get(NewInode(d.Inode, 0)).(*Inode)
+		if ino == nil || !proto.IsDir(ino.Type) {
+			continue
+		}
+		ino.Usage.Bytes += d.Bytes
+		ino.Usage.Files += d.Files
+		ino.Usage.Dirs += d.Dirs
+		mp.dirty.markInode(ino.Inode)
+		mp.addUsage(ino.Parent, d.DirUsage)
+	}
+	return
+}
+
+// UpdateUsage applies the usage changes sent by another meta partition.
+func (mp *metaPartition) UpdateUsage(req *UpdateUsageReq, p *Packet) (err error) {
+	resp, err := mp.Put(opFSMUpdateUsage, p.Data)
+	if err != nil {
+		p.PackErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PackErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+// TopDirs returns the largest directories of the partition, nil if the
+// partition is not the leader.
+func (mp *metaPartition) TopDirs() []proto.InodeUsage {
+	return mp.usage.getTopDirs()
+}
+
+func (mp *metaPartition) startUsageWorker() {
+	sender := newAsyncSender(mp, "flushUsage", opFSMUpdateUsage,
+		NewUpdateUsagePacket)
+	go mp.runAsync(UsageFlushInterval, func(isLeader bool) {
+		// The followers drop their changes, the same changes are
+		// recorded by the leader.
+		deltas := mp.usage.swap()
+		if isLeader && len(deltas) != 0 {
+			mp.flushUsage(sender, deltas)
+		}
+	})
+	go mp.runAsync(TopDirsInterval, func(isLeader bool) {
+		if !isLeader {
+			mp.usage.setTopDirs(nil)
+			return
+		}
+		mp.usage.setTopDirs(mp.largestDirs(TopDirsCount))
+	})
+}
+
+// flushUsage adds the changes to their directories, the changes which are
+// not sent are kept for the next round.
+func (mp *metaPartition) flushUsage(sender *asyncSender,
+	deltas map[uint64]*proto.DirUsage) {
+	list := make([]proto.InodeUsage, 0, len(deltas))
+	for ino, u := range deltas {
+		list = append(list, proto.InodeUsage{Inode: ino, DirUsage: *u})
+	}
+	failed := sender.send(len(list), func(i int) uint64 {
+		return list[i].Inode
+	}, func(partitionID uint64, indexes []int) interface{} {
+		req := &UpdateUsageReq{
+			VolName:     mp.config.VolName,
+			PartitionID: partitionID,
+		}
+		for _, i := range indexes {
+			req.Deltas = append(req.Deltas, list[i])
+		}
+		return req
+	})
+	for _, i := range failed {
+		mp.usage.add(list[i].Inode, list[i].DirUsage)
+	}
+}
+
+// largestDirs returns the n directories of the partition with the most
+// bytes, the largest first.
+func (mp *metaPartition) largestDirs(n int) (dirs []proto.InodeUsage) {
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		if !proto.IsDir(ino.Type) || ino.Usage.Bytes <= 0 {
+			return true
+		}
+		if len(dirs) == n && dirs[n-1].Bytes >= ino.Usage.Bytes {
+			return true
+		}
+		k := sort.Search(len(dirs), func(k int) bool {
+			return dirs[k].Bytes < ino.Usage.Bytes
+		})
+		if len(dirs) < n {
+			dirs = append(dirs, proto.InodeUsage{})
+		}
+		copy(dirs[k+1:], dirs[k:])
+		dirs[k] = proto.InodeUsage{Inode: ino.Inode, DirUsage: ino.Usage}
+		return true
+	})
+	return
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// flushLocalUsage adds the recorded changes like the usage worker does,
+// until they reach the root.
+func flushLocalUsage(mp *metaPartition) {
+	for deltas := mp.usage.swap(); len(deltas) != 0; deltas = mp.usage.swap() {
+		req := &UpdateUsageReq{}
+		for ino, u := range deltas {
+			req.Deltas = append(req.Deltas, proto.InodeUsage{Inode: ino, DirUsage: *u})
+		}
+		mp.applyUsage(req)
+	}
+}
+
+func TestDirUsage(t *testing.T) {
+	mp := newTestPartition(t)
+	dirMode := proto.Mode(os.ModeDir | os.ModePerm)
+	root := NewInode(1, dirMode)
+	dir := NewInode(2, dirMode)
+	dir.Parent = 1
+	file := NewInode(3, proto.Mode(os.ModePerm))
+	file.Parent = 2
+	mp.createInode(root)
+	mp.createInode(dir)
+	mp.createInode(file)
+	mp.createDentry(&Dentry{ParentId: 1, Name: "dir", Inode: 2, Type: dirMode})
+	mp.createDentry(&Dentry{ParentId: 2, Name: "file", Inode: 3, Type: file.Type})
+	if status := mp.inlineWrite(&InlineWriteReq{Inode: 3, Data: make([]byte, 100)}); status != proto.OpOk {
+		t.Fatalf("inline write status %v", status)
+	}
+	flushLocalUsage(mp)
+	if u := (proto.DirUsage{Bytes: 100, Files: 1, Dirs: 1}); root.Usage != u {
+		t.Fatalf("root usage %v", root.Usage)
+	}
+	if u := (proto.DirUsage{Bytes: 100, Files: 1}); dir.Usage != u {
+		t.Fatalf("dir usage %v", dir.Usage)
+	}
+
+	// Rename the file to the root.
+	mp.deleteDentry(&Dentry{ParentId: 2, Name: "file"})
+	mp.createDentry(&Dentry{ParentId: 1, Name: "file", Inode: 3, Type: file.Type})
+	if status := mp.setAttr(&SetattrRequest{Inode: 3, Valid: proto.AttrParent, Parent: 1}); status != proto.OpOk {
+		t.Fatalf("set parent status %v", status)
+	}
+	flushLocalUsage(mp)
+	if u := (proto.DirUsage{Bytes: 100, Files: 1, Dirs: 1}); root.Usage != u {
+		t.Fatalf("root usage after rename %v", root.Usage)
+	}
+	if dir.Usage != (proto.DirUsage{}) {
+		t.Fatalf("dir usage after rename %v", dir.Usage)
+	}
+	if top := mp.largestDirs(1); len(top) != 1 || top[0].Inode != 1 || top[0].Bytes != 100 {
+		t.Fatalf("largest dirs %v", top)
+	}
+
+	mp.deleteDentry(&Dentry{ParentId: 1, Name: "file"})
+	mp.deleteInode(NewInode(3, 0))
+	mp.evictInode(NewInode(3, 0))
+	flushLocalUsage(mp)
+	if u := (proto.DirUsage{Dirs: 1}); root.Usage != u {
+		t.Fatalf("root usage after unlink %v", root.Usage)
+	}
+	data, err := root.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInode(0, 0)
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Usage != root.Usage || loaded.Parent != root.Parent {
+		t.Fatalf("unmarshal inode %v", loaded)
+	}
+}
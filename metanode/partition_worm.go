@@ -0,0 +1,210 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/btree"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	WormAutoCommitInterval = time.Minute
+)
+
+// wormCandidate is a file to be committed automatically, ordered by the
+// modify time it had when it was queued.
+type wormCandidate struct {
+	modifyTime int64
+	inode      uint64
+}
+
+func (c *wormCandidate) Less(than btree.Item) bool {
+	o := than.(*wormCandidate)
+	return c.modifyTime < o.modifyTime ||
+		c.modifyTime == o.modifyTime && c.inode < o.inode
+}
+
+// wormQueue keeps the regular files which are not committed yet, so the
+// worker only visits those whose modify time is old enough. It is filled
+// by one scan of the inodes once the worker runs on the leader, the files
+// created since are added as they are applied. A file modified after it
+// was queued is queued again when it is visited.
+type wormQueue struct {
+	sync.Mutex
+	tree   *btree.BTree
+	filled bool
+}
+
+func newWormQueue() *wormQueue {
+	return &wormQueue{tree: btree.New(defaultBTreeDegree)}
+}
+
+// add queues the inode if the queue is filled and the inode may be
+// committed.
+func (q *wormQueue) add(ino *Inode) {
+	if !proto.IsRegular(ino.Type) || ino.IsWormCommitted() {
+		return
+	}
+	q.Lock()
+	defer q.Unlock()
+	if q.filled {
+		q.tree.ReplaceOrInsert(&wormCandidate{modifyTime: ino.ModifyTime,
+			inode: ino.Inode})
+	}
+}
+
+// due removes and returns the candidates modified up to deadline.
+func (q *wormQueue) due(deadline int64) (candidates []*wormCandidate) {
+	q.Lock()
+	defer q.Unlock()
+	for {
+		c, _ := q.tree.Min().(*wormCandidate)
+		if c == nil || c.modifyTime > deadline {
+			return
+		}
+		q.tree.DeleteMin()
+		candidates = append(candidates, c)
+	}
+}
+
+func (q *wormQueue) requeue(candidates []*wormCandidate) {
+	q.Lock()
+	defer q.Unlock()
+	for _, c := range candidates {
+		q.tree.ReplaceOrInsert(c)
+	}
+}
+
+// reset drops the queue, it is filled again by the worker.
+func (q *wormQueue) reset() {
+	q.Lock()
+	defer q.Unlock()
+	q.tree = btree.New(defaultBTreeDegree)
+	q.filled = false
+}
+
+// fill queues the inodes of the tree, unless the queue is filled already.
+func (q *wormQueue) fill(tree MetaTree) {
+	q.Lock()
+	defer q.Unlock()
+	if q.filled {
+		return
+	}
+	tree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		if proto.IsRegular(ino.Type) && !ino.IsWormCommitted() {
+			q.tree.ReplaceOrInsert(&wormCandidate{
+				modifyTime: ino.ModifyTime, inode: ino.Inode})
+		}
+		return true
+	})
+	q.filled = true
+}
+
+func (mp *metaPartition) startWormWorker() {
+	if mp.config.Worm.AutoCommit <= 0 {
+		return
+	}
+	go mp.wormAutoCommitWorker()
+}
+
+// wormAutoCommitWorker commits the files which have not been modified for
+// the auto commit period of the volume, in case they are never closed.
+func (mp *metaPartition) wormAutoCommitWorker() {
+	t := time.NewTicker(WormAutoCommitInterval)
+	for {
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-t.C:
+			if _, isLeader := mp.IsLeader(); !isLeader {
+				break
+			}
+			mp.wormAutoCommit(time.Now().Unix())
+		}
+	}
+}
+
+// wormAutoCommit commits the queued files not modified since deadline, in
+// batches of proto.MaxBatchItems.
+func (mp *metaPartition) wormAutoCommit(now int64) {
+	mp.worm.fill(mp.getInodeTree())
+	deadline := now - mp.config.Worm.AutoCommit
+	candidates := mp.worm.due(deadline)
+	var (
+		items   []*MetaItem
+		pending []*wormCandidate
+	)
+	flush := func(rest []*wormCandidate) bool {
+		if len(items) == 0 {
+			return true
+		}
+		if err := mp.putWormCommits(items); err != nil {
+			log.LogErrorf("[wormAutoCommit] partition(%v) %v inodes: %v",
+				mp.config.PartitionId, len(items), err)
+			// Tried again in the next round.
+			mp.worm.requeue(pending)
+			mp.worm.requeue(rest)
+			return false
+		}
+		log.LogDebugf("[wormAutoCommit] partition(%v) committed %v inodes",
+			mp.config.PartitionId, len(items))
+		items, pending = items[:0], pending[:0]
+		return true
+	}
+	for k, c := range candidates {
+		ino, _ := mp.inodeTree.Get(NewInode(c.inode, 0)).(*Inode)
+		if ino == nil || ino.MarkDelete == 1 || ino.IsWormCommitted() {
+			continue
+		}
+		if ino.ModifyTime > deadline {
+			mp.worm.requeue([]*wormCandidate{{modifyTime: ino.ModifyTime,
+				inode: ino.Inode}})
+			continue
+		}
+		req := NewInode(c.inode, 0)
+		req.Retention = now + mp.config.Worm.Retention
+		val, err := req.Marshal()
+		if err != nil {
+			log.LogErrorf("[wormAutoCommit] partition(%v) inode(%v): %v",
+				mp.config.PartitionId, c.inode, err)
+			continue
+		}
+		items = append(items, NewMetaItem(opFSMWormCommit, nil, val))
+		pending = append(pending, c)
+		if len(items) == proto.MaxBatchItems && !flush(candidates[k+1:]) {
+			return
+		}
+	}
+	flush(nil)
+}
+
+func (mp *metaPartition) putWormCommits(items []*MetaItem) (err error) {
+	if len(items) == 0 {
+		return
+	}
+	val, err := json.Marshal(items)
+	if err != nil {
+		return
+	}
+	_, err = mp.Put(opFSMBatch, val)
+	return
+}
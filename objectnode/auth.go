@@ -0,0 +1,334 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// AWS signature version 4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+const (
+	signV4Algorithm  = "AWS4-HMAC-SHA256"
+	signV4Terminator = "aws4_request"
+	iso8601Format    = "20060102T150405Z"
+	yyyymmdd         = "20060102"
+	serviceS3        = "s3"
+
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	emptySHA256      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxRequestSkew    = 15 * time.Minute
+	maxPresignExpires = 7 * 24 * 3600 // seconds
+)
+
+// errContentSHA256Mismatch is returned by the body of a request once it is
+// read to the end and does not match its x-amz-content-sha256.
+var errContentSHA256Mismatch = errors.New("x-amz-content-sha256 mismatch")
+
+// signature is the signature V4 of a request, either in the Authorization
+// header or in the query of a presigned URL.
+type signature struct {
+	accessKey     string
+	date          string // yyyymmdd of the credential scope
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	payloadHash   string
+	presigned     bool
+	expires       int64 // seconds, presigned only
+}
+
+func (s *signature) scope() string {
+	return strings.Join([]string{s.date, s.region, s.service, signV4Terminator}, "/")
+}
+
+// parseCredential parses "<access key>/<date>/<region>/<service>/aws4_request".
+func (s *signature) parseCredential(credential string) bool {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != signV4Terminator || parts[0] == "" {
+		return false
+	}
+	s.accessKey, s.date, s.region, s.service = parts[0], parts[1], parts[2], parts[3]
+	return true
+}
+
+// parseSignature parses the signature V4 of r.
+func parseSignature(r *http.Request) (s *signature, aerr *apiError) {
+	authorization := r.Header.Get(HeaderAuthorization)
+	query := r.URL.Query()
+	switch {
+	case strings.HasPrefix(authorization, signV4Algorithm+" "):
+		return parseHeaderSignature(r, strings.TrimPrefix(authorization, signV4Algorithm+" "))
+	case query.Get("X-Amz-Algorithm") == signV4Algorithm:
+		return parsePresignedSignature(r, query)
+	case authorization != "" || query.Get("AWSAccessKeyId") != "":
+		return nil, ErrUnsupportedSignatureVer
+	default:
+		return nil, ErrAccessDenied
+	}
+}
+
+func parseHeaderSignature(r *http.Request, authorization string) (s *signature, aerr *apiError) {
+	s = &signature{}
+	for _, field := range strings.Split(authorization, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrAuthorizationMalformed
+		}
+		switch kv[0] {
+		case "Credential":
+			if !s.parseCredential(kv[1]) {
+				return nil, ErrAuthorizationMalformed
+			}
+		case "SignedHeaders":
+			s.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			s.signature = kv[1]
+		}
+	}
+	if s.accessKey == "" || len(s.signedHeaders) == 0 || s.signature == "" {
+		return nil, ErrAuthorizationMalformed
+	}
+
+	var err error
+	if date := r.Header.Get(HeaderAmzDate); date != "" {
+		s.amzDate, err = time.Parse(iso8601Format, date)
+	} else {
+		s.amzDate, err = http.ParseTime(r.Header.Get(HeaderDate))
+	}
+	if err != nil || s.amzDate.UTC().Format(yyyymmdd) != s.date {
+		return nil, ErrAuthorizationMalformed
+	}
+
+	// The payload hash is required by S3, a request without it is taken as
+	// one without a body.
+	if s.payloadHash = r.Header.Get(HeaderAmzContentSHA256); s.payloadHash == "" {
+		s.payloadHash = emptySHA256
+	}
+	return s, nil
+}
+
+func parsePresignedSignature(r *http.Request, query url.Values) (s *signature, aerr *apiError) {
+	s = &signature{presigned: true}
+	if !s.parseCredential(query.Get("X-Amz-Credential")) {
+		return nil, ErrMalformedPresignedRequest
+	}
+	if s.signature = query.Get("X-Amz-Signature"); s.signature == "" {
+		return nil, ErrMalformedPresignedRequest
+	}
+	if headers := query.Get("X-Amz-SignedHeaders"); headers != "" {
+		s.signedHeaders = strings.Split(headers, ";")
+	} else {
+		return nil, ErrMalformedPresignedRequest
+	}
+	var err error
+	if s.amzDate, err = time.Parse(iso8601Format, query.Get("X-Amz-Date")); err != nil ||
+		s.amzDate.Format(yyyymmdd) != s.date {
+		return nil, ErrMalformedPresignedRequest
+	}
+	if s.expires, err = strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64); err != nil ||
+		s.expires < 0 || s.expires > maxPresignExpires {
+		return nil, ErrMalformedPresignedRequest
+	}
+	if s.payloadHash = r.Header.Get(HeaderAmzContentSHA256); s.payloadHash == "" {
+		s.payloadHash = unsignedPayload
+	}
+	return s, nil
+}
+
+// checkTime checks the signing time of the request against now.
+func (s *signature) checkTime(now time.Time) *apiError {
+	if s.presigned {
+		if now.Before(s.amzDate.Add(-maxRequestSkew)) {
+			return ErrRequestTimeTooSkewed
+		}
+		if now.After(s.amzDate.Add(time.Duration(s.expires) * time.Second)) {
+			return ErrExpiredPresignRequest
+		}
+		return nil
+	}
+	if skew := now.Sub(s.amzDate); skew > maxRequestSkew || skew < -maxRequestSkew {
+		return ErrRequestTimeTooSkewed
+	}
+	return nil
+}
+
+// computeSignature returns the signature of r signed with secretKey.
+func computeSignature(r *http.Request, s *signature, secretKey string) string {
+	stringToSign := strings.Join([]string{
+		signV4Algorithm,
+		s.amzDate.UTC().Format(iso8601Format),
+		s.scope(),
+		hexSHA256([]byte(canonicalRequest(r, s))),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretKey), s.date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, signV4Terminator)
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalRequest(r *http.Request, s *signature) string {
+	headers := make([]string, 0, len(s.signedHeaders))
+	for _, name := range s.signedHeaders {
+		headers = append(headers, name+":"+canonicalHeaderValue(r, name)+"\n")
+	}
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query(), s.presigned),
+		strings.Join(headers, ""),
+		strings.Join(s.signedHeaders, ";"),
+		s.payloadHash,
+	}, "\n")
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		if presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaderValue returns the values of a header joined with commas,
+// with the spaces trimmed and sequential spaces collapsed.
+func canonicalHeaderValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		if r.Header.Get(HeaderContentLength) == "" {
+			return strconv.FormatInt(r.ContentLength, 10)
+		}
+	}
+	values := r.Header[http.CanonicalHeaderKey(name)]
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// uriEncode encodes s as the URI-encode of signature V4 does, every byte
+// except the unreserved characters is escaped, and so is '/' if encodeSlash
+// is set.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexChars = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexChars[c>>4])
+			b.WriteByte(hexChars[c&15])
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate verifies the signature of r and returns the key it is signed
+// with. The body of r is replaced to verify the payload hash as it is read.
+func (o *ObjectNode) authenticate(r *http.Request) (key *proto.AccessKeyInfo, aerr *apiError) {
+	var s *signature
+	if s, aerr = parseSignature(r); aerr != nil {
+		return
+	}
+	if s.service != serviceS3 || (o.region != "" && s.region != o.region) {
+		return nil, ErrAuthorizationMalformed
+	}
+	if aerr = s.checkTime(time.Now()); aerr != nil {
+		return
+	}
+	switch {
+	case s.payloadHash == streamingPayload:
+		return nil, ErrNotImplemented
+	case s.payloadHash != unsignedPayload && !isHexSHA256(s.payloadHash):
+		return nil, ErrContentSHA256Mismatch
+	}
+	if key, aerr = o.getAccessKey(s.accessKey); aerr != nil {
+		return
+	}
+	if !hmac.Equal([]byte(computeSignature(r, s, key.SecretKey)), []byte(s.signature)) {
+		log.LogDebugf("TRACE authenticate: signature mismatch, accessKey(%v) canonical request(%q)",
+			s.accessKey, canonicalRequest(r, s))
+		return nil, ErrSignatureDoesNotMatch
+	}
+	if s.payloadHash != unsignedPayload && r.Body != nil {
+		r.Body = &hashReader{ReadCloser: r.Body, hash: sha256.New(), expected: s.payloadHash}
+	}
+	return key, nil
+}
+
+func isHexSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// hashReader returns errContentSHA256Mismatch at the end of the body if the
+// body does not match the payload hash.
+type hashReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (h *hashReader) Read(p []byte) (n int, err error) {
+	n, err = h.ReadCloser.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.expected {
+		err = errContentSHA256Mismatch
+	}
+	return
+}
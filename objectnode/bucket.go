@@ -0,0 +1,154 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// bucketNamePattern is what both S3 and the master accept as names of new
+// buckets, existing volumes of other names are still served.
+var bucketNamePattern = regexp.MustCompile("^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$")
+
+type owner struct {
+	ID          string
+	DisplayName string
+}
+
+type bucketInfo struct {
+	Name         string
+	CreationDate string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Owner   owner        `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+func keyOwner(key *proto.AccessKeyInfo) owner {
+	return owner{ID: key.AccessKey, DisplayName: key.AccessKey}
+}
+
+// formatTime formats t as the timestamps of the S3 XML documents.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// listBuckets lists the volumes the key can access. Volumes do not record
+// their creation time, so the epoch is reported.
+func (o *ObjectNode) listBuckets(w http.ResponseWriter, r *request) *apiError {
+	vols, err := o.listVols()
+	if err != nil {
+		return ErrServiceUnavailable
+	}
+	result := &listAllMyBucketsResult{
+		Xmlns:   xmlNS,
+		Owner:   keyOwner(r.key),
+		Buckets: make([]bucketInfo, 0, len(vols)),
+	}
+	for _, vol := range vols {
+		if r.key.CanAccess(vol) {
+			result.Buckets = append(result.Buckets, bucketInfo{Name: vol, CreationDate: formatTime(time.Unix(0, 0))})
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (o *ObjectNode) headBucket(w http.ResponseWriter, r *request) *apiError {
+	if _, aerr := o.getFileSystem(r.bucket); aerr != nil {
+		return aerr
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (o *ObjectNode) getBucketLocation(w http.ResponseWriter, r *request) *apiError {
+	if _, aerr := o.getFileSystem(r.bucket); aerr != nil {
+		return aerr
+	}
+	writeXML(w, http.StatusOK, &locationConstraint{Xmlns: xmlNS, Location: o.region})
+	return nil
+}
+
+// createBucket creates an extent volume for the bucket. The location
+// constraint in the body is ignored.
+func (o *ObjectNode) createBucket(w http.ResponseWriter, r *request) *apiError {
+	if _, err := io.Copy(ioutil.Discard, r.Body); err != nil {
+		return bodyError(err)
+	}
+	if !bucketNamePattern.MatchString(r.bucket) {
+		return ErrInvalidBucketName
+	}
+	vols, err := o.listVols()
+	if err != nil {
+		return ErrServiceUnavailable
+	}
+	if contains(vols, r.bucket) {
+		return ErrBucketAlreadyExists
+	}
+	req := &master.CreateVolRequest{Name: r.bucket, Replicas: o.replicas, Type: proto.ExtentPartition}
+	if err = o.mc.CreateVol(req); err != nil {
+		log.LogErrorf("action[createBucket] bucket(%v) err(%v)", r.bucket, err)
+		return ErrInternalError
+	}
+	log.LogInfof("action[createBucket] bucket(%v) created by accessKey(%v)", r.bucket, r.key.AccessKey)
+	w.Header().Set("Location", "/"+r.bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteBucket deletes the volume of an empty bucket. The system directory
+// of the gateway does not count, so pending multipart uploads are dropped.
+func (o *ObjectNode) deleteBucket(w http.ResponseWriter, r *request) *apiError {
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	entries, err := fsys.ReadDir("/")
+	if err != nil {
+		return fsError(err)
+	}
+	for _, entry := range entries {
+		if "/"+entry.Name() != systemDir {
+			return ErrBucketNotEmpty
+		}
+	}
+	if err = o.mc.DeleteVol(&master.VolRequest{Name: r.bucket}); err != nil {
+		log.LogErrorf("action[deleteBucket] bucket(%v) err(%v)", r.bucket, err)
+		return ErrInternalError
+	}
+	o.forgetFileSystem(r.bucket)
+	log.LogInfof("action[deleteBucket] bucket(%v) deleted by accessKey(%v)", r.bucket, r.key.AccessKey)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
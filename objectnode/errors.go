@@ -0,0 +1,89 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// apiError is an error of the S3 REST API, written to the client as an XML
+// error document.
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	ErrAccessDenied              = &apiError{"AccessDenied", "Access Denied.", http.StatusForbidden}
+	ErrAuthorizationMalformed    = &apiError{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	ErrBadDigest                 = &apiError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	ErrBucketAlreadyExists       = &apiError{"BucketAlreadyExists", "The requested bucket name is not available.", http.StatusConflict}
+	ErrBucketNotEmpty            = &apiError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	ErrEntityTooSmall            = &apiError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	ErrExpiredPresignRequest     = &apiError{"AccessDenied", "Request has expired.", http.StatusForbidden}
+	ErrInternalError             = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	ErrInvalidAccessKeyId        = &apiError{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	ErrInvalidArgument           = &apiError{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	ErrInvalidBucketName         = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	ErrInvalidDigest             = &apiError{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	ErrInvalidObjectName         = &apiError{"InvalidArgument", "The object key cannot be stored as a path of the volume.", http.StatusBadRequest}
+	ErrInvalidPart               = &apiError{"InvalidPart", "One or more of the specified parts could not be found or the ETag did not match.", http.StatusBadRequest}
+	ErrInvalidPartOrder          = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	ErrInvalidRange              = &apiError{"InvalidRange", "The requested range is not satisfiable.", http.StatusRequestedRangeNotSatisfiable}
+	ErrKeyConflict               = &apiError{"InvalidArgument", "The object key conflicts with the path of another object.", http.StatusConflict}
+	ErrKeyTooLong                = &apiError{"KeyTooLongError", "Your key is too long.", http.StatusBadRequest}
+	ErrMalformedXML              = &apiError{"MalformedXML", "The XML you provided was not well-formed.", http.StatusBadRequest}
+	ErrMethodNotAllowed          = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	ErrMissingContentLength      = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	ErrNoSuchBucket              = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	ErrNoSuchKey                 = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	ErrNoSuchUpload              = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	ErrNotImplemented            = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	ErrRequestTimeTooSkewed      = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	ErrSignatureDoesNotMatch     = &apiError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	ErrContentSHA256Mismatch     = &apiError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	ErrUnsupportedSignatureVer   = &apiError{"AccessDenied", "Only AWS signature version 4 is supported.", http.StatusForbidden}
+	ErrServiceUnavailable        = &apiError{"ServiceUnavailable", "Reduce your request rate.", http.StatusServiceUnavailable}
+	ErrInvalidMaxKeys            = &apiError{"InvalidArgument", "Argument max-keys must be an integer between 0 and 2147483647.", http.StatusBadRequest}
+	ErrInvalidContinuationToken  = &apiError{"InvalidArgument", "The continuation token provided is incorrect.", http.StatusBadRequest}
+	ErrInvalidPartNumber         = &apiError{"InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive.", http.StatusBadRequest}
+	ErrIncompleteBody            = &apiError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	ErrMalformedPresignedRequest = &apiError{"AuthorizationQueryParametersError", "The presigned URL is malformed.", http.StatusBadRequest}
+)
+
+// errorResponse is the XML document of an apiError.
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	resp := &errorResponse{
+		Code:      err.Code,
+		Message:   err.Message,
+		Resource:  r.URL.Path,
+		RequestId: w.Header().Get(HeaderRequestId),
+	}
+	writeXML(w, err.StatusCode, resp)
+}
@@ -0,0 +1,310 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	MaxKeys = 1000
+)
+
+type objectInfo struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type listBucketResultV2 struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectInfo   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// dirReader reads directories by their absolute paths, as sdk/fs.FileSystem
+// does.
+type dirReader interface {
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// errListDone stops the walk of a listing once a page is full.
+var errListDone = errors.New("list done")
+
+// lister lists the objects of a volume in the order of their keys. Keys of
+// a directory all start with its key plus "/", so a directory is walked as
+// if its name ended with "/", and the subtrees before the marker or out of
+// the prefix are skipped.
+type lister struct {
+	fsys      dirReader
+	prefix    string
+	delimiter string
+	marker    string // the keys and common prefixes up to it are skipped
+	maxKeys   int
+
+	objects   []objectInfo
+	prefixes  []commonPrefix
+	last      string // the last key or common prefix listed
+	lastCP    string
+	truncated bool
+}
+
+type listEntry struct {
+	key   string
+	entry fs.DirEntry
+}
+
+func (l *lister) count() int {
+	return len(l.objects) + len(l.prefixes)
+}
+
+// list walks the volume until maxKeys keys and common prefixes are listed.
+func (l *lister) list() error {
+	if l.maxKeys == 0 {
+		return nil
+	}
+	if err := l.walk("/", ""); err != nil && err != errListDone {
+		return err
+	}
+	return nil
+}
+
+// walk lists the directory dir, whose key prefix is dirKey.
+func (l *lister) walk(dir, dirKey string) error {
+	entries, err := l.fsys.ReadDir(dir)
+	if err != nil {
+		// directories removed since they are read are empty
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+			return nil
+		}
+		return err
+	}
+	sorted := make([]listEntry, 0, len(entries))
+	for _, entry := range entries {
+		key := dirKey + entry.Name()
+		if entry.IsDir() {
+			key += "/"
+		}
+		if dir == "/" && "/"+entry.Name() == systemDir {
+			continue
+		}
+		sorted = append(sorted, listEntry{key: key, entry: entry})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].key < sorted[j].key })
+
+	for _, e := range sorted {
+		if e.entry.IsDir() {
+			if err = l.walkDir(dir+e.entry.Name()+"/", e.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if !e.entry.Type().IsRegular() || !strings.HasPrefix(e.key, l.prefix) || e.key <= l.marker {
+			continue
+		}
+		info, err := e.entry.Info()
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				continue
+			}
+			return err
+		}
+		if err = l.add(e.key, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *lister) walkDir(dir, key string) error {
+	// out of the prefix
+	if !strings.HasPrefix(key, l.prefix) && !strings.HasPrefix(l.prefix, key) {
+		return nil
+	}
+	// all of the keys are before the marker, or roll up into the common
+	// prefix just listed
+	if key <= l.marker && !strings.HasPrefix(l.marker, key) ||
+		l.lastCP != "" && strings.HasPrefix(key, l.lastCP) {
+		return nil
+	}
+	// The directory is a common prefix as a whole. A marker in it leaves
+	// only part of it, which is walked to find out whether anything is left.
+	if l.delimiter == "/" && len(key) > len(l.prefix) && strings.HasPrefix(key, l.prefix) &&
+		!strings.Contains(key[len(l.prefix):len(key)-1], "/") && key > l.marker {
+		if ok, err := l.hasObjects(dir); err != nil || !ok {
+			return err
+		}
+		return l.addPrefix(key)
+	}
+	return l.walk(dir, key)
+}
+
+// hasObjects reports whether there are any objects under dir.
+func (l *lister) hasObjects(dir string) (bool, error) {
+	entries, err := l.fsys.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			return true, nil
+		}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if ok, err := l.hasObjects(dir + entry.Name() + "/"); err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// add lists an object, or the common prefix it rolls up into.
+func (l *lister) add(key string, info fs.FileInfo) error {
+	if l.delimiter != "" {
+		rest := key[len(l.prefix):]
+		if i := strings.Index(rest, l.delimiter); i >= 0 {
+			cp := l.prefix + rest[:i+len(l.delimiter)]
+			if cp == l.marker || cp == l.lastCP {
+				return nil
+			}
+			return l.addPrefix(cp)
+		}
+	}
+	if l.count() >= l.maxKeys {
+		l.truncated = true
+		return errListDone
+	}
+	l.objects = append(l.objects, objectInfo{
+		Key:          key,
+		LastModified: formatTime(info.ModTime()),
+		ETag:         objectETag(info),
+		Size:         info.Size(),
+		StorageClass: "STANDARD",
+	})
+	l.last = key
+	return nil
+}
+
+func (l *lister) addPrefix(cp string) error {
+	if l.count() >= l.maxKeys {
+		l.truncated = true
+		return errListDone
+	}
+	l.prefixes = append(l.prefixes, commonPrefix{Prefix: cp})
+	l.last, l.lastCP = cp, cp
+	return nil
+}
+
+// listObjectsV2 lists the objects of a bucket. The continuation token is the
+// last key or common prefix of the previous page.
+func (o *ObjectNode) listObjectsV2(w http.ResponseWriter, r *request) *apiError {
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	query := r.URL.Query()
+	l := &lister{
+		fsys:      fsys,
+		prefix:    query.Get("prefix"),
+		delimiter: query.Get("delimiter"),
+		marker:    query.Get("start-after"),
+		maxKeys:   MaxKeys,
+	}
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err := strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			return ErrInvalidMaxKeys
+		}
+		if maxKeys < MaxKeys {
+			l.maxKeys = maxKeys
+		}
+	}
+	token := query.Get("continuation-token")
+	if token != "" {
+		marker, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return ErrInvalidContinuationToken
+		}
+		l.marker = string(marker)
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		return ErrInvalidArgument
+	}
+	if err := l.list(); err != nil {
+		return fsError(err)
+	}
+
+	encode := func(s string) string { return s }
+	if encodingType == "url" {
+		encode = func(s string) string { return strings.Replace(url.QueryEscape(s), "+", "%20", -1) }
+	}
+	result := &listBucketResultV2{
+		Xmlns:             xmlNS,
+		Name:              r.bucket,
+		Prefix:            encode(l.prefix),
+		StartAfter:        encode(query.Get("start-after")),
+		ContinuationToken: token,
+		KeyCount:          l.count(),
+		MaxKeys:           l.maxKeys,
+		Delimiter:         encode(l.delimiter),
+		EncodingType:      encodingType,
+		IsTruncated:       l.truncated,
+		Contents:          l.objects,
+		CommonPrefixes:    l.prefixes,
+	}
+	if l.truncated {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(l.last))
+	}
+	for i := range result.Contents {
+		result.Contents[i].Key = encode(result.Contents[i].Key)
+	}
+	for i := range result.CommonPrefixes {
+		result.CommonPrefixes[i].Prefix = encode(result.CommonPrefixes[i].Prefix)
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
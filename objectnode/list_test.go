@@ -0,0 +1,124 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// mapDirReader reads the directories of a fstest.MapFS by absolute paths.
+type mapDirReader fstest.MapFS
+
+func (m mapDirReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name = strings.Trim(name, "/"); name == "" {
+		name = "."
+	}
+	return fstest.MapFS(m).ReadDir(name)
+}
+
+func newTestLister() *lister {
+	files := fstest.MapFS{}
+	for _, key := range []string{
+		"a.txt", "a/b", "a/c/d", "a/c/e", "a-b", "b/x/y", "c",
+		".objectnode/tmp/1", ".objectnode/multipart/2/key",
+	} {
+		files[key] = &fstest.MapFile{Data: []byte(key)}
+	}
+	files["empty/dir"] = &fstest.MapFile{Mode: fs.ModeDir}
+	return &lister{fsys: mapDirReader(files), maxKeys: MaxKeys}
+}
+
+func listResult(l *lister) (keys, prefixes []string) {
+	keys, prefixes = []string{}, []string{}
+	for _, o := range l.objects {
+		keys = append(keys, o.Key)
+	}
+	for _, p := range l.prefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	return
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		prefix, delimiter, marker string
+		maxKeys                   int
+		keys, prefixes            []string
+		truncated                 bool
+	}{
+		{keys: []string{"a-b", "a.txt", "a/b", "a/c/d", "a/c/e", "b/x/y", "c"}, prefixes: []string{}},
+		{delimiter: "/", keys: []string{"a-b", "a.txt", "c"}, prefixes: []string{"a/", "b/"}},
+		{prefix: "a/", delimiter: "/", keys: []string{"a/b"}, prefixes: []string{"a/c/"}},
+		{prefix: "a/c", keys: []string{"a/c/d", "a/c/e"}, prefixes: []string{}},
+		{prefix: "a", delimiter: "/", keys: []string{"a-b", "a.txt"}, prefixes: []string{"a/"}},
+		{delimiter: "c", keys: []string{"a-b", "a.txt", "a/b", "b/x/y"}, prefixes: []string{"a/c", "c"}},
+		{marker: "a/c/d", keys: []string{"a/c/e", "b/x/y", "c"}, prefixes: []string{}},
+		{marker: "a/c/d", delimiter: "/", keys: []string{"c"}, prefixes: []string{"a/", "b/"}},
+		{marker: "a/", delimiter: "/", keys: []string{"c"}, prefixes: []string{"b/"}},
+		{maxKeys: 2, delimiter: "/", keys: []string{"a-b", "a.txt"}, prefixes: []string{}, truncated: true},
+		{maxKeys: 3, marker: "a.txt", delimiter: "/", keys: []string{"c"}, prefixes: []string{"a/", "b/"}},
+		{prefix: "empty", keys: []string{}, prefixes: []string{}},
+		{prefix: ".objectnode", keys: []string{}, prefixes: []string{}},
+	}
+	for i, tt := range tests {
+		l := newTestLister()
+		l.prefix, l.delimiter, l.marker = tt.prefix, tt.delimiter, tt.marker
+		if tt.maxKeys != 0 {
+			l.maxKeys = tt.maxKeys
+		}
+		if err := l.list(); err != nil {
+			t.Fatalf("%v: %v", i, err)
+		}
+		keys, prefixes := listResult(l)
+		if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(prefixes, tt.prefixes) || l.truncated != tt.truncated {
+			t.Errorf("%v: keys %v prefixes %v truncated %v, expected %v %v %v",
+				i, keys, prefixes, l.truncated, tt.keys, tt.prefixes, tt.truncated)
+		}
+	}
+}
+
+// Listing page by page from the last key or common prefix lists everything
+// once.
+func TestListPages(t *testing.T) {
+	for _, delimiter := range []string{"", "/"} {
+		all := newTestLister()
+		all.delimiter = delimiter
+		all.list()
+		allKeys, allPrefixes := listResult(all)
+
+		keys, prefixes := []string{}, []string{}
+		marker := ""
+		for {
+			l := newTestLister()
+			l.delimiter, l.marker, l.maxKeys = delimiter, marker, 1
+			if err := l.list(); err != nil {
+				t.Fatal(err)
+			}
+			k, p := listResult(l)
+			keys, prefixes = append(keys, k...), append(prefixes, p...)
+			if !l.truncated {
+				break
+			}
+			marker = l.last
+		}
+		if !reflect.DeepEqual(keys, allKeys) || !reflect.DeepEqual(prefixes, allPrefixes) {
+			t.Errorf("delimiter %q: pages %v %v, expected %v %v", delimiter, keys, prefixes, allKeys, allPrefixes)
+		}
+	}
+}
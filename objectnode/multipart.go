@@ -0,0 +1,272 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/tiglabs/containerfs/sdk/fs"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// Multipart uploads keep their parts in multipartDir/<upload id>, along
+// with the key of the object in a file named "key". Completing an upload
+// copies the parts to the object in order.
+const (
+	MinPartSize   = 5 * 1024 * 1024
+	MaxPartNumber = 10000
+
+	// maxCompleteBodySize bounds the body of CompleteMultipartUpload.
+	maxCompleteBodySize = 4 * 1024 * 1024
+
+	uploadKeyFile = "key"
+)
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completePart struct {
+	PartNumber int
+	ETag       string
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+func uploadDir(uploadId string) string {
+	return path.Join(multipartDir, uploadId)
+}
+
+func partPath(uploadId string, partNumber int) string {
+	return path.Join(uploadDir(uploadId), "part."+strconv.Itoa(partNumber))
+}
+
+// checkUpload checks that the upload of r exists and is for the key of r.
+// Upload ids are hex strings, so they cannot address other paths.
+func checkUpload(fsys *fs.FileSystem, r *request, uploadId string) *apiError {
+	if id, err := hex.DecodeString(uploadId); err != nil || len(id) != len(uuid.UUID{}) {
+		return ErrNoSuchUpload
+	}
+	f, err := fsys.Open(path.Join(uploadDir(uploadId), uploadKeyFile))
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) {
+			return ErrNoSuchUpload
+		}
+		return fsError(err)
+	}
+	defer f.Close()
+	key, err := ioutil.ReadAll(io.LimitReader(f, MaxKeyLength+1))
+	if err != nil {
+		return fsError(err)
+	}
+	if string(key) != r.object {
+		return ErrNoSuchUpload
+	}
+	return nil
+}
+
+func (o *ObjectNode) createMultipartUpload(w http.ResponseWriter, r *request) *apiError {
+	if _, aerr := objectPath(r.object); aerr != nil {
+		return aerr
+	}
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	id := uuid.New()
+	uploadId := hex.EncodeToString(id[:])
+	if err := fsys.MkdirAll(uploadDir(uploadId), 0755); err != nil {
+		return fsError(err)
+	}
+	f, err := fsys.Create(path.Join(uploadDir(uploadId), uploadKeyFile))
+	if err == nil {
+		_, err = f.Write([]byte(r.object))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fsys.RemoveAll(uploadDir(uploadId))
+		return fsError(err)
+	}
+	log.LogDebugf("TRACE createMultipartUpload: bucket(%v) key(%v) uploadId(%v)", r.bucket, r.object, uploadId)
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    xmlNS,
+		Bucket:   r.bucket,
+		Key:      r.object,
+		UploadId: uploadId,
+	})
+	return nil
+}
+
+func (o *ObjectNode) uploadPart(w http.ResponseWriter, r *request) *apiError {
+	query := r.URL.Query()
+	uploadId := query.Get("uploadId")
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > MaxPartNumber {
+		return ErrInvalidPartNumber
+	}
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	if aerr = checkUpload(fsys, r, uploadId); aerr != nil {
+		return aerr
+	}
+	fi, aerr := writeObject(fsys, partPath(uploadId, partNumber), r)
+	if aerr != nil {
+		return aerr
+	}
+	log.LogDebugf("TRACE uploadPart: bucket(%v) key(%v) uploadId(%v) part(%v) size(%v)",
+		r.bucket, r.object, uploadId, partNumber, fi.Size())
+	w.Header().Set(HeaderETag, objectETag(fi))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (o *ObjectNode) completeMultipartUpload(w http.ResponseWriter, r *request) *apiError {
+	uploadId := r.URL.Query().Get("uploadId")
+	name, aerr := objectPath(r.object)
+	if aerr != nil {
+		return aerr
+	}
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	if aerr = checkUpload(fsys, r, uploadId); aerr != nil {
+		return aerr
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCompleteBodySize))
+	if err != nil {
+		return bodyError(err)
+	}
+	complete := &completeMultipartUpload{}
+	if err = xml.Unmarshal(body, complete); err != nil || len(complete.Parts) == 0 {
+		return ErrMalformedXML
+	}
+
+	// check all of the parts before the object is written
+	for i, part := range complete.Parts {
+		if i > 0 && part.PartNumber <= complete.Parts[i-1].PartNumber {
+			return ErrInvalidPartOrder
+		}
+		if part.PartNumber < 1 || part.PartNumber > MaxPartNumber {
+			return ErrInvalidPart
+		}
+		fi, err := fsys.Stat(partPath(uploadId, part.PartNumber))
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				return ErrInvalidPart
+			}
+			return fsError(err)
+		}
+		if strings.Trim(part.ETag, "\"") != strings.Trim(objectETag(fi), "\"") {
+			return ErrInvalidPart
+		}
+		if i < len(complete.Parts)-1 && fi.Size() < MinPartSize {
+			return ErrEntityTooSmall
+		}
+	}
+
+	f, aerr := createTemp(fsys)
+	if aerr != nil {
+		return aerr
+	}
+	for _, part := range complete.Parts {
+		if aerr = copyPart(f, fsys, partPath(uploadId, part.PartNumber)); aerr != nil {
+			break
+		}
+	}
+	if err = f.Close(); err != nil && aerr == nil {
+		aerr = fsError(err)
+	}
+	if aerr != nil {
+		fsys.Remove(f.Name())
+		return aerr
+	}
+	fi, aerr := commitObject(fsys, f.Name(), name)
+	if aerr != nil {
+		return aerr
+	}
+	if err = fsys.RemoveAll(uploadDir(uploadId)); err != nil {
+		log.LogWarnf("action[completeMultipartUpload] remove upload(%v) err(%v)", uploadId, err)
+	}
+	log.LogDebugf("TRACE completeMultipartUpload: bucket(%v) key(%v) uploadId(%v) parts(%v) size(%v)",
+		r.bucket, r.object, uploadId, len(complete.Parts), fi.Size())
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    xmlNS,
+		Location: "/" + r.bucket + "/" + r.object,
+		Bucket:   r.bucket,
+		Key:      r.object,
+		ETag:     objectETag(fi),
+	})
+	return nil
+}
+
+func copyPart(dst *fs.File, fsys *fs.FileSystem, name string) *apiError {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return fsError(err)
+	}
+	defer src.Close()
+	if _, err = dst.ReadFrom(src); err != nil {
+		return fsError(err)
+	}
+	return nil
+}
+
+func (o *ObjectNode) abortMultipartUpload(w http.ResponseWriter, r *request) *apiError {
+	uploadId := r.URL.Query().Get("uploadId")
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	if aerr = checkUpload(fsys, r, uploadId); aerr != nil {
+		return aerr
+	}
+	if err := fsys.RemoveAll(uploadDir(uploadId)); err != nil {
+		return fsError(err)
+	}
+	log.LogDebugf("TRACE abortMultipartUpload: bucket(%v) key(%v) uploadId(%v)", r.bucket, r.object, uploadId)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
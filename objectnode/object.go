@@ -0,0 +1,359 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/fs"
+	"github.com/tiglabs/containerfs/util"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	// systemDir keeps the files of the gateway in each volume, it is hidden
+	// from the listings and cannot be addressed by keys.
+	systemDir    = "/.objectnode"
+	tmpDir       = systemDir + "/tmp"
+	multipartDir = systemDir + "/multipart"
+
+	MaxKeyLength       = 1024
+	DefaultContentType = "binary/octet-stream"
+
+	// renameRetries bounds the retries of moving an object into a directory
+	// removed by a concurrent delete.
+	renameRetries = 3
+)
+
+// objectPath returns the path of the file of key. Keys which are not clean
+// relative paths, e.g. "a//b" or "a/", cannot be stored.
+func objectPath(key string) (string, *apiError) {
+	if len(key) > MaxKeyLength {
+		return "", ErrKeyTooLong
+	}
+	for i, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || (i == 0 && "/"+segment == systemDir) {
+			return "", ErrInvalidObjectName
+		}
+	}
+	return "/" + key, nil
+}
+
+// objectETag returns the ETag of an object. The MD5 of the data is not
+// stored, so the ETag is derived from the inode, the size and the
+// modification time, which changes whenever the object is written.
+func objectETag(fi os.FileInfo) string {
+	var ino uint64
+	if info, ok := fi.Sys().(*proto.InodeInfo); ok {
+		ino = info.Inode
+	}
+	sum := md5.Sum([]byte(fmt.Sprintf("%d/%d/%d", ino, fi.Size(), fi.ModTime().UnixNano())))
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+func contentType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return DefaultContentType
+}
+
+// fsError converts an error of the file system to the S3 error reported.
+func fsError(err error) *apiError {
+	switch {
+	case errors.Is(err, syscall.ENOENT):
+		return ErrNoSuchKey
+	case errors.Is(err, syscall.ENOTDIR), errors.Is(err, syscall.EISDIR),
+		errors.Is(err, syscall.EEXIST), errors.Is(err, syscall.ENOTEMPTY):
+		return ErrKeyConflict
+	case errors.Is(err, syscall.EPERM), errors.Is(err, syscall.EACCES):
+		return ErrAccessDenied
+	}
+	log.LogErrorf("action[fsError] err(%v)", err)
+	return ErrInternalError
+}
+
+// bodyError converts an error met while reading the body of a request.
+func bodyError(err error) *apiError {
+	var pe *os.PathError
+	switch {
+	case err == errContentSHA256Mismatch:
+		return ErrContentSHA256Mismatch
+	case errors.As(err, &pe):
+		return fsError(err)
+	}
+	return ErrIncompleteBody
+}
+
+// parseContentMD5 returns the MD5 in the Content-MD5 header, nil if absent.
+func parseContentMD5(r *request) ([]byte, *apiError) {
+	value := r.Header.Get(HeaderContentMD5)
+	if value == "" {
+		return nil, nil
+	}
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != md5.Size {
+		return nil, ErrInvalidDigest
+	}
+	return sum, nil
+}
+
+// createTemp creates a temporary file to write an object to, which is
+// committed by commitObject once it is complete, so readers never see a
+// partial object.
+func createTemp(fsys *fs.FileSystem) (f *fs.File, aerr *apiError) {
+	if err := fsys.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, fsError(err)
+	}
+	f, err := fsys.Create(path.Join(tmpDir, uuid.New().String()))
+	if err != nil {
+		return nil, fsError(err)
+	}
+	return f, nil
+}
+
+// commitObject renames the temporary file tmp to name, creating the
+// directories of name as needed.
+func commitObject(fsys *fs.FileSystem, tmp, name string) (fi os.FileInfo, aerr *apiError) {
+	var err error
+	for i := 0; ; i++ {
+		if err = fsys.MkdirAll(path.Dir(name), 0755); err == nil {
+			err = fsys.Rename(tmp, name)
+		}
+		if err == nil || !errors.Is(err, syscall.ENOENT) || i >= renameRetries {
+			break
+		}
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return nil, fsError(err)
+	}
+	if fi, err = fsys.Stat(name); err != nil {
+		return nil, fsError(err)
+	}
+	return fi, nil
+}
+
+// writeObject writes the body of r to the object name.
+func writeObject(fsys *fs.FileSystem, name string, r *request) (fi os.FileInfo, aerr *apiError) {
+	if r.ContentLength < 0 {
+		return nil, ErrMissingContentLength
+	}
+	expectedMD5, aerr := parseContentMD5(r)
+	if aerr != nil {
+		return
+	}
+	f, aerr := createTemp(fsys)
+	if aerr != nil {
+		return
+	}
+	h := md5.New()
+	n, err := f.ReadFrom(io.TeeReader(r.Body, h))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+		aerr = bodyError(err)
+	case n != r.ContentLength:
+		aerr = ErrIncompleteBody
+	case expectedMD5 != nil && !bytes.Equal(expectedMD5, h.Sum(nil)):
+		aerr = ErrBadDigest
+	}
+	if aerr != nil {
+		fsys.Remove(f.Name())
+		return nil, aerr
+	}
+	return commitObject(fsys, f.Name(), name)
+}
+
+func (o *ObjectNode) putObject(w http.ResponseWriter, r *request) *apiError {
+	name, aerr := objectPath(r.object)
+	if aerr != nil {
+		return aerr
+	}
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	fi, aerr := writeObject(fsys, name, r)
+	if aerr != nil {
+		return aerr
+	}
+	log.LogDebugf("TRACE putObject: bucket(%v) key(%v) size(%v)", r.bucket, r.object, fi.Size())
+	w.Header().Set(HeaderETag, objectETag(fi))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getObject serves GET and HEAD of an object, with a single byte range if
+// the Range header asks for one.
+func (o *ObjectNode) getObject(w http.ResponseWriter, r *request) *apiError {
+	name, aerr := objectPath(r.object)
+	if aerr != nil {
+		return ErrNoSuchKey
+	}
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTDIR) {
+			return ErrNoSuchKey
+		}
+		return fsError(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fsError(err)
+	}
+	if !fi.Mode().IsRegular() {
+		return ErrNoSuchKey
+	}
+
+	size := fi.Size()
+	start, length, ranged, aerr := parseRange(r.Header.Get(HeaderRange), size)
+	if aerr != nil {
+		w.Header().Set(HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return aerr
+	}
+	header := w.Header()
+	header.Set(HeaderContentType, contentType(name))
+	header.Set(HeaderContentLength, strconv.FormatInt(length, 10))
+	header.Set(HeaderETag, objectETag(fi))
+	header.Set(HeaderLastModified, fi.ModTime().UTC().Format(http.TimeFormat))
+	header.Set(HeaderAcceptRanges, "bytes")
+	if ranged {
+		header.Set(HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	// The status is sent, failures can only be reported by a short body.
+	if _, err = io.CopyBuffer(w, io.NewSectionReader(f, start, length), make([]byte, util.BlockSize)); err != nil {
+		log.LogErrorf("action[getObject] bucket(%v) key(%v) range(%v,%v) err(%v)",
+			r.bucket, r.object, start, length, err)
+	}
+	return nil
+}
+
+// parseRange parses a Range header of a single byte range. Like S3, headers
+// it does not understand, including multiple ranges, are ignored and the
+// whole object is returned.
+func parseRange(spec string, size int64) (start, length int64, ranged bool, aerr *apiError) {
+	length = size
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return
+	}
+	spec = strings.TrimSpace(strings.TrimPrefix(spec, "bytes="))
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if first == "" {
+		// suffix range, the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+	begin, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || begin < 0 {
+		return
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < begin {
+			return 0, size, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if begin >= size {
+		return 0, 0, false, ErrInvalidRange
+	}
+	return begin, end - begin + 1, true, nil
+}
+
+// deleteObject removes the file of an object and the directories left
+// empty by it. Like S3, deleting a missing object succeeds.
+func (o *ObjectNode) deleteObject(w http.ResponseWriter, r *request) *apiError {
+	name, aerr := objectPath(r.object)
+	if aerr != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	fsys, aerr := o.getFileSystem(r.bucket)
+	if aerr != nil {
+		return aerr
+	}
+	fi, err := fsys.Lstat(name)
+	switch {
+	case err == nil && !fi.IsDir():
+		if err = fsys.Remove(name); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return fsError(err)
+		}
+		removeEmptyParents(fsys, path.Dir(name))
+	case err != nil && !errors.Is(err, syscall.ENOENT) && !errors.Is(err, syscall.ENOTDIR):
+		return fsError(err)
+	}
+	log.LogDebugf("TRACE deleteObject: bucket(%v) key(%v)", r.bucket, r.object)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// removeEmptyParents removes dir and its parents until one is not empty, as
+// directories only exist for the objects in them.
+func removeEmptyParents(fsys *fs.FileSystem, dir string) {
+	for dir != "/" {
+		entries, err := fsys.ReadDir(dir)
+		if err != nil || len(entries) != 0 {
+			return
+		}
+		if err = fsys.Remove(dir); err != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
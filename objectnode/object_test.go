@@ -0,0 +1,69 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		spec          string
+		size          int64
+		start, length int64
+		ranged        bool
+		aerr          *apiError
+	}{
+		{"", 100, 0, 100, false, nil},
+		{"bytes=0-9", 100, 0, 10, true, nil},
+		{"bytes=90-", 100, 90, 10, true, nil},
+		{"bytes=90-200", 100, 90, 10, true, nil},
+		{"bytes=-10", 100, 90, 10, true, nil},
+		{"bytes=-200", 100, 0, 100, true, nil},
+		{"bytes=100-", 100, 0, 0, false, ErrInvalidRange},
+		{"bytes=-0", 100, 0, 0, false, ErrInvalidRange},
+		{"bytes=-1", 0, 0, 0, false, ErrInvalidRange},
+		{"bytes=9-0", 100, 0, 100, false, nil},
+		{"bytes=0-1,5-6", 100, 0, 100, false, nil},
+		{"items=0-9", 100, 0, 100, false, nil},
+		{"bytes=x-9", 100, 0, 100, false, nil},
+	}
+	for _, tt := range tests {
+		start, length, ranged, aerr := parseRange(tt.spec, tt.size)
+		if start != tt.start || length != tt.length || ranged != tt.ranged || aerr != tt.aerr {
+			t.Errorf("parseRange(%q, %v) = %v, %v, %v, %v, expected %v, %v, %v, %v", tt.spec, tt.size,
+				start, length, ranged, aerr, tt.start, tt.length, tt.ranged, tt.aerr)
+		}
+	}
+}
+
+func TestObjectPath(t *testing.T) {
+	valid := map[string]string{
+		"a":             "/a",
+		"a/b/c.txt":     "/a/b/c.txt",
+		".objectnodes":  "/.objectnodes",
+		"a/.objectnode": "/a/.objectnode",
+	}
+	for key, expected := range valid {
+		if name, aerr := objectPath(key); aerr != nil || name != expected {
+			t.Errorf("objectPath(%q) = %q, %v, expected %q", key, name, aerr, expected)
+		}
+	}
+	for _, key := range []string{"", "a/", "/a", "a//b", "a/./b", "../a", ".objectnode/tmp/x"} {
+		if _, aerr := objectPath(key); aerr == nil {
+			t.Errorf("objectPath(%q) succeeded", key)
+		}
+	}
+}
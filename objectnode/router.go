@@ -0,0 +1,153 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	HeaderAuthorization    = "Authorization"
+	HeaderAmzContentSHA256 = "X-Amz-Content-Sha256"
+	HeaderAmzDate          = "X-Amz-Date"
+	HeaderDate             = "Date"
+	HeaderContentLength    = "Content-Length"
+	HeaderContentMD5       = "Content-MD5"
+	HeaderContentRange     = "Content-Range"
+	HeaderContentType      = "Content-Type"
+	HeaderAcceptRanges     = "Accept-Ranges"
+	HeaderETag             = "ETag"
+	HeaderLastModified     = "Last-Modified"
+	HeaderRange            = "Range"
+	HeaderRequestId        = "X-Amz-Request-Id"
+	HeaderServer           = "Server"
+)
+
+const (
+	ServerName = "ContainerFS"
+	xmlNS      = "http://s3.amazonaws.com/doc/2006-03-01/"
+)
+
+// request is an authenticated request of the S3 API.
+type request struct {
+	*http.Request
+	key    *proto.AccessKeyInfo
+	bucket string
+	object string // the object key, empty for the requests of buckets
+}
+
+// ServeHTTP serves the S3 API with path style addressing, i.e.
+// "/<bucket>/<key>".
+func (o *ObjectNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderRequestId, strings.Replace(uuid.New().String(), "-", "", -1))
+	w.Header().Set(HeaderServer, ServerName)
+
+	key, aerr := o.authenticate(r)
+	if aerr != nil {
+		log.LogWarnf("action[ServeHTTP] %v %v from %v: %v", r.Method, r.URL.Path, r.RemoteAddr, aerr)
+		writeError(w, r, aerr)
+		return
+	}
+	req := &request{Request: r, key: key}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		req.bucket, req.object = path[:i], path[i+1:]
+	} else {
+		req.bucket = path
+	}
+	log.LogDebugf("TRACE ServeHTTP: %v bucket(%v) object(%v) query(%v) accessKey(%v)",
+		r.Method, req.bucket, req.object, r.URL.RawQuery, key.AccessKey)
+
+	if req.bucket != "" && !key.CanAccess(req.bucket) {
+		writeError(w, r, ErrAccessDenied)
+		return
+	}
+	if aerr = o.route(w, req); aerr != nil {
+		writeError(w, r, aerr)
+	}
+}
+
+// route dispatches a request by its method, bucket, key and sub-resource.
+func (o *ObjectNode) route(w http.ResponseWriter, r *request) *apiError {
+	query := r.URL.Query()
+	_, uploads := query["uploads"]
+	uploadId := query.Get("uploadId")
+
+	if r.bucket == "" {
+		if r.Method == http.MethodGet {
+			return o.listBuckets(w, r)
+		}
+		return ErrMethodNotAllowed
+	}
+	if r.object == "" {
+		switch r.Method {
+		case http.MethodGet:
+			if _, ok := query["location"]; ok {
+				return o.getBucketLocation(w, r)
+			}
+			if query.Get("list-type") == "2" {
+				return o.listObjectsV2(w, r)
+			}
+			return ErrNotImplemented
+		case http.MethodHead:
+			return o.headBucket(w, r)
+		case http.MethodPut:
+			return o.createBucket(w, r)
+		case http.MethodDelete:
+			return o.deleteBucket(w, r)
+		}
+		return ErrMethodNotAllowed
+	}
+
+	switch {
+	case r.Method == http.MethodPost && uploads:
+		return o.createMultipartUpload(w, r)
+	case r.Method == http.MethodPut && uploadId != "":
+		return o.uploadPart(w, r)
+	case r.Method == http.MethodPost && uploadId != "":
+		return o.completeMultipartUpload(w, r)
+	case r.Method == http.MethodDelete && uploadId != "":
+		return o.abortMultipartUpload(w, r)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return ErrNotImplemented
+		}
+		return o.putObject(w, r)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		return o.getObject(w, r)
+	case r.Method == http.MethodDelete:
+		return o.deleteObject(w, r)
+	}
+	return ErrMethodNotAllowed
+}
+
+func writeXML(w http.ResponseWriter, statusCode int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		log.LogErrorf("action[writeXML] marshal %T err(%v)", v, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(HeaderContentType, "application/xml")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
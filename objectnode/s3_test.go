@@ -0,0 +1,278 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/fs"
+	"github.com/tiglabs/containerfs/sdk/fs/fstest"
+	"github.com/tiglabs/containerfs/sdk/master"
+)
+
+// fakeMaster keeps the volumes and access keys of a cluster in memory, the
+// volumes are kept by fstest.
+type fakeMaster struct {
+	sync.Mutex
+	vols map[string]*fs.FileSystem
+	keys map[string]*proto.AccessKeyInfo
+}
+
+func newFakeMaster() *fakeMaster {
+	return &fakeMaster{
+		vols: make(map[string]*fs.FileSystem),
+		keys: make(map[string]*proto.AccessKeyInfo),
+	}
+}
+
+func (m *fakeMaster) GetCluster() (*master.ClusterView, error) {
+	m.Lock()
+	defer m.Unlock()
+	cv := &master.ClusterView{Name: "fake"}
+	for name := range m.vols {
+		cv.Vols = append(cv.Vols, name)
+	}
+	sort.Strings(cv.Vols)
+	return cv, nil
+}
+
+func (m *fakeMaster) CreateVol(req *master.CreateVolRequest) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.vols[req.Name]; ok {
+		return fmt.Errorf("vol %v exists", req.Name)
+	}
+	m.vols[req.Name] = fstest.NewFileSystem()
+	return nil
+}
+
+func (m *fakeMaster) DeleteVol(req *master.VolRequest) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.vols[req.Name]; !ok {
+		return master.ErrVolNotFound
+	}
+	delete(m.vols, req.Name)
+	return nil
+}
+
+func (m *fakeMaster) GetAccessKey(req *master.AccessKeyRequest) (*proto.AccessKeyInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	info, ok := m.keys[req.AccessKey]
+	if !ok {
+		return nil, master.ErrAccessKeyNotFound
+	}
+	return info, nil
+}
+
+func (m *fakeMaster) openVolume(name string) (*fs.FileSystem, error) {
+	m.Lock()
+	defer m.Unlock()
+	fsys, ok := m.vols[name]
+	if !ok {
+		return nil, master.ErrVolNotFound
+	}
+	return fsys, nil
+}
+
+// newTestSession runs a gateway in the test process and returns a session
+// of the AWS SDK with an access key of it. The volumes are kept in memory,
+// unless CFS_MASTER_ADDR names the master of a cluster to use instead, e.g.
+//
+//	CFS_MASTER_ADDR=127.0.0.1:8080 go test ./objectnode/
+func newTestSession(t *testing.T) (*session.Session, func()) {
+	node := NewServer()
+	node.region, node.replicas = DefaultRegion, DefaultReplicas
+	var (
+		key     *proto.AccessKeyInfo
+		err     error
+		dropKey = func() {}
+	)
+	if addr := os.Getenv("CFS_MASTER_ADDR"); addr != "" {
+		node.init([]string{addr})
+		mc := master.NewMasterClient([]string{addr})
+		if key, err = mc.CreateAccessKey(&master.CreateAccessKeyRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		dropKey = func() {
+			mc.DeleteAccessKey(&master.AccessKeyRequest{AccessKey: key.AccessKey})
+		}
+	} else {
+		fake := newFakeMaster()
+		key = &proto.AccessKeyInfo{AccessKey: "test", SecretKey: "secret"}
+		fake.keys[key.AccessKey] = key
+		node.init(nil)
+		node.mc, node.openVolume = fake, fake.openVolume
+	}
+	server := httptest.NewServer(node)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String(DefaultRegion),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials(key.AccessKey, key.SecretKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess, func() {
+		server.Close()
+		dropKey()
+	}
+}
+
+func isCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
+
+func TestS3(t *testing.T) {
+	sess, cleanup := newTestSession(t)
+	defer cleanup()
+	svc := s3.New(sess)
+	bucket := aws.String(fmt.Sprintf("s3test-%d", time.Now().Unix()))
+
+	if _, err := svc.CreateBucket(&s3.CreateBucketInput{Bucket: bucket}); err != nil {
+		t.Fatal(err)
+	}
+	// the partitions of a new volume are created in the background
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	var err error
+	for i := 0; i < 30; i++ {
+		if _, err = svc.PutObject(&s3.PutObjectInput{Bucket: bucket, Key: aws.String("dir/a"), Body: bytes.NewReader(data)}); err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// whole and ranged GET
+	out, err := svc.GetObject(&s3.GetObjectInput{Bucket: bucket, Key: aws.String("dir/a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(out.Body)
+	out.Body.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("get: %v, %v bytes", err, len(got))
+	}
+	out, err = svc.GetObject(&s3.GetObjectInput{Bucket: bucket, Key: aws.String("dir/a"), Range: aws.String("bytes=100-199")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(out.Body)
+	out.Body.Close()
+	if err != nil || !bytes.Equal(got, data[100:200]) || aws.StringValue(out.ContentRange) != fmt.Sprintf("bytes 100-199/%d", len(data)) {
+		t.Fatalf("ranged get: %v, %v bytes, content range %v", err, len(got), aws.StringValue(out.ContentRange))
+	}
+	if _, err = svc.GetObject(&s3.GetObjectInput{Bucket: bucket, Key: aws.String("dir/missing")}); !isCode(err, "NoSuchKey") {
+		t.Fatalf("get missing: %v", err)
+	}
+
+	// presigned GET
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{Bucket: bucket, Key: aws.String("dir/a")})
+	url, err := req.Presign(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+		t.Fatalf("presigned get: status %v, %v bytes", resp.StatusCode, len(got))
+	}
+
+	// multipart upload
+	large := make([]byte, 12*1024*1024)
+	rand.Read(large)
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		u.PartSize = MinPartSize
+	})
+	if _, err = uploader.Upload(&s3manager.UploadInput{Bucket: bucket, Key: aws.String("dir/sub/large"), Body: bytes.NewReader(large)}); err != nil {
+		t.Fatal(err)
+	}
+	out, err = svc.GetObject(&s3.GetObjectInput{Bucket: bucket, Key: aws.String("dir/sub/large")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(out.Body)
+	out.Body.Close()
+	if err != nil || !bytes.Equal(got, large) {
+		t.Fatalf("get multipart: %v, %v bytes", err, len(got))
+	}
+
+	// listing
+	for _, key := range []string{"b", "dir.txt"} {
+		if _, err = svc.PutObject(&s3.PutObjectInput{Bucket: bucket, Key: aws.String(key), Body: bytes.NewReader(nil)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: bucket, Delimiter: aws.String("/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Contents) != 2 || aws.StringValue(list.Contents[0].Key) != "b" || aws.StringValue(list.Contents[1].Key) != "dir.txt" ||
+		len(list.CommonPrefixes) != 1 || aws.StringValue(list.CommonPrefixes[0].Prefix) != "dir/" {
+		t.Fatalf("list with delimiter: %v", list)
+	}
+	keys := make([]string, 0)
+	err = svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: bucket, Prefix: aws.String("dir/"), MaxKeys: aws.Int64(1)},
+		func(page *s3.ListObjectsV2Output, last bool) bool {
+			for _, object := range page.Contents {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+			return true
+		})
+	if err != nil || fmt.Sprint(keys) != "[dir/a dir/sub/large]" {
+		t.Fatalf("list pages: %v, %v", err, keys)
+	}
+
+	// a bucket is deleted once it is empty
+	if _, err = svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: bucket}); !isCode(err, "BucketNotEmpty") {
+		t.Fatalf("delete non-empty bucket: %v", err)
+	}
+	for _, key := range []string{"dir/a", "dir/sub/large", "b", "dir.txt"} {
+		if _, err = svc.DeleteObject(&s3.DeleteObjectInput{Bucket: bucket, Key: aws.String(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: bucket}); err != nil {
+		t.Fatal(err)
+	}
+}
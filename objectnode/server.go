@@ -0,0 +1,258 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package objectnode implements the object gateway, which serves a subset of
+// the S3 REST API on top of the volumes. Buckets are volumes and objects are
+// the regular files of a volume, the key of an object is its path.
+package objectnode
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/fs"
+	"github.com/tiglabs/containerfs/sdk/master"
+	"github.com/tiglabs/containerfs/util/config"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	ConfigKeyListen     = "listen"     // string, e.g. ":80"
+	ConfigKeyMasterAddr = "masterAddr" // array
+	ConfigKeyRegion     = "region"     // string
+	ConfigKeyReplicas   = "replicas"   // int, replicas of the volumes of new buckets
+)
+
+const (
+	DefaultListen   = ":80"
+	DefaultRegion   = "us-east-1"
+	DefaultReplicas = 3
+
+	// accessKeyCacheTime is how long a key read from the master is used, so
+	// deleted keys stop working after it.
+	accessKeyCacheTime = time.Minute
+)
+
+const (
+	Standby uint32 = iota
+	Start
+	Running
+	Shutdown
+	Stopped
+)
+
+var (
+	ErrBadConfFile = errors.New("bad config file")
+)
+
+// masterClient is the part of master.MasterClient used by the gateway.
+type masterClient interface {
+	GetCluster() (*master.ClusterView, error)
+	CreateVol(req *master.CreateVolRequest) error
+	DeleteVol(req *master.VolRequest) error
+	GetAccessKey(req *master.AccessKeyRequest) (*proto.AccessKeyInfo, error)
+}
+
+// ObjectNode is the object gateway.
+type ObjectNode struct {
+	listen   string
+	region   string
+	replicas int
+	masters  []string
+	mc       masterClient
+
+	// openVolume returns the file system of a volume
+	openVolume func(name string) (*fs.FileSystem, error)
+
+	// file systems of the buckets, by volume name
+	volLock sync.Mutex
+	vols    map[string]*fs.FileSystem
+
+	keyLock sync.RWMutex
+	keys    map[string]*cachedAccessKey
+
+	httpServer *http.Server
+	state      uint32
+	wg         sync.WaitGroup
+}
+
+type cachedAccessKey struct {
+	info   *proto.AccessKeyInfo
+	expire time.Time
+}
+
+func NewServer() *ObjectNode {
+	return &ObjectNode{}
+}
+
+func (o *ObjectNode) Start(cfg *config.Config) (err error) {
+	if atomic.CompareAndSwapUint32(&o.state, Standby, Start) {
+		defer func() {
+			if err != nil {
+				atomic.StoreUint32(&o.state, Standby)
+			} else {
+				atomic.StoreUint32(&o.state, Running)
+			}
+		}()
+		if err = o.parseConfig(cfg); err != nil {
+			return
+		}
+		if err = o.startHttpService(); err != nil {
+			return
+		}
+		o.wg.Add(1)
+	}
+	return
+}
+
+func (o *ObjectNode) Shutdown() {
+	if atomic.CompareAndSwapUint32(&o.state, Running, Shutdown) {
+		o.httpServer.Close()
+		o.wg.Done()
+		atomic.StoreUint32(&o.state, Stopped)
+	}
+}
+
+func (o *ObjectNode) Sync() {
+	if atomic.LoadUint32(&o.state) == Running {
+		o.wg.Wait()
+	}
+}
+
+func (o *ObjectNode) parseConfig(cfg *config.Config) (err error) {
+	if o.listen = cfg.GetString(ConfigKeyListen); o.listen == "" {
+		o.listen = DefaultListen
+	}
+	if o.region = cfg.GetString(ConfigKeyRegion); o.region == "" {
+		o.region = DefaultRegion
+	}
+	if o.replicas = int(cfg.GetInt(ConfigKeyReplicas)); o.replicas == 0 {
+		o.replicas = DefaultReplicas
+	}
+	masters := make([]string, 0)
+	for _, addr := range cfg.GetArray(ConfigKeyMasterAddr) {
+		masters = append(masters, addr.(string))
+	}
+	if len(masters) == 0 || o.replicas < 2 {
+		return ErrBadConfFile
+	}
+	o.init(masters)
+	log.LogDebugf("action[parseConfig] listen(%v) region(%v) replicas(%v) masters(%v)",
+		o.listen, o.region, o.replicas, o.masters)
+	return
+}
+
+func (o *ObjectNode) init(masters []string) {
+	o.masters = masters
+	o.mc = master.NewMasterClient(masters)
+	o.openVolume = func(name string) (*fs.FileSystem, error) {
+		return fs.NewFileSystem(name, strings.Join(masters, ","))
+	}
+	o.vols = make(map[string]*fs.FileSystem)
+	o.keys = make(map[string]*cachedAccessKey)
+}
+
+func (o *ObjectNode) startHttpService() (err error) {
+	var ln net.Listener
+	if ln, err = net.Listen("tcp", o.listen); err != nil {
+		return
+	}
+	o.httpServer = &http.Server{Handler: o}
+	go func() {
+		if err := o.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.LogErrorf("action[startHttpService] serve failed, err(%v)", err)
+		}
+	}()
+	log.LogInfof("action[startHttpService] listen on %v", o.listen)
+	return
+}
+
+// getFileSystem returns the file system of the volume of a bucket.
+func (o *ObjectNode) getFileSystem(bucket string) (fsys *fs.FileSystem, aerr *apiError) {
+	o.volLock.Lock()
+	defer o.volLock.Unlock()
+	if fsys = o.vols[bucket]; fsys != nil {
+		return
+	}
+	vols, err := o.listVols()
+	if err != nil {
+		return nil, ErrServiceUnavailable
+	}
+	if !contains(vols, bucket) {
+		return nil, ErrNoSuchBucket
+	}
+	if fsys, err = o.openVolume(bucket); err != nil {
+		log.LogErrorf("action[getFileSystem] bucket(%v) err(%v)", bucket, err)
+		return nil, ErrServiceUnavailable
+	}
+	o.vols[bucket] = fsys
+	return
+}
+
+func (o *ObjectNode) forgetFileSystem(bucket string) {
+	o.volLock.Lock()
+	delete(o.vols, bucket)
+	o.volLock.Unlock()
+}
+
+// getAccessKey returns the key pair of accessKey, which is cached for
+// accessKeyCacheTime.
+func (o *ObjectNode) getAccessKey(accessKey string) (info *proto.AccessKeyInfo, aerr *apiError) {
+	o.keyLock.RLock()
+	cached, ok := o.keys[accessKey]
+	o.keyLock.RUnlock()
+	if ok && time.Now().Before(cached.expire) {
+		return cached.info, nil
+	}
+
+	info, err := o.mc.GetAccessKey(&master.AccessKeyRequest{AccessKey: accessKey})
+	switch errors.Cause(err) {
+	case nil:
+	case master.ErrAccessKeyNotFound, master.ErrInvalidPara:
+		log.LogWarnf("action[getAccessKey] accessKey(%v) err(%v)", accessKey, err)
+		return nil, ErrInvalidAccessKeyId
+	default:
+		log.LogErrorf("action[getAccessKey] accessKey(%v) err(%v)", accessKey, err)
+		return nil, ErrInternalError
+	}
+	o.keyLock.Lock()
+	o.keys[accessKey] = &cachedAccessKey{info: info, expire: time.Now().Add(accessKeyCacheTime)}
+	o.keyLock.Unlock()
+	return info, nil
+}
+
+// listVols returns the names of all of the volumes.
+func (o *ObjectNode) listVols() (vols []string, err error) {
+	cv, err := o.mc.GetCluster()
+	if err != nil {
+		log.LogErrorf("action[listVols] err(%v)", err)
+		return
+	}
+	return cv.Vols, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -126,6 +126,7 @@ type MetaPartitionReport struct {
 	Status      int
 	MaxInodeID  uint64
 	IsLeader    bool
+	TopDirs     []InodeUsage // Largest directories, reported by the leader
 }
 
 type MetaNodeHeartbeatResponse struct {
@@ -187,3 +188,45 @@ type MetaPartitionOfflineResponse struct {
 	Status      uint8
 	Result      string
 }
+
+// SplitMetaPartitionRequest moves the inodes after SplitAt and their
+// dentries from PartitionID to the new partition NewPartitionID, which
+// serves the upper part of the inode range afterwards.
+type SplitMetaPartitionRequest struct {
+	PartitionID    uint64
+	VolName        string
+	SplitAt        uint64
+	NewPartitionID uint64
+	NewPeers       []Peer
+}
+
+type SplitMetaPartitionResponse struct {
+	PartitionID    uint64
+	VolName        string
+	NewPartitionID uint64
+	End            uint64
+	Status         uint8
+	Result         string
+}
+
+// AccessKeyInfo is a key pair of the object gateway, which signs requests
+// with AWS signature V4. Vols are the volumes the key can access, all of the
+// volumes if empty.
+type AccessKeyInfo struct {
+	AccessKey string
+	SecretKey string
+	Vols      []string
+}
+
+// CanAccess tests whether the key can access volume vol.
+func (info *AccessKeyInfo) CanAccess(vol string) bool {
+	if len(info.Vols) == 0 {
+		return true
+	}
+	for _, v := range info.Vols {
+		if v == vol {
+			return true
+		}
+	}
+	return false
+}
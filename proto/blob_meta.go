@@ -0,0 +1,68 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// MaxBlobMetaSize is the limit of the encoded metadata of a blob object.
+	MaxBlobMetaSize = 4096
+	// BlobMetaExpire is the key of the metadata that holds when a blob object
+	// expires, in unix seconds.
+	BlobMetaExpire = "cfs-expire"
+)
+
+// MarshalBlobMeta encodes the metadata of a blob object, which is stored
+// in front of the data of the object. Empty metadata is encoded as nothing.
+func MarshalBlobMeta(meta map[string]string) (data []byte, err error) {
+	if len(meta) == 0 {
+		return nil, nil
+	}
+	if data, err = json.Marshal(meta); err != nil {
+		return
+	}
+	if len(data) > MaxBlobMetaSize {
+		return nil, fmt.Errorf("blob meta size(%v) exceeds %v", len(data), MaxBlobMetaSize)
+	}
+	return
+}
+
+// UnmarshalBlobMeta decodes the metadata of a blob object.
+func UnmarshalBlobMeta(data []byte) (meta map[string]string, err error) {
+	meta = make(map[string]string)
+	if len(data) == 0 {
+		return
+	}
+	err = json.Unmarshal(data, &meta)
+	return
+}
+
+// BlobMetaExpireTime returns when the blob object of the encoded metadata
+// expires in unix seconds, 0 if it never expires.
+func BlobMetaExpireTime(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+	meta, err := UnmarshalBlobMeta(data)
+	if err != nil {
+		return 0
+	}
+	expire, _ := strconv.ParseInt(meta[BlobMetaExpire], 10, 64)
+	return expire
+}
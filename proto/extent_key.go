@@ -25,15 +25,48 @@ import (
 
 var InvalidKey = errors.New("invalid key error")
 
+// ExtentKey describes a piece of file data stored in an extent.
+// The piece starts at ExtentOffset inside the extent and is Size bytes long.
+// A key with neither partition nor extent is a hole, which reads as zeros.
+// A hole flagged ExtentFlagUnwritten is space allocated by fallocate(2)
+// after the data of the file.
 type ExtentKey struct {
-	PartitionId uint32
-	ExtentId    uint64
-	Size        uint32
-	Crc         uint32
+	PartitionId  uint32
+	ExtentId     uint64
+	ExtentOffset uint32
+	Size         uint32
+	Crc          uint32
+	Flags        uint8
 }
 
+// Flags of an extent key.
+const (
+	ExtentFlagUnwritten uint8 = 1 << iota // hole allocated for appended data
+)
+
 func (ek ExtentKey) String() string {
-	return fmt.Sprintf("ExtentKey{Partition(%v),ExtentID(%v),Size(%v),CRC(%v)}", ek.PartitionId, ek.ExtentId, ek.Size, ek.Crc)
+	return fmt.Sprintf("ExtentKey{Partition(%v),ExtentID(%v),ExtentOffset(%v),Size(%v),CRC(%v),Flags(%#x)}", ek.PartitionId, ek.ExtentId, ek.ExtentOffset, ek.Size, ek.Crc, ek.Flags)
+}
+
+// NewHoleKey returns an extent key which stands for size bytes of zeros.
+func NewHoleKey(size uint32) ExtentKey {
+	return ExtentKey{Size: size}
+}
+
+// IsHole tests whether the key is a hole which has no data stored.
+func (ek *ExtentKey) IsHole() bool {
+	return ek.PartitionId == 0 && ek.ExtentId == 0
+}
+
+// NewUnwrittenKey returns a hole of size bytes allocated after the data of
+// the file, which the data appended next replaces.
+func NewUnwrittenKey(size uint32) ExtentKey {
+	return ExtentKey{Size: size, Flags: ExtentFlagUnwritten}
+}
+
+// IsUnwritten tests whether the key is a hole allocated for appended data.
+func (ek *ExtentKey) IsUnwritten() bool {
+	return ek.IsHole() && ek.Flags&ExtentFlagUnwritten != 0
 }
 
 func (ek *ExtentKey) Equal(k ExtentKey) bool {
@@ -48,36 +81,89 @@ func (k *ExtentKey) Marshal() (m string) {
 	return fmt.Sprintf("%v_%v_%v_%v", k.PartitionId, k.ExtentId, k.Size, k.Crc)
 }
 
+// Binary layouts of an extent key:
+//
+//	version 0: PartitionId(4) | ExtentId(8) | Size(4) | Crc(4)
+//	version 1: 1(1) | PartitionId(4) | ExtentId(8) | ExtentOffset(4) | Size(4) | Crc(4)
+//	version 2: 2(1) | PartitionId(4) | ExtentId(8) | ExtentOffset(4) | Size(4) | Crc(4) | Flags(1)
+//
+// A key of version 1 or later starts with its version. Keys of version 0
+// have none, they are only read from records known to hold them. Version 1
+// marked an unwritten hole with an ExtentOffset of 1.
+const (
+	ExtentKeyVersion0 uint8 = 0
+	ExtentKeyVersion1 uint8 = 1
+	ExtentKeyVersion2 uint8 = 2
+
+	ExtentKeyVersion = ExtentKeyVersion2
+)
+
 func (k *ExtentKey) MarshalBinary() ([]byte, error) {
 	buf := bytes.NewBuffer(make([]byte, 0))
+	if err := buf.WriteByte(ExtentKeyVersion); err != nil {
+		return nil, err
+	}
 	if err := binary.Write(buf, binary.BigEndian, k.PartitionId); err != nil {
 		return nil, err
 	}
 	if err := binary.Write(buf, binary.BigEndian, k.ExtentId); err != nil {
 		return nil, err
 	}
+	if err := binary.Write(buf, binary.BigEndian, k.ExtentOffset); err != nil {
+		return nil, err
+	}
 	if err := binary.Write(buf, binary.BigEndian, k.Size); err != nil {
 		return nil, err
 	}
 	if err := binary.Write(buf, binary.BigEndian, k.Crc); err != nil {
 		return nil, err
 	}
+	if err := buf.WriteByte(k.Flags); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
+// UnmarshalBinary reads a key which starts with its version.
 func (k *ExtentKey) UnmarshalBinary(buf *bytes.Buffer) (err error) {
+	var version uint8
+	if version, err = buf.ReadByte(); err != nil {
+		return
+	}
+	if version != ExtentKeyVersion1 && version != ExtentKeyVersion2 {
+		return fmt.Errorf("unknown extent key version %v", version)
+	}
+	return k.UnmarshalBinaryVersion(buf, version)
+}
+
+// UnmarshalBinaryVersion reads a key of the version given, without its
+// leading version.
+func (k *ExtentKey) UnmarshalBinaryVersion(buf *bytes.Buffer, version uint8) (err error) {
 	if err = binary.Read(buf, binary.BigEndian, &k.PartitionId); err != nil {
 		return
 	}
 	if err = binary.Read(buf, binary.BigEndian, &k.ExtentId); err != nil {
 		return
 	}
+	k.ExtentOffset = 0
+	if version >= ExtentKeyVersion1 {
+		if err = binary.Read(buf, binary.BigEndian, &k.ExtentOffset); err != nil {
+			return
+		}
+	}
 	if err = binary.Read(buf, binary.BigEndian, &k.Size); err != nil {
 		return
 	}
 	if err = binary.Read(buf, binary.BigEndian, &k.Crc); err != nil {
 		return
 	}
+	k.Flags = 0
+	switch {
+	case version >= ExtentKeyVersion2:
+		k.Flags, err = buf.ReadByte()
+	case version == ExtentKeyVersion1 && k.IsHole() && k.ExtentOffset == 1:
+		k.ExtentOffset, k.Flags = 0, ExtentFlagUnwritten
+	}
 	return
 }
 
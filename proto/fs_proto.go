@@ -45,17 +45,31 @@ func IsSymlink(mode uint32) bool {
 }
 
 type InodeInfo struct {
-	Inode      uint64    `json:"ino"`
-	Mode       uint32    `json:"mode"`
-	Nlink      uint32    `json:"nlink"`
-	Size       uint64    `json:"sz"`
-	Uid        uint32    `json:"uid"`
-	Gid        uint32    `json:"gid"`
-	Generation uint64    `json:"gen"`
-	ModifyTime time.Time `json:"mt"`
-	CreateTime time.Time `json:"ct"`
-	AccessTime time.Time `json:"at"`
-	Target     []byte    `json:"tgt"`
+	Inode      uint64      `json:"ino"`
+	Mode       uint32      `json:"mode"`
+	Nlink      uint32      `json:"nlink"`
+	Size       uint64      `json:"sz"`
+	Uid        uint32      `json:"uid"`
+	Gid        uint32      `json:"gid"`
+	Generation uint64      `json:"gen"`
+	ModifyTime time.Time   `json:"mt"`
+	CreateTime time.Time   `json:"ct"`
+	AccessTime time.Time   `json:"at"`
+	Target     []byte      `json:"tgt"`
+	Flags      uint32      `json:"flags"`
+	Retention  int64       `json:"ret"`
+	Inline     []byte      `json:"inline,omitempty"`
+	Shards     []uint64    `json:"shards,omitempty"`
+	Usage      *DirUsage   `json:"usage,omitempty"`
+	Parent     uint64      `json:"parent,omitempty"`
+	Links      []InodeLink `json:"links,omitempty"`
+	Unwritten  uint64      `json:"unwritten,omitempty"` // Allocated after the data
+}
+
+// IsRetained tests whether the inode is a committed WORM file which is
+// still under retention at the unix time now.
+func (info *InodeInfo) IsRetained(now int64) bool {
+	return info.Retention != 0 && now < info.Retention
 }
 
 func (info *InodeInfo) String() string {
@@ -77,6 +91,7 @@ type CreateInodeRequest struct {
 	PartitionID uint64 `json:"pid"`
 	Mode        uint32 `json:"mode"`
 	Target      []byte `json:"tgt"`
+	ParentID    uint64 `json:"pino,omitempty"`
 }
 
 type CreateInodeResponse struct {
@@ -119,6 +134,13 @@ type CreateDentryRequest struct {
 	Mode        uint32 `json:"mode"`
 }
 
+// CreateDentryResponse tells the number of entries created in the parent
+// directory, so that the client can shard the directory once it grows
+// large.
+type CreateDentryResponse struct {
+	Entries uint64 `json:"entries"`
+}
+
 type UpdateDentryRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
@@ -188,6 +210,7 @@ type ReadDirRequest struct {
 
 type ReadDirResponse struct {
 	Children []Dentry `json:"children"`
+	Shards   []uint64 `json:"shards,omitempty"`
 }
 
 type AppendExtentKeyRequest struct {
@@ -219,18 +242,232 @@ type TruncateResponse struct {
 	Extents []ExtentKey `json:"ek"`
 }
 
-type SetattrRequest struct {
+type PunchHoleRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
-	Mode        uint32 `json:"mode"`
-	Uid         uint32 `json:"uid"`
-	Gid         uint32 `json:"gid"`
-	Valid       uint32 `json:"valid"`
+	Offset      uint64 `json:"off"`
+	Size        uint64 `json:"sz"`
+}
+
+// InlineWriteRequest writes data into the body of a small file, which is
+// kept inline in the inode instead of extents.
+type InlineWriteRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+	Offset      uint64 `json:"off"`
+	Data        []byte `json:"data"`
+}
+
+// CloneExtentsRequest makes DstInode share the extents of range
+// [SrcOffset, SrcOffset+Size) of SrcInode, which are appended to the data
+// of DstInode at DstOffset. Both inodes must live in the meta partition
+// PartitionID.
+type CloneExtentsRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	SrcInode    uint64 `json:"src"`
+	DstInode    uint64 `json:"dst"`
+	SrcOffset   uint64 `json:"srcoff"`
+	DstOffset   uint64 `json:"dstoff"`
+	Size        uint64 `json:"sz"`
+}
+
+// CloneExtentsResponse replies the number of bytes cloned, less than the
+// size requested at the end of the source.
+type CloneExtentsResponse struct {
+	Size uint64 `json:"sz"`
+}
+
+// WormCommitRequest commits a file of a WORM volume, so that it can not be
+// modified any more and is retained as the volume policy requires.
+type WormCommitRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+}
+
+// MaxBatchItems limits the sub-operations of a BatchRequest.
+const MaxBatchItems = 1024
+
+// BatchItem is a sub-operation of a BatchRequest. Op is the opcode of the
+// operation, one of OpMetaCreateInode, OpMetaDeleteInode, OpMetaCreateDentry,
+// OpMetaDeleteDentry and OpMetaSetattr, and Data is its request.
+type BatchItem struct {
+	Op   uint8  `json:"op"`
+	Data []byte `json:"data"`
+}
+
+// BatchRequest carries the mutations of meta partition PartitionID, which
+// are applied at once. Each of them succeeds or fails on its own.
+type BatchRequest struct {
+	VolName     string      `json:"vol"`
+	PartitionID uint64      `json:"pid"`
+	Items       []BatchItem `json:"items"`
+}
+
+// BatchResult is the result code and the reply of a BatchItem, as if the
+// operation were sent alone.
+type BatchResult struct {
+	ResultCode uint8  `json:"code"`
+	Data       []byte `json:"data,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// ImportItemsRequest copies inodes and dentries split off another meta
+// partition into PartitionID. The items are marshaled by the meta node,
+// Done is set on the last request of a split.
+type ImportItemsRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	Inodes      [][]byte `json:"inodes"`
+	Dentries    [][]byte `json:"dentries"`
+	Done        bool     `json:"done"`
+}
+
+// DirUsage is the recursive usage of a directory, that is the bytes of the
+// files and the number of files and directories under it.
+type DirUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+}
+
+// InodeUsage is the usage of directory Inode, or a change of it.
+type InodeUsage struct {
+	Inode uint64 `json:"ino"`
+	DirUsage
+}
+
+// UpdateUsageRequest adds the usage changes of directories kept by
+// PartitionID, which are found by the meta node of their children.
+type UpdateUsageRequest struct {
+	VolName     string       `json:"vol"`
+	PartitionID uint64       `json:"pid"`
+	Deltas      []InodeUsage `json:"deltas"`
+}
+
+// InodeLink is a dentry of an inode, that is the directory of the dentry and
+// its name there.
+type InodeLink struct {
+	Parent uint64 `json:"pino"`
+	Name   string `json:"name"`
+}
+
+// LinkChange adds a link to Inode, or removes it if Remove is set.
+type LinkChange struct {
+	Inode uint64 `json:"ino"`
+	InodeLink
+	Remove bool `json:"rm,omitempty"`
+}
+
+// UpdateLinksRequest applies the link changes of inodes kept by
+// PartitionID, in order. They are found by the meta node of the dentries.
+type UpdateLinksRequest struct {
+	VolName     string       `json:"vol"`
+	PartitionID uint64       `json:"pid"`
+	Changes     []LinkChange `json:"changes"`
+}
+
+// Types of the changes in the change feed of a meta partition. A rename to
+// a new name is a ChangeCreate of the new dentry and a ChangeDelete of the
+// old one, both of the same inode, which may be on different partitions.
+// ChangeRename switches an existing dentry to another inode, that is a
+// rename over an existing name.
+const (
+	ChangeCreate uint8 = iota + 1
+	ChangeDelete
+	ChangeRename
+	ChangeSetattr
+	ChangeSize
+)
+
+// MetaChange is a change of the metadata of a meta partition. Index is the
+// raft apply index of the change, which may be shared by several changes,
+// and Time the unix time it was applied at.
+type MetaChange struct {
+	PartitionID uint64 `json:"pid"`
+	Index       uint64 `json:"idx"`
+	Time        int64  `json:"ts"`
+	Type        uint8  `json:"type"`
+	Inode       uint64 `json:"ino"`
+	Parent      uint64 `json:"pino,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Mode        uint32 `json:"mode,omitempty"`
+	OldInode    uint64 `json:"old,omitempty"`
+	Valid       uint32 `json:"valid,omitempty"`
+	Size        uint64 `json:"sz,omitempty"`
+}
+
+// ReadChangesRequest reads the changes of a meta partition from apply
+// index From, 0 for the first change kept. If there is none yet, the meta
+// node waits up to Wait milliseconds for one.
+type ReadChangesRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	From        uint64 `json:"from"`
+	Limit       int    `json:"limit"`
+	Wait        int64  `json:"wait"`
+}
+
+// ReadChangesResponse returns the changes in order, and the index to read
+// from next time. Start is the first index kept by the meta node, if it is
+// after the index asked for the changes in between are lost and none is
+// returned.
+type ReadChangesResponse struct {
+	Changes []MetaChange `json:"changes"`
+	Next    uint64       `json:"next"`
+	Start   uint64       `json:"start"`
+}
+
+// MovedResponse is the body of OpMovedErr. Inode is the inode which
+// decided the partition of the request, it is served by another partition
+// since a split.
+type MovedResponse struct {
+	Inode uint64 `json:"ino"`
+}
+
+// ShardedResponse is the body of OpShardedErr. The directory of the request
+// is sharded, its new dentries are kept in the shard directories by the
+// hash of their names.
+type ShardedResponse struct {
+	Shards []uint64 `json:"shards"`
+}
+
+type SetattrRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	Inode       uint64   `json:"ino"`
+	Mode        uint32   `json:"mode"`
+	Uid         uint32   `json:"uid"`
+	Gid         uint32   `json:"gid"`
+	Flags       uint32   `json:"flags"`
+	Retention   int64    `json:"ret"`
+	Shards      []uint64 `json:"shards,omitempty"`
+	Parent      uint64   `json:"parent,omitempty"`
+	Size        uint64   `json:"sz,omitempty"`
+	Valid       uint32   `json:"valid"`
 }
 
 const (
 	AttrMode uint32 = 1 << iota
 	AttrUid
 	AttrGid
+	AttrFlags
+	AttrRetention
+	AttrShards
+	AttrParent
+	AttrSize // Extends the file with unwritten space, never shrinks it
+)
+
+// Inode flags, the values are the same as FS_IOC_GETFLAGS flags of Linux.
+const (
+	FlagImmutable uint32 = 0x00000010 // FS_IMMUTABLE_FL
+	FlagAppend    uint32 = 0x00000020 // FS_APPEND_FL
+
+	FlagMask = FlagImmutable | FlagAppend
 )
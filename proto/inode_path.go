@@ -0,0 +1,72 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"path"
+)
+
+// MaxPathDepth bounds the directories walked up from an inode, in case the
+// links form a loop.
+const MaxPathDepth = 4096
+
+// InodeGetter returns the inode info of ino, nil if it does not exist.
+type InodeGetter func(ino uint64) (*InodeInfo, error)
+
+// InodePaths returns the paths of inode ino from the root of the volume, one
+// for each of its links. The links of an inode are recorded by the meta
+// nodes shortly after the dentries are changed, so a new inode may have no
+// path yet.
+func InodePaths(ino uint64, get InodeGetter) (paths []string, err error) {
+	return inodePaths(ino, get, 0)
+}
+
+func inodePaths(ino uint64, get InodeGetter, depth int) (paths []string, err error) {
+	if ino == RootIno {
+		return []string{"/"}, nil
+	}
+	if depth >= MaxPathDepth {
+		return nil, fmt.Errorf("inode %v: path deeper than %v", ino, MaxPathDepth)
+	}
+	info, err := get(ino)
+	if err != nil || info == nil {
+		return
+	}
+	if len(info.Links) == 0 && IsDir(info.Mode) && info.Parent != 0 {
+		// The shard directories of a directory have no dentry, their
+		// dentries are shown in the directory.
+		var parent *InodeInfo
+		if parent, err = get(info.Parent); err != nil || parent == nil {
+			return
+		}
+		for _, shard := range parent.Shards {
+			if shard == ino {
+				return inodePaths(info.Parent, get, depth+1)
+			}
+		}
+		return
+	}
+	for _, link := range info.Links {
+		var dirs []string
+		if dirs, err = inodePaths(link.Parent, get, depth+1); err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			paths = append(paths, path.Join(dir, link.Name))
+		}
+	}
+	return
+}
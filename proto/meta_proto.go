@@ -14,6 +14,10 @@
 
 package proto
 
+// MaxInlineSize limits the inline size of a volume, the body of a file kept
+// inline in its inode.
+const MaxInlineSize = 64 * 1024
+
 type CreateNameSpaceRequest struct {
 	Name string
 }
@@ -34,6 +38,23 @@ type CreateMetaPartitionRequest struct {
 	End         uint64
 	PartitionID uint64
 	Members     []Peer
+	Worm        WormPolicy
+	StoreMode   string // Storage engine of the partition, empty for the default of the meta node
+	SplitFrom   uint64 // Set if the partition takes over the upper range of partition SplitFrom
+	InlineSize  uint32 // Files up to InlineSize bytes are kept inline, 0: disabled
+}
+
+// WormPolicy describes a write-once-read-many volume. Files of the volume
+// are committed after they are closed, or after they are not modified for
+// AutoCommit seconds, and can not be removed for Retention seconds since.
+type WormPolicy struct {
+	Retention  int64 `json:"retention"`
+	AutoCommit int64 `json:"autoCommit"`
+}
+
+// Enabled tests whether the volume is a WORM volume.
+func (w WormPolicy) Enabled() bool {
+	return w.Retention > 0
 }
 
 type CreateMetaPartitionResponse struct {
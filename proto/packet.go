@@ -64,6 +64,8 @@ const (
 	OpGetDataPartitionMetrics  uint8 = 0x0E
 	OpBlobStoreGetAllWaterMark uint8 = 0x0F
 	OpNotifyBlobRepair         uint8 = 0x10
+	OpPunchHole                uint8 = 0x11
+	OpBlobStat                 uint8 = 0x12
 
 	// Operations: Client -> MetaNode.
 	OpMetaCreateInode   uint8 = 0x20
@@ -83,6 +85,12 @@ const (
 	OpMetaLinkInode     uint8 = 0x2E
 	OpMetaEvictInode    uint8 = 0x2F
 	OpMetaSetattr       uint8 = 0x30
+	OpMetaPunchHole     uint8 = 0x31
+	OpMetaExtentsClone  uint8 = 0x32
+	OpMetaWormCommit    uint8 = 0x33
+	OpMetaInlineWrite   uint8 = 0x34
+	OpMetaBatch         uint8 = 0x35
+	OpMetaReadChanges   uint8 = 0x36
 
 	// Operations: Master -> MetaNode
 	OpCreateMetaPartition  uint8 = 0x40
@@ -91,6 +99,12 @@ const (
 	OpUpdateMetaPartition  uint8 = 0x43
 	OpLoadMetaPartition    uint8 = 0x44
 	OpOfflineMetaPartition uint8 = 0x45
+	OpSplitMetaPartition   uint8 = 0x46
+
+	// Operations: MetaNode -> MetaNode
+	OpMetaImportItems uint8 = 0x50
+	OpMetaUpdateUsage uint8 = 0x51
+	OpMetaUpdateLinks uint8 = 0x52
 
 	// Operations: Master -> DataNode
 	OpCreateDataPartition uint8 = 0x60
@@ -110,6 +124,9 @@ const (
 	OpAgain            uint8 = 0xF9
 	OpExistErr         uint8 = 0xFA
 	OpInodeFullErr     uint8 = 0xFB
+	OpNotPermErr       uint8 = 0xFC
+	OpMovedErr         uint8 = 0xFD
+	OpShardedErr       uint8 = 0xFE
 	OpOk               uint8 = 0xF0
 
 	// For connection diagnosis
@@ -240,6 +257,14 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpLoadMetaPartition"
 	case OpOfflineMetaPartition:
 		m = "OpOfflineMetaPartition"
+	case OpSplitMetaPartition:
+		m = "OpSplitMetaPartition"
+	case OpMetaImportItems:
+		m = "OpMetaImportItems"
+	case OpMetaUpdateUsage:
+		m = "OpMetaUpdateUsage"
+	case OpMetaUpdateLinks:
+		m = "OpMetaUpdateLinks"
 	case OpCreateDataPartition:
 		m = "OpCreateDataPartion"
 	case OpDeleteDataPartition:
@@ -260,6 +285,22 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpBlobStoreGetAllWaterMark"
 	case OpNotifyBlobRepair:
 		m = "OpNotifyBlobRepair"
+	case OpPunchHole:
+		m = "OpPunchHole"
+	case OpBlobStat:
+		m = "BlobStat"
+	case OpMetaPunchHole:
+		m = "OpMetaPunchHole"
+	case OpMetaExtentsClone:
+		m = "OpMetaExtentsClone"
+	case OpMetaWormCommit:
+		m = "OpMetaWormCommit"
+	case OpMetaInlineWrite:
+		m = "OpMetaInlineWrite"
+	case OpMetaBatch:
+		m = "OpMetaBatch"
+	case OpMetaReadChanges:
+		m = "OpMetaReadChanges"
 
 	}
 	return
@@ -289,6 +330,12 @@ func (p *Packet) GetResultMesg() (m string) {
 		m = "ExistErr"
 	case OpInodeFullErr:
 		m = "InodeFullErr"
+	case OpNotPermErr:
+		m = "NotPermErr"
+	case OpMovedErr:
+		m = "MovedErr"
+	case OpShardedErr:
+		m = "ShardedErr"
 	case OpArgMismatchErr:
 		m = "ArgUnmatchErr"
 	case OpNotExistErr:
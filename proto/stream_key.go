@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"sync"
 )
 
@@ -55,38 +56,232 @@ func (sk *StreamKey) UnMarshal(data []byte) {
 	json.Unmarshal(data, sk)
 }
 
+// Put records data appended to the stream. The data of an extent is
+// appended in order, so the part of k which the stream holds already, or
+// which has been punched since, is skipped, and the rest is appended after
+// the data of the stream. An unwritten tail is replaced by the data instead
+// of being grown.
 func (sk *StreamKey) Put(k ExtentKey) {
 	sk.Lock()
 	defer sk.Unlock()
-	if len(sk.Extents) == 0 {
-		sk.Extents = append(sk.Extents, k)
-		return
-	}
-	lastIndex := len(sk.Extents) - 1
-	lastKey := sk.Extents[lastIndex]
-	if lastKey.PartitionId == k.PartitionId && lastKey.ExtentId == k.ExtentId {
-		if k.Size > lastKey.Size {
-			sk.Extents[lastIndex].Size = k.Size
-			return
+	tail := sk.unwrittenIndex()
+	var (
+		dataEnd uint64
+		last    = -1
+		start   uint64 // Stream offset of the last key of the extent
+		held    uint64 // End of the extent data held by the keys
+	)
+	for i, ek := range sk.Extents[:tail] {
+		if ek.PartitionId == k.PartitionId && ek.ExtentId == k.ExtentId {
+			last, start = i, dataEnd
+			if end := uint64(ek.ExtentOffset) + uint64(ek.Size); end > held {
+				held = end
+			}
 		}
-		return
+		dataEnd += uint64(ek.Size)
 	}
-	extentsLen := len(sk.Extents)
-	for i := 0; i < extentsLen; i++ {
-		ek := sk.Extents[i]
-		if ek.PartitionId == k.PartitionId && ek.ExtentId == k.ExtentId {
-			if k.Size > ek.Size {
-				sk.Extents[i].Size = k.Size
-				return
+	if last >= 0 {
+		// The extent is the last one written if only holes follow it,
+		// the data punched from its end is skipped too.
+		trailing := true
+		for _, ek := range sk.Extents[last+1 : tail] {
+			if !ek.IsHole() {
+				trailing = false
+				break
 			}
+		}
+		if trailing {
+			held = dataEnd - start + uint64(sk.Extents[last].ExtentOffset)
+		}
+		end := uint64(k.ExtentOffset) + uint64(k.Size)
+		if end <= held {
 			return
 		}
+		if uint64(k.ExtentOffset) < held {
+			k.Size = uint32(end - held)
+			k.ExtentOffset = uint32(held)
+		}
+	}
+	extents := make([]ExtentKey, 0, len(sk.Extents)+1)
+	extents = append(extents, sk.Extents[:tail]...)
+	if n := len(extents); n > 0 && last == n-1 &&
+		extents[n-1].ExtentOffset+extents[n-1].Size == k.ExtentOffset {
+		extents[n-1].Size += k.Size
+	} else {
+		extents = append(extents, k)
 	}
-	sk.Extents = append(sk.Extents, k)
+	sk.Extents = sk.appendUnwritten(extents, tail, uint64(k.Size))
+}
 
+// appendUnwritten appends the unwritten tail of the stream, which starts at
+// key tail, to extents, less the size taken by data appended before it.
+func (sk *StreamKey) appendUnwritten(extents []ExtentKey, tail int,
+	taken uint64) []ExtentKey {
+	for _, ek := range sk.Extents[tail:] {
+		if taken >= uint64(ek.Size) {
+			taken -= uint64(ek.Size)
+			continue
+		}
+		ek.Size -= uint32(taken)
+		taken = 0
+		extents = append(extents, ek)
+	}
+	return extents
+}
+
+// Append appends the keys after the data of the stream as they are, they
+// take the place of the unwritten space.
+func (sk *StreamKey) Append(keys []ExtentKey) {
+	sk.Lock()
+	defer sk.Unlock()
+	tail := sk.unwrittenIndex()
+	extents := make([]ExtentKey, 0, len(sk.Extents)+len(keys))
+	extents = append(extents, sk.Extents[:tail]...)
+	var size uint64
+	for _, k := range keys {
+		extents = appendKey(extents, k)
+		size += uint64(k.Size)
+	}
+	sk.Extents = sk.appendUnwritten(extents, tail, size)
+}
+
+// Slice returns the keys of range [offset, offset+size) of the stream, the
+// keys crossing the range boundaries are cut. Unwritten space is returned as
+// plain holes.
+func (sk *StreamKey) Slice(offset, size uint64) (keys []ExtentKey) {
+	sk.Lock()
+	defer sk.Unlock()
+	var start uint64
+	end := offset + size
+	for _, ek := range sk.Extents {
+		keyEnd := start + uint64(ek.Size)
+		if keyEnd <= offset || start >= end {
+			start = keyEnd
+			continue
+		}
+		k := ek
+		if k.IsUnwritten() {
+			k = NewHoleKey(k.Size)
+		}
+		if offset > start {
+			cut := uint32(offset - start)
+			if !k.IsHole() {
+				k.ExtentOffset += cut
+			}
+			k.Size -= cut
+		}
+		if keyEnd > end {
+			k.Size -= uint32(keyEnd - end)
+		}
+		keys = appendKey(keys, k)
+		start = keyEnd
+	}
 	return
 }
 
+// unwrittenIndex returns the index of the first key of the unwritten tail,
+// the number of keys if there is none.
+func (sk *StreamKey) unwrittenIndex() int {
+	i := len(sk.Extents)
+	for i > 0 && sk.Extents[i-1].IsUnwritten() {
+		i--
+	}
+	return i
+}
+
+// Allocate extends the stream to size bytes with unwritten space. A stream
+// of size bytes or more is not changed.
+func (sk *StreamKey) Allocate(size uint64) {
+	sk.Lock()
+	defer sk.Unlock()
+	var cur uint64
+	for _, ek := range sk.Extents {
+		cur += uint64(ek.Size)
+	}
+	for cur < size {
+		n := size - cur
+		if n > math.MaxUint32 {
+			n = math.MaxUint32
+		}
+		sk.Extents = append(sk.Extents, NewUnwrittenKey(uint32(n)))
+		cur += n
+	}
+}
+
+// Unwritten returns the size of the unwritten tail of the stream.
+func (sk *StreamKey) Unwritten() (size uint64) {
+	sk.Lock()
+	defer sk.Unlock()
+	for _, ek := range sk.Extents[sk.unwrittenIndex():] {
+		size += uint64(ek.Size)
+	}
+	return
+}
+
+// Punch replaces the data in range [offset, offset+size) with a hole and
+// returns the pieces of extents which are no longer referenced by the stream.
+// Keys crossing the range boundaries are split. Range beyond the end of
+// the stream is ignored, so the stream size never changes.
+func (sk *StreamKey) Punch(offset, size uint64) (freed []ExtentKey) {
+	sk.Lock()
+	defer sk.Unlock()
+	var (
+		start   uint64
+		extents = make([]ExtentKey, 0, len(sk.Extents)+2)
+	)
+	punchEnd := offset + size
+	for _, ek := range sk.Extents {
+		end := start + uint64(ek.Size)
+		if end <= offset || start >= punchEnd {
+			extents = appendKey(extents, ek)
+			start = end
+			continue
+		}
+		holeStart, holeEnd := start, end
+		if offset > holeStart {
+			holeStart = offset
+		}
+		if punchEnd < holeEnd {
+			holeEnd = punchEnd
+		}
+		if holeStart > start {
+			head := ek
+			head.Size = uint32(holeStart - start)
+			extents = appendKey(extents, head)
+		}
+		extents = appendKey(extents, NewHoleKey(uint32(holeEnd-holeStart)))
+		if !ek.IsHole() {
+			piece := ek
+			piece.ExtentOffset += uint32(holeStart - start)
+			piece.Size = uint32(holeEnd - holeStart)
+			freed = append(freed, piece)
+		}
+		if holeEnd < end {
+			tail := ek
+			if !ek.IsHole() {
+				tail.ExtentOffset += uint32(holeEnd - start)
+			}
+			tail.Size = uint32(end - holeEnd)
+			extents = appendKey(extents, tail)
+		}
+		start = end
+	}
+	sk.Extents = extents
+	return
+}
+
+// appendKey appends k to extents, merging adjacent holes of the same kind
+// into one key.
+func appendKey(extents []ExtentKey, k ExtentKey) []ExtentKey {
+	if n := len(extents); n > 0 && k.IsHole() && extents[n-1].IsHole() &&
+		k.IsUnwritten() == extents[n-1].IsUnwritten() &&
+		uint64(extents[n-1].Size)+uint64(k.Size) <= math.MaxUint32 {
+		extents[n-1].Size += k.Size
+		return extents
+	}
+	return append(extents, k)
+}
+
 func (sk *StreamKey) Size() (bytes uint64) {
 	sk.Lock()
 	defer sk.Unlock()
@@ -146,3 +341,22 @@ func (sk *StreamKey) UnmarshalBinary(data []byte) (err error) {
 	}
 	return
 }
+
+// UnmarshalBinaryV0 reads keys of ExtentKeyVersion0, which were written
+// without their version.
+func (sk *StreamKey) UnmarshalBinaryV0(data []byte) (err error) {
+	sk.Lock()
+	defer sk.Unlock()
+	buf := bytes.NewBuffer(data)
+	for {
+		if buf.Len() == 0 {
+			break
+		}
+		var ext ExtentKey
+		if err = ext.UnmarshalBinaryVersion(buf, ExtentKeyVersion0); err != nil {
+			return
+		}
+		sk.Extents = append(sk.Extents, ext)
+	}
+	return
+}
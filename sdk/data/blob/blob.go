@@ -22,9 +22,12 @@ import (
 	"github.com/tiglabs/containerfs/util/log"
 	"github.com/tiglabs/containerfs/util/pool"
 	"hash/crc32"
+	"io"
 	"net"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const (
@@ -70,7 +73,9 @@ func (client *BlobClient) checkWriteResponse(request, reply *proto.Packet) (err
 	return
 }
 
-func (client *BlobClient) checkReadResponse(request, reply *proto.Packet, expectCrc uint32) (err error) {
+// checkReadResponse checks the crc of the data read, which is also checked
+// against expectCrc, the crc of the object, if the whole object is read.
+func (client *BlobClient) checkReadResponse(request, reply *proto.Packet, expectCrc uint32, whole bool) (err error) {
 	if reply.ResultCode != proto.OpOk {
 		return fmt.Errorf("ReadRequest(%v) reply(%v) replyOp Err msg(%v)",
 			request.GetUniqueLogId(), reply.GetUniqueLogId(), string(reply.Data[:reply.Size]))
@@ -87,14 +92,65 @@ func (client *BlobClient) checkReadResponse(request, reply *proto.Packet, expect
 			" replyHeaderCrc(%v) userExpectCrc(%v)", request.GetUniqueLogId(),
 			reply.GetUniqueLogId(), replyBodyCrc, reply.Crc, expectCrc)
 	}
-	if expectCrc != replyBodyCrc {
+	if whole && expectCrc != replyBodyCrc {
 		return fmt.Errorf("ReadRequest(%v) reply(%v) CRC not equare,request(%v) userExpectCrc(%v) reply(%v)", request.GetUniqueLogId(),
 			reply.GetUniqueLogId(), request.Crc, expectCrc, replyBodyCrc)
 	}
 	return
 }
 
+// Write writes data as an object and returns its key. Data larger than
+// ChunkSize is written as a chunked object, whose key is that of its manifest.
 func (client *BlobClient) Write(data []byte) (key string, err error) {
+	return client.WriteWithOptions(data, WriteOptions{})
+}
+
+// WriteWithMeta writes data as an object with the metadata meta, e.g. the
+// content type, which is returned by Stat.
+func (client *BlobClient) WriteWithMeta(data []byte, meta map[string]string) (key string, err error) {
+	return client.WriteWithOptions(data, WriteOptions{Meta: meta})
+}
+
+// WriteOptions are the options of an object written by WriteWithOptions.
+type WriteOptions struct {
+	Meta map[string]string // the metadata returned by Stat
+	// The object is deleted by the datanodes once TTL passes after it is
+	// written, it never expires if TTL is 0.
+	TTL time.Duration
+}
+
+// WriteWithOptions writes data as an object with opts. The metadata of a
+// chunked object is stored with its manifest, and its chunks expire with it.
+func (client *BlobClient) WriteWithOptions(data []byte, opts WriteOptions) (key string, err error) {
+	if opts.TTL < 0 || opts.Meta[proto.BlobMetaExpire] != "" {
+		log.LogErrorf("Write: ttl(%v) meta(%v) invalid", opts.TTL, opts.Meta)
+		return "", syscall.EINVAL
+	}
+	meta, chunkMeta := opts.Meta, map[string]string(nil)
+	if opts.TTL > 0 {
+		expire := strconv.FormatInt(time.Now().Add(opts.TTL).Unix(), 10)
+		meta = make(map[string]string, len(opts.Meta)+1)
+		for k, v := range opts.Meta {
+			meta[k] = v
+		}
+		meta[proto.BlobMetaExpire] = expire
+		// the chunks of a chunked object carry nothing but the expire time
+		chunkMeta = map[string]string{proto.BlobMetaExpire: expire}
+	}
+	encoded, err := proto.MarshalBlobMeta(meta)
+	if err != nil {
+		log.LogErrorf("Write: err(%v)", err)
+		return "", syscall.EINVAL
+	}
+	if len(data) > ChunkSize {
+		encodedChunk, _ := proto.MarshalBlobMeta(chunkMeta)
+		return client.writeChunks(data, encoded, encodedChunk)
+	}
+	return client.writeObject(data, encoded)
+}
+
+// writeObject writes data as one object, meta is the encoded metadata.
+func (client *BlobClient) writeObject(data, meta []byte) (key string, err error) {
 	var (
 		dp *wrapper.DataPartition
 	)
@@ -111,7 +167,7 @@ func (client *BlobClient) Write(data []byte) (key string, err error) {
 		var (
 			conn *net.TCPConn
 		)
-		request := NewBlobWritePacket(dp, writeData)
+		request := NewBlobWritePacket(dp, meta, writeData)
 		if conn, err = client.conns.Get(dp.Hosts[0]); err != nil {
 			log.LogWarnf("WriteRequest(%v) Get connect from host(%v) err(%v)", request.GetUniqueLogId(), dp.Hosts[0], err.Error())
 			exclude = append(exclude, dp.PartitionID)
@@ -138,6 +194,10 @@ func (client *BlobClient) Write(data []byte) (key string, err error) {
 		}
 		partitionID, fileID, objID, crc := ParsePacket(reply)
 		client.conns.Put(conn, false)
+		// the crc of the packet covers the metadata too
+		if len(meta) > 0 {
+			crc = crc32.ChecksumIEEE(writeData)
+		}
 		key = GenKey(client.cluster, client.volname, partitionID, fileID, objID, uint32(writeSize), crc)
 		return key, nil
 	}
@@ -145,7 +205,7 @@ func (client *BlobClient) Write(data []byte) (key string, err error) {
 	return "", syscall.EIO
 }
 
-func (client *BlobClient) readDataFromHost(request *proto.Packet, target string, expectCrc uint32) (data []byte, err error) {
+func (client *BlobClient) readDataFromHost(request *proto.Packet, target string, expectCrc uint32, whole bool) (data []byte, err error) {
 
 	var (
 		conn *net.TCPConn
@@ -165,7 +225,11 @@ func (client *BlobClient) readDataFromHost(request *proto.Packet, target string,
 		err = errors.Annotatef(err, "ReadRequest(%v) ReadFrom host(%v)-", request.GetUniqueLogId(), target)
 		return
 	}
-	if err = client.checkReadResponse(request, reply, expectCrc); err != nil {
+	if reply.ResultCode == proto.OpNotExistErr {
+		client.conns.Put(conn, false)
+		return nil, syscall.ENOENT
+	}
+	if err = client.checkReadResponse(request, reply, expectCrc, whole); err != nil {
 		client.conns.Put(conn, true)
 		err = errors.Annotatef(err, "ReadRequest CheckReadResponse from (%v)", target)
 		return
@@ -176,35 +240,174 @@ func (client *BlobClient) readDataFromHost(request *proto.Packet, target string,
 }
 
 func (client *BlobClient) Read(key string) (data []byte, err error) {
-	cluster, volname, partitionID, fileID, objID, size, crc, err := ParseKey(key)
-	if err != nil || strings.Compare(cluster, client.cluster) != 0 || strings.Compare(volname, client.volname) != 0 {
+	if IsManifestKey(key) {
+		var m *Manifest
+		if m, err = client.readManifest(key); err != nil {
+			return
+		}
+		return client.readChunks(m)
+	}
+	partitionID, fileID, objID, size, crc, err := client.parseKey(key)
+	if err != nil {
 		log.LogErrorf("Read: err(%v)", err)
 		return nil, syscall.EINVAL
 	}
+	return client.read(key, partitionID, fileID, objID, 0, size, size, crc)
+}
 
-	dp, err := client.wraper.GetDataPartition(partitionID)
+// ReadAt reads length bytes at offset of the object. Like io.ReaderAt, it
+// returns io.EOF with the data up to the end of the object if the range
+// exceeds it. Only the crc of the data transferred is checked, use Read or
+// NewReader to check the data against the crc of the object.
+func (client *BlobClient) ReadAt(key string, offset int64, length int) (data []byte, err error) {
+	if offset < 0 || length < 0 {
+		log.LogErrorf("ReadAt: key(%v) offset(%v) length(%v)", key, offset, length)
+		return nil, syscall.EINVAL
+	}
+	if IsManifestKey(key) {
+		var m *Manifest
+		if m, err = client.readManifest(key); err != nil {
+			return
+		}
+		return client.readChunksAt(m, offset, length)
+	}
+	partitionID, fileID, objID, size, crc, err := client.parseKey(key)
+	if err != nil {
+		log.LogErrorf("ReadAt: key(%v) err(%v)", key, err)
+		return nil, syscall.EINVAL
+	}
+	if offset >= int64(size) {
+		return nil, io.EOF
+	}
+	readSize := uint32(length)
+	if int64(length) > int64(size)-offset {
+		readSize = uint32(int64(size) - offset)
+		err = io.EOF
+	}
+	if readSize == 0 {
+		return nil, err
+	}
+	data, rerr := client.read(key, partitionID, fileID, objID, offset, readSize, size, crc)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return data, err
+}
+
+func (client *BlobClient) parseKey(key string) (partitionID uint32, fileID uint64, objID int64, size, crc uint32, err error) {
+	cluster, volname, partitionID, fileID, objID, size, crc, err := ParseKey(key)
+	if err != nil {
+		return
+	}
+	if strings.Compare(cluster, client.cluster) != 0 || strings.Compare(volname, client.volname) != 0 {
+		err = fmt.Errorf("key(%v) not of cluster(%v) vol(%v)", key, client.cluster, client.volname)
+	}
+	return
+}
+
+// read reads size bytes at offset of the object from any replica, objSize
+// and crc are the size and the crc of the whole object.
+func (client *BlobClient) read(key string, partitionID uint32, fileID uint64, objID, offset int64, size, objSize, crc uint32) (data []byte, err error) {
+	whole := offset == 0 && size == objSize
+	var request *proto.Packet
+	if whole {
+		request = NewBlobReadPacket(partitionID, fileID, objID, size)
+	} else {
+		request = NewBlobRangeReadPacket(partitionID, fileID, objID, offset, size)
+	}
+	return client.readFromReplicas(key, request, crc, whole)
+}
+
+// readFromReplicas sends a read request to the replicas in turn until one
+// of them replies.
+func (client *BlobClient) readFromReplicas(key string, request *proto.Packet, crc uint32, whole bool) (data []byte, err error) {
+	dp, err := client.wraper.GetDataPartition(request.PartitionID)
 	if dp == nil {
 		log.LogErrorf("Read: No partition, key(%v) err(%v)", key, err)
 		return
 	}
 
-	request := NewBlobReadPacket(partitionID, fileID, objID, size)
 	mesg := ""
+	notExist := 0
 	for i := 0; i < len(dp.Hosts); i++ {
-		data, err = client.readDataFromHost(request, dp.Hosts[i], crc)
+		data, err = client.readDataFromHost(request, dp.Hosts[i], crc, whole)
 		if err == nil {
 			return
 		}
+		if err == syscall.ENOENT {
+			notExist++
+		}
 		log.LogWarn(err.Error())
 		mesg += fmt.Sprintf(" (index(%v) err(%v))", i, err.Error())
 	}
 	log.LogWarn(mesg)
+	// deleted or never written, as all of the replicas tell
+	if notExist == len(dp.Hosts) {
+		return nil, syscall.ENOENT
+	}
 	err = fmt.Errorf(mesg)
 
 	return nil, err
 }
 
+// ObjectInfo is what Stat returns of an object.
+type ObjectInfo struct {
+	Key      string
+	Size     int64
+	Crc      uint32
+	Meta     map[string]string
+	ExpireAt time.Time // zero if the object never expires
+}
+
+// Stat returns the size, the crc and the metadata of an object without
+// reading its data.
+func (client *BlobClient) Stat(key string) (info *ObjectInfo, err error) {
+	partitionID, fileID, objID, size, crc, err := client.parseKey(key)
+	if err != nil {
+		log.LogErrorf("Stat: err(%v)", err)
+		return nil, syscall.EINVAL
+	}
+	info = &ObjectInfo{Key: key, Size: int64(size), Crc: crc}
+	if IsManifestKey(key) {
+		var m *Manifest
+		if m, err = client.readManifest(key); err != nil {
+			return nil, err
+		}
+		info.Size, info.Crc = m.Size, m.Crc
+	}
+	request := NewBlobStatPacket(partitionID, fileID, objID)
+	meta, err := client.readFromReplicas(key, request, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if info.Meta, err = proto.UnmarshalBlobMeta(meta); err != nil {
+		log.LogErrorf("Stat: key(%v) err(%v)", key, err)
+		return nil, syscall.EIO
+	}
+	if expire := proto.BlobMetaExpireTime(meta); expire > 0 {
+		info.ExpireAt = time.Unix(expire, 0)
+		delete(info.Meta, proto.BlobMetaExpire)
+	}
+	return
+}
+
+// Delete deletes an object. The chunks of a chunked object are deleted
+// before its manifest, so that the deletion can be retried if it fails.
 func (client *BlobClient) Delete(key string) (err error) {
+	if IsManifestKey(key) {
+		var m *Manifest
+		if m, err = client.readManifest(key); err != nil {
+			return
+		}
+		if err = client.deleteChunks(m); err != nil {
+			return
+		}
+		return client.deleteObject(strings.TrimSuffix(key, ManifestKeySuffix))
+	}
+	return client.deleteObject(key)
+}
+
+func (client *BlobClient) deleteObject(key string) (err error) {
 	cluster, volname, partitionID, fileID, objID, _, _, err := ParseKey(key)
 	if err != nil || strings.Compare(cluster, client.cluster) != 0 || strings.Compare(volname, client.volname) != 0 {
 		log.LogErrorf("Delete: err(%v)", err)
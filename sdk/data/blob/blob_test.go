@@ -15,6 +15,9 @@
 package blob
 
 import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -63,3 +66,47 @@ func TestWrite(t *testing.T) {
 
 	time.Sleep(2 * time.Second)
 }
+
+func TestWriteChunked(t *testing.T) {
+	data := make([]byte, 3*ChunkSize+1)
+	rand.Read(data)
+	key, err := gBlobClient.Write(data)
+	if err != nil || !IsManifestKey(key) {
+		t.Fatalf("Write: key(%v) err(%v)", key, err)
+	}
+	rdata, err := gBlobClient.Read(key)
+	if err != nil || !bytes.Equal(rdata, data) {
+		t.Fatalf("Read: key(%v) size(%v) err(%v)", key, len(rdata), err)
+	}
+	rdata, err = gBlobClient.ReadAt(key, ChunkSize-10, 20)
+	if err != nil || !bytes.Equal(rdata, data[ChunkSize-10:ChunkSize+10]) {
+		t.Fatalf("ReadAt: key(%v) data(%v) err(%v)", key, rdata, err)
+	}
+	r, err := gBlobClient.NewReader(key)
+	if err != nil {
+		t.Fatalf("NewReader: key(%v) err(%v)", key, err)
+	}
+	rdata, err = ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(rdata, data) {
+		t.Fatalf("Reader: key(%v) size(%v) err(%v)", key, len(rdata), err)
+	}
+	if err = gBlobClient.Delete(key); err != nil {
+		t.Fatalf("Delete: key(%v) err(%v)", key, err)
+	}
+}
+
+func TestWriteWithMeta(t *testing.T) {
+	meta := map[string]string{"content-type": "text/plain", "filename": "a.txt"}
+	key, err := gBlobClient.WriteWithMeta([]byte("1234"), meta)
+	if err != nil {
+		t.Fatalf("WriteWithMeta: err(%v)", err)
+	}
+	info, err := gBlobClient.Stat(key)
+	if err != nil || info.Size != 4 || len(info.Meta) != 2 || info.Meta["filename"] != "a.txt" {
+		t.Fatalf("Stat: key(%v) info(%v) err(%v)", key, info, err)
+	}
+	if err = gBlobClient.Delete(key); err != nil {
+		t.Fatalf("Delete: key(%v) err(%v)", key, err)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package blob
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/tiglabs/containerfs/util"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	// Data larger than ChunkSize is written as chunks of ChunkSize, each a
+	// blob object of its own, plus a manifest object listing the chunks.
+	ChunkSize = util.MB
+	// The number of chunks written, read or deleted at the same time.
+	MaxChunkConcurrency = 8
+	// The key of a chunked object is the key of its manifest with the suffix.
+	ManifestKeySuffix = "/m"
+)
+
+// Manifest is the content of the manifest object of a chunked object.
+type Manifest struct {
+	Size      int64    `json:"size"`
+	Crc       uint32   `json:"crc"` // crc of the whole object
+	ChunkSize int64    `json:"chunkSize"`
+	Chunks    []string `json:"chunks"` // keys of the chunks in order
+}
+
+// IsManifestKey reports whether key is the key of a chunked object.
+func IsManifestKey(key string) bool {
+	return strings.HasSuffix(key, ManifestKeySuffix)
+}
+
+func (m *Manifest) check() error {
+	if m.Size <= 0 || m.ChunkSize <= 0 || int64(len(m.Chunks)) != (m.Size+m.ChunkSize-1)/m.ChunkSize {
+		return fmt.Errorf("bad manifest size(%v) chunkSize(%v) chunks(%v)", m.Size, m.ChunkSize, len(m.Chunks))
+	}
+	return nil
+}
+
+// chunkSize returns the size of the i-th chunk.
+func (m *Manifest) chunkSize(i int) int64 {
+	if i == len(m.Chunks)-1 {
+		return m.Size - int64(i)*m.ChunkSize
+	}
+	return m.ChunkSize
+}
+
+// forEachChunk calls fn for chunks 0 to n-1, MaxChunkConcurrency at a time,
+// and returns the first error of them.
+func forEachChunk(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, MaxChunkConcurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChunks writes data as chunks with the metadata chunkMeta in parallel,
+// and then their manifest with the metadata meta. If any of them fails, the
+// chunks written are deleted.
+func (client *BlobClient) writeChunks(data, meta, chunkMeta []byte) (key string, err error) {
+	m := &Manifest{
+		Size:      int64(len(data)),
+		Crc:       crc32.ChecksumIEEE(data),
+		ChunkSize: ChunkSize,
+	}
+	m.Chunks = make([]string, (len(data)+ChunkSize-1)/ChunkSize)
+	err = forEachChunk(len(m.Chunks), func(i int) (err error) {
+		end := util.Min(len(data), (i+1)*ChunkSize)
+		m.Chunks[i], err = client.writeObject(data[i*ChunkSize:end], chunkMeta)
+		return
+	})
+	if err == nil {
+		var manifest []byte
+		if manifest, err = json.Marshal(m); err == nil {
+			key, err = client.writeObject(manifest, meta)
+		}
+	}
+	if err != nil {
+		log.LogErrorf("Write: size(%v) chunks(%v) err(%v)", len(data), len(m.Chunks), err)
+		client.deleteChunks(m)
+		return "", err
+	}
+	log.LogDebugf("TRACE Write: key(%v) size(%v) chunks(%v)", key, len(data), len(m.Chunks))
+	return key + ManifestKeySuffix, nil
+}
+
+// readManifest reads the manifest of a chunked object.
+func (client *BlobClient) readManifest(key string) (m *Manifest, err error) {
+	data, err := client.Read(strings.TrimSuffix(key, ManifestKeySuffix))
+	if err != nil {
+		return
+	}
+	m = new(Manifest)
+	if err = json.Unmarshal(data, m); err == nil {
+		err = m.check()
+	}
+	if err != nil {
+		log.LogErrorf("readManifest: key(%v) err(%v)", key, err)
+		return nil, syscall.EIO
+	}
+	return
+}
+
+// readChunks reads the chunks in parallel, and checks the whole object
+// against the crc in the manifest.
+func (client *BlobClient) readChunks(m *Manifest) (data []byte, err error) {
+	data = make([]byte, m.Size)
+	err = forEachChunk(len(m.Chunks), func(i int) error {
+		chunk, err := client.Read(m.Chunks[i])
+		if err != nil {
+			return err
+		}
+		if int64(len(chunk)) != m.chunkSize(i) {
+			return fmt.Errorf("chunk(%v) size(%v) not of manifest", m.Chunks[i], len(chunk))
+		}
+		copy(data[int64(i)*m.ChunkSize:], chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if crc := crc32.ChecksumIEEE(data); crc != m.Crc {
+		return nil, fmt.Errorf("chunked object crc(%v) not of manifest(%v)", crc, m.Crc)
+	}
+	return
+}
+
+// readChunksAt reads length bytes at offset of a chunked object, like
+// ReadAt does.
+func (client *BlobClient) readChunksAt(m *Manifest, offset int64, length int) (data []byte, err error) {
+	if offset >= m.Size {
+		return nil, io.EOF
+	}
+	end := offset + int64(length)
+	if end > m.Size {
+		end = m.Size
+		err = io.EOF
+	}
+	data = make([]byte, 0, end-offset)
+	for off := offset; off < end; {
+		i := int(off / m.ChunkSize)
+		chunkOffset := off - int64(i)*m.ChunkSize
+		size := util.Min(int(end-off), int(m.chunkSize(i)-chunkOffset))
+		chunk, rerr := client.ReadAt(m.Chunks[i], chunkOffset, size)
+		if rerr != nil && rerr != io.EOF {
+			return nil, rerr
+		}
+		if len(chunk) != size {
+			return nil, fmt.Errorf("chunk(%v) shorter than manifest", m.Chunks[i])
+		}
+		data = append(data, chunk...)
+		off += int64(size)
+	}
+	return
+}
+
+// deleteChunks deletes the chunks written of a chunked object.
+func (client *BlobClient) deleteChunks(m *Manifest) error {
+	return forEachChunk(len(m.Chunks), func(i int) error {
+		if m.Chunks[i] == "" {
+			return nil
+		}
+		err := client.deleteObject(m.Chunks[i])
+		if err != nil {
+			log.LogErrorf("deleteChunks: chunk(%v) err(%v)", m.Chunks[i], err)
+		}
+		return err
+	})
+}
@@ -31,7 +31,9 @@ const (
 	NumKeySegments = 10
 )
 
-func NewBlobWritePacket(dp *wrapper.DataPartition, data []byte) *proto.Packet {
+// NewBlobWritePacket writes data with the encoded metadata meta, which is
+// sent in front of data, and its size after the addresses in Arg.
+func NewBlobWritePacket(dp *wrapper.DataPartition, meta, data []byte) *proto.Packet {
 	p := proto.NewPacket()
 
 	p.StoreMode = proto.BlobStoreMode
@@ -39,6 +41,10 @@ func NewBlobWritePacket(dp *wrapper.DataPartition, data []byte) *proto.Packet {
 	p.ReqID = proto.GetReqID()
 	p.PartitionID = uint32(dp.PartitionID)
 	p.Arg = ([]byte)(dp.GetAllAddrs())
+	if len(meta) > 0 {
+		p.Arg = append(p.Arg, strconv.Itoa(len(meta))...)
+		data = append(append(make([]byte, 0, len(meta)+len(data)), meta...), data...)
+	}
 	p.Arglen = uint32(len(p.Arg))
 	p.Nodes = uint8(len(dp.Hosts) - 1)
 	p.Size = uint32(len(data))
@@ -62,6 +68,29 @@ func NewBlobReadPacket(partitionID uint32, fileID uint64, objID int64, size uint
 	return p
 }
 
+// NewBlobRangeReadPacket reads size bytes at offset of the object, the offset
+// is carried in Arg as a decimal.
+func NewBlobRangeReadPacket(partitionID uint32, fileID uint64, objID, offset int64, size uint32) *proto.Packet {
+	p := NewBlobReadPacket(partitionID, fileID, objID, size)
+	p.Arg = []byte(strconv.FormatInt(offset, 10))
+	p.Arglen = uint32(len(p.Arg))
+
+	return p
+}
+
+func NewBlobStatPacket(partitionID uint32, fileID uint64, objID int64) *proto.Packet {
+	p := proto.NewPacket()
+	p.PartitionID = partitionID
+	p.FileID = fileID
+	p.Offset = objID
+	p.StoreMode = proto.BlobStoreMode
+	p.ReqID = proto.GetReqID()
+	p.Opcode = proto.OpBlobStat
+	p.Nodes = 0
+
+	return p
+}
+
 func NewBlobDeletePacket(dp *wrapper.DataPartition, fileID uint64, objID int64) *proto.Packet {
 	p := proto.NewPacket()
 	p.StoreMode = proto.BlobStoreMode
@@ -88,8 +117,10 @@ func GenKey(clusterName, volName string, partitionID uint32, fileID uint64, objI
 	return key
 }
 
+// ParseKey parses the key of an object, the key of a chunked object is parsed
+// as the key of its manifest.
 func ParseKey(key string) (clusterName, volName string, partitionID uint32, fileID uint64, objID int64, size, crc uint32, err error) {
-	segs := strings.Split(key, "/")
+	segs := strings.Split(strings.TrimSuffix(key, ManifestKeySuffix), "/")
 	if len(segs) != NumKeySegments {
 		err = errors.New(fmt.Sprintf("ParseKey: num key(%v)", key))
 		return
@@ -0,0 +1,213 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package blob
+
+import (
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/tiglabs/containerfs/util"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// Reader reads an object in blocks of util.BlockSize, so that a large object
+// is neither read in one packet nor held in memory at once. The crc of the
+// object is checked once the object is read to its end from its start: if
+// it mismatches, the Read which would return the last bytes returns an
+// error instead, and so do the Reads after it. It is not safe for
+// concurrent use.
+type Reader struct {
+	client *BlobClient
+	key    string
+	size   int64
+	crc    uint32
+	m      *Manifest // the manifest of a chunked object
+	offset int64
+
+	buf    []byte // the block read last
+	bufOff int64  // the offset of buf in the object
+
+	hash   hash.Hash32
+	hashed int64 // the data before hashed is summed by hash
+	err    error // set once the crc mismatches
+	closed bool
+
+	source func(offset int64, length int) ([]byte, error)
+}
+
+// interfaces that Reader implements
+var (
+	_ io.ReadSeeker = (*Reader)(nil)
+	_ io.ReaderAt   = (*Reader)(nil)
+	_ io.Closer     = (*Reader)(nil)
+)
+
+// NewReader returns a Reader of the object of key. The data is not read
+// until the first Read, but the manifest of a chunked object is.
+func (client *BlobClient) NewReader(key string) (*Reader, error) {
+	r := &Reader{
+		client: client,
+		key:    key,
+		hash:   crc32.NewIEEE(),
+	}
+	if IsManifestKey(key) {
+		m, err := client.readManifest(key)
+		if err != nil {
+			return nil, err
+		}
+		r.m, r.size, r.crc = m, m.Size, m.Crc
+		return r, nil
+	}
+	_, _, _, size, crc, err := client.parseKey(key)
+	if err != nil {
+		log.LogErrorf("NewReader: err(%v)", err)
+		return nil, syscall.EINVAL
+	}
+	r.size, r.crc = int64(size), crc
+	return r, nil
+}
+
+// NewSourceReader returns a Reader of the object of key, which is size
+// bytes with crc, and whose data is read by readAt instead of a BlobClient.
+func NewSourceReader(key string, size int64, crc uint32,
+	readAt func(offset int64, length int) ([]byte, error)) *Reader {
+	return &Reader{
+		key:    key,
+		size:   size,
+		crc:    crc,
+		hash:   crc32.NewIEEE(),
+		source: readAt,
+	}
+}
+
+func (r *Reader) readAt(offset int64, length int) ([]byte, error) {
+	if r.source != nil {
+		return r.source(offset, length)
+	}
+	if r.m != nil {
+		return r.client.readChunksAt(r.m, offset, length)
+	}
+	return r.client.ReadAt(r.key, offset, length)
+}
+
+// Size returns the size of the object.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.offset < r.bufOff || r.offset >= r.bufOff+int64(len(r.buf)) {
+		length := util.Min(util.BlockSize, int(r.size-r.offset))
+		buf, err := r.readAt(r.offset, length)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		r.buf, r.bufOff = buf, r.offset
+	}
+	n = copy(p, r.buf[r.offset-r.bufOff:])
+	if r.offset == r.hashed {
+		r.hash.Write(p[:n])
+		r.hashed += int64(n)
+		// Readers which stop at the size, like io.CopyN, do not read
+		// up to io.EOF, so the crc is checked before the last bytes
+		// are returned.
+		if r.hashed == r.size && r.hash.Sum32() != r.crc {
+			log.LogErrorf("Read: key(%v) crc mismatch, expect(%v) actual(%v)", r.key, r.crc, r.hash.Sum32())
+			r.err = syscall.EIO
+			return 0, r.err
+		}
+	}
+	r.offset += int64(n)
+	return n, nil
+}
+
+// ReadAt reads len(p) bytes at offset off of the object, the data is not
+// checked against the crc of the object.
+func (r *Reader) ReadAt(p []byte, off int64) (n int, err error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if rest := r.size - off; int64(len(p)) > rest {
+		p = p[:rest]
+		defer func() {
+			if err == nil {
+				err = io.EOF
+			}
+		}()
+	}
+	for n < len(p) {
+		length := util.Min(util.BlockSize, len(p)-n)
+		data, err := r.readAt(off+int64(n), length)
+		n += copy(p[n:], data)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Seek sets the offset of the next Read, like os.File.Seek. Seeking to the
+// start sums the object again from its start.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, syscall.EINVAL
+	}
+	if offset < 0 {
+		return 0, syscall.EINVAL
+	}
+	if offset == 0 {
+		r.hash.Reset()
+		r.hashed = 0
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close releases the block read last.
+func (r *Reader) Close() error {
+	if r.closed {
+		return os.ErrClosed
+	}
+	r.closed = true
+	r.buf = nil
+	return nil
+}
@@ -15,11 +15,15 @@
 package stream
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"sync"
+	"syscall"
 
 	"github.com/juju/errors"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk"
 	"github.com/tiglabs/containerfs/sdk/data/wrapper"
 	"github.com/tiglabs/containerfs/util/log"
 	"github.com/tiglabs/containerfs/util/ump"
@@ -29,6 +33,8 @@ import (
 
 type AppendExtentKeyFunc func(inode uint64, key proto.ExtentKey) error
 type GetExtentsFunc func(inode uint64) ([]proto.ExtentKey, error)
+type GetInlineFunc func(inode uint64) ([]byte, error)
+type WriteInlineFunc func(inode, offset uint64, data []byte) error
 
 var (
 	gDataWrapper     *wrapper.Wrapper
@@ -44,6 +50,10 @@ type ExtentClient struct {
 	writerLock      sync.RWMutex
 	appendExtentKey AppendExtentKeyFunc
 	getExtents      GetExtentsFunc
+	getInline       GetInlineFunc
+	writeInline     WriteInlineFunc
+	inlineSize      int    // files up to inlineSize bytes are kept inline, 0: disabled
+	inlineSeq       uint64 // versions of the inline bodies written by the writers
 }
 
 func NewExtentClient(volname, master string, appendExtentKey AppendExtentKeyFunc, getExtents GetExtentsFunc) (client *ExtentClient, err error) {
@@ -57,6 +67,11 @@ func NewExtentClient(volname, master string, appendExtentKey AppendExtentKeyFunc
 	client.appendExtentKey = appendExtentKey
 	client.referCnt = make(map[uint64]uint64)
 	client.getExtents = getExtents
+	initRequestPools()
+	return
+}
+
+func initRequestPools() {
 	writeRequestPool = &sync.Pool{New: func() interface{} {
 		return &WriteRequest{}
 	}}
@@ -66,7 +81,15 @@ func NewExtentClient(volname, master string, appendExtentKey AppendExtentKeyFunc
 	closeRequestPool = &sync.Pool{New: func() interface{} {
 		return &CloseRequest{}
 	}}
-	return
+}
+
+// SetInline makes the bodies of files no larger than size bytes kept inline
+// in the inode on the metaNode, they are read with getInline and written
+// with writeInline. Inline bodies are read even if size is 0.
+func (client *ExtentClient) SetInline(size int, getInline GetInlineFunc, writeInline WriteInlineFunc) {
+	client.inlineSize = size
+	client.getInline = getInline
+	client.writeInline = writeInline
 }
 
 func (client *ExtentClient) getStreamWriter(inode uint64) (stream *StreamWriter) {
@@ -89,6 +112,24 @@ func (client *ExtentClient) getStreamWriterForRead(inode uint64) (stream *Stream
 }
 
 func (client *ExtentClient) Write(inode uint64, offset int, data []byte) (write int, err error) {
+	return client.write(context.Background(), inode, offset, data, false)
+}
+
+// WriteNoOverwrite is Write which fails with syscall.EOPNOTSUPP, instead of
+// skipping the data which overlaps the data written to extents already.
+// Inline bodies are overwritten as usual.
+func (client *ExtentClient) WriteNoOverwrite(inode uint64, offset int, data []byte) (write int, err error) {
+	return client.write(context.Background(), inode, offset, data, true)
+}
+
+// WriteContext is Write which gives up once ctx is done, unless the data is
+// being written to dataNodes already.
+func (client *ExtentClient) WriteContext(ctx context.Context, inode uint64, offset int, data []byte) (write int, err error) {
+	write, err = client.write(ctx, inode, offset, data, false)
+	return write, toError("Write", ctx, err)
+}
+
+func (client *ExtentClient) write(ctx context.Context, inode uint64, offset int, data []byte, noOverwrite bool) (write int, err error) {
 	stream := client.getStreamWriter(inode)
 	if stream == nil {
 		prefix := fmt.Sprintf("inodewrite %v_%v_%v", inode, offset, len(data))
@@ -96,16 +137,23 @@ func (client *ExtentClient) Write(inode uint64, offset int, data []byte) (write
 	}
 
 	request := writeRequestPool.Get().(*WriteRequest)
+	request.reset()
 	request.data = data
 	request.kernelOffset = offset
 	request.size = len(data)
+	request.canWrite = 0
+	request.cutSize = 0
+	request.noOverwrite = noOverwrite
+	request.err = nil
 	request.done = make(chan struct{}, 1)
-	stream.requestCh <- request
-	<-request.done
+	if !sendRequest(ctx, stream, request, request.done) {
+		// the request may still be in requestCh, never reuse it
+		return 0, sdk.ContextError("Write", ctx)
+	}
 	err = request.err
 	write = request.canWrite
 	write += request.cutSize
-	if err != nil {
+	if err != nil && err != syscall.EOPNOTSUPP {
 		prefix := fmt.Sprintf("inodewrite %v_%v_%v", inode, offset, len(data))
 		err = errors.Annotatef(err, prefix)
 		log.LogError(errors.ErrorStack(err))
@@ -116,7 +164,17 @@ func (client *ExtentClient) Write(inode uint64, offset int, data []byte) (write
 }
 
 func (client *ExtentClient) OpenForRead(inode uint64) (stream *StreamReader, err error) {
-	return NewStreamReader(inode, client.getExtents)
+	return newStreamReader(inode, client.getExtents, client.getInline)
+}
+
+// OpenForReadContext is OpenForRead which gives up if ctx is done before the
+// extents of the inode are got.
+func (client *ExtentClient) OpenForReadContext(ctx context.Context, inode uint64) (stream *StreamReader, err error) {
+	if err = sdk.ContextError("OpenForRead", ctx); err != nil {
+		return
+	}
+	stream, err = client.OpenForRead(inode)
+	return stream, toError("OpenForRead", ctx, err)
 }
 
 func (client *ExtentClient) OpenForWrite(inode, start uint64) {
@@ -142,6 +200,10 @@ func (client *ExtentClient) OpenForWrite(inode, start uint64) {
 	_, ok = client.writers[inode]
 	if !ok {
 		writer := NewStreamWriter(inode, start, client.appendExtentKey)
+		writer.inlineSize = client.inlineSize
+		writer.getInline = client.getInline
+		writer.writeInline = client.writeInline
+		writer.inlineSeq = &client.inlineSeq
 		client.writers[inode] = writer
 	}
 	client.writerLock.Unlock()
@@ -174,19 +236,85 @@ func (client *ExtentClient) deleteRefercnt(inode uint64) {
 }
 
 func (client *ExtentClient) Flush(inode uint64) (err error) {
+	return client.flush(context.Background(), inode)
+}
+
+// FlushContext is Flush which gives up once ctx is done, unless the data is
+// being flushed already.
+func (client *ExtentClient) FlushContext(ctx context.Context, inode uint64) (err error) {
+	return toError("Flush", ctx, client.flush(ctx, inode))
+}
+
+func (client *ExtentClient) flush(ctx context.Context, inode uint64) (err error) {
 	stream := client.getStreamWriterForRead(inode)
 	if stream == nil {
 		return nil
 	}
 	request := flushRequestPool.Get().(*FlushRequest)
+	request.reset()
+	request.err = nil
 	request.done = make(chan struct{}, 1)
-	stream.requestCh <- request
-	<-request.done
+	if !sendRequest(ctx, stream, request, request.done) {
+		return sdk.ContextError("Flush", ctx)
+	}
 	err = request.err
 	flushRequestPool.Put(request)
 	return err
 }
 
+// Preallocate makes new extents of the inode reserve space on dataNodes
+// until the file is written up to end.
+func (client *ExtentClient) Preallocate(inode, end uint64) (err error) {
+	stream := client.getStreamWriterForRead(inode)
+	if stream == nil {
+		return fmt.Errorf("Prefix(inodeprealloc %v_%v) cannot init write stream", inode, end)
+	}
+	stream.setPreallocEnd(end)
+	return nil
+}
+
+// PreallocateContext is Preallocate, which does not wait for anything.
+func (client *ExtentClient) PreallocateContext(ctx context.Context, inode, end uint64) (err error) {
+	if err = sdk.ContextError("Preallocate", ctx); err != nil {
+		return
+	}
+	return toError("Preallocate", ctx, client.Preallocate(inode, end))
+}
+
+// Seal flushes the pending data of the inode and stops appending to its
+// current extent, so that later writes never touch extents written so far.
+func (client *ExtentClient) Seal(inode uint64) (err error) {
+	return client.seal(context.Background(), inode)
+}
+
+// SealContext is Seal which gives up once ctx is done, unless the inode is
+// being sealed already.
+func (client *ExtentClient) SealContext(ctx context.Context, inode uint64) (err error) {
+	return toError("Seal", ctx, client.seal(ctx, inode))
+}
+
+func (client *ExtentClient) seal(ctx context.Context, inode uint64) (err error) {
+	stream := client.getStreamWriterForRead(inode)
+	if stream == nil {
+		return nil
+	}
+	request := &SealRequest{done: make(chan struct{}, 1)}
+	if !sendRequest(ctx, stream, request, request.done) {
+		return sdk.ContextError("Seal", ctx)
+	}
+	return request.err
+}
+
+// CloseForWriteContext is CloseForWrite which gives up once ctx is done
+// while the pending data is flushed. The writer is closed only if the data
+// is flushed.
+func (client *ExtentClient) CloseForWriteContext(ctx context.Context, inode uint64) (err error) {
+	if err = client.FlushContext(ctx, inode); err != nil {
+		return
+	}
+	return toError("CloseForWrite", ctx, client.CloseForWrite(inode))
+}
+
 func (client *ExtentClient) CloseForWrite(inode uint64) (err error) {
 	client.referLock.Lock()
 	refercnt, ok := client.referCnt[inode]
@@ -231,6 +359,17 @@ func (client *ExtentClient) CloseForWrite(inode uint64) (err error) {
 }
 
 func (client *ExtentClient) Read(stream *StreamReader, inode uint64, data []byte, offset int, size int) (read int, err error) {
+	return client.read(context.Background(), stream, inode, data, offset, size)
+}
+
+// ReadContext is Read which gives up once ctx is done, the reads from
+// dataNodes are aborted. io.EOF is returned as it is.
+func (client *ExtentClient) ReadContext(ctx context.Context, stream *StreamReader, inode uint64, data []byte, offset int, size int) (read int, err error) {
+	read, err = client.read(ctx, stream, inode, data, offset, size)
+	return read, toError("Read", ctx, err)
+}
+
+func (client *ExtentClient) read(ctx context.Context, stream *StreamReader, inode uint64, data []byte, offset int, size int) (read int, err error) {
 	if size == 0 {
 		return
 	}
@@ -243,17 +382,64 @@ func (client *ExtentClient) Read(stream *StreamReader, inode uint64, data []byte
 
 	wstream := client.getStreamWriterForRead(inode)
 	if wstream != nil {
-		request := flushRequestPool.Get().(*FlushRequest)
-		request.done = make(chan struct{}, 1)
-		wstream.requestCh <- request
-		<-request.done
-		err = request.err
-		flushRequestPool.Put(request)
-		if err != nil {
+		if err = client.flush(ctx, inode); err != nil {
 			return 0, err
 		}
+		// Inline writes go to the metaNode directly, reload the body once
+		// the writer has changed it.
+		if version := atomic.LoadUint64(&wstream.inlineVersion); stream.isInline() &&
+			version != stream.inlineVersion {
+			if err = stream.update(); err != nil {
+				return 0, err
+			}
+			stream.inlineVersion = version
+		}
 	}
-	read, err = stream.read(data, offset, size)
+	read, err = stream.read(ctx, data, offset, size)
 
 	return
 }
+
+// sendRequest sends request to stream and waits for it to be done. It
+// returns false if ctx is done before stream starts the request.
+func sendRequest(ctx context.Context, stream *StreamWriter, request interface{ abandon() bool }, done chan struct{}) bool {
+	select {
+	case stream.requestCh <- request:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		if request.abandon() {
+			return false
+		}
+		<-done
+		return true
+	}
+}
+
+// toError converts err to an sdk.Error, io.EOF is returned as it is.
+func toError(op string, ctx context.Context, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if cerr := sdk.ContextError(op, ctx); cerr != nil {
+		return cerr
+	}
+	switch cause := errors.Cause(err).(type) {
+	case *sdk.Error:
+		return sdk.NewError(op, cause.Kind, cause.Errno, cause)
+	case syscall.Errno:
+		// from the callbacks of the metaNode
+		return sdk.NewErrnoError(op, cause, err)
+	}
+	if errors.Cause(err) == wrapper.NoWritablePartitionErr {
+		return sdk.NewError(op, sdk.ErrNoSpace, syscall.ENOSPC, err)
+	}
+	if sdk.IsTimeout(errors.Cause(err)) {
+		return sdk.NewError(op, sdk.ErrTimeout, syscall.ETIMEDOUT, err)
+	}
+	return sdk.NewError(op, sdk.ErrPartitionUnavailable, syscall.EIO, err)
+}
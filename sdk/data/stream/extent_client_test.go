@@ -0,0 +1,46 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestWriteNoOverwrite(t *testing.T) {
+	m := &inlineMeta{bodies: map[uint64][]byte{1: []byte("abcd")}, size: 16}
+	client := newInlineTestClient(m)
+
+	// Inline bodies are overwritten.
+	client.OpenForWrite(1, 4)
+	if n, err := client.WriteNoOverwrite(1, 1, []byte("BC")); n != 2 || err != nil {
+		t.Fatalf("overwrite inline body: %v %v", n, err)
+	}
+	if body := string(m.bodies[1]); body != "aBCd" {
+		t.Fatalf("inline body %q", body)
+	}
+
+	// Files without inline bodies are written to extents, the data written
+	// already is not overwritten.
+	m.size = 0
+	client = newInlineTestClient(m)
+	client.OpenForWrite(2, 8)
+	if n, err := client.WriteNoOverwrite(2, 4, []byte("x")); n != 0 || err != syscall.EOPNOTSUPP {
+		t.Fatalf("overwrite extents: %v %v", n, err)
+	}
+	if size := client.GetWriteSize(2); size != 8 {
+		t.Fatalf("write size %v after a failed overwrite", size)
+	}
+}
@@ -15,9 +15,11 @@
 package stream
 
 import (
+	"context"
 	"fmt"
 	"github.com/juju/errors"
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk"
 	"github.com/tiglabs/containerfs/sdk/data/wrapper"
 	"github.com/tiglabs/containerfs/util"
 	"github.com/tiglabs/containerfs/util/log"
@@ -27,6 +29,7 @@ import (
 	"net"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -50,14 +53,17 @@ type ExtentReader struct {
 
 func NewExtentReader(inode uint64, inInodeOffset int, key proto.ExtentKey) (reader *ExtentReader, err error) {
 	reader = new(ExtentReader)
-	reader.dp, err = gDataWrapper.GetDataPartition(key.PartitionId)
-	if err != nil {
-		return
-	}
 	reader.inode = inode
 	reader.key = key
 	reader.startInodeOffset = uint64(inInodeOffset)
 	reader.endInodeOffset = reader.startInodeOffset + uint64(key.Size)
+	if key.IsHole() {
+		return reader, nil
+	}
+	reader.dp, err = gDataWrapper.GetDataPartition(key.PartitionId)
+	if err != nil {
+		return
+	}
 	rand.Seed(time.Now().UnixNano())
 	hasFindLocalReplica := false
 	for index, host := range reader.dp.Hosts {
@@ -73,18 +79,24 @@ func NewExtentReader(inode uint64, inInodeOffset int, key proto.ExtentKey) (read
 	return reader, nil
 }
 
-func (reader *ExtentReader) read(data []byte, offset, size, kerneloffset, kernelsize int) (err error) {
+func (reader *ExtentReader) read(ctx context.Context, data []byte, offset, size, kerneloffset, kernelsize int) (err error) {
 	if size <= 0 {
 		return
 	}
-	err = reader.readDataFromDataPartition(offset, size, data, kerneloffset, kernelsize)
+	if reader.key.IsHole() {
+		for i := range data[:size] {
+			data[i] = 0
+		}
+		return
+	}
+	err = reader.readDataFromDataPartition(ctx, offset, size, data, kerneloffset, kernelsize)
 
 	return
 }
 
-func (reader *ExtentReader) readDataFromDataPartition(offset, size int, data []byte, kerneloffset, kernelsize int) (err error) {
+func (reader *ExtentReader) readDataFromDataPartition(ctx context.Context, offset, size int, data []byte, kerneloffset, kernelsize int) (err error) {
 	var host string
-	if _, host, err = reader.streamReadDataFromHost(offset, size, data, kerneloffset, kernelsize); err != nil {
+	if _, host, err = reader.streamReadDataFromHost(ctx, offset, size, data, kerneloffset, kernelsize); err != nil {
 		if reader.isUseCloseConnectErr(err) {
 			reader.forceDestoryAllConnect(host)
 		}
@@ -95,7 +107,10 @@ func (reader *ExtentReader) readDataFromDataPartition(offset, size int, data []b
 forLoop:
 	mesg := ""
 	for i := 0; i < len(reader.dp.Hosts); i++ {
-		_, host, err = reader.streamReadDataFromHost(offset, size, data, kerneloffset, kernelsize)
+		if err = sdk.ContextError("Read", ctx); err != nil {
+			return
+		}
+		_, host, err = reader.streamReadDataFromHost(ctx, offset, size, data, kerneloffset, kernelsize)
 		if err == nil {
 			return
 		} else if reader.isUseCloseConnectErr(err) {
@@ -106,7 +121,7 @@ forLoop:
 		mesg += fmt.Sprintf(" (index(%v) err(%v))", i, err.Error())
 	}
 	log.LogWarn(mesg)
-	err = fmt.Errorf(mesg)
+	err = sdk.NewError("Read", sdk.ErrPartitionUnavailable, syscall.EIO, fmt.Errorf(mesg))
 
 	return
 }
@@ -119,9 +134,9 @@ func (reader *ExtentReader) forceDestoryAllConnect(host string) {
 	ReadConnectPool.ReleaseAllConnect(host)
 }
 
-func (reader *ExtentReader) streamReadDataFromHost(offset, expectReadSize int, data []byte, kerneloffset,
+func (reader *ExtentReader) streamReadDataFromHost(ctx context.Context, offset, expectReadSize int, data []byte, kerneloffset,
 	kernelsize int) (actualReadSize int, host string, err error) {
-	request := NewStreamReadPacket(&reader.key, offset, expectReadSize)
+	request := NewStreamReadPacket(&reader.key, offset+int(reader.key.ExtentOffset), expectReadSize)
 	var connect *net.TCPConn
 	index := atomic.LoadUint32(&reader.readerIndex)
 	if index >= uint32(reader.dp.ReplicaNum) {
@@ -137,7 +152,16 @@ func (reader *ExtentReader) streamReadDataFromHost(offset, expectReadSize int, d
 			reader.key.PartitionId, host, request.GetUniqueLogId())
 
 	}
+	timeout := time.Duration(proto.ReadDeadlineTime)
+	if ctx.Done() != nil {
+		// the deadline of the connect is managed by WatchConn
+		timeout = proto.NoReadDeadlineTime
+	}
+	stop := sdk.WatchConn(ctx, connect, time.Duration(proto.ReadDeadlineTime*(1+expectReadSize/util.ReadBlockSize))*time.Second)
 	defer func() {
+		if stop() && err == nil {
+			err = sdk.ContextError("Read", ctx)
+		}
 		if err != nil {
 			ReadConnectPool.Put(connect, ForceCloseConnect)
 			if reader.isUseCloseConnectErr(err) {
@@ -162,7 +186,7 @@ func (reader *ExtentReader) streamReadDataFromHost(offset, expectReadSize int, d
 		reply := NewReply(request.ReqID, reader.dp.PartitionID, request.FileID)
 		canRead := util.Min(util.ReadBlockSize, expectReadSize-actualReadSize)
 		reply.Data = data[actualReadSize : canRead+actualReadSize]
-		err = reply.ReadFromConnStream(connect, proto.ReadDeadlineTime)
+		err = reply.ReadFromConnStream(connect, timeout)
 		if err != nil {
 			err = errors.Annotatef(err, reader.toString()+"streamReadDataFromHost host(%v)  error reqeust(%v)",
 				host, request.GetUniqueLogId())
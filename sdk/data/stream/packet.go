@@ -82,7 +82,7 @@ func NewStreamReadPacket(key *proto.ExtentKey, offset, size int) (p *Packet) {
 	return
 }
 
-func NewCreateExtentPacket(dp *wrapper.DataPartition, inodeId uint64) (p *Packet) {
+func NewCreateExtentPacket(dp *wrapper.DataPartition, inodeId, prealloc uint64) (p *Packet) {
 	p = new(Packet)
 	p.PartitionID = dp.PartitionID
 	p.Magic = proto.ProtoMagic
@@ -94,7 +94,12 @@ func NewCreateExtentPacket(dp *wrapper.DataPartition, inodeId uint64) (p *Packet
 	p.ReqID = proto.GetReqID()
 	p.Opcode = proto.OpCreateFile
 
-	p.Data = make([]byte, 8)
+	if prealloc > 0 {
+		p.Data = make([]byte, 16)
+		binary.BigEndian.PutUint64(p.Data[8:16], prealloc)
+	} else {
+		p.Data = make([]byte, 8)
+	}
 	binary.BigEndian.PutUint64(p.Data, inodeId)
 	p.Size = uint32(len(p.Data))
 
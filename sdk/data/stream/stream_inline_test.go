@@ -0,0 +1,142 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// inlineMeta keeps the inline bodies of files like a metaNode.
+type inlineMeta struct {
+	sync.Mutex
+	bodies map[uint64][]byte
+	size   int
+	gets   int
+}
+
+func (m *inlineMeta) getExtents(inode uint64) ([]proto.ExtentKey, error) {
+	return nil, nil
+}
+
+func (m *inlineMeta) getInline(inode uint64) ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.gets++
+	return append([]byte(nil), m.bodies[inode]...), nil
+}
+
+func (m *inlineMeta) writeInline(inode, offset uint64, data []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	end := int(offset) + len(data)
+	if end > m.size {
+		return syscall.EINVAL
+	}
+	body := m.bodies[inode]
+	if end > len(body) {
+		body = append(body, make([]byte, end-len(body))...)
+	}
+	copy(body[offset:], data)
+	m.bodies[inode] = body
+	return nil
+}
+
+func (m *inlineMeta) getCount() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.gets
+}
+
+func newInlineTestClient(m *inlineMeta) *ExtentClient {
+	initRequestPools()
+	client := &ExtentClient{
+		writers:    make(map[uint64]*StreamWriter),
+		referCnt:   make(map[uint64]uint64),
+		getExtents: m.getExtents,
+	}
+	client.SetInline(m.size, m.getInline, m.writeInline)
+	return client
+}
+
+// readString reads size bytes of the file, reads past the known end of the
+// file reload the file anyway.
+func readString(t *testing.T, client *ExtentClient, reader *StreamReader, inode uint64, size int) string {
+	data := make([]byte, size)
+	n, err := client.Read(reader, inode, data, 0, size)
+	if n == 0 && err != nil {
+		t.Fatalf("read inode %v: %v", inode, err)
+	}
+	return string(data[:n])
+}
+
+func TestStreamReaderInline(t *testing.T) {
+	m := &inlineMeta{bodies: map[uint64][]byte{1: []byte("abcd")}, size: 16}
+	client := newInlineTestClient(m)
+
+	reader, err := client.OpenForRead(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, client, reader, 1, 4); got != "abcd" {
+		t.Fatalf("read %q, want %q", got, "abcd")
+	}
+
+	// The exported reader does not know about inline bodies.
+	plain, err := NewStreamReader(1, m.getExtents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.fileSize != 0 || plain.inline != nil {
+		t.Fatalf("plain reader loaded inline body %q", plain.inline)
+	}
+}
+
+func TestStreamReaderInlineReloadAfterWrite(t *testing.T) {
+	m := &inlineMeta{bodies: map[uint64][]byte{1: []byte("abcd")}, size: 16}
+	client := newInlineTestClient(m)
+	client.OpenForWrite(1, 4)
+
+	reader, err := client.OpenForRead(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gets := m.getCount()
+	for i := 0; i < 3; i++ {
+		if got := readString(t, client, reader, 1, 4); got != "abcd" {
+			t.Fatalf("read %q, want %q", got, "abcd")
+		}
+	}
+	if n := m.getCount() - gets; n != 0 {
+		t.Fatalf("body got %v times without writes", n)
+	}
+
+	if _, err = client.Write(1, 4, []byte("ef")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, client, reader, 1, 6); got != "abcdef" {
+		t.Fatalf("read after write %q, want %q", got, "abcdef")
+	}
+	gets = m.getCount()
+	if got := readString(t, client, reader, 1, 6); got != "abcdef" {
+		t.Fatalf("read %q, want %q", got, "abcdef")
+	}
+	if n := m.getCount() - gets; n != 0 {
+		t.Fatalf("body got %v times after it was reloaded", n)
+	}
+}
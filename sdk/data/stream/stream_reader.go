@@ -15,6 +15,7 @@
 package stream
 
 import (
+	"context"
 	"fmt"
 	"github.com/juju/errors"
 	"github.com/tiglabs/containerfs/proto"
@@ -39,14 +40,25 @@ type StreamReader struct {
 	inode      uint64
 	readers    []*ExtentReader
 	getExtents GetExtentsFunc
+	getInline  GetInlineFunc
 	extents    *proto.StreamKey
+	inline     []byte // body of a small file without extents
 	fileSize   uint64
+
+	inlineVersion uint64 // version of the inline body written by the writer
 }
 
 func NewStreamReader(inode uint64, getExtents GetExtentsFunc) (stream *StreamReader, err error) {
+	return newStreamReader(inode, getExtents, nil)
+}
+
+// newStreamReader is NewStreamReader which reads the inline body of the
+// file with getInline if the file has no extents.
+func newStreamReader(inode uint64, getExtents GetExtentsFunc, getInline GetInlineFunc) (stream *StreamReader, err error) {
 	stream = new(StreamReader)
 	stream.inode = inode
 	stream.getExtents = getExtents
+	stream.getInline = getInline
 	stream.extents = proto.NewStreamKey(inode)
 	stream.extents.Extents, err = stream.getExtents(inode)
 	if err != nil {
@@ -63,6 +75,12 @@ func NewStreamReader(inode uint64, getExtents GetExtentsFunc) (stream *StreamRea
 		offset += int(key.Size)
 	}
 	stream.fileSize = stream.extents.Size()
+	if len(stream.extents.Extents) == 0 && stream.getInline != nil {
+		if stream.inline, err = stream.getInline(inode); err != nil {
+			return
+		}
+		stream.fileSize = uint64(len(stream.inline))
+	}
 	return
 }
 
@@ -78,13 +96,7 @@ func (stream *StreamReader) initCheck(offset, size int) (canread int, err error)
 	if offset+size <= int(stream.fileSize) {
 		return size, nil
 	}
-	newStreamKey := proto.NewStreamKey(stream.inode)
-	newStreamKey.Extents, err = stream.getExtents(stream.inode)
-
-	if err == nil {
-		err = stream.updateLocalReader(newStreamKey)
-	}
-	if err != nil {
+	if err = stream.update(); err != nil {
 		return 0, err
 	}
 
@@ -98,6 +110,32 @@ func (stream *StreamReader) initCheck(offset, size int) (canread int, err error)
 	return size, nil
 }
 
+// isInline tests whether the file has no extents, its body is either empty
+// or kept inline in the inode.
+func (stream *StreamReader) isInline() bool {
+	return len(stream.readers) == 0
+}
+
+// update reloads the extents of the file, or the inline body if the file
+// has no extents.
+func (stream *StreamReader) update() (err error) {
+	newStreamKey := proto.NewStreamKey(stream.inode)
+	if newStreamKey.Extents, err = stream.getExtents(stream.inode); err != nil {
+		return
+	}
+	if len(newStreamKey.Extents) == 0 && stream.getInline != nil {
+		var inline []byte
+		if inline, err = stream.getInline(stream.inode); err != nil {
+			return
+		}
+		stream.inline = inline
+		stream.fileSize = uint64(len(inline))
+		return
+	}
+	stream.inline = nil
+	return stream.updateLocalReader(newStreamKey)
+}
+
 func (stream *StreamReader) updateLocalReader(newStreamKey *proto.StreamKey) (err error) {
 	var (
 		newOffSet int
@@ -131,16 +169,20 @@ func (stream *StreamReader) updateLocalReader(newStreamKey *proto.StreamKey) (er
 	return nil
 }
 
-func (stream *StreamReader) read(data []byte, offset int, size int) (canRead int, err error) {
+func (stream *StreamReader) read(ctx context.Context, data []byte, offset int, size int) (canRead int, err error) {
 	var keyCanRead int
 	keyCanRead, err = stream.initCheck(offset, size)
 	if keyCanRead <= 0 || (err != nil && err != io.EOF) {
 		return
 	}
+	if stream.isInline() {
+		canRead = copy(data[:keyCanRead], stream.inline[offset:])
+		return
+	}
 	readers, readerOffset, readerSize := stream.GetReader(offset, size)
 	for index := 0; index < len(readers); index++ {
 		r := readers[index]
-		err = r.read(data[canRead:canRead+readerSize[index]], readerOffset[index], readerSize[index], offset, size)
+		err = r.read(ctx, data[canRead:canRead+readerSize[index]], readerOffset[index], readerSize[index], offset, size)
 		if err != nil {
 			err = errors.Annotatef(err, "UserRequest{inode(%v) FileSize(%v) "+
 				"Offset(%v) Size(%v)} readers{ (%v) Offset(%v) Size(%v) occous error}",
@@ -22,9 +22,9 @@ import (
 	"github.com/juju/errors"
 	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/sdk/data/wrapper"
+	"github.com/tiglabs/containerfs/util"
 	"github.com/tiglabs/containerfs/util/log"
 	"net"
-	"strings"
 	"sync/atomic"
 )
 
@@ -34,22 +34,66 @@ const (
 	HasClosed                    = -1
 )
 
+// The states of the inline body of the file.
+const (
+	inlineUnknown = iota
+	inlineInUse
+	inlineUnused
+)
+
+// The states of a request sent to the StreamWriter.
+const (
+	requestPending int32 = iota
+	requestStarted
+	requestAbandoned
+)
+
+// requestState lets the caller of a request stop waiting for it once its
+// context is done, as long as the StreamWriter has not started it yet.
+// A request being handled is always finished, so that no data is left
+// half-written by a cancellation.
+type requestState struct {
+	state int32
+}
+
+func (r *requestState) reset() {
+	atomic.StoreInt32(&r.state, requestPending)
+}
+
+func (r *requestState) start() bool {
+	return atomic.CompareAndSwapInt32(&r.state, requestPending, requestStarted)
+}
+
+func (r *requestState) abandon() bool {
+	return atomic.CompareAndSwapInt32(&r.state, requestPending, requestAbandoned)
+}
+
 type WriteRequest struct {
+	requestState
 	data         []byte
 	size         int
 	canWrite     int
 	err          error
 	kernelOffset int
 	cutSize      int
+	noOverwrite  bool // fail instead of cutting the data written already
 	done         chan struct{}
 }
 
 type FlushRequest struct {
+	requestState
 	err  error
 	done chan struct{}
 }
 
 type CloseRequest struct {
+	requestState
+	err  error
+	done chan struct{}
+}
+
+type SealRequest struct {
+	requestState
 	err  error
 	done chan struct{}
 }
@@ -68,6 +112,13 @@ type StreamWriter struct {
 	hasWriteSize            uint64
 	hasClosed               int32
 	hasUpdateToMetaNodeSize uint64
+	preallocEnd             uint64 //file offset up to which new extents reserve space
+	inlineSize              int    //files up to inlineSize bytes are kept inline
+	inlineState             int
+	getInline               GetInlineFunc
+	writeInline             WriteInlineFunc
+	inlineSeq               *uint64 //versions of the inline bodies of the client
+	inlineVersion           uint64  //version of the inline body, changed by every write of it
 }
 
 func NewStreamWriter(inode, start uint64, appendExtentKey AppendExtentKeyFunc) (stream *StreamWriter) {
@@ -79,6 +130,7 @@ func NewStreamWriter(inode, start uint64, appendExtentKey AppendExtentKeyFunc) (
 	stream.exitCh = make(chan bool, 10)
 	stream.excludePartition = make([]uint32, 0)
 	stream.hasUpdateKey = make(map[string]int, 0)
+	stream.inlineSeq = new(uint64)
 	go stream.server()
 
 	return
@@ -146,8 +198,21 @@ func (stream *StreamWriter) server() {
 }
 
 func (stream *StreamWriter) handleRequest(request interface{}) {
+	if r, ok := request.(interface{ start() bool }); ok && !r.start() {
+		// abandoned by its caller
+		return
+	}
 	switch request := request.(type) {
 	case *WriteRequest:
+		if stream.handleInlineWrite(request) {
+			request.done <- struct{}{}
+			break
+		}
+		if request.noOverwrite && request.kernelOffset < int(stream.getHasWriteSize()) {
+			request.err = syscall.EOPNOTSUPP
+			request.done <- struct{}{}
+			break
+		}
 		if request.kernelOffset < int(stream.getHasWriteSize()) {
 			cutSize := int(stream.getHasWriteSize()) - request.kernelOffset
 			if cutSize < len(request.data) {
@@ -163,6 +228,12 @@ func (stream *StreamWriter) handleRequest(request interface{}) {
 	case *FlushRequest:
 		request.err = stream.flushCurrExtentWriter()
 		request.done <- struct{}{}
+	case *SealRequest:
+		request.err = stream.flushCurrExtentWriter()
+		if request.err == nil {
+			stream.sealCurrExtentWriter()
+		}
+		request.done <- struct{}{}
 	case *CloseRequest:
 		request.err = stream.flushCurrExtentWriter()
 		if request.err == nil {
@@ -174,6 +245,66 @@ func (stream *StreamWriter) handleRequest(request interface{}) {
 	}
 }
 
+// handleInlineWrite writes the request into the inline body of the file if
+// the file stays small enough. Once the file grows past inlineSize, the body
+// is merged with the request and moved to the first extent of the file.
+// It returns false if the request should be written to extents.
+func (stream *StreamWriter) handleInlineWrite(request *WriteRequest) bool {
+	if stream.inlineState == inlineUnused || stream.writeInline == nil {
+		return false
+	}
+	end := request.kernelOffset + request.size
+	if end <= stream.inlineSize {
+		err := stream.writeInline(stream.Inode, uint64(request.kernelOffset), request.data[:request.size])
+		if err == syscall.EINVAL {
+			// the file has extents already
+			stream.inlineState = inlineUnused
+			return false
+		}
+		if err == nil {
+			stream.inlineState = inlineInUse
+			stream.inlineChanged()
+			request.canWrite = request.size
+			if uint64(end) > stream.getHasWriteSize() {
+				stream.setHasWriteSize(uint64(end))
+			}
+		}
+		request.err = err
+		return true
+	}
+
+	body, err := stream.getInline(stream.Inode)
+	if err != nil {
+		request.err = err
+		return true
+	}
+	stream.inlineState = inlineUnused
+	if len(body) == 0 {
+		return false
+	}
+	if end > len(body) {
+		body = append(body, make([]byte, end-len(body))...)
+	}
+	copy(body[request.kernelOffset:], request.data[:request.size])
+	if _, err = stream.write(body, 0, len(body)); err == nil {
+		err = stream.flushCurrExtentWriter()
+	}
+	stream.inlineChanged()
+	if err == nil {
+		request.canWrite = request.size
+		stream.setHasWriteSize(uint64(len(body)))
+	}
+	request.err = err
+	log.LogDebugf("inode(%v) move inline body(%v) to extents err(%v)", stream.Inode, len(body), err)
+	return true
+}
+
+// inlineChanged gives the inline body of the file a new version, so that
+// the readers reload it.
+func (stream *StreamWriter) inlineChanged() {
+	atomic.StoreUint64(&stream.inlineVersion, atomic.AddUint64(stream.inlineSeq, 1))
+}
+
 func (stream *StreamWriter) write(data []byte, offset, size int) (total int, err error) {
 	var (
 		write int
@@ -204,7 +335,7 @@ func (stream *StreamWriter) write(data []byte, offset, size int) (total int, err
 			total += write
 			continue
 		}
-		if strings.Contains(err.Error(), FullExtentErr.Error()) {
+		if errors.Cause(err) == FullExtentErr {
 			continue
 		}
 		if err = stream.recoverExtent(); err != nil {
@@ -266,6 +397,17 @@ func (stream *StreamWriter) flushCurrExtentWriter() (err error) {
 	return err
 }
 
+// sealCurrExtentWriter stops writing to the current extent, later writes go to a new extent.
+func (stream *StreamWriter) sealCurrExtentWriter() {
+	writer := stream.getCurrentWriter()
+	if writer == nil {
+		return
+	}
+	writer.close()
+	writer.getConnect().Close()
+	stream.setCurrentWriter(nil)
+}
+
 func (stream *StreamWriter) updateToMetaNodeSize() (sumSize int) {
 	return int(stream.hasUpdateToMetaNodeSize)
 }
@@ -413,7 +555,7 @@ func (stream *StreamWriter) createExtent(dp *wrapper.DataPartition) (extentId ui
 	connect.SetKeepAlive(true)
 	connect.SetNoDelay(true)
 	defer connect.Close()
-	p := NewCreateExtentPacket(dp, stream.Inode)
+	p := NewCreateExtentPacket(dp, stream.Inode, stream.preallocSize())
 	if err = p.WriteToConn(connect); err != nil {
 		err = errors.Annotatef(err, "send CreateExtent(%v) to datapartionHosts(%v)", p.GetUniqueLogId(), dp.Hosts[0])
 		return
@@ -437,6 +579,25 @@ func (stream *StreamWriter) createExtent(dp *wrapper.DataPartition) (extentId ui
 	return extentId, nil
 }
 
+// preallocSize returns how many bytes the next extent should reserve on dataNodes.
+func (stream *StreamWriter) preallocSize() uint64 {
+	end := atomic.LoadUint64(&stream.preallocEnd)
+	hasWrite := stream.getHasWriteSize()
+	if end <= hasWrite {
+		return 0
+	}
+	return uint64(util.Min(int(end-hasWrite), util.ExtentSize))
+}
+
+func (stream *StreamWriter) setPreallocEnd(end uint64) {
+	for {
+		old := atomic.LoadUint64(&stream.preallocEnd)
+		if end <= old || atomic.CompareAndSwapUint64(&stream.preallocEnd, old, end) {
+			return
+		}
+	}
+}
+
 func (stream *StreamWriter) exit() {
 	select {
 	case stream.exitCh <- true:
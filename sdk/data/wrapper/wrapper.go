@@ -15,56 +15,43 @@
 package wrapper
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/util"
 	"github.com/tiglabs/containerfs/util/log"
 )
 
 const (
-	DataPartitionViewUrl        = "/client/dataPartitions"
-	GetClusterInfoURL           = "/admin/getIp"
 	ActionGetDataPartitionView  = "ActionGetDataPartitionView"
 	MinWritableDataPartitionNum = 10
 )
 
 var (
-	MasterHelper = util.NewMasterHelper()
-	LocalIP, _   = util.GetLocalIP()
-)
-
-type DataPartitionView struct {
-	DataPartitions []*DataPartition
-}
+	LocalIP, _ = util.GetLocalIP()
 
-type ClusterInfo struct {
-	Cluster string
-}
+	NoWritablePartitionErr = errors.New("no writable data partition")
+)
 
 type Wrapper struct {
 	sync.RWMutex
 	clusterName           string
 	volName               string
-	masters               []string
+	mc                    *master.MasterClient
 	partitions            map[uint32]*DataPartition
 	rwPartition           []*DataPartition
 	localLeaderPartitions []*DataPartition
 }
 
 func NewDataPartitionWrapper(volName, masterHosts string) (w *Wrapper, err error) {
-	masters := strings.Split(masterHosts, ",")
 	w = new(Wrapper)
-	w.masters = masters
-	for _, m := range w.masters {
-		MasterHelper.AddNode(m)
-	}
+	w.mc = master.NewMasterClient(strings.Split(masterHosts, ","))
 	w.volName = volName
 	w.rwPartition = make([]*DataPartition, 0)
 	w.partitions = make(map[uint32]*DataPartition)
@@ -82,21 +69,11 @@ func (w *Wrapper) GetClusterName() string {
 	return w.clusterName
 }
 func (w *Wrapper) updateClusterInfo() error {
-	masterHelper := util.NewMasterHelper()
-	for _, ip := range w.masters {
-		masterHelper.AddNode(ip)
-	}
-	body, err := masterHelper.Request(http.MethodPost, GetClusterInfoURL, nil, nil)
+	info, err := w.mc.GetClusterInfo()
 	if err != nil {
 		log.LogWarnf("UpdateClusterInfo request: err(%v)", err)
 		return err
 	}
-
-	info := new(ClusterInfo)
-	if err = json.Unmarshal(body, info); err != nil {
-		log.LogWarnf("UpdateClusterInfo unmarshal: err(%v)", err)
-		return err
-	}
 	log.LogInfof("ClusterInfo: %v", *info)
 	w.clusterName = info.Cluster
 	return nil
@@ -113,27 +90,19 @@ func (w *Wrapper) update() {
 }
 
 func (w *Wrapper) updateDataPartition() error {
-	paras := make(map[string]string, 0)
-	paras["name"] = w.volName
-	msg, err := MasterHelper.Request(http.MethodGet, DataPartitionViewUrl, paras, nil)
+	view, err := w.mc.GetDataPartitions(&master.VolRequest{Name: w.volName})
 	if err != nil {
 		return err
 	}
 
-	view := &DataPartitionView{}
-	if err = json.Unmarshal(msg, view); err != nil {
-		return err
-	}
-
-	rwPartitionGroups := make([]*DataPartition, 0)
-	localLeaderPartitionGroups := make([]*DataPartition, 0)
 	for _, dp := range view.DataPartitions {
-		if dp.Status == proto.ReadWrite {
-			rwPartitionGroups = append(rwPartitionGroups, dp)
-		}
-	}
-	for _, dp := range view.DataPartitions {
-		w.replaceOrInsertPartition(dp)
+		w.replaceOrInsertPartition(&DataPartition{
+			PartitionID:   uint32(dp.PartitionID),
+			Status:        dp.Status,
+			ReplicaNum:    dp.ReplicaNum,
+			PartitionType: dp.PartitionType,
+			Hosts:         dp.Hosts,
+		})
 	}
 	partitions := make([]*DataPartition, 0)
 	w.RLock()
@@ -142,8 +111,8 @@ func (w *Wrapper) updateDataPartition() error {
 	}
 	w.RUnlock()
 
-	rwPartitionGroups = make([]*DataPartition, 0)
-	localLeaderPartitionGroups = make([]*DataPartition, 0)
+	rwPartitionGroups := make([]*DataPartition, 0)
+	localLeaderPartitionGroups := make([]*DataPartition, 0)
 	for _, dp := range partitions {
 		if dp.Status == proto.ReadWrite {
 			rwPartitionGroups = append(rwPartitionGroups, dp)
@@ -184,7 +153,7 @@ func (w *Wrapper) replaceOrInsertPartition(dp *DataPartition) {
 func (w *Wrapper) getLocalLeaderDataPartition(exclude []uint32) (*DataPartition, error) {
 	rwPartitionGroups := w.localLeaderPartitions
 	if len(rwPartitionGroups) == 0 {
-		return nil, fmt.Errorf("no writable data partition")
+		return nil, NoWritablePartitionErr
 	}
 	var (
 		partition *DataPartition
@@ -212,7 +181,7 @@ func (w *Wrapper) GetWriteDataPartition(exclude []uint32) (*DataPartition, error
 	}
 	rwPartitionGroups := w.rwPartition
 	if len(rwPartitionGroups) == 0 {
-		return nil, fmt.Errorf("no writable data partition")
+		return nil, NoWritablePartitionErr
 	}
 	var (
 		partition *DataPartition
@@ -0,0 +1,169 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package sdk holds what the meta and data SDKs share, i.e. the errors
+// returned by their context-aware operations.
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Kinds of the errors of the SDK, test them with errors.Is.
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrExist                = errors.New("already exists")
+	ErrNoSpace              = errors.New("no space left")
+	ErrPartitionUnavailable = errors.New("partition unavailable")
+	ErrTimeout              = errors.New("timeout")
+	ErrPermission           = errors.New("permission denied")
+	ErrInvalid              = errors.New("invalid argument")
+)
+
+// Error is the error returned by the context-aware operations of the SDK.
+// errors.Is matches both its Kind and its Errno, i.e. sdk.ErrNotFound and
+// syscall.ENOENT, and errors.Unwrap returns the underlying error.
+type Error struct {
+	Op    string        // the operation, e.g. "Lookup"
+	Kind  error         // one of the Err* kinds, nil if unknown
+	Errno syscall.Errno // the errno reported to the FUSE client
+	Err   error         // the underlying error, may be nil
+}
+
+func (e *Error) Error() string {
+	msg := e.Op
+	if e.Kind != nil {
+		msg += ": " + e.Kind.Error()
+	} else if e.Errno != 0 {
+		msg += ": " + e.Errno.Error()
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	if target == nil {
+		return false
+	}
+	if e.Kind != nil && target == e.Kind {
+		return true
+	}
+	errno, ok := target.(syscall.Errno)
+	return ok && e.Errno != 0 && errno == e.Errno
+}
+
+// NewError returns an Error of kind, errno is the errno reported to the
+// FUSE client for it.
+func NewError(op string, kind error, errno syscall.Errno, err error) *Error {
+	return &Error{Op: op, Kind: kind, Errno: errno, Err: err}
+}
+
+// errnoKinds maps errnos to the kinds of Error.
+var errnoKinds = map[syscall.Errno]error{
+	syscall.ENOENT:    ErrNotFound,
+	syscall.EEXIST:    ErrExist,
+	syscall.ENOMEM:    ErrNoSpace,
+	syscall.ENOSPC:    ErrNoSpace,
+	syscall.EAGAIN:    ErrPartitionUnavailable,
+	syscall.EINVAL:    ErrInvalid,
+	syscall.EPERM:     ErrPermission,
+	syscall.ETIMEDOUT: ErrTimeout,
+}
+
+// NewErrnoError returns an Error of the kind errno stands for.
+func NewErrnoError(op string, errno syscall.Errno, err error) *Error {
+	return NewError(op, errnoKinds[errno], errno, err)
+}
+
+// ContextError returns the Error of an operation aborted because ctx is done,
+// or nil if ctx is not done.
+func ContextError(op string, ctx context.Context) error {
+	switch err := ctx.Err(); err {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return NewError(op, ErrTimeout, syscall.ETIMEDOUT, err)
+	default:
+		return NewError(op, nil, syscall.EINTR, err)
+	}
+}
+
+// IsTimeout reports whether err is a timeout of the network.
+func IsTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// Errno converts err to the errno reported to the FUSE client. The errors
+// other than Error and syscall.Errno are reported as EIO.
+func Errno(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) && e.Errno != 0 {
+		return e.Errno
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	return syscall.EIO
+}
+
+// WatchConn aborts the pending reads and writes of conn once ctx is done.
+// Unless ctx.Done() is nil, the deadline of conn is set to the deadline of
+// ctx or timeout from now, whichever is earlier, so callers must not set
+// deadlines of their own. The returned stop must be called when conn is not
+// used for ctx any more, it reports whether conn was aborted, in which case
+// conn must not be reused.
+func WatchConn(ctx context.Context, conn net.Conn, timeout time.Duration) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	done := make(chan struct{})
+	exited := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+			exited <- true
+		case <-done:
+			exited <- false
+		}
+	}()
+	return func() bool {
+		close(done)
+		aborted := <-exited
+		if !aborted {
+			conn.SetDeadline(time.Time{})
+		}
+		return aborted
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", NewErrnoError("Lookup", syscall.ENOENT, nil))
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, syscall.ENOENT) {
+		t.Fatalf("%v is not ErrNotFound or ENOENT", err)
+	}
+	if errors.Is(err, ErrExist) || errors.Is(err, syscall.EEXIST) {
+		t.Fatalf("%v is ErrExist", err)
+	}
+	if errno := Errno(err); errno != syscall.ENOENT {
+		t.Fatalf("Errno(%v) = %v", err, errno)
+	}
+	if errno := Errno(errors.New("unknown")); errno != syscall.EIO {
+		t.Fatalf("Errno of unknown error = %v", errno)
+	}
+	if Errno(nil) != nil {
+		t.Fatalf("Errno(nil) is not nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	err = ContextError("Read", ctx)
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("%v is not a timeout", err)
+	}
+}
+
+func TestWatchConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := WatchConn(ctx, client, time.Minute)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	buf := make([]byte, 1)
+	if _, err := client.Read(buf); !IsTimeout(err) {
+		t.Fatalf("read is not aborted: %v", err)
+	}
+	if !stop() {
+		t.Fatalf("conn is not reported as aborted")
+	}
+
+	stop = WatchConn(context.Background(), server, time.Minute)
+	if stop() {
+		t.Fatalf("conn without deadline is reported as aborted")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/data/stream"
+	"github.com/tiglabs/containerfs/util"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// File is an open file or directory of a FileSystem. Writes to regions
+// already written to extents fail with EOPNOTSUPP, see the package doc.
+type File struct {
+	fsys *FileSystem
+	name string
+	ino  uint64
+	mode uint32
+	flag int
+
+	sync.Mutex
+	offset  int64
+	reader  *stream.StreamReader
+	entries []iofs.DirEntry // remaining entries of a directory being read
+	listed  bool
+	closed  bool
+}
+
+// interfaces that File implements
+var (
+	_ io.ReaderAt        = (*File)(nil)
+	_ io.ReadWriteSeeker = (*File)(nil)
+	_ io.Closer          = (*File)(nil)
+	_ iofs.ReadDirFile   = (*File)(nil)
+	_ io.ReaderFrom      = (*File)(nil)
+)
+
+func newFile(fsys *FileSystem, name string, info *proto.InodeInfo, flag int) *File {
+	return &File{
+		fsys: fsys,
+		name: name,
+		ino:  info.Inode,
+		mode: info.Mode,
+		flag: flag,
+	}
+}
+
+// Name returns the path the file is opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Inode returns the inode number of the file.
+func (f *File) Inode() uint64 {
+	return f.ino
+}
+
+func (f *File) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+func (f *File) checkValid(op string) error {
+	if f.closed {
+		return pathError(op, f.name, os.ErrClosed)
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes from the file at offset off.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+	if err = f.checkValid("read"); err != nil {
+		return
+	}
+	if off < 0 {
+		return 0, pathError("read", f.name, syscall.EINVAL)
+	}
+	return f.readAt(p, off)
+}
+
+func (f *File) readAt(p []byte, off int64) (n int, err error) {
+	if proto.IsDir(f.mode) {
+		return 0, pathError("read", f.name, syscall.EISDIR)
+	}
+	if !f.readable() {
+		return 0, pathError("read", f.name, syscall.EBADF)
+	}
+	if f.reader == nil {
+		if f.reader, err = f.fsys.ec.OpenForRead(f.ino); err != nil {
+			log.LogErrorf("ReadAt: open for read ino(%v) err(%v)", f.ino, err)
+			return 0, pathError("read", f.name, syscall.EIO)
+		}
+	}
+	for n < len(p) {
+		size := util.Min(len(p)-n, util.ReadBlockSize)
+		read, err := f.fsys.ec.Read(f.reader, f.ino, p[n:n+size], int(off)+n, size)
+		n += read
+		if err == io.EOF || (err == nil && read < size) {
+			return n, io.EOF
+		}
+		if err != nil {
+			log.LogErrorf("ReadAt: ino(%v) offset(%v) size(%v) err(%v)", f.ino, int(off)+n, size, err)
+			return n, pathError("read", f.name, syscall.EIO)
+		}
+	}
+	return n, nil
+}
+
+func (f *File) readable() bool {
+	return f.flag&os.O_WRONLY == 0
+}
+
+// WriteAt writes len(p) bytes to the file at offset off. It is not allowed
+// if the file is opened with O_APPEND, and fails with EOPNOTSUPP if off is
+// before the end of the data written to extents.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+	if err = f.checkValid("write"); err != nil {
+		return
+	}
+	if f.flag&os.O_APPEND != 0 || off < 0 {
+		return 0, pathError("write", f.name, syscall.EINVAL)
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *File) writeAt(p []byte, off int64) (n int, err error) {
+	if !f.writable() {
+		return 0, pathError("write", f.name, syscall.EBADF)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if n, err = f.fsys.ec.WriteNoOverwrite(f.ino, int(off), p); err == syscall.EOPNOTSUPP {
+		return n, pathError("write", f.name, err)
+	}
+	if err != nil {
+		log.LogErrorf("WriteAt: ino(%v) offset(%v) len(%v) err(%v)", f.ino, off, len(p), err)
+		return n, pathError("write", f.name, syscall.EIO)
+	}
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// Read reads up to len(p) bytes at the current offset.
+func (f *File) Read(p []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+	if err = f.checkValid("read"); err != nil {
+		return
+	}
+	n, err = f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+// Write writes p at the current offset, or at the end of the file if the
+// file is opened with O_APPEND.
+func (f *File) Write(p []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+	if err = f.checkValid("write"); err != nil {
+		return
+	}
+	if f.flag&os.O_APPEND != 0 {
+		var size int64
+		if size, err = f.size(); err != nil {
+			return
+		}
+		f.offset = size
+	}
+	n, err = f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return
+}
+
+// ReadFrom copies r into the file at the current offset.
+func (f *File) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := make([]byte, util.BlockSize)
+	for {
+		read, rerr := r.Read(buf)
+		if read > 0 {
+			written, werr := f.Write(buf[:read])
+			n += int64(written)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// Seek sets the offset of the next Read or Write, like os.File.Seek.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.checkValid("seek"); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		size, err := f.size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, pathError("seek", f.name, syscall.EINVAL)
+	}
+	if offset < 0 {
+		return 0, pathError("seek", f.name, syscall.EINVAL)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Stat returns the FileInfo of the file.
+func (f *File) Stat() (os.FileInfo, error) {
+	info, err := f.fsys.mw.InodeGet_ll(f.ino)
+	if err != nil {
+		return nil, pathError("stat", f.name, err)
+	}
+	return newFileInfo(path.Base(f.name), info, f.fsys.ec.GetWriteSize(f.ino)), nil
+}
+
+func (f *File) size() (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Sync flushes the data written to the file.
+func (f *File) Sync() error {
+	if err := f.fsys.ec.Flush(f.ino); err != nil {
+		log.LogErrorf("Sync: ino(%v) err(%v)", f.ino, err)
+		return pathError("sync", f.name, syscall.EIO)
+	}
+	return nil
+}
+
+// ReadDir reads the entries of a directory sorted by name, as
+// io/fs.ReadDirFile does.
+func (f *File) ReadDir(n int) ([]iofs.DirEntry, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.checkValid("readdir"); err != nil {
+		return nil, err
+	}
+	if !proto.IsDir(f.mode) {
+		return nil, pathError("readdir", f.name, syscall.ENOTDIR)
+	}
+	if !f.listed {
+		entries, err := f.fsys.readDir(f.ino)
+		if err != nil {
+			return nil, pathError("readdir", f.name, err)
+		}
+		f.entries = entries
+		f.listed = true
+	}
+	if n <= 0 || n > len(f.entries) {
+		if n > 0 && len(f.entries) == 0 {
+			return nil, io.EOF
+		}
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+// Close flushes the data written to the file and releases it. The data of
+// an unlinked file is removed on its last close.
+func (f *File) Close() (err error) {
+	f.Lock()
+	defer f.Unlock()
+	if err = f.checkValid("close"); err != nil {
+		return
+	}
+	f.closed = true
+	defer f.fsys.unref(f.ino)
+	if !f.writable() {
+		return nil
+	}
+
+	start := time.Now()
+	if err = f.fsys.ec.Flush(f.ino); err != nil {
+		log.LogErrorf("Close: flush failed, ino(%v) err(%v)", f.ino, err)
+		f.fsys.ec.CloseForWrite(f.ino)
+		return pathError("close", f.name, syscall.EIO)
+	}
+	if err = f.fsys.ec.CloseForWrite(f.ino); err != nil {
+		log.LogErrorf("Close: close writer failed, ino(%v) err(%v)", f.ino, err)
+		return pathError("close", f.name, syscall.EIO)
+	}
+	// Files of a WORM volume are committed once they are written and closed.
+	if f.fsys.mw.Worm().Enabled() {
+		if err = f.fsys.mw.WormCommit(f.ino); err != nil {
+			log.LogErrorf("Close: worm commit failed, ino(%v) err(%v)", f.ino, err)
+			return pathError("close", f.name, err)
+		}
+	}
+	log.LogDebugf("TRACE Close: ino(%v) (%v)ns", f.ino, time.Since(start).Nanoseconds())
+	return nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/tiglabs/containerfs/sdk/fs"
+	"github.com/tiglabs/containerfs/sdk/fs/fstest"
+)
+
+// writeFile creates the named file with data.
+func writeFile(t *testing.T, fsys *fs.FileSystem, name string, data string) {
+	t.Helper()
+	f, err := fsys.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	fsys := fstest.NewFileSystem()
+	if err := fsys.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fsys, "/dir/a", "abc")
+
+	tests := []struct {
+		name string
+		flag int
+		err  error
+	}{
+		{"/dir/a", os.O_RDONLY, nil},
+		{"/dir/a", os.O_RDWR, nil},
+		{"/dir", os.O_RDONLY, nil},
+		{"/dir/b", os.O_RDONLY, syscall.ENOENT},
+		{"/dir/a/b", os.O_RDONLY, syscall.ENOTDIR},
+		{"/dir", os.O_RDWR, syscall.EISDIR},
+		{"/dir/a", os.O_RDWR | os.O_CREATE | os.O_EXCL, syscall.EEXIST},
+		{"/dir/b", os.O_RDWR | os.O_CREATE | os.O_EXCL, nil},
+	}
+	for _, tt := range tests {
+		f, err := fsys.OpenFile(tt.name, tt.flag, 0644)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Fatalf("open %v flag %#x: err %v, want %v", tt.name, tt.flag, err, tt.err)
+		}
+		if err == nil {
+			f.Close()
+		}
+	}
+
+	// O_TRUNC drops the data of the file.
+	f, err := fsys.OpenFile("/dir/a", os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fi, err := fsys.Stat("/dir/a"); err != nil || fi.Size() != 0 {
+		t.Fatalf("stat truncated file: %v %v", fi, err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	fsys := fstest.NewFileSystem()
+	writeFile(t, fsys, "/a", "hello world")
+
+	f, err := fsys.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("read all %q %v", data, err)
+	}
+	if n, err := f.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("read at the end: %v %v", n, err)
+	}
+
+	p := make([]byte, 5)
+	if n, err := f.ReadAt(p, 6); n != 5 || err != nil || string(p) != "world" {
+		t.Fatalf("read at 6: %v %v %q", n, err, p)
+	}
+	if n, err := f.ReadAt(p, 8); n != 3 || err != io.EOF || string(p[:n]) != "rld" {
+		t.Fatalf("read at 8: %v %v %q", n, err, p[:n])
+	}
+	if _, err := f.ReadAt(p, -1); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("read at -1: %v", err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, syscall.EBADF) {
+		t.Fatalf("write to a file opened for reading: %v", err)
+	}
+
+	dir, err := fsys.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	if _, err := dir.Read(p); !errors.Is(err, syscall.EISDIR) {
+		t.Fatalf("read a directory: %v", err)
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	fsys := fstest.NewFileSystem()
+	f, err := fsys.Create("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.WriteAt([]byte("abc"), 0); n != 3 || err != nil {
+		t.Fatalf("write at 0: %v %v", n, err)
+	}
+	// A hole is left before data written past the end.
+	if n, err := f.WriteAt([]byte("xyz"), 5); n != 3 || err != nil {
+		t.Fatalf("write at 5: %v %v", n, err)
+	}
+	// Data written already is not overwritten.
+	if n, err := f.WriteAt([]byte("B"), 1); n != 0 || !errors.Is(err, syscall.EOPNOTSUPP) {
+		t.Fatalf("overwrite at 1: %v %v", n, err)
+	}
+	if _, err := f.WriteAt([]byte("x"), -1); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("write at -1: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("x"), 8); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("write to a closed file: %v", err)
+	}
+
+	f, err = fsys.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil || string(data) != "abc\x00\x00xyz" {
+		t.Fatalf("read all %q %v", data, err)
+	}
+
+	appender, err := fsys.OpenFile("/a", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+	if _, err = appender.WriteAt([]byte("x"), 8); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("write at to an append only file: %v", err)
+	}
+	if n, err := appender.Write([]byte("!")); n != 1 || err != nil {
+		t.Fatalf("append: %v %v", n, err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	fsys := fstest.NewFileSystem()
+	writeFile(t, fsys, "/a", "0123456789")
+	f, err := fsys.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		offset int64
+		whence int
+		want   int64
+		err    error
+	}{
+		{3, io.SeekStart, 3, nil},
+		{2, io.SeekCurrent, 5, nil},
+		{-1, io.SeekEnd, 9, nil},
+		{5, io.SeekEnd, 15, nil},
+		{-1, io.SeekStart, 15, syscall.EINVAL},
+		{-20, io.SeekCurrent, 15, syscall.EINVAL},
+		{0, 3, 15, syscall.EINVAL},
+	}
+	for _, tt := range tests {
+		got, err := f.Seek(tt.offset, tt.whence)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Fatalf("seek %v %v: err %v, want %v", tt.offset, tt.whence, err, tt.err)
+		}
+		if err == nil && got != tt.want {
+			t.Fatalf("seek %v %v = %v, want %v", tt.offset, tt.whence, got, tt.want)
+		}
+	}
+
+	if _, err = f.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 2)
+	if n, err := f.Read(p); n != 2 || err != nil || string(p) != "78" {
+		t.Fatalf("read after seek: %v %v %q", n, err, p)
+	}
+	if off, err := f.Seek(0, io.SeekCurrent); off != 9 || err != nil {
+		t.Fatalf("offset after read: %v %v", off, err)
+	}
+}
+
+func TestFileReadDir(t *testing.T) {
+	fsys := fstest.NewFileSystem()
+	for _, name := range []string{"/c", "/a", "/b"} {
+		writeFile(t, fsys, name, name)
+	}
+	if err := fsys.Mkdir("/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := fsys.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	var names []string
+	for {
+		entries, err := dir.ReadDir(3)
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			t.Fatal("no entries and no EOF")
+		}
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("read dir %v, want %v", names, want)
+	}
+	if entries, err := dir.ReadDir(-1); len(entries) != 0 || err != nil {
+		t.Fatalf("read dir at the end: %v %v", entries, err)
+	}
+
+	all, err := fsys.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+	entries, err := all.ReadDir(0)
+	if err != nil || len(entries) != 4 || !entries[3].IsDir() {
+		t.Fatalf("read all entries: %v %v", entries, err)
+	}
+	if fi, err := entries[0].Info(); err != nil || fi.Size() != 2 {
+		t.Fatalf("info of %v: %v %v", entries[0].Name(), fi, err)
+	}
+
+	f, err := fsys.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.ReadDir(-1); !errors.Is(err, syscall.ENOTDIR) {
+		t.Fatalf("read dir of a file: %v", err)
+	}
+}
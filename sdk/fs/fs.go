@@ -0,0 +1,509 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fs accesses a volume by path without FUSE. It walks paths on top
+// of sdk/meta, reads and writes file data through sdk/data/stream, and
+// reports errors as *io/fs.PathError wrapping a syscall.Errno, so that
+// errors.Is(err, io/fs.ErrNotExist) and os.IsNotExist work as usual.
+//
+// Data written to extents is only appended to, so files can only be
+// appended to or written in regions not written yet. A write to a region
+// already written to extents fails with EOPNOTSUPP. For that reason File
+// is not an io.WriterAt, whose callers expect to overwrite data.
+package fs
+
+import (
+	iofs "io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/data/stream"
+	"github.com/tiglabs/containerfs/sdk/meta"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+const (
+	RootInode = proto.RootIno
+
+	// MaxSymlinks limits the symbolic links followed while walking a path.
+	MaxSymlinks = 40
+)
+
+// MetaClient is the part of meta.MetaWrapper used by FileSystem.
+type MetaClient interface {
+	Create_ll(parentID uint64, name string, mode uint32, target []byte) (*proto.InodeInfo, error)
+	Delete_ll(parentID uint64, name string) (*proto.InodeInfo, error)
+	Evict(inode uint64) error
+	InodeGet_ll(inode uint64) (*proto.InodeInfo, error)
+	Lookup_ll(parentID uint64, name string) (inode uint64, mode uint32, err error)
+	Open_ll(inode uint64) error
+	ReadDir_ll(parentID uint64) ([]proto.Dentry, error)
+	Rename_ll(srcParentID uint64, srcName string, dstParentID uint64, dstName string) error
+	Truncate(inode uint64) error
+	Worm() proto.WormPolicy
+	WormCommit(inode uint64) error
+}
+
+// DataClient is the part of stream.ExtentClient used by FileSystem.
+type DataClient interface {
+	OpenForRead(inode uint64) (*stream.StreamReader, error)
+	Read(reader *stream.StreamReader, inode uint64, data []byte, offset int, size int) (int, error)
+	OpenForWrite(inode, start uint64)
+	WriteNoOverwrite(inode uint64, offset int, data []byte) (int, error)
+	GetWriteSize(inode uint64) uint64
+	SetWriteSize(inode, size uint64)
+	Flush(inode uint64) error
+	CloseForWrite(inode uint64) error
+}
+
+// FileSystem is a volume accessed by path.
+type FileSystem struct {
+	mw MetaClient
+	ec DataClient
+
+	sync.Mutex
+	// open inodes and their reference counts
+	opens map[uint64]*openInode
+}
+
+type openInode struct {
+	refs   int
+	orphan bool // unlinked while open, evict on the last close
+}
+
+// NewFileSystem connects to the volume volname of the cluster managed by
+// master, which is a comma separated list of master addresses.
+func NewFileSystem(volname, master string) (*FileSystem, error) {
+	mw, err := meta.NewMetaWrapper(volname, master)
+	if err != nil {
+		log.LogErrorf("NewMetaWrapper failed! %v", err.Error())
+		return nil, err
+	}
+	ec, err := stream.NewExtentClient(volname, master, mw.AppendExtentKey, mw.GetExtents)
+	if err != nil {
+		log.LogErrorf("NewExtentClient failed! %v", err.Error())
+		return nil, err
+	}
+	ec.SetInline(int(mw.InlineSize()), mw.GetInline, mw.WriteInline)
+	return NewFileSystemWithClients(mw, ec), nil
+}
+
+// NewFileSystemWithClients builds a FileSystem on existing clients of the
+// volume, so services can share them with their own low-level calls.
+func NewFileSystemWithClients(mw MetaClient, ec DataClient) *FileSystem {
+	return &FileSystem{
+		mw:    mw,
+		ec:    ec,
+		opens: make(map[uint64]*openInode),
+	}
+}
+
+// MetaWrapper returns the metadata client of the volume, nil if the
+// FileSystem is built on another MetaClient.
+func (fsys *FileSystem) MetaWrapper() *meta.MetaWrapper {
+	mw, _ := fsys.mw.(*meta.MetaWrapper)
+	return mw
+}
+
+// ExtentClient returns the data client of the volume, nil if the
+// FileSystem is built on another DataClient.
+func (fsys *FileSystem) ExtentClient() *stream.ExtentClient {
+	ec, _ := fsys.ec.(*stream.ExtentClient)
+	return ec
+}
+
+// Create creates or truncates the named file, like os.Create.
+func (fsys *FileSystem) Create(name string) (*File, error) {
+	return fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens the named file or directory for reading.
+func (fsys *FileSystem) Open(name string) (*File, error) {
+	return fsys.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with the flags of os.OpenFile. O_CREATE,
+// O_EXCL, O_TRUNC and O_APPEND are supported.
+func (fsys *FileSystem) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, true)
+	if err == syscall.ENOENT && flag&os.O_CREATE != 0 {
+		info, err = fsys.create(name, proto.Mode(perm.Perm()))
+		if err == syscall.EEXIST && flag&os.O_EXCL == 0 {
+			// created by someone else in the meantime
+			info, err = fsys.resolve(name, true)
+		}
+	} else if err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		err = syscall.EEXIST
+	}
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if proto.IsDir(info.Mode) && writable {
+		return nil, pathError("open", name, syscall.EISDIR)
+	}
+	if err = fsys.mw.Open_ll(info.Inode); err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if writable && flag&os.O_TRUNC != 0 && info.Size != 0 {
+		if err = fsys.mw.Truncate(info.Inode); err != nil {
+			return nil, pathError("truncate", name, err)
+		}
+		info.Size = 0
+	}
+
+	f := newFile(fsys, name, info, flag)
+	fsys.ref(info.Inode)
+	if writable {
+		fsys.ec.OpenForWrite(info.Inode, info.Size-info.Unwritten)
+		if flag&os.O_TRUNC != 0 {
+			fsys.ec.SetWriteSize(info.Inode, 0)
+		}
+	}
+	log.LogDebugf("TRACE OpenFile: name(%v) ino(%v) flag(%#x)", name, info.Inode, flag)
+	return f, nil
+}
+
+// Stat returns the FileInfo of the named file, following symbolic links.
+func (fsys *FileSystem) Stat(name string) (os.FileInfo, error) {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, true)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return newFileInfo(path.Base(name), info, fsys.ec.GetWriteSize(info.Inode)), nil
+}
+
+// Lstat returns the FileInfo of the named file, a symbolic link is not
+// followed.
+func (fsys *FileSystem) Lstat(name string) (os.FileInfo, error) {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, false)
+	if err != nil {
+		return nil, pathError("lstat", name, err)
+	}
+	return newFileInfo(path.Base(name), info, fsys.ec.GetWriteSize(info.Inode)), nil
+}
+
+// Mkdir creates the named directory.
+func (fsys *FileSystem) Mkdir(name string, perm os.FileMode) error {
+	name = cleanPath(name)
+	if _, err := fsys.create(name, proto.Mode(os.ModeDir|perm.Perm())); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// MkdirAll creates the named directory along with the missing parents.
+func (fsys *FileSystem) MkdirAll(name string, perm os.FileMode) error {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, true)
+	if err == nil {
+		if !proto.IsDir(info.Mode) {
+			return pathError("mkdir", name, syscall.ENOTDIR)
+		}
+		return nil
+	}
+	if parent := path.Dir(name); parent != name {
+		if err = fsys.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err = fsys.Mkdir(name, perm); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (fsys *FileSystem) Symlink(oldname, newname string) error {
+	newname = cleanPath(newname)
+	parent, base := path.Split(newname)
+	dir, err := fsys.resolve(parent, true)
+	if err == nil {
+		_, err = fsys.mw.Create_ll(dir.Inode, base, proto.Mode(os.ModeSymlink|os.ModePerm), []byte(oldname))
+	}
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link.
+func (fsys *FileSystem) Readlink(name string) (string, error) {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, false)
+	if err == nil && !proto.IsSymlink(info.Mode) {
+		err = syscall.EINVAL
+	}
+	if err != nil {
+		return "", pathError("readlink", name, err)
+	}
+	return string(info.Target), nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *FileSystem) ReadDir(name string) ([]iofs.DirEntry, error) {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, true)
+	if err == nil && !proto.IsDir(info.Mode) {
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries, err := fsys.readDir(info.Inode)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+func (fsys *FileSystem) readDir(ino uint64) ([]iofs.DirEntry, error) {
+	children, err := fsys.mw.ReadDir_ll(ino)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]iofs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, &dirEntry{fsys: fsys, dentry: child})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Remove removes the named file or empty directory. The data of a file
+// which is still open is kept until it is closed.
+func (fsys *FileSystem) Remove(name string) error {
+	name = cleanPath(name)
+	if name == "/" {
+		return pathError("remove", name, syscall.EBUSY)
+	}
+	parent, base := path.Split(name)
+	dir, err := fsys.resolve(parent, true)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	ino, mode, err := fsys.mw.Lookup_ll(dir.Inode, base)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if proto.IsDir(mode) {
+		children, err := fsys.mw.ReadDir_ll(ino)
+		if err != nil {
+			return pathError("remove", name, err)
+		}
+		if len(children) != 0 {
+			return pathError("remove", name, syscall.ENOTEMPTY)
+		}
+	}
+	info, err := fsys.mw.Delete_ll(dir.Inode, base)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if info != nil && proto.IsRegular(info.Mode) && info.Nlink == 0 {
+		fsys.orphan(info.Inode)
+	}
+	log.LogDebugf("TRACE Remove: name(%v) ino(%v)", name, ino)
+	return nil
+}
+
+// RemoveAll removes name and any children it contains.
+func (fsys *FileSystem) RemoveAll(name string) error {
+	name = cleanPath(name)
+	info, err := fsys.resolve(name, false)
+	if err == syscall.ENOENT {
+		return nil
+	}
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if proto.IsDir(info.Mode) {
+		entries, err := fsys.readDir(info.Inode)
+		if err != nil {
+			return pathError("remove", name, err)
+		}
+		for _, entry := range entries {
+			if err = fsys.RemoveAll(path.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return fsys.Remove(name)
+}
+
+// Rename renames oldname to newname, replacing newname if it exists.
+func (fsys *FileSystem) Rename(oldname, newname string) error {
+	oldname, newname = cleanPath(oldname), cleanPath(newname)
+	oldParent, oldBase := path.Split(oldname)
+	newParent, newBase := path.Split(newname)
+	src, err := fsys.resolve(oldParent, true)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	dst, err := fsys.resolve(newParent, true)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if err = fsys.mw.Rename_ll(src.Inode, oldBase, dst.Inode, newBase); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Walk walks the file tree rooted at root in lexical order, calling fn for
+// each file or directory as io/fs.WalkDir does. The paths passed to fn are
+// absolute paths of the volume.
+func (fsys *FileSystem) Walk(root string, fn iofs.WalkDirFunc) error {
+	root = cleanPath(root)
+	return iofs.WalkDir(fsys.IOFS(), ioName(root), func(name string, d iofs.DirEntry, err error) error {
+		if pe, ok := err.(*iofs.PathError); ok {
+			pe.Path = cleanPath(pe.Path)
+		}
+		return fn(cleanPath(name), d, err)
+	})
+}
+
+func (fsys *FileSystem) create(name string, mode uint32) (*proto.InodeInfo, error) {
+	if name == "/" {
+		return nil, syscall.EEXIST
+	}
+	parent, base := path.Split(name)
+	dir, err := fsys.resolve(parent, true)
+	if err != nil {
+		return nil, err
+	}
+	if !proto.IsDir(dir.Mode) {
+		return nil, syscall.ENOTDIR
+	}
+	return fsys.mw.Create_ll(dir.Inode, base, mode, nil)
+}
+
+// resolve walks the clean absolute path name from the root inode. The last
+// component is followed if it is a symbolic link and follow is set.
+func (fsys *FileSystem) resolve(name string, follow bool) (*proto.InodeInfo, error) {
+	for links := 0; ; links++ {
+		info, next, err := fsys.walk(name, follow)
+		if err != nil || next == "" {
+			return info, err
+		}
+		if links >= MaxSymlinks {
+			return nil, syscall.ELOOP
+		}
+		name = next
+	}
+}
+
+// walk returns the inode of name. If a symbolic link to follow is met, the
+// path with the link replaced by its destination is returned in next
+// instead. Directories do not record their parents, so ".." in the
+// destination is resolved lexically.
+func (fsys *FileSystem) walk(name string, follow bool) (info *proto.InodeInfo, next string, err error) {
+	if info, err = fsys.mw.InodeGet_ll(RootInode); err != nil {
+		return
+	}
+	components := strings.Split(strings.Trim(name, "/"), "/")
+	for i, component := range components {
+		if component == "" {
+			continue
+		}
+		if !proto.IsDir(info.Mode) {
+			return nil, "", syscall.ENOTDIR
+		}
+		var ino uint64
+		if ino, _, err = fsys.mw.Lookup_ll(info.Inode, component); err != nil {
+			return nil, "", err
+		}
+		if info, err = fsys.mw.InodeGet_ll(ino); err != nil {
+			return nil, "", err
+		}
+		last := i == len(components)-1
+		if proto.IsSymlink(info.Mode) && (!last || follow) {
+			target := string(info.Target)
+			if !path.IsAbs(target) {
+				target = path.Join("/", path.Join(components[:i]...), target)
+			}
+			return nil, cleanPath(path.Join(target, path.Join(components[i+1:]...))), nil
+		}
+	}
+	return
+}
+
+func (fsys *FileSystem) ref(ino uint64) {
+	fsys.Lock()
+	defer fsys.Unlock()
+	if oi, ok := fsys.opens[ino]; ok {
+		oi.refs++
+		return
+	}
+	fsys.opens[ino] = &openInode{refs: 1}
+}
+
+// unref drops a reference of the inode, and evicts the inode if it has been
+// unlinked and this is the last reference.
+func (fsys *FileSystem) unref(ino uint64) {
+	fsys.Lock()
+	oi, ok := fsys.opens[ino]
+	if !ok {
+		fsys.Unlock()
+		return
+	}
+	if oi.refs--; oi.refs > 0 {
+		fsys.Unlock()
+		return
+	}
+	delete(fsys.opens, ino)
+	fsys.Unlock()
+	if oi.orphan {
+		fsys.evict(ino)
+	}
+}
+
+// orphan evicts an unlinked inode, or defers it to the last close if the
+// inode is still open.
+func (fsys *FileSystem) orphan(ino uint64) {
+	fsys.Lock()
+	if oi, ok := fsys.opens[ino]; ok {
+		oi.orphan = true
+		fsys.Unlock()
+		return
+	}
+	fsys.Unlock()
+	fsys.evict(ino)
+}
+
+func (fsys *FileSystem) evict(ino uint64) {
+	if err := fsys.mw.Evict(ino); err != nil {
+		log.LogErrorf("Evict: ino(%v) err(%v)", ino, err)
+	}
+}
+
+// cleanPath returns the clean absolute form of name, a relative name is
+// taken relative to the root of the volume.
+func cleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func pathError(op, name string, err error) error {
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
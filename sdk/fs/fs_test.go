@@ -0,0 +1,41 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"testing"
+)
+
+func TestPathNames(t *testing.T) {
+	cases := []struct {
+		name, clean, io string
+	}{
+		{"", "/", "."},
+		{".", "/", "."},
+		{"/", "/", "."},
+		{"a/b", "/a/b", "a/b"},
+		{"/a//b/../c/", "/a/c", "a/c"},
+		{"../../a", "/a", "a"},
+	}
+	for _, c := range cases {
+		clean := cleanPath(c.name)
+		if clean != c.clean {
+			t.Fatalf("cleanPath(%q) = %q, want %q", c.name, clean, c.clean)
+		}
+		if name := ioName(clean); name != c.io {
+			t.Fatalf("ioName(%q) = %q, want %q", clean, name, c.io)
+		}
+	}
+}
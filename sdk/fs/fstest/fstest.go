@@ -0,0 +1,272 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fstest implements the clients of a volume in memory, so that code
+// built on sdk/fs is tested without a cluster.
+package fstest
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/data/stream"
+	"github.com/tiglabs/containerfs/sdk/fs"
+)
+
+// interfaces that the clients implement
+var (
+	_ fs.MetaClient = (*Meta)(nil)
+	_ fs.DataClient = (*Data)(nil)
+)
+
+// NewFileSystem returns a FileSystem of an empty volume kept in memory.
+func NewFileSystem() *fs.FileSystem {
+	meta := NewMeta()
+	return fs.NewFileSystemWithClients(meta, NewData(meta))
+}
+
+// Meta is a fs.MetaClient which keeps the inodes and dentries of a volume
+// in memory, like the metaNodes do.
+type Meta struct {
+	sync.Mutex
+	inodes   map[uint64]*proto.InodeInfo
+	dentries map[uint64]map[string]uint64
+	next     uint64
+}
+
+// NewMeta returns the Meta of a volume which has only the root directory.
+func NewMeta() *Meta {
+	m := &Meta{
+		inodes:   make(map[uint64]*proto.InodeInfo),
+		dentries: make(map[uint64]map[string]uint64),
+		next:     fs.RootInode,
+	}
+	m.newInode(proto.Mode(os.ModeDir|os.ModePerm), nil)
+	return m
+}
+
+func (m *Meta) newInode(mode uint32, target []byte) *proto.InodeInfo {
+	info := &proto.InodeInfo{Inode: m.next, Mode: mode, Nlink: 1, Target: target}
+	if proto.IsDir(mode) {
+		info.Nlink = 2
+		m.dentries[info.Inode] = make(map[string]uint64)
+	}
+	m.inodes[info.Inode] = info
+	m.next++
+	return info
+}
+
+func (m *Meta) get(inode uint64) (*proto.InodeInfo, error) {
+	info, ok := m.inodes[inode]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	clone := *info
+	return &clone, nil
+}
+
+func (m *Meta) Create_ll(parentID uint64, name string, mode uint32, target []byte) (*proto.InodeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	children, ok := m.dentries[parentID]
+	if !ok {
+		return nil, syscall.ENOTDIR
+	}
+	if _, ok = children[name]; ok {
+		return nil, syscall.EEXIST
+	}
+	info := m.newInode(mode, target)
+	children[name] = info.Inode
+	return m.get(info.Inode)
+}
+
+func (m *Meta) Delete_ll(parentID uint64, name string) (*proto.InodeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	ino, ok := m.dentries[parentID][name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	delete(m.dentries[parentID], name)
+	m.inodes[ino].Nlink--
+	return m.get(ino)
+}
+
+func (m *Meta) Evict(inode uint64) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.inodes, inode)
+	return nil
+}
+
+func (m *Meta) InodeGet_ll(inode uint64) (*proto.InodeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.get(inode)
+}
+
+func (m *Meta) Lookup_ll(parentID uint64, name string) (inode uint64, mode uint32, err error) {
+	m.Lock()
+	defer m.Unlock()
+	ino, ok := m.dentries[parentID][name]
+	if !ok {
+		return 0, 0, syscall.ENOENT
+	}
+	return ino, m.inodes[ino].Mode, nil
+}
+
+func (m *Meta) Open_ll(inode uint64) error {
+	_, err := m.InodeGet_ll(inode)
+	return err
+}
+
+func (m *Meta) ReadDir_ll(parentID uint64) ([]proto.Dentry, error) {
+	m.Lock()
+	defer m.Unlock()
+	var dentries []proto.Dentry
+	for name, ino := range m.dentries[parentID] {
+		dentries = append(dentries, proto.Dentry{Name: name, Inode: ino, Type: m.inodes[ino].Mode})
+	}
+	return dentries, nil
+}
+
+func (m *Meta) Rename_ll(srcParentID uint64, srcName string, dstParentID uint64, dstName string) error {
+	m.Lock()
+	defer m.Unlock()
+	ino, ok := m.dentries[srcParentID][srcName]
+	if !ok {
+		return syscall.ENOENT
+	}
+	if _, ok = m.dentries[dstParentID]; !ok {
+		return syscall.ENOTDIR
+	}
+	delete(m.dentries[srcParentID], srcName)
+	m.dentries[dstParentID][dstName] = ino
+	return nil
+}
+
+func (m *Meta) Truncate(inode uint64) error {
+	m.Lock()
+	defer m.Unlock()
+	info, ok := m.inodes[inode]
+	if !ok {
+		return syscall.ENOENT
+	}
+	info.Size = 0
+	return nil
+}
+
+func (m *Meta) Worm() proto.WormPolicy {
+	return proto.WormPolicy{}
+}
+
+func (m *Meta) WormCommit(inode uint64) error {
+	return nil
+}
+
+func (m *Meta) setSize(inode, size uint64) {
+	m.Lock()
+	defer m.Unlock()
+	if info, ok := m.inodes[inode]; ok {
+		info.Size = size
+	}
+}
+
+// Data is a fs.DataClient which keeps the data of files in memory. Like
+// extents, the data is appended and never overwritten. The size of a file
+// is recorded in its inode of meta once the file is closed.
+type Data struct {
+	sync.Mutex
+	meta    *Meta
+	bodies  map[uint64][]byte
+	writers map[uint64]bool
+}
+
+// NewData returns the Data of the files of meta.
+func NewData(meta *Meta) *Data {
+	return &Data{
+		meta:    meta,
+		bodies:  make(map[uint64][]byte),
+		writers: make(map[uint64]bool),
+	}
+}
+
+func (d *Data) OpenForRead(inode uint64) (*stream.StreamReader, error) {
+	return new(stream.StreamReader), nil
+}
+
+func (d *Data) Read(reader *stream.StreamReader, inode uint64, data []byte, offset int, size int) (int, error) {
+	d.Lock()
+	defer d.Unlock()
+	body := d.bodies[inode]
+	if offset >= len(body) {
+		return 0, io.EOF
+	}
+	n := copy(data[:size], body[offset:])
+	if n < size {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *Data) OpenForWrite(inode, start uint64) {
+	d.Lock()
+	defer d.Unlock()
+	d.writers[inode] = true
+}
+
+func (d *Data) WriteNoOverwrite(inode uint64, offset int, data []byte) (int, error) {
+	d.Lock()
+	defer d.Unlock()
+	body := d.bodies[inode]
+	if offset < len(body) {
+		return 0, syscall.EOPNOTSUPP
+	}
+	body = append(body, make([]byte, offset-len(body))...)
+	d.bodies[inode] = append(body, data...)
+	return len(data), nil
+}
+
+func (d *Data) GetWriteSize(inode uint64) uint64 {
+	d.Lock()
+	defer d.Unlock()
+	if !d.writers[inode] {
+		return 0
+	}
+	return uint64(len(d.bodies[inode]))
+}
+
+func (d *Data) SetWriteSize(inode, size uint64) {
+	d.Lock()
+	defer d.Unlock()
+	if body := d.bodies[inode]; uint64(len(body)) > size {
+		d.bodies[inode] = body[:size]
+	}
+}
+
+func (d *Data) Flush(inode uint64) error {
+	return nil
+}
+
+func (d *Data) CloseForWrite(inode uint64) error {
+	d.Lock()
+	size := uint64(len(d.bodies[inode]))
+	delete(d.writers, inode)
+	d.Unlock()
+	d.meta.setSize(inode, size)
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	iofs "io/fs"
+	"os"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// fileInfo implements os.FileInfo, Sys returns the *proto.InodeInfo.
+type fileInfo struct {
+	name string
+	size int64
+	info *proto.InodeInfo
+}
+
+// newFileInfo returns the FileInfo of the inode. The size includes the data
+// written by open files which is not flushed to the metaNode yet.
+func newFileInfo(name string, info *proto.InodeInfo, writeSize uint64) *fileInfo {
+	size := info.Size
+	if writeSize > size {
+		size = writeSize
+	}
+	return &fileInfo{
+		name: name,
+		size: int64(size),
+		info: info,
+	}
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	return proto.OsMode(fi.info.Mode)
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.info.ModifyTime
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return proto.IsDir(fi.info.Mode)
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return fi.info
+}
+
+// dirEntry implements io/fs.DirEntry, the inode is read by Info on demand.
+type dirEntry struct {
+	fsys   *FileSystem
+	dentry proto.Dentry
+}
+
+func (d *dirEntry) Name() string {
+	return d.dentry.Name
+}
+
+func (d *dirEntry) IsDir() bool {
+	return proto.IsDir(d.dentry.Type)
+}
+
+func (d *dirEntry) Type() os.FileMode {
+	return proto.OsMode(d.dentry.Type).Type()
+}
+
+func (d *dirEntry) Info() (os.FileInfo, error) {
+	info, err := d.fsys.mw.InodeGet_ll(d.dentry.Inode)
+	if err != nil {
+		return nil, pathError("stat", d.dentry.Name, err)
+	}
+	return newFileInfo(d.dentry.Name, info, d.fsys.ec.GetWriteSize(info.Inode)), nil
+}
+
+func (d *dirEntry) String() string {
+	return iofs.FormatDirEntry(d)
+}
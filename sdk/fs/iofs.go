@@ -0,0 +1,111 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"io"
+	iofs "io/fs"
+	"strings"
+)
+
+// ioFS adapts a FileSystem to io/fs. Names are unrooted slash separated
+// paths as io/fs.ValidPath requires, "." is the root of the volume.
+type ioFS struct {
+	fsys *FileSystem
+}
+
+// interfaces that ioFS implements
+var (
+	_ iofs.FS         = ioFS{}
+	_ iofs.StatFS     = ioFS{}
+	_ iofs.ReadDirFS  = ioFS{}
+	_ iofs.ReadFileFS = ioFS{}
+)
+
+// IOFS returns the volume as an io/fs.FS, which also implements
+// io/fs.StatFS, io/fs.ReadDirFS and io/fs.ReadFileFS.
+func (fsys *FileSystem) IOFS() iofs.FS {
+	return ioFS{fsys: fsys}
+}
+
+func (s ioFS) Open(name string) (iofs.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, pathError("open", name, iofs.ErrInvalid)
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, ioPathError(err, name)
+	}
+	return f, nil
+}
+
+func (s ioFS) Stat(name string) (iofs.FileInfo, error) {
+	if !iofs.ValidPath(name) {
+		return nil, pathError("stat", name, iofs.ErrInvalid)
+	}
+	fi, err := s.fsys.Stat(name)
+	if err != nil {
+		return nil, ioPathError(err, name)
+	}
+	return fi, nil
+}
+
+func (s ioFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	if !iofs.ValidPath(name) {
+		return nil, pathError("readdir", name, iofs.ErrInvalid)
+	}
+	entries, err := s.fsys.ReadDir(name)
+	if err != nil {
+		return nil, ioPathError(err, name)
+	}
+	return entries, nil
+}
+
+func (s ioFS) ReadFile(name string) ([]byte, error) {
+	if !iofs.ValidPath(name) {
+		return nil, pathError("read", name, iofs.ErrInvalid)
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, ioPathError(err, name)
+	}
+	defer f.Close()
+	size, err := f.size()
+	if err != nil {
+		return nil, ioPathError(err, name)
+	}
+	data := make([]byte, size)
+	n, err := f.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, ioPathError(err, name)
+	}
+	return data[:n], nil
+}
+
+// ioName converts a clean absolute path of the volume to an io/fs name.
+func ioName(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// ioPathError reports err with the io/fs name the caller used.
+func ioPathError(err error, name string) error {
+	if pe, ok := err.(*iofs.PathError); ok {
+		pe.Path = name
+	}
+	return err
+}
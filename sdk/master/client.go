@@ -0,0 +1,312 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util"
+)
+
+// MasterClient is the typed client of the master APIs. Requests go to
+// the leader, a follower answers with the leader address and the request
+// is sent again there.
+type MasterClient struct {
+	helper util.MasterHelper
+}
+
+func NewMasterClient(masters []string) *MasterClient {
+	mc := &MasterClient{helper: util.NewMasterHelper()}
+	for _, addr := range masters {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			mc.helper.AddNode(addr)
+		}
+	}
+	return mc
+}
+
+// AddNode adds a master, the latest one added is tried first.
+func (mc *MasterClient) AddNode(addr string) {
+	mc.helper.AddNode(addr)
+}
+
+func (mc *MasterClient) Nodes() []string {
+	return mc.helper.Nodes()
+}
+
+func (mc *MasterClient) Leader() string {
+	return mc.helper.Leader()
+}
+
+func (mc *MasterClient) request(method, path string, params map[string]string, body []byte) (data []byte, err error) {
+	if data, err = mc.helper.Request(method, path, params, body); err != nil {
+		err = decodeError(err)
+	}
+	return
+}
+
+// get sends a query, the JSON answer is decoded into resp.
+func (mc *MasterClient) get(path string, params map[string]string, resp interface{}) (err error) {
+	var data []byte
+	if data, err = mc.request(http.MethodGet, path, params, nil); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return errors.Annotatef(err, "decode response of %v", path)
+	}
+	return
+}
+
+// post sends a mutation, the text answer of the master is dropped.
+func (mc *MasterClient) post(path string, params map[string]string) (err error) {
+	_, err = mc.request(http.MethodPost, path, params, nil)
+	return
+}
+
+// Admin APIs
+
+func (mc *MasterClient) GetCluster() (cv *ClusterView, err error) {
+	cv = new(ClusterView)
+	if err = mc.get(adminGetCluster, nil, cv); err != nil {
+		cv = nil
+	}
+	return
+}
+
+// GetClusterInfo returns the cluster name and the IP address the master
+// sees the caller on.
+func (mc *MasterClient) GetClusterInfo() (info *proto.ClusterInfo, err error) {
+	info = new(proto.ClusterInfo)
+	if err = mc.get(adminGetIp, nil, info); err != nil {
+		info = nil
+	}
+	return
+}
+
+func (mc *MasterClient) GetDataPartition(req *GetDataPartitionRequest) (dp *DataPartitionInfo, err error) {
+	dp = new(DataPartitionInfo)
+	if err = mc.get(adminGetDataPartition, req.params(), dp); err != nil {
+		dp = nil
+	}
+	return
+}
+
+func (mc *MasterClient) LoadDataPartition(req *PartitionRequest) error {
+	return mc.post(adminLoadDataPartition, req.params())
+}
+
+func (mc *MasterClient) CreateDataPartition(req *CreateDataPartitionRequest) error {
+	return mc.post(adminCreateDataPartition, req.params())
+}
+
+func (mc *MasterClient) DataPartitionOffline(req *PartitionOfflineRequest) error {
+	return mc.post(adminDataPartitionOffline, req.params())
+}
+
+func (mc *MasterClient) CreateVol(req *CreateVolRequest) error {
+	return mc.post(adminCreateVol, req.params())
+}
+
+func (mc *MasterClient) DeleteVol(req *VolRequest) error {
+	return mc.post(adminDeleteVol, req.params())
+}
+
+// GetTopDirs returns the largest directories of a volume by the bytes of
+// their trees, the largest first.
+func (mc *MasterClient) GetTopDirs(req *TopDirsRequest) (dirs []proto.InodeUsage, err error) {
+	if err = mc.get(adminVolTopDirs, req.params(), &dirs); err != nil {
+		dirs = nil
+	}
+	return
+}
+
+func (mc *MasterClient) CreateMetaPartition(req *CreateMetaPartitionRequest) error {
+	return mc.post(adminCreateMP, req.params())
+}
+
+func (mc *MasterClient) SetCompactStatus(req *SetCompactStatusRequest) error {
+	return mc.post(adminSetCompactStatus, req.params())
+}
+
+func (mc *MasterClient) GetCompactStatus() (status bool, err error) {
+	var data []byte
+	if data, err = mc.request(http.MethodGet, adminGetCompactStatus, nil, nil); err != nil {
+		return
+	}
+	if status, err = strconv.ParseBool(strings.TrimSpace(string(data))); err != nil {
+		err = errors.Annotatef(err, "decode response of %v", adminGetCompactStatus)
+	}
+	return
+}
+
+func (mc *MasterClient) SetMetaNodeThreshold(req *SetMetaNodeThresholdRequest) error {
+	return mc.post(adminSetMetaNodeThreshold, req.params())
+}
+
+func (mc *MasterClient) CreateAccessKey(req *CreateAccessKeyRequest) (info *proto.AccessKeyInfo, err error) {
+	var data []byte
+	if data, err = mc.request(http.MethodPost, adminCreateAccessKey, req.params(), nil); err != nil {
+		return
+	}
+	info = new(proto.AccessKeyInfo)
+	if err = json.Unmarshal(data, info); err != nil {
+		info = nil
+		err = errors.Annotatef(err, "decode response of %v", adminCreateAccessKey)
+	}
+	return
+}
+
+func (mc *MasterClient) DeleteAccessKey(req *AccessKeyRequest) error {
+	return mc.post(adminDeleteAccessKey, req.params())
+}
+
+func (mc *MasterClient) GetAccessKey(req *AccessKeyRequest) (info *proto.AccessKeyInfo, err error) {
+	info = new(proto.AccessKeyInfo)
+	if err = mc.get(adminGetAccessKey, req.params(), info); err != nil {
+		info = nil
+	}
+	return
+}
+
+// Client APIs
+
+func (mc *MasterClient) GetDataPartitions(req *VolRequest) (view *DataPartitionsView, err error) {
+	view = new(DataPartitionsView)
+	if err = mc.get(clientDataPartitions, req.params(), view); err != nil {
+		view = nil
+	}
+	return
+}
+
+func (mc *MasterClient) GetVol(req *VolRequest) (view *VolView, err error) {
+	view = new(VolView)
+	if err = mc.get(clientVol, req.params(), view); err != nil {
+		view = nil
+	}
+	return
+}
+
+func (mc *MasterClient) GetMetaPartition(req *PartitionRequest) (mp *MetaPartitionInfo, err error) {
+	mp = new(MetaPartitionInfo)
+	if err = mc.get(clientMetaPartition, req.params(), mp); err != nil {
+		mp = nil
+	}
+	return
+}
+
+func (mc *MasterClient) GetVolStat(req *VolRequest) (stat *VolStatInfo, err error) {
+	stat = new(VolStatInfo)
+	if err = mc.get(clientVolStat, req.params(), stat); err != nil {
+		stat = nil
+	}
+	return
+}
+
+// Raft node APIs
+
+func (mc *MasterClient) AddRaftNode(req *RaftNodeRequest) error {
+	return mc.post(raftNodeAdd, req.params())
+}
+
+func (mc *MasterClient) RemoveRaftNode(req *RaftNodeRequest) error {
+	return mc.post(raftNodeRemove, req.params())
+}
+
+// Node APIs
+
+func (mc *MasterClient) AddDataNode(req *NodeRequest) error {
+	return mc.post(addDataNode, req.params())
+}
+
+func (mc *MasterClient) DataNodeOffline(req *NodeRequest) error {
+	return mc.post(dataNodeOffline, req.params())
+}
+
+func (mc *MasterClient) GetDataNode(req *NodeRequest) (node *DataNodeInfo, err error) {
+	node = new(DataNodeInfo)
+	if err = mc.get(getDataNode, req.params(), node); err != nil {
+		node = nil
+	}
+	return
+}
+
+// AddMetaNode registers a meta node and returns the ID the master gave
+// to it.
+func (mc *MasterClient) AddMetaNode(req *NodeRequest) (id uint64, err error) {
+	var data []byte
+	if data, err = mc.request(http.MethodPost, addMetaNode, req.params(), nil); err != nil {
+		return
+	}
+	if id, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		err = errors.Annotatef(err, "decode response of %v", addMetaNode)
+	}
+	return
+}
+
+func (mc *MasterClient) MetaNodeOffline(req *NodeRequest) error {
+	return mc.post(metaNodeOffline, req.params())
+}
+
+func (mc *MasterClient) GetMetaNode(req *NodeRequest) (node *MetaNodeInfo, err error) {
+	node = new(MetaNodeInfo)
+	if err = mc.get(getMetaNode, req.params(), node); err != nil {
+		node = nil
+	}
+	return
+}
+
+func (mc *MasterClient) LoadMetaPartition(req *PartitionRequest) error {
+	return mc.post(adminLoadMetaPartition, req.params())
+}
+
+func (mc *MasterClient) MetaPartitionOffline(req *PartitionOfflineRequest) error {
+	return mc.post(adminMetaPartitionOffline, req.params())
+}
+
+func (mc *MasterClient) SplitMetaPartition(req *SplitMetaPartitionRequest) error {
+	return mc.post(adminSplitMetaPartition, req.params())
+}
+
+// BalanceMetaNodes moves a meta partition replica from the meta node using
+// the largest share of its memory to the one using the smallest share.
+func (mc *MasterClient) BalanceMetaNodes() error {
+	return mc.post(metaNodeBalance, nil)
+}
+
+// Operation responses
+
+// MetaNodeResponse reports the result of an admin task to the master.
+func (mc *MasterClient) MetaNodeResponse(task *proto.AdminTask) error {
+	return mc.respond(metaNodeResponse, task)
+}
+
+// DataNodeResponse reports the result of an admin task to the master.
+func (mc *MasterClient) DataNodeResponse(task *proto.AdminTask) error {
+	return mc.respond(dataNodeResponse, task)
+}
+
+func (mc *MasterClient) respond(path string, task *proto.AdminTask) (err error) {
+	var data []byte
+	if data, err = json.Marshal(task); err != nil {
+		return
+	}
+	_, err = mc.request(http.MethodPost, path, nil, data)
+	return
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestMasterClient(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case adminGetCluster:
+			w.Write([]byte(`{"Name":"test","Vols":["v1"],"MetaNodes":[{"ID":1,"Addr":"mn:1","Status":true}]}`))
+		case clientVolStat:
+			msg := fmt.Sprintf("type[getVolStatInfo] From [%v] Deal [400] Because [%v not found: vol not found] ",
+				r.RemoteAddr, r.FormValue(paraName))
+			http.Error(w, msg, http.StatusBadRequest)
+		case adminGetAccessKey:
+			if key := r.FormValue(paraAccessKey); key != "a b&c" {
+				http.Error(w, "bad key "+key, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"AccessKey":"a b&c","SecretKey":"s"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer leader.Close()
+	leaderAddr := strings.TrimPrefix(leader.URL, "http://")
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(leaderAddr))
+	}))
+	defer follower.Close()
+
+	mc := NewMasterClient([]string{strings.TrimPrefix(follower.URL, "http://")})
+	cv, err := mc.GetCluster()
+	if err != nil {
+		t.Fatalf("get cluster: %v", err)
+	}
+	if cv.Name != "test" || len(cv.Vols) != 1 || len(cv.MetaNodes) != 1 || cv.MetaNodes[0].Addr != "mn:1" {
+		t.Fatalf("unexpected cluster view %+v", cv)
+	}
+	if mc.Leader() != leaderAddr {
+		t.Fatalf("leader %v, want %v", mc.Leader(), leaderAddr)
+	}
+
+	_, err = mc.GetVolStat(&VolRequest{Name: "v9"})
+	if errors.Cause(err) != ErrVolNotFound {
+		t.Fatalf("get vol stat: err %v, want cause %v", err, ErrVolNotFound)
+	}
+	if e, ok := err.(*Error); !ok || e.Op != "getVolStatInfo" || e.Status != http.StatusBadRequest || e.Reason != "v9 not found: vol not found" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	info, err := mc.GetAccessKey(&AccessKeyRequest{AccessKey: "a b&c"})
+	if err != nil {
+		t.Fatalf("get access key: %v", err)
+	}
+	if info.SecretKey != "s" {
+		t.Fatalf("unexpected access key %+v", info)
+	}
+}
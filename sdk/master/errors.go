@@ -0,0 +1,110 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/tiglabs/containerfs/util"
+)
+
+// Causes of the errors of the master, errors.Cause of an error returned
+// by MasterClient is one of these when the master gave a known reason.
+var (
+	ErrNoValidMaster         = util.ErrNoValidMaster
+	ErrVolNotFound           = errors.New("vol not found")
+	ErrDataPartitionNotFound = errors.New("data partition not found")
+	ErrMetaPartitionNotFound = errors.New("meta partition not found")
+	ErrDataNodeNotFound      = errors.New("data node not found")
+	ErrMetaNodeNotFound      = errors.New("meta node not found")
+	ErrAccessKeyNotFound     = errors.New("access key not found")
+	ErrInvalidPara           = errors.New("invalid parameter")
+	ErrNoLeader              = errors.New("no leader")
+)
+
+// notFounds maps the kinds of the "not found" errors of the master to
+// their causes, the master annotates them with the missing name.
+var notFounds = []struct {
+	kind  string
+	cause error
+}{
+	{"data partition", ErrDataPartitionNotFound},
+	{"meta partition", ErrMetaPartitionNotFound},
+	{"data node", ErrDataNodeNotFound},
+	{"meta node", ErrMetaNodeNotFound},
+	{"access key", ErrAccessKeyNotFound},
+	{"vol", ErrVolNotFound},
+}
+
+func reasonCause(reason string) error {
+	switch {
+	case strings.HasPrefix(reason, "parameter ") && strings.HasSuffix(reason, " not found"):
+		return ErrInvalidPara
+	case strings.HasSuffix(reason, "not found"):
+		for _, nf := range notFounds {
+			if strings.Contains(reason, nf.kind) {
+				return nf.cause
+			}
+		}
+	case strings.HasSuffix(reason, "para not unmatched"):
+		return ErrInvalidPara
+	case strings.HasSuffix(reason, "no leader"):
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// The master answers errors as
+// "type[op] From [remote] Deal [code] Because [reason] ".
+var errorMessageRegexp = regexp.MustCompile(`^type\[(.*?)\] From \[.*?\] Deal \[.*?\] Because \[(.*)\]\s*$`)
+
+// Error is an error answered by the master.
+type Error struct {
+	Addr   string
+	Status int
+	Op     string
+	Reason string
+	cause  error
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return fmt.Sprintf("master[%v] status[%v] %v", e.Addr, e.Status, e.Reason)
+	}
+	return fmt.Sprintf("master[%v] op[%v] status[%v] %v", e.Addr, e.Op, e.Status, e.Reason)
+}
+
+// Cause returns the known cause of the error, or nil, it makes
+// errors.Cause see through the error.
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+// decodeError turns the errors of the master helper into an *Error.
+func decodeError(err error) error {
+	masterErr, ok := err.(*util.MasterError)
+	if !ok {
+		return err
+	}
+	e := &Error{Addr: masterErr.Addr, Status: masterErr.Status, Reason: masterErr.Msg}
+	if match := errorMessageRegexp.FindStringSubmatch(masterErr.Msg); match != nil {
+		e.Op, e.Reason = match[1], match[2]
+	}
+	e.cause = reasonCause(e.Reason)
+	return e
+}
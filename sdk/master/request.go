@@ -0,0 +1,276 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// Routes of master/http_server.go.
+const (
+	adminGetCluster           = "/admin/getCluster"
+	adminGetDataPartition     = "/dataPartition/get"
+	adminLoadDataPartition    = "/dataPartition/load"
+	adminCreateDataPartition  = "/dataPartition/create"
+	adminDataPartitionOffline = "/dataPartition/offline"
+	adminDeleteVol            = "/vol/delete"
+	adminVolTopDirs           = "/vol/topDirs"
+	adminCreateVol            = "/admin/createVol"
+	adminGetIp                = "/admin/getIp"
+	adminCreateMP             = "/metaPartition/create"
+	adminSetCompactStatus     = "/compactStatus/set"
+	adminGetCompactStatus     = "/compactStatus/get"
+	adminSetMetaNodeThreshold = "/threshold/set"
+	adminCreateAccessKey      = "/accessKey/create"
+	adminDeleteAccessKey      = "/accessKey/delete"
+	adminGetAccessKey         = "/accessKey/get"
+
+	clientDataPartitions = "/client/dataPartitions"
+	clientVol            = "/client/vol"
+	clientMetaPartition  = "/client/metaPartition"
+	clientVolStat        = "/client/volStat"
+
+	raftNodeAdd    = "/raftNode/add"
+	raftNodeRemove = "/raftNode/remove"
+
+	addDataNode               = "/dataNode/add"
+	dataNodeOffline           = "/dataNode/offline"
+	getDataNode               = "/dataNode/get"
+	addMetaNode               = "/metaNode/add"
+	metaNodeOffline           = "/metaNode/offline"
+	getMetaNode               = "/metaNode/get"
+	adminLoadMetaPartition    = "/metaPartition/load"
+	adminMetaPartitionOffline = "/metaPartition/offline"
+	adminSplitMetaPartition   = "/metaPartition/split"
+	metaNodeBalance           = "/metaNode/balance"
+
+	metaNodeResponse = "/metaNode/response"
+	dataNodeResponse = "/dataNode/response"
+)
+
+// Parameters of the routes.
+const (
+	paraNodeAddr          = "addr"
+	paraName              = "name"
+	paraId                = "id"
+	paraCount             = "count"
+	paraReplicas          = "replicas"
+	paraDataPartitionType = "type"
+	paraStart             = "start"
+	paraEnable            = "enable"
+	paraThreshold         = "threshold"
+	paraWormRetention     = "wormRetention"
+	paraWormAutoCommit    = "wormAutoCommit"
+	paraInlineSize        = "inlineSize"
+	paraAccessKey         = "accessKey"
+	paraVols              = "vols"
+)
+
+// VolRequest names the volume of /vol/delete, /client/dataPartitions,
+// /client/vol and /client/volStat.
+type VolRequest struct {
+	Name string
+}
+
+func (req *VolRequest) params() map[string]string {
+	return map[string]string{paraName: req.Name}
+}
+
+// TopDirsRequest asks for the Count largest directories of volume Name, 0
+// leaves the count to the master.
+type TopDirsRequest struct {
+	Name  string
+	Count int
+}
+
+func (req *TopDirsRequest) params() map[string]string {
+	params := map[string]string{paraName: req.Name}
+	if req.Count > 0 {
+		params[paraCount] = strconv.Itoa(req.Count)
+	}
+	return params
+}
+
+type CreateVolRequest struct {
+	Name     string
+	Replicas int
+	Type     string
+	Worm     proto.WormPolicy
+	// Files up to InlineSize bytes are kept inline in their inodes, 0
+	// disables inline files.
+	InlineSize uint32
+}
+
+func (req *CreateVolRequest) params() map[string]string {
+	params := map[string]string{
+		paraName:              req.Name,
+		paraReplicas:          strconv.Itoa(req.Replicas),
+		paraDataPartitionType: req.Type,
+	}
+	if req.Worm.Retention > 0 {
+		params[paraWormRetention] = strconv.FormatInt(req.Worm.Retention, 10)
+	}
+	if req.Worm.AutoCommit > 0 {
+		params[paraWormAutoCommit] = strconv.FormatInt(req.Worm.AutoCommit, 10)
+	}
+	if req.InlineSize > 0 {
+		params[paraInlineSize] = strconv.FormatUint(uint64(req.InlineSize), 10)
+	}
+	return params
+}
+
+// NodeRequest names the node of the data node and meta node routes.
+type NodeRequest struct {
+	Addr string
+}
+
+func (req *NodeRequest) params() map[string]string {
+	return map[string]string{paraNodeAddr: req.Addr}
+}
+
+type RaftNodeRequest struct {
+	ID   uint64
+	Addr string
+}
+
+func (req *RaftNodeRequest) params() map[string]string {
+	return map[string]string{
+		paraId:       strconv.FormatUint(req.ID, 10),
+		paraNodeAddr: req.Addr,
+	}
+}
+
+type GetDataPartitionRequest struct {
+	PartitionID uint64
+}
+
+func (req *GetDataPartitionRequest) params() map[string]string {
+	return map[string]string{paraId: strconv.FormatUint(req.PartitionID, 10)}
+}
+
+// PartitionRequest names a partition of a volume, for the load routes
+// and /client/metaPartition.
+type PartitionRequest struct {
+	Vol         string
+	PartitionID uint64
+}
+
+func (req *PartitionRequest) params() map[string]string {
+	return map[string]string{
+		paraName: req.Vol,
+		paraId:   strconv.FormatUint(req.PartitionID, 10),
+	}
+}
+
+// PartitionOfflineRequest names the replica on Addr of a partition to
+// take offline.
+type PartitionOfflineRequest struct {
+	Vol         string
+	PartitionID uint64
+	Addr        string
+}
+
+func (req *PartitionOfflineRequest) params() map[string]string {
+	return map[string]string{
+		paraName:     req.Vol,
+		paraId:       strconv.FormatUint(req.PartitionID, 10),
+		paraNodeAddr: req.Addr,
+	}
+}
+
+type CreateDataPartitionRequest struct {
+	Vol   string
+	Count int
+	Type  string
+}
+
+func (req *CreateDataPartitionRequest) params() map[string]string {
+	return map[string]string{
+		paraName:              req.Vol,
+		paraCount:             strconv.Itoa(req.Count),
+		paraDataPartitionType: req.Type,
+	}
+}
+
+// CreateMetaPartitionRequest ends the last meta partition of the volume
+// at Start, a new partition serves the inodes from Start on.
+type CreateMetaPartitionRequest struct {
+	Vol   string
+	Start uint64
+}
+
+func (req *CreateMetaPartitionRequest) params() map[string]string {
+	return map[string]string{
+		paraName:  req.Vol,
+		paraStart: strconv.FormatUint(req.Start, 10),
+	}
+}
+
+// SplitMetaPartitionRequest moves the inodes after SplitAt of a meta
+// partition to a new partition.
+type SplitMetaPartitionRequest struct {
+	Vol         string
+	PartitionID uint64
+	SplitAt     uint64
+}
+
+func (req *SplitMetaPartitionRequest) params() map[string]string {
+	return map[string]string{
+		paraName:  req.Vol,
+		paraId:    strconv.FormatUint(req.PartitionID, 10),
+		paraStart: strconv.FormatUint(req.SplitAt, 10),
+	}
+}
+
+type SetCompactStatusRequest struct {
+	Enable bool
+}
+
+func (req *SetCompactStatusRequest) params() map[string]string {
+	return map[string]string{paraEnable: strconv.FormatBool(req.Enable)}
+}
+
+type SetMetaNodeThresholdRequest struct {
+	Threshold float64
+}
+
+func (req *SetMetaNodeThresholdRequest) params() map[string]string {
+	return map[string]string{paraThreshold: strconv.FormatFloat(req.Threshold, 'f', -1, 64)}
+}
+
+// CreateAccessKeyRequest limits the new key to Vols, an empty list gives
+// access to all volumes.
+type CreateAccessKeyRequest struct {
+	Vols []string
+}
+
+func (req *CreateAccessKeyRequest) params() map[string]string {
+	params := make(map[string]string)
+	if len(req.Vols) > 0 {
+		params[paraVols] = strings.Join(req.Vols, ",")
+	}
+	return params
+}
+
+type AccessKeyRequest struct {
+	AccessKey string
+}
+
+func (req *AccessKeyRequest) params() map[string]string {
+	return map[string]string{paraAccessKey: req.AccessKey}
+}
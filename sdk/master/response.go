@@ -0,0 +1,158 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+)
+
+// The responses below mirror the JSON the master answers with, fields of
+// the master structures which are of no use to clients are left out.
+
+type ClusterView struct {
+	Name               string
+	LeaderAddr         string
+	CompactStatus      bool
+	Applied            uint64
+	MaxDataPartitionID uint64
+	MaxMetaNodeID      uint64
+	MaxMetaPartitionID uint64
+	Vols               []string
+	MetaNodes          []MetaNodeView
+	DataNodes          []DataNodeView
+}
+
+type DataNodeView struct {
+	Addr   string
+	Status bool
+}
+
+type MetaNodeView struct {
+	ID     uint64
+	Addr   string
+	Status bool
+}
+
+type DataNodeInfo struct {
+	MaxDiskAvailWeight        uint64
+	CreatedVolWeights         uint64
+	RemainWeightsForCreateVol uint64
+	Total                     uint64 `json:"TotalWeight"`
+	Used                      uint64 `json:"UsedWeight"`
+	Available                 uint64
+	RackName                  string `json:"Rack"`
+	Addr                      string
+	ReportTime                time.Time
+	Ratio                     float64
+	SelectCount               uint64
+	Carry                     float64
+	DataPartitionCount        uint32
+}
+
+type MetaNodeInfo struct {
+	ID                 uint64
+	Addr               string
+	IsActive           bool
+	RackName           string `json:"Rack"`
+	MaxMemAvailWeight  uint64
+	Total              uint64 `json:"TotalWeight"`
+	Used               uint64 `json:"UsedWeight"`
+	Ratio              float64
+	SelectCount        uint64
+	Carry              float64
+	Threshold          float32
+	ReportTime         time.Time
+	MetaPartitionCount int
+}
+
+type DataReplica struct {
+	Addr                    string
+	ReportTime              int64
+	FileCount               uint32
+	Status                  int8
+	LoadPartitionIsResponse bool
+	Total                   uint64 `json:"TotalSize"`
+	Used                    uint64 `json:"UsedSize"`
+}
+
+type DataPartitionInfo struct {
+	PartitionID      uint64
+	LastLoadTime     int64
+	ReplicaNum       uint8
+	Status           int8
+	Replicas         []*DataReplica
+	PartitionType    string
+	PersistenceHosts []string
+	MissNodes        map[string]int64
+	VolName          string
+}
+
+type MetaReplica struct {
+	Addr       string
+	ReportTime int64
+	Status     int8
+	IsLeader   bool
+}
+
+type MetaPartitionInfo struct {
+	PartitionID      uint64
+	Start            uint64
+	End              uint64
+	MaxNodeID        uint64
+	Replicas         []*MetaReplica
+	ReplicaNum       uint8
+	Status           int8
+	PersistenceHosts []string
+	Peers            []proto.Peer
+	MissNodes        map[string]int64
+}
+
+type DataPartitionResponse struct {
+	PartitionID   uint64
+	Status        int8
+	ReplicaNum    uint8
+	PartitionType string
+	Hosts         []string
+}
+
+type DataPartitionsView struct {
+	DataPartitions []*DataPartitionResponse
+}
+
+type MetaPartitionView struct {
+	PartitionID uint64
+	Start       uint64
+	End         uint64
+	Members     []string
+	LeaderAddr  string
+	Status      int8
+}
+
+type VolView struct {
+	Name           string
+	VolType        string
+	Worm           proto.WormPolicy
+	InlineSize     uint32
+	MetaPartitions []*MetaPartitionView
+	DataPartitions []*DataPartitionResponse
+}
+
+type VolStatInfo struct {
+	Name      string
+	TotalSize uint64
+	UsedSize  uint64
+}
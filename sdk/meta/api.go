@@ -15,17 +15,26 @@
 package meta
 
 import (
+	"context"
+	"math"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk"
 	"github.com/tiglabs/containerfs/util/log"
 )
 
 // TODO: High-level API, i.e. work with absolute path
 
 // Low-level API, i.e. work with inode
+//
+// Every operation has a context-first variant named with the Context suffix,
+// which gives up once the context is done and returns *sdk.Error, so that
+// callers can tell errors apart with errors.Is, e.g. sdk.ErrNotFound. The
+// variants without context return the plain syscall.Errno of the error.
 
 const (
 	BatchIgetRespBuf = 1000
@@ -38,20 +47,29 @@ func (mw *MetaWrapper) Statfs() (total, used uint64) {
 }
 
 func (mw *MetaWrapper) Open_ll(inode uint64) error {
+	return sdk.Errno(mw.OpenContext(context.Background(), inode))
+}
+
+func (mw *MetaWrapper) OpenContext(ctx context.Context, inode uint64) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogErrorf("Open_ll: No such partition, ino(%v)", inode)
-		return syscall.ENOENT
+		return newError("Open", syscall.ENOENT)
 	}
 
-	status, err := mw.open(mp, inode)
+	status, err := mw.open(ctx, mp, inode)
 	if err != nil || status != statusOK {
-		return statusToErrno(status)
+		return statusToError("Open", status, err)
 	}
 	return nil
 }
 
 func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode uint32, target []byte) (*proto.InodeInfo, error) {
+	info, err := mw.CreateContext(context.Background(), parentID, name, mode, target)
+	return info, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) CreateContext(ctx context.Context, parentID uint64, name string, mode uint32, target []byte) (*proto.InodeInfo, error) {
 	var (
 		status       int
 		err          error
@@ -60,17 +78,16 @@ func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode uint32, targ
 		rwPartitions []*MetaPartition
 	)
 
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
+	if mw.getPartitionByInode(parentID) == nil {
 		log.LogErrorf("Create_ll: No parent partition, parentID(%v)", parentID)
-		return nil, syscall.ENOENT
+		return nil, newError("Create", syscall.ENOENT)
 	}
 
 	// Create Inode
 
 	mp = mw.getLatestPartition()
 	if mp != nil {
-		status, info, err = mw.icreate(mp, mode, target)
+		status, info, err = mw.icreate(ctx, mp, mode, target, parentID)
 		if err == nil {
 			if status == statusOK {
 				goto create_dentry
@@ -82,57 +99,87 @@ func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode uint32, targ
 
 	rwPartitions = mw.getRWPartitions()
 	for _, mp = range rwPartitions {
-		status, info, err = mw.icreate(mp, mode, target)
+		if err = sdk.ContextError("Create", ctx); err != nil {
+			return nil, err
+		}
+		status, info, err = mw.icreate(ctx, mp, mode, target, parentID)
 		if err == nil && status == statusOK {
 			goto create_dentry
 		}
 	}
-	return nil, syscall.ENOMEM
+	if err = sdk.ContextError("Create", ctx); err != nil {
+		return nil, err
+	}
+	return nil, newError("Create", syscall.ENOMEM)
 
 create_dentry:
-	status, err = mw.dcreate(parentMP, parentID, name, info.Inode, mode)
+	status, err = mw.dentryCreate(ctx, parentID, name, info.Inode, mode)
 	if err != nil || status != statusOK {
 		if status == statusExist {
-			return nil, syscall.EEXIST
+			return nil, newError("Create", syscall.EEXIST)
 		} else {
-			mw.idelete(mp, info.Inode)
-			mw.ievict(mp, info.Inode)
-			return nil, statusToErrno(status)
+			mw.idelete(context.Background(), mp, info.Inode)
+			mw.ievict(context.Background(), mp, info.Inode)
+			return nil, statusToError("Create", status, err)
 		}
 	}
 	return info, nil
 }
 
 func (mw *MetaWrapper) Lookup_ll(parentID uint64, name string) (inode uint64, mode uint32, err error) {
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
-		log.LogErrorf("Lookup_ll: No parent partition, parentID(%v) name(%v)", parentID, name)
-		return 0, 0, syscall.ENOENT
-	}
+	inode, mode, err = mw.LookupContext(context.Background(), parentID, name)
+	return inode, mode, sdk.Errno(err)
+}
 
-	status, inode, mode, err := mw.lookup(parentMP, parentID, name)
+func (mw *MetaWrapper) LookupContext(ctx context.Context, parentID uint64, name string) (inode uint64, mode uint32, err error) {
+	status, inode, mode, err := mw.dentryLookup(ctx, parentID, name)
 	if err != nil || status != statusOK {
-		return 0, 0, statusToErrno(status)
+		return 0, 0, statusToError("Lookup", status, err)
 	}
 	return inode, mode, nil
 }
 
 func (mw *MetaWrapper) InodeGet_ll(inode uint64) (*proto.InodeInfo, error) {
+	info, err := mw.InodeGetContext(context.Background(), inode)
+	return info, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) InodeGetContext(ctx context.Context, inode uint64) (*proto.InodeInfo, error) {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogErrorf("InodeGet_ll: No such partition, ino(%v)", inode)
-		return nil, syscall.ENOENT
+		return nil, newError("InodeGet", syscall.ENOENT)
 	}
 
-	status, info, err := mw.iget(mp, inode)
+	status, info, err := mw.iget(ctx, mp, inode)
 	if err != nil || status != statusOK {
-		return nil, statusToErrno(status)
+		return nil, statusToError("InodeGet", status, err)
 	}
 	log.LogDebugf("InodeGet_ll: info(%v)", info)
 	return info, nil
 }
 
+// InodePaths returns the paths of inode from the root of the volume, one
+// for each of its hard links. The links are recorded by the meta nodes in
+// the background, so a new inode may have no path yet.
+func (mw *MetaWrapper) InodePaths(inode uint64) ([]string, error) {
+	paths, err := proto.InodePaths(inode, func(ino uint64) (*proto.InodeInfo, error) {
+		info, err := mw.InodeGetContext(context.Background(), ino)
+		if err != nil && sdk.Errno(err) == syscall.ENOENT {
+			return nil, nil
+		}
+		return info, err
+	})
+	return paths, sdk.Errno(err)
+}
+
 func (mw *MetaWrapper) BatchInodeGet(inodes []uint64) []*proto.InodeInfo {
+	return mw.BatchInodeGetContext(context.Background(), inodes)
+}
+
+// BatchInodeGetContext returns the inodes found before ctx is done, the
+// others are left out as BatchInodeGet does for failed partitions.
+func (mw *MetaWrapper) BatchInodeGetContext(ctx context.Context, inodes []uint64) []*proto.InodeInfo {
 	var wg sync.WaitGroup
 
 	batchInfos := make([]*proto.InodeInfo, 0)
@@ -141,7 +188,7 @@ func (mw *MetaWrapper) BatchInodeGet(inodes []uint64) []*proto.InodeInfo {
 	mw.RLock()
 	for _, mp := range mw.partitions {
 		wg.Add(1)
-		go mw.batchIget(&wg, mp, inodes, resp)
+		go mw.batchIget(ctx, &wg, mp, inodes, resp)
 	}
 	mw.RUnlock()
 
@@ -157,15 +204,14 @@ func (mw *MetaWrapper) BatchInodeGet(inodes []uint64) []*proto.InodeInfo {
 }
 
 func (mw *MetaWrapper) Delete_ll(parentID uint64, name string) (*proto.InodeInfo, error) {
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
-		log.LogErrorf("Delete_ll: No parent partition, parentID(%v) name(%v)", parentID, name)
-		return nil, syscall.ENOENT
-	}
+	info, err := mw.DeleteContext(context.Background(), parentID, name)
+	return info, sdk.Errno(err)
+}
 
-	status, inode, err := mw.ddelete(parentMP, parentID, name)
+func (mw *MetaWrapper) DeleteContext(ctx context.Context, parentID uint64, name string) (*proto.InodeInfo, error) {
+	status, inode, err := mw.dentryDelete(ctx, parentID, name)
 	if err != nil || status != statusOK {
-		return nil, statusToErrno(status)
+		return nil, statusToError("Delete", status, err)
 	}
 
 	// dentry is deleted successfully but inode is not, still returns success.
@@ -175,183 +221,452 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string) (*proto.InodeInfo
 		return nil, nil
 	}
 
-	status, info, err := mw.idelete(mp, inode)
+	// The dentry is gone already, do not leave the inode behind for ctx.
+	status, info, err := mw.idelete(context.Background(), mp, inode)
 	if err != nil || status != statusOK {
 		return nil, nil
 	}
+	if len(info.Shards) != 0 {
+		mw.deleteShardDirs(info.Shards)
+		mw.deleteShards(inode)
+	}
 	return info, nil
 }
 
 func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID uint64, dstName string) (err error) {
-	var oldInode uint64
+	return sdk.Errno(mw.RenameContext(context.Background(), srcParentID, srcName, dstParentID, dstName))
+}
 
-	srcParentMP := mw.getPartitionByInode(srcParentID)
-	if srcParentMP == nil {
-		return syscall.ENOENT
-	}
-	dstParentMP := mw.getPartitionByInode(dstParentID)
-	if dstParentMP == nil {
-		return syscall.ENOENT
-	}
+// RenameContext gives up only before the dentry is created in the
+// destination, the rest of a rename is finished regardless of ctx.
+func (mw *MetaWrapper) RenameContext(ctx context.Context, srcParentID uint64, srcName string, dstParentID uint64, dstName string) (err error) {
+	var oldInode uint64
 
 	// look up for the ino
-	status, inode, mode, err := mw.lookup(srcParentMP, srcParentID, srcName)
+	status, inode, mode, err := mw.dentryLookup(ctx, srcParentID, srcName)
 	if err != nil || status != statusOK {
-		return statusToErrno(status)
+		return statusToError("Rename", status, err)
+	}
+	if err = mw.checkMutable(ctx, inode); err != nil {
+		return
 	}
 	// create dentry in dst parent
-	status, err = mw.dcreate(dstParentMP, dstParentID, dstName, inode, mode)
+	status, err = mw.dentryCreate(ctx, dstParentID, dstName, inode, mode)
 	if err != nil {
-		return syscall.EAGAIN
+		return statusToError("Rename", statusOK, err)
 	}
+	ctx = context.Background()
 
 	if status == statusExist {
-		status, oldInode, err = mw.dupdate(dstParentMP, dstParentID, dstName, inode)
+		status, oldInode, _, err = mw.dentryLookup(ctx, dstParentID, dstName)
+		if err != nil || status != statusOK {
+			return statusToError("Rename", status, err)
+		}
+		if err = mw.checkMutable(ctx, oldInode); err != nil {
+			return
+		}
+		status, oldInode, err = mw.dentryUpdate(ctx, dstParentID, dstName, inode)
 		if err != nil {
-			return syscall.EAGAIN
+			return statusToError("Rename", statusOK, err)
 		}
 	}
 
 	if status != statusOK {
-		return statusToErrno(status)
+		return statusToError("Rename", status, nil)
 	}
 
 	// delete dentry from src parent
-	status, _, err = mw.ddelete(srcParentMP, srcParentID, srcName)
+	status, _, err = mw.dentryDelete(ctx, srcParentID, srcName)
 	if err != nil || status != statusOK {
 		if oldInode == 0 {
-			mw.ddelete(dstParentMP, dstParentID, dstName)
+			mw.dentryDelete(ctx, dstParentID, dstName)
 		} else {
-			mw.dupdate(dstParentMP, dstParentID, dstName, oldInode)
+			mw.dentryUpdate(ctx, dstParentID, dstName, oldInode)
 		}
-		return statusToErrno(status)
+		return statusToError("Rename", status, err)
 	}
 
 	if oldInode != 0 {
 		inodeMP := mw.getPartitionByInode(oldInode)
 		if inodeMP != nil {
-			mw.idelete(inodeMP, oldInode)
+			mw.idelete(ctx, inodeMP, oldInode)
+		}
+	}
+
+	// The usage of the directory trees is fixed in the background.
+	if srcParentID != dstParentID {
+		if inodeMP := mw.getPartitionByInode(inode); inodeMP != nil {
+			mw.setParent(ctx, inodeMP, inode, dstParentID)
 		}
 	}
 
 	return nil
 }
 
-func (mw *MetaWrapper) ReadDir_ll(parentID uint64) ([]proto.Dentry, error) {
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
-		return nil, syscall.ENOENT
+// checkMutable returns EPERM if the inode is immutable or append-only,
+// which can not be renamed or replaced. The meta nodes refuse to remove
+// its dentry anyway, checking first saves creating and removing the
+// destination dentry of a rename which fails.
+func (mw *MetaWrapper) checkMutable(ctx context.Context, inode uint64) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		return newError("Rename", syscall.ENOENT)
+	}
+	status, info, err := mw.iget(ctx, mp, inode)
+	if err != nil || status != statusOK {
+		return statusToError("Rename", status, err)
 	}
+	if info.Flags&(proto.FlagImmutable|proto.FlagAppend) != 0 {
+		return newError("Rename", syscall.EPERM)
+	}
+	if info.IsRetained(time.Now().Unix()) {
+		return newError("Rename", syscall.EPERM)
+	}
+	return nil
+}
 
-	status, children, err := mw.readdir(parentMP, parentID)
+func (mw *MetaWrapper) ReadDir_ll(parentID uint64) ([]proto.Dentry, error) {
+	children, err := mw.ReadDirContext(context.Background(), parentID)
+	return children, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) ReadDirContext(ctx context.Context, parentID uint64) ([]proto.Dentry, error) {
+	status, children, err := mw.dentryList(ctx, parentID)
 	if err != nil || status != statusOK {
-		return nil, statusToErrno(status)
+		return nil, statusToError("ReadDir", status, err)
 	}
 	return children, nil
 }
 
 // Used as a callback by stream sdk
 func (mw *MetaWrapper) AppendExtentKey(inode uint64, ek proto.ExtentKey) error {
+	return sdk.Errno(mw.AppendExtentKeyContext(context.Background(), inode, ek))
+}
+
+func (mw *MetaWrapper) AppendExtentKeyContext(ctx context.Context, inode uint64, ek proto.ExtentKey) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
-		return syscall.ENOENT
+		return newError("AppendExtentKey", syscall.ENOENT)
 	}
 
-	status, err := mw.appendExtentKey(mp, inode, ek)
+	status, err := mw.appendExtentKey(ctx, mp, inode, ek)
 	if err != nil || status != statusOK {
 		log.LogErrorf("AppendExtentKey: inode(%v) ek(%v) err(%v) status(%v)", inode, ek, err, status)
-		return statusToErrno(status)
+		return statusToError("AppendExtentKey", status, err)
 	}
 	return nil
 }
 
 func (mw *MetaWrapper) GetExtents(inode uint64) ([]proto.ExtentKey, error) {
+	extents, err := mw.GetExtentsContext(context.Background(), inode)
+	return extents, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) GetExtentsContext(ctx context.Context, inode uint64) ([]proto.ExtentKey, error) {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
-		return nil, syscall.ENOENT
+		return nil, newError("GetExtents", syscall.ENOENT)
 	}
 
-	status, extents, err := mw.getExtents(mp, inode)
+	status, extents, err := mw.getExtents(ctx, mp, inode)
 	if err != nil || status != statusOK {
 		log.LogErrorf("GetExtents: err(%v) status(%v)", err, status)
-		return nil, statusToErrno(status)
+		return nil, statusToError("GetExtents", status, err)
 	}
 	return extents, nil
 }
 
+// GetInline returns the body of a small file which is kept inline in the
+// inode, it is empty if the file is stored in extents.
+func (mw *MetaWrapper) GetInline(inode uint64) ([]byte, error) {
+	data, err := mw.GetInlineContext(context.Background(), inode)
+	return data, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) GetInlineContext(ctx context.Context, inode uint64) ([]byte, error) {
+	info, err := mw.InodeGetContext(ctx, inode)
+	if err != nil {
+		log.LogErrorf("GetInline: ino(%v) err(%v)", inode, err)
+		return nil, err
+	}
+	return info.Inline, nil
+}
+
+// WriteInline writes data into the inline body of a small file. EINVAL is
+// returned if the file has extents or the body would grow too large.
+func (mw *MetaWrapper) WriteInline(inode, offset uint64, data []byte) error {
+	return sdk.Errno(mw.WriteInlineContext(context.Background(), inode, offset, data))
+}
+
+func (mw *MetaWrapper) WriteInlineContext(ctx context.Context, inode, offset uint64, data []byte) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		return newError("WriteInline", syscall.ENOENT)
+	}
+
+	status, err := mw.inlineWrite(ctx, mp, inode, offset, data)
+	if err != nil || status != statusOK {
+		return statusToError("WriteInline", status, err)
+	}
+	return nil
+}
+
 func (mw *MetaWrapper) Truncate(inode uint64) error {
+	return sdk.Errno(mw.TruncateContext(context.Background(), inode))
+}
+
+func (mw *MetaWrapper) TruncateContext(ctx context.Context, inode uint64) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogErrorf("Truncate: No inode partition, ino(%v)", inode)
-		return syscall.ENOENT
+		return newError("Truncate", syscall.ENOENT)
 	}
 
-	status, err := mw.truncate(mp, inode)
+	status, err := mw.truncate(ctx, mp, inode)
 	if err != nil || status != statusOK {
-		return statusToErrno(status)
+		return statusToError("Truncate", status, err)
 	}
 	return nil
 
 }
 
+// PunchHole replaces range [offset, offset+size) of the file data with a hole,
+// and the space of the range is released from dataNodes.
+func (mw *MetaWrapper) PunchHole(inode, offset, size uint64) error {
+	return sdk.Errno(mw.PunchHoleContext(context.Background(), inode, offset, size))
+}
+
+func (mw *MetaWrapper) PunchHoleContext(ctx context.Context, inode, offset, size uint64) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("PunchHole: No inode partition, ino(%v)", inode)
+		return newError("PunchHole", syscall.ENOENT)
+	}
+
+	status, err := mw.punchHole(ctx, mp, inode, offset, size)
+	if err != nil || status != statusOK {
+		return statusToError("PunchHole", status, err)
+	}
+	return nil
+}
+
+// CloneRange makes inode dst share the extents of range [srcOffset,
+// srcOffset+size) of inode src, appended to the data of dst, which has to
+// end at dstOffset. It returns the number of bytes cloned, less than size
+// at the end of src. Extents are reference counted by the meta partition,
+// so both inodes must live in the same one, otherwise EXDEV is returned.
+func (mw *MetaWrapper) CloneRange(src, srcOffset, dst, dstOffset, size uint64) (uint64, error) {
+	n, err := mw.CloneRangeContext(context.Background(), src, srcOffset, dst, dstOffset, size)
+	return n, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) CloneRangeContext(ctx context.Context, src, srcOffset, dst, dstOffset, size uint64) (uint64, error) {
+	mp := mw.getPartitionByInode(src)
+	if mp == nil {
+		log.LogErrorf("CloneRange: No inode partition, src(%v)", src)
+		return 0, newError("CloneRange", syscall.ENOENT)
+	}
+	if dmp := mw.getPartitionByInode(dst); dmp == nil || dmp.PartitionID != mp.PartitionID {
+		return 0, newError("CloneRange", syscall.EXDEV)
+	}
+
+	status, n, err := mw.cloneExtents(ctx, mp, src, srcOffset, dst, dstOffset, size)
+	if err != nil || status != statusOK {
+		return 0, statusToError("CloneRange", status, err)
+	}
+	return n, nil
+}
+
+// Clone creates file name in directory parentID which shares the data of
+// inode src. The new inode is allocated in the partition of src.
+func (mw *MetaWrapper) Clone(parentID uint64, name string, src uint64) (*proto.InodeInfo, error) {
+	info, err := mw.CloneContext(context.Background(), parentID, name, src)
+	return info, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) CloneContext(ctx context.Context, parentID uint64, name string, src uint64) (*proto.InodeInfo, error) {
+	if mw.getPartitionByInode(parentID) == nil {
+		log.LogErrorf("Clone: No parent partition, parentID(%v)", parentID)
+		return nil, newError("Clone", syscall.ENOENT)
+	}
+
+	mp := mw.getPartitionByInode(src)
+	if mp == nil {
+		log.LogErrorf("Clone: No source inode partition, src(%v)", src)
+		return nil, newError("Clone", syscall.ENOENT)
+	}
+
+	status, srcInfo, err := mw.iget(ctx, mp, src)
+	if err != nil || status != statusOK {
+		return nil, statusToError("Clone", status, err)
+	}
+	if !proto.IsRegular(srcInfo.Mode) {
+		return nil, newError("Clone", syscall.EINVAL)
+	}
+
+	status, info, err := mw.icreate(ctx, mp, srcInfo.Mode, nil, parentID)
+	if err != nil || status != statusOK {
+		return nil, statusToError("Clone", status, err)
+	}
+	ino := info.Inode
+
+	status, _, err = mw.cloneExtents(ctx, mp, src, 0, ino, 0, math.MaxUint64)
+	if err == nil && status == statusOK {
+		status, info, err = mw.iget(ctx, mp, ino)
+	}
+	if err != nil || status != statusOK {
+		mw.idelete(context.Background(), mp, ino)
+		mw.ievict(context.Background(), mp, ino)
+		return nil, statusToError("Clone", status, err)
+	}
+
+	status, err = mw.dentryCreate(ctx, parentID, name, ino, srcInfo.Mode)
+	if err != nil || status != statusOK {
+		mw.idelete(context.Background(), mp, ino)
+		mw.ievict(context.Background(), mp, ino)
+		if status == statusExist {
+			return nil, newError("Clone", syscall.EEXIST)
+		}
+		return nil, statusToError("Clone", status, err)
+	}
+	return info, nil
+}
+
 func (mw *MetaWrapper) Link(parentID uint64, name string, ino uint64) (*proto.InodeInfo, error) {
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
+	info, err := mw.LinkContext(context.Background(), parentID, name, ino)
+	return info, sdk.Errno(err)
+}
+
+func (mw *MetaWrapper) LinkContext(ctx context.Context, parentID uint64, name string, ino uint64) (*proto.InodeInfo, error) {
+	if mw.getPartitionByInode(parentID) == nil {
 		log.LogErrorf("Link: No parent partition, parentID(%v)", parentID)
-		return nil, syscall.ENOENT
+		return nil, newError("Link", syscall.ENOENT)
 	}
 
 	mp := mw.getPartitionByInode(ino)
 	if mp == nil {
 		log.LogErrorf("Link: No target inode partition, ino(%v)", ino)
-		return nil, syscall.ENOENT
+		return nil, newError("Link", syscall.ENOENT)
 	}
 
 	// increase inode nlink
-	status, info, err := mw.ilink(mp, ino)
+	status, info, err := mw.ilink(ctx, mp, ino)
 	if err != nil || status != statusOK {
-		return nil, statusToErrno(status)
+		return nil, statusToError("Link", status, err)
 	}
 
 	// create new dentry and refer to the inode
-	status, err = mw.dcreate(parentMP, parentID, name, ino, info.Mode)
+	status, err = mw.dentryCreate(ctx, parentID, name, ino, info.Mode)
 	if err != nil || status != statusOK {
 		if status == statusExist {
-			return nil, syscall.EEXIST
+			return nil, newError("Link", syscall.EEXIST)
 		} else {
-			mw.idelete(mp, ino)
-			return nil, syscall.EAGAIN
+			mw.idelete(context.Background(), mp, ino)
+			return nil, statusToError("Link", statusOK, err)
 		}
 	}
 	return info, nil
 }
 
 func (mw *MetaWrapper) Evict(inode uint64) error {
+	return sdk.Errno(mw.EvictContext(context.Background(), inode))
+}
+
+func (mw *MetaWrapper) EvictContext(ctx context.Context, inode uint64) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogWarnf("Evict: No such partition, ino(%v)", inode)
-		return syscall.EINVAL
+		return newError("Evict", syscall.EINVAL)
 	}
 
-	status, err := mw.ievict(mp, inode)
+	status, err := mw.ievict(ctx, mp, inode)
 	if err != nil || status != statusOK {
 		log.LogWarnf("Evict: ino(%v) err(%v) status(%v)", inode, err, status)
-		return statusToErrno(status)
+		return statusToError("Evict", status, err)
 	}
 	return nil
 }
 
 func (mw *MetaWrapper) Setattr(inode uint64, valid, mode, uid, gid uint32) error {
+	return sdk.Errno(mw.SetattrContext(context.Background(), inode, valid, mode, uid, gid))
+}
+
+func (mw *MetaWrapper) SetattrContext(ctx context.Context, inode uint64, valid, mode, uid, gid uint32) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogErrorf("Setattr: No such partition, ino(%v)", inode)
-		return syscall.EINVAL
+		return newError("Setattr", syscall.EINVAL)
 	}
 
-	status, err := mw.setattr(mp, inode, valid, mode, uid, gid)
+	status, err := mw.setattr(ctx, mp, inode, valid, mode, uid, gid, 0)
 	if err != nil || status != statusOK {
 		log.LogErrorf("Setattr: ino(%v) err(%v) status(%v)", inode, err, status)
-		return statusToErrno(status)
+		return statusToError("Setattr", status, err)
+	}
+
+	return nil
+}
+
+// SetFlags replaces the inode flags, i.e. proto.FlagImmutable and proto.FlagAppend.
+func (mw *MetaWrapper) SetFlags(inode uint64, flags uint32) error {
+	return sdk.Errno(mw.SetFlagsContext(context.Background(), inode, flags))
+}
+
+func (mw *MetaWrapper) SetFlagsContext(ctx context.Context, inode uint64, flags uint32) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("SetFlags: No such partition, ino(%v)", inode)
+		return newError("SetFlags", syscall.EINVAL)
+	}
+
+	status, err := mw.setattr(ctx, mp, inode, proto.AttrFlags, 0, 0, 0, flags)
+	if err != nil || status != statusOK {
+		log.LogErrorf("SetFlags: ino(%v) err(%v) status(%v)", inode, err, status)
+		return statusToError("SetFlags", status, err)
+	}
+
+	return nil
+}
+
+// Allocate extends the file to size bytes with unwritten space, which the
+// data appended next takes. A file of size bytes or more is not changed.
+func (mw *MetaWrapper) Allocate(inode, size uint64) error {
+	return sdk.Errno(mw.AllocateContext(context.Background(), inode, size))
+}
+
+func (mw *MetaWrapper) AllocateContext(ctx context.Context, inode, size uint64) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("Allocate: No such partition, ino(%v)", inode)
+		return newError("Allocate", syscall.EINVAL)
+	}
+
+	status, err := mw.allocate(ctx, mp, inode, size)
+	if err != nil || status != statusOK {
+		log.LogErrorf("Allocate: ino(%v) size(%v) err(%v) status(%v)", inode, size, err, status)
+		return statusToError("Allocate", status, err)
+	}
+
+	return nil
+}
+
+// WormCommit commits a file of a WORM volume, so that it can not be modified
+// any more and is kept until the retention of the volume expires.
+func (mw *MetaWrapper) WormCommit(inode uint64) error {
+	return sdk.Errno(mw.WormCommitContext(context.Background(), inode))
+}
+
+func (mw *MetaWrapper) WormCommitContext(ctx context.Context, inode uint64) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("WormCommit: No such partition, ino(%v)", inode)
+		return newError("WormCommit", syscall.EINVAL)
+	}
+
+	status, err := mw.wormCommit(ctx, mp, inode)
+	if err != nil || status != statusOK {
+		log.LogErrorf("WormCommit: ino(%v) err(%v) status(%v)", inode, err, status)
+		return statusToError("WormCommit", status, err)
 	}
 
 	return nil
@@ -0,0 +1,193 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// Small mutations of a partition are coalesced into batches. A request is
+// sent at once if no request of the partition is in flight, otherwise it
+// waits for the one in flight, and all the requests waiting by then are
+// sent in one OpMetaBatch request. So a batch costs no latency, and grows
+// with the number of concurrent requests.
+
+const (
+	// BatchMaxItems limits the requests sent in one batch.
+	BatchMaxItems = 128
+)
+
+type batchCall struct {
+	ctx  context.Context
+	mp   *MetaPartition
+	req  *proto.Packet
+	resp *proto.Packet
+	err  error
+	done chan struct{}
+}
+
+type metaBatcher struct {
+	sync.Mutex
+	sending bool
+	pending []*batchCall
+}
+
+func isBatchable(op uint8) bool {
+	switch op {
+	case proto.OpMetaCreateInode, proto.OpMetaDeleteInode, proto.OpMetaCreateDentry,
+		proto.OpMetaDeleteDentry, proto.OpMetaSetattr:
+		return true
+	default:
+		return false
+	}
+}
+
+func (mw *MetaWrapper) getBatcher(partitionID uint64) *metaBatcher {
+	mw.Lock()
+	defer mw.Unlock()
+	b, ok := mw.batchers[partitionID]
+	if !ok {
+		b = &metaBatcher{}
+		mw.batchers[partitionID] = b
+	}
+	return b
+}
+
+// sendBatched sends req to mp like sendToMetaPartition, but it may be sent
+// in a batch with the other requests of mp.
+func (mw *MetaWrapper) sendBatched(ctx context.Context, mp *MetaPartition, req *proto.Packet) (*proto.Packet, error) {
+	if !isBatchable(req.Opcode) {
+		return mw.sendToMetaPartition(ctx, mp, req)
+	}
+	call := &batchCall{ctx: ctx, mp: mp, req: req, done: make(chan struct{})}
+	b := mw.getBatcher(mp.PartitionID)
+	b.Lock()
+	b.pending = append(b.pending, call)
+	if !b.sending {
+		b.sending = true
+		go mw.flushBatches(b)
+	}
+	b.Unlock()
+
+	select {
+	case <-call.done:
+		return call.resp, call.err
+	case <-ctx.Done():
+		return nil, sdk.ContextError(req.GetOpMsg(), ctx)
+	}
+}
+
+// flushBatches sends the pending requests until none is left.
+func (mw *MetaWrapper) flushBatches(b *metaBatcher) {
+	for {
+		b.Lock()
+		calls := b.pending
+		if len(calls) > BatchMaxItems {
+			calls = calls[:BatchMaxItems]
+		}
+		b.pending = b.pending[len(calls):]
+		if len(calls) == 0 {
+			b.sending = false
+			b.pending = nil
+			b.Unlock()
+			return
+		}
+		b.Unlock()
+		mw.sendCalls(calls)
+	}
+}
+
+func (mw *MetaWrapper) sendCalls(calls []*batchCall) {
+	// Requests given up by the caller are not sent any more.
+	live := calls[:0]
+	for _, call := range calls {
+		if call.ctx.Err() != nil {
+			call.err = sdk.ContextError(call.req.GetOpMsg(), call.ctx)
+			close(call.done)
+			continue
+		}
+		live = append(live, call)
+	}
+	switch len(live) {
+	case 0:
+		return
+	case 1:
+		mw.sendCall(live[0])
+		return
+	}
+
+	mp := live[0].mp
+	req := &proto.BatchRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Items:       make([]proto.BatchItem, len(live)),
+	}
+	for i, call := range live {
+		req.Items[i].Op = call.req.Opcode
+		req.Items[i].Data = call.req.Data
+	}
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaBatch
+	err := packet.MarshalData(req)
+	if err == nil {
+		packet, err = mw.sendToMetaPartition(context.Background(), mp, packet)
+	}
+	resp := new(proto.BatchResponse)
+	if err == nil && packet.ResultCode == proto.OpOk {
+		if err = packet.UnmarshalData(resp); err == nil && len(resp.Results) != len(live) {
+			err = fmt.Errorf("%v results of %v items", len(resp.Results), len(live))
+		}
+	}
+	if err == nil && packet.ResultCode != proto.OpOk {
+		err = fmt.Errorf("result %v", packet.GetResultMesg())
+	}
+	if err != nil {
+		// The batch fails as a whole, e.g. the partition is not found, or
+		// the meta node is too old to know batches. Each request is sent by
+		// itself then, with the retries of a single request.
+		log.LogWarnf("sendCalls: mp(%v) items(%v) err(%v), sending one by one", mp, len(live), err)
+		for _, call := range live {
+			mw.sendCall(call)
+		}
+		return
+	}
+
+	for i, call := range live {
+		result := resp.Results[i]
+		if result.ResultCode == proto.OpMovedErr {
+			// Moved by a split, which sendToMetaPartition follows.
+			mw.sendCall(call)
+			continue
+		}
+		call.resp = proto.NewPacket()
+		call.resp.Opcode = call.req.Opcode
+		call.resp.ReqID = call.req.ReqID
+		call.resp.ResultCode = result.ResultCode
+		call.resp.Data = result.Data
+		call.resp.Size = uint32(len(result.Data))
+		close(call.done)
+	}
+}
+
+func (mw *MetaWrapper) sendCall(call *batchCall) {
+	call.resp, call.err = mw.sendToMetaPartition(call.ctx, call.mp, call.req)
+	close(call.done)
+}
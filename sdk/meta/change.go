@@ -0,0 +1,193 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// Each meta partition keeps a feed of the changes applied to it, in the
+// order of its raft log. A ChangeConsumer reads the feeds of all the
+// partitions of the volume, and keeps a cursor for each, the apply index to
+// read from next. The cursors are saved by the caller to resume from.
+
+const (
+	// ChangesWait is how long a meta node is asked to wait for a change.
+	ChangesWait = 2 * time.Second
+)
+
+// ChangesExpiredError tells the changes of a partition from a cursor are
+// not kept by the meta node any more. Start is the first index it keeps.
+type ChangesExpiredError struct {
+	PartitionID uint64
+	From        uint64
+	Start       uint64
+}
+
+func (e *ChangesExpiredError) Error() string {
+	return fmt.Sprintf("changes of partition %v from %v expired, first kept %v",
+		e.PartitionID, e.From, e.Start)
+}
+
+// ChangeConsumer follows the changes of a volume. It is not safe for
+// concurrent use.
+type ChangeConsumer struct {
+	mw      *MetaWrapper
+	cursors map[uint64]uint64
+}
+
+// NewChangeConsumer returns a consumer which resumes from cursors, as
+// returned by Cursors. The partitions without a cursor are read from the
+// first change kept.
+func (mw *MetaWrapper) NewChangeConsumer(cursors map[uint64]uint64) *ChangeConsumer {
+	c := &ChangeConsumer{mw: mw, cursors: make(map[uint64]uint64)}
+	for id, index := range cursors {
+		c.cursors[id] = index
+	}
+	return c
+}
+
+// Cursors returns the cursors of the partitions read so far.
+func (c *ChangeConsumer) Cursors() map[uint64]uint64 {
+	cursors := make(map[uint64]uint64, len(c.cursors))
+	for id, index := range c.cursors {
+		cursors[id] = index
+	}
+	return cursors
+}
+
+// SetCursor moves the cursor of a partition, e.g. to the Start of a
+// ChangesExpiredError once the lost changes are made up for.
+func (c *ChangeConsumer) SetCursor(partitionID, index uint64) {
+	c.cursors[partitionID] = index
+}
+
+type changesResult struct {
+	mp   *MetaPartition
+	from uint64
+	resp *proto.ReadChangesResponse
+	err  error
+}
+
+// Next returns the next changes of the volume, waiting up to ChangesWait if
+// there is none. The changes of a partition are in order, and those of the
+// partitions are merged by their time. The cursor of a partition which
+// fails is left, the changes of the others are returned with the first
+// error, which is a *ChangesExpiredError if the changes are lost.
+func (c *ChangeConsumer) Next(ctx context.Context) (changes []proto.MetaChange, err error) {
+	partitions := c.mw.getPartitions()
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *changesResult, len(partitions))
+	for _, mp := range partitions {
+		go func(r *changesResult) {
+			r.resp, r.err = c.mw.readChanges(readCtx, r.mp, r.from, ChangesWait)
+			if r.err == nil && len(r.resp.Changes) != 0 {
+				// The others need not wait any more.
+				cancel()
+			}
+			results <- r
+		}(&changesResult{mp: mp, from: c.cursors[mp.PartitionID]})
+	}
+	lists := make([][]proto.MetaChange, 0, len(partitions))
+	for range partitions {
+		r := <-results
+		if r.err != nil {
+			if readCtx.Err() != nil && ctx.Err() == nil {
+				// Given up for the changes of another partition.
+				continue
+			}
+			if err == nil {
+				err = r.err
+			}
+			continue
+		}
+		if r.from != 0 && r.from < r.resp.Start {
+			if err == nil {
+				err = &ChangesExpiredError{
+					PartitionID: r.mp.PartitionID,
+					From:        r.from,
+					Start:       r.resp.Start,
+				}
+			}
+			continue
+		}
+		c.cursors[r.mp.PartitionID] = r.resp.Next
+		lists = append(lists, r.resp.Changes)
+	}
+	return mergeChanges(lists), err
+}
+
+// mergeChanges merges the changes of the partitions by their time, keeping
+// the order of each partition.
+func mergeChanges(lists [][]proto.MetaChange) (changes []proto.MetaChange) {
+	for {
+		k := -1
+		for i, list := range lists {
+			if len(list) != 0 && (k < 0 || list[0].Time < lists[k][0].Time) {
+				k = i
+			}
+		}
+		if k < 0 {
+			return
+		}
+		changes = append(changes, lists[k][0])
+		lists[k] = lists[k][1:]
+	}
+}
+
+func (mw *MetaWrapper) readChanges(ctx context.Context, mp *MetaPartition, from uint64, wait time.Duration) (resp *proto.ReadChangesResponse, err error) {
+	req := &proto.ReadChangesRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		From:        from,
+		Wait:        int64(wait / time.Millisecond),
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaReadChanges
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("readChanges: err(%v)", err)
+		return
+	}
+
+	// Any member keeps the changes, they are not moved by a split.
+	packet, err = mw.sendToPartition(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("readChanges: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status := parseStatus(packet.ResultCode)
+	if status != statusOK {
+		err = statusToError("ReadChanges", status, nil)
+		log.LogErrorf("readChanges: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	resp = new(proto.ReadChangesResponse)
+	err = packet.UnmarshalData(resp)
+	if err != nil {
+		log.LogErrorf("readChanges: mp(%v) req(%v) err(%v) PacketData(%v)", mp, *req, err, string(packet.Data))
+		return
+	}
+	return
+}
@@ -15,13 +15,18 @@
 package meta
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"syscall"
 	"time"
 
 	"github.com/juju/errors"
 
 	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk"
 	"github.com/tiglabs/containerfs/util/log"
 )
 
@@ -62,7 +67,58 @@ func (mw *MetaWrapper) putConn(mc *MetaConn, err error) {
 	}
 }
 
-func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet) (*proto.Packet, error) {
+// sendToMetaPartition sends req to mp. If the inode of the request is moved
+// to another partition by a split, the partitions are refreshed and req is
+// sent to the partition which serves the inode now.
+func (mw *MetaWrapper) sendToMetaPartition(ctx context.Context, mp *MetaPartition, req *proto.Packet) (*proto.Packet, error) {
+	start := time.Now()
+	for {
+		resp, err := mw.sendToPartition(ctx, mp, req)
+		if err != nil || resp.ResultCode != proto.OpMovedErr || time.Since(start) > SendTimeLimit {
+			return resp, err
+		}
+		moved := &proto.MovedResponse{}
+		if err = json.Unmarshal(resp.Data, moved); err != nil {
+			return resp, nil
+		}
+		log.LogWarnf("sendToMetaPartition: mp(%v) op(%v) inode(%v) moved", mp, req.GetOpMsg(), moved.Inode)
+		mw.UpdateMetaPartitions()
+		if next := mw.getPartitionByInode(moved.Inode); next != nil && next.PartitionID != mp.PartitionID {
+			if err = setPartitionID(req, next.PartitionID); err != nil {
+				return resp, nil
+			}
+			mp = next
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, sdk.ContextError(req.GetOpMsg(), ctx)
+		case <-time.After(SendRetryInterval):
+		}
+	}
+}
+
+// setPartitionID points the request in the body of p to another partition.
+func setPartitionID(p *proto.Packet, partitionID uint64) error {
+	body := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(p.Data))
+	d.UseNumber()
+	if err := d.Decode(&body); err != nil {
+		return err
+	}
+	body["pid"] = partitionID
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	p.Data = data
+	p.Size = uint32(len(data))
+	return nil
+}
+
+// sendToPartition sends req to the leader of mp, and retries the other
+// members until SendTimeLimit is exceeded or ctx is done.
+func (mw *MetaWrapper) sendToPartition(ctx context.Context, mp *MetaPartition, req *proto.Packet) (*proto.Packet, error) {
 	var (
 		resp  *proto.Packet
 		err   error
@@ -73,6 +129,9 @@ func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet)
 	)
 
 	op = req.GetOpMsg()
+	if err = sdk.ContextError(op, ctx); err != nil {
+		return nil, err
+	}
 	addr = mp.LeaderAddr
 	if addr == "" {
 		goto retry
@@ -81,12 +140,15 @@ func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet)
 	if err != nil {
 		goto retry
 	}
-	resp, err = mc.send(req)
+	resp, err = mc.send(ctx, req)
 	mw.putConn(mc, err)
 	if err == nil && !resp.ShallRetry() {
 		goto out
 	}
-	log.LogWarnf("sendToMetaPartition: leader failed mp(%v) mc(%v) err(%v) op(%v) result(%v)", mp, mc, err, op, resp.GetResultMesg())
+	if ctx.Err() != nil {
+		goto out
+	}
+	log.LogWarnf("sendToPartition: leader failed mp(%v) mc(%v) err(%v) op(%v) result(%v)", mp, mc, err, op, resp.GetResultMesg())
 
 retry:
 	start = time.Now()
@@ -96,36 +158,59 @@ retry:
 			if err != nil {
 				continue
 			}
-			resp, err = mc.send(req)
+			resp, err = mc.send(ctx, req)
 			mw.putConn(mc, err)
 			if err == nil && !resp.ShallRetry() {
 				goto out
 			}
-			log.LogWarnf("sendToMetaPartition: retry failed mp(%v) mc(%v) err(%v) op(%v) result(%v)", mp, mc, err, op, resp.GetResultMesg())
+			if ctx.Err() != nil {
+				goto out
+			}
+			log.LogWarnf("sendToPartition: retry failed mp(%v) mc(%v) err(%v) op(%v) result(%v)", mp, mc, err, op, resp.GetResultMesg())
 		}
 		if time.Since(start) > SendTimeLimit {
-			log.LogWarnf("sendToMetaPartition: retry timeout mp(%v) op(%v) time(%v)", mp, op, time.Since(start))
+			log.LogWarnf("sendToPartition: retry timeout mp(%v) op(%v) time(%v)", mp, op, time.Since(start))
 			break
 		}
-		log.LogWarnf("sendToMetaPartition: mp(%v) op(%v) retry in (%v)", mp, op, SendRetryInterval)
-		time.Sleep(SendRetryInterval)
+		log.LogWarnf("sendToPartition: mp(%v) op(%v) retry in (%v)", mp, op, SendRetryInterval)
+		select {
+		case <-ctx.Done():
+			goto out
+		case <-time.After(SendRetryInterval):
+		}
 	}
 
 out:
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("sendToMetaPartition faild: mp(%v) op(%v)", mp, req.GetOpMsg()))
+	if cerr := sdk.ContextError(op, ctx); cerr != nil && (err != nil || resp == nil || resp.ShallRetry()) {
+		log.LogWarnf("sendToPartition: mp(%v) op(%v) err(%v)", mp, op, cerr)
+		return nil, cerr
 	}
-	log.LogDebugf("sendToMetaPartition successful: mc(%v) op(%v) result(%v)", mc, req.GetOpMsg(), resp.GetResultMesg())
+	if err != nil || resp == nil {
+		err = errors.New(fmt.Sprintf("sendToPartition faild: mp(%v) op(%v)", mp, req.GetOpMsg()))
+		return nil, sdk.NewError(op, sdk.ErrPartitionUnavailable, syscall.EAGAIN, err)
+	}
+	log.LogDebugf("sendToPartition successful: mc(%v) op(%v) result(%v)", mc, req.GetOpMsg(), resp.GetResultMesg())
 	return resp, nil
 }
 
-func (mc *MetaConn) send(req *proto.Packet) (resp *proto.Packet, err error) {
+func (mc *MetaConn) send(ctx context.Context, req *proto.Packet) (resp *proto.Packet, err error) {
+	timeout := proto.ReadDeadlineTime
+	if ctx.Done() != nil {
+		// the deadline of the conn is managed by WatchConn
+		timeout = proto.NoReadDeadlineTime
+	}
+	stop := sdk.WatchConn(ctx, mc.conn, proto.ReadDeadlineTime*time.Second)
+	defer func() {
+		if stop() && err == nil {
+			err = sdk.ContextError(req.GetOpMsg(), ctx)
+		}
+	}()
 	err = req.WriteToConn(mc.conn)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Failed to write to conn")
 	}
 	resp = proto.NewPacket()
-	err = resp.ReadFromConn(mc.conn, proto.ReadDeadlineTime)
+	err = resp.ReadFromConn(mc.conn, timeout)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Failed to read from conn")
 	}
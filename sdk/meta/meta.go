@@ -24,15 +24,14 @@ import (
 	"github.com/tiglabs/containerfs/util/btree"
 
 	"github.com/tiglabs/containerfs/proto"
-	"github.com/tiglabs/containerfs/util"
+	"github.com/tiglabs/containerfs/sdk"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/util/pool"
 )
 
 const (
 	HostsSeparator       = ","
 	MetaPartitionViewURL = "/client/vol"
-	GetVolStatURL        = "/client/volStat"
-	GetClusterInfoURL    = "/admin/getIp"
 
 	RefreshMetaPartitionsInterval = time.Minute * 5
 )
@@ -46,13 +45,15 @@ const (
 	statusAgain
 	statusError
 	statusInval
+	statusNotPerm
+	statusSharded
 )
 
 type MetaWrapper struct {
 	sync.RWMutex
 	cluster string
 	volname string
-	master  util.MasterHelper
+	mc      *master.MasterClient
 	conns   *pool.ConnectPool
 
 	// Partitions and ranges should be modified together. So do not
@@ -67,19 +68,31 @@ type MetaWrapper struct {
 
 	totalSize uint64
 	usedSize  uint64
+
+	// WORM policy of the volume
+	worm proto.WormPolicy
+	// Files up to inlineSize bytes are kept inline in their inodes
+	inlineSize uint32
+
+	// Shard directories of the sharded directories indexed by inode
+	shards map[uint64][]uint64
+	// Moves of the dentries kept since before sharding indexed by inode
+	migrations map[uint64]*shardMigration
+
+	// Batchers of the partitions indexed by ID
+	batchers map[uint64]*metaBatcher
 }
 
 func NewMetaWrapper(volname, masterHosts string) (*MetaWrapper, error) {
 	mw := new(MetaWrapper)
 	mw.volname = volname
-	master := strings.Split(masterHosts, HostsSeparator)
-	mw.master = util.NewMasterHelper()
-	for _, ip := range master {
-		mw.master.AddNode(ip)
-	}
+	mw.mc = master.NewMasterClient(strings.Split(masterHosts, HostsSeparator))
 	mw.conns = pool.NewConnPool()
 	mw.partitions = make(map[uint64]*MetaPartition)
 	mw.ranges = btree.New(32)
+	mw.shards = make(map[uint64][]uint64)
+	mw.migrations = make(map[uint64]*shardMigration)
+	mw.batchers = make(map[uint64]*metaBatcher)
 	mw.UpdateClusterInfo()
 	mw.UpdateVolStatInfo()
 	if err := mw.UpdateMetaPartitions(); err != nil {
@@ -93,6 +106,21 @@ func (mw *MetaWrapper) Cluster() string {
 	return mw.cluster
 }
 
+// Worm returns the WORM policy of the volume.
+func (mw *MetaWrapper) Worm() proto.WormPolicy {
+	mw.RLock()
+	defer mw.RUnlock()
+	return mw.worm
+}
+
+// InlineSize returns the size up to which the files of the volume are kept
+// inline in their inodes, 0 if they are not.
+func (mw *MetaWrapper) InlineSize() uint32 {
+	mw.RLock()
+	defer mw.RUnlock()
+	return mw.inlineSize
+}
+
 func (mw *MetaWrapper) umpKey(act string) string {
 	return fmt.Sprintf("%s_sdk_meta_%s", mw.cluster, act)
 }
@@ -108,10 +136,14 @@ func parseStatus(result uint8) (status int) {
 		status = statusNoent
 	case proto.OpInodeFullErr:
 		status = statusFull
-	case proto.OpAgain:
+	case proto.OpAgain, proto.OpMovedErr:
 		status = statusAgain
 	case proto.OpArgMismatchErr:
 		status = statusInval
+	case proto.OpNotPermErr:
+		status = statusNotPerm
+	case proto.OpShardedErr:
+		status = statusSharded
 	default:
 		status = statusError
 	}
@@ -135,7 +167,24 @@ func statusToErrno(status int) error {
 		return syscall.EINVAL
 	case statusError:
 		return syscall.EPERM
+	case statusNotPerm:
+		return syscall.EPERM
+	case statusSharded:
+		return syscall.EAGAIN
 	default:
 	}
 	return syscall.EIO
 }
+
+func newError(op string, errno syscall.Errno) error {
+	return sdk.NewErrnoError(op, errno, nil)
+}
+
+// statusToError converts the result of an operation to an sdk.Error, the
+// errno of which is the same as statusToErrno returns.
+func statusToError(op string, status int, err error) error {
+	if e, ok := err.(*sdk.Error); ok {
+		return e
+	}
+	return sdk.NewErrnoError(op, statusToErrno(status).(syscall.Errno), err)
+}
@@ -15,6 +15,7 @@
 package meta
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -28,7 +29,7 @@ import (
 // API implementations
 //
 
-func (mw *MetaWrapper) open(mp *MetaPartition, inode uint64) (status int, err error) {
+func (mw *MetaWrapper) open(ctx context.Context, mp *MetaPartition, inode uint64) (status int, err error) {
 	req := &proto.OpenRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -47,7 +48,7 @@ func (mw *MetaWrapper) open(mp *MetaPartition, inode uint64) (status int, err er
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("open: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -60,12 +61,13 @@ func (mw *MetaWrapper) open(mp *MetaPartition, inode uint64) (status int, err er
 	return
 }
 
-func (mw *MetaWrapper) icreate(mp *MetaPartition, mode uint32, target []byte) (status int, info *proto.InodeInfo, err error) {
+func (mw *MetaWrapper) icreate(ctx context.Context, mp *MetaPartition, mode uint32, target []byte, parentID uint64) (status int, info *proto.InodeInfo, err error) {
 	req := &proto.CreateInodeRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Mode:        mode,
 		Target:      target,
+		ParentID:    parentID,
 	}
 
 	packet := proto.NewPacket()
@@ -82,7 +84,7 @@ func (mw *MetaWrapper) icreate(mp *MetaPartition, mode uint32, target []byte) (s
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendBatched(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("icreate: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -109,7 +111,7 @@ func (mw *MetaWrapper) icreate(mp *MetaPartition, mode uint32, target []byte) (s
 	return statusOK, resp.Info, nil
 }
 
-func (mw *MetaWrapper) idelete(mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
+func (mw *MetaWrapper) idelete(ctx context.Context, mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
 	req := &proto.DeleteInodeRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -130,7 +132,7 @@ func (mw *MetaWrapper) idelete(mp *MetaPartition, inode uint64) (status int, inf
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendBatched(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("idelete: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -153,7 +155,7 @@ func (mw *MetaWrapper) idelete(mp *MetaPartition, inode uint64) (status int, inf
 	return statusOK, resp.Info, nil
 }
 
-func (mw *MetaWrapper) ievict(mp *MetaPartition, inode uint64) (status int, err error) {
+func (mw *MetaWrapper) ievict(ctx context.Context, mp *MetaPartition, inode uint64) (status int, err error) {
 	req := &proto.EvictInodeRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -174,7 +176,7 @@ func (mw *MetaWrapper) ievict(mp *MetaPartition, inode uint64) (status int, err
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogWarnf("ievict: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -190,7 +192,7 @@ func (mw *MetaWrapper) ievict(mp *MetaPartition, inode uint64) (status int, err
 	return statusOK, nil
 }
 
-func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string, inode uint64, mode uint32) (status int, err error) {
+func (mw *MetaWrapper) dcreate(ctx context.Context, mp *MetaPartition, parentID uint64, name string, inode uint64, mode uint32) (status int, entries uint64, err error) {
 	req := &proto.CreateDentryRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -214,21 +216,35 @@ func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string,
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendBatched(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("dcreate: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
 	}
 
 	status = parseStatus(packet.ResultCode)
+	if status == statusSharded {
+		mw.updateShards(parentID, packet)
+		return
+	}
 	if status != statusOK {
 		log.LogErrorf("dcreate: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
 	}
-	log.LogDebugf("dcreate exit: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
-	return
+
+	// Older meta nodes reply no body.
+	resp := new(proto.CreateDentryResponse)
+	if len(packet.Data) != 0 {
+		if err = packet.UnmarshalData(resp); err != nil {
+			log.LogErrorf("dcreate: mp(%v) err(%v) PacketData(%v)", mp, err, string(packet.Data))
+			return
+		}
+	}
+	log.LogDebugf("dcreate exit: mp(%v) req(%v) entries(%v)", mp, *req, resp.Entries)
+	return statusOK, resp.Entries, nil
 }
 
-func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string, newInode uint64) (status int, oldInode uint64, err error) {
+func (mw *MetaWrapper) dupdate(ctx context.Context, mp *MetaPartition, parentID uint64, name string, newInode uint64) (status int, oldInode uint64, err error) {
 	req := &proto.UpdateDentryRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -251,13 +267,17 @@ func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string,
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("dupdate: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
 	}
 
 	status = parseStatus(packet.ResultCode)
+	if status == statusSharded {
+		mw.updateShards(parentID, packet)
+		return
+	}
 	if status != statusOK {
 		log.LogErrorf("dupdate: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
 		return
@@ -273,7 +293,7 @@ func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string,
 	return statusOK, resp.Inode, nil
 }
 
-func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string) (status int, inode uint64, err error) {
+func (mw *MetaWrapper) ddelete(ctx context.Context, mp *MetaPartition, parentID uint64, name string) (status int, inode uint64, err error) {
 	req := &proto.DeleteDentryRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -295,13 +315,17 @@ func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string)
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendBatched(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("ddelete: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
 	}
 
 	status = parseStatus(packet.ResultCode)
+	if status == statusSharded {
+		mw.updateShards(parentID, packet)
+		return
+	}
 	if status != statusOK {
 		log.LogErrorf("ddelete: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
 		return
@@ -317,7 +341,7 @@ func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string)
 	return statusOK, resp.Inode, nil
 }
 
-func (mw *MetaWrapper) lookup(mp *MetaPartition, parentID uint64, name string) (status int, inode uint64, mode uint32, err error) {
+func (mw *MetaWrapper) lookup(ctx context.Context, mp *MetaPartition, parentID uint64, name string) (status int, inode uint64, mode uint32, err error) {
 	req := &proto.LookupRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -338,13 +362,17 @@ func (mw *MetaWrapper) lookup(mp *MetaPartition, parentID uint64, name string) (
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("lookup: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
 	}
 
 	status = parseStatus(packet.ResultCode)
+	if status == statusSharded {
+		mw.updateShards(parentID, packet)
+		return
+	}
 	if status != statusOK {
 		if status != statusNoent {
 			log.LogErrorf("lookup: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
@@ -364,7 +392,7 @@ func (mw *MetaWrapper) lookup(mp *MetaPartition, parentID uint64, name string) (
 	return statusOK, resp.Inode, resp.Mode, nil
 }
 
-func (mw *MetaWrapper) iget(mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
+func (mw *MetaWrapper) iget(ctx context.Context, mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
 	req := &proto.InodeGetRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -383,7 +411,7 @@ func (mw *MetaWrapper) iget(mp *MetaPartition, inode uint64) (status int, info *
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("iget: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -404,7 +432,7 @@ func (mw *MetaWrapper) iget(mp *MetaPartition, inode uint64) (status int, info *
 	return statusOK, resp.Info, nil
 }
 
-func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes []uint64, respCh chan []*proto.InodeInfo) {
+func (mw *MetaWrapper) batchIget(ctx context.Context, wg *sync.WaitGroup, mp *MetaPartition, inodes []uint64, respCh chan []*proto.InodeInfo) {
 	defer wg.Done()
 	var (
 		err error
@@ -426,7 +454,7 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("batchIget: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -455,7 +483,7 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 	}
 }
 
-func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int, children []proto.Dentry, err error) {
+func (mw *MetaWrapper) readdir(ctx context.Context, mp *MetaPartition, parentID uint64) (status int, children []proto.Dentry, err error) {
 	req := &proto.ReadDirRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -474,7 +502,7 @@ func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int,
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("readdir: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -493,11 +521,14 @@ func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int,
 		log.LogErrorf("readdir: mp(%v) err(%v) PacketData(%v)", mp, err, string(packet.Data))
 		return
 	}
+	if len(resp.Shards) != 0 {
+		mw.putShards(parentID, resp.Shards)
+	}
 	log.LogDebugf("readdir: mp(%v) req(%v) dentries(%v)", mp, *req, resp.Children)
 	return statusOK, resp.Children, nil
 }
 
-func (mw *MetaWrapper) appendExtentKey(mp *MetaPartition, inode uint64, extent proto.ExtentKey) (status int, err error) {
+func (mw *MetaWrapper) appendExtentKey(ctx context.Context, mp *MetaPartition, inode uint64, extent proto.ExtentKey) (status int, err error) {
 	req := &proto.AppendExtentKeyRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -517,7 +548,7 @@ func (mw *MetaWrapper) appendExtentKey(mp *MetaPartition, inode uint64, extent p
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("appendExtentKey: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -530,7 +561,7 @@ func (mw *MetaWrapper) appendExtentKey(mp *MetaPartition, inode uint64, extent p
 	return status, nil
 }
 
-func (mw *MetaWrapper) getExtents(mp *MetaPartition, inode uint64) (status int, extents []proto.ExtentKey, err error) {
+func (mw *MetaWrapper) getExtents(ctx context.Context, mp *MetaPartition, inode uint64) (status int, extents []proto.ExtentKey, err error) {
 	req := &proto.GetExtentsRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -549,7 +580,7 @@ func (mw *MetaWrapper) getExtents(mp *MetaPartition, inode uint64) (status int,
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("getExtents: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -571,7 +602,7 @@ func (mw *MetaWrapper) getExtents(mp *MetaPartition, inode uint64) (status int,
 	return statusOK, resp.Extents, nil
 }
 
-func (mw *MetaWrapper) truncate(mp *MetaPartition, inode uint64) (status int, err error) {
+func (mw *MetaWrapper) truncate(ctx context.Context, mp *MetaPartition, inode uint64) (status int, err error) {
 	req := &proto.TruncateRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -594,7 +625,7 @@ func (mw *MetaWrapper) truncate(mp *MetaPartition, inode uint64) (status int, er
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("truncate: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -610,7 +641,168 @@ func (mw *MetaWrapper) truncate(mp *MetaPartition, inode uint64) (status int, er
 	return statusOK, nil
 }
 
-func (mw *MetaWrapper) ilink(mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
+func (mw *MetaWrapper) punchHole(ctx context.Context, mp *MetaPartition, inode, offset, size uint64) (status int, err error) {
+	req := &proto.PunchHoleRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Offset:      offset,
+		Size:        size,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaPunchHole
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("punchHole: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("punchHole enter: mp(%v) req(%v)", mp, string(packet.Data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("punchHole: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("punchHole: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	log.LogDebugf("punchHole exit: mp(%v) req(%v)", mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) cloneExtents(ctx context.Context, mp *MetaPartition, src, srcOffset, dst, dstOffset, size uint64) (status int, cloned uint64, err error) {
+	req := &proto.CloneExtentsRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		SrcInode:    src,
+		DstInode:    dst,
+		SrcOffset:   srcOffset,
+		DstOffset:   dstOffset,
+		Size:        size,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaExtentsClone
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("cloneExtents: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("cloneExtents enter: mp(%v) req(%v)", mp, string(packet.Data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("cloneExtents: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("cloneExtents: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	resp := new(proto.CloneExtentsResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("cloneExtents: mp(%v) req(%v) err(%v) PacketData(%v)", mp, *req, err, string(packet.Data))
+		return
+	}
+	log.LogDebugf("cloneExtents exit: mp(%v) req(%v) cloned(%v)", mp, *req, resp.Size)
+	return statusOK, resp.Size, nil
+}
+
+func (mw *MetaWrapper) wormCommit(ctx context.Context, mp *MetaPartition, inode uint64) (status int, err error) {
+	req := &proto.WormCommitRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaWormCommit
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("wormCommit: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("wormCommit enter: mp(%v) req(%v)", mp, string(packet.Data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("wormCommit: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("wormCommit: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	log.LogDebugf("wormCommit exit: mp(%v) req(%v)", mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) inlineWrite(ctx context.Context, mp *MetaPartition, inode, offset uint64, data []byte) (status int, err error) {
+	req := &proto.InlineWriteRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Offset:      offset,
+		Data:        data,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaInlineWrite
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("inlineWrite: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("inlineWrite enter: mp(%v) ino(%v) offset(%v) size(%v)", mp, inode, offset, len(data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("inlineWrite: mp(%v) ino(%v) offset(%v) err(%v)", mp, inode, offset, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("inlineWrite: mp(%v) ino(%v) offset(%v) result(%v)", mp, inode, offset, packet.GetResultMesg())
+		return
+	}
+
+	log.LogDebugf("inlineWrite exit: mp(%v) ino(%v) offset(%v)", mp, inode, offset)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) ilink(ctx context.Context, mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
 	req := &proto.LinkInodeRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -631,7 +823,7 @@ func (mw *MetaWrapper) ilink(mp *MetaPartition, inode uint64) (status int, info
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("ilink: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -658,7 +850,7 @@ func (mw *MetaWrapper) ilink(mp *MetaPartition, inode uint64) (status int, info
 	return statusOK, resp.Info, nil
 }
 
-func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid, gid uint32) (status int, err error) {
+func (mw *MetaWrapper) setattr(ctx context.Context, mp *MetaPartition, inode uint64, valid, mode, uid, gid, flags uint32) (status int, err error) {
 	req := &proto.SetattrRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -667,6 +859,7 @@ func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid
 		Mode:        mode,
 		Uid:         uid,
 		Gid:         gid,
+		Flags:       flags,
 	}
 
 	packet := proto.NewPacket()
@@ -683,7 +876,7 @@ func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid
 	tpObject := ump.BeforeTP(umpKey)
 	defer ump.AfterTP(tpObject, err)
 
-	packet, err = mw.sendToMetaPartition(mp, packet)
+	packet, err = mw.sendBatched(ctx, mp, packet)
 	if err != nil {
 		log.LogErrorf("setattr: mp(%v) req(%v) err(%v)", mp, *req, err)
 		return
@@ -698,3 +891,125 @@ func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid
 	log.LogDebugf("setattr exit: mp(%v) req(%v)", mp, *req)
 	return statusOK, nil
 }
+
+// allocate extends file inode to size bytes with unwritten space.
+func (mw *MetaWrapper) allocate(ctx context.Context, mp *MetaPartition, inode, size uint64) (status int, err error) {
+	req := &proto.SetattrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Valid:       proto.AttrSize,
+		Size:        size,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaSetattr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("allocate: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("allocate enter: mp(%v) req(%v)", mp, string(packet.Data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendBatched(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("allocate: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("allocate: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	log.LogDebugf("allocate exit: mp(%v) req(%v)", mp, *req)
+	return statusOK, nil
+}
+
+// setShards makes directory inode sharded, the new dentries of which are
+// kept in the shard directories.
+func (mw *MetaWrapper) setShards(ctx context.Context, mp *MetaPartition, inode uint64, shards []uint64) (status int, err error) {
+	req := &proto.SetattrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Valid:       proto.AttrShards,
+		Shards:      shards,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaSetattr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("setShards: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("setShards enter: mp(%v) req(%v)", mp, string(packet.Data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendToMetaPartition(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("setShards: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("setShards: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	log.LogDebugf("setShards exit: mp(%v) req(%v)", mp, *req)
+	return statusOK, nil
+}
+
+// setParent moves the usage of inode to directory parentID once it is
+// renamed there.
+func (mw *MetaWrapper) setParent(ctx context.Context, mp *MetaPartition, inode uint64, parentID uint64) (status int, err error) {
+	req := &proto.SetattrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Valid:       proto.AttrParent,
+		Parent:      parentID,
+	}
+
+	packet := proto.NewPacket()
+	packet.Opcode = proto.OpMetaSetattr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("setParent: err(%v)", err)
+		return
+	}
+
+	log.LogDebugf("setParent enter: mp(%v) req(%v)", mp, string(packet.Data))
+
+	umpKey := mw.umpKey(packet.GetOpMsg())
+	tpObject := ump.BeforeTP(umpKey)
+	defer ump.AfterTP(tpObject, err)
+
+	packet, err = mw.sendBatched(ctx, mp, packet)
+	if err != nil {
+		log.LogErrorf("setParent: mp(%v) req(%v) err(%v)", mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("setParent: mp(%v) req(%v) result(%v)", mp, *req, packet.GetResultMesg())
+		return
+	}
+
+	log.LogDebugf("setParent exit: mp(%v) req(%v)", mp, *req)
+	return statusOK, nil
+}
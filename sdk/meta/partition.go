@@ -106,6 +106,16 @@ func (mw *MetaWrapper) getRWPartitions() []*MetaPartition {
 	return rwPartitions
 }
 
+func (mw *MetaWrapper) getPartitions() []*MetaPartition {
+	partitions := make([]*MetaPartition, 0)
+	mw.RLock()
+	defer mw.RUnlock()
+	for _, mp := range mw.partitions {
+		partitions = append(partitions, mp)
+	}
+	return partitions
+}
+
 // Get the partition whose Start is Larger than ino.
 // Return nil if no successive partition.
 func (mw *MetaWrapper) getNextPartition(ino uint64) *MetaPartition {
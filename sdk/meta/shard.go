@@ -0,0 +1,392 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/util/log"
+)
+
+// A large directory is sharded, so that its dentries are spread across meta
+// partitions. The directory gets DirShardCount hidden shard directories in
+// different partitions, and a new dentry is kept in the shard chosen by the
+// hash of its name. The dentries created before sharding are moved to their
+// shards in the background, until then a name is looked up in the directory
+// itself if it is not in its shard. Meta nodes refuse to create dentries in
+// a sharded directory, so once it is drained it stays empty.
+
+const (
+	// DirShardThreshold is the number of entries, past which a directory
+	// is sharded.
+	DirShardThreshold = 1 << 20
+	// DirShardCount is the number of shards of a sharded directory.
+	DirShardCount = 16
+	// ShardMigrationRetry is the interval, after which a failed move of
+	// the dentries of a sharded directory is tried again.
+	ShardMigrationRetry = time.Minute
+)
+
+// shardMigration is the state of the move of the dentries of a sharded
+// directory to its shards.
+type shardMigration struct {
+	running bool
+	drained bool
+	retry   time.Time
+}
+
+func (mw *MetaWrapper) getShards(parentID uint64) []uint64 {
+	mw.RLock()
+	defer mw.RUnlock()
+	return mw.shards[parentID]
+}
+
+// putShards caches the shards of a directory, which never change once the
+// directory is sharded.
+func (mw *MetaWrapper) putShards(parentID uint64, shards []uint64) {
+	mw.Lock()
+	defer mw.Unlock()
+	mw.shards[parentID] = shards
+}
+
+func (mw *MetaWrapper) deleteShards(parentID uint64) {
+	mw.Lock()
+	defer mw.Unlock()
+	delete(mw.shards, parentID)
+}
+
+// updateShards caches the shards replied by OpShardedErr.
+func (mw *MetaWrapper) updateShards(parentID uint64, packet *proto.Packet) {
+	resp := new(proto.ShardedResponse)
+	if err := packet.UnmarshalData(resp); err != nil || len(resp.Shards) == 0 {
+		log.LogErrorf("updateShards: parentID(%v) err(%v) PacketData(%v)", parentID, err, string(packet.Data))
+		return
+	}
+	log.LogInfof("updateShards: parentID(%v) shards(%v)", parentID, resp.Shards)
+	mw.putShards(parentID, resp.Shards)
+}
+
+// shardOf returns the directory which keeps the new dentry name of
+// directory parentID.
+func (mw *MetaWrapper) shardOf(parentID uint64, name string) uint64 {
+	shards := mw.getShards(parentID)
+	if len(shards) == 0 {
+		return parentID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return shards[h.Sum32()%uint32(len(shards))]
+}
+
+// onDentry runs op on the directory which keeps dentry name of directory
+// parentID, that is the shard of the name, or the directory itself if the
+// dentry is not found in the shard.
+func (mw *MetaWrapper) onDentry(parentID uint64, name string, op func(mp *MetaPartition, dir uint64) (int, error)) (status int, err error) {
+	run := func(dir uint64) (int, error) {
+		mp := mw.getPartitionByInode(dir)
+		if mp == nil {
+			log.LogErrorf("onDentry: No parent partition, dir(%v) name(%v)", dir, name)
+			return statusNoent, nil
+		}
+		return op(mp, dir)
+	}
+
+	dir := mw.shardOf(parentID, name)
+	status, err = run(dir)
+	if err == nil && status == statusSharded && dir == parentID {
+		// Sharded by another client, the shards are cached by op now.
+		if dir = mw.shardOf(parentID, name); dir != parentID {
+			status, err = run(dir)
+		}
+	}
+	if err == nil && status == statusNoent && dir != parentID && !mw.shardsDrained(parentID) {
+		status, err = run(parentID)
+		if err == nil && status == statusSharded {
+			status = statusNoent
+		}
+	}
+	return
+}
+
+func (mw *MetaWrapper) dentryLookup(ctx context.Context, parentID uint64, name string) (status int, inode uint64, mode uint32, err error) {
+	status, err = mw.onDentry(parentID, name, func(mp *MetaPartition, dir uint64) (status int, err error) {
+		status, inode, mode, err = mw.lookup(ctx, mp, dir, name)
+		return
+	})
+	return
+}
+
+func (mw *MetaWrapper) dentryDelete(ctx context.Context, parentID uint64, name string) (status int, inode uint64, err error) {
+	status, err = mw.onDentry(parentID, name, func(mp *MetaPartition, dir uint64) (status int, err error) {
+		status, inode, err = mw.ddelete(ctx, mp, dir, name)
+		return
+	})
+	return
+}
+
+func (mw *MetaWrapper) dentryUpdate(ctx context.Context, parentID uint64, name string, newInode uint64) (status int, oldInode uint64, err error) {
+	status, err = mw.onDentry(parentID, name, func(mp *MetaPartition, dir uint64) (status int, err error) {
+		status, oldInode, err = mw.dupdate(ctx, mp, dir, name, newInode)
+		return
+	})
+	return
+}
+
+// dentryCreate creates dentry name in the shard of the name, and shards
+// directory parentID once it has DirShardThreshold entries.
+func (mw *MetaWrapper) dentryCreate(ctx context.Context, parentID uint64, name string, inode uint64, mode uint32) (status int, err error) {
+	var entries uint64
+
+	// A stale view of the directory is refreshed by OpShardedErr once.
+	for i := 0; i < 2; i++ {
+		dir := mw.shardOf(parentID, name)
+		mp := mw.getPartitionByInode(parentID)
+		if mp == nil {
+			log.LogErrorf("dentryCreate: No parent partition, parentID(%v) name(%v)", parentID, name)
+			return statusNoent, nil
+		}
+		if dir != parentID && !mw.shardsDrained(parentID) {
+			// The name may be kept since before sharding.
+			status, _, _, err = mw.lookup(ctx, mp, parentID, name)
+			if err != nil {
+				return
+			}
+			if status == statusOK {
+				return statusExist, nil
+			}
+			if status != statusNoent && status != statusSharded {
+				return
+			}
+			if mp = mw.getPartitionByInode(dir); mp == nil {
+				log.LogErrorf("dentryCreate: No shard partition, parentID(%v) shard(%v)", parentID, dir)
+				return statusNoent, nil
+			}
+		}
+		status, entries, err = mw.dcreate(ctx, mp, dir, name, inode, mode)
+		if err != nil || status != statusSharded {
+			break
+		}
+	}
+	if err == nil && status == statusOK && entries >= DirShardThreshold && len(mw.getShards(parentID)) == 0 {
+		mw.shardDir(ctx, parentID)
+	}
+	return
+}
+
+// dentryList lists directory parentID, merging the dentries of its shards.
+// A dentry being moved to its shard is listed once.
+func (mw *MetaWrapper) dentryList(ctx context.Context, parentID uint64) (status int, children []proto.Dentry, err error) {
+	mp := mw.getPartitionByInode(parentID)
+	if mp == nil {
+		return statusNoent, nil, nil
+	}
+	shards := mw.getShards(parentID)
+	drained := len(shards) != 0 && mw.shardsDrained(parentID)
+	if !drained {
+		status, children, err = mw.readdir(ctx, mp, parentID)
+		if err != nil || status != statusOK {
+			return
+		}
+	}
+	var own map[string]int
+	if len(shards) != 0 && len(children) != 0 {
+		own = make(map[string]int, len(children))
+		for i, child := range children {
+			own[child.Name] = i
+		}
+	}
+	status = statusOK
+	for _, shard := range shards {
+		mp = mw.getPartitionByInode(shard)
+		if mp == nil {
+			log.LogErrorf("dentryList: No shard partition, parentID(%v) shard(%v)", parentID, shard)
+			return statusError, nil, nil
+		}
+		var dentries []proto.Dentry
+		status, dentries, err = mw.readdir(ctx, mp, shard)
+		if err != nil || status != statusOK {
+			return
+		}
+		for _, dentry := range dentries {
+			if i, ok := own[dentry.Name]; ok {
+				children[i] = dentry
+				continue
+			}
+			children = append(children, dentry)
+		}
+	}
+	return
+}
+
+// shardsDrained tells if sharded directory parentID keeps no dentries of
+// its own, and starts moving them to their shards otherwise.
+func (mw *MetaWrapper) shardsDrained(parentID uint64) bool {
+	mw.Lock()
+	defer mw.Unlock()
+	m := mw.migrations[parentID]
+	if m == nil {
+		m = new(shardMigration)
+		mw.migrations[parentID] = m
+	}
+	if m.drained || m.running || time.Now().Before(m.retry) {
+		return m.drained
+	}
+	m.running = true
+	go mw.migrateShards(parentID, m)
+	return false
+}
+
+// migrateShards moves the dentries of sharded directory parentID to their
+// shards, until the directory is empty.
+func (mw *MetaWrapper) migrateShards(parentID uint64, m *shardMigration) {
+	ctx := context.Background()
+	drained, err := func() (bool, error) {
+		mp := mw.getPartitionByInode(parentID)
+		if mp == nil {
+			return false, fmt.Errorf("no parent partition")
+		}
+		for {
+			status, children, err := mw.readdir(ctx, mp, parentID)
+			if err != nil {
+				return false, err
+			}
+			if status != statusOK {
+				return false, fmt.Errorf("readdir status(%v)", status)
+			}
+			if len(children) == 0 {
+				return true, nil
+			}
+			for _, dentry := range children {
+				if err = mw.migrateDentry(ctx, mp, parentID, dentry); err != nil {
+					return false, fmt.Errorf("dentry(%v) %v", dentry, err)
+				}
+			}
+		}
+	}()
+	if err != nil {
+		log.LogWarnf("migrateShards: parentID(%v) err(%v)", parentID, err)
+	} else {
+		log.LogInfof("migrateShards: parentID(%v) drained", parentID)
+	}
+
+	mw.Lock()
+	defer mw.Unlock()
+	m.running, m.drained = false, drained
+	if !drained {
+		m.retry = time.Now().Add(ShardMigrationRetry)
+	}
+}
+
+// migrateDentry moves dentry of directory parentID, kept in partition mp,
+// to its shard. The dentry is created in the shard before it is deleted
+// from the directory, so the name is always found.
+func (mw *MetaWrapper) migrateDentry(ctx context.Context, mp *MetaPartition, parentID uint64, dentry proto.Dentry) error {
+	shard := mw.shardOf(parentID, dentry.Name)
+	smp := mw.getPartitionByInode(shard)
+	if smp == nil {
+		return fmt.Errorf("no shard partition, shard(%v)", shard)
+	}
+	status, _, err := mw.dcreate(ctx, smp, shard, dentry.Name, dentry.Inode, dentry.Type)
+	if err != nil {
+		return err
+	}
+	// A dentry found in the shard is newer, or moved by another client.
+	created := status == statusOK
+	if !created && status != statusExist {
+		return fmt.Errorf("dcreate status(%v)", status)
+	}
+
+	status, inode, err := mw.ddelete(ctx, mp, parentID, dentry.Name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !created:
+	case status == statusOK && inode != dentry.Inode:
+		// Updated since listed.
+		if status, _, err = mw.dupdate(ctx, smp, shard, dentry.Name, inode); err == nil && status != statusOK {
+			err = fmt.Errorf("dupdate status(%v)", status)
+		}
+	case status == statusNoent:
+		// Deleted since listed, unless moved by another client, which
+		// leaves the inode linked.
+		imp := mw.getPartitionByInode(dentry.Inode)
+		if imp == nil {
+			return nil
+		}
+		status, info, err := mw.iget(ctx, imp, dentry.Inode)
+		if err == nil && (status == statusNoent || (status == statusOK && info.Nlink == 0)) {
+			_, _, err = mw.ddelete(ctx, smp, shard, dentry.Name)
+		}
+		return err
+	case status != statusOK:
+		err = fmt.Errorf("ddelete status(%v)", status)
+	}
+	return err
+}
+
+// shardDir creates the shard directories of directory parentID in the
+// writable partitions by turns. The shards are dropped if another client
+// shards the directory first.
+func (mw *MetaWrapper) shardDir(ctx context.Context, parentID uint64) {
+	mp := mw.getPartitionByInode(parentID)
+	if mp == nil {
+		return
+	}
+	status, info, err := mw.iget(ctx, mp, parentID)
+	if err != nil || status != statusOK {
+		return
+	}
+	if len(info.Shards) != 0 {
+		mw.putShards(parentID, info.Shards)
+		return
+	}
+	rwPartitions := mw.getRWPartitions()
+	if len(rwPartitions) == 0 {
+		return
+	}
+
+	shards := make([]uint64, 0, DirShardCount)
+	for i := 0; i < DirShardCount; i++ {
+		status, shard, err := mw.icreate(ctx, rwPartitions[i%len(rwPartitions)], info.Mode, nil, parentID)
+		if err != nil || status != statusOK {
+			break
+		}
+		shards = append(shards, shard.Inode)
+	}
+	if len(shards) == DirShardCount {
+		status, err = mw.setShards(ctx, mp, parentID, shards)
+		if err == nil && status == statusOK {
+			log.LogInfof("shardDir: parentID(%v) shards(%v)", parentID, shards)
+			mw.putShards(parentID, shards)
+			return
+		}
+	}
+	mw.deleteShardDirs(shards)
+}
+
+func (mw *MetaWrapper) deleteShardDirs(shards []uint64) {
+	for _, shard := range shards {
+		mp := mw.getPartitionByInode(shard)
+		if mp == nil {
+			continue
+		}
+		mw.idelete(context.Background(), mp, shard)
+	}
+}
@@ -15,13 +15,13 @@
 package meta
 
 import (
-	"encoding/json"
-	"net/http"
 	"sync/atomic"
 	"time"
 
 	"github.com/juju/errors"
 
+	"github.com/tiglabs/containerfs/proto"
+	"github.com/tiglabs/containerfs/sdk/master"
 	"github.com/tiglabs/containerfs/util/log"
 )
 
@@ -35,69 +35,56 @@ var (
 
 type VolumeView struct {
 	VolName        string
+	Worm           proto.WormPolicy
+	InlineSize     uint32
 	MetaPartitions []*MetaPartition
 }
 
-type ClusterInfo struct {
-	Cluster string
-}
-
-type VolStatInfo struct {
-	Name      string
-	TotalSize uint64
-	UsedSize  uint64
-}
-
 // VolName view managements
 //
 func (mw *MetaWrapper) PullVolumeView() (*VolumeView, error) {
-	params := make(map[string]string)
-	params["name"] = mw.volname
-	body, err := mw.master.Request(http.MethodPost, MetaPartitionViewURL, params, nil)
+	vv, err := mw.mc.GetVol(&master.VolRequest{Name: mw.volname})
 	if err != nil {
 		log.LogWarnf("PullVolumeView request: err(%v)", err)
 		return nil, err
 	}
 
-	view := new(VolumeView)
-	if err = json.Unmarshal(body, view); err != nil {
-		log.LogWarnf("PullVolumeView unmarshal: err(%v) body(%v)", err, string(body))
-		return nil, err
+	view := &VolumeView{
+		VolName:        vv.Name,
+		Worm:           vv.Worm,
+		InlineSize:     vv.InlineSize,
+		MetaPartitions: make([]*MetaPartition, 0, len(vv.MetaPartitions)),
+	}
+	for _, mp := range vv.MetaPartitions {
+		view.MetaPartitions = append(view.MetaPartitions, &MetaPartition{
+			PartitionID: mp.PartitionID,
+			Start:       mp.Start,
+			End:         mp.End,
+			Members:     mp.Members,
+			LeaderAddr:  mp.LeaderAddr,
+			Status:      mp.Status,
+		})
 	}
 	return view, nil
 }
 
 func (mw *MetaWrapper) UpdateClusterInfo() error {
-	body, err := mw.master.Request(http.MethodPost, GetClusterInfoURL, nil, nil)
+	info, err := mw.mc.GetClusterInfo()
 	if err != nil {
 		log.LogWarnf("UpdateClusterInfo request: err(%v)", err)
 		return err
 	}
-
-	info := new(ClusterInfo)
-	if err = json.Unmarshal(body, info); err != nil {
-		log.LogWarnf("UpdateClusterInfo unmarshal: err(%v)", err)
-		return err
-	}
 	log.LogInfof("ClusterInfo: %v", *info)
 	mw.cluster = info.Cluster
 	return nil
 }
 
 func (mw *MetaWrapper) UpdateVolStatInfo() error {
-	params := make(map[string]string)
-	params["name"] = mw.volname
-	body, err := mw.master.Request(http.MethodPost, GetVolStatURL, params, nil)
+	info, err := mw.mc.GetVolStat(&master.VolRequest{Name: mw.volname})
 	if err != nil {
 		log.LogWarnf("UpdateVolStatInfo request: err(%v)", err)
 		return err
 	}
-
-	info := new(VolStatInfo)
-	if err = json.Unmarshal(body, info); err != nil {
-		log.LogWarnf("UpdateVolStatInfo unmarshal: err(%v)", err)
-		return err
-	}
 	log.LogInfof("UpdateVolStatInfo: info(%v)", *info)
 	atomic.StoreUint64(&mw.totalSize, info.TotalSize)
 	atomic.StoreUint64(&mw.usedSize, info.UsedSize)
@@ -110,6 +97,10 @@ func (mw *MetaWrapper) UpdateMetaPartitions() error {
 		return err
 	}
 
+	mw.Lock()
+	mw.worm = nv.Worm
+	mw.inlineSize = nv.InlineSize
+	mw.Unlock()
 	for _, mp := range nv.MetaPartitions {
 		mw.replaceOrInsertPartition(mp)
 		log.LogInfof("UpdateMetaPartition: mp(%v)", mp)
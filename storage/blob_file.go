@@ -71,6 +71,9 @@ func (c *BlobFile) loadTree(name string) (maxOid uint64, err error) {
 
 	tree := NewObjectTree(idxFile)
 	if maxOid, err = tree.Load(); err == nil {
+		err = tree.loadExpires(c.file)
+	}
+	if err == nil {
 		c.tree = tree
 	} else {
 		idxFile.Close()
@@ -193,7 +196,7 @@ func (c *BlobFile) copyValidData(dstNm *ObjectTree, dstDatFile *os.File) (err er
 			return nil
 		}
 
-		realsize := o.Size
+		realsize := uint32(o.MetaSize) + o.Size
 		if newOffset, e = dstDatFile.Seek(0, 2); e != nil {
 			return e
 		}
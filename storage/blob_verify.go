@@ -85,7 +85,7 @@ func WalkIndexFileAndVerify(indexfp *os.File, datafp *os.File, blobFileInfo *Blo
 				continue
 			}
 			data := make([]byte, ni.Size)
-			_, err = datafp.ReadAt(data, int64(ni.Offset))
+			_, err = datafp.ReadAt(data, ni.DataOffset())
 			if err != nil {
 				oi.ErrorMesg = fmt.Sprintf("oi read datafile err %v", err.Error())
 				return
@@ -97,6 +97,13 @@ type Extent interface {
 	// Flush synchronize data to disk immediately.
 	Flush() error
 
+	// Fallocate reserves disk space for range of extent data without changing the extent size.
+	Fallocate(offset, size int64) error
+
+	// PunchHole releases disk space of whole blocks inside range of extent data.
+	// Released blocks read as zeros afterwards.
+	PunchHole(offset, size int64) error
+
 	// MarkDelete mark this extent as deleted.
 	MarkDelete() error
 
@@ -355,6 +362,46 @@ func (e *fsExtent) Read(data []byte, offset, size int64) (crc uint32, err error)
 	return
 }
 
+// Fallocate reserves disk space for range of extent data without changing the extent size.
+func (e *fsExtent) Fallocate(offset, size int64) (err error) {
+	if offset < 0 || size <= 0 || offset+size > util.ExtentSize {
+		return NewParamMismatchErr(fmt.Sprintf("offset=%v size=%v", offset, size))
+	}
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.tryKeepSize(int(e.file.Fd()), offset+util.BlockHeaderSize, size)
+}
+
+// PunchHole releases disk space of whole blocks inside range of extent data.
+// The last block is released as well if the range reaches the end of data.
+func (e *fsExtent) PunchHole(offset, size int64) (err error) {
+	if offset < 0 || size <= 0 {
+		return NewParamMismatchErr(fmt.Sprintf("offset=%v size=%v", offset, size))
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	start := (offset + util.BlockSize - 1) / util.BlockSize * util.BlockSize
+	end := (offset + size) / util.BlockSize * util.BlockSize
+	if offset+size >= e.dataSize {
+		end = e.dataSize
+	}
+	if end <= start {
+		return
+	}
+	if err = e.tryPunchHole(int(e.file.Fd()), start+util.BlockHeaderSize, end-start); err != nil {
+		return
+	}
+	emptyBlock := make([]byte, util.BlockSize)
+	for blockOffset := start; blockOffset < end; blockOffset += util.BlockSize {
+		blockSize := util.Min(util.BlockSize, int(end-blockOffset))
+		crc := crc32.ChecksumIEEE(emptyBlock[:blockSize])
+		if err = e.updateBlockCrc(int(blockOffset/util.BlockSize), crc); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (e *fsExtent) updateBlockCrc(blockNo int, crc uint32) (err error) {
 	startIdx := util.BlockHeaderCrcIndex + blockNo*util.PerBlockCrcSize
 	endIdx := startIdx + util.PerBlockCrcSize
@@ -29,6 +29,7 @@ func (e *fsExtent) tryKeepSize(fd int, off int64, len int64) (err error) {
 }
 
 func (e *fsExtent) tryPunchHole(fd int, off int64, len int64) (err error) {
-	err = syscall.Fallocate(fd, FALLOC_FL_PUNCH_HOLE, off, len)
+	// Linux only supports punching a hole which keeps the file size.
+	err = syscall.Fallocate(fd, FALLOC_FL_PUNCH_HOLE|FALLOC_FL_KEEP_SIZE, off, len)
 	return
 }
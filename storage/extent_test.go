@@ -105,3 +105,43 @@ func TestFsExtent_Validate(t *testing.T) {
 	}
 
 }
+
+func TestFsExtent_PunchHole(t *testing.T) {
+	var err error
+	extent := NewExtentInCore("/tmp/extent_2", 2)
+	if err = extent.InitToFS(2, true); err != nil {
+		panic(err)
+	}
+	defer os.Remove("/tmp/extent_2")
+	defer extent.Close()
+	data := make([]byte, util.BlockSize)
+	for i := range data {
+		data[i] = byte(i%255 + 1)
+	}
+	for blockNo := 0; blockNo < 3; blockNo++ {
+		if err = extent.Write(data, int64(blockNo*util.BlockSize), util.BlockSize, crc32.ChecksumIEEE(data)); err != nil {
+			panic(err)
+		}
+	}
+	// Only the second block is fully covered by the hole.
+	if err = extent.PunchHole(util.BlockSize/2, util.BlockSize*2); err != nil {
+		t.Skipf("punch hole not supported: %v", err)
+	}
+	if extent.Size() != 3*util.BlockSize {
+		t.Fatalf("size act[%v] and exp[%v]", extent.Size(), 3*util.BlockSize)
+	}
+	readBuff := make([]byte, util.BlockSize)
+	expects := [][]byte{data, make([]byte, util.BlockSize), data}
+	for blockNo, expect := range expects {
+		crc, err := extent.Read(readBuff, int64(blockNo*util.BlockSize), util.BlockSize)
+		if err != nil {
+			t.Fatalf("read block %v: %v", blockNo, err)
+		}
+		if !bytes.Equal(readBuff, expect) {
+			t.Fatalf("block %v data mismatch", blockNo)
+		}
+		if crc != crc32.ChecksumIEEE(expect) {
+			t.Fatalf("block %v crc act[%8x] and exp[%8x]", blockNo, crc, crc32.ChecksumIEEE(expect))
+		}
+	}
+}
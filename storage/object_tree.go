@@ -23,6 +23,7 @@ import (
 
 	"os"
 
+	"github.com/tiglabs/containerfs/proto"
 	"github.com/tiglabs/containerfs/util/btree"
 )
 
@@ -30,13 +31,19 @@ const (
 	ObjectHeaderSize = 24
 	IndexBatchRead   = 1024
 	MarkDeleteObject = math.MaxUint32
+	// The offset field of an index record keeps MetaSize above the offset.
+	ObjectOffsetBits = 48
+	ObjectOffsetMask = 1<<ObjectOffsetBits - 1
 )
 
+// Object is the index record of an object. The metadata of the object, if
+// any, is stored at Offset in front of its data, Size and Crc are of the data.
 type Object struct {
-	Oid    uint64
-	Offset uint64
-	Size   uint32
-	Crc    uint32
+	Oid      uint64
+	Offset   uint64
+	Size     uint32
+	Crc      uint32
+	MetaSize uint16
 }
 
 func (o Object) Less(than btree.Item) bool {
@@ -46,19 +53,26 @@ func (o Object) Less(than btree.Item) bool {
 
 func (o *Object) Marshal(out []byte) {
 	binary.BigEndian.PutUint64(out[0:8], o.Oid)
-	binary.BigEndian.PutUint64(out[8:16], o.Offset)
+	binary.BigEndian.PutUint64(out[8:16], uint64(o.MetaSize)<<ObjectOffsetBits|o.Offset)
 	binary.BigEndian.PutUint32(out[16:20], o.Size)
 	binary.BigEndian.PutUint32(out[20:ObjectHeaderSize], o.Crc)
 }
 
 func (o *Object) Unmarshal(in []byte) {
 	o.Oid = binary.BigEndian.Uint64(in[0:8])
-	o.Offset = binary.BigEndian.Uint64(in[8:16])
+	offset := binary.BigEndian.Uint64(in[8:16])
+	o.Offset = offset & ObjectOffsetMask
+	o.MetaSize = uint16(offset >> ObjectOffsetBits)
 	o.Size = binary.BigEndian.Uint32(in[16:20])
 	o.Crc = binary.BigEndian.Uint32(in[20:ObjectHeaderSize])
 	return
 }
 
+// DataOffset returns the offset of the data of the object in the blob file.
+func (o *Object) DataOffset() int64 {
+	return int64(o.Offset) + int64(o.MetaSize)
+}
+
 type treeStat struct {
 	fileCount   uint32
 	deleteCount uint32
@@ -70,6 +84,7 @@ type ObjectTree struct {
 	idxFile *os.File
 	idxLock sync.Mutex
 	tree    *btree.BTree
+	expires map[uint64]int64 // expire time in unix seconds by oid
 	treeStat
 }
 
@@ -79,7 +94,8 @@ func (tree *ObjectTree) FileBytes() uint64 {
 
 func NewObjectTree(f *os.File) *ObjectTree {
 	tree := &ObjectTree{
-		tree: btree.New(32),
+		tree:    btree.New(32),
+		expires: make(map[uint64]int64),
 	}
 	tree.idxFile = f
 	return tree
@@ -89,8 +105,8 @@ func NewObjectTree(f *os.File) *ObjectTree {
 // guarantee there is no write and delete operations on this needle map
 func (tree *ObjectTree) Load() (maxOid uint64, err error) {
 	f := tree.idxFile
-	maxOid, err = LoopIndexFile(f, func(oid, offset uint64, size, crc uint32) error {
-		o := Object{Oid: oid, Offset: offset, Size: size, Crc: crc}
+	maxOid, err = loopIndexObjects(f, func(o Object) error {
+		oid, size := o.Oid, o.Size
 		if oid > 0 && size != MarkDeleteObject {
 			tree.idxLock.Lock()
 			found := tree.tree.ReplaceOrInsert(o)
@@ -115,12 +131,41 @@ func (tree *ObjectTree) Load() (maxOid uint64, err error) {
 	return
 }
 
+// loadExpires reads the expire times of the objects from their metadata in
+// the data file f.
+func (tree *ObjectTree) loadExpires(f *os.File) (err error) {
+	objects := make([]Object, 0)
+	tree.tree.Ascend(func(i btree.Item) bool {
+		if o := i.(Object); o.MetaSize > 0 {
+			objects = append(objects, o)
+		}
+		return true
+	})
+	for _, o := range objects {
+		meta := make([]byte, o.MetaSize)
+		if _, err = f.ReadAt(meta, int64(o.Offset)); err != nil {
+			return
+		}
+		if expire := proto.BlobMetaExpireTime(meta); expire > 0 {
+			tree.expires[o.Oid] = expire
+		}
+	}
+	return
+}
+
 func (o *Object) Check(offset uint64, size, crc uint32) bool {
 	return o.Oid != 0 && o.Offset == offset && o.Crc == crc &&
 		(o.Size == size || size == MarkDeleteObject)
 }
 
 func LoopIndexFile(f *os.File, fn func(oid, offset uint64, size, crc uint32) error) (maxOid uint64, err error) {
+	return loopIndexObjects(f, func(o Object) error {
+		return fn(o.Oid, o.Offset, o.Size, o.Crc)
+	})
+}
+
+// loopIndexObjects is LoopIndexFile with the whole index records.
+func loopIndexObjects(f *os.File, fn func(o Object) error) (maxOid uint64, err error) {
 	var (
 		readOff int64
 		count   int
@@ -138,7 +183,7 @@ func LoopIndexFile(f *os.File, fn func(oid, offset uint64, size, crc uint32) err
 			if maxOid < o.Oid {
 				maxOid = o.Oid
 			}
-			if e := fn(o.Oid, o.Offset, o.Size, o.Crc); e != nil {
+			if e := fn(*o); e != nil {
 				return maxOid, e
 			}
 		}
@@ -155,12 +200,13 @@ func LoopIndexFile(f *os.File, fn func(oid, offset uint64, size, crc uint32) err
 	return maxOid, err
 }
 
-func (tree *ObjectTree) set(oid, offset uint64, size, crc uint32) (oldOff uint64, oldSize uint32, err error) {
+func (tree *ObjectTree) set(oid, offset uint64, size, crc uint32, metaSize uint16) (oldOff uint64, oldSize uint32, err error) {
 	o := &Object{
-		Oid:    oid,
-		Offset: offset,
-		Size:   size,
-		Crc:    crc,
+		Oid:      oid,
+		Offset:   offset,
+		Size:     size,
+		Crc:      crc,
+		MetaSize: metaSize,
 	}
 
 	tree.idxLock.Lock()
@@ -201,12 +247,32 @@ func (tree *ObjectTree) delete(oid uint64) error {
 	}
 	o := found.(Object)
 	tree.decreaseSize(o.Size)
+	delete(tree.expires, oid)
 	o.Size = MarkDeleteObject
 	tree.idxLock.Unlock()
 
 	return tree.appendToIdxFile(&o)
 }
 
+// setExpire records that the object expires at expire in unix seconds.
+func (tree *ObjectTree) setExpire(oid uint64, expire int64) {
+	tree.idxLock.Lock()
+	tree.expires[oid] = expire
+	tree.idxLock.Unlock()
+}
+
+// expired returns the objects expired at now in unix seconds.
+func (tree *ObjectTree) expired(now int64) (oids []uint64) {
+	tree.idxLock.Lock()
+	defer tree.idxLock.Unlock()
+	for oid, expire := range tree.expires {
+		if expire <= now {
+			oids = append(oids, oid)
+		}
+	}
+	return
+}
+
 func (tree *ObjectTree) checkConsistency(oid, offset uint64, size uint32) bool {
 	o, ok := tree.get(oid)
 	if !ok || o.Offset != offset || o.Size != size {
@@ -19,7 +19,9 @@ import (
 	"time"
 
 	"fmt"
+	"hash/crc32"
 	"io/ioutil"
+	"math"
 	"strconv"
 
 	"github.com/juju/errors"
@@ -134,9 +136,18 @@ func (s *BlobStore) WriteDeleteDentry(objectId uint64, blobfileId int, crc uint3
 }
 
 func (s *BlobStore) Write(fileId uint32, objectId uint64, size int64, data []byte, crc uint32) (err error) {
+	return s.WriteObject(fileId, objectId, nil, data[:size], crc)
+}
+
+// WriteObject writes an object with its metadata, which is stored in front
+// of the data, crc is the crc of the data.
+func (s *BlobStore) WriteObject(fileId uint32, objectId uint64, meta, data []byte, crc uint32) (err error) {
 	var (
 		fi os.FileInfo
 	)
+	if len(meta) > math.MaxUint16 {
+		return ErrorParamMismatch
+	}
 	blobfileId := int(fileId)
 	c, ok := s.blobfiles[blobfileId]
 	if !ok {
@@ -159,22 +170,34 @@ func (s *BlobStore) Write(fileId uint32, objectId uint64, size int64, data []byt
 		return
 	}
 
+	// the file is opened with O_APPEND, so the object is written at its end
 	newOffset := fi.Size()
-	if _, err = c.file.WriteAt(data[:size], newOffset); err != nil {
+	if len(meta) > 0 {
+		if _, err = c.file.Write(meta); err != nil {
+			return
+		}
+	}
+	if _, err = c.file.Write(data); err != nil {
 		return
 	}
 
-	if _, _, err = c.tree.set(objectId, uint64(newOffset), uint32(size), crc); err == nil {
+	if _, _, err = c.tree.set(objectId, uint64(newOffset), uint32(len(data)), crc, uint16(len(meta))); err == nil {
 		if c.loadLastOid() < objectId {
 			c.storeLastOid(objectId)
 		}
+		if expire := proto.BlobMetaExpireTime(meta); expire > 0 {
+			c.tree.setExpire(objectId, expire)
+		}
 	}
 	return
 }
 
-func (s *BlobStore) Read(fileId uint32, offset, size int64, nbuf []byte) (crc uint32, err error) {
+// Read reads size bytes at offset of the object into nbuf. Reading the whole
+// object returns the crc stored with it, reading a range of the object
+// returns the crc of the data read, as the stored one covers the whole object.
+func (s *BlobStore) Read(fileId uint32, oid, offset, size int64, nbuf []byte) (crc uint32, err error) {
 	blobfileId := int(fileId)
-	objectId := uint64(offset)
+	objectId := uint64(oid)
 	c, ok := s.blobfiles[blobfileId]
 	if !ok {
 		return 0, ErrorFileNotFound
@@ -198,18 +221,45 @@ func (s *BlobStore) Read(fileId uint32, offset, size int64, nbuf []byte) (crc ui
 		return 0, ErrorObjNotFound
 	}
 
-	if int64(o.Size) != size || int64(o.Offset)+size > fi.Size() {
+	if offset < 0 || size < 0 || offset+size > int64(o.Size) || o.DataOffset()+offset+size > fi.Size() {
 		return 0, ErrorParamMismatch
 	}
 
-	if _, err = c.file.ReadAt(nbuf[:size], int64(o.Offset)); err != nil {
+	if _, err = c.file.ReadAt(nbuf[:size], o.DataOffset()+offset); err != nil {
 		return
 	}
-	crc = o.Crc
+	if offset == 0 && size == int64(o.Size) {
+		crc = o.Crc
+	} else {
+		crc = crc32.ChecksumIEEE(nbuf[:size])
+	}
 
 	return
 }
 
+// ReadMeta reads the metadata of the object, which is empty if the object
+// is written without any.
+func (s *BlobStore) ReadMeta(fileId uint32, oid int64) (meta []byte, err error) {
+	c, ok := s.blobfiles[int(fileId)]
+	if !ok {
+		return nil, ErrorFileNotFound
+	}
+
+	c.commitLock.RLock()
+	defer c.commitLock.RUnlock()
+
+	o, ok := c.tree.get(uint64(oid))
+	if !ok {
+		return nil, ErrorObjNotFound
+	}
+	meta = make([]byte, o.MetaSize)
+	if o.MetaSize == 0 {
+		return
+	}
+	_, err = c.file.ReadAt(meta, int64(o.Offset))
+	return
+}
+
 func (s *BlobStore) Sync(fileId uint32) (err error) {
 	blobfileId := (int)(fileId)
 	c, ok := s.blobfiles[blobfileId]
@@ -354,6 +404,16 @@ func (s *BlobStore) GetObject(fileId uint32, objectId uint64) (o *Object, err er
 	return
 }
 
+// GetExpiredObjects returns the objects of the blob file expired at now in
+// unix seconds.
+func (s *BlobStore) GetExpiredObjects(fileId uint32, now int64) (objects []uint64) {
+	c, ok := s.blobfiles[int(fileId)]
+	if !ok {
+		return
+	}
+	return c.tree.expired(now)
+}
+
 func (s *BlobStore) GetDelObjects(fileId uint32) (objects []uint64) {
 	objects = make([]uint64, 0)
 	c, ok := s.blobfiles[int(fileId)]
@@ -0,0 +1,139 @@
+// Copyright 2018 The Containerfs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tiglabs/raft/util"
+)
+
+func TestBlobStore_ReadRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewBlobStore(dir, 20*util.MB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.DeleteStore()
+
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	crc := crc32.ChecksumIEEE(data)
+	// another object first, so that the object is not at the start of the file
+	if err = s.Write(1, 1, 3, []byte("abc"), crc32.ChecksumIEEE([]byte("abc"))); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(1, 2, int64(len(data)), data, crc); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(data))
+	if c, err := s.Read(1, 2, 0, int64(len(data)), buf); err != nil || c != crc || !bytes.Equal(buf, data) {
+		t.Fatalf("whole: crc(%v) data(%q) err(%v)", c, buf, err)
+	}
+	for _, r := range [][2]int64{{0, 3}, {4, 5}, {40, 3}, {43, 0}} {
+		want := data[r[0] : r[0]+r[1]]
+		c, err := s.Read(1, 2, r[0], r[1], buf)
+		if err != nil || c != crc32.ChecksumIEEE(want) || !bytes.Equal(buf[:r[1]], want) {
+			t.Fatalf("range %v: crc(%v) data(%q) err(%v)", r, c, buf[:r[1]], err)
+		}
+	}
+	for _, r := range [][2]int64{{-1, 3}, {41, 3}, {44, 0}} {
+		if _, err := s.Read(1, 2, r[0], r[1], buf); err != ErrorParamMismatch {
+			t.Fatalf("range %v: err(%v)", r, err)
+		}
+	}
+}
+
+func TestBlobStore_Meta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewBlobStore(dir, 20*util.MB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.DeleteStore()
+
+	meta, data := []byte(`{"content-type":"image/png"}`), []byte("data")
+	crc := crc32.ChecksumIEEE(data)
+	if err = s.WriteObject(1, 1, meta, data, crc); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(1, 2, 3, []byte("abc"), crc32.ChecksumIEEE([]byte("abc"))); err != nil {
+		t.Fatal(err)
+	}
+	// the metadata is kept in the index file across reloads
+	s.blobfiles[1].file.Close()
+	s.blobfiles[1].tree.idxFile.Close()
+	if s.blobfiles[1], err = NewBlobFile(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(data))
+	if c, err := s.Read(1, 1, 0, int64(len(data)), buf); err != nil || c != crc || !bytes.Equal(buf, data) {
+		t.Fatalf("read: crc(%v) data(%q) err(%v)", c, buf, err)
+	}
+	if m, err := s.ReadMeta(1, 1); err != nil || !bytes.Equal(m, meta) {
+		t.Fatalf("read meta: meta(%q) err(%v)", m, err)
+	}
+	if m, err := s.ReadMeta(1, 2); err != nil || len(m) != 0 {
+		t.Fatalf("read empty meta: meta(%q) err(%v)", m, err)
+	}
+	if _, err := s.ReadMeta(1, 3); err != ErrorObjNotFound {
+		t.Fatalf("read meta of missing object: err(%v)", err)
+	}
+}
+
+func TestBlobStore_Expire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewBlobStore(dir, 20*util.MB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.DeleteStore()
+
+	data := []byte("data")
+	crc := crc32.ChecksumIEEE(data)
+	for i, meta := range []string{`{"cfs-expire":"100"}`, `{"cfs-expire":"200"}`, `{"a":"b"}`} {
+		if err = s.WriteObject(1, uint64(i+1), []byte(meta), data, crc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if oids := s.GetExpiredObjects(1, 150); len(oids) != 1 || oids[0] != 1 {
+		t.Fatalf("expired at 150: %v", oids)
+	}
+	if err = s.MarkDelete(1, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the expire times are loaded from the metadata
+	s.blobfiles[1].file.Close()
+	s.blobfiles[1].tree.idxFile.Close()
+	if s.blobfiles[1], err = NewBlobFile(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	if oids := s.GetExpiredObjects(1, 300); len(oids) != 1 || oids[0] != 2 {
+		t.Fatalf("expired at 300: %v", oids)
+	}
+}
@@ -320,6 +320,43 @@ func (s *ExtentStore) Read(extentId uint64, offset, size int64, nbuf []byte) (cr
 	return
 }
 
+func (s *ExtentStore) Fallocate(extentId uint64, offset, size int64) (err error) {
+	var extent Extent
+	if extent, err = s.getExtent(extentId); err != nil {
+		return
+	}
+	if extent.IsMarkDelete() {
+		return ErrorHasDelete
+	}
+	return extent.Fallocate(offset, size)
+}
+
+func (s *ExtentStore) PunchHole(extentId uint64, offset, size int64) (err error) {
+	var (
+		extent     Extent
+		extentInfo *FileInfo
+		has        bool
+	)
+	s.extentInfoMux.RLock()
+	extentInfo, has = s.extentInfoMap[extentId]
+	s.extentInfoMux.RUnlock()
+	if !has {
+		err = fmt.Errorf("extent %v not exist", extentId)
+		return
+	}
+	if extent, err = s.getExtent(extentId); err != nil {
+		return
+	}
+	if extent.IsMarkDelete() {
+		return ErrorHasDelete
+	}
+	if err = extent.PunchHole(offset, size); err != nil {
+		return
+	}
+	extentInfo.FromExtent(extent)
+	return
+}
+
 func (s *ExtentStore) MarkDelete(extentId uint64) (err error) {
 	var (
 		extent     Extent
@@ -22,6 +22,7 @@ import (
 	"hash/crc32"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +32,18 @@ var (
 	ErrNoValidMaster = errors.New("no valid master")
 )
 
+// MasterError is returned when a master answered a request with a status
+// other than OK or a leader redirect, it keeps the message of the master.
+type MasterError struct {
+	Addr   string
+	Status int
+	Msg    string
+}
+
+func (e *MasterError) Error() string {
+	return fmt.Sprintf("master[%v] status[%v] %v", e.Addr, e.Status, e.Msg)
+}
+
 type MasterHelper interface {
 	AddNode(address string)
 	Nodes() []string
@@ -66,6 +79,8 @@ func (helper *masterHelper) Request(method, path string, param map[string]string
 }
 
 func (helper *masterHelper) request(method, path string, param map[string]string, reqData []byte) (repsData []byte, err error) {
+	var masterErr *MasterError
+loop:
 	for i := 0; i < len(helper.masters); i++ {
 		var index int
 		if i+int(helper.leaderIdx) < len(helper.masters) {
@@ -100,6 +115,10 @@ func (helper *masterHelper) request(method, path string, param map[string]string
 				return
 			}
 			helper.updateMaster(curMasterAddr)
+			// The leader has been tried already, keep its answer.
+			if helper.skipMarks.Has(int(crc32.ChecksumIEEE([]byte(curMasterAddr)))) {
+				break loop
+			}
 			repsData, err = helper.request(method, path, param, reqData)
 			return
 		case http.StatusOK:
@@ -107,9 +126,15 @@ func (helper *masterHelper) request(method, path string, param map[string]string
 		default:
 			log.LogErrorf("action[request] master[%v] uri[%v] statusCode[%v] respBody[%v].",
 				resp.Request.URL.String(), masterAddr, stateCode, string(repsData))
+			masterErr = &MasterError{Addr: masterAddr, Status: stateCode, Msg: strings.TrimSpace(string(repsData))}
 			continue
 		}
 	}
+	repsData = nil
+	if masterErr != nil {
+		err = masterErr
+		return
+	}
 	err = ErrNoValidMaster
 	return
 }
@@ -155,9 +180,9 @@ func (helper *masterHelper) updateMaster(address string) {
 	}
 }
 
-func (helper *masterHelper) mergeRequestUrl(url string, params map[string]string) string {
+func (helper *masterHelper) mergeRequestUrl(reqUrl string, params map[string]string) string {
 	if params != nil && len(params) > 0 {
-		buff := bytes.NewBuffer([]byte(url))
+		buff := bytes.NewBuffer([]byte(reqUrl))
 		firstParam := true
 		for k, v := range params {
 			if firstParam {
@@ -166,13 +191,13 @@ func (helper *masterHelper) mergeRequestUrl(url string, params map[string]string
 			} else {
 				buff.WriteString("&")
 			}
-			buff.WriteString(k)
+			buff.WriteString(url.QueryEscape(k))
 			buff.WriteString("=")
-			buff.WriteString(v)
+			buff.WriteString(url.QueryEscape(v))
 		}
 		return buff.String()
 	}
-	return url
+	return reqUrl
 }
 
 func NewMasterHelper() MasterHelper {